@@ -7,6 +7,7 @@
 package addrmgr
 
 import (
+	"bytes"
 	"container/list"
 	crand "crypto/rand" // for seeding
 	"encoding/base32"
@@ -14,6 +15,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
@@ -26,16 +28,21 @@ import (
 
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
 	"github.com/CommerciumBlockchain/cmmd/wire"
+	"golang.org/x/crypto/sha3"
 )
 
 // PeersFilename is the default filename to store serialized peers.
 const PeersFilename = "peers.json"
 
+// AnchorsFilename is the default filename to store the anchor peers.
+const AnchorsFilename = "anchors.json"
+
 // AddrManager provides a concurrency safe address manager for caching potential
 // peers on the Commercium network.
 type AddrManager struct {
 	mtx            sync.Mutex                               // main mutex used to sync methods
 	peersFile      string                                   // path of file to store peers in
+	anchorsFile    string                                   // path of file to store anchors in
 	lookupFunc     func(string) ([]net.IP, error)           // for DNS lookups
 	rand           *rand.Rand                               // internal PRNG
 	key            [32]byte                                 // cryptographically secure random bytes
@@ -51,6 +58,7 @@ type AddrManager struct {
 	nNew           int                                      // number of new addresses (i.e., not tried)
 	lamtx          sync.Mutex                               // local address mutex
 	localAddresses map[string]*localAddress                 // address key to la for all local addresses
+	cjdnsReachable bool                                     // treat fc00::/8 as CJDNS
 }
 
 type serializedKnownAddress struct {
@@ -545,6 +553,63 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 	return nil
 }
 
+// SaveAnchors saves the addresses of the passed anchor peers, which are the
+// outbound block-relay-only peers the node is connected to when it shuts down,
+// so they can be reconnected to at next run.
+func (a *AddrManager) SaveAnchors(anchors []*wire.NetAddress) error {
+	addrs := make([]string, 0, len(anchors))
+	for _, na := range anchors {
+		addrs = append(addrs, NetAddressKey(na))
+	}
+
+	// Write temporary anchors file and then move it into place.
+	tmpfile := a.anchorsFile + ".new"
+	w, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(addrs); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, a.anchorsFile)
+}
+
+// LoadAnchors returns the addresses of the anchor peers saved by SaveAnchors
+// during the previous run.  The anchors file is removed once it has been read
+// so the node does not keep reconnecting to anchors which cause it to crash.
+func (a *AddrManager) LoadAnchors() ([]*wire.NetAddress, error) {
+	b, err := ioutil.ReadFile(a.anchorsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(a.anchorsFile); err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	if err := json.Unmarshal(b, &addrs); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", a.anchorsFile,
+			err)
+	}
+	anchors := make([]*wire.NetAddress, 0, len(addrs))
+	for _, addr := range addrs {
+		na, err := a.DeserializeNetAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize netaddress "+
+				"%s: %v", addr, err)
+		}
+		anchors = append(anchors, na)
+	}
+	return anchors, nil
+}
+
 // DeserializeNetAddress converts a given address string to a *wire.NetAddress
 func (a *AddrManager) DeserializeNetAddress(addr string) (*wire.NetAddress, error) {
 	host, portStr, err := net.SplitHostPort(addr)
@@ -708,16 +773,41 @@ func (a *AddrManager) reset() {
 	a.addrChanged = true
 }
 
+// SetCJDNSReachable sets whether or not CJDNS addresses are reachable by the
+// local node.  When they are, hosts in the fc00::/8 range are treated as CJDNS
+// addresses instead of unroutable unique local IPv6 addresses.  It must be
+// called before Start so addresses loaded from the peers file are treated the
+// same way.
+func (a *AddrManager) SetCJDNSReachable(reachable bool) {
+	a.cjdnsReachable = reachable
+}
+
+// base32NoPadding is the base32 encoding used by Tor v3 and I2P addresses.
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// torV3Version is the version byte encoded in Tor v3 .onion addresses.
+const torV3Version = 0x03
+
+// torV3Checksum returns the checksum encoded in the Tor v3 .onion address of
+// the passed public key.
+func torV3Checksum(pubKey []byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{torV3Version})
+	return h.Sum(nil)[:2]
+}
+
 // HostToNetAddress returns a netaddress given a host address. If the address is
-// a Tor .onion address this will be taken care of. Else if the host is not an
-// IP address it will be resolved (via Tor if required).
+// a Tor .onion or I2P .b32.i2p address this will be taken care of. Else if the
+// host is not an IP address it will be resolved (via Tor if required).
 func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.ServiceFlag) (*wire.NetAddress, error) {
-	// Tor address is 16 char base32 + ".onion"
+	// go base32 encoding uses capitals (as does the rfc but Tor, I2P and
+	// bitcoind tend to use lowercase, so we switch case when decoding.
 	var ip net.IP
-	if len(host) == 22 && host[16:] == ".onion" {
-		// go base32 encoding uses capitals (as does the rfc
-		// but Tor and bitcoind tend to user lowercase, so we switch
-		// case here.
+	switch {
+	// Tor v2 address is 16 char base32 + ".onion"
+	case len(host) == 22 && host[16:] == ".onion":
 		data, err := base32.StdEncoding.DecodeString(
 			strings.ToUpper(host[:16]))
 		if err != nil {
@@ -725,28 +815,82 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.S
 		}
 		prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
 		ip = net.IP(append(prefix, data...))
-	} else if ip = net.ParseIP(host); ip == nil {
-		ips, err := a.lookupFunc(host)
+
+	// Tor v3 address is 56 char base32 of the 32 byte public key, 2 byte
+	// checksum and version byte + ".onion"
+	case len(host) == 62 && host[56:] == ".onion":
+		data, err := base32NoPadding.DecodeString(
+			strings.ToUpper(host[:56]))
+		if err != nil {
+			return nil, err
+		}
+		pubKey, checksum, version := data[:32], data[32:34], data[34]
+		if version != torV3Version ||
+			!bytes.Equal(checksum, torV3Checksum(pubKey)) {
+
+			return nil, fmt.Errorf("invalid Tor v3 address %s", host)
+		}
+		na := wire.NewNetAddressIPPort(nil, port, services)
+		na.Network = wire.NetworkTorV3
+		na.Addr = pubKey
+		return na, nil
+
+	// I2P address is 52 char base32 of the 32 byte destination hash +
+	// ".b32.i2p"
+	case len(host) == 60 && host[52:] == ".b32.i2p":
+		data, err := base32NoPadding.DecodeString(
+			strings.ToUpper(host[:52]))
 		if err != nil {
 			return nil, err
 		}
-		if len(ips) == 0 {
-			return nil, fmt.Errorf("no addresses found for %s", host)
+		na := wire.NewNetAddressIPPort(nil, port, services)
+		na.Network = wire.NetworkI2P
+		na.Addr = data
+		return na, nil
+
+	default:
+		if ip = net.ParseIP(host); ip == nil {
+			ips, err := a.lookupFunc(host)
+			if err != nil {
+				return nil, err
+			}
+			if len(ips) == 0 {
+				return nil, fmt.Errorf("no addresses found for %s",
+					host)
+			}
+			ip = ips[0]
 		}
-		ip = ips[0]
 	}
 
-	return wire.NewNetAddressIPPort(ip, port, services), nil
+	na := wire.NewNetAddressIPPort(ip, port, services)
+	if a.cjdnsReachable && cjdnsNet.Contains(ip) {
+		na.Network = wire.NetworkCJDNS
+	}
+	return na, nil
 }
 
 // ipString returns a string for the ip from the provided NetAddress. If the
 // ip is in the range used for Tor addresses then it will be transformed into
-// the relevant .onion address.
+// the relevant .onion address.  Tor v3 and I2P addresses are transformed into
+// their .onion and .b32.i2p addresses respectively.
 func ipString(na *wire.NetAddress) string {
-	if isOnionCatTor(na) {
+	switch {
+	case isOnionCatTor(na):
 		// We know now that na.IP is long enogh.
 		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
 		return strings.ToLower(base32) + ".onion"
+
+	case isTorV3(na):
+		data := make([]byte, 0, len(na.Addr)+3)
+		data = append(data, na.Addr...)
+		data = append(data, torV3Checksum(na.Addr)...)
+		data = append(data, torV3Version)
+		return strings.ToLower(base32NoPadding.EncodeToString(data)) +
+			".onion"
+
+	case isI2P(na):
+		return strings.ToLower(base32NoPadding.EncodeToString(na.Addr)) +
+			".b32.i2p"
 	}
 
 	return na.IP.String()
@@ -1007,8 +1151,8 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 		return Unreachable
 	}
 
-	if isOnionCatTor(remoteAddr) {
-		if isOnionCatTor(localAddr) {
+	if isOnionCatTor(remoteAddr) || isTorV3(remoteAddr) {
+		if isOnionCatTor(localAddr) || isTorV3(localAddr) {
 			return Private
 		}
 
@@ -1019,6 +1163,19 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 		return Default
 	}
 
+	if isI2P(remoteAddr) || isCJDNS(remoteAddr) {
+		if localAddr.NetworkID() == remoteAddr.NetworkID() {
+			return Private
+		}
+		return Unreachable
+	}
+
+	// Addresses on the remaining overlay networks are not reachable from
+	// peers on other networks.
+	if isTorV3(localAddr) || isI2P(localAddr) || isCJDNS(localAddr) {
+		return Unreachable
+	}
+
 	if isRFC4380(remoteAddr) {
 		if !IsRoutable(localAddr) {
 			return Default
@@ -1088,15 +1245,15 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 		}
 	}
 	if bestAddress != nil {
-		log.Debugf("Suggesting address %s:%d for %s:%d", bestAddress.IP,
-			bestAddress.Port, remoteAddr.IP, remoteAddr.Port)
+		log.Debugf("Suggesting address %s for %s",
+			NetAddressKey(bestAddress), NetAddressKey(remoteAddr))
 	} else {
-		log.Debugf("No worthy address for %s:%d", remoteAddr.IP,
-			remoteAddr.Port)
+		log.Debugf("No worthy address for %s", NetAddressKey(remoteAddr))
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if !isIPv4(remoteAddr) && !isOnionCatTor(remoteAddr) {
+		if !isIPv4(remoteAddr) && !isOnionCatTor(remoteAddr) &&
+			!isTorV3(remoteAddr) {
 			ip = net.IPv6zero
 		} else {
 			ip = net.IPv4zero
@@ -1113,6 +1270,7 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
 	am := AddrManager{
 		peersFile:      filepath.Join(dataDir, PeersFilename),
+		anchorsFile:    filepath.Join(dataDir, AnchorsFilename),
 		lookupFunc:     lookupFunc,
 		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		quit:           make(chan struct{}),
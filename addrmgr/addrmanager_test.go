@@ -522,3 +522,132 @@ func TestCorruptPeersFile(t *testing.T) {
 		t.Fatalf("Corrupt peers file has not been removed: %s", peersFile)
 	}
 }
+
+// TestAddrV2Addresses ensures Tor v3, I2P and CJDNS hosts are parsed into
+// addresses on their networks, are keyed by their host, and survive a round
+// trip through the peers file.
+func TestAddrV2Addresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testaddrv2addresses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	amgr := addrmgr.New(dir, lookupFunc)
+	amgr.SetCJDNSReachable(true)
+	amgr.Start()
+
+	tests := []struct {
+		host    string
+		network wire.NetworkID
+	}{
+		{"duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion",
+			wire.NetworkTorV3},
+		{"ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p",
+			wire.NetworkI2P},
+		{"fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa", wire.NetworkCJDNS},
+	}
+	src := wire.NewNetAddressIPPort(net.ParseIP(someIP), 8333, 0)
+	wantKeys := make(map[string]struct{})
+	for _, test := range tests {
+		na, err := amgr.HostToNetAddress(test.host, 8333,
+			wire.SFNodeNetwork)
+		if err != nil {
+			t.Fatalf("HostToNetAddress %s: unexpected error: %v",
+				test.host, err)
+		}
+		if na.NetworkID() != test.network || !addrmgr.IsRoutable(na) {
+			t.Fatalf("HostToNetAddress %s: got routable %v address "+
+				"on network %v, want %v", test.host,
+				addrmgr.IsRoutable(na), na.NetworkID(), test.network)
+		}
+		key := net.JoinHostPort(test.host, "8333")
+		if got := addrmgr.NetAddressKey(na); got != key {
+			t.Fatalf("NetAddressKey: got %s, want %s", got, key)
+		}
+		wantKeys[key] = struct{}{}
+		amgr.AddAddress(na, src)
+	}
+
+	// Ensure Tor v3 addresses with a bad checksum are rejected.
+	_, err = amgr.HostToNetAddress("duckduckgogg42xjoc72x3sjasowoarfbgcmvf"+
+		"imaftt6twagswzczaa.onion", 8333, wire.SFNodeNetwork)
+	if err == nil {
+		t.Fatal("HostToNetAddress: accepted Tor v3 address with a bad " +
+			"checksum")
+	}
+
+	if err := amgr.Stop(); err != nil {
+		t.Fatalf("Address Manager failed to stop: %v", err)
+	}
+
+	// Start the address manager again to read the peers file and ensure
+	// all addresses were restored on their networks.
+	amgr = addrmgr.New(dir, lookupFunc)
+	amgr.SetCJDNSReachable(true)
+	amgr.Start()
+	defer amgr.Stop()
+	if n := amgr.NumAddresses(); n != len(tests) {
+		t.Fatalf("NumAddresses: got %d addresses, want %d", n,
+			len(tests))
+	}
+	for i := 0; i < 20; i++ {
+		na := amgr.GetAddress().NetAddress()
+		key := addrmgr.NetAddressKey(na)
+		if _, ok := wantKeys[key]; !ok || !addrmgr.IsRoutable(na) {
+			t.Fatalf("GetAddress: unexpected address %s", key)
+		}
+	}
+}
+
+// TestAnchors ensures the anchor peers saved by SaveAnchors are returned by
+// LoadAnchors only once.
+func TestAnchors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testanchors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	amgr := addrmgr.New(dir, lookupFunc)
+
+	// Ensure there are no anchors before any are saved.
+	anchors, err := amgr.LoadAnchors()
+	if err != nil || len(anchors) != 0 {
+		t.Fatalf("LoadAnchors: got %v (err %v), want no anchors",
+			anchors, err)
+	}
+
+	want := []*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"), 8333,
+			wire.SFNodeNetwork),
+		wire.NewNetAddressIPPort(net.ParseIP("2001:470::1"), 9657,
+			wire.SFNodeNetwork),
+	}
+	if err := amgr.SaveAnchors(want); err != nil {
+		t.Fatalf("SaveAnchors: unexpected error: %v", err)
+	}
+	anchors, err = addrmgr.New(dir, lookupFunc).LoadAnchors()
+	if err != nil {
+		t.Fatalf("LoadAnchors: unexpected error: %v", err)
+	}
+	if len(anchors) != len(want) {
+		t.Fatalf("LoadAnchors: got %d anchors, want %d", len(anchors),
+			len(want))
+	}
+	for i, na := range anchors {
+		if addrmgr.NetAddressKey(na) != addrmgr.NetAddressKey(want[i]) {
+			t.Fatalf("LoadAnchors: got anchor %s, want %s",
+				addrmgr.NetAddressKey(na),
+				addrmgr.NetAddressKey(want[i]))
+		}
+	}
+
+	// Ensure the anchors are removed once loaded.
+	if _, err := os.Stat(filepath.Join(dir, addrmgr.AnchorsFilename)); !os.IsNotExist(err) {
+		t.Fatalf("anchors file not removed after loading: %v", err)
+	}
+	anchors, err = amgr.LoadAnchors()
+	if err != nil || len(anchors) != 0 {
+		t.Fatalf("LoadAnchors: got %v (err %v) after loading, want "+
+			"no anchors", anchors, err)
+	}
+}
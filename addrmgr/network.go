@@ -86,6 +86,12 @@ var (
 	// { magic 6 bytes, 10 bytes base32 decode of key hash }
 	onionCatNet = ipNet("fd87:d87e:eb43::", 48, 128)
 
+	// cjdnsNet defines the IPv6 address block used by CJDNS (fc00::/8).
+	// It is part of the RFC4193 unique local IPv6 range, so addresses in it
+	// are only treated as CJDNS addresses when they are explicitly flagged
+	// as such.
+	cjdnsNet = ipNet("fc00::", 8, 128)
+
 	// zero4Net defines the IPv4 address block for address staring with 0
 	// (0.0.0.0/8).
 	zero4Net = ipNet("0.0.0.0", 8, 32)
@@ -119,6 +125,22 @@ func isOnionCatTor(na *wire.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
+// isTorV3 returns whether or not the passed address is a Tor v3 hidden service
+// address.
+func isTorV3(na *wire.NetAddress) bool {
+	return na.Network == wire.NetworkTorV3
+}
+
+// isI2P returns whether or not the passed address is an I2P address.
+func isI2P(na *wire.NetAddress) bool {
+	return na.Network == wire.NetworkI2P
+}
+
+// isCJDNS returns whether or not the passed address is a CJDNS address.
+func isCJDNS(na *wire.NetAddress) bool {
+	return na.Network == wire.NetworkCJDNS
+}
+
 // isRFC1918 returns whether or not the passed address is part of the IPv4
 // private network address space as defined by RFC1918 (10.0.0.0/8,
 // 172.16.0.0/12, or 192.168.0.0/16).
@@ -223,8 +245,20 @@ func isValid(na *wire.NetAddress) bool {
 
 // IsRoutable returns whether or not the passed address is routable over
 // the public internet.  This is true as long as the address is valid and is not
-// in any reserved ranges.
+// in any reserved ranges.  Tor v3, I2P and CJDNS addresses are routable over
+// their own networks as long as they are valid, while addresses on unknown
+// networks are never routable.
 func IsRoutable(na *wire.NetAddress) bool {
+	switch na.NetworkID() {
+	case wire.NetworkIPv4, wire.NetworkIPv6, wire.NetworkTorV2:
+	case wire.NetworkTorV3, wire.NetworkI2P:
+		return len(na.Addr) == 32
+	case wire.NetworkCJDNS:
+		return cjdnsNet.Contains(na.IP)
+	default:
+		return false
+	}
+
 	return isValid(na) && !(isRFC1918(na) || isRFC2544(na) ||
 		isRFC3927(na) || isRFC4862(na) || isRFC3849(na) ||
 		isRFC4843(na) || isRFC5737(na) || isRFC6598(na) ||
@@ -234,8 +268,10 @@ func IsRoutable(na *wire.NetAddress) bool {
 // GroupKey returns a string representing the network group an address is part
 // of.  This is the /16 for IPv4, the /32 (/36 for he.net) for IPv6, the string
 // "local" for a local address, the string "tor:key" where key is the /4 of the
-// onion address for Tor address, and the string "unroutable" for an unroutable
-// address.
+// onion address for Tor address, the strings "torv3:key", "i2p:key" and
+// "cjdns:key" where key is the /4 of the address, skipping the fixed fc prefix
+// for CJDNS, for the respective networks, and the string "unroutable" for an
+// unroutable address.
 func GroupKey(na *wire.NetAddress) string {
 	if isLocal(na) {
 		return "local"
@@ -243,6 +279,15 @@ func GroupKey(na *wire.NetAddress) string {
 	if !IsRoutable(na) {
 		return "unroutable"
 	}
+	if isTorV3(na) {
+		return fmt.Sprintf("torv3:%d", na.Addr[0]>>4)
+	}
+	if isI2P(na) {
+		return fmt.Sprintf("i2p:%d", na.Addr[0]>>4)
+	}
+	if isCJDNS(na) {
+		return fmt.Sprintf("cjdns:%d", na.IP.To16()[1]>>4)
+	}
 	if isIPv4(na) {
 		return na.IP.Mask(net.CIDRMask(16, 32)).String()
 	}
@@ -200,4 +200,35 @@ func TestGroupKey(t *testing.T) {
 				key, test.expected)
 		}
 	}
+
+	// Addresses on networks which are not identified by IP address alone.
+	addrV2Tests := []struct {
+		name     string
+		na       wire.NetAddress
+		expected string
+	}{
+		{name: "tor v3", na: wire.NetAddress{Network: wire.NetworkTorV3,
+			Addr: append([]byte{0xa5}, make([]byte, 31)...)},
+			expected: "torv3:10"},
+		{name: "tor v3 bad length", na: wire.NetAddress{
+			Network: wire.NetworkTorV3, Addr: []byte{0xa5}},
+			expected: "unroutable"},
+		{name: "i2p", na: wire.NetAddress{Network: wire.NetworkI2P,
+			Addr: append([]byte{0x3c}, make([]byte, 31)...)},
+			expected: "i2p:3"},
+		{name: "cjdns", na: wire.NetAddress{Network: wire.NetworkCJDNS,
+			IP: net.ParseIP("fc32:17ea::1")}, expected: "cjdns:3"},
+		{name: "cjdns outside fc00::/8", na: wire.NetAddress{
+			Network: wire.NetworkCJDNS, IP: net.ParseIP("fd32::1")},
+			expected: "unroutable"},
+		{name: "unknown network", na: wire.NetAddress{Network: 42,
+			Addr: make([]byte, 32)}, expected: "unroutable"},
+	}
+	for i, test := range addrV2Tests {
+		if key := GroupKey(&test.na); key != test.expected {
+			t.Errorf("TestGroupKey addrv2 #%d (%s): unexpected group "+
+				"key - got '%s', want '%s'", i, test.name, key,
+				test.expected)
+		}
+	}
 }
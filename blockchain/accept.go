@@ -133,6 +133,24 @@ func (b *BlockChain) maybeAcceptBlock(block *cmmutil.Block, flags BehaviorFlags)
 		return false, ruleError(ErrInvalidAncestorBlock, str)
 	}
 
+	// Reject blocks which were previously marked as having failed
+	// validation, such as those manually invalidated before the node was
+	// restarted, since side chain blocks are not loaded into the index.
+	var status blockStatus
+	err = b.db.View(func(dbTx database.Tx) error {
+		var err error
+		status, err = dbFetchBlockStatus(dbTx, block.Hash(),
+			block.MsgBlock().Header.Height)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if status&statusValidateFailed != 0 {
+		str := fmt.Sprintf("block %s is known to be invalid", block.Hash())
+		return false, ruleError(ErrKnownInvalidBlock, str)
+	}
+
 	// The block must pass all of the validation rules which depend on the
 	// position of the block within the block chain.
 	err = b.checkBlockContext(block, prevNode, flags)
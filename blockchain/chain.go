@@ -9,6 +9,7 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -142,8 +143,8 @@ type BlockChain struct {
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
-	nextCheckpoint  *chaincfg.Checkpoint
-	checkpointBlock *cmmutil.Block
+	nextCheckpoint *chaincfg.Checkpoint
+	checkpointNode *blockNode
 
 	// The state is used as a fairly efficient way to cache information
 	// about the current best chain state that is returned to callers when
@@ -174,6 +175,16 @@ type BlockChain struct {
 	// it is unlikely to be referenced in the future.
 	pruner *chainPruner
 
+	// pruneTarget is the target size in bytes of the stored block data or
+	// zero when pruning is disabled.  prunedHeight is the height of the most
+	// recent main chain block whose data has been pruned or -1 when no block
+	// data has been pruned.  blocksSincePruneCheck is the number of blocks
+	// accepted since the size of the stored block data was last checked.
+	// The latter two are protected by the chain lock.
+	pruneTarget           uint64
+	prunedHeight          int64
+	blocksSincePruneCheck int64
+
 	// The following maps are various caches for the stake version/voting
 	// system.  The goal of these is to reduce disk access to load blocks
 	// from disk.  Measurements indicate that it is slightly more expensive
@@ -1274,12 +1285,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 	// Set the fork point and grab the fork block when there are nodes to be
 	// attached.  The fork block is used as the parent to the first node to be
-	// attached below.
+	// attached below.  Notice the parent of the first node to attach is used
+	// since there might not be any nodes to detach.
 	var forkNode *blockNode
 	var forkBlock *cmmutil.Block
 	if attachNodes.Len() > 0 {
 		var err error
-		forkNode, err = b.index.PrevNodeFromNode(newBest)
+		firstAttachNode := attachNodes.Front().Value.(*blockNode)
+		forkNode, err = b.index.PrevNodeFromNode(firstAttachNode)
 		if err != nil {
 			return err
 		}
@@ -1786,6 +1799,19 @@ func (b *BlockChain) MaxBlockSize() (int64, error) {
 	return maxSize, err
 }
 
+// ChainWork returns the total work up to and including the block of the
+// provided block hash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainWork(hash *chainhash.Hash) (*big.Int, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, HashError(hash.String())
+	}
+
+	return new(big.Int).Set(node.workSum), nil
+}
+
 // FetchHeader returns the block header identified by the given hash or an error
 // if it doesn't exist.
 //
@@ -1898,6 +1924,15 @@ type Config struct {
 	// This field can be nil if the caller does not wish to make use of an
 	// index manager.
 	IndexManager IndexManager
+
+	// PruneTarget is the target size in bytes of the stored block data.
+	// The oldest blocks are removed from the database once they are buried
+	// deep enough and the stored block data exceeds this size.
+	//
+	// This field can be zero to disable pruning, however it may not be
+	// disabled once a database has been pruned.  Otherwise it must be at
+	// least MinPruneTarget.
+	PruneTarget uint64
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1929,6 +1964,8 @@ func New(config *Config) (*BlockChain, error) {
 		notifications:                 config.Notifications,
 		sigCache:                      config.SigCache,
 		indexManager:                  config.IndexManager,
+		pruneTarget:                   config.PruneTarget,
+		prunedHeight:                  -1,
 		index:                         newBlockIndex(config.DB, params),
 		orphans:                       make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:                   make(map[chainhash.Hash][]*orphanBlock),
@@ -1942,6 +1979,12 @@ func New(config *Config) (*BlockChain, error) {
 		calcStakeVersionCache:         make(map[[chainhash.HashSize]byte]uint32),
 	}
 
+	if b.pruneTarget != 0 && b.pruneTarget < MinPruneTarget {
+		str := fmt.Sprintf("blockchain.New prune target %d is less "+
+			"than the minimum %d", b.pruneTarget, MinPruneTarget)
+		return nil, AssertError(str)
+	}
+
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
 	// will be initialized to contain only the genesis block.
@@ -1949,6 +1992,13 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Load the pruning state and ensure a database that has already been
+	// pruned is not used without pruning since it no longer has the data
+	// for all blocks.
+	if err := b.initPruneState(); err != nil {
+		return nil, err
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -16,13 +16,12 @@ import (
 	"time"
 
 	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
-	"github.com/CommerciumBlockchain/cmmd/cequihash"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
 	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/equihash"
 	"github.com/CommerciumBlockchain/cmmd/txscript"
 	"github.com/CommerciumBlockchain/cmmd/wire"
-	"unsafe"
 )
 
 var (
@@ -1266,20 +1265,19 @@ type solutionValidatorData struct {
 	header *wire.BlockHeader
 }
 
-func (data solutionValidatorData) Validate(solution unsafe.Pointer) int {
-	if uintptr(solution) == 0 {
-		return 0
+func (data solutionValidatorData) validate(solution []byte) bool {
+	if solution == nil {
+		return false
 	}
 
-	solutionBytes := cequihash.ExtractSolution(data.params.N, data.params.K, solution)
-	copy(data.header.EquihashSolution[:], solutionBytes)
+	copy(data.header.EquihashSolution[:], solution)
 	hash := data.header.BlockHash()
 
 	if hashToBig(&hash).Cmp(compactToBig(data.header.Bits)) <= 0 {
 		*data.solved = true
-		return 1
+		return true
 	}
-	return 0
+	return false
 }
 
 const (
@@ -1314,7 +1312,10 @@ func SolveBlockWithEquihash(header *wire.BlockHeader, chainParams *chaincfg.Para
 		for i := uint32(0); i <= maxNonce && !solved; i++ {
 			header.Nonce = i
 
-			cequihash.SolveEquihash(chainParams.N, chainParams.K, headerBytes, int64(i), validator)
+			err := equihash.Solve(chainParams.N, chainParams.K, headerBytes, int64(i), validator.validate)
+			if err != nil {
+				return false
+			}
 		}
 	}
 
@@ -8,6 +8,7 @@ package blockchain
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"math/big"
@@ -59,6 +60,13 @@ func isNotInMainChainErr(err error) bool {
 	return ok
 }
 
+// isDbBlockNotFoundErr returns whether or not the passed error is a
+// database.Error with an error code of database.ErrBlockNotFound.
+func isDbBlockNotFoundErr(err error) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == database.ErrBlockNotFound
+}
+
 // errDeserialize signifies that a problem was encountered when deserializing
 // data.
 type errDeserialize string
@@ -433,6 +441,22 @@ func dbFetchBlockIndexEntry(dbTx database.Tx, hash *chainhash.Hash, height uint3
 	return deserializeBlockIndexEntry(serialized)
 }
 
+// dbFetchBlockStatus returns the status stored in the block index for the
+// passed hash and height.  A zero status is returned when there is no entry.
+func dbFetchBlockStatus(dbTx database.Tx, hash *chainhash.Hash, height uint32) (blockStatus, error) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName)
+	serialized := bucket.Get(blockIndexKey(hash, height))
+	if serialized == nil {
+		return 0, nil
+	}
+
+	entry, err := deserializeBlockIndexEntry(serialized)
+	if err != nil {
+		return 0, err
+	}
+	return entry.status, nil
+}
+
 // dbMaybeStoreBlock stores the provided block in the database if it's not
 // already there.
 func dbMaybeStoreBlock(dbTx database.Tx, block *cmmutil.Block) error {
@@ -1192,6 +1216,56 @@ func dbFetchUtxoEntry(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry, error
 	return entry, nil
 }
 
+// UtxoStats represents unspent output statistics on the current utxo set.
+type UtxoStats struct {
+	BestHash       chainhash.Hash
+	BestHeight     int64
+	Transactions   int64
+	Utxos          int64
+	Total          int64
+	Size           int64
+	SerializedHash chainhash.Hash
+}
+
+// dbFetchUtxoStats uses an existing database transaction to walk the entire
+// utxo set and return statistics about it.  The serialized hash commits to
+// every key and serialized entry in the order they are stored.
+func dbFetchUtxoStats(dbTx database.Tx) (*UtxoStats, error) {
+	utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+
+	var stats UtxoStats
+	hasher := sha256.New()
+	err := utxoBucket.ForEach(func(k, v []byte) error {
+		entry, err := deserializeUtxoEntry(v)
+		if err != nil {
+			if isDeserializeErr(err) {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt utxo "+
+						"entry for %x: %v", k, err),
+				}
+			}
+			return err
+		}
+
+		stats.Transactions++
+		stats.Size += int64(len(k) + len(v))
+		for _, output := range entry.sparseOutputs {
+			stats.Utxos++
+			stats.Total += output.amount
+		}
+		hasher.Write(k)
+		hasher.Write(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	copy(stats.SerializedHash[:], hasher.Sum(nil))
+
+	return &stats, nil
+}
+
 // dbPutUtxoView uses an existing database transaction to update the utxo set
 // in the database based on the provided utxo view contents and state.  In
 // particular, only the entries that have been marked as modified are written
@@ -1842,9 +1916,21 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 }
 
 // dbFetchHeaderByHash uses an existing database transaction to retrieve the
-// block header for the provided hash.
+// block header for the provided hash.  The headers of main chain blocks whose
+// data has been pruned are loaded from the block index.
 func dbFetchHeaderByHash(dbTx database.Tx, hash *chainhash.Hash) (*wire.BlockHeader, error) {
 	headerBytes, err := dbTx.FetchBlockHeader(hash)
+	if isDbBlockNotFoundErr(err) {
+		height, hErr := dbFetchHeightByHash(dbTx, hash)
+		if hErr != nil {
+			return nil, err
+		}
+		entry, err := dbFetchBlockIndexEntry(dbTx, hash, uint32(height))
+		if err != nil {
+			return nil, err
+		}
+		return &entry.header, nil
+	}
 	if err != nil {
 		return nil, err
 	}
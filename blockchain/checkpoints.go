@@ -98,13 +98,32 @@ func (b *BlockChain) verifyCheckpoint(height int64, hash *chainhash.Hash) bool {
 	return true
 }
 
+// dbFetchCheckpointNode uses an existing database transaction to create a block
+// node for the passed main chain checkpoint from the block index.  Unlike the
+// block itself, the block index entry is always available, even when the block
+// data has been pruned.  The returned node is not linked into the block index.
+func dbFetchCheckpointNode(dbTx database.Tx, hash *chainhash.Hash) (*blockNode, error) {
+	height, err := dbFetchHeightByHash(dbTx, hash)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := dbFetchBlockIndexEntry(dbTx, hash, uint32(height))
+	if err != nil {
+		return nil, err
+	}
+
+	node := new(blockNode)
+	initBlockNode(node, &entry.header, nil)
+	return node, nil
+}
+
 // findPreviousCheckpoint finds the most recent checkpoint that is already
 // available in the downloaded portion of the block chain and returns the
-// associated block.  It returns nil if a checkpoint can't be found (this should
-// really only happen for blocks before the first checkpoint).
+// associated block node.  It returns nil if a checkpoint can't be found (this
+// should really only happen for blocks before the first checkpoint).
 //
 // This function MUST be called with the chain lock held (for reads).
-func (b *BlockChain) findPreviousCheckpoint() (*cmmutil.Block, error) {
+func (b *BlockChain) findPreviousCheckpoint() (*blockNode, error) {
 	if b.noCheckpoints || len(b.chainParams.Checkpoints) == 0 {
 		return nil, nil
 	}
@@ -119,7 +138,7 @@ func (b *BlockChain) findPreviousCheckpoint() (*cmmutil.Block, error) {
 	// Perform the initial search to find and cache the latest known
 	// checkpoint if the best chain is not known yet or we haven't already
 	// previously searched.
-	if b.checkpointBlock == nil && b.nextCheckpoint == nil {
+	if b.checkpointNode == nil && b.nextCheckpoint == nil {
 		// Loop backwards through the available checkpoints to find one
 		// that is already available.
 		checkpointIndex := -1
@@ -145,14 +164,14 @@ func (b *BlockChain) findPreviousCheckpoint() (*cmmutil.Block, error) {
 			return nil, nil
 		}
 
-		// Cache the latest known checkpoint block for future lookups.
+		// Cache the latest known checkpoint node for future lookups.
 		checkpoint := checkpoints[checkpointIndex]
 		err = b.db.View(func(dbTx database.Tx) error {
-			block, err := dbFetchBlockByHash(dbTx, checkpoint.Hash)
+			node, err := dbFetchCheckpointNode(dbTx, checkpoint.Hash)
 			if err != nil {
 				return err
 			}
-			b.checkpointBlock = block
+			b.checkpointNode = node
 
 			// Set the next expected checkpoint block accordingly.
 			b.nextCheckpoint = nil
@@ -166,21 +185,21 @@ func (b *BlockChain) findPreviousCheckpoint() (*cmmutil.Block, error) {
 			return nil, err
 		}
 
-		return b.checkpointBlock, nil
+		return b.checkpointNode, nil
 	}
 
 	// At this point we've already searched for the latest known checkpoint,
 	// so when there is no next checkpoint, the current checkpoint lockin
 	// will always be the latest known checkpoint.
 	if b.nextCheckpoint == nil {
-		return b.checkpointBlock, nil
+		return b.checkpointNode, nil
 	}
 
 	// When there is a next checkpoint and the height of the current best
 	// chain does not exceed it, the current checkpoint lockin is still
 	// the latest known checkpoint.
 	if b.bestNode.height < b.nextCheckpoint.Height {
-		return b.checkpointBlock, nil
+		return b.checkpointNode, nil
 	}
 
 	// We've reached or exceeded the next checkpoint height.  Note that
@@ -188,16 +207,16 @@ func (b *BlockChain) findPreviousCheckpoint() (*cmmutil.Block, error) {
 	// any blocks before the checkpoint, so we don't have to worry about the
 	// checkpoint going away out from under us due to a chain reorganize.
 
-	// Cache the latest known checkpoint block for future lookups.  Note
+	// Cache the latest known checkpoint node for future lookups.  Note
 	// that if this lookup fails something is very wrong since the chain
 	// has already passed the checkpoint which was verified as accurate
 	// before inserting it.
 	err := b.db.View(func(tx database.Tx) error {
-		block, err := dbFetchBlockByHash(tx, b.nextCheckpoint.Hash)
+		node, err := dbFetchCheckpointNode(tx, b.nextCheckpoint.Hash)
 		if err != nil {
 			return err
 		}
-		b.checkpointBlock = block
+		b.checkpointNode = node
 		return nil
 	})
 	if err != nil {
@@ -217,7 +236,7 @@ func (b *BlockChain) findPreviousCheckpoint() (*cmmutil.Block, error) {
 		b.nextCheckpoint = &checkpoints[checkpointIndex+1]
 	}
 
-	return b.checkpointBlock, nil
+	return b.checkpointNode, nil
 }
 
 // isNonstandardTransaction determines whether a transaction contains any
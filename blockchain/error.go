@@ -453,6 +453,10 @@ const (
 	// ErrInvalidEquihashSolution indicates that block does not passes equihash solution validation
 	ErrInvalidEquihashSolution
 
+	// ErrKnownInvalidBlock indicates that this block has previously failed
+	// validation or was manually invalidated.
+	ErrKnownInvalidBlock
+
 	// numErrorCodes is the maximum error code number used in tests.
 	numErrorCodes
 )
@@ -555,6 +559,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidEarlyFinalState:  "ErrInvalidEarlyFinalState",
 	ErrInvalidAncestorBlock:    "ErrInvalidAncestorBlock",
 	ErrInvalidEquihashSolution: "ErrInvalidEquihashSolution",
+	ErrKnownInvalidBlock:       "ErrKnownInvalidBlock",
 }
 
 // String returns the ErrorCode as a human-readable name.
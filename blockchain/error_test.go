@@ -112,6 +112,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrInvalidEarlyFinalState, "ErrInvalidEarlyFinalState"},
 		{ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{ErrInvalidEquihashSolution, "ErrInvalidEquihashSolution"},
+		{ErrKnownInvalidBlock, "ErrKnownInvalidBlock"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
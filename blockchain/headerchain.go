@@ -0,0 +1,215 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// HeaderChain houses a chain of block headers which extends a block known to
+// the block chain and for which the blocks have not necessarily been downloaded
+// yet.  Every header is validated to connect to the previous one, to have valid
+// proof of work including the Equihash solution, to commit to the required
+// difficulty and height, to have a timestamp after the median time of the
+// previous blocks, and to match the checkpoints.  This allows the headers of the
+// best chain to be synced ahead of the blocks so the blocks can be downloaded in
+// parallel from multiple peers.
+//
+// Headers for which the associated blocks have been connected to the main chain
+// are dropped from the header chain as more headers are added, so its memory
+// usage is proportional to the number of headers ahead of the blocks.
+//
+// A HeaderChain is NOT safe for concurrent access.
+type HeaderChain struct {
+	chain *BlockChain
+
+	// nodes are the block nodes for the headers which are not known to be
+	// connected to the main chain, ordered by height.  They are not added
+	// to the block index.
+	nodes []*blockNode
+
+	// tip is the block node for the final header in the header chain.  It
+	// is nil until the first header is connected.
+	tip *blockNode
+}
+
+// NewHeaderChain returns a new empty header chain.  The first connected header
+// must extend a block that is already known to the block chain.
+func (b *BlockChain) NewHeaderChain() *HeaderChain {
+	return &HeaderChain{chain: b}
+}
+
+// Tip returns the hash and height of the final header in the header chain.  The
+// returned hash is nil when no headers have been connected.
+func (hc *HeaderChain) Tip() (*chainhash.Hash, int64) {
+	if hc.tip == nil {
+		return nil, 0
+	}
+	return &hc.tip.hash, hc.tip.height
+}
+
+// pruneConnected drops the leading headers for which the associated blocks have
+// been connected to the main chain by linking the header that follows them to
+// the block node in the block index.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (hc *HeaderChain) pruneConnected() {
+	b := hc.chain
+	for len(hc.nodes) > 0 {
+		node := b.index.LookupNode(&hc.nodes[0].hash)
+		if node == nil || !node.inMainChain {
+			return
+		}
+
+		if len(hc.nodes) > 1 {
+			hc.nodes[1].parent = node
+		} else {
+			hc.tip = node
+		}
+		hc.nodes[0] = nil
+		hc.nodes = hc.nodes[1:]
+	}
+}
+
+// checkHeaderContext performs the checks of a block header which depend on its
+// position within the header chain and only involve the headers of the previous
+// blocks, as opposed to their contents, so they may be performed before the
+// blocks are available.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkHeaderContext(header *wire.BlockHeader, prevNode *blockNode) error {
+	// Ensure the difficulty specified in the block header matches the
+	// calculated difficulty based on the previous block and difficulty
+	// retarget rules.
+	expDiff, err := b.calcNextRequiredDifficulty(prevNode, header.Timestamp)
+	if err != nil {
+		return err
+	}
+	if header.Bits != expDiff {
+		str := fmt.Sprintf("block difficulty of %d is not the expected "+
+			"value of %d", header.Bits, expDiff)
+		return ruleError(ErrUnexpectedDifficulty, str)
+	}
+
+	// Ensure the timestamp for the block header is after the median time of
+	// the last several blocks (medianTimeBlocks).
+	medianTime, err := b.index.CalcPastMedianTime(prevNode)
+	if err != nil {
+		return err
+	}
+	if !header.Timestamp.After(medianTime) {
+		str := fmt.Sprintf("block timestamp of %v is not after expected "+
+			"%v", header.Timestamp, medianTime)
+		return ruleError(ErrTimeTooOld, str)
+	}
+
+	// Ensure the header commits to the height it connects at.
+	blockHeight := prevNode.height + 1
+	if int64(header.Height) != blockHeight {
+		str := fmt.Sprintf("block header commitment to height %d does "+
+			"not match chain height %d", header.Height, blockHeight)
+		return ruleError(ErrBadBlockHeight, str)
+	}
+
+	// Ensure the header matches the predetermined checkpoints and does not
+	// fork the main chain before the previous one.
+	blockHash := header.BlockHash()
+	if !b.verifyCheckpoint(blockHeight, &blockHash) {
+		str := fmt.Sprintf("block at height %d does not match "+
+			"checkpoint hash", blockHeight)
+		return ruleError(ErrBadCheckpoint, str)
+	}
+	checkpointNode, err := b.findPreviousCheckpoint()
+	if err != nil {
+		return err
+	}
+	if checkpointNode != nil && blockHeight < checkpointNode.height {
+		str := fmt.Sprintf("block at height %d forks the main chain "+
+			"before the previous checkpoint at height %d",
+			blockHeight, checkpointNode.height)
+		return ruleError(ErrForkTooOld, str)
+	}
+
+	return nil
+}
+
+// ConnectHeaders validates the passed headers and adds them to the end of the
+// header chain.  The first header must connect to the final header of the
+// header chain or, when it is empty, to a block known to the block chain.  The
+// Equihash solutions of all of the headers are validated concurrently before
+// any of the other checks are performed.
+//
+// It returns the index of the header which failed validation along with the
+// error.  The headers before it remain part of the header chain.
+//
+// The flags modify the behavior of this function as follows:
+//  - BFNoPoWCheck: The proof of work, including the Equihash solution, is not
+//    validated.
+//
+// This function is safe for concurrent access with the block chain, however,
+// the header chain itself is NOT.
+func (hc *HeaderChain) ConnectHeaders(headers []*wire.BlockHeader, flags BehaviorFlags) (int, error) {
+	b := hc.chain
+	if flags&BFNoPoWCheck != BFNoPoWCheck {
+		failedIdx, err := CheckProofOfWorkBatch(headers, b.chainParams)
+		if err != nil {
+			return failedIdx, err
+		}
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	hc.pruneConnected()
+	for i, header := range headers {
+		// The proof of work was already validated above, so only
+		// perform the remaining sanity checks.
+		err := checkBlockHeaderSanity(header, b.timeSource,
+			flags|BFNoEquihashCheck, b.chainParams)
+		if err != nil {
+			return i, err
+		}
+
+		// Ensure the header connects to the previous one.  The first
+		// header of an empty header chain may extend any block that is
+		// already known.
+		prevNode := hc.tip
+		if prevNode == nil {
+			prevNode, err = b.lookupNodeForHash(&header.PrevBlock)
+			if err != nil {
+				return i, err
+			}
+		}
+		if prevNode == nil || prevNode.hash != header.PrevBlock {
+			str := fmt.Sprintf("block header %v does not connect to "+
+				"the header chain", header.BlockHash())
+			return i, ruleError(ErrMissingParent, str)
+		}
+
+		// Reject headers for blocks which are already known to be
+		// invalid.
+		blockHash := header.BlockHash()
+		if node := b.index.LookupNode(&blockHash); node != nil &&
+			b.index.NodeStatus(node).KnownInvalid() {
+
+			str := fmt.Sprintf("block %v is known to be invalid",
+				blockHash)
+			return i, ruleError(ErrKnownInvalidBlock, str)
+		}
+
+		if err := b.checkHeaderContext(header, prevNode); err != nil {
+			return i, err
+		}
+
+		node := newBlockNode(header, prevNode)
+		hc.nodes = append(hc.nodes, node)
+		hc.tip = node
+	}
+
+	return len(headers), nil
+}
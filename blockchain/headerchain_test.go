@@ -0,0 +1,118 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestHeaderChain ensures headers are only connected to the header chain when
+// they link to the previous header and commit to the expected difficulty and
+// height, and that headers for blocks in the main chain are pruned.
+func TestHeaderChain(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	bc := newFakeChain(params)
+	bc.timeSource = NewMedianTime()
+	genesis := bc.bestNode
+
+	// nextHeader returns a header which properly extends the passed
+	// previous header.
+	nextHeader := func(prev *wire.BlockHeader) *wire.BlockHeader {
+		return &wire.BlockHeader{
+			Version:   prev.Version,
+			PrevBlock: prev.BlockHash(),
+			VoteBits:  earlyVoteBitsValue,
+			Bits:      prev.Bits,
+			Height:    prev.Height + 1,
+			Timestamp: prev.Timestamp.Add(time.Minute),
+		}
+	}
+
+	// assertRuleError ensures the passed error is a rule error with the
+	// provided error code.
+	assertRuleError := func(err error, code ErrorCode) {
+		t.Helper()
+		rerr, ok := err.(RuleError)
+		if !ok {
+			t.Fatalf("unexpected error type -- got %T (%v), want "+
+				"blockchain.RuleError", err, err)
+		}
+		if rerr.ErrorCode != code {
+			t.Fatalf("unexpected error code -- got %v, want %v",
+				rerr.ErrorCode, code)
+		}
+	}
+
+	// Ensure an empty header chain has no tip.
+	hc := bc.NewHeaderChain()
+	if tipHash, _ := hc.Tip(); tipHash != nil {
+		t.Fatalf("unexpected tip for empty header chain %v", tipHash)
+	}
+
+	// Connect a few headers extending the genesis block.
+	genesisHeader := genesis.Header()
+	headers := []*wire.BlockHeader{nextHeader(&genesisHeader)}
+	headers = append(headers, nextHeader(headers[0]))
+	headers = append(headers, nextHeader(headers[1]))
+	n, err := hc.ConnectHeaders(headers, BFNoPoWCheck)
+	if err != nil {
+		t.Fatalf("ConnectHeaders: unexpected error at header %d: %v", n,
+			err)
+	}
+	wantTip := headers[2].BlockHash()
+	if tipHash, tipHeight := hc.Tip(); *tipHash != wantTip || tipHeight != 3 {
+		t.Fatalf("unexpected tip -- got %v (height %d), want %v "+
+			"(height 3)", tipHash, tipHeight, wantTip)
+	}
+
+	// Ensure headers which do not connect to the tip are rejected.
+	badHeader := nextHeader(headers[2])
+	badHeader.PrevBlock = chainhash.Hash{0x01}
+	_, err = hc.ConnectHeaders([]*wire.BlockHeader{badHeader}, BFNoPoWCheck)
+	assertRuleError(err, ErrMissingParent)
+
+	// Ensure headers with an unexpected difficulty are rejected.
+	badHeader = nextHeader(headers[2])
+	badHeader.Bits--
+	_, err = hc.ConnectHeaders([]*wire.BlockHeader{badHeader}, BFNoPoWCheck)
+	assertRuleError(err, ErrUnexpectedDifficulty)
+
+	// Ensure headers which commit to the wrong height are rejected and the
+	// index of the failed header is reported.
+	goodHeader := nextHeader(headers[2])
+	badHeader = nextHeader(goodHeader)
+	badHeader.Height++
+	n, err = hc.ConnectHeaders([]*wire.BlockHeader{goodHeader, badHeader},
+		BFNoPoWCheck)
+	assertRuleError(err, ErrBadBlockHeight)
+	if n != 1 {
+		t.Fatalf("unexpected failed header index -- got %d, want 1", n)
+	}
+	headers = append(headers, goodHeader)
+
+	// Add the block for the first header to the main chain and ensure the
+	// header is pruned once more headers are connected while the following
+	// header is linked to the block node in the block index.
+	node := newBlockNode(headers[0], genesis)
+	node.inMainChain = true
+	bc.index.AddNode(node)
+	_, err = hc.ConnectHeaders([]*wire.BlockHeader{nextHeader(headers[3])},
+		BFNoPoWCheck)
+	if err != nil {
+		t.Fatalf("ConnectHeaders: unexpected error: %v", err)
+	}
+	if len(hc.nodes) != 4 {
+		t.Fatalf("unexpected number of header nodes -- got %d, want 4",
+			len(hc.nodes))
+	}
+	if hc.nodes[0].parent != node {
+		t.Fatal("header not linked to the block node in the block index")
+	}
+}
@@ -226,9 +226,16 @@ func (m *Manager) maybeCreateIndexes(dbTx database.Tx) error {
 		}
 
 		// Set the tip for the index to values which represent an
-		// uninitialized index (the genesis block hash and height).
-		genesisBlockHash := m.params.GenesisBlock.BlockHash()
-		err := dbPutIndexerTip(dbTx, idxKey, &genesisBlockHash, 0)
+		// uninitialized index (the genesis block hash and height).  When
+		// the chain state was imported from a utxo snapshot, the blocks
+		// before the snapshot block are not available, so the index
+		// starts at the snapshot block instead.
+		tipHash := m.params.GenesisBlock.BlockHash()
+		var tipHeight int32
+		if hash, height := blockchain.DBFetchUtxoSnapshot(dbTx); hash != nil {
+			tipHash, tipHeight = *hash, int32(height)
+		}
+		err := dbPutIndexerTip(dbTx, idxKey, &tipHash, tipHeight)
 		if err != nil {
 			return err
 		}
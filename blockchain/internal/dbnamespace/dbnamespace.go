@@ -62,4 +62,13 @@ var (
 	// block index which consists of metadata for all known blocks both in
 	// the main chain and on side chains.
 	BlockIndexBucketName = []byte("blockidx")
+
+	// UtxoSnapshotKeyName is the name of the db key used to store the block
+	// the chain state was bootstrapped from when it was imported from a
+	// utxo snapshot.
+	UtxoSnapshotKeyName = []byte("utxosnapshot")
+
+	// PrunedHeightKeyName is the name of the db key used to store the height
+	// of the most recent main chain block whose data has been pruned.
+	PrunedHeightKeyName = []byte("prunedheight")
 )
@@ -0,0 +1,244 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/internal/dbnamespace"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/database"
+)
+
+// descendantNodes returns all of the known descendants of the passed block
+// node in breadth first order.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func descendantNodes(node *blockNode) []*blockNode {
+	var descendants []*blockNode
+	queue := append([]*blockNode(nil), node.children...)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		descendants = append(descendants, n)
+		queue = append(queue, n.children...)
+	}
+	return descendants
+}
+
+// lookupNodeForHash returns the block node for the passed hash when it is in
+// the block index or is part of the main chain, in which case it is loaded
+// along with the nodes between it and the current tip as needed.  It returns
+// nil when the block is not known.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) lookupNodeForHash(hash *chainhash.Hash) (*blockNode, error) {
+	if node := b.index.LookupNode(hash); node != nil {
+		return node, nil
+	}
+
+	var height int64
+	var inMainChain bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		inMainChain = dbMainChainHasBlock(dbTx, hash)
+		if !inMainChain {
+			return nil
+		}
+		var err error
+		height, err = dbFetchHeightByHash(dbTx, hash)
+		return err
+	})
+	if err != nil || !inMainChain {
+		return nil, err
+	}
+	return b.index.AncestorNode(b.bestNode, height)
+}
+
+// dbPutBlockNodes stores the block index entries for all of the passed block
+// nodes in a single database transaction.
+func (b *BlockChain) dbPutBlockNodes(nodes []*blockNode) error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		for _, node := range nodes {
+			if err := dbPutBlockNode(dbTx, node); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// bestValidTip returns the block node with the most cumulative work that is
+// not known to be invalid.  Every chain tip is considered along with the most
+// recent valid ancestor of those which are known to be invalid, so the result
+// is never a descendant of an invalid block.  The current best chain is
+// preferred when there are multiple candidates with the same work.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) bestValidTip() *blockNode {
+	b.index.RLock()
+	validAncestor := func(n *blockNode) *blockNode {
+		for n != nil && n.status.KnownInvalid() {
+			n = n.parent
+		}
+		return n
+	}
+	best := validAncestor(b.bestNode)
+	for _, tips := range b.index.chainTips {
+		for _, tip := range tips {
+			n := validAncestor(tip)
+			if n != nil && (best == nil || n.workSum.Cmp(best.workSum) > 0) {
+				best = n
+			}
+		}
+	}
+	b.index.RUnlock()
+	return best
+}
+
+// reorganizeToNode reorganizes the main chain so the passed block node becomes
+// the new tip.  This is used to move the tip to a valid chain that has less
+// cumulative work than the current one when blocks are manually invalidated as
+// well as to move it back once they are reconsidered.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reorganizeToNode(node *blockNode) error {
+	if node.hash == b.bestNode.hash {
+		return nil
+	}
+
+	detachNodes, attachNodes, err := b.getReorganizeNodes(node)
+	if err != nil {
+		return err
+	}
+	return b.reorganizeChain(detachNodes, attachNodes)
+}
+
+// InvalidateBlock manually marks the block identified by the passed hash as
+// invalid along with all of its known descendants.  The new status is
+// persisted in the block index so the block is not accepted again once the
+// node is restarted.  When the block is part of the main chain, the chain is
+// reorganized to the valid tip with the most cumulative work, which involves
+// disconnecting the invalid blocks and rewinding the stake node and ticket
+// database accordingly.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node, err := b.lookupNodeForHash(hash)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return fmt.Errorf("block %v is not known", hash)
+	}
+	if node.height == 0 {
+		return fmt.Errorf("the genesis block can't be invalidated")
+	}
+
+	// Mark the block as having failed validation and all of its
+	// descendants as having an invalid ancestor.
+	modified := []*blockNode{node}
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	for _, n := range descendantNodes(node) {
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+		modified = append(modified, n)
+	}
+	if err := b.dbPutBlockNodes(modified); err != nil {
+		return err
+	}
+
+	log.Infof("Block %v (height %v) was manually invalidated", hash,
+		node.height)
+
+	// There is nothing more to do when the block is not part of the main
+	// chain.
+	if !node.inMainChain {
+		return nil
+	}
+
+	// Reorganize to the best remaining valid tip.  That chain might fail
+	// to connect, in which case the invalid blocks are simply disconnected
+	// so the tip becomes the parent of the invalidated block.
+	err = b.reorganizeToNode(b.bestValidTip())
+	if err != nil {
+		log.Warnf("Unable to reorganize to the best valid tip after "+
+			"invalidating block %v: %v", hash, err)
+		return b.reorganizeToNode(node.parent)
+	}
+	return nil
+}
+
+// ReconsiderBlock removes the invalid status from the block identified by the
+// passed hash, its ancestors, and all of its known descendants that was
+// previously set by InvalidateBlock or due to failed validation.  The chain is
+// then reorganized to the valid tip with the most cumulative work when it has
+// more work than the current one.
+//
+// A block which is no longer in memory, such as an invalidated side chain
+// block after a restart, only has its persisted status cleared so it is
+// accepted again once it is received from the network.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	node, err := b.lookupNodeForHash(hash)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return b.db.Update(func(dbTx database.Tx) error {
+			header, err := dbFetchHeaderByHash(dbTx, hash)
+			if err != nil {
+				return fmt.Errorf("block %v is not known", hash)
+			}
+			entry, err := dbFetchBlockIndexEntry(dbTx, hash,
+				header.Height)
+			if err != nil {
+				return err
+			}
+			if entry.status&invalidFlags == 0 {
+				return nil
+			}
+			entry.status &^= invalidFlags
+			serialized, err := serializeBlockIndexEntry(entry)
+			if err != nil {
+				return err
+			}
+			bucket := dbTx.Metadata().Bucket(
+				dbnamespace.BlockIndexBucketName)
+			return bucket.Put(blockIndexKey(hash, header.Height),
+				serialized)
+		})
+	}
+
+	// Clear the invalid status of the block, its descendants, and any of
+	// its ancestors since the block can't be valid without them.
+	var modified []*blockNode
+	for n := node; n != nil; n = n.parent {
+		if b.index.NodeStatus(n)&invalidFlags == 0 && n != node {
+			break
+		}
+		b.index.UnsetStatusFlags(n, invalidFlags)
+		modified = append(modified, n)
+	}
+	for _, n := range descendantNodes(node) {
+		b.index.UnsetStatusFlags(n, invalidFlags)
+		modified = append(modified, n)
+	}
+	if err := b.dbPutBlockNodes(modified); err != nil {
+		return err
+	}
+
+	log.Infof("Block %v (height %v) was reconsidered", hash, node.height)
+
+	// Reorganize to the best valid tip when the newly valid blocks form a
+	// chain with more cumulative work.
+	return b.reorganizeToNode(b.bestValidTip())
+}
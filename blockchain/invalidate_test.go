@@ -0,0 +1,294 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/chaingen"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/txscript"
+)
+
+// TestBestValidTip ensures the best valid tip skips blocks which are known to
+// be invalid along with their descendants and falls back to the most recent
+// valid ancestor of an invalidated chain.
+func TestBestValidTip(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	bc := newFakeChain(params)
+
+	// addNodes extends the passed parent with the provided number of nodes
+	// and returns them.
+	blockTime := time.Unix(bc.bestNode.timestamp, 0)
+	addNodes := func(parent *blockNode, numNodes int) []*blockNode {
+		nodes := make([]*blockNode, 0, numNodes)
+		for i := 0; i < numNodes; i++ {
+			blockTime = blockTime.Add(time.Second)
+			node := newFakeNode(parent, 1, 1, params.PowLimitBits,
+				blockTime)
+			bc.index.AddNode(node)
+			nodes = append(nodes, node)
+			parent = node
+		}
+		return nodes
+	}
+
+	// Create a main chain of three blocks and a side chain of a single
+	// block, both of which fork from the genesis block.
+	genesis := bc.bestNode
+	mainChain := addNodes(genesis, 3)
+	sideChain := addNodes(genesis, 1)
+	bc.bestNode = mainChain[2]
+
+	if tip := bc.bestValidTip(); tip != mainChain[2] {
+		t.Fatalf("unexpected best valid tip - got %v, want %v",
+			tip.hash, mainChain[2].hash)
+	}
+
+	// Ensure all of the descendants are found.
+	descendants := descendantNodes(genesis)
+	if len(descendants) != 4 {
+		t.Fatalf("unexpected number of descendants - got %d, want 4",
+			len(descendants))
+	}
+
+	// Invalidate the second block of the main chain and ensure the best
+	// valid tip is its parent since the current chain is preferred over the
+	// side chain with the same work.
+	bc.index.SetStatusFlags(mainChain[1], statusValidateFailed)
+	for _, n := range descendantNodes(mainChain[1]) {
+		bc.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+	if tip := bc.bestValidTip(); tip != mainChain[0] {
+		t.Fatalf("unexpected best valid tip - got %v, want %v",
+			tip.hash, mainChain[0].hash)
+	}
+
+	// Extend the side chain so it has more work than the remaining valid
+	// portion of the main chain and ensure it is selected.
+	sideChain = append(sideChain, addNodes(sideChain[0], 1)...)
+	if tip := bc.bestValidTip(); tip != sideChain[1] {
+		t.Fatalf("unexpected best valid tip - got %v, want %v",
+			tip.hash, sideChain[1].hash)
+	}
+
+	// Invalidate the entire side chain and ensure the genesis block is
+	// selected once the main chain is invalidated as well.
+	bc.index.SetStatusFlags(sideChain[0], statusValidateFailed)
+	bc.index.SetStatusFlags(sideChain[1], statusInvalidAncestor)
+	bc.index.SetStatusFlags(mainChain[0], statusValidateFailed)
+	if tip := bc.bestValidTip(); tip != genesis {
+		t.Fatalf("unexpected best valid tip - got %v, want %v",
+			tip.hash, genesis.hash)
+	}
+}
+
+// TestInvalidateReconsiderBlock ensures manually invalidating blocks
+// reorganizes the chain off of them, rewinding the stake node and ticket
+// database, that the invalid status survives a restart, and that reconsidering
+// the blocks restores the original chain.
+func TestInvalidateReconsiderBlock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	params := &chaincfg.SimNetParams
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("invalidateblocktest", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a test generator instance initialized with the genesis block
+	// as the tip.
+	g, err := chaingen.MakeGenerator(params, chain)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	// processBlock processes the named block and ensures it is accepted
+	// with the expected main chain flag.
+	processBlock := func(blockName string, wantMainChain bool) {
+		msgBlock := g.BlockByName(blockName)
+		block := cmmutil.NewBlock(msgBlock)
+		isMainChain, isOrphan, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("block %q (hash %s, height %d) should have been "+
+				"accepted: %v", blockName, block.Hash(),
+				msgBlock.Header.Height, err)
+		}
+		if isMainChain != wantMainChain || isOrphan {
+			t.Fatalf("block %q (hash %s, height %d) unexpected flags "+
+				"-- got main chain %v, orphan %v", blockName,
+				block.Hash(), msgBlock.Header.Height, isMainChain,
+				isOrphan)
+		}
+	}
+
+	// chainState houses the parts of the chain state which must be
+	// restored when the chain is reorganized back to a block.
+	type chainState struct {
+		hash      chainhash.Hash
+		height    int64
+		totalTxns uint64
+		subsidy   int64
+		live      []chainhash.Hash
+		missed    []chainhash.Hash
+	}
+	currentState := func() *chainState {
+		best := chain.BestSnapshot()
+		live, err := chain.LiveTickets()
+		if err != nil {
+			t.Fatalf("unable to fetch live tickets: %v", err)
+		}
+		missed, err := chain.MissedTickets()
+		if err != nil {
+			t.Fatalf("unable to fetch missed tickets: %v", err)
+		}
+		return &chainState{best.Hash, best.Height, best.TotalTxns,
+			best.TotalSubsidy, live, missed}
+	}
+	expectState := func(desc string, want *chainState) {
+		got := currentState()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: unexpected chain state -- got tip %v "+
+				"(height %d, %d live tickets), want tip %v (height "+
+				"%d, %d live tickets)", desc, got.hash, got.height,
+				len(got.live), want.hash, want.height,
+				len(want.live))
+		}
+	}
+	expectTip := func(desc, tipName string) {
+		want := g.BlockByName(tipName).BlockHash()
+		if best := chain.BestSnapshot(); best.Hash != want {
+			t.Fatalf("%s: unexpected tip -- got %v, want %q (%v)", desc,
+				best.Hash, tipName, want)
+		}
+	}
+	blockHash := func(blockName string) *chainhash.Hash {
+		hash := g.BlockByName(blockName).BlockHash()
+		return &hash
+	}
+
+	// Generate enough blocks to reach the stake validation height with
+	// mature coinbase outputs and a full ticket pool to work with.
+	g.CreatePremineBlock("bp", 0)
+	processBlock("bp", true)
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		blockName := fmt.Sprintf("bm%d", i)
+		g.NextBlock(blockName, nil, nil)
+		g.SaveTipCoinbaseOuts()
+		processBlock(blockName, true)
+	}
+	targetPoolSize := int(g.Params().TicketPoolSize * params.TicketsPerBlock)
+	var ticketsPurchased int
+	for i := 0; int64(g.Tip().Header.Height) < params.StakeValidationHeight; i++ {
+		ticketOuts := g.OldestCoinbaseOuts()[1:]
+		if ticketsPurchased+len(ticketOuts) > targetPoolSize {
+			ticketOuts = ticketOuts[:targetPoolSize-ticketsPurchased]
+		}
+		ticketsPurchased += len(ticketOuts)
+		blockName := fmt.Sprintf("bsv%d", i)
+		g.NextBlock(blockName, nil, ticketOuts)
+		g.SaveTipCoinbaseOuts()
+		processBlock(blockName, true)
+	}
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		blockName := fmt.Sprintf("bbm%d", i)
+		g.NextBlock(blockName, nil, g.OldestCoinbaseOuts()[1:])
+		g.SaveTipCoinbaseOuts()
+		processBlock(blockName, true)
+	}
+	var outs []*chaingen.SpendableOut
+	var ticketOuts [][]chaingen.SpendableOut
+	for i := 0; i < 3; i++ {
+		coinbaseOuts := g.OldestCoinbaseOuts()
+		outs = append(outs, &coinbaseOuts[0])
+		ticketOuts = append(ticketOuts, coinbaseOuts[1:])
+	}
+
+	// Create a main chain of three blocks, each of which purchases
+	// tickets, and a side chain that forks from the first one:
+	//
+	//   ... -> b1(0) -> b2(1) -> b3(2)
+	//               \-> b2a(1)
+	g.NextBlock("b1", outs[0], ticketOuts[0])
+	processBlock("b1", true)
+	b1State := currentState()
+	g.NextBlock("b2", outs[1], ticketOuts[1])
+	processBlock("b2", true)
+	b2State := currentState()
+	g.NextBlock("b3", outs[2], ticketOuts[2])
+	processBlock("b3", true)
+	b3State := currentState()
+	g.SetTip("b1")
+	g.NextBlock("b2a", outs[1], ticketOuts[1])
+	processBlock("b2a", false)
+	expectTip("side chain", "b3")
+
+	// Invalidating the tip reorganizes to its parent, which is preferred
+	// over the side chain with the same work, and reconsidering it
+	// restores the original chain.
+	if err := chain.InvalidateBlock(blockHash("b3")); err != nil {
+		t.Fatalf("unable to invalidate b3: %v", err)
+	}
+	expectState("invalidate b3", b2State)
+	if err := chain.ReconsiderBlock(blockHash("b3")); err != nil {
+		t.Fatalf("unable to reconsider b3: %v", err)
+	}
+	expectState("reconsider b3", b3State)
+
+	// Invalidating a block further back reorganizes to the side chain and
+	// invalidating the side chain as well rewinds the chain to the fork
+	// point.
+	if err := chain.InvalidateBlock(blockHash("b2")); err != nil {
+		t.Fatalf("unable to invalidate b2: %v", err)
+	}
+	expectTip("invalidate b2", "b2a")
+	if err := chain.InvalidateBlock(blockHash("b2a")); err != nil {
+		t.Fatalf("unable to invalidate b2a: %v", err)
+	}
+	expectState("invalidate b2a", b1State)
+
+	// Restart the chain from the database and ensure the stake state was
+	// rewound there as well and that the invalidated blocks are still
+	// rejected.
+	chain, err = New(&Config{
+		DB:          chain.db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		t.Fatalf("failed to restart chain instance: %v", err)
+	}
+	expectState("restart", b1State)
+	for _, blockName := range []string{"b2", "b2a"} {
+		block := cmmutil.NewBlock(g.BlockByName(blockName))
+		_, _, err := chain.ProcessBlock(block, BFNone)
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != ErrKnownInvalidBlock {
+			t.Fatalf("block %q: unexpected error after restart -- "+
+				"got %v, want %v", blockName, err,
+				ErrKnownInvalidBlock)
+		}
+	}
+
+	// Reconsidering the invalidated block after the restart allows it and
+	// its descendants to be accepted again and restores the original chain.
+	if err := chain.ReconsiderBlock(blockHash("b2")); err != nil {
+		t.Fatalf("unable to reconsider b2: %v", err)
+	}
+	processBlock("b2", true)
+	processBlock("b3", true)
+	expectState("reconsider b2", b3State)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"runtime"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// powValidateItem holds a block header along with its index in the batch being
+// validated.
+type powValidateItem struct {
+	index  int
+	header *wire.BlockHeader
+}
+
+// powValidateResult houses the result of validating the proof of work of a
+// single header in a batch.
+type powValidateResult struct {
+	index int
+	err   error
+}
+
+// powValidator provides a type which asynchronously validates the proof of
+// work, including the Equihash solution, of a batch of block headers.  It
+// provides several channels for communication and a processing function that
+// is intended to be run in multiple goroutines.
+type powValidator struct {
+	validateChan chan *powValidateItem
+	quitChan     chan struct{}
+	resultChan   chan powValidateResult
+	chainParams  *chaincfg.Params
+}
+
+// sendResult sends the result of a header validation on the internal result
+// channel while respecting the quit channel.  This allows orderly shutdown when
+// the validation process is aborted early.
+func (v *powValidator) sendResult(result powValidateResult) {
+	select {
+	case v.resultChan <- result:
+	case <-v.quitChan:
+	}
+}
+
+// validateHandler consumes items to validate from the internal validate channel
+// and returns the result of the validation on the internal result channel.  It
+// must be run as a goroutine.
+func (v *powValidator) validateHandler() {
+out:
+	for {
+		select {
+		case item := <-v.validateChan:
+			err := checkProofOfWork(item.header, v.chainParams, BFNone)
+			v.sendResult(powValidateResult{index: item.index, err: err})
+
+		case <-v.quitChan:
+			break out
+		}
+	}
+}
+
+// Validate validates the proof of work of all passed headers using multiple
+// goroutines.  It returns the index of the first header in the batch which
+// failed validation along with the associated error, or -1 and nil when all
+// headers are valid.
+//
+// Headers are dispatched in order and no further headers are dispatched once
+// a failure is observed, so the reported header is always the one with the
+// lowest index among the failures regardless of scheduling.
+func (v *powValidator) Validate(headers []*wire.BlockHeader) (int, error) {
+	if len(headers) == 0 {
+		return -1, nil
+	}
+
+	// Limit the number of goroutines based on the number of processor
+	// cores since Equihash validation is entirely CPU bound.
+	maxGoRoutines := runtime.NumCPU()
+	if maxGoRoutines <= 0 {
+		maxGoRoutines = 1
+	}
+	if maxGoRoutines > len(headers) {
+		maxGoRoutines = len(headers)
+	}
+	for i := 0; i < maxGoRoutines; i++ {
+		go v.validateHandler()
+	}
+
+	numHeaders := len(headers)
+	currentItem := 0
+	dispatched := 0
+	processed := 0
+	failedIndex := -1
+	var failedErr error
+	for processed < dispatched || (failedIndex == -1 && currentItem < numHeaders) {
+		// Only send items while there are still items that need to be
+		// processed and no failure has been observed.  The select
+		// statement will never select a nil channel.
+		var validateChan chan *powValidateItem
+		var item *powValidateItem
+		if failedIndex == -1 && currentItem < numHeaders {
+			validateChan = v.validateChan
+			item = &powValidateItem{
+				index:  currentItem,
+				header: headers[currentItem],
+			}
+		}
+
+		select {
+		case validateChan <- item:
+			currentItem++
+			dispatched++
+
+		case result := <-v.resultChan:
+			processed++
+			if result.err != nil && (failedIndex == -1 ||
+				result.index < failedIndex) {
+
+				failedIndex = result.index
+				failedErr = result.err
+			}
+		}
+	}
+
+	close(v.quitChan)
+	return failedIndex, failedErr
+}
+
+// newPowValidator returns a new instance of powValidator to be used for
+// validating header proof of work asynchronously.
+func newPowValidator(chainParams *chaincfg.Params) *powValidator {
+	return &powValidator{
+		validateChan: make(chan *powValidateItem),
+		quitChan:     make(chan struct{}),
+		resultChan:   make(chan powValidateResult),
+		chainParams:  chainParams,
+	}
+}
+
+// CheckProofOfWorkBatch ensures the proof of work of every passed block header
+// is valid, including the Equihash solution, using multiple goroutines.  The
+// checks performed for each header are identical to those of
+// CheckProofOfWork.
+//
+// It returns the index within headers of the first header which failed
+// validation along with the associated error, or -1 and nil when every header
+// is valid.
+func CheckProofOfWorkBatch(headers []*wire.BlockHeader, chainParams *chaincfg.Params) (int, error) {
+	return newPowValidator(chainParams).Validate(headers)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/chaingen"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// solvedTestHeaders returns the requested number of headers that each carry a
+// valid Equihash solution for the provided network parameters.
+func solvedTestHeaders(t *testing.T, params *chaincfg.Params, count int) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, count)
+	prevHash := *params.GenesisHash
+	for i := 0; i < count; i++ {
+		header := params.GenesisBlock.Header
+		header.PrevBlock = prevHash
+		header.Height = uint32(i + 1)
+		header.Timestamp = time.Unix(params.GenesisBlock.Header.Timestamp.Unix()+
+			int64(i+1), 0)
+		if !chaingen.SolveBlockWithEquihash(&header, params) {
+			t.Fatalf("unable to solve test header %d", i)
+		}
+		headers = append(headers, &header)
+		prevHash = header.BlockHash()
+	}
+	return headers
+}
+
+// TestCheckProofOfWorkBatch ensures batch proof of work validation accepts
+// valid headers and reports the first invalid header in a batch.
+func TestCheckProofOfWorkBatch(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	headers := solvedTestHeaders(t, params, 8)
+
+	// An empty batch is trivially valid.
+	if idx, err := CheckProofOfWorkBatch(nil, params); idx != -1 || err != nil {
+		t.Fatalf("unexpected result for empty batch: %d, %v", idx, err)
+	}
+
+	// All of the solved headers must be valid.
+	if idx, err := CheckProofOfWorkBatch(headers, params); idx != -1 || err != nil {
+		t.Fatalf("unexpected result for valid batch: %d, %v", idx, err)
+	}
+
+	// Invalidate the solutions of a couple of headers and ensure the first
+	// one is reported regardless of the order in which the workers finish.
+	invalidate := func(header *wire.BlockHeader) *wire.BlockHeader {
+		mutated := *header
+		mutated.EquihashSolution[0] ^= 0xff
+		return &mutated
+	}
+	for _, badIdx := range []int{0, 3, 7} {
+		batch := append([]*wire.BlockHeader(nil), headers...)
+		batch[badIdx] = invalidate(batch[badIdx])
+		if badIdx+2 < len(batch) {
+			batch[badIdx+2] = invalidate(batch[badIdx+2])
+		}
+
+		idx, err := CheckProofOfWorkBatch(batch, params)
+		if idx != badIdx {
+			t.Fatalf("unexpected failed index: got %d, want %d", idx,
+				badIdx)
+		}
+		if _, ok := err.(RuleError); !ok {
+			t.Fatalf("unexpected error type %T for index %d", err, idx)
+		}
+
+		// The result must match the single header check.
+		if err := CheckProofOfWork(batch[badIdx], params); err == nil {
+			t.Fatalf("single header check accepted invalid header %d",
+				badIdx)
+		}
+	}
+}
@@ -31,6 +31,13 @@ const (
 	// not be performed.
 	BFNoPoWCheck
 
+	// BFNoEquihashCheck may be set to indicate the Equihash solution of the
+	// block header has already been verified, such as by
+	// CheckProofOfWorkBatch during headers-first sync, and therefore does
+	// not need to be validated again.  The remaining proof of work checks
+	// are still performed.
+	BFNoEquihashCheck
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -46,28 +53,20 @@ func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
 	}
 
 	// Check in the database.
+	//
+	// Only main chain blocks are considered since side chain blocks in the
+	// database are ignored.  This is necessary because there is not
+	// currently any record of the associated block index data, so it's not
+	// yet possible to efficiently load the block and do anything useful
+	// with it.  Main chain blocks are known even when their data has been
+	// pruned.
+	//
+	// Ultimately the entire block index should be serialized instead of
+	// only the current main chain so it can be consulted directly.
 	var exists bool
 	err := b.db.View(func(dbTx database.Tx) error {
-		var err error
-		exists, err = dbTx.HasBlock(hash)
-		if err != nil || !exists {
-			return err
-		}
-
-		// Ignore side chain blocks in the database.  This is necessary
-		// because there is not currently any record of the associated
-		// block index data, so it's not yet possible to efficiently load the
-		// block and do anything useful with it.
-		//
-		// Ultimately the entire block index should be serialized
-		// instead of only the current main chain so it can be consulted
-		// directly.
-		_, err = dbFetchHeightByHash(dbTx, hash)
-		if isNotInMainChainErr(err) {
-			exists = false
-			return nil
-		}
-		return err
+		exists = dbMainChainHasBlock(dbTx, hash)
+		return nil
 	})
 	return exists, err
 }
@@ -184,13 +183,13 @@ func (b *BlockChain) ProcessBlock(block *cmmutil.Block, flags BehaviorFlags) (bo
 	// used to eat memory, and ensuring expected (versus claimed) proof of
 	// work requirements since the previous checkpoint are met.
 	blockHeader := &block.MsgBlock().Header
-	checkpointBlock, err := b.findPreviousCheckpoint()
+	checkpointNode, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return false, false, err
 	}
-	if checkpointBlock != nil {
+	if checkpointNode != nil {
 		// Ensure the block timestamp is after the checkpoint timestamp.
-		checkpointHeader := &checkpointBlock.MsgBlock().Header
+		checkpointHeader := checkpointNode.Header()
 		checkpointTime := checkpointHeader.Timestamp
 		if blockHeader.Timestamp.Before(checkpointTime) {
 			str := fmt.Sprintf("block %v has timestamp %v before "+
@@ -248,6 +247,13 @@ func (b *BlockChain) ProcessBlock(block *cmmutil.Block, flags BehaviorFlags) (bo
 		return false, false, err
 	}
 
+	// Prune the oldest block data now that the best chain might have
+	// advanced.  Failing to prune only affects disk usage, so it does not
+	// cause the block to be rejected.
+	if err := b.maybePruneBlocks(); err != nil {
+		log.Warnf("Unable to prune blocks: %v", err)
+	}
+
 	log.Debugf("Accepted block %v", blockHash)
 
 	return isMainChain, false, nil
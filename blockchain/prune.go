@@ -3,9 +3,33 @@
 package blockchain
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/internal/dbnamespace"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/database"
 )
 
+const (
+	// MinBlocksToKeep is the minimum number of the most recent main chain
+	// blocks, in addition to the ticket maturity, whose data is never
+	// pruned.  This ensures reorganizations up to this depth remain
+	// possible, including connecting the stake nodes of the side chain
+	// blocks, which requires the blocks the newly maturing tickets were
+	// purchased in.
+	MinBlocksToKeep = 288
+
+	// MinPruneTarget is the minimum target size in bytes of the stored
+	// block data when pruning is enabled.
+	MinPruneTarget = 550 * 1024 * 1024
+)
+
+// pruneCheckInterval is the number of accepted blocks between checks of the
+// size of the stored block data when pruning is enabled.  Block data is removed
+// a whole block file at a time, so there is no need to check after every block.
+const pruneCheckInterval = 100
+
 // pruningIntervalInMinutes is the interval in which to prune the blockchain's
 // nodes and restore memory to the garbage collector.
 const pruningIntervalInMinutes = 5
@@ -39,3 +63,155 @@ func (c *chainPruner) pruneChainIfNeeded() {
 	c.lastNodeInsertTime = now
 	c.chain.pruneStakeNodes()
 }
+
+// pruneDepth returns the number of the most recent main chain blocks whose data
+// is never pruned.
+func (b *BlockChain) pruneDepth() int64 {
+	return MinBlocksToKeep + int64(b.chainParams.TicketMaturity)
+}
+
+// dbFetchPrunedHeight uses an existing database transaction to retrieve the
+// height of the most recent main chain block whose data has been pruned.  It
+// returns -1 when no block data has been pruned.
+func dbFetchPrunedHeight(dbTx database.Tx) int64 {
+	serialized := dbTx.Metadata().Get(dbnamespace.PrunedHeightKeyName)
+	if len(serialized) != 4 {
+		return -1
+	}
+	return int64(dbnamespace.ByteOrder.Uint32(serialized))
+}
+
+// dbPutPrunedHeight uses an existing database transaction to store the height
+// of the most recent main chain block whose data has been pruned.
+func dbPutPrunedHeight(dbTx database.Tx, height int64) error {
+	var serialized [4]byte
+	dbnamespace.ByteOrder.PutUint32(serialized[:], uint32(height))
+	return dbTx.Metadata().Put(dbnamespace.PrunedHeightKeyName, serialized[:])
+}
+
+// initPruneState loads the height of the most recently pruned main chain block
+// from the database.  A database which has been pruned no longer has the data
+// for all blocks, so it is an error to load one with pruning disabled.
+func (b *BlockChain) initPruneState() error {
+	err := b.db.View(func(dbTx database.Tx) error {
+		b.prunedHeight = dbFetchPrunedHeight(dbTx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if b.prunedHeight != -1 && b.pruneTarget == 0 {
+		return fmt.Errorf("the block database has been pruned up to "+
+			"height %d and may only be used with pruning enabled",
+			b.prunedHeight)
+	}
+	if b.pruneTarget != 0 {
+		log.Infof("Block pruning enabled with a target of %d MiB",
+			b.pruneTarget/(1024*1024))
+	}
+	return nil
+}
+
+// maybePruneBlocks removes the data of the oldest blocks from the database when
+// pruning is enabled and the stored block data exceeds the target size.  The
+// size is only checked every pruneCheckInterval calls.  Only
+// blocks which are buried at least pruneDepth blocks deep in the main chain, or
+// side chain blocks at or below that height, are ever removed.  The block index,
+// spend journal and stake undo data for the blocks are retained, so the headers
+// remain available.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybePruneBlocks() error {
+	if b.pruneTarget == 0 {
+		return nil
+	}
+	b.blocksSincePruneCheck++
+	if b.blocksSincePruneCheck < pruneCheckInterval {
+		return nil
+	}
+	b.blocksSincePruneCheck = 0
+	pruneHeight := b.bestNode.height - b.pruneDepth()
+	if pruneHeight < 0 {
+		return nil
+	}
+
+	// Avoid the write transaction when the stored block data is still
+	// within the target size.
+	storeSize, err := b.db.BlockStoreSize()
+	if err != nil || storeSize <= b.pruneTarget {
+		return err
+	}
+
+	var pruned []chainhash.Hash
+	prunedHeight := b.prunedHeight
+	err = b.db.Update(func(dbTx database.Tx) error {
+		canPrune := func(hash *chainhash.Hash) bool {
+			height, err := dbFetchHeightByHash(dbTx, hash)
+			if err == nil {
+				return height <= pruneHeight
+			}
+
+			// Side chain blocks which are not in the block index can't
+			// be used for anything, so they may always be pruned.
+			if node := b.index.LookupNode(hash); node != nil {
+				return node.height <= pruneHeight
+			}
+			return true
+		}
+
+		var err error
+		pruned, err = dbTx.PruneBlocks(b.pruneTarget, canPrune)
+		if err != nil || len(pruned) == 0 {
+			return err
+		}
+
+		// Track the most recent pruned main chain block.
+		for i := range pruned {
+			height, err := dbFetchHeightByHash(dbTx, &pruned[i])
+			if err == nil && height > prunedHeight {
+				prunedHeight = height
+			}
+		}
+		return dbPutPrunedHeight(dbTx, prunedHeight)
+	})
+	if err != nil {
+		return err
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+
+	b.prunedHeight = prunedHeight
+	log.Debugf("Pruned %d blocks up to height %d", len(pruned), prunedHeight)
+	return nil
+}
+
+// PrunedHeight returns the height of the most recent main chain block whose
+// data has been pruned.  It returns -1 when no block data has been pruned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PrunedHeight() int64 {
+	b.chainLock.RLock()
+	prunedHeight := b.prunedHeight
+	b.chainLock.RUnlock()
+	return prunedHeight
+}
+
+// IsBlockPruned returns whether or not the data for the main chain block with
+// the given hash has been pruned.  The block header is still available.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsBlockPruned(hash *chainhash.Hash) (bool, error) {
+	var pruned bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		if !dbMainChainHasBlock(dbTx, hash) {
+			return nil
+		}
+
+		exists, err := dbTx.HasBlock(hash)
+		pruned = !exists
+		return err
+	})
+	return pruned, err
+}
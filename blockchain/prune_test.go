@@ -0,0 +1,76 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/database"
+	"github.com/CommerciumBlockchain/cmmd/txscript"
+)
+
+// TestPruneState ensures the prune target is validated and that a database
+// which has been pruned may only be loaded with pruning enabled.
+func TestPruneState(t *testing.T) {
+	chain, teardownChain, err := chainSetup("prunestate",
+		&chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownChain()
+
+	newChain := func(pruneTarget uint64) (*BlockChain, error) {
+		return New(&Config{
+			DB:          chain.db,
+			ChainParams: &chaincfg.SimNetParams,
+			TimeSource:  NewMedianTime(),
+			SigCache:    txscript.NewSigCache(1000),
+			PruneTarget: pruneTarget,
+		})
+	}
+
+	// Ensure a prune target below the minimum is rejected.
+	if _, err := newChain(MinPruneTarget - 1); err == nil {
+		t.Fatal("did not receive expected error for small prune target")
+	}
+
+	// Ensure an unpruned database may be loaded with pruning enabled and
+	// that nothing is reported as pruned.
+	pruneChain, err := newChain(MinPruneTarget)
+	if err != nil {
+		t.Fatalf("failed to create pruning chain: %v", err)
+	}
+	if height := pruneChain.PrunedHeight(); height != -1 {
+		t.Fatalf("unexpected pruned height - got %d, want -1", height)
+	}
+	genesisHash := chaincfg.SimNetParams.GenesisHash
+	pruned, err := pruneChain.IsBlockPruned(genesisHash)
+	if err != nil {
+		t.Fatalf("IsBlockPruned: unexpected error: %v", err)
+	}
+	if pruned {
+		t.Fatal("IsBlockPruned: genesis block unexpectedly pruned")
+	}
+
+	// Mark the database as pruned and ensure it may no longer be loaded
+	// without pruning while the pruned height is loaded with it enabled.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbPutPrunedHeight(dbTx, 0)
+	})
+	if err != nil {
+		t.Fatalf("failed to store pruned height: %v", err)
+	}
+	if _, err := newChain(0); err == nil {
+		t.Fatal("did not receive expected error loading pruned database")
+	}
+	pruneChain, err = newChain(MinPruneTarget)
+	if err != nil {
+		t.Fatalf("failed to create pruning chain: %v", err)
+	}
+	if height := pruneChain.PrunedHeight(); height != 0 {
+		t.Fatalf("unexpected pruned height - got %d, want 0", height)
+	}
+}
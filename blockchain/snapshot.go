@@ -0,0 +1,665 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/internal/dbnamespace"
+	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/database"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+const (
+	// snapshotVersion is the current version of the utxo snapshot format.
+	snapshotVersion = 1
+
+	// snapshotRecentBlocks is the number of most recent main chain blocks
+	// which are included in a snapshot along with their spend journal
+	// entries.  The best block and its parent are required to load the
+	// chain state, while the others allow shallow reorganizations across
+	// the snapshot block.
+	snapshotRecentBlocks = 8
+
+	// snapshotHeaderSize is the size of the fixed snapshot header.
+	snapshotHeaderSize = 4 + 4 + 4 + 4 + 4 + 4 + chainhash.HashSize + 4 +
+		chainhash.HashSize
+
+	// maxSnapshotKeySize is the maximum size of a bucket name or key in a
+	// snapshot record.
+	maxSnapshotKeySize = 256
+
+	// maxSnapshotValueSize is the maximum size of a value in a snapshot
+	// record.
+	maxSnapshotValueSize = wire.MaxBlockPayload
+)
+
+// snapshotMagic identifies a utxo snapshot file.
+var snapshotMagic = [4]byte{'c', 'm', 'u', 's'}
+
+// Snapshot record types.
+const (
+	snapshotRecordEntry byte = iota
+	snapshotRecordBlock
+	snapshotRecordEnd = 0xff
+)
+
+// -----------------------------------------------------------------------------
+// A utxo snapshot contains everything needed to initialize the chain state at
+// a given main chain block without replaying the blocks that lead up to it.
+// That is the compressed utxo set, the stake database, the block index entries
+// of the main chain and the most recent blocks along with their spend journal
+// entries.
+//
+// The serialized format is:
+//
+//   <header><record 0><record 1>...<end marker><snapshot hash>
+//
+// The header is:
+//
+//   Field              Type              Size
+//   magic              [4]byte           4 bytes
+//   snapshot version   uint32            4 bytes
+//   network            wire.CurrencyNet  4 bytes
+//   database version   uint32            4 bytes
+//   compression ver    uint32            4 bytes
+//   block index ver    uint32            4 bytes
+//   block hash         chainhash.Hash    chainhash.HashSize
+//   block height       uint32            4 bytes
+//   utxo hash          chainhash.Hash    chainhash.HashSize
+//
+// Each record is:
+//
+//   <record type><bucket name><key><value>
+//
+//   Field         Type      Size
+//   record type   byte      1 byte
+//   bucket name   []byte    variable (varint length prefix)
+//   key           []byte    variable (varint length prefix)
+//   value         []byte    variable (varint length prefix)
+//
+// Entry records hold a key and value of the named database metadata bucket,
+// or of the metadata itself when the bucket name is empty.  Block records
+// hold a block hash and the serialized block.  The end marker is a single
+// record type byte.
+//
+// The utxo hash commits to the utxo set the same way as the serialized hash
+// returned by FetchUtxoStats, so snapshots can be checked against the
+// gettxoutsetinfo RPC of any fully synced node.
+//
+// The trailing snapshot hash is the sha256 hash of everything that precedes
+// it, from the header through the end marker.  Unlike the utxo hash, it
+// commits to all of the imported state, including the stake database, the
+// block index, the spend journal and the blocks, and it is the hash which must
+// be pinned for a snapshot to be imported.
+// -----------------------------------------------------------------------------
+
+// SnapshotInfo describes the block a utxo snapshot was taken at.
+type SnapshotInfo struct {
+	Hash         chainhash.Hash
+	Height       int64
+	UtxoHash     chainhash.Hash
+	SnapshotHash chainhash.Hash
+}
+
+// snapshotWriter writes snapshot records while tracking the first error.
+type snapshotWriter struct {
+	w   io.Writer
+	err error
+}
+
+// writeRecord writes a single record of the given type.
+func (sw *snapshotWriter) writeRecord(recordType byte, bucket, key, value []byte) {
+	if sw.err != nil {
+		return
+	}
+	if _, sw.err = sw.w.Write([]byte{recordType}); sw.err != nil {
+		return
+	}
+	for _, b := range [][]byte{bucket, key, value} {
+		if sw.err = wire.WriteVarBytes(sw.w, 0, b); sw.err != nil {
+			return
+		}
+	}
+}
+
+// writeBucket writes an entry record for every key in the named metadata
+// bucket.
+func (sw *snapshotWriter) writeBucket(dbTx database.Tx, bucketName []byte) {
+	if sw.err != nil {
+		return
+	}
+	bucket := dbTx.Metadata().Bucket(bucketName)
+	if bucket == nil {
+		sw.err = AssertError(fmt.Sprintf("missing bucket %s", bucketName))
+		return
+	}
+	err := bucket.ForEach(func(k, v []byte) error {
+		sw.writeRecord(snapshotRecordEntry, bucketName, k, v)
+		return sw.err
+	})
+	if sw.err == nil {
+		sw.err = err
+	}
+}
+
+// WriteUtxoSnapshot writes a utxo snapshot of the current best chain state to
+// the passed writer.  The snapshot can later be imported into a new database
+// with LoadUtxoSnapshot once its snapshot hash has been pinned in the chain
+// parameters.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) WriteUtxoSnapshot(w io.Writer) (*SnapshotInfo, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	best := b.bestNode
+	info := &SnapshotInfo{Hash: best.hash, Height: best.height}
+	err := b.db.View(func(dbTx database.Tx) error {
+		// Commit to the utxo set up front so the hash is known when
+		// writing the header.
+		stats, err := dbFetchUtxoStats(dbTx)
+		if err != nil {
+			return err
+		}
+		info.UtxoHash = stats.SerializedHash
+
+		var hdr [snapshotHeaderSize]byte
+		offset := copy(hdr[:], snapshotMagic[:])
+		binary.LittleEndian.PutUint32(hdr[offset:], snapshotVersion)
+		offset += 4
+		binary.LittleEndian.PutUint32(hdr[offset:], uint32(b.chainParams.Net))
+		offset += 4
+		binary.LittleEndian.PutUint32(hdr[offset:], b.dbInfo.version)
+		offset += 4
+		binary.LittleEndian.PutUint32(hdr[offset:], b.dbInfo.compVer)
+		offset += 4
+		binary.LittleEndian.PutUint32(hdr[offset:], b.dbInfo.bidxVer)
+		offset += 4
+		offset += copy(hdr[offset:], info.Hash[:])
+		binary.LittleEndian.PutUint32(hdr[offset:], uint32(info.Height))
+		offset += 4
+		copy(hdr[offset:], info.UtxoHash[:])
+
+		// Commit to everything up to and including the end marker.
+		hasher := sha256.New()
+		hw := io.MultiWriter(w, hasher)
+		if _, err := hw.Write(hdr[:]); err != nil {
+			return err
+		}
+
+		meta := dbTx.Metadata()
+		sw := &snapshotWriter{w: hw}
+		sw.writeRecord(snapshotRecordEntry, nil,
+			dbnamespace.ChainStateKeyName,
+			meta.Get(dbnamespace.ChainStateKeyName))
+		sw.writeRecord(snapshotRecordEntry, nil,
+			stake.DatabaseStateKeyName(),
+			meta.Get(stake.DatabaseStateKeyName()))
+
+		// Write the block index entries of the main chain.  The hash and
+		// height indexes are rebuilt from them on import.
+		blockIndex := meta.Bucket(dbnamespace.BlockIndexBucketName)
+		for height := int64(0); height <= info.Height && sw.err == nil; height++ {
+			hash, err := dbFetchHashByHeight(dbTx, height)
+			if err != nil {
+				return err
+			}
+			key := blockIndexKey(hash, uint32(height))
+			sw.writeRecord(snapshotRecordEntry,
+				dbnamespace.BlockIndexBucketName, key,
+				blockIndex.Get(key))
+		}
+
+		// Write the most recent blocks along with their spend journal
+		// entries.
+		spendJournal := meta.Bucket(dbnamespace.SpendJournalBucketName)
+		for i := int64(0); i < snapshotRecentBlocks && sw.err == nil; i++ {
+			height := info.Height - i
+			if height < 0 {
+				break
+			}
+			hash, err := dbFetchHashByHeight(dbTx, height)
+			if err != nil {
+				return err
+			}
+			blockBytes, err := dbTx.FetchBlock(hash)
+			if err != nil {
+				return err
+			}
+			sw.writeRecord(snapshotRecordBlock, nil, hash[:], blockBytes)
+			if stxos := spendJournal.Get(hash[:]); stxos != nil {
+				sw.writeRecord(snapshotRecordEntry,
+					dbnamespace.SpendJournalBucketName, hash[:],
+					stxos)
+			}
+		}
+
+		// Write the stake database and the utxo set.
+		for _, bucketName := range stake.DatabaseBucketNames() {
+			sw.writeBucket(dbTx, bucketName)
+		}
+		sw.writeBucket(dbTx, dbnamespace.UtxoSetBucketName)
+		if sw.err != nil {
+			return sw.err
+		}
+
+		if _, err := hw.Write([]byte{snapshotRecordEnd}); err != nil {
+			return err
+		}
+		copy(info.SnapshotHash[:], hasher.Sum(nil))
+		_, err = w.Write(info.SnapshotHash[:])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// snapshotBuckets returns the set of metadata buckets a snapshot is allowed to
+// populate.
+func snapshotBuckets() map[string]struct{} {
+	buckets := map[string]struct{}{
+		string(dbnamespace.BlockIndexBucketName):   {},
+		string(dbnamespace.SpendJournalBucketName): {},
+		string(dbnamespace.UtxoSetBucketName):      {},
+	}
+	for _, bucketName := range stake.DatabaseBucketNames() {
+		buckets[string(bucketName)] = struct{}{}
+	}
+	return buckets
+}
+
+// LoadUtxoSnapshot imports a utxo snapshot created by WriteUtxoSnapshot into
+// the passed database so the chain can be initialized at the snapshot block
+// instead of the genesis block.  The database must not contain any chain state
+// yet and the snapshot must be pinned by the passed chain parameters, both by
+// its block and by the hash of its entire contents.  Nothing is imported when
+// the contents do not match the pinned hash.
+//
+// Blocks before the snapshot block are not available afterwards.  Their
+// headers may be checked with VerifySnapshotHistory.
+func LoadUtxoSnapshot(db database.DB, r io.Reader, params *chaincfg.Params) (*SnapshotInfo, error) {
+	// Read and check the header while committing to everything up to the
+	// trailing snapshot hash.
+	snapshotHasher := sha256.New()
+	hr := io.TeeReader(r, snapshotHasher)
+	var hdr [snapshotHeaderSize]byte
+	if _, err := io.ReadFull(hr, hdr[:]); err != nil {
+		return nil, fmt.Errorf("unable to read snapshot header: %v", err)
+	}
+	if !bytes.Equal(hdr[:4], snapshotMagic[:]) {
+		return nil, fmt.Errorf("not a utxo snapshot")
+	}
+	offset := 4
+	version := binary.LittleEndian.Uint32(hdr[offset:])
+	offset += 4
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported utxo snapshot version %d",
+			version)
+	}
+	net := wire.CurrencyNet(binary.LittleEndian.Uint32(hdr[offset:]))
+	offset += 4
+	if net != params.Net {
+		return nil, fmt.Errorf("utxo snapshot is for network %v, not %v",
+			net, params.Net)
+	}
+	dbi := databaseInfo{
+		version: binary.LittleEndian.Uint32(hdr[offset:]),
+		compVer: binary.LittleEndian.Uint32(hdr[offset+4:]),
+		bidxVer: binary.LittleEndian.Uint32(hdr[offset+8:]),
+	}
+	offset += 12
+	if dbi.version != currentDatabaseVersion ||
+		dbi.compVer != currentCompressionVersion ||
+		dbi.bidxVer != currentBlockIndexVersion {
+
+		return nil, fmt.Errorf("utxo snapshot database versions "+
+			"%d/%d/%d do not match %d/%d/%d", dbi.version, dbi.compVer,
+			dbi.bidxVer, currentDatabaseVersion,
+			currentCompressionVersion, currentBlockIndexVersion)
+	}
+	var info SnapshotInfo
+	offset += copy(info.Hash[:], hdr[offset:])
+	info.Height = int64(binary.LittleEndian.Uint32(hdr[offset:]))
+	offset += 4
+	copy(info.UtxoHash[:], hdr[offset:])
+
+	// Ensure the snapshot is pinned by the chain parameters.
+	var pinned *chaincfg.UtxoSnapshot
+	for i := range params.UtxoSnapshots {
+		snapshot := &params.UtxoSnapshots[i]
+		if snapshot.Height == info.Height &&
+			snapshot.Hash.IsEqual(&info.Hash) {
+
+			pinned = snapshot
+			break
+		}
+	}
+	if pinned == nil {
+		return nil, fmt.Errorf("utxo snapshot of block %v (height %d) "+
+			"is not pinned by the %s network parameters", info.Hash,
+			info.Height, params.Name)
+	}
+	if pinned.SnapshotHash == nil {
+		return nil, fmt.Errorf("utxo snapshot of block %v (height %d) "+
+			"is pinned without a snapshot hash", info.Hash, info.Height)
+	}
+	if !pinned.UtxoHash.IsEqual(&info.UtxoHash) {
+		return nil, fmt.Errorf("utxo snapshot hash %v does not match "+
+			"pinned hash %v", info.UtxoHash, pinned.UtxoHash)
+	}
+
+	allowedBuckets := snapshotBuckets()
+	err := db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Get(dbnamespace.ChainStateKeyName) != nil ||
+			meta.Bucket(dbnamespace.BCDBInfoBucketName) != nil {
+
+			return fmt.Errorf("unable to import a utxo snapshot " +
+				"into an initialized database")
+		}
+
+		// Create the buckets along with the database version
+		// information the same way a new chain state is created.
+		_, err := meta.CreateBucket(dbnamespace.BCDBInfoBucketName)
+		if err != nil {
+			return err
+		}
+		dbi.created = params.GenesisBlock.Header.Timestamp
+		if err := dbPutDatabaseInfo(dbTx, &dbi); err != nil {
+			return err
+		}
+		for _, bucketName := range [][]byte{
+			dbnamespace.BlockIndexBucketName,
+			dbnamespace.HashIndexBucketName,
+			dbnamespace.HeightIndexBucketName,
+			dbnamespace.SpendJournalBucketName,
+			dbnamespace.UtxoSetBucketName,
+		} {
+			if _, err := meta.CreateBucket(bucketName); err != nil {
+				return err
+			}
+		}
+		for _, bucketName := range stake.DatabaseBucketNames() {
+			if _, err := meta.CreateBucket(bucketName); err != nil {
+				return err
+			}
+		}
+
+		// Import the records while committing to the utxo set and
+		// keeping track of the main chain.
+		hasher := sha256.New()
+		var numIndexEntries int64
+		var haveBest bool
+		for {
+			var recordType [1]byte
+			if _, err := io.ReadFull(hr, recordType[:]); err != nil {
+				return fmt.Errorf("unable to read snapshot "+
+					"record: %v", err)
+			}
+			if recordType[0] == snapshotRecordEnd {
+				break
+			}
+
+			bucketName, err := wire.ReadVarBytes(hr, 0,
+				maxSnapshotKeySize, "bucket name")
+			if err != nil {
+				return err
+			}
+			key, err := wire.ReadVarBytes(hr, 0, maxSnapshotKeySize,
+				"key")
+			if err != nil {
+				return err
+			}
+			value, err := wire.ReadVarBytes(hr, 0,
+				maxSnapshotValueSize, "value")
+			if err != nil {
+				return err
+			}
+
+			switch recordType[0] {
+			case snapshotRecordBlock:
+				block, err := cmmutil.NewBlockFromBytes(value)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(block.Hash()[:], key) {
+					return fmt.Errorf("snapshot block %v "+
+						"does not match its key %x",
+						block.Hash(), key)
+				}
+				if block.Hash().IsEqual(&info.Hash) {
+					haveBest = true
+				}
+				if err := dbTx.StoreBlock(block); err != nil {
+					return err
+				}
+
+			case snapshotRecordEntry:
+				if len(bucketName) == 0 {
+					if !bytes.Equal(key, dbnamespace.ChainStateKeyName) &&
+						!bytes.Equal(key, stake.DatabaseStateKeyName()) {
+
+						return fmt.Errorf("unexpected "+
+							"snapshot key %q", key)
+					}
+					if err := meta.Put(key, value); err != nil {
+						return err
+					}
+					continue
+				}
+				if _, ok := allowedBuckets[string(bucketName)]; !ok {
+					return fmt.Errorf("unexpected snapshot "+
+						"bucket %q", bucketName)
+				}
+
+				switch {
+				case bytes.Equal(bucketName, dbnamespace.UtxoSetBucketName):
+					hasher.Write(key)
+					hasher.Write(value)
+
+				case bytes.Equal(bucketName, dbnamespace.BlockIndexBucketName):
+					// Rebuild the main chain hash and height
+					// indexes from the block index entries,
+					// which must be in height order.
+					if len(key) != chainhash.HashSize+4 {
+						return fmt.Errorf("malformed "+
+							"snapshot block index key %x",
+							key)
+					}
+					height := binary.BigEndian.Uint32(key[:4])
+					if int64(height) != numIndexEntries {
+						return fmt.Errorf("unexpected "+
+							"snapshot block index height "+
+							"%d", height)
+					}
+					hash, err := chainhash.NewHash(key[4:])
+					if err != nil {
+						return err
+					}
+					if height == 0 && !hash.IsEqual(params.GenesisHash) {
+						return fmt.Errorf("utxo snapshot " +
+							"does not start at the genesis " +
+							"block")
+					}
+					err = dbPutMainChainIndex(dbTx, hash,
+						int64(height))
+					if err != nil {
+						return err
+					}
+					numIndexEntries++
+				}
+				if err := meta.Bucket(bucketName).Put(key, value); err != nil {
+					return err
+				}
+
+			default:
+				return fmt.Errorf("unknown snapshot record type %d",
+					recordType[0])
+			}
+		}
+
+		// Ensure the imported state is complete and matches the pinned
+		// snapshot.  Any mismatch rolls back the entire import.
+		copy(info.SnapshotHash[:], snapshotHasher.Sum(nil))
+		var trailer chainhash.Hash
+		if _, err := io.ReadFull(r, trailer[:]); err != nil {
+			return fmt.Errorf("unable to read snapshot hash: %v", err)
+		}
+		if trailer != info.SnapshotHash {
+			return fmt.Errorf("snapshot contents hash %v does not "+
+				"match the snapshot hash %v", info.SnapshotHash,
+				trailer)
+		}
+		if !pinned.SnapshotHash.IsEqual(&info.SnapshotHash) {
+			return fmt.Errorf("snapshot contents hash %v does not "+
+				"match pinned hash %v", info.SnapshotHash,
+				pinned.SnapshotHash)
+		}
+		var utxoHash chainhash.Hash
+		copy(utxoHash[:], hasher.Sum(nil))
+		if utxoHash != info.UtxoHash {
+			return fmt.Errorf("utxo set hash %v does not match the "+
+				"snapshot hash %v", utxoHash, info.UtxoHash)
+		}
+		if !haveBest || numIndexEntries != info.Height+1 {
+			return fmt.Errorf("utxo snapshot is incomplete")
+		}
+		state, err := deserializeBestChainState(
+			meta.Get(dbnamespace.ChainStateKeyName))
+		if err != nil {
+			return err
+		}
+		if state.hash != info.Hash || int64(state.height) != info.Height {
+			return fmt.Errorf("utxo snapshot chain state does not " +
+				"match the snapshot block")
+		}
+
+		// Remember the snapshot block so the prior history can be
+		// verified later.
+		var serialized [chainhash.HashSize + 4]byte
+		copy(serialized[:], info.Hash[:])
+		dbnamespace.ByteOrder.PutUint32(serialized[chainhash.HashSize:],
+			uint32(info.Height))
+		return meta.Put(dbnamespace.UtxoSnapshotKeyName, serialized[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// DBFetchUtxoSnapshot uses an existing database transaction to fetch the block
+// the chain state was bootstrapped from when it was imported from a utxo
+// snapshot.  The returned hash is nil when the chain state was not imported.
+func DBFetchUtxoSnapshot(dbTx database.Tx) (*chainhash.Hash, int64) {
+	serialized := dbTx.Metadata().Get(dbnamespace.UtxoSnapshotKeyName)
+	if len(serialized) != chainhash.HashSize+4 {
+		return nil, 0
+	}
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	height := dbnamespace.ByteOrder.Uint32(serialized[chainhash.HashSize:])
+	return &hash, int64(height)
+}
+
+// VerifySnapshotHistory checks the main chain headers leading up to the block
+// the chain state was imported at from a utxo snapshot.  Every header must
+// connect to the previous one, match any checkpoints and carry a valid proof
+// of work including the equihash solution.  It does nothing when the chain
+// state was not imported from a snapshot.
+//
+// This function is safe for concurrent access and is intended to be run in
+// the background.
+func (b *BlockChain) VerifySnapshotHistory(interrupt <-chan struct{}) error {
+	var snapHash *chainhash.Hash
+	var snapHeight int64
+	err := b.db.View(func(dbTx database.Tx) error {
+		snapHash, snapHeight = DBFetchUtxoSnapshot(dbTx)
+		return nil
+	})
+	if err != nil || snapHash == nil {
+		return err
+	}
+
+	log.Infof("Verifying the block headers leading up to the utxo "+
+		"snapshot at height %d", snapHeight)
+
+	// Verify the headers in batches to avoid holding a database
+	// transaction open for the entire history.
+	const batchSize = 2000
+	prevHash := *b.chainParams.GenesisHash
+	for height := int64(1); height <= snapHeight; {
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+
+		err = b.db.View(func(dbTx database.Tx) error {
+			for end := height + batchSize; height < end &&
+				height <= snapHeight; height++ {
+
+				hash, err := dbFetchHashByHeight(dbTx, height)
+				if err != nil {
+					return err
+				}
+				entry, err := dbFetchBlockIndexEntry(dbTx, hash,
+					uint32(height))
+				if err != nil {
+					return err
+				}
+				header := &entry.header
+				if header.BlockHash() != *hash ||
+					header.PrevBlock != prevHash ||
+					int64(header.Height) != height {
+
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("header "+
+							"at height %d does not "+
+							"connect", height),
+					}
+				}
+				if checkpoint, ok := b.checkpointsByHeight[height]; ok &&
+					!checkpoint.Hash.IsEqual(hash) {
+
+					str := fmt.Sprintf("block at height %d "+
+						"does not match checkpoint hash",
+						height)
+					return ruleError(ErrBadCheckpoint, str)
+				}
+				err = checkProofOfWork(header, b.chainParams,
+					BFNone)
+				if err != nil {
+					return err
+				}
+				prevHash = *hash
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if prevHash != *snapHash {
+		return AssertError(fmt.Sprintf("verified history ends at %v "+
+			"instead of the snapshot block %v", prevHash, snapHash))
+	}
+
+	log.Infof("Verified the block headers leading up to the utxo snapshot "+
+		"at height %d", snapHeight)
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/database"
+	"github.com/CommerciumBlockchain/cmmd/txscript"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestUtxoSnapshot ensures a utxo snapshot written by one chain can be
+// imported into a new database only when it is pinned by the chain parameters
+// and that the imported chain state matches the original one.
+func TestUtxoSnapshot(t *testing.T) {
+	chain, teardownChain, err := chainSetup("utxosnapshot",
+		&chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownChain()
+
+	var snapshot bytes.Buffer
+	info, err := chain.WriteUtxoSnapshot(&snapshot)
+	if err != nil {
+		t.Fatalf("unable to write snapshot: %v", err)
+	}
+	best := chain.BestSnapshot()
+	if info.Hash != best.Hash || info.Height != best.Height {
+		t.Fatalf("unexpected snapshot block - got %v (%d), want %v (%d)",
+			info.Hash, info.Height, best.Hash, best.Height)
+	}
+	stats, err := chain.FetchUtxoStats()
+	if err != nil {
+		t.Fatalf("unable to fetch utxo stats: %v", err)
+	}
+	if info.UtxoHash != stats.SerializedHash {
+		t.Fatalf("unexpected snapshot utxo hash - got %v, want %v",
+			info.UtxoHash, stats.SerializedHash)
+	}
+
+	// newDB creates a new database which is removed when the test ends.
+	newDB := func(name string) database.DB {
+		dbPath := filepath.Join(testDbRoot, name)
+		_ = os.RemoveAll(dbPath)
+		db, err := database.Create(testDbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("error creating db: %v", err)
+		}
+		return db
+	}
+
+	pinnedParams := chaincfg.SimNetParams
+	pinnedParams.UtxoSnapshots = []chaincfg.UtxoSnapshot{{
+		Height:       info.Height,
+		Hash:         &info.Hash,
+		UtxoHash:     &info.UtxoHash,
+		SnapshotHash: &info.SnapshotHash,
+	}}
+	badHashParams := pinnedParams
+	badHashParams.UtxoSnapshots = []chaincfg.UtxoSnapshot{{
+		Height:       info.Height,
+		Hash:         &info.Hash,
+		UtxoHash:     &chainhash.Hash{0x01},
+		SnapshotHash: &info.SnapshotHash,
+	}}
+	noSnapshotHashParams := pinnedParams
+	noSnapshotHashParams.UtxoSnapshots = []chaincfg.UtxoSnapshot{{
+		Height:   info.Height,
+		Hash:     &info.Hash,
+		UtxoHash: &info.UtxoHash,
+	}}
+	data := snapshot.Bytes()
+
+	// Inject a live ticket into the stake database of the snapshot while
+	// leaving the utxo set untouched and updating the trailing snapshot
+	// hash accordingly.  Such a snapshot still matches the pinned utxo hash
+	// and must only be rejected because of the pinned snapshot hash.
+	contentsLen := len(data) - chainhash.HashSize - 1
+	var tampered bytes.Buffer
+	tampered.Write(data[:contentsLen])
+	tampered.WriteByte(snapshotRecordEntry)
+	for _, b := range [][]byte{[]byte("livetickets"),
+		bytes.Repeat([]byte{0x01}, chainhash.HashSize),
+		make([]byte, 9)} {
+
+		if err := wire.WriteVarBytes(&tampered, 0, b); err != nil {
+			t.Fatalf("unable to write tampered record: %v", err)
+		}
+	}
+	tampered.WriteByte(snapshotRecordEnd)
+	tamperedHash := sha256.Sum256(tampered.Bytes())
+	tampered.Write(tamperedHash[:])
+
+	// Also corrupt the trailing snapshot hash on its own.
+	badTrailer := append([]byte(nil), data...)
+	badTrailer[len(badTrailer)-1] ^= 0x01
+	tests := []struct {
+		name   string
+		data   []byte
+		params *chaincfg.Params
+	}{
+		{"not pinned", data, &chaincfg.SimNetParams},
+		{"wrong network", data, &chaincfg.MainNetParams},
+		{"utxo hash mismatch", data, &badHashParams},
+		{"snapshot hash not pinned", data, &noSnapshotHashParams},
+		{"tampered ticket bucket", tampered.Bytes(), &pinnedParams},
+		{"snapshot hash mismatch", badTrailer, &pinnedParams},
+		{"truncated", data[:len(data)-1], &pinnedParams},
+		{"bad magic", append([]byte{0}, data[1:]...), &pinnedParams},
+	}
+	db := newDB("utxosnapshotimport")
+	defer db.Close()
+	for _, test := range tests {
+		_, err := LoadUtxoSnapshot(db, bytes.NewReader(test.data),
+			test.params)
+		if err == nil {
+			t.Fatalf("%s: did not receive expected error", test.name)
+		}
+	}
+
+	// The failed imports must not leave anything behind, so the pinned
+	// snapshot is still accepted.
+	imported, err := LoadUtxoSnapshot(db, bytes.NewReader(data),
+		&pinnedParams)
+	if err != nil {
+		t.Fatalf("unable to import snapshot: %v", err)
+	}
+	if *imported != *info {
+		t.Fatalf("unexpected imported snapshot - got %+v, want %+v",
+			imported, info)
+	}
+	_, err = LoadUtxoSnapshot(db, bytes.NewReader(data), &pinnedParams)
+	if err == nil {
+		t.Fatal("did not receive error importing into initialized db")
+	}
+
+	// Create a chain from the imported state and ensure it matches the
+	// original one.
+	importedChain, err := New(&Config{
+		DB:          db,
+		ChainParams: &pinnedParams,
+		TimeSource:  NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain from snapshot: %v", err)
+	}
+	importedBest := importedChain.BestSnapshot()
+	if importedBest.Hash != best.Hash || importedBest.Height != best.Height ||
+		importedBest.TotalTxns != best.TotalTxns {
+
+		t.Fatalf("unexpected imported best state - got %+v, want %+v",
+			importedBest, best)
+	}
+	if err := importedChain.VerifySnapshotHistory(nil); err != nil {
+		t.Fatalf("unable to verify snapshot history: %v", err)
+	}
+}
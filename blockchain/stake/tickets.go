@@ -268,6 +268,26 @@ func InitDatabaseState(dbTx database.Tx, params *chaincfg.Params) (*Node, error)
 	return genesis, nil
 }
 
+// DatabaseBucketNames returns the names of the database metadata buckets which
+// house the stake database.  Together with the key returned by
+// DatabaseStateKeyName they make up the entire stake database state.
+func DatabaseBucketNames() [][]byte {
+	return [][]byte{
+		dbnamespace.StakeDbInfoBucketName,
+		dbnamespace.LiveTicketsBucketName,
+		dbnamespace.MissedTicketsBucketName,
+		dbnamespace.RevokedTicketsBucketName,
+		dbnamespace.StakeBlockUndoDataBucketName,
+		dbnamespace.TicketsInBlockBucketName,
+	}
+}
+
+// DatabaseStateKeyName returns the name of the database metadata key which
+// houses the best state of the stake database.
+func DatabaseStateKeyName() []byte {
+	return dbnamespace.StakeChainStateKeyName
+}
+
 // LoadBestNode is used when the blockchain is initialized, to get the initial
 // stake node from the database bucket.  The blockchain must pass the height
 // and the blockHash to confirm that the ticket database is on the same
@@ -1156,3 +1156,27 @@ func (b *BlockChain) FetchUtxoEntry(txHash *chainhash.Hash) (*UtxoEntry, error)
 
 	return entry, nil
 }
+
+// FetchUtxoStats returns statistics on the current utxo set along with the
+// best block they were calculated for.  Since the entire utxo set is walked,
+// this is an expensive operation.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchUtxoStats() (*UtxoStats, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	var stats *UtxoStats
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		stats, err = dbFetchUtxoStats(dbTx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.BestHash = b.bestNode.hash
+	stats.BestHeight = b.bestNode.height
+	return stats, nil
+}
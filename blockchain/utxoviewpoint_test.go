@@ -0,0 +1,150 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/chaingen"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestFetchUtxoStats ensures the utxo set statistics match the unspent outputs
+// of the transactions of a generated chain, both before and after outputs are
+// spent and tickets are purchased.
+func TestFetchUtxoStats(t *testing.T) {
+	params := &chaincfg.SimNetParams
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("utxostatstest", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Create a test generator instance initialized with the genesis block
+	// as the tip.
+	g, err := chaingen.MakeGenerator(params, chain)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	// processBlock processes the named block, ensures it extends the main
+	// chain and keeps track of its transactions.
+	var txns []*wire.MsgTx
+	processBlock := func(blockName string) {
+		msgBlock := g.BlockByName(blockName)
+		block := cmmutil.NewBlock(msgBlock)
+		isMainChain, isOrphan, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("block %q (hash %s, height %d) should have been "+
+				"accepted: %v", blockName, block.Hash(),
+				msgBlock.Header.Height, err)
+		}
+		if !isMainChain || isOrphan {
+			t.Fatalf("block %q (hash %s, height %d) unexpected flags "+
+				"-- got main chain %v, orphan %v", blockName,
+				block.Hash(), msgBlock.Header.Height, isMainChain,
+				isOrphan)
+		}
+		txns = append(txns, msgBlock.Transactions...)
+		txns = append(txns, msgBlock.STransactions...)
+	}
+
+	// expectStats ensures the utxo set statistics match the unspent
+	// outputs of the tracked transactions and the current best block, and
+	// returns them.
+	expectStats := func(desc string) *UtxoStats {
+		t.Helper()
+
+		var want UtxoStats
+		for _, tx := range txns {
+			txHash := tx.TxHash()
+			entry, err := chain.FetchUtxoEntry(&txHash)
+			if err != nil {
+				t.Fatalf("%s: unable to fetch utxo entry: %v", desc,
+					err)
+			}
+			if entry == nil {
+				continue
+			}
+			want.Transactions++
+			for i := range tx.TxOut {
+				if entry.IsOutputSpent(uint32(i)) {
+					continue
+				}
+				want.Utxos++
+				want.Total += entry.AmountByIndex(uint32(i))
+			}
+		}
+
+		stats, err := chain.FetchUtxoStats()
+		if err != nil {
+			t.Fatalf("%s: unable to fetch utxo stats: %v", desc, err)
+		}
+		best := chain.BestSnapshot()
+		if stats.BestHash != best.Hash || stats.BestHeight != best.Height {
+			t.Fatalf("%s: unexpected best block -- got %v (%d), want "+
+				"%v (%d)", desc, stats.BestHash, stats.BestHeight,
+				best.Hash, best.Height)
+		}
+		if stats.Transactions != want.Transactions ||
+			stats.Utxos != want.Utxos || stats.Total != want.Total {
+
+			t.Fatalf("%s: unexpected stats -- got %d txns, %d utxos, "+
+				"total %d, want %d txns, %d utxos, total %d", desc,
+				stats.Transactions, stats.Utxos, stats.Total,
+				want.Transactions, want.Utxos, want.Total)
+		}
+		if (stats.Size > 0) != (stats.Transactions > 0) {
+			t.Fatalf("%s: unexpected serialized size %d for %d txns",
+				desc, stats.Size, stats.Transactions)
+		}
+		return stats
+	}
+
+	// The utxo set of a chain with only the genesis block is empty since
+	// the outputs of the genesis block are not spendable.
+	stats := expectStats("genesis")
+	if stats.Transactions != 0 || stats.Total != 0 {
+		t.Fatalf("genesis: unexpected stats -- got %d txns, total %d",
+			stats.Transactions, stats.Total)
+	}
+
+	// None of the outputs of the premine block are spent, so the total
+	// amount is the sum of all of its outputs.
+	g.CreatePremineBlock("bp", 0)
+	processBlock("bp")
+	var premineTotal int64
+	for _, tx := range g.BlockByName("bp").Transactions {
+		for _, txOut := range tx.TxOut {
+			premineTotal += txOut.Value
+		}
+	}
+	if stats := expectStats("premine"); stats.Total != premineTotal {
+		t.Fatalf("premine: unexpected total -- got %d, want %d",
+			stats.Total, premineTotal)
+	}
+
+	// Mature some coinbase outputs and then spend one of them along with
+	// purchasing tickets with others.
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		blockName := fmt.Sprintf("bm%d", i)
+		g.NextBlock(blockName, nil, nil)
+		g.SaveTipCoinbaseOuts()
+		processBlock(blockName)
+	}
+	matured := expectStats("matured")
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("b1", &outs[0], outs[1:])
+	processBlock("b1")
+	spent := expectStats("spent")
+	if spent.SerializedHash == matured.SerializedHash {
+		t.Fatal("serialized hash did not change after spending outputs")
+	}
+}
@@ -13,11 +13,11 @@ import (
 	"time"
 
 	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
-	equihash "github.com/CommerciumBlockchain/cmmd/cequihash"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
 	"github.com/CommerciumBlockchain/cmmd/database"
 	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/equihash"
 	"github.com/CommerciumBlockchain/cmmd/txscript"
 	"github.com/CommerciumBlockchain/cmmd/wire"
 )
@@ -348,6 +348,7 @@ func CheckProofOfStake(block *cmmutil.Block, posLimit int64) error {
 // The flags modify the behavior of this function as follows:
 //  - BFNoPoWCheck: The check to ensure the block hash is less than the target
 //    difficulty is not performed.
+//  - BFNoEquihashCheck: The Equihash solution is not validated.
 func checkProofOfWork(header *wire.BlockHeader, chainParams *chaincfg.Params, flags BehaviorFlags) error {
 	// The target difficulty must be larger than zero.
 	target := CompactToBig(header.Bits)
@@ -376,10 +377,11 @@ func checkProofOfWork(header *wire.BlockHeader, chainParams *chaincfg.Params, fl
 			return ruleError(ErrHighHash, str)
 		}
 
-		err := ValidateEquihashSolution(header, chainParams)
-
-		if err != nil {
-			return err
+		if flags&BFNoEquihashCheck != BFNoEquihashCheck {
+			err := ValidateEquihashSolution(header, chainParams)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -394,7 +396,7 @@ func ValidateEquihashSolution(header *wire.BlockHeader, chainParams *chaincfg.Pa
 		return ruleError(ErrInvalidEquihashSolution, "unable to deserialize required header fields")
 	}
 
-	result := equihash.ValidateEquihash(chainParams.N, chainParams.K, headerBytes,
+	result := equihash.Validate(chainParams.N, chainParams.K, headerBytes,
 		int64(header.Nonce), header.EquihashSolution[:])
 
 	if !result {
@@ -925,14 +927,14 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	// blocks which build off of old blocks that are likely at a much
 	// easier difficulty and therefore could be used to waste cache and
 	// disk space.
-	checkpointBlock, err := b.findPreviousCheckpoint()
+	checkpointNode, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return err
 	}
-	if checkpointBlock != nil && blockHeight < checkpointBlock.Height() {
+	if checkpointNode != nil && blockHeight < checkpointNode.height {
 		str := fmt.Sprintf("block at height %d forks the main chain "+
 			"before the previous checkpoint at height %d",
-			blockHeight, checkpointBlock.Height())
+			blockHeight, checkpointNode.height)
 		return ruleError(ErrForkTooOld, str)
 	}
 
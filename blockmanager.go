@@ -7,6 +7,7 @@
 package main
 
 import (
+	"bufio"
 	"container/list"
 	"encoding/binary"
 	"fmt"
@@ -28,10 +29,30 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
+	// blockDownloadWindow is the maximum number of blocks after the current
+	// best chain that are downloaded in parallel in headers-first mode.  It
+	// must be less than the maximum number of orphan blocks kept by the
+	// chain since blocks which arrive out of order are orphans until their
+	// parents are processed.
+	blockDownloadWindow = 256
+
+	// maxInFlightBlocksPerPeer is the maximum number of blocks requested
+	// from a single peer at a time in headers-first mode.
+	maxInFlightBlocksPerPeer = 16
+
+	// maxHeadersAhead is the number of headers whose blocks have not been
+	// processed yet after which no more headers are requested in
+	// headers-first mode until the blocks catch up.
+	maxHeadersAhead = wire.MaxBlockHeadersPerMsg * 4
+
+	// blockStallTimeout is the duration after which a peer which has not
+	// delivered any of the blocks requested from it in headers-first mode
+	// is considered stalled.
+	blockStallTimeout = time.Minute
+
+	// stallSampleInterval is the interval at which the blocks in flight in
+	// headers-first mode are checked for stalled peers.
+	stallSampleInterval = 10 * time.Second
 
 	// blockDbNamePrefix is the prefix for the block database name.  The
 	// database type is appended to this value to form the full block
@@ -93,6 +114,30 @@ type headersMsg struct {
 	peer    *serverPeer
 }
 
+// cmpctBlockMsg packages a Commercium cmpctblock message and the peer it came
+// from together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *serverPeer
+}
+
+// blockTxnMsg packages a Commercium blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *serverPeer
+}
+
+// partialBlock houses a block which is being rebuilt from a cmpctblock message
+// along with the indexes of the transactions of both trees that were missing
+// from the memory pool and have been requested from the peer.
+type partialBlock struct {
+	hash     chainhash.Hash
+	block    *wire.MsgBlock
+	missing  []uint32
+	sMissing []uint32
+}
+
 // donePeerMsg signifies a newly disconnected peer to the block handler.
 type donePeerMsg struct {
 	peer *serverPeer
@@ -193,6 +238,32 @@ type forceReorganizationMsg struct {
 	reply      chan forceReorganizationResponse
 }
 
+// invalidateBlockResponse is a response sent to the reply channel of an
+// invalidateBlockMsg.
+type invalidateBlockResponse struct {
+	err error
+}
+
+// invalidateBlockMsg is a message type to be sent across the message channel
+// for requesting that a block and its descendants be marked invalid.
+type invalidateBlockMsg struct {
+	hash  *chainhash.Hash
+	reply chan invalidateBlockResponse
+}
+
+// reconsiderBlockResponse is a response sent to the reply channel of a
+// reconsiderBlockMsg.
+type reconsiderBlockResponse struct {
+	err error
+}
+
+// reconsiderBlockMsg is a message type to be sent across the message channel
+// for requesting that the invalid status of a block be removed.
+type reconsiderBlockMsg struct {
+	hash  *chainhash.Hash
+	reply chan reconsiderBlockResponse
+}
+
 // processBlockResponse is a response sent to the reply channel of a
 // processBlockMsg.
 type processBlockResponse struct {
@@ -292,13 +363,24 @@ type setParentTemplateMsg struct {
 type setParentTemplateResponse struct {
 }
 
-// headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
+// headerNode is used as a node in the list of headers whose blocks are being
+// downloaded in headers-first mode.
 type headerNode struct {
 	height int64
 	hash   *chainhash.Hash
 }
 
+// inFlightBlock houses a block of the header chain which was requested in
+// headers-first mode along with its height, the peer it was requested from,
+// and the time after which the peer is considered stalled unless it delivers
+// one of the blocks requested from it.  The peer is nil once the block has been
+// received.
+type inFlightBlock struct {
+	peer     *serverPeer
+	height   int64
+	deadline time.Time
+}
+
 // chainState tracks the state of the best chain as blocks are inserted.  This
 // is done because blockchain is currently not safe for concurrent access and the
 // block manager is typically quite busy processing block and inventory.
@@ -399,11 +481,27 @@ type blockManager struct {
 	miningAddr          *cmmutil.Address
 	miningAddrMutex     sync.RWMutex
 
-	// The following fields are used for headers-first mode.
-	headersFirstMode bool
-	headerList       *list.List
-	startHeader      *list.Element
-	nextCheckpoint   *chaincfg.Checkpoint
+	// The following fields are used for headers-first mode.  The header
+	// chain is synced from the sync peer ahead of the blocks, which are
+	// downloaded in parallel from all of the candidate peers.
+	headersFirstMode  bool
+	headerChain       *blockchain.HeaderChain
+	headerList        *list.List
+	requestingHeaders bool
+	haveAllHeaders    bool
+	inFlightBlocks    map[chainhash.Hash]*inFlightBlock
+	nextCheckpoint    *chaincfg.Checkpoint
+	fastAddHeight     int64
+	candidatePeers    *list.List
+
+	// syncHeight is the height of the best chain advertised by the peer
+	// which was most recently selected for syncing and headersHeight is
+	// the height of the tip of the validated header chain.  They are
+	// protected by syncHeightMtx since they are also read from other
+	// goroutines.
+	syncHeightMtx sync.Mutex
+	syncHeight    int64
+	headersHeight int64
 
 	// lotteryDataBroadcastMutex is a mutex protecting the map
 	// that checks if block lottery data has been broadcasted
@@ -419,18 +517,71 @@ type blockManager struct {
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
 // syncing from a new peer.
-func (b *blockManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int64) {
+func (b *blockManager) resetHeaderState(newestHeight int64) {
 	b.headersFirstMode = false
+	b.headerChain = nil
 	b.headerList.Init()
-	b.startHeader = nil
+	b.requestingHeaders = false
+	b.haveAllHeaders = false
+
+	// Forget about the blocks still in flight so they don't count against
+	// the limits of the peers they were requested from.
+	for hash, inFlight := range b.inFlightBlocks {
+		if inFlight.peer != nil {
+			delete(b.requestedBlocks, hash)
+			delete(inFlight.peer.requestedBlocks, hash)
+		}
+	}
+	b.inFlightBlocks = make(map[chainhash.Hash]*inFlightBlock)
+	b.nextCheckpoint = b.findNextHeaderCheckpoint(newestHeight)
+	b.fastAddHeight = newestHeight
+}
+
+// refreshChainState queries the chain for the current best block and the
+// stake data associated with it in order to update the chain state associated
+// with the block manager after the chain was reorganized outside of the normal
+// block processing, such as when forcing a head reorganization or manually
+// invalidating a block.  It also updates websocket clients and prunes the
+// mempool according to the new stake difficulty.
+func (b *blockManager) refreshChainState() {
+	// Query the db for the latest best block since the chain might have
+	// been reorganized.
+	best := b.chain.BestSnapshot()
 
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if b.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		b.headerList.PushBack(&node)
+	// Fetch the required lottery data.
+	winningTickets, poolSize, finalState, err :=
+		b.chain.LotteryDataForBlock(&best.Hash)
+
+	// Update registered websocket clients on the current stake difficulty.
+	nextStakeDiff, errSDiff := b.chain.CalcNextRequiredStakeDifficulty()
+	if err != nil {
+		bmgrLog.Warnf("Failed to get next stake difficulty "+
+			"calculation: %v", err)
+	}
+	r := b.server.rpcServer
+	if r != nil && errSDiff == nil {
+		r.ntfnMgr.NotifyStakeDifficulty(
+			&StakeDifficultyNtfnData{
+				best.Hash,
+				best.Height,
+				nextStakeDiff,
+			})
+		b.server.txMemPool.PruneStakeTx(nextStakeDiff, best.Height)
+		b.server.txMemPool.PruneExpiredTx(best.Height)
+	}
+
+	missedTickets, err := b.chain.MissedTickets()
+	if err != nil {
+		bmgrLog.Warnf("Failed to get missed tickets: %v", err)
 	}
+
+	// The blockchain should be updated, so fetch the latest snapshot.
+	best = b.chain.BestSnapshot()
+	curPrevHash := b.chain.BestPrevHash()
+
+	b.updateChainState(&best.Hash, best.Height, finalState,
+		uint32(poolSize), nextStakeDiff, winningTickets, missedTickets,
+		curPrevHash)
 }
 
 // updateChainState updates the chain state associated with the block manager.
@@ -543,45 +694,37 @@ func (b *blockManager) startSync(peers *list.List) {
 		bmgrLog.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
+		b.syncHeightMtx.Lock()
+		b.syncHeight = bestPeer.LastBlock()
+		b.syncHeightMtx.Unlock()
+
+		// Use block headers to learn about which blocks comprise the
+		// chain all the way to the tip of the peer.  This is possible
+		// since each header contains the hash of the previous header
+		// and a merkle root.  Therefore if we validate all of the
+		// received headers link together properly and have valid proof
+		// of work and difficulty, we can be sure the hashes for the
+		// blocks are accurate and download them in parallel from all of
+		// the candidate peers.  Further, once the full blocks are
+		// downloaded, the merkle root is computed and compared against
+		// the value in the header which proves the full block hasn't
+		// been tampered with.
 		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
-		// downloads when in regression test mode.
-		if b.nextCheckpoint != nil &&
-			best.Height < b.nextCheckpoint.Height &&
-			!cfg.DisableCheckpoints {
-
-			err := bestPeer.PushGetHeadersMsg(locator, b.nextCheckpoint.Hash)
-			if err != nil {
-				bmgrLog.Errorf("Failed to push getheadermsg for the "+
-					"latest blocks: %v", err)
-				return
-			}
-			b.headersFirstMode = true
-			bmgrLog.Infof("Downloading headers for blocks %d to "+
-				"%d from peer %s", best.Height+1,
-				b.nextCheckpoint.Height, bestPeer.Addr())
-		} else {
-			err := bestPeer.PushGetBlocksMsg(locator, &zeroHash)
-			if err != nil {
-				bmgrLog.Errorf("Failed to push getblocksmsg for the "+
-					"latest blocks: %v", err)
-				return
-			}
+		// The blocks up to the latest checkpoint that matches the
+		// downloaded headers are eligible for less validation while the
+		// remaining ones are fully validated.
+		b.resetHeaderState(best.Height)
+		err = bestPeer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			bmgrLog.Errorf("Failed to push getheadermsg for the "+
+				"latest blocks: %v", err)
+			return
 		}
+		b.headersFirstMode = true
+		b.headerChain = b.chain.NewHeaderChain()
+		b.requestingHeaders = true
+		bmgrLog.Infof("Downloading headers for blocks after height %d "+
+			"from peer %s", best.Height, bestPeer.Addr())
 		b.syncPeer = bestPeer
 	} else {
 		bmgrLog.Warnf("No sync peer candidates available")
@@ -633,8 +776,13 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, sp *serverPeer) {
 	// Add the peer as a candidate to sync from.
 	peers.PushBack(sp)
 
-	// Start syncing by choosing the best candidate if needed.
+	// Start syncing by choosing the best candidate if needed.  Otherwise,
+	// the peer is able to help downloading the blocks when syncing in
+	// headers-first mode.
 	b.startSync(peers)
+	if b.headersFirstMode {
+		b.fetchHeaderBlocks()
+	}
 
 	// Grab the mining state from this peer after we're synced.
 	if !cfg.NoMiningStateSync {
@@ -671,16 +819,24 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, sp *serverPeer) {
 		delete(b.requestedBlocks, k)
 	}
 
+	// Release the blocks requested from the peer in headers-first mode so
+	// they are requested from the other peers.
+	released := b.releaseInFlightBlocks(sp)
+
 	// Attempt to find a new peer to sync from if the quitting peer is the
 	// sync peer.  Also, reset the headers-first state if in headers-first
-	// mode so
+	// mode so the headers are downloaded from the new sync peer.
 	if b.syncPeer != nil && b.syncPeer == sp {
 		b.syncPeer = nil
 		if b.headersFirstMode {
 			best := b.chain.BestSnapshot()
-			b.resetHeaderState(&best.Hash, best.Height)
+			b.resetHeaderState(best.Height)
 		}
 		b.startSync(peers)
+		return
+	}
+	if released && b.headersFirstMode {
+		b.fetchHeaderBlocks()
 	}
 }
 
@@ -744,6 +900,12 @@ func (b *blockManager) handleTxMsg(tmsg *txMsg) {
 		return
 	}
 
+	// Remember when the peer last sent a novel transaction so it is
+	// protected from eviction.
+	if len(acceptedTxs) > 0 {
+		tmsg.peer.setLastTxTime(time.Now())
+	}
+
 	b.server.AnnounceNewTransactions(acceptedTxs)
 }
 
@@ -949,6 +1111,186 @@ func (b *blockManager) checkBlockForHiddenVotes(block *cmmutil.Block) {
 	template.Block.Header.Size = uint32(template.Block.SerializeSize())
 }
 
+// rebuildTxTree returns the transactions of a single transaction tree of a
+// compact block using the prefilled transactions and the transactions of the
+// passed pool that match the short transaction IDs, along with the indexes of
+// the transactions that could not be found.
+func rebuildTxTree(shortIDs []uint64, prefilled []wire.PrefilledTx, pool map[uint64]*wire.MsgTx) ([]*wire.MsgTx, []uint32) {
+	txns := make([]*wire.MsgTx, len(shortIDs)+len(prefilled))
+	for _, ptx := range prefilled {
+		txns[ptx.Index] = ptx.Tx
+	}
+
+	// The short transaction IDs fill the remaining indexes in order.
+	var missing []uint32
+	var next int
+	for i := range txns {
+		if txns[i] != nil {
+			continue
+		}
+		tx := pool[shortIDs[next]]
+		next++
+		if tx == nil {
+			missing = append(missing, uint32(i))
+			continue
+		}
+		txns[i] = tx
+	}
+	return txns, missing
+}
+
+// newPartialBlock rebuilds the block announced by the passed cmpctblock message
+// from the passed memory pool transactions.  The indexes of the transactions
+// of both trees that could not be found are recorded in the returned partial
+// block so they can be requested from the peer.
+func newPartialBlock(msg *wire.MsgCmpctBlock, txDescs []*mempool.TxDesc) *partialBlock {
+	// Map the short transaction IDs of the transactions in the memory pool
+	// to the transactions.  IDs that collide are mapped to nil so the
+	// associated transactions are requested from the peer instead.
+	key := msg.ShortIDKey()
+	pool := make(map[uint64]*wire.MsgTx, len(txDescs))
+	for _, txDesc := range txDescs {
+		id := wire.ShortTxID(&key, txDesc.Tx.Hash())
+		if _, exists := pool[id]; exists {
+			pool[id] = nil
+			continue
+		}
+		pool[id] = txDesc.Tx.MsgTx()
+	}
+
+	pb := &partialBlock{
+		hash:  msg.BlockHash(),
+		block: wire.NewMsgBlock(&msg.Header),
+	}
+	pb.block.Transactions, pb.missing = rebuildTxTree(msg.ShortIDs,
+		msg.PrefilledTxs, pool)
+	pb.block.STransactions, pb.sMissing = rebuildTxTree(msg.SShortIDs,
+		msg.PrefilledSTxs, pool)
+	return pb
+}
+
+// complete fills in the missing transactions of the partial block with the
+// transactions of the passed blocktxn message.  An error is returned when the
+// message does not contain exactly the requested transactions.
+func (pb *partialBlock) complete(msg *wire.MsgBlockTxn) error {
+	if len(msg.Transactions) != len(pb.missing) ||
+		len(msg.STransactions) != len(pb.sMissing) {
+
+		return fmt.Errorf("blocktxn has %d regular and %d stake "+
+			"transactions instead of the %d and %d requested",
+			len(msg.Transactions), len(msg.STransactions),
+			len(pb.missing), len(pb.sMissing))
+	}
+	for i, index := range pb.missing {
+		pb.block.Transactions[index] = msg.Transactions[i]
+	}
+	for i, index := range pb.sMissing {
+		pb.block.STransactions[index] = msg.STransactions[i]
+	}
+	pb.missing, pb.sMissing = nil, nil
+	return nil
+}
+
+// merkleRootsMatch returns whether the merkle roots of both transaction trees
+// of the passed block match the ones committed to by its header.
+func merkleRootsMatch(block *cmmutil.Block) bool {
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions())
+	sMerkles := blockchain.BuildMerkleTreeStore(block.STransactions())
+	header := &block.MsgBlock().Header
+	return header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) &&
+		header.StakeRoot.IsEqual(sMerkles[len(sMerkles)-1])
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The block is
+// rebuilt from the transactions in the memory pool and processed as if the
+// full block had been received when all of them are available.  Otherwise,
+// the missing transactions are requested from the peer with a getblocktxn
+// message and the partially rebuilt block is kept until they arrive.
+func (b *blockManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	sp := cmsg.peer
+	msg := cmsg.cmpctBlock
+	blockHash := msg.BlockHash()
+
+	// Compact blocks are only useful for relaying new blocks, so ignore
+	// them while syncing.  The block will be downloaded in full instead.
+	if b.headersFirstMode || !b.current() {
+		bmgrLog.Debugf("Ignoring cmpctblock %v from %s while syncing",
+			blockHash, sp)
+		return
+	}
+
+	// Ignore blocks which are already known.
+	haveBlock, err := b.chain.HaveBlock(&blockHash)
+	if err != nil {
+		bmgrLog.Warnf("Unexpected failure when checking for existing "+
+			"block %v: %v", blockHash, err)
+		return
+	}
+	if haveBlock {
+		return
+	}
+
+	pb := newPartialBlock(msg, b.server.txMemPool.TxDescs())
+	if len(pb.missing) == 0 && len(pb.sMissing) == 0 {
+		sp.partialBlock = nil
+		b.handleRebuiltBlock(sp, pb.block)
+		return
+	}
+
+	bmgrLog.Debugf("Requesting %d regular and %d stake transactions of "+
+		"cmpctblock %v from %s", len(pb.missing), len(pb.sMissing),
+		blockHash, sp)
+	sp.partialBlock = pb
+	sp.QueueMessage(wire.NewMsgGetBlockTxn(&blockHash, pb.missing,
+		pb.sMissing), nil)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers.  The transactions
+// are used to complete the block which is being rebuilt from the cmpctblock
+// message previously received from the peer.
+func (b *blockManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	sp := bmsg.peer
+	msg := bmsg.blockTxn
+	pb := sp.partialBlock
+	if pb == nil || pb.hash != msg.BlockHash {
+		bmgrLog.Debugf("Ignoring unrequested blocktxn for block %v "+
+			"from %s", msg.BlockHash, sp)
+		return
+	}
+	sp.partialBlock = nil
+
+	if err := pb.complete(msg); err != nil {
+		bmgrLog.Warnf("Got invalid blocktxn for block %v from %s: %v "+
+			"-- disconnecting", msg.BlockHash, sp, err)
+		sp.Disconnect()
+		return
+	}
+	b.handleRebuiltBlock(sp, pb.block)
+}
+
+// handleRebuiltBlock processes a block which was rebuilt from a compact block
+// received from the passed peer as if the full block had been requested from
+// it.  When the merkle roots of the rebuilt block do not match its header, due
+// to a short transaction ID collision or a malleated transaction in the memory
+// pool, the full block is requested instead.
+func (b *blockManager) handleRebuiltBlock(sp *serverPeer, msgBlock *wire.MsgBlock) {
+	block := cmmutil.NewBlock(msgBlock)
+	blockHash := block.Hash()
+	b.requestedBlocks[*blockHash] = struct{}{}
+	sp.requestedBlocks[*blockHash] = struct{}{}
+
+	if !merkleRootsMatch(block) {
+		bmgrLog.Debugf("Rebuilt block %v from %s does not match its "+
+			"merkle roots -- requesting full block", blockHash, sp)
+		gdmsg := wire.NewMsgGetData()
+		gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, blockHash))
+		sp.QueueMessage(gdmsg, nil)
+		return
+	}
+
+	b.handleBlockMsg(&blockMsg{block: block, peer: sp})
+}
+
 // handleBlockMsg handles block messages from all peers.
 func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	// If we didn't ask for this block then the peer is misbehaving.
@@ -976,28 +1318,21 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
+	// When in headers-first mode, blocks of the header chain don't need
+	// their Equihash solutions validated again since the headers have
+	// already been verified to link together and to have valid proof of
+	// work.  The blocks up to the latest verified checkpoint are also
+	// eligible for less validation.  Since the peer delivered one of the
+	// blocks requested from it, it is not stalled.
 	behaviorFlags := blockchain.BFNone
-	if b.headersFirstMode {
-		firstNodeEl := b.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				behaviorFlags |= blockchain.BFFastAdd
-				if firstNode.hash.IsEqual(b.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					b.headerList.Remove(firstNodeEl)
-				}
-			}
+	inFlight, isHeaderBlock := b.inFlightBlocks[*blockHash]
+	if isHeaderBlock {
+		behaviorFlags |= blockchain.BFNoEquihashCheck
+		if inFlight.height <= b.fastAddHeight {
+			behaviorFlags |= blockchain.BFFastAdd
 		}
+		inFlight.peer = nil
+		b.extendBlockDeadlines(bmsg.peer)
 	}
 
 	// Remove block from request maps. Either chain will know about it and
@@ -1032,6 +1367,35 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		code, reason := mempool.ErrToRejectErr(err)
 		bmsg.peer.PushRejectMsg(wire.CmdBlock, code, reason,
 			blockHash, false)
+
+		// A block of the header chain which does not match its header
+		// was tampered with by the peer which delivered it, so that peer
+		// is banned and the block is requested again from another peer.
+		// Any other rule violation means the header chain of the sync
+		// peer leads to an invalid block, so sync from another peer
+		// instead.
+		if isHeaderBlock {
+			delete(b.inFlightBlocks, *blockHash)
+			if !merkleRootsMatch(bmsg.block) {
+				bmgrLog.Warnf("Block %v from peer %s does not "+
+					"match its header -- disconnecting",
+					blockHash, bmsg.peer)
+				bmsg.peer.addBanScore(100, 0, "block does not "+
+					"match its header")
+				bmsg.peer.Disconnect()
+				b.fetchHeaderBlocks()
+				return
+			}
+			rerr, ok := err.(blockchain.RuleError)
+			if ok && rerr.ErrorCode != blockchain.ErrDuplicateBlock &&
+				b.syncPeer != nil {
+
+				bmgrLog.Warnf("Header chain of sync peer %s "+
+					"leads to invalid block %v -- "+
+					"disconnecting", b.syncPeer, blockHash)
+				b.syncPeer.Disconnect()
+			}
+		}
 		return
 	}
 
@@ -1059,22 +1423,29 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		heightUpdate = int64(cbHeight)
 		blkHashUpdate = blockHash
 
-		orphanRoot := b.chain.GetOrphanRoot(blockHash)
-		locator, err := b.chain.LatestBlockLocator()
-		if err != nil {
-			bmgrLog.Warnf("Failed to get block locator for the "+
-				"latest block: %v", err)
-		} else {
-			err = bmsg.peer.PushGetBlocksMsg(locator, orphanRoot)
+		// Blocks of the header chain are downloaded out of order, so
+		// their parents are already being downloaded as well.
+		if !isHeaderBlock {
+			orphanRoot := b.chain.GetOrphanRoot(blockHash)
+			locator, err := b.chain.LatestBlockLocator()
 			if err != nil {
-				bmgrLog.Warnf("Failed to push getblocksmsg for the "+
-					"latest block: %v", err)
+				bmgrLog.Warnf("Failed to get block locator for "+
+					"the latest block: %v", err)
+			} else {
+				err = bmsg.peer.PushGetBlocksMsg(locator,
+					orphanRoot)
+				if err != nil {
+					bmgrLog.Warnf("Failed to push getblocksmsg "+
+						"for the latest block: %v", err)
+				}
 			}
 		}
 	} else {
 		// When the block is not an orphan, log information about it and
-		// update the chain state.
+		// update the chain state.  The peer is protected from eviction
+		// for sending a novel block.
 		b.progressLogger.logBlockHeight(bmsg.block)
+		bmsg.peer.setLastBlockTime(time.Now())
 		r := b.server.rpcServer
 
 		// Determine if this block is recent enough that we need to calculate
@@ -1205,105 +1576,219 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// Nothing more to do if we aren't in headers-first mode.
-	if !b.headersFirstMode {
-		return
+	// Request more blocks of the header chain now that this one has been
+	// processed when in headers-first mode.
+	if b.headersFirstMode {
+		b.fetchHeaderBlocks()
 	}
+}
 
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if b.startHeader != nil &&
-			len(bmsg.peer.requestedBlocks) < minInFlightBlocks {
-			b.fetchHeaderBlocks()
+// extendBlockDeadlines extends the time after which the passed peer is
+// considered stalled for all of the blocks requested from it in headers-first
+// mode.  It is called whenever the peer delivers one of those blocks.
+func (b *blockManager) extendBlockDeadlines(sp *serverPeer) {
+	deadline := time.Now().Add(blockStallTimeout)
+	for _, inFlight := range b.inFlightBlocks {
+		if inFlight.peer == sp {
+			inFlight.deadline = deadline
 		}
-		return
 	}
+}
 
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := b.nextCheckpoint.Height
-	prevHash := b.nextCheckpoint.Hash
-	b.nextCheckpoint = b.findNextHeaderCheckpoint(prevHeight)
-	if b.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := bmsg.peer.PushGetHeadersMsg(locator, b.nextCheckpoint.Hash)
-		if err != nil {
-			bmgrLog.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", bmsg.peer.Addr(), err)
-			return
+// releaseInFlightBlocks removes the blocks requested from the passed peer in
+// headers-first mode from the blocks in flight so they are requested from other
+// peers.  It returns whether or not there were any.
+func (b *blockManager) releaseInFlightBlocks(sp *serverPeer) bool {
+	var released bool
+	for hash, inFlight := range b.inFlightBlocks {
+		if inFlight.peer == sp {
+			delete(b.inFlightBlocks, hash)
+			delete(b.requestedBlocks, hash)
+			delete(sp.requestedBlocks, hash)
+			released = true
 		}
-		bmgrLog.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, b.nextCheckpoint.Height,
-			b.syncPeer.Addr())
+	}
+	return released
+}
+
+// blockDownloadPeer returns the candidate peer with the fewest blocks in flight
+// which advertised a chain that includes the passed height and is able to
+// download another block in headers-first mode.  It returns nil when there is
+// no such peer.
+func (b *blockManager) blockDownloadPeer(height int64) *serverPeer {
+	var bestPeer *serverPeer
+	for e := b.candidatePeers.Front(); e != nil; e = e.Next() {
+		sp := e.Value.(*serverPeer)
+		numInFlight := len(sp.requestedBlocks)
+		if !sp.Connected() || sp.LastBlock() < height ||
+			numInFlight >= maxInFlightBlocksPerPeer {
+			continue
+		}
+		if bestPeer == nil || numInFlight < len(bestPeer.requestedBlocks) {
+			bestPeer = sp
+		}
+	}
+	return bestPeer
+}
+
+// handleStallSample checks the blocks in flight in headers-first mode for peers
+// which have not delivered any of the blocks requested from them in time.  The
+// stalled peers are disconnected and their blocks are requested from other
+// peers.
+func (b *blockManager) handleStallSample() {
+	if !b.headersFirstMode {
 		return
 	}
 
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	b.headersFirstMode = false
-	b.headerList.Init()
-	bmgrLog.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = bmsg.peer.PushGetBlocksMsg(locator, &zeroHash)
-	if err != nil {
-		bmgrLog.Warnf("Failed to send getblocks message to peer %s: %v",
-			bmsg.peer.Addr(), err)
+	now := time.Now()
+	stalledPeers := make(map[*serverPeer]struct{})
+	for _, inFlight := range b.inFlightBlocks {
+		if inFlight.peer != nil && now.After(inFlight.deadline) {
+			stalledPeers[inFlight.peer] = struct{}{}
+		}
+	}
+	if len(stalledPeers) == 0 {
 		return
 	}
+
+	for sp := range stalledPeers {
+		bmgrLog.Infof("Peer %s stalled downloading blocks -- "+
+			"disconnecting and requesting its blocks from other "+
+			"peers", sp)
+		b.releaseInFlightBlocks(sp)
+		sp.Disconnect()
+	}
+	b.fetchHeaderBlocks()
 }
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
+// fetchHeaderBlocks requests the blocks of the header chain which are within
+// the download window after the current best chain and have not been requested
+// yet in headers-first mode.  The requests are spread over all of the candidate
+// peers.  It also requests more headers from the sync peer when the headers
+// whose blocks have not been processed run low and switches to normal mode once
+// the blocks of all of the headers have been processed.
 func (b *blockManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if b.startHeader == nil {
-		bmgrLog.Warnf("fetchHeaderBlocks called with no start header")
-		return
+	// Remove the headers for the blocks that have been processed from the
+	// front of the list.  A block which was received but is not known has
+	// been evicted from the orphan pool, so request it again.
+	for e := b.headerList.Front(); e != nil; e = b.headerList.Front() {
+		node := e.Value.(*headerNode)
+		haveBlock, err := b.chain.HaveBlock(node.hash)
+		if err != nil {
+			bmgrLog.Warnf("Unexpected failure when checking for "+
+				"existing block %v: %v", node.hash, err)
+			break
+		}
+		if !haveBlock || b.chain.IsKnownOrphan(node.hash) {
+			inFlight, exists := b.inFlightBlocks[*node.hash]
+			if exists && inFlight.peer == nil {
+				delete(b.inFlightBlocks, *node.hash)
+			}
+			break
+		}
+		delete(b.inFlightBlocks, *node.hash)
+		b.headerList.Remove(e)
 	}
 
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(b.headerList.Len()))
-	numRequested := 0
-	for e := b.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			bmgrLog.Warn("Header list node type is not a headerNode")
+	// Build up getdata requests for the blocks in the download window which
+	// are not in flight for the peers able to download them.
+	best := b.chain.BestSnapshot()
+	maxHeight := best.Height + blockDownloadWindow
+	deadline := time.Now().Add(blockStallTimeout)
+	requests := make(map[*serverPeer]*wire.MsgGetData)
+	for e := b.headerList.Front(); e != nil; e = e.Next() {
+		node := e.Value.(*headerNode)
+		if node.height > maxHeight {
+			break
+		}
+		if _, exists := b.inFlightBlocks[*node.hash]; exists {
 			continue
 		}
 
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
-		haveInv, err := b.haveInventory(iv)
+		// Blocks that are already known, such as those of a side
+		// chain, don't need to be downloaded.
+		haveBlock, err := b.chain.HaveBlock(node.hash)
 		if err != nil {
 			bmgrLog.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
-			continue
+				"existing block %v: %v", node.hash, err)
+			break
 		}
-		if !haveInv {
-			b.requestedBlocks[*node.hash] = struct{}{}
-			b.requestedEverBlocks[*node.hash] = 0
-			b.syncPeer.requestedBlocks[*node.hash] = struct{}{}
-			err = gdmsg.AddInvVect(iv)
-			if err != nil {
-				bmgrLog.Warnf("Failed to add invvect while fetching "+
-					"block headers: %v", err)
+		if haveBlock {
+			b.inFlightBlocks[*node.hash] = &inFlightBlock{
+				height: node.height,
 			}
-			numRequested++
+			continue
 		}
-		b.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
+
+		// Peers which do not have a block also don't have any of the
+		// following ones, so stop once there is no peer to download it
+		// from.
+		sp := b.blockDownloadPeer(node.height)
+		if sp == nil {
 			break
 		}
+		b.inFlightBlocks[*node.hash] = &inFlightBlock{
+			peer:     sp,
+			height:   node.height,
+			deadline: deadline,
+		}
+		b.requestedBlocks[*node.hash] = struct{}{}
+		b.requestedEverBlocks[*node.hash] = 0
+		sp.requestedBlocks[*node.hash] = struct{}{}
+
+		gdmsg, exists := requests[sp]
+		if !exists {
+			gdmsg = wire.NewMsgGetData()
+			requests[sp] = gdmsg
+		}
+		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
+		if err := gdmsg.AddInvVect(iv); err != nil {
+			bmgrLog.Warnf("Failed to add invvect while fetching "+
+				"block headers: %v", err)
+		}
 	}
-	if len(gdmsg.InvList) > 0 {
-		b.syncPeer.QueueMessage(gdmsg, nil)
+	for sp, gdmsg := range requests {
+		sp.QueueMessage(gdmsg, nil)
+	}
+
+	// Request the next batch of headers from the sync peer when it has more
+	// and the blocks are catching up.
+	if !b.haveAllHeaders && !b.requestingHeaders && b.syncPeer != nil &&
+		b.headerList.Len() < maxHeadersAhead {
+
+		// Continue from the best block when the header chain is empty
+		// since there is no header tip to locate from in that case.
+		tipHash, _ := b.headerChain.Tip()
+		if tipHash == nil {
+			tipHash = &best.Hash
+		}
+		locator := blockchain.BlockLocator([]*chainhash.Hash{tipHash})
+		err := b.syncPeer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			bmgrLog.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", b.syncPeer.Addr(), err)
+			return
+		}
+		b.requestingHeaders = true
+	}
+
+	// Switch to normal mode once the blocks of all of the headers have been
+	// processed.  Request any blocks that were announced by the sync peer
+	// in the mean time since the announcements are ignored in headers-first
+	// mode.
+	if b.haveAllHeaders && b.headerList.Len() == 0 {
+		b.resetHeaderState(best.Height)
+		bmgrLog.Infof("Downloaded the blocks of all headers -- switching " +
+			"to normal mode")
+		if b.syncPeer == nil {
+			return
+		}
+		locator := blockchain.BlockLocator([]*chainhash.Hash{&best.Hash})
+		err := b.syncPeer.PushGetBlocksMsg(locator, &zeroHash)
+		if err != nil {
+			bmgrLog.Warnf("Failed to send getblocks message to peer "+
+				"%s: %v", b.syncPeer.Addr(), err)
+		}
 	}
 }
 
@@ -1312,99 +1797,81 @@ func (b *blockManager) handleHeadersMsg(hmsg *headersMsg) {
 	// The remote peer is misbehaving if we didn't request headers.
 	msg := hmsg.headers
 	numHeaders := len(msg.Headers)
-	if !b.headersFirstMode {
+	if !b.headersFirstMode || !b.requestingHeaders ||
+		hmsg.peer != b.syncPeer {
+
 		bmgrLog.Warnf("Got %d unrequested headers from %s -- "+
 			"disconnecting", numHeaders, hmsg.peer.Addr())
 		hmsg.peer.Disconnect()
 		return
 	}
+	b.requestingHeaders = false
 
-	// Nothing to do for an empty headers message.
-	if numHeaders == 0 {
+	// Add the headers to the header chain.  This validates the proof of
+	// work of the entire batch of headers, including the Equihash
+	// solutions, concurrently before ensuring each one connects to the
+	// previous one, commits to the expected difficulty, and matches the
+	// checkpoints.  The solutions are not validated again when the
+	// associated blocks arrive.
+	failedIdx, err := b.headerChain.ConnectHeaders(msg.Headers,
+		blockchain.BFNone)
+	if err != nil {
+		failedHeader := msg.Headers[failedIdx]
+		bmgrLog.Warnf("Received invalid block header %v (%d of %d) "+
+			"from peer %s: %v -- disconnecting",
+			failedHeader.BlockHash(), failedIdx+1, numHeaders,
+			hmsg.peer.Addr(), err)
+		if rerr, ok := err.(blockchain.RuleError); ok {
+			switch rerr.ErrorCode {
+			case blockchain.ErrHighHash,
+				blockchain.ErrInvalidEquihashSolution,
+				blockchain.ErrUnexpectedDifficulty:
+
+				hmsg.peer.addBanScore(100, 0, "invalid header "+
+					"proof of work")
+			}
+		}
+		hmsg.peer.Disconnect()
 		return
 	}
-
-	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
-	var finalHash *chainhash.Hash
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
-
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := b.headerList.Back()
-		if prevNodeEl == nil {
-			bmgrLog.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
-			hmsg.peer.Disconnect()
-			return
+		node := headerNode{
+			height: int64(blockHeader.Height),
+			hash:   &blockHash,
 		}
+		b.headerList.PushBack(&node)
+	}
 
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := b.headerList.PushBack(&node)
-			if b.startHeader == nil {
-				b.startHeader = e
-			}
-		} else {
-			bmgrLog.Warnf("Received block header that does not "+
-				"properly connect to the chain from peer %s "+
-				"-- disconnecting", hmsg.peer.Addr())
-			hmsg.peer.Disconnect()
-			return
-		}
-
-		// Verify the header at the next checkpoint height matches.
-		if node.height == b.nextCheckpoint.Height {
-			if node.hash.IsEqual(b.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				bmgrLog.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
-				bmgrLog.Warnf("Block header at height %d/hash "+
-					"%s from peer %s does NOT match "+
-					"expected checkpoint hash of %s -- "+
-					"disconnecting", node.height,
-					node.hash, hmsg.peer.Addr(),
-					b.nextCheckpoint.Hash)
-				hmsg.peer.Disconnect()
-				return
-			}
-			break
+	// The peer has no more headers when it sent fewer than the maximum
+	// allowed.
+	b.haveAllHeaders = numHeaders < wire.MaxBlockHeadersPerMsg
+	if numHeaders > 0 {
+		tipHash, tipHeight := b.headerChain.Tip()
+		b.syncHeightMtx.Lock()
+		if tipHeight > b.headersHeight {
+			b.headersHeight = tipHeight
 		}
+		b.syncHeightMtx.Unlock()
+		bmgrLog.Infof("Received %d block headers up to height %d "+
+			"(hash %s) from peer %s", numHeaders, tipHeight, tipHash,
+			hmsg.peer.Addr())
 	}
 
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		b.headerList.Remove(b.headerList.Front())
-		bmgrLog.Infof("Received %v block headers: Fetching blocks",
-			b.headerList.Len())
-		b.progressLogger.SetLastLogTime(time.Now())
-		b.fetchHeaderBlocks()
-		return
+	// The blocks up to the latest checkpoint the header chain has been
+	// verified against are eligible for less validation.
+	_, tipHeight := b.headerChain.Tip()
+	for b.nextCheckpoint != nil && tipHeight >= b.nextCheckpoint.Height {
+		bmgrLog.Infof("Verified downloaded block header against "+
+			"checkpoint at height %d/hash %s",
+			b.nextCheckpoint.Height, b.nextCheckpoint.Hash)
+		b.fastAddHeight = b.nextCheckpoint.Height
+		b.nextCheckpoint = b.findNextHeaderCheckpoint(
+			b.nextCheckpoint.Height)
 	}
 
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := hmsg.peer.PushGetHeadersMsg(locator, b.nextCheckpoint.Hash)
-	if err != nil {
-		bmgrLog.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", hmsg.peer.Addr(), err)
-		return
-	}
+	b.progressLogger.SetLastLogTime(time.Now())
+	b.fetchHeaderBlocks()
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1640,7 +2107,9 @@ func (b *blockManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 // important because the block manager controls which blocks are needed and how
 // the fetching should proceed.
 func (b *blockManager) blockHandler() {
-	candidatePeers := list.New()
+	candidatePeers := b.candidatePeers
+	stallTicker := time.NewTicker(stallSampleInterval)
+	defer stallTicker.Stop()
 out:
 	for {
 		select {
@@ -1663,6 +2132,12 @@ out:
 			case *headersMsg:
 				b.handleHeadersMsg(msg)
 
+			case *cmpctBlockMsg:
+				b.handleCmpctBlockMsg(msg)
+
+			case *blockTxnMsg:
+				b.handleBlockTxnMsg(msg)
+
 			case *donePeerMsg:
 				b.handleDonePeerMsg(candidatePeers, msg.peer)
 
@@ -1698,58 +2173,30 @@ out:
 				// Reorganizing has succeeded, so we need to
 				// update the chain state.
 				if err == nil {
-					// Query the db for the latest best block since
-					// the block that was processed could be on a
-					// side chain or have caused a reorg.
-					best := b.chain.BestSnapshot()
-
-					// Fetch the required lottery data.
-					winningTickets, poolSize, finalState, err :=
-						b.chain.LotteryDataForBlock(&best.Hash)
+					b.refreshChainState()
+				}
 
-					// Update registered websocket clients on the
-					// current stake difficulty.
-					nextStakeDiff, errSDiff :=
-						b.chain.CalcNextRequiredStakeDifficulty()
-					if err != nil {
-						bmgrLog.Warnf("Failed to get next stake difficulty "+
-							"calculation: %v", err)
-					}
-					r := b.server.rpcServer
-					if r != nil && errSDiff == nil {
-						r.ntfnMgr.NotifyStakeDifficulty(
-							&StakeDifficultyNtfnData{
-								best.Hash,
-								best.Height,
-								nextStakeDiff,
-							})
-						b.server.txMemPool.PruneStakeTx(nextStakeDiff,
-							best.Height)
-						b.server.txMemPool.PruneExpiredTx(best.Height)
-					}
+				msg.reply <- forceReorganizationResponse{
+					err: err,
+				}
 
-					missedTickets, err := b.chain.MissedTickets()
-					if err != nil {
-						bmgrLog.Warnf("Failed to get missed tickets"+
-							": %v", err)
-					}
+			case invalidateBlockMsg:
+				err := b.chain.InvalidateBlock(msg.hash)
 
-					// The blockchain should be updated, so fetch the
-					// latest snapshot.
-					best = b.chain.BestSnapshot()
-					curPrevHash := b.chain.BestPrevHash()
+				// The chain might have been reorganized even when
+				// an error is returned, so always update the chain
+				// state.
+				b.refreshChainState()
 
-					b.updateChainState(&best.Hash,
-						best.Height,
-						finalState,
-						uint32(poolSize),
-						nextStakeDiff,
-						winningTickets,
-						missedTickets,
-						curPrevHash)
+				msg.reply <- invalidateBlockResponse{
+					err: err,
 				}
 
-				msg.reply <- forceReorganizationResponse{
+			case reconsiderBlockMsg:
+				err := b.chain.ReconsiderBlock(msg.hash)
+				b.refreshChainState()
+
+				msg.reply <- reconsiderBlockResponse{
 					err: err,
 				}
 
@@ -1928,6 +2375,9 @@ out:
 					"handler: %T", msg)
 			}
 
+		case <-stallTicker.C:
+			b.handleStallSample()
+
 		case <-b.quit:
 			break out
 		}
@@ -2006,7 +2456,7 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 
 		// Generate the inventory vector and relay it.
 		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
-		b.server.RelayInventory(iv, block.MsgBlock().Header)
+		b.server.RelayInventory(iv, block)
 
 	case blockchain.NTBlockConnected: // A block has been connected to the main block chain.
 		blockSlice, ok := notification.Data.([]*cmmutil.Block)
@@ -2023,6 +2473,17 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		block := blockSlice[0]
 		parentBlock := blockSlice[1]
 
+		// Abort any in-flight CPU miner solves since they are now
+		// working on a stale tip.
+		if b.server.cpuMiner != nil {
+			b.server.cpuMiner.NotifyNewTip()
+		}
+
+		// Hand stratum miners new work for the new tip.
+		if b.server.stratumServer != nil {
+			b.server.stratumServer.NotifyNewTip()
+		}
+
 		// Check and see if the regular tx tree of the previous block was
 		// invalid or not. If it wasn't, then we need to restore all the tx
 		// from this block into the mempool. They may end up being spent in
@@ -2032,6 +2493,13 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			cmmutil.BlockValid)
 
 		if !txTreeRegularValid {
+			// The disapproved transactions are removed from the
+			// transaction pool below, which must not count them as
+			// failures to be mined.
+			if b.server.feeEstimator != nil {
+				b.server.feeEstimator.RegisterDisapprovedBlock(parentBlock)
+			}
+
 			for _, tx := range parentBlock.Transactions()[1:] {
 				_, err := b.server.txMemPool.MaybeAcceptTransaction(tx, false,
 					true)
@@ -2046,6 +2514,13 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			}
 		}
 
+		// Register the regular transactions confirmed by this block
+		// with the fee estimator before they are removed from the
+		// transaction pool so they are not counted as failures.
+		if txTreeRegularValid && b.server.feeEstimator != nil {
+			b.server.feeEstimator.RegisterBlock(parentBlock)
+		}
+
 		// Remove all of the regular and stake transactions in the
 		// connected block from the transaction pool.  Also, remove any
 		// transactions which are now double spends as a result of these
@@ -2071,6 +2546,24 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.server.AnnounceNewTransactions(acceptedTxs)
 		}
 
+		// Allow the minimum fee rate raised by evicting transactions due
+		// to the pool size limit to decay again and clear the deltas of
+		// the mined transactions.
+		minedTxns := make([]*cmmutil.Tx, 0, len(block.STransactions())+
+			len(parentBlock.Transactions()))
+		minedTxns = append(minedTxns, block.STransactions()...)
+		if txTreeRegularValid {
+			minedTxns = append(minedTxns,
+				parentBlock.Transactions()[1:]...)
+		}
+		b.server.txMemPool.BlockConnected(minedTxns)
+
+		// Remove the mined transactions and those they double spend
+		// from the Dandelion++ stem pool.
+		if b.server.dandelion != nil {
+			b.server.dandelion.RemoveTransactions(minedTxns)
+		}
+
 		if r := b.server.rpcServer; r != nil {
 			// Now that this block is in the blockchain we can mark
 			// all the transactions (except the coinbase) as no
@@ -2129,6 +2622,17 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		block := blockSlice[0]
 		parentBlock := blockSlice[1]
 
+		// Abort any in-flight CPU miner solves since they are now
+		// working on a stale tip.
+		if b.server.cpuMiner != nil {
+			b.server.cpuMiner.NotifyNewTip()
+		}
+
+		// Hand stratum miners new work for the new tip.
+		if b.server.stratumServer != nil {
+			b.server.stratumServer.NotifyNewTip()
+		}
+
 		// If the parent tx tree was invalidated, we need to remove these
 		// tx from the mempool as the next incoming block may alternatively
 		// validate them.
@@ -2244,6 +2748,30 @@ func (b *blockManager) QueueHeaders(headers *wire.MsgHeaders, sp *serverPeer) {
 	b.msgChan <- &headersMsg{headers: headers, peer: sp}
 }
 
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.
+func (b *blockManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, sp *serverPeer) {
+	// No channel handling here because peers do not need to block on
+	// cmpctblock messages.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: sp}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block handling
+// queue.
+func (b *blockManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, sp *serverPeer) {
+	// No channel handling here because peers do not need to block on
+	// blocktxn messages.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- &blockTxnMsg{blockTxn: blockTxn, peer: sp}
+}
+
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (b *blockManager) DonePeer(sp *serverPeer) {
 	// Ignore if we are shutting down.
@@ -2433,6 +2961,27 @@ func (b *blockManager) ForceReorganization(formerBest, newBest chainhash.Hash) e
 	return response.err
 }
 
+// InvalidateBlock marks the block with the passed hash and its descendants as
+// invalid and reorganizes the chain away from them as needed.  It is funneled
+// through the block manager since blockchain is not safe for concurrent access.
+func (b *blockManager) InvalidateBlock(hash *chainhash.Hash) error {
+	reply := make(chan invalidateBlockResponse)
+	b.msgChan <- invalidateBlockMsg{hash: hash, reply: reply}
+	response := <-reply
+	return response.err
+}
+
+// ReconsiderBlock removes the invalid status from the block with the passed
+// hash and reorganizes the chain to it when it is part of the best chain.  It
+// is funneled through the block manager since blockchain is not safe for
+// concurrent access.
+func (b *blockManager) ReconsiderBlock(hash *chainhash.Hash) error {
+	reply := make(chan reconsiderBlockResponse)
+	b.msgChan <- reconsiderBlockMsg{hash: hash, reply: reply}
+	response := <-reply
+	return response.err
+}
+
 // TipGeneration returns the hashes of all the children of the current best
 // chain tip.  It is funneled through the block manager since blockchain is not
 // safe for concurrent access.
@@ -2473,6 +3022,38 @@ func (b *blockManager) IsCurrent() bool {
 	return <-reply
 }
 
+// SyncHeight returns the height of the best chain the block manager is syncing
+// to or has synced to.  It is never less than the height of the current best
+// chain.
+//
+// This function is safe for concurrent access.
+func (b *blockManager) SyncHeight() int64 {
+	b.syncHeightMtx.Lock()
+	syncHeight := b.syncHeight
+	b.syncHeightMtx.Unlock()
+
+	if best := b.chain.BestSnapshot().Height; best > syncHeight {
+		return best
+	}
+	return syncHeight
+}
+
+// HeadersHeight returns the height of the best validated block header.  It is
+// the tip of the header chain synced ahead of the blocks in headers-first mode
+// and never less than the height of the current best chain.
+//
+// This function is safe for concurrent access.
+func (b *blockManager) HeadersHeight() int64 {
+	b.syncHeightMtx.Lock()
+	headersHeight := b.headersHeight
+	b.syncHeightMtx.Unlock()
+
+	if best := b.chain.BestSnapshot().Height; best > headersHeight {
+		return best
+	}
+	return headersHeight
+}
+
 // Pause pauses the block manager until the returned channel is closed.
 //
 // Note that while paused, all peer and block processing is halted.  The
@@ -2562,6 +3143,8 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager, interrupt
 		progressLogger:      newBlockProgressLogger("Processed", bmgrLog),
 		msgChan:             make(chan interface{}, cfg.MaxPeers*3),
 		headerList:          list.New(),
+		inFlightBlocks:      make(map[chainhash.Hash]*inFlightBlock),
+		candidatePeers:      list.New(),
 		AggressiveMining:    !cfg.NonAggressive,
 		quit:                make(chan struct{}),
 	}
@@ -2576,22 +3159,20 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager, interrupt
 		Notifications: bm.handleNotifyMsg,
 		SigCache:      s.sigCache,
 		IndexManager:  indexManager,
+		PruneTarget:   cfg.Prune * 1024 * 1024,
 	})
 	if err != nil {
 		return nil, err
 	}
 	best := bm.chain.BestSnapshot()
 	bm.chain.DisableCheckpoints(cfg.DisableCheckpoints)
-	if !cfg.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		bm.nextCheckpoint = bm.findNextHeaderCheckpoint(best.Height)
-		if bm.nextCheckpoint != nil {
-			bm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	if cfg.DisableCheckpoints {
 		bmgrLog.Info("Checkpoints are disabled")
 	}
 
+	// Initialize the next checkpoint based on the current height.
+	bm.resetHeaderState(best.Height)
+
 	// Dump the blockchain here if asked for it, and quit.
 	if cfg.DumpBlockchain != "" {
 		err = dumpBlockChain(bm.chain, best.Height)
@@ -2728,6 +3309,43 @@ func loadBlockDB() (database.DB, error) {
 	return db, nil
 }
 
+// loadUtxoSnapshot imports the utxo snapshot specified via --loadutxosnapshot
+// into the passed block database so the chain is initialized at the snapshot
+// block instead of the genesis block.  Nothing is done when a snapshot has
+// already been imported into the database.
+func loadUtxoSnapshot(db database.DB) error {
+	var hash *chainhash.Hash
+	var height int64
+	err := db.View(func(dbTx database.Tx) error {
+		hash, height = blockchain.DBFetchUtxoSnapshot(dbTx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if hash != nil {
+		cmmLog.Infof("Utxo snapshot of block %v (height %d) has already "+
+			"been imported", hash, height)
+		return nil
+	}
+
+	cmmLog.Infof("Importing utxo snapshot from '%s'", cfg.LoadUtxoSnapshot)
+	file, err := os.Open(cfg.LoadUtxoSnapshot)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := blockchain.LoadUtxoSnapshot(db, bufio.NewReader(file),
+		activeNetParams.Params)
+	if err != nil {
+		return err
+	}
+	cmmLog.Infof("Imported utxo snapshot of block %v (height %d)",
+		info.Hash, info.Height)
+	return nil
+}
+
 // dumpBlockChain dumps a map of the blockchain blocks as serialized bytes.
 func dumpBlockChain(b *blockchain.BlockChain, height int64) error {
 	bmgrLog.Infof("Writing the blockchain to disk as a flat file, " +
@@ -0,0 +1,526 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/database"
+	"github.com/CommerciumBlockchain/cmmd/mempool"
+	"github.com/CommerciumBlockchain/cmmd/mining"
+	"github.com/CommerciumBlockchain/cmmd/peer"
+	"github.com/CommerciumBlockchain/cmmd/txscript"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// newCmpctTestTx returns a transaction which is unique for the passed seed.
+func newCmpctTestTx(seed byte) *wire.MsgTx {
+	tx := wire.NewMsgTx()
+	prevOut := wire.NewOutPoint(&chainhash.Hash{seed}, 0, wire.TxTreeRegular)
+	tx.AddTxIn(wire.NewTxIn(prevOut, nil))
+	tx.AddTxOut(wire.NewTxOut(int64(seed), nil))
+	return tx
+}
+
+// TestRebuildTxTree ensures a transaction tree is rebuilt from the prefilled
+// transactions and the pool transactions matching the short transaction IDs,
+// and that the indexes of the transactions which are not in the pool are
+// reported.
+func TestRebuildTxTree(t *testing.T) {
+	txns := []*wire.MsgTx{newCmpctTestTx(0), newCmpctTestTx(1),
+		newCmpctTestTx(2), newCmpctTestTx(3)}
+	pool := map[uint64]*wire.MsgTx{11: txns[1], 13: txns[3], 14: nil}
+
+	tests := []struct {
+		name        string
+		shortIDs    []uint64
+		prefilled   []wire.PrefilledTx
+		wantTxns    []*wire.MsgTx
+		wantMissing []uint32
+	}{{
+		name:     "empty tree",
+		wantTxns: []*wire.MsgTx{},
+	}, {
+		name:      "prefilled only",
+		prefilled: []wire.PrefilledTx{{Index: 0, Tx: txns[0]}},
+		wantTxns:  txns[:1],
+	}, {
+		name:      "all in pool",
+		shortIDs:  []uint64{11, 13},
+		prefilled: []wire.PrefilledTx{{Index: 0, Tx: txns[0]}},
+		wantTxns:  []*wire.MsgTx{txns[0], txns[1], txns[3]},
+	}, {
+		name:     "interleaved prefilled",
+		shortIDs: []uint64{11, 13},
+		prefilled: []wire.PrefilledTx{{Index: 0, Tx: txns[0]},
+			{Index: 2, Tx: txns[2]}},
+		wantTxns: txns,
+	}, {
+		name:        "missing and colliding",
+		shortIDs:    []uint64{12, 11, 14},
+		prefilled:   []wire.PrefilledTx{{Index: 0, Tx: txns[0]}},
+		wantTxns:    []*wire.MsgTx{txns[0], nil, txns[1], nil},
+		wantMissing: []uint32{1, 3},
+	}}
+	for _, test := range tests {
+		gotTxns, gotMissing := rebuildTxTree(test.shortIDs,
+			test.prefilled, pool)
+		if !reflect.DeepEqual(gotTxns, test.wantTxns) {
+			t.Errorf("%s: unexpected transactions -- got %v, want %v",
+				test.name, gotTxns, test.wantTxns)
+		}
+		if !reflect.DeepEqual(gotMissing, test.wantMissing) {
+			t.Errorf("%s: unexpected missing indexes -- got %v, "+
+				"want %v", test.name, gotMissing, test.wantMissing)
+		}
+	}
+}
+
+// TestCmpctBlockRebuild ensures blocks announced with cmpctblock messages are
+// rebuilt from the memory pool, that missing transactions are completed with
+// the blocktxn response to the getblocktxn request, and that rebuilt blocks
+// which do not match their merkle roots are detected so the full block is
+// requested instead.
+func TestCmpctBlockRebuild(t *testing.T) {
+	// Create a block with a coinbase, three regular transactions and two
+	// stake transactions that commits to its transactions.
+	block := wire.NewMsgBlock(&wire.BlockHeader{Height: 100})
+	for i := byte(0); i < 4; i++ {
+		block.AddTransaction(newCmpctTestTx(i))
+	}
+	for i := byte(10); i < 12; i++ {
+		block.AddSTransaction(newCmpctTestTx(i))
+	}
+	utilBlock := cmmutil.NewBlock(block)
+	merkles := blockchain.BuildMerkleTreeStore(utilBlock.Transactions())
+	sMerkles := blockchain.BuildMerkleTreeStore(utilBlock.STransactions())
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+	block.Header.StakeRoot = *sMerkles[len(sMerkles)-1]
+	blockHash := block.BlockHash()
+	msg := wire.NewMsgCmpctBlockFromBlock(block, 1)
+
+	// txDescs returns memory pool descriptors for the passed transactions.
+	txDescs := func(txns ...*wire.MsgTx) []*mempool.TxDesc {
+		descs := make([]*mempool.TxDesc, 0, len(txns))
+		for _, tx := range txns {
+			descs = append(descs, &mempool.TxDesc{
+				TxDesc: mining.TxDesc{Tx: cmmutil.NewTx(tx)},
+			})
+		}
+		return descs
+	}
+
+	// The block is rebuilt directly when every transaction is in the pool.
+	pool := txDescs(block.Transactions[1], block.Transactions[2],
+		block.Transactions[3], block.STransactions[0],
+		block.STransactions[1], newCmpctTestTx(20))
+	pb := newPartialBlock(msg, pool)
+	if len(pb.missing) != 0 || len(pb.sMissing) != 0 {
+		t.Fatalf("unexpected missing transactions -- got %v and %v",
+			pb.missing, pb.sMissing)
+	}
+	if pb.hash != blockHash || pb.block.BlockHash() != blockHash {
+		t.Fatalf("unexpected rebuilt block hash -- got %v, want %v",
+			pb.block.BlockHash(), blockHash)
+	}
+	if !merkleRootsMatch(cmmutil.NewBlock(pb.block)) {
+		t.Fatal("rebuilt block does not match its merkle roots")
+	}
+
+	// Transactions that are not in the pool, or whose short IDs collide
+	// with another pool transaction, are requested from the peer.
+	pool = txDescs(block.Transactions[2], block.Transactions[3],
+		block.Transactions[3], block.STransactions[1])
+	pb = newPartialBlock(msg, pool)
+	wantMissing, wantSMissing := []uint32{1, 3}, []uint32{0}
+	if !reflect.DeepEqual(pb.missing, wantMissing) ||
+		!reflect.DeepEqual(pb.sMissing, wantSMissing) {
+
+		t.Fatalf("unexpected missing transactions -- got %v and %v, "+
+			"want %v and %v", pb.missing, pb.sMissing, wantMissing,
+			wantSMissing)
+	}
+	getBlockTxn := wire.NewMsgGetBlockTxn(&pb.hash, pb.missing, pb.sMissing)
+	if !reflect.DeepEqual(getBlockTxn.Indexes, wantMissing) ||
+		!reflect.DeepEqual(getBlockTxn.SIndexes, wantSMissing) {
+
+		t.Fatalf("unexpected getblocktxn indexes -- got %v and %v",
+			getBlockTxn.Indexes, getBlockTxn.SIndexes)
+	}
+
+	// A blocktxn response without exactly the requested transactions is
+	// rejected.
+	blockTxn := wire.NewMsgBlockTxn(&blockHash)
+	blockTxn.Transactions = []*wire.MsgTx{block.Transactions[1]}
+	blockTxn.STransactions = []*wire.MsgTx{block.STransactions[0]}
+	if err := pb.complete(blockTxn); err == nil {
+		t.Fatal("blocktxn with too few transactions accepted")
+	}
+
+	// A blocktxn response with the requested transactions completes the
+	// block.
+	blockTxn.Transactions = append(blockTxn.Transactions,
+		block.Transactions[3])
+	if err := pb.complete(blockTxn); err != nil {
+		t.Fatalf("unable to complete block: %v", err)
+	}
+	if pb.block.BlockHash() != blockHash ||
+		!merkleRootsMatch(cmmutil.NewBlock(pb.block)) {
+
+		t.Fatal("completed block does not match the original block")
+	}
+
+	// A block completed with other transactions than the ones it commits
+	// to, such as a malleated transaction, is detected so the full block
+	// is requested instead.
+	pb = newPartialBlock(msg, pool)
+	blockTxn.Transactions[1] = newCmpctTestTx(30)
+	if err := pb.complete(blockTxn); err != nil {
+		t.Fatalf("unable to complete block: %v", err)
+	}
+	if merkleRootsMatch(cmmutil.NewBlock(pb.block)) {
+		t.Fatal("block with a wrong transaction matches its merkle roots")
+	}
+}
+
+// newHeadersFirstTestManager returns a block manager in headers-first mode
+// backed by a new chain with only the genesis block.  Its header list contains
+// the passed number of headers, starting at height 1, which do not refer to any
+// known blocks.  The returned function must be called to remove the chain once
+// the test is done.
+func newHeadersFirstTestManager(t *testing.T, numHeaders int) (*blockManager, func()) {
+	t.Helper()
+
+	params := &chaincfg.SimNetParams
+	dbPath, err := ioutil.TempDir("", "cmmdbmtest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	b := &blockManager{
+		chain:               chain,
+		requestedBlocks:     make(map[chainhash.Hash]struct{}),
+		requestedEverBlocks: make(map[chainhash.Hash]uint8),
+		headersFirstMode:    true,
+		headerList:          list.New(),
+		inFlightBlocks:      make(map[chainhash.Hash]*inFlightBlock),
+		candidatePeers:      list.New(),
+	}
+	for height := int64(1); height <= int64(numHeaders); height++ {
+		hash := chainhash.HashH([]byte{byte(height), byte(height >> 8)})
+		b.headerList.PushBack(&headerNode{height: height, hash: &hash})
+	}
+	return b, teardown
+}
+
+// newHeadersFirstTestPeer returns a connected server peer which advertised a
+// best chain at the passed height and adds it to the candidate peers of the
+// passed block manager.  The remote side of the connection sends the getdata
+// messages it receives on the returned channel.
+func newHeadersFirstTestPeer(t *testing.T, b *blockManager, lastBlock int32) (*serverPeer, <-chan *wire.MsgGetData) {
+	t.Helper()
+
+	params := &chaincfg.SimNetParams
+	localConn, remoteConn := net.Pipe()
+	verAck := make(chan struct{}, 1)
+	sp := newServerPeer(&server{chainParams: params}, false)
+	p, err := peer.NewOutboundPeer(&peer.Config{
+		ChainParams: params,
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verAck <- struct{}{}
+			},
+		},
+	}, "127.0.0.1:18555")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+	}
+	sp.Peer = p
+	p.AssociateConnection(localConn)
+
+	// Play the remote side of the handshake and report the getdata
+	// messages which follow it.
+	pver := wire.ProtocolVersion
+	getData := make(chan *wire.MsgGetData, 100)
+	go func() {
+		defer remoteConn.Close()
+		if _, _, err := wire.ReadMessage(remoteConn, pver, params.Net); err != nil {
+			return
+		}
+		addr := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"),
+			18555, 0)
+		msgs := []wire.Message{
+			wire.NewMsgVersion(addr, addr, 0x7e57, lastBlock),
+			wire.NewMsgVerAck(),
+		}
+		for _, msg := range msgs {
+			err := wire.WriteMessage(remoteConn, msg, pver, params.Net)
+			if err != nil {
+				return
+			}
+		}
+		for {
+			msg, _, err := wire.ReadMessage(remoteConn, pver, params.Net)
+			if err != nil {
+				return
+			}
+			if msg, ok := msg.(*wire.MsgGetData); ok {
+				getData <- msg
+			}
+		}
+	}()
+	select {
+	case <-verAck:
+	case <-time.After(time.Second * 5):
+		t.Fatal("verack timeout")
+	}
+	b.candidatePeers.PushBack(sp)
+	return sp, getData
+}
+
+// TestHeadersFirstBlockDownload ensures the blocks of the header chain are
+// requested from all of the candidate peers within the download window and
+// the limit of blocks in flight per peer, and that the blocks of stalled peers
+// are requested from the other peers unless the peers keep delivering blocks.
+func TestHeadersFirstBlockDownload(t *testing.T) {
+	b, teardown := newHeadersFirstTestManager(t, blockDownloadWindow+50)
+	defer teardown()
+
+	// checkInFlight ensures the blocks of the expected number of lowest
+	// headers are in flight and that no peer has more than the maximum
+	// number of blocks in flight.
+	checkInFlight := func(desc string, want int) {
+		t.Helper()
+		if len(b.inFlightBlocks) != want {
+			t.Fatalf("%s: unexpected number of blocks in flight -- "+
+				"got %d, want %d", desc, len(b.inFlightBlocks), want)
+		}
+		for hash, inFlight := range b.inFlightBlocks {
+			if inFlight.height > int64(want) {
+				t.Fatalf("%s: block %v at height %d in flight before "+
+					"lower blocks", desc, hash, inFlight.height)
+			}
+			if _, ok := inFlight.peer.requestedBlocks[hash]; !ok {
+				t.Fatalf("%s: block %v in flight is not requested "+
+					"from its peer", desc, hash)
+			}
+		}
+		for e := b.candidatePeers.Front(); e != nil; e = e.Next() {
+			sp := e.Value.(*serverPeer)
+			if len(sp.requestedBlocks) > maxInFlightBlocksPerPeer {
+				t.Fatalf("%s: peer %s has %d blocks in flight",
+					desc, sp, len(sp.requestedBlocks))
+			}
+		}
+	}
+
+	// Only the blocks up to the height advertised by the peers are
+	// requested from them, spread over the peers with the fewest blocks in
+	// flight, and no peer has more than the maximum number of blocks in
+	// flight.
+	lowPeer, lowGetData := newHeadersFirstTestPeer(t, b, 4)
+	defer lowPeer.Disconnect()
+	highPeer, highGetData := newHeadersFirstTestPeer(t, b, 1000)
+	defer highPeer.Disconnect()
+	b.fetchHeaderBlocks()
+	checkInFlight("two peers", 2+maxInFlightBlocksPerPeer)
+	for _, test := range []struct {
+		sp      *serverPeer
+		getData <-chan *wire.MsgGetData
+		want    int
+	}{
+		{lowPeer, lowGetData, 2},
+		{highPeer, highGetData, maxInFlightBlocksPerPeer},
+	} {
+		if len(test.sp.requestedBlocks) != test.want {
+			t.Fatalf("peer %s: unexpected number of requested blocks "+
+				"-- got %d, want %d", test.sp,
+				len(test.sp.requestedBlocks), test.want)
+		}
+		select {
+		case msg := <-test.getData:
+			if len(msg.InvList) != test.want {
+				t.Fatalf("peer %s: unexpected number of blocks in "+
+					"getdata -- got %d, want %d", test.sp,
+					len(msg.InvList), test.want)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("peer %s: getdata timeout", test.sp)
+		}
+	}
+
+	// Enough peers to download more blocks than the download window are
+	// only requested the blocks within the window.
+	peers := []*serverPeer{highPeer}
+	numPeers := blockDownloadWindow/maxInFlightBlocksPerPeer + 1
+	for len(peers) < numPeers {
+		sp, _ := newHeadersFirstTestPeer(t, b, 1000)
+		defer sp.Disconnect()
+		peers = append(peers, sp)
+	}
+	b.fetchHeaderBlocks()
+	checkInFlight("full window", blockDownloadWindow)
+
+	// A peer which delivers one of its blocks has the time after which it
+	// is considered stalled extended for all of its blocks.
+	past := time.Now().Add(-time.Second)
+	for _, inFlight := range b.inFlightBlocks {
+		inFlight.deadline = past
+	}
+	b.extendBlockDeadlines(highPeer)
+	for hash, inFlight := range b.inFlightBlocks {
+		extended := inFlight.deadline.After(time.Now())
+		if extended != (inFlight.peer == highPeer) {
+			t.Fatalf("block %v: unexpected deadline extension -- "+
+				"got %v, want %v", hash, extended, !extended)
+		}
+	}
+
+	// Peers which do not deliver their blocks in time are disconnected and
+	// their blocks are requested from the remaining peers.
+	for _, sp := range peers {
+		b.extendBlockDeadlines(sp)
+	}
+	var stalledBlocks []chainhash.Hash
+	for hash := range lowPeer.requestedBlocks {
+		stalledBlocks = append(stalledBlocks, hash)
+	}
+	b.handleStallSample()
+	if lowPeer.Connected() {
+		t.Fatal("stalled peer not disconnected")
+	}
+	if len(lowPeer.requestedBlocks) != 0 {
+		t.Fatalf("stalled peer still has %d blocks in flight",
+			len(lowPeer.requestedBlocks))
+	}
+	for _, sp := range peers {
+		if !sp.Connected() {
+			t.Fatalf("peer %s with extended deadlines disconnected", sp)
+		}
+	}
+	checkInFlight("stalled", blockDownloadWindow)
+	for _, hash := range stalledBlocks {
+		inFlight, ok := b.inFlightBlocks[hash]
+		if !ok || inFlight.peer == lowPeer {
+			t.Fatalf("block %v of the stalled peer not requested from "+
+				"another peer", hash)
+		}
+	}
+}
+
+// TestHeadersFirstBadBlock ensures a block of the header chain which does not
+// match its header penalizes the peer which delivered it and is requested from
+// another peer, while a block which matches its header but is invalid causes
+// the sync peer to be disconnected instead.
+func TestHeadersFirstBadBlock(t *testing.T) {
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{BanThreshold: defaultBanThreshold}
+	b, teardown := newHeadersFirstTestManager(t, 0)
+	defer teardown()
+
+	// Create a block at the first header which commits to its transactions
+	// but is invalid since it does not have a coinbase.
+	params := &chaincfg.SimNetParams
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+		PrevBlock: *params.GenesisHash,
+		Height:    1,
+	})
+	msgBlock.AddTransaction(newCmpctTestTx(0))
+	merkles := blockchain.BuildMerkleTreeStore(
+		cmmutil.NewBlock(msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	blockHash := msgBlock.BlockHash()
+	b.headerList.PushBack(&headerNode{height: 1, hash: &blockHash})
+
+	syncPeer, _ := newHeadersFirstTestPeer(t, b, 1)
+	defer syncPeer.Disconnect()
+	b.syncPeer = syncPeer
+	b.haveAllHeaders = true
+	badPeer, _ := newHeadersFirstTestPeer(t, b, 1)
+	defer badPeer.Disconnect()
+	goodPeer, _ := newHeadersFirstTestPeer(t, b, 1)
+	defer goodPeer.Disconnect()
+	b.candidatePeers.Remove(b.candidatePeers.Front())
+
+	// deliver delivers the block with the passed transactions from the
+	// peer it was requested from and returns that peer.
+	deliver := func(txns []*wire.MsgTx) *serverPeer {
+		t.Helper()
+		inFlight, ok := b.inFlightBlocks[blockHash]
+		if !ok || inFlight.peer == nil {
+			t.Fatal("block not in flight")
+		}
+		sp := inFlight.peer
+		block := *msgBlock
+		block.Transactions = txns
+		b.handleBlockMsg(&blockMsg{
+			block: cmmutil.NewBlock(&block),
+			peer:  sp,
+		})
+		return sp
+	}
+
+	// A block with other transactions than the ones committed to by its
+	// header is requested from another peer and the peer which delivered it
+	// is penalized.
+	b.fetchHeaderBlocks()
+	sp := deliver([]*wire.MsgTx{newCmpctTestTx(1)})
+	if sp != badPeer {
+		t.Fatalf("block requested from unexpected peer %s", sp)
+	}
+	if badPeer.Connected() || badPeer.banScore.Int() == 0 {
+		t.Fatal("peer which delivered a block not matching its header " +
+			"was not penalized")
+	}
+	if !syncPeer.Connected() {
+		t.Fatal("sync peer disconnected for a block not matching its " +
+			"header")
+	}
+	if inFlight, ok := b.inFlightBlocks[blockHash]; !ok ||
+		inFlight.peer != goodPeer {
+
+		t.Fatal("block not requested from another peer")
+	}
+
+	// A block which matches its header but is invalid means the header
+	// chain of the sync peer is invalid.
+	deliver(msgBlock.Transactions)
+	if !goodPeer.Connected() || goodPeer.banScore.Int() != 0 {
+		t.Fatal("peer which delivered the block matching its header " +
+			"was penalized")
+	}
+	if syncPeer.Connected() {
+		t.Fatal("sync peer not disconnected for an invalid header chain")
+	}
+}
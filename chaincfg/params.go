@@ -90,6 +90,19 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// UtxoSnapshot identifies a known good utxo set snapshot which may be imported
+// to bootstrap a new node without replaying all of the blocks that lead up to
+// it.  The utxo hash is the serialized hash of the utxo set as of the block as
+// reported by the gettxoutsetinfo RPC.  The snapshot hash commits to the entire
+// contents of the snapshot, including the stake database, and is reported by
+// the exportutxosnapshot RPC.
+type UtxoSnapshot struct {
+	Height       int64
+	Hash         *chainhash.Hash
+	UtxoHash     *chainhash.Hash
+	SnapshotHash *chainhash.Hash
+}
+
 // Vote describes a voting instance.  It is self-describing so that the UI can
 // be directly implemented using the fields.  Mask determines which bits can be
 // used.  Bits are enumerated and must be consecutive.  Each vote requires one
@@ -331,6 +344,10 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// UtxoSnapshots are the utxo set snapshots which may be imported to
+	// bootstrap a new node.
+	UtxoSnapshots []UtxoSnapshot
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -504,6 +521,9 @@ var MainNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{},
 
+	// Utxo set snapshots which may be imported to bootstrap a new node.
+	UtxoSnapshots: nil,
+
 	// The miner confirmation window is defined as:
 	//   target proof of work timespan / target proof of work spacing
 	RuleChangeActivationQuorum:     4032, // 10 % of RuleChangeActivationInterval * TicketsPerBlock
@@ -615,6 +635,9 @@ var TestNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{},
 
+	// Utxo set snapshots which may be imported to bootstrap a new node.
+	UtxoSnapshots: nil,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -723,6 +746,9 @@ var SimNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
+	// Utxo set snapshots which may be imported to bootstrap a new node.
+	UtxoSnapshots: nil,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	flags "github.com/jessevdk/go-flags"
+)
+
+const defaultWait = time.Second * 2
+
+// config defines the configuration options for msgcapture.
+//
+// See loadConfig for details on the configuration load process.
+type config struct {
+	Replay bool          `short:"r" long:"replay" description:"Replay the messages received from the peer into a new inbound peer and print the messages it sends instead of printing the captured messages"`
+	Peer   string        `short:"p" long:"peer" description:"Only use the messages of the peer with the given address (eg. 192.168.1.10:9108)"`
+	Wait   time.Duration `short:"w" long:"wait" description:"How long to wait for the messages sent by the peer after replaying.  Valid time units are {ms, s, m}"`
+}
+
+// loadConfig initializes and parses the config using command line options.
+// The remaining arguments are the message capture files to read.
+func loadConfig() (*config, []string, error) {
+	// Default config.
+	cfg := config{
+		Wait: defaultWait,
+	}
+
+	// Parse command line options.
+	parser := flags.NewParser(&cfg, flags.Default)
+	parser.Usage = "[OPTIONS] <capture file>..."
+	remainingArgs, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		return nil, nil, err
+	}
+
+	if len(remainingArgs) == 0 {
+		err := errors.New("loadConfig: no message capture files specified")
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	return &cfg, remainingArgs, nil
+}
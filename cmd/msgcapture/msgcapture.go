@@ -0,0 +1,206 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// msgcapture decodes the message capture files written by cmmd for the peers
+// selected with --capturepeer into JSON and replays them into a peer.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/peer"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// jsonRecord is the JSON representation of a captured message.  Messages which
+// fail to decode are represented by their hex encoded payload and the decode
+// error instead.
+type jsonRecord struct {
+	Timestamp       string       `json:"timestamp"`
+	Direction       string       `json:"direction"`
+	Addr            string       `json:"addr"`
+	ProtocolVersion uint32       `json:"protocolversion"`
+	Command         string       `json:"command"`
+	Message         wire.Message `json:"message,omitempty"`
+	Payload         string       `json:"payload,omitempty"`
+	Error           string       `json:"error,omitempty"`
+}
+
+// printJSON writes the passed record to stdout as a single line of JSON.
+func printJSON(rec *jsonRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
+
+// printRecord writes the passed captured record of the passed network to
+// stdout as a single line of JSON.
+func printRecord(rec *peer.CaptureRecord, cmmnet wire.CurrencyNet) error {
+	jsonRec := &jsonRecord{
+		Timestamp:       rec.Timestamp.UTC().Format(time.RFC3339Nano),
+		Direction:       rec.Direction.String(),
+		Addr:            rec.Addr,
+		ProtocolVersion: rec.ProtocolVersion,
+		Command:         rec.Command,
+	}
+	msg, err := rec.Message(cmmnet)
+	if err != nil {
+		jsonRec.Payload = hex.EncodeToString(rec.Payload)
+		jsonRec.Error = err.Error()
+	} else {
+		jsonRec.Message = msg
+	}
+	return printJSON(jsonRec)
+}
+
+// readCaptureFile returns the records of the passed message capture file along
+// with the network of the captured messages.
+func readCaptureFile(path string) ([]*peer.CaptureRecord, wire.CurrencyNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	r, err := peer.NewCaptureReader(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", path, err)
+	}
+	var records []*peer.CaptureRecord
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", path, err)
+		}
+		records = append(records, rec)
+	}
+	return records, r.Net(), nil
+}
+
+// netParams returns the parameters of the network with the passed identifier.
+func netParams(cmmnet wire.CurrencyNet) (*chaincfg.Params, error) {
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams,
+		&chaincfg.TestNetParams, &chaincfg.SimNetParams} {
+
+		if params.Net == cmmnet {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %v", cmmnet)
+}
+
+// replay replays the messages received from the captured peer into a new
+// inbound peer and prints the messages the peer sends in response.
+func replay(records []*peer.CaptureRecord, cmmnet wire.CurrencyNet) error {
+	// The messages must all be from the same peer since they are replayed
+	// over a single connection.
+	var addr string
+	for _, rec := range records {
+		if addr != "" && rec.Addr != addr {
+			return errors.New("the messages of multiple peers were " +
+				"captured -- select one with --peer")
+		}
+		addr = rec.Addr
+	}
+
+	params, err := netParams(cmmnet)
+	if err != nil {
+		return err
+	}
+	p := peer.NewInboundPeer(&peer.Config{
+		UserAgentName:    "msgcapture",
+		UserAgentVersion: "1.0",
+		ChainParams:      params,
+	})
+
+	// The messages sent by the peer are printed from a separate goroutine,
+	// so serialize the output.
+	var mtx sync.Mutex
+	onSent := func(msg wire.Message) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		err := printJSON(&jsonRecord{
+			Timestamp:       time.Now().UTC().Format(time.RFC3339Nano),
+			Direction:       peer.CaptureSent.String(),
+			Addr:            addr,
+			ProtocolVersion: p.ProtocolVersion(),
+			Command:         msg.Command(),
+			Message:         msg,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to print %s message: %v\n",
+				msg.Command(), err)
+		}
+	}
+	err = peer.ReplayCapture(p, records, cmmnet, onSent)
+	if err == nil {
+		time.Sleep(cfg.Wait)
+	}
+	p.Disconnect()
+	p.WaitForDisconnect()
+	return err
+}
+
+var cfg *config
+
+func main() {
+	// Load configuration and parse command line.
+	tcfg, files, err := loadConfig()
+	if err != nil {
+		os.Exit(1)
+	}
+	cfg = tcfg
+
+	// Read the records of all of the capture files in the given order.
+	var records []*peer.CaptureRecord
+	var cmmnet wire.CurrencyNet
+	for i, file := range files {
+		fileRecords, fileNet, err := readCaptureFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if i > 0 && fileNet != cmmnet {
+			fmt.Fprintf(os.Stderr, "%s: the messages are for a "+
+				"different network\n", file)
+			os.Exit(1)
+		}
+		cmmnet = fileNet
+		for _, rec := range fileRecords {
+			if cfg.Peer == "" || rec.Addr == cfg.Peer {
+				records = append(records, rec)
+			}
+		}
+	}
+
+	if cfg.Replay {
+		if err := replay(records, cmmnet); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to replay messages:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, rec := range records {
+		if err := printRecord(rec, cmmnet); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to print %s message: %v\n",
+				rec.Command, err)
+			os.Exit(1)
+		}
+	}
+}
@@ -176,6 +176,14 @@ func cmmdMain(serverChan chan<- *server) error {
 		return nil
 	}
 
+	// Initialize the chain from a utxo snapshot if requested.
+	if cfg.LoadUtxoSnapshot != "" {
+		if err := loadUtxoSnapshot(db); err != nil {
+			cmmLog.Errorf("Unable to load utxo snapshot: %v", err)
+			return err
+		}
+	}
+
 	// Create server and start it.
 	lifetimeNotifier.notifyStartupEvent(lifetimeEventP2PServer)
 	server, err := newServer(cfg.Listeners, db, activeNetParams.Params,
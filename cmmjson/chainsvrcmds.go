@@ -46,6 +46,15 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// ClearBannedCmd defines the clearbanned JSON-RPC command.
+type ClearBannedCmd struct{}
+
+// NewClearBannedCmd returns a new instance which can be used to issue a
+// clearbanned JSON-RPC command.
+func NewClearBannedCmd() *ClearBannedCmd {
+	return &ClearBannedCmd{}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair. Contains Commercium additions.
 type TransactionInput struct {
@@ -114,6 +123,57 @@ func NewEstimateFeeCmd(numBlocks int64) *EstimateFeeCmd {
 	}
 }
 
+// EstimateSmartFeeMode defines the different fee estimation modes available
+// for the estimatesmartfee JSON-RPC.
+type EstimateSmartFeeMode string
+
+const (
+	// EstimateModeEconomical requests an estimate which is more responsive
+	// to short term drops in the prevailing fee market.
+	EstimateModeEconomical EstimateSmartFeeMode = "ECONOMICAL"
+
+	// EstimateModeConservative requests an estimate which is less likely to
+	// be undercut by short term fluctuations of the fee market.
+	EstimateModeConservative EstimateSmartFeeMode = "CONSERVATIVE"
+)
+
+// EstimateSmartFeeModeAddr is a helper routine that allocates a new
+// EstimateSmartFeeMode value to store v and returns a pointer to it.  This is
+// useful when assigning optional parameters.
+func EstimateSmartFeeModeAddr(v EstimateSmartFeeMode) *EstimateSmartFeeMode {
+	p := new(EstimateSmartFeeMode)
+	*p = v
+	return p
+}
+
+// EstimateSmartFeeCmd defines the estimatesmartfee JSON-RPC command.
+type EstimateSmartFeeCmd struct {
+	ConfTarget   int64
+	EstimateMode *EstimateSmartFeeMode `jsonrpcdefault:"\"CONSERVATIVE\""`
+}
+
+// NewEstimateSmartFeeCmd returns a new instance which can be used to issue an
+// estimatesmartfee JSON-RPC command.
+func NewEstimateSmartFeeCmd(confTarget int64, mode *EstimateSmartFeeMode) *EstimateSmartFeeCmd {
+	return &EstimateSmartFeeCmd{
+		ConfTarget:   confTarget,
+		EstimateMode: mode,
+	}
+}
+
+// ExportUtxoSnapshotCmd defines the exportutxosnapshot JSON-RPC command.
+type ExportUtxoSnapshotCmd struct {
+	Path string
+}
+
+// NewExportUtxoSnapshotCmd returns a new instance which can be used to issue
+// an exportutxosnapshot JSON-RPC command.
+func NewExportUtxoSnapshotCmd(path string) *ExportUtxoSnapshotCmd {
+	return &ExportUtxoSnapshotCmd{
+		Path: path,
+	}
+}
+
 // GetAddedNodeInfoCmd defines the getaddednodeinfo JSON-RPC command.
 type GetAddedNodeInfoCmd struct {
 	DNS  bool
@@ -409,6 +469,55 @@ func NewGetHeadersCmd(blockLocators string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// GetMempoolAncestorsCmd defines the getmempoolancestors JSON-RPC command.
+type GetMempoolAncestorsCmd struct {
+	Txid    string
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolAncestorsCmd returns a new instance which can be used to issue
+// a getmempoolancestors JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolAncestorsCmd(txHash string, verbose *bool) *GetMempoolAncestorsCmd {
+	return &GetMempoolAncestorsCmd{
+		Txid:    txHash,
+		Verbose: verbose,
+	}
+}
+
+// GetMempoolDescendantsCmd defines the getmempooldescendants JSON-RPC command.
+type GetMempoolDescendantsCmd struct {
+	Txid    string
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolDescendantsCmd returns a new instance which can be used to
+// issue a getmempooldescendants JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolDescendantsCmd(txHash string, verbose *bool) *GetMempoolDescendantsCmd {
+	return &GetMempoolDescendantsCmd{
+		Txid:    txHash,
+		Verbose: verbose,
+	}
+}
+
+// GetMempoolEntryCmd defines the getmempoolentry JSON-RPC command.
+type GetMempoolEntryCmd struct {
+	Txid string
+}
+
+// NewGetMempoolEntryCmd returns a new instance which can be used to issue a
+// getmempoolentry JSON-RPC command.
+func NewGetMempoolEntryCmd(txHash string) *GetMempoolEntryCmd {
+	return &GetMempoolEntryCmd{
+		Txid: txHash,
+	}
+}
+
 // GetMempoolInfoCmd defines the getmempoolinfo JSON-RPC command.
 type GetMempoolInfoCmd struct{}
 
@@ -593,6 +702,28 @@ func NewHelpCmd(command *string) *HelpCmd {
 	}
 }
 
+// InvalidateBlockCmd defines the invalidateblock JSON-RPC command.
+type InvalidateBlockCmd struct {
+	BlockHash string
+}
+
+// NewInvalidateBlockCmd returns a new instance which can be used to issue an
+// invalidateblock JSON-RPC command.
+func NewInvalidateBlockCmd(blockHash string) *InvalidateBlockCmd {
+	return &InvalidateBlockCmd{
+		BlockHash: blockHash,
+	}
+}
+
+// ListBannedCmd defines the listbanned JSON-RPC command.
+type ListBannedCmd struct{}
+
+// NewListBannedCmd returns a new instance which can be used to issue a
+// listbanned JSON-RPC command.
+func NewListBannedCmd() *ListBannedCmd {
+	return &ListBannedCmd{}
+}
+
 // PingCmd defines the ping JSON-RPC command.
 type PingCmd struct{}
 
@@ -602,6 +733,45 @@ func NewPingCmd() *PingCmd {
 	return &PingCmd{}
 }
 
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+type PrioritiseTransactionCmd struct {
+	Txid          string
+	PriorityDelta float64
+	FeeDelta      int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to
+// issue a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txHash string, priorityDelta float64, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		Txid:          txHash,
+		PriorityDelta: priorityDelta,
+		FeeDelta:      feeDelta,
+	}
+}
+
+// ReconsiderBlockCmd defines the reconsiderblock JSON-RPC command.
+type ReconsiderBlockCmd struct {
+	BlockHash string
+}
+
+// NewReconsiderBlockCmd returns a new instance which can be used to issue a
+// reconsiderblock JSON-RPC command.
+func NewReconsiderBlockCmd(blockHash string) *ReconsiderBlockCmd {
+	return &ReconsiderBlockCmd{
+		BlockHash: blockHash,
+	}
+}
+
+// SaveMempoolCmd defines the savemempool JSON-RPC command.
+type SaveMempoolCmd struct{}
+
+// NewSaveMempoolCmd returns a new instance which can be used to issue a
+// savemempool JSON-RPC command.
+func NewSaveMempoolCmd() *SaveMempoolCmd {
+	return &SaveMempoolCmd{}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -648,6 +818,41 @@ func NewSendRawTransactionCmd(hexTx string, allowHighFees *bool) *SendRawTransac
 	}
 }
 
+// SetBanSubCmd defines the type used in the setban JSON-RPC command for the
+// sub command field.
+type SetBanSubCmd string
+
+const (
+	// SBAdd indicates the specified IP address or subnet should be banned.
+	SBAdd SetBanSubCmd = "add"
+
+	// SBRemove indicates the ban of the specified IP address or subnet
+	// should be removed.
+	SBRemove SetBanSubCmd = "remove"
+)
+
+// SetBanCmd defines the setban JSON-RPC command.
+type SetBanCmd struct {
+	SubNet   string
+	SubCmd   SetBanSubCmd `jsonrpcusage:"\"add|remove\""`
+	BanTime  *int64       `jsonrpcdefault:"0"`
+	Absolute *bool        `jsonrpcdefault:"false"`
+}
+
+// NewSetBanCmd returns a new instance which can be used to issue a setban
+// JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetBanCmd(subNet string, subCmd SetBanSubCmd, banTime *int64, absolute *bool) *SetBanCmd {
+	return &SetBanCmd{
+		SubNet:   subNet,
+		SubCmd:   subCmd,
+		BanTime:  banTime,
+		Absolute: absolute,
+	}
+}
+
 // SetGenerateCmd defines the setgenerate JSON-RPC command.
 type SetGenerateCmd struct {
 	Generate     bool
@@ -755,10 +960,13 @@ func init() {
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
+	MustRegisterCmd("clearbanned", (*ClearBannedCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
 	MustRegisterCmd("estimatefee", (*EstimateFeeCmd)(nil), flags)
+	MustRegisterCmd("estimatesmartfee", (*EstimateSmartFeeCmd)(nil), flags)
+	MustRegisterCmd("exportutxosnapshot", (*ExportUtxoSnapshotCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
@@ -777,6 +985,9 @@ func init() {
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
+	MustRegisterCmd("getmempoolancestors", (*GetMempoolAncestorsCmd)(nil), flags)
+	MustRegisterCmd("getmempooldescendants", (*GetMempoolDescendantsCmd)(nil), flags)
+	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
 	MustRegisterCmd("getnetworkinfo", (*GetNetworkInfoCmd)(nil), flags)
@@ -789,9 +1000,15 @@ func init() {
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
+	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
+	MustRegisterCmd("listbanned", (*ListBannedCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
+	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
+	MustRegisterCmd("savemempool", (*SaveMempoolCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("setban", (*SetBanCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
@@ -42,6 +42,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &cmmjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: cmmjson.ANRemove},
 		},
+		{
+			name: "clearbanned",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("clearbanned")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewClearBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"clearbanned","params":[],"id":1}`,
+			unmarshalled: &cmmjson.ClearBannedCmd{},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -103,6 +114,46 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &cmmjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "estimatesmartfee",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("estimatesmartfee", 6)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewEstimateSmartFeeCmd(6, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6],"id":1}`,
+			unmarshalled: &cmmjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: cmmjson.EstimateSmartFeeModeAddr(cmmjson.EstimateModeConservative),
+			},
+		},
+		{
+			name: "estimatesmartfee optional",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("estimatesmartfee", 6, cmmjson.EstimateModeEconomical)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewEstimateSmartFeeCmd(6,
+					cmmjson.EstimateSmartFeeModeAddr(cmmjson.EstimateModeEconomical))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6,"ECONOMICAL"],"id":1}`,
+			unmarshalled: &cmmjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: cmmjson.EstimateSmartFeeModeAddr(cmmjson.EstimateModeEconomical),
+			},
+		},
+		{
+			name: "exportutxosnapshot",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("exportutxosnapshot", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewExportUtxoSnapshotCmd("utxo.dat")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"exportutxosnapshot","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &cmmjson.ExportUtxoSnapshotCmd{Path: "utxo.dat"},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -426,6 +477,75 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &cmmjson.GetInfoCmd{},
 		},
+		{
+			name: "getmempoolancestors",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("getmempoolancestors", "123")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewGetMempoolAncestorsCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["123"],"id":1}`,
+			unmarshalled: &cmmjson.GetMempoolAncestorsCmd{
+				Txid:    "123",
+				Verbose: cmmjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempoolancestors optional",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("getmempoolancestors", "123", true)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewGetMempoolAncestorsCmd("123", cmmjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["123",true],"id":1}`,
+			unmarshalled: &cmmjson.GetMempoolAncestorsCmd{
+				Txid:    "123",
+				Verbose: cmmjson.Bool(true),
+			},
+		},
+		{
+			name: "getmempooldescendants",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("getmempooldescendants", "123")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewGetMempoolDescendantsCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["123"],"id":1}`,
+			unmarshalled: &cmmjson.GetMempoolDescendantsCmd{
+				Txid:    "123",
+				Verbose: cmmjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempooldescendants optional",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("getmempooldescendants", "123", true)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewGetMempoolDescendantsCmd("123", cmmjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["123",true],"id":1}`,
+			unmarshalled: &cmmjson.GetMempoolDescendantsCmd{
+				Txid:    "123",
+				Verbose: cmmjson.Bool(true),
+			},
+		},
+		{
+			name: "getmempoolentry",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("getmempoolentry", "123")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewGetMempoolEntryCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolentry","params":["123"],"id":1}`,
+			unmarshalled: &cmmjson.GetMempoolEntryCmd{
+				Txid: "123",
+			},
+		},
 		{
 			name: "getmempoolinfo",
 			newCmd: func() (interface{}, error) {
@@ -684,6 +804,30 @@ func TestChainSvrCmds(t *testing.T) {
 				Command: cmmjson.String("getblock"),
 			},
 		},
+		{
+			name: "invalidateblock",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("invalidateblock", "123")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewInvalidateBlockCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"invalidateblock","params":["123"],"id":1}`,
+			unmarshalled: &cmmjson.InvalidateBlockCmd{
+				BlockHash: "123",
+			},
+		},
+		{
+			name: "listbanned",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("listbanned")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewListBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listbanned","params":[],"id":1}`,
+			unmarshalled: &cmmjson.ListBannedCmd{},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -695,6 +839,45 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"ping","params":[],"id":1}`,
 			unmarshalled: &cmmjson.PingCmd{},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("prioritisetransaction", "123", 0.5, 1000)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewPrioritiseTransactionCmd("123", 0.5, 1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",0.5,1000],"id":1}`,
+			unmarshalled: &cmmjson.PrioritiseTransactionCmd{
+				Txid:          "123",
+				PriorityDelta: 0.5,
+				FeeDelta:      1000,
+			},
+		},
+		{
+			name: "reconsiderblock",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("reconsiderblock", "123")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewReconsiderBlockCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"reconsiderblock","params":["123"],"id":1}`,
+			unmarshalled: &cmmjson.ReconsiderBlockCmd{
+				BlockHash: "123",
+			},
+		},
+		{
+			name: "savemempool",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("savemempool")
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewSaveMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"savemempool","params":[],"id":1}`,
+			unmarshalled: &cmmjson.SaveMempoolCmd{},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -864,6 +1047,38 @@ func TestChainSvrCmds(t *testing.T) {
 				AllowHighFees: cmmjson.Bool(false),
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("setban", "10.0.0.0/8", cmmjson.SBAdd)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewSetBanCmd("10.0.0.0/8", cmmjson.SBAdd, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.0/8","add"],"id":1}`,
+			unmarshalled: &cmmjson.SetBanCmd{
+				SubNet:   "10.0.0.0/8",
+				SubCmd:   cmmjson.SBAdd,
+				BanTime:  cmmjson.Int64(0),
+				Absolute: cmmjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return cmmjson.NewCmd("setban", "10.0.0.1", cmmjson.SBAdd, 1600000000, true)
+			},
+			staticCmd: func() interface{} {
+				return cmmjson.NewSetBanCmd("10.0.0.1", cmmjson.SBAdd, cmmjson.Int64(1600000000), cmmjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.1","add",1600000000,true],"id":1}`,
+			unmarshalled: &cmmjson.SetBanCmd{
+				SubNet:   "10.0.0.1",
+				SubCmd:   cmmjson.SBAdd,
+				BanTime:  cmmjson.Int64(1600000000),
+				Absolute: cmmjson.Bool(true),
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
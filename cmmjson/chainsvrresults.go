@@ -85,6 +85,25 @@ type DecodeScriptResult struct {
 	P2sh      string   `json:"p2sh,omitempty"`
 }
 
+// EstimateSmartFeeResult models the data returned from the estimatesmartfee
+// command.
+type EstimateSmartFeeResult struct {
+	FeeRate *float64 `json:"feerate,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	Blocks  int64    `json:"blocks"`
+}
+
+// ExportUtxoSnapshotResult models the data returned from the
+// exportutxosnapshot command.
+type ExportUtxoSnapshotResult struct {
+	Path         string `json:"path"`
+	BlockHash    string `json:"blockhash"`
+	Height       int64  `json:"height"`
+	UtxoHash     string `json:"utxohash"`
+	SnapshotHash string `json:"snapshothash"`
+	Bytes        int64  `json:"bytes"`
+}
+
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
 // getaddednodeinfo command.
 type GetAddedNodeInfoResultAddr struct {
@@ -102,13 +121,26 @@ type GetAddedNodeInfoResult struct {
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
-	Chain                string  `json:"chain"`
-	Blocks               int32   `json:"blocks"`
-	Headers              int32   `json:"headers"`
-	BestBlockHash        string  `json:"bestblockhash"`
-	Difficulty           float64 `json:"difficulty"`
-	VerificationProgress float64 `json:"verificationprogress"`
-	ChainWork            string  `json:"chainwork"`
+	Chain                string                `json:"chain"`
+	Blocks               int64                 `json:"blocks"`
+	Headers              int64                 `json:"headers"`
+	SyncHeight           int64                 `json:"syncheight"`
+	BestBlockHash        string                `json:"bestblockhash"`
+	Difficulty           float64               `json:"difficulty"`
+	MedianTime           int64                 `json:"mediantime"`
+	VerificationProgress float64               `json:"verificationprogress"`
+	InitialBlockDownload bool                  `json:"initialblockdownload"`
+	ChainWork            string                `json:"chainwork"`
+	Pruned               bool                  `json:"pruned"`
+	PruneHeight          int64                 `json:"pruneheight,omitempty"`
+	Deployments          map[string]AgendaInfo `json:"deployments"`
+}
+
+// AgendaInfo provides an overview of an agenda in a consensus deployment.
+type AgendaInfo struct {
+	Status     string `json:"status"`
+	StartTime  uint64 `json:"starttime"`
+	ExpireTime uint64 `json:"expiretime"`
 }
 
 // GetBlockSubsidyResult models the data returned from the getblocksubsidy
@@ -136,6 +168,42 @@ type GetBlockTemplateResultAux struct {
 	Flags string `json:"flags"`
 }
 
+// GetBlockTemplateResultHeader models the decoded header fields of the block
+// template returned by the getblocktemplate command.
+type GetBlockTemplateResultHeader struct {
+	Version      int32  `json:"version"`
+	PreviousHash string `json:"previousblockhash"`
+	MerkleRoot   string `json:"merkleroot"`
+	StakeRoot    string `json:"stakeroot"`
+	VoteBits     uint16 `json:"votebits"`
+	FinalState   string `json:"finalstate"`
+	Voters       uint16 `json:"voters"`
+	FreshStake   uint8  `json:"freshstake"`
+	Revocations  uint8  `json:"revocations"`
+	PoolSize     uint32 `json:"poolsize"`
+	Bits         string `json:"bits"`
+	SBits        int64  `json:"sbits"`
+	Height       uint32 `json:"height"`
+	Size         uint32 `json:"size"`
+	CurTime      int64  `json:"curtime"`
+	Nonce        uint32 `json:"nonce"`
+	ExtraData    string `json:"extradata"`
+	StakeVersion uint32 `json:"stakeversion"`
+}
+
+// GetBlockTemplateResultEquihash models the equihash parameters and the
+// layout of the serialized header of the block template returned by the
+// getblocktemplate command.
+type GetBlockTemplateResultEquihash struct {
+	N               int `json:"n"`
+	K               int `json:"k"`
+	SolutionSize    int `json:"solutionsize"`
+	HeaderSize      int `json:"headersize"`
+	NonceOffset     int `json:"nonceoffset"`
+	ExtraDataOffset int `json:"extradataoffset"`
+	SolutionOffset  int `json:"solutionoffset"`
+}
+
 // GetBlockTemplateResult models the data returned from the getblocktemplate
 // command.
 type GetBlockTemplateResult struct {
@@ -144,15 +212,17 @@ type GetBlockTemplateResult struct {
 	// GBT has been modified from the Bitcoin semantics to include
 	// the header rather than various components which are all part
 	// of the header anyway.
-	Header        string                     `json:"header"`
-	SigOpLimit    int64                      `json:"sigoplimit,omitempty"`
-	SizeLimit     int64                      `json:"sizelimit,omitempty"`
-	Transactions  []GetBlockTemplateResultTx `json:"transactions"`
-	STransactions []GetBlockTemplateResultTx `json:"stransactions"`
-	CoinbaseAux   *GetBlockTemplateResultAux `json:"coinbaseaux,omitempty"`
-	CoinbaseTxn   *GetBlockTemplateResultTx  `json:"coinbasetxn,omitempty"`
-	CoinbaseValue *int64                     `json:"coinbasevalue,omitempty"`
-	WorkID        string                     `json:"workid,omitempty"`
+	Header        string                          `json:"header"`
+	HeaderFields  *GetBlockTemplateResultHeader   `json:"headerfields,omitempty"`
+	Equihash      *GetBlockTemplateResultEquihash `json:"equihash,omitempty"`
+	SigOpLimit    int64                           `json:"sigoplimit,omitempty"`
+	SizeLimit     int64                           `json:"sizelimit,omitempty"`
+	Transactions  []GetBlockTemplateResultTx      `json:"transactions"`
+	STransactions []GetBlockTemplateResultTx      `json:"stransactions"`
+	CoinbaseAux   *GetBlockTemplateResultAux      `json:"coinbaseaux,omitempty"`
+	CoinbaseTxn   *GetBlockTemplateResultTx       `json:"coinbasetxn,omitempty"`
+	CoinbaseValue *int64                          `json:"coinbasevalue,omitempty"`
+	WorkID        string                          `json:"workid,omitempty"`
 
 	// Optional long polling from BIP 0022.
 	LongPollID  string `json:"longpollid,omitempty"`
@@ -182,11 +252,34 @@ type GetChainTipsResult struct {
 	Status    string `json:"status"`
 }
 
+// GetMempoolEntryResult models the data returned from the getmempoolentry
+// command and the getmempoolancestors and getmempooldescendants commands when
+// the verbose flag is set.
+type GetMempoolEntryResult struct {
+	Size             int32    `json:"size"`
+	Fee              float64  `json:"fee"`
+	ModifiedFee      float64  `json:"modifiedfee"`
+	Time             int64    `json:"time"`
+	Height           int64    `json:"height"`
+	StartingPriority float64  `json:"startingpriority"`
+	CurrentPriority  float64  `json:"currentpriority"`
+	DescendantCount  int64    `json:"descendantcount"`
+	DescendantSize   int64    `json:"descendantsize"`
+	DescendantFees   float64  `json:"descendantfees"`
+	AncestorCount    int64    `json:"ancestorcount"`
+	AncestorSize     int64    `json:"ancestorsize"`
+	AncestorFees     float64  `json:"ancestorfees"`
+	Depends          []string `json:"depends"`
+	SpentBy          []string `json:"spentby"`
+}
+
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size  int64 `json:"size"`
-	Bytes int64 `json:"bytes"`
+	Size          int64   `json:"size"`
+	Bytes         int64   `json:"bytes"`
+	MaxMempool    int64   `json:"maxmempool"`
+	MempoolMinFee float64 `json:"mempoolminfee"`
 }
 
 // GetNetworkInfoResult models the data returned from the getnetworkinfo
@@ -223,6 +316,8 @@ type GetPeerInfoResult struct {
 	CurrentHeight  int64   `json:"currentheight,omitempty"`
 	BanScore       int32   `json:"banscore"`
 	SyncNode       bool    `json:"syncnode"`
+	MaxSendRate    int64   `json:"maxsendrate"`
+	MaxRecvRate    int64   `json:"maxrecvrate"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -231,6 +326,7 @@ type GetPeerInfoResult struct {
 type GetRawMempoolVerboseResult struct {
 	Size             int32    `json:"size"`
 	Fee              float64  `json:"fee"`
+	ModifiedFee      float64  `json:"modifiedfee"`
 	Time             int64    `json:"time"`
 	Height           int64    `json:"height"`
 	StartingPriority float64  `json:"startingpriority"`
@@ -259,11 +355,42 @@ type GetTxOutResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// GetTxOutSetInfoResult models the data from the gettxoutsetinfo command.
+type GetTxOutSetInfoResult struct {
+	Height         int64   `json:"height"`
+	BestBlock      string  `json:"bestblock"`
+	Transactions   int64   `json:"transactions"`
+	TxOuts         int64   `json:"txouts"`
+	SerializedSize int64   `json:"bytes_serialized"`
+	SerializedHash string  `json:"hash_serialized"`
+	TotalAmount    float64 `json:"total_amount"`
+}
+
+// ListBannedResult models the data of a single ban returned from the
+// listbanned command.
+type ListBannedResult struct {
+	Address     string `json:"address"`
+	BanCreated  int64  `json:"bancreated"`
+	BannedUntil int64  `json:"banneduntil"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
-	TotalBytesRecv uint64 `json:"totalbytesrecv"`
-	TotalBytesSent uint64 `json:"totalbytessent"`
-	TimeMillis     int64  `json:"timemillis"`
+	TotalBytesRecv uint64                         `json:"totalbytesrecv"`
+	TotalBytesSent uint64                         `json:"totalbytessent"`
+	TimeMillis     int64                          `json:"timemillis"`
+	UploadTarget   GetNetTotalsResultUploadTarget `json:"uploadtarget"`
+}
+
+// GetNetTotalsResultUploadTarget models the upload target data returned from
+// the getnettotals command.
+type GetNetTotalsResultUploadTarget struct {
+	TimeFrame             int64  `json:"timeframe"`
+	Target                uint64 `json:"target"`
+	TargetReached         bool   `json:"targetreached"`
+	ServeHistoricalBlocks bool   `json:"servehistoricalblocks"`
+	BytesLeftInCycle      uint64 `json:"bytesleftincycle"`
+	TimeLeftInCycle       int64  `json:"timeleftincycle"`
 }
 
 // ScriptSig models a signature script.  It is defined separately since it only
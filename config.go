@@ -22,6 +22,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/CommerciumBlockchain/cmmd/blockchain"
 	"github.com/CommerciumBlockchain/cmmd/connmgr"
 	"github.com/CommerciumBlockchain/cmmd/database"
 	_ "github.com/CommerciumBlockchain/cmmd/database/ffldb"
@@ -55,11 +56,17 @@ const (
 	defaultNoMiningStateSync     = false
 	defaultAllowOldVotes         = false
 	defaultMaxOrphanTransactions = 1000
+	defaultMaxMempool            = 300
 	defaultMaxOrphanTxSize       = 5000
 	defaultSigCacheMaxSize       = 100000
 	defaultTxIndex               = false
 	defaultNoExistsAddrIndex     = false
 	defaultNoCFilters            = false
+	defaultStratumDifficulty     = 1.0
+	defaultStratumVarDiff        = time.Minute * 2
+	defaultDandelionEpoch        = time.Minute * 10
+	defaultCaptureMaxFileSize    = 16
+	defaultCaptureMaxFiles       = 10
 )
 
 var (
@@ -104,6 +111,18 @@ type config struct {
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	V2Transport          bool          `long:"v2transport" description:"Support the encrypted and authenticated v2 P2P transport and prefer it for outbound connections, falling back to the v1 protocol for peers that do not support it"`
+	V2Only               bool          `long:"v2only" description:"Only connect to and accept peers that use the v2 P2P transport -- implies --v2transport"`
+	Dandelion            bool          `long:"dandelion" description:"Relay transactions submitted via RPC with Dandelion++ to hide their origin and relay stem transactions for other peers"`
+	DandelionEpoch       time.Duration `long:"dandelionepoch" description:"How often the Dandelion++ stem routes are changed"`
+	MaxUploadRate        uint64        `long:"maxuploadrate" description:"Max KiB per second sent to all non-whitelisted peers combined (0 = unlimited)"`
+	MaxDownloadRate      uint64        `long:"maxdownloadrate" description:"Max KiB per second received from all non-whitelisted peers combined (0 = unlimited)"`
+	MaxPeerUploadRate    uint64        `long:"maxpeeruploadrate" description:"Max KiB per second sent to each non-whitelisted peer (0 = unlimited)"`
+	MaxPeerDownloadRate  uint64        `long:"maxpeerdownloadrate" description:"Max KiB per second received from each non-whitelisted peer (0 = unlimited)"`
+	MaxUploadTarget      uint64        `long:"maxuploadtarget" description:"Try to keep the data sent to peers below the given number of MiB per 24h -- Historical blocks are no longer served to non-whitelisted peers once the target is about to be reached -- Must leave room to relay new blocks, which is 216 MiB on the main network (0 = unlimited)"`
+	CapturePeers         []string      `long:"capturepeer" description:"Record the messages sent to and received from peers with the given IP or IP network to rotating files in the msgcapture directory of the data directory (eg. 192.168.1.0/24 or ::1)"`
+	CaptureMaxFileSize   int64         `long:"capturemaxfilesize" description:"Max MiB per message capture file"`
+	CaptureMaxFiles      int           `long:"capturemaxfiles" description:"Max number of message capture files to keep"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
@@ -126,14 +145,21 @@ type config struct {
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	TorControl           string        `long:"torcontrol" description:"Create a tor onion service for the listener via the tor control port and advertise it (eg. 127.0.0.1:9051)"`
+	TorPassword          string        `long:"torpassword" default-mask:"-" description:"Password for the tor control port -- NOTE: Cookie authentication is used when not specified"`
+	I2PProxy             string        `long:"i2pproxy" description:"Connect to I2P destinations via SOCKS5 proxy (eg. 127.0.0.1:4447)"`
+	CJDNSReachable       bool          `long:"cjdnsreachable" description:"Treat addresses in fc00::/8 as CJDNS addresses which can be connected to directly"`
 	TestNet              bool          `long:"testnet" description:"Use the test network"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	Prune                uint64        `long:"prune" description:"Reduce disk usage by deleting the oldest blocks once the stored blocks exceed the specified target size in MiB (0 = disabled, minimum 550) -- Pruned nodes only serve recent blocks and do not support the transaction or address indexes"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given [addr:]port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
 	MemProfile           string        `long:"memprofile" description:"Write mem profile to the specified file"`
 	DumpBlockchain       string        `long:"dumpblockchain" description:"Write blockchain as a flat file of blocks for use with addblock, to the specified filename"`
+	LoadUtxoSnapshot     string        `long:"loadutxosnapshot" description:"Initialize a new block database from the utxo snapshot in the specified file -- The snapshot must be pinned by the network parameters"`
+	VerifyUtxoSnapshot   bool          `long:"verifyutxosnapshot" description:"Verify the block headers leading up to an imported utxo snapshot in the background"`
 	MiningTimeOffset     int           `long:"miningtimeoffset" description:"Offset the mining timestamp of a block by this many seconds (positive values are in the past)"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
@@ -141,11 +167,16 @@ type config struct {
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxMempool           int64         `long:"maxmempool" description:"Max MiB of transactions to keep in the memory pool -- The transactions paying the lowest fee rates are evicted beyond it and a quarter of it is reserved for stake transactions -- 0 to disable"`
+	PersistMempool       bool          `long:"persistmempool" description:"Save the memory pool to mempool.dat in the data directory at shutdown and periodically and reload it on startup"`
 	Generate             bool          `long:"generate" description:"Generate (mine) coins using the CPU"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	StratumListeners     []string      `long:"stratumlisten" description:"Add an interface/port to listen for stratum mining connections (default port: 9112, testnet: 19112) -- NOTE: The stratum server is disabled unless at least one interface is specified"`
+	StratumDifficulty    float64       `long:"stratumdiff" description:"Initial share difficulty assigned to each stratum miner, relative to the proof of work limit of the network -- Miners may request a fixed difficulty with a password of d=<difficulty>"`
+	StratumVarDiff       time.Duration `long:"stratumvardiff" description:"Interval at which the share difficulty of each stratum miner is retargeted to maintain a steady share rate, 0 to disable.  Valid time units are {s, m, h}"`
 	GetWorkKeys          []string      `long:"getworkkey" description:"DEPRECATED -- Use the --miningaddr option instead"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
@@ -169,10 +200,12 @@ type config struct {
 	onionlookup          func(string) ([]net.IP, error)
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string) (net.Conn, error)
+	i2pdial              func(string, string) (net.Conn, error)
 	dial                 func(string, string) (net.Conn, error)
 	miningAddrs          []cmmutil.Address
 	minRelayTxFee        cmmutil.Amount
 	whitelists           []*net.IPNet
+	capturePeers         []*net.IPNet
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -444,6 +477,7 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxSize:         defaultBlockMaxSize,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxMempool:           defaultMaxMempool,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
 		Generate:             defaultGenerate,
 		NoMiningStateSync:    defaultNoMiningStateSync,
@@ -452,6 +486,11 @@ func loadConfig() (*config, []string, error) {
 		AllowOldVotes:        defaultAllowOldVotes,
 		NoExistsAddrIndex:    defaultNoExistsAddrIndex,
 		NoCFilters:           defaultNoCFilters,
+		StratumDifficulty:    defaultStratumDifficulty,
+		StratumVarDiff:       defaultStratumVarDiff,
+		DandelionEpoch:       defaultDandelionEpoch,
+		CaptureMaxFileSize:   defaultCaptureMaxFileSize,
+		CaptureMaxFiles:      defaultCaptureMaxFiles,
 	}
 
 	// Service options which are only added on Windows.
@@ -748,6 +787,48 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Validate any given IP addresses and networks of the peers to capture
+	// the messages of along with the limits of the capture files.
+	for _, addr := range cfg.CapturePeers {
+		ipnet, err := connmgr.ParseSubnet(addr)
+		if err != nil {
+			str := "%s: the capturepeer value of '%s' is invalid"
+			err = fmt.Errorf(str, funcName, addr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.capturePeers = append(cfg.capturePeers, ipnet)
+	}
+	if cfg.CaptureMaxFileSize < 1 || cfg.CaptureMaxFiles < 1 {
+		str := "%s: the capturemaxfilesize and capturemaxfiles " +
+			"options must be at least 1"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The upload target must be large enough to relay the new blocks
+	// expected during a full cycle since they are served even once the
+	// target is reached.
+	if cfg.MaxUploadTarget != 0 {
+		const bytesPerMiB = 1024 * 1024
+		maxBlockSizes := activeNetParams.MaximumBlockSizes
+		minTarget := minUploadTarget(activeNetParams.TargetTimePerBlock,
+			uint64(maxBlockSizes[len(maxBlockSizes)-1]))
+		minTargetMiB := (minTarget + bytesPerMiB - 1) / bytesPerMiB
+		if cfg.MaxUploadTarget < minTargetMiB {
+			str := "%s: the maxuploadtarget option must be 0 or at " +
+				"least %d MiB to relay new blocks -- parsed [%d]"
+			err := fmt.Errorf(str, funcName, minTargetMiB,
+				cfg.MaxUploadTarget)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// --addPeer and --connect do not mix.
 	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
 		str := "%s: the --addpeer and --connect options can not be " +
@@ -861,6 +942,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Limit the max mempool size to a sane value.
+	if cfg.MaxMempool < 0 {
+		str := "%s: the maxmempool option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxMempool)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -897,6 +988,63 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The prune target must be at least the minimum allowed size.
+	const bytesPerMiB = 1024 * 1024
+	if cfg.Prune != 0 && cfg.Prune < blockchain.MinPruneTarget/bytesPerMiB {
+		str := "%s: the --prune target may not be less than %d MiB -- " +
+			"parsed [%d]"
+		err := fmt.Errorf(str, funcName,
+			blockchain.MinPruneTarget/bytesPerMiB, cfg.Prune)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --v2only implies --v2transport.
+	if cfg.V2Only {
+		cfg.V2Transport = true
+	}
+
+	// Don't allow Dandelion++ epochs that are too short.
+	if cfg.DandelionEpoch < time.Second {
+		str := "%s: the dandelionepoch option may not be less than 1s " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DandelionEpoch)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --dandelion and --blocksonly do not mix since stem transactions are
+	// received from remote peers.
+	if cfg.Dandelion && cfg.BlocksOnly {
+		err := fmt.Errorf("%s: the --dandelion and --blocksonly options "+
+			"may not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --txindex do not mix since pruned blocks can't be
+	// indexed or served.
+	if cfg.Prune != 0 && cfg.TxIndex {
+		err := fmt.Errorf("%s: the --prune and --txindex options may "+
+			"not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --addrindex do not mix since pruned blocks can't be
+	// indexed or served.
+	if cfg.Prune != 0 && cfg.AddrIndex {
+		err := fmt.Errorf("%s: the --prune and --addrindex options may "+
+			"not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// !--noexistsaddrindex and --dropexistsaddrindex do not mix.
 	if !cfg.NoExistsAddrIndex && cfg.DropExistsAddrIndex {
 		err := fmt.Errorf("dropexistsaddrindex cannot be activated when " +
@@ -967,11 +1115,47 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure there is at least one mining address when the stratum server
+	// is enabled.
+	if len(cfg.StratumListeners) > 0 && len(cfg.miningAddrs) == 0 {
+		str := "%s: the stratumlisten option is set, but there are no " +
+			"mining addresses specified "
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The stratum share difficulty must be positive.
+	if cfg.StratumDifficulty <= 0 {
+		str := "%s: the stratumdiff option must be greater than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StratumDifficulty)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow a negative stratum retarget interval.
+	if cfg.StratumVarDiff < 0 {
+		str := "%s: the stratumvardiff option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StratumVarDiff)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
 		activeNetParams.DefaultPort)
 
+	// Add default port to all stratum listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.StratumListeners = normalizeAddresses(cfg.StratumListeners,
+		activeNetParams.stratumPort)
+
 	// Add default port to all rpc listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
@@ -1115,6 +1299,40 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Validate the tor control port address used to create an onion service
+	// for the listener.
+	if cfg.TorControl != "" {
+		_, _, err := net.SplitHostPort(cfg.TorControl)
+		if err != nil {
+			str := "%s: Tor control address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.TorControl, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Setup the I2P address dial function.  Since I2P destinations can only
+	// be reached through an I2P router, dialing them results in an error
+	// unless an I2P proxy is specified.
+	if cfg.I2PProxy != "" {
+		_, _, err := net.SplitHostPort(cfg.I2PProxy)
+		if err != nil {
+			str := "%s: I2P proxy address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.I2PProxy, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		proxy := &socks.Proxy{Addr: cfg.I2PProxy}
+		cfg.i2pdial = proxy.Dial
+	} else {
+		cfg.i2pdial = func(a, b string) (net.Conn, error) {
+			return nil, errors.New("i2p has not been enabled")
+		}
+	}
+
 	// Warn if old testnet directory is present.
 	for _, oldDir := range oldTestNets {
 		if fileExists(oldDir) {
@@ -1143,9 +1361,30 @@ func cmmdDial(network, addr string) (net.Conn, error) {
 	if strings.Contains(addr, ".onion:") {
 		return cfg.oniondial(network, addr)
 	}
+	if strings.Contains(addr, ".i2p:") {
+		return cfg.i2pdial(network, addr)
+	}
 	return cfg.dial(network, addr)
 }
 
+// cmmdProxyDial connects to the address of a peer on an overlay network, such
+// as a Tor hidden service or an I2P destination, through the proxy for its
+// network.  Unlike cmmdDial, addresses on any other network result in an error
+// rather than being dialed with the normal dial function.
+func cmmdProxyDial(network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(host, ".onion"):
+		return cfg.oniondial(network, addr)
+	case strings.HasSuffix(host, ".i2p"):
+		return cfg.i2pdial(network, addr)
+	}
+	return nil, fmt.Errorf("no proxy for address %s", addr)
+}
+
 // cmmdLookup returns the correct DNS lookup function to use depending on the
 // passed host and configuration options.  For example, .onion addresses will be
 // resolved using the onion specific proxy if one was specified, but will
@@ -0,0 +1,265 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BanEntry describes a banned IP address or subnet.  Single IP addresses are
+// represented by a subnet with a full mask.
+type BanEntry struct {
+	Subnet  *net.IPNet
+	Created time.Time
+	Until   time.Time
+}
+
+// serializedBanEntry is the format a ban entry is persisted in.
+type serializedBanEntry struct {
+	Subnet  string `json:"subnet"`
+	Created int64  `json:"created"`
+	Until   int64  `json:"until"`
+}
+
+// BanList houses the IP addresses and subnets which are banned along with when
+// their bans expire.  Every change is written to the file the list was created
+// with so bans persist across restarts.
+//
+// A nil BanList does not ban any address.  It is safe for concurrent access.
+type BanList struct {
+	mtx      sync.Mutex
+	filename string
+	entries  map[string]*BanEntry
+}
+
+// NewBanList returns an empty ban list which is persisted to the passed file.
+// Nothing is persisted when the filename is empty.  Load must be called to
+// read the bans from a previous run.
+func NewBanList(filename string) *BanList {
+	return &BanList{
+		filename: filename,
+		entries:  make(map[string]*BanEntry),
+	}
+}
+
+// ParseSubnet parses the passed IP address or subnet in CIDR notation, such as
+// "192.168.0.0/16" or "2001:db8::/32".  A single IP address results in a subnet
+// which only contains that address.
+func ParseSubnet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, subnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q", s)
+		}
+		return subnet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// addrIP returns the IP address of the passed network address or nil when it
+// does not have one, such as for onion addresses.
+func addrIP(addr net.Addr) net.IP {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// removeExpired removes the bans which have expired at the passed time.
+//
+// This function MUST be called with the mutex held.
+func (b *BanList) removeExpired(now time.Time) {
+	for key, entry := range b.entries {
+		if !now.Before(entry.Until) {
+			delete(b.entries, key)
+		}
+	}
+}
+
+// save writes the bans to the file of the ban list.
+//
+// This function MUST be called with the mutex held.
+func (b *BanList) save() error {
+	if b.filename == "" {
+		return nil
+	}
+
+	entries := make([]serializedBanEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		entries = append(entries, serializedBanEntry{
+			Subnet:  entry.Subnet.String(),
+			Created: entry.Created.Unix(),
+			Until:   entry.Until.Unix(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Subnet < entries[j].Subnet
+	})
+
+	// Write temporary ban list file and then move it into place.
+	tmpfile := b.filename + ".new"
+	w, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, b.filename)
+}
+
+// Load reads the bans persisted by a previous run from the file of the ban
+// list.  Bans which have expired in the meantime are ignored.
+func (b *BanList) Load() error {
+	if b.filename == "" {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(b.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []serializedBanEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return fmt.Errorf("error reading %s: %v", b.filename, err)
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, e := range entries {
+		subnet, err := ParseSubnet(e.Subnet)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", b.filename,
+				err)
+		}
+		b.entries[subnet.String()] = &BanEntry{
+			Subnet:  subnet,
+			Created: time.Unix(e.Created, 0),
+			Until:   time.Unix(e.Until, 0),
+		}
+	}
+	b.removeExpired(time.Now())
+	return nil
+}
+
+// Ban bans the passed subnet until the passed time.  An existing ban of the
+// same subnet is only extended, never shortened.
+func (b *BanList) Ban(subnet *net.IPNet, until time.Time) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	b.removeExpired(now)
+	key := subnet.String()
+	if entry, ok := b.entries[key]; ok {
+		if !until.After(entry.Until) {
+			return nil
+		}
+		entry.Until = until
+		return b.save()
+	}
+	b.entries[key] = &BanEntry{
+		Subnet:  subnet,
+		Created: now,
+		Until:   until,
+	}
+	return b.save()
+}
+
+// Unban removes the ban of the passed subnet.  It returns false when the subnet
+// is not banned.  Bans of other subnets which contain the subnet are not
+// affected.
+func (b *BanList) Unban(subnet *net.IPNet) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.removeExpired(time.Now())
+	key := subnet.String()
+	if _, ok := b.entries[key]; !ok {
+		return false, nil
+	}
+	delete(b.entries, key)
+	return true, b.save()
+}
+
+// Clear removes all bans.
+func (b *BanList) Clear() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.entries = make(map[string]*BanEntry)
+	return b.save()
+}
+
+// IsBanned returns whether or not the passed IP address is within any of the
+// banned subnets.
+func (b *BanList) IsBanned(ip net.IP) bool {
+	if b == nil || ip == nil {
+		return false
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	for _, entry := range b.entries {
+		if now.Before(entry.Until) && entry.Subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBannedAddr returns whether or not the IP address of the passed network
+// address is banned.  Addresses without an IP address are never banned.
+func (b *BanList) IsBannedAddr(addr net.Addr) bool {
+	if b == nil {
+		return false
+	}
+	return b.IsBanned(addrIP(addr))
+}
+
+// Entries returns the bans which have not expired sorted by subnet.
+func (b *BanList) Entries() []BanEntry {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.removeExpired(time.Now())
+	entries := make([]BanEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Subnet.String() < entries[j].Subnet.String()
+	})
+	return entries
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseSubnet ensures IP addresses and subnets are parsed as expected.
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"10.0.1.2/16", "10.0.0.0/16"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"10.0.0.256", ""},
+		{"10.0.0.0/33", ""},
+		{"example.com", ""},
+	}
+	for _, test := range tests {
+		subnet, err := ParseSubnet(test.in)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("ParseSubnet(%q): got %v, want error",
+					test.in, subnet)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSubnet(%q): unexpected error: %v", test.in,
+				err)
+			continue
+		}
+		if subnet.String() != test.want {
+			t.Errorf("ParseSubnet(%q): got %v, want %v", test.in,
+				subnet, test.want)
+		}
+	}
+}
+
+// TestBanList ensures IP addresses and subnets are banned until their bans
+// expire and that the bans persist across ban lists using the same file.
+func TestBanList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "banlist.json")
+
+	mustParseSubnet := func(s string) *net.IPNet {
+		subnet, err := ParseSubnet(s)
+		if err != nil {
+			t.Fatalf("ParseSubnet(%q): unexpected error: %v", s, err)
+		}
+		return subnet
+	}
+
+	// Ensure a nil ban list does not ban any address.
+	var nilList *BanList
+	if nilList.IsBannedAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")}) {
+		t.Fatal("nil ban list banned address")
+	}
+
+	b := NewBanList(filename)
+	if err := b.Load(); err != nil {
+		t.Fatalf("Load: unexpected error without ban list file: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	for _, s := range []string{"10.0.0.1", "192.168.0.0/16", "2001:db8::/32"} {
+		if err := b.Ban(mustParseSubnet(s), future); err != nil {
+			t.Fatalf("Ban(%s): unexpected error: %v", s, err)
+		}
+	}
+	if err := b.Ban(mustParseSubnet("172.16.0.1"), time.Now()); err != nil {
+		t.Fatalf("Ban: unexpected error: %v", err)
+	}
+
+	// Ensure an existing ban is not shortened.
+	if err := b.Ban(mustParseSubnet("10.0.0.1"), time.Now()); err != nil {
+		t.Fatalf("Ban: unexpected error: %v", err)
+	}
+
+	checkBanned := func(b *BanList, want map[string]bool) {
+		t.Helper()
+		for addr, banned := range want {
+			tcpAddr := &net.TCPAddr{IP: net.ParseIP(addr), Port: 8333}
+			if got := b.IsBannedAddr(tcpAddr); got != banned {
+				t.Errorf("IsBannedAddr(%s): got %v, want %v", addr,
+					got, banned)
+			}
+		}
+	}
+	checkBanned(b, map[string]bool{
+		"10.0.0.1":        true,
+		"::ffff:10.0.0.1": true,
+		"10.0.0.2":        false,
+		"192.168.5.6":     true,
+		"2001:db8::5":     true,
+		"2001:db9::5":     false,
+		"172.16.0.1":      false,
+	})
+	if entries := b.Entries(); len(entries) != 3 {
+		t.Fatalf("Entries: got %d entries, want 3", len(entries))
+	}
+
+	// Ensure the bans are loaded from the file by a new ban list.
+	b = NewBanList(filename)
+	if err := b.Load(); err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	entries := b.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Entries: got %d loaded entries, want 3", len(entries))
+	}
+	if got := entries[0].Until.Unix(); got != future.Unix() {
+		t.Fatalf("Entries: got ban until %d, want %d", got,
+			future.Unix())
+	}
+	checkBanned(b, map[string]bool{"10.0.0.1": true, "192.168.5.6": true})
+
+	// Ensure removing a ban only removes the exact subnet.
+	removed, err := b.Unban(mustParseSubnet("192.168.5.6"))
+	if err != nil || removed {
+		t.Fatalf("Unban: got %v, %v, want false, nil", removed, err)
+	}
+	removed, err = b.Unban(mustParseSubnet("192.168.0.0/16"))
+	if err != nil || !removed {
+		t.Fatalf("Unban: got %v, %v, want true, nil", removed, err)
+	}
+	checkBanned(b, map[string]bool{"10.0.0.1": true, "192.168.5.6": false})
+
+	// Ensure clearing the bans is persisted.
+	if err := b.Clear(); err != nil {
+		t.Fatalf("Clear: unexpected error: %v", err)
+	}
+	b = NewBanList(filename)
+	if err := b.Load(); err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if entries := b.Entries(); len(entries) != 0 {
+		t.Fatalf("Entries: got %d entries after clear, want 0",
+			len(entries))
+	}
+}
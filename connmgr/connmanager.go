@@ -53,6 +53,18 @@ const (
 	ConnFailed
 )
 
+// TransportPolicy defines which transports are used for outbound connections.
+type TransportPolicy uint8
+
+// TransportPolicy can be either v1 only, prefer v2, or require v2.  When v2 is
+// preferred, connections attempt the encrypted v2 transport first and are
+// retried with the v1 protocol when the v2 handshake fails.
+const (
+	TransportV1 TransportPolicy = iota
+	TransportPreferV2
+	TransportRequireV2
+)
+
 // ConnReq is the connection request to a network address. If permanent, the
 // connection will be retried on disconnection.
 type ConnReq struct {
@@ -62,8 +74,25 @@ type ConnReq struct {
 
 	retryCount uint32
 	conn       net.Conn
+
+	// triedV1 is set once the connection has been retried with the v1
+	// protocol after its v2 transport handshake failed.  It is only used by
+	// the connection handler.
+	triedV1 bool
 	Addr       net.Addr
 	Permanent  bool
+
+	// V2Transport specifies whether the encrypted v2 transport is
+	// attempted for the connection.  It is set for the connection requests
+	// made automatically according to the configured transport policy and
+	// cleared when falling back to the v1 protocol.
+	V2Transport bool
+
+	// BlockRelayOnly specifies whether the connection only relays blocks.
+	// Transactions and addresses are not relayed to or from such peers,
+	// which makes the connections harder to discover and thus harder to
+	// eclipse.
+	BlockRelayOnly bool
 }
 
 // updateState updates the state of the connection request.
@@ -118,6 +147,15 @@ type Config struct {
 	// maintain. Defaults to 8.
 	TargetOutbound uint32
 
+	// TargetBlockRelayOnly is the number of block-relay-only outbound
+	// network connections to maintain in addition to TargetOutbound.
+	TargetBlockRelayOnly uint32
+
+	// Anchors are the addresses of the block-relay-only peers of a previous
+	// run.  They are connected to first when the connection manager starts
+	// and take up the block-relay-only connection slots.
+	Anchors []net.Addr
+
 	// RetryDuration is the duration to wait before retrying connection
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
@@ -136,6 +174,19 @@ type Config struct {
 
 	// Dial connects to the address on the named network. It cannot be nil.
 	Dial func(network, addr string) (net.Conn, error)
+
+	// ProxyDial connects to ProxyAddr addresses through the proxy for
+	// their network.  Dial is used for them when it is nil.
+	ProxyDial func(network, addr string) (net.Conn, error)
+
+	// TransportPolicy specifies which transports are used for the outbound
+	// connections made automatically.  Defaults to TransportV1.
+	TransportPolicy TransportPolicy
+
+	// BanList houses the banned IP addresses and subnets.  Inbound
+	// connections from them are closed as soon as they are accepted and
+	// outbound connections to them are not attempted.  It may be nil.
+	BanList *BanList
 }
 
 // handleConnected is used to queue a successful connection.
@@ -148,6 +199,10 @@ type handleConnected struct {
 type handleDisconnected struct {
 	id    uint64
 	retry bool
+
+	// fallbackV1 indicates the v2 transport handshake failed, so the
+	// connection is retried with the v1 protocol when allowed.
+	fallbackV1 bool
 }
 
 // handleFailed is used to remove a pending connection.
@@ -196,14 +251,27 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 				"-- retrying connection in: %v", maxFailedAttempts,
 				cm.cfg.RetryDuration)
 			time.AfterFunc(cm.cfg.RetryDuration, func() {
-				cm.NewConnReq()
+				cm.newConnReq(c.BlockRelayOnly)
 			})
 		} else {
-			go cm.NewConnReq()
+			go cm.newConnReq(c.BlockRelayOnly)
 		}
 	}
 }
 
+// outboundCount returns the number of the passed connections which are
+// block-relay-only when blockRelayOnly is set, or the number of the other
+// connections otherwise.
+func outboundCount(conns map[uint64]*ConnReq, blockRelayOnly bool) uint32 {
+	var count uint32
+	for _, c := range conns {
+		if c.BlockRelayOnly == blockRelayOnly {
+			count++
+		}
+	}
+	return count
+}
+
 // connHandler handles all connection related requests.  It must be run as a
 // goroutine.
 //
@@ -244,7 +312,32 @@ out:
 						go cm.cfg.OnDisconnection(connReq)
 					}
 
-					if uint32(len(conns)) < cm.cfg.TargetOutbound && msg.retry {
+					// Retry the connection with the v1
+					// protocol right away when the remote
+					// peer doesn't support the v2 transport
+					// and it isn't required.  This is only
+					// done once per connection request, any
+					// further retries are subject to the
+					// usual backoff.
+					if msg.fallbackV1 && connReq.V2Transport &&
+						!connReq.triedV1 &&
+						cm.cfg.TransportPolicy != TransportRequireV2 {
+
+						log.Debugf("Retrying connection to %v "+
+							"with the v1 protocol", connReq)
+						connReq.V2Transport = false
+						connReq.triedV1 = true
+						go cm.Connect(connReq)
+						continue
+					}
+
+					target := cm.cfg.TargetOutbound
+					if connReq.BlockRelayOnly {
+						target = cm.cfg.TargetBlockRelayOnly
+					}
+					count := outboundCount(conns,
+						connReq.BlockRelayOnly)
+					if count < target && msg.retry {
 						cm.handleFailedConn(connReq)
 					}
 				} else {
@@ -270,6 +363,12 @@ out:
 // NewConnReq creates a new connection request and connects to the
 // corresponding address.
 func (cm *ConnManager) NewConnReq() {
+	cm.newConnReq(false)
+}
+
+// newConnReq creates a new connection request which is block-relay-only when
+// requested and connects to the corresponding address.
+func (cm *ConnManager) newConnReq(blockRelayOnly bool) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
@@ -277,7 +376,10 @@ func (cm *ConnManager) NewConnReq() {
 		return
 	}
 
-	c := &ConnReq{}
+	c := &ConnReq{
+		V2Transport:    cm.cfg.TransportPolicy != TransportV1,
+		BlockRelayOnly: blockRelayOnly,
+	}
 	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
 
 	addr, err := cm.cfg.GetNewAddress()
@@ -300,8 +402,16 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 	if atomic.LoadUint64(&c.id) == 0 {
 		atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
 	}
+	if cm.cfg.BanList.IsBannedAddr(c.Addr) {
+		cm.requests <- handleFailed{c, fmt.Errorf("%v is banned", c.Addr)}
+		return
+	}
 	log.Debugf("Attempting to connect to %v", c)
-	conn, err := cm.cfg.Dial(c.Addr.Network(), c.Addr.String())
+	dial := cm.cfg.Dial
+	if _, ok := c.Addr.(*ProxyAddr); ok && cm.cfg.ProxyDial != nil {
+		dial = cm.cfg.ProxyDial
+	}
+	conn, err := dial(c.Addr.Network(), c.Addr.String())
 	if err != nil {
 		cm.requests <- handleFailed{c, err}
 	} else {
@@ -316,7 +426,18 @@ func (cm *ConnManager) Disconnect(id uint64) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
-	cm.requests <- handleDisconnected{id, true}
+	cm.requests <- handleDisconnected{id, true, false}
+}
+
+// DisconnectV2Failed disconnects the connection corresponding to the given
+// connection id after the v2 transport handshake failed.  The connection is
+// retried with the v1 protocol right away unless the transport policy requires
+// v2, in which case it is treated the same as Disconnect.
+func (cm *ConnManager) DisconnectV2Failed(id uint64) {
+	if atomic.LoadInt32(&cm.stop) != 0 {
+		return
+	}
+	cm.requests <- handleDisconnected{id, true, true}
 }
 
 // Remove removes the connection corresponding to the given connection
@@ -325,7 +446,7 @@ func (cm *ConnManager) Remove(id uint64) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
-	cm.requests <- handleDisconnected{id, false}
+	cm.requests <- handleDisconnected{id, false, false}
 }
 
 // listenHandler accepts incoming connections on a given listener.  It must be
@@ -341,6 +462,12 @@ func (cm *ConnManager) listenHandler(listener net.Listener) {
 			}
 			continue
 		}
+		if cm.cfg.BanList.IsBannedAddr(conn.RemoteAddr()) {
+			log.Debugf("Rejecting connection from banned address %v",
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
 		go cm.cfg.OnAccept(conn)
 	}
 
@@ -371,6 +498,23 @@ func (cm *ConnManager) Start() {
 	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
 		go cm.NewConnReq()
 	}
+
+	// Reconnect to the anchors before making up the remaining
+	// block-relay-only connections with new addresses.
+	anchors := cm.cfg.Anchors
+	if uint32(len(anchors)) > cm.cfg.TargetBlockRelayOnly {
+		anchors = anchors[:cm.cfg.TargetBlockRelayOnly]
+	}
+	for _, addr := range anchors {
+		go cm.Connect(&ConnReq{
+			Addr:           addr,
+			V2Transport:    cm.cfg.TransportPolicy != TransportV1,
+			BlockRelayOnly: true,
+		})
+	}
+	for i := uint32(len(anchors)); i < cm.cfg.TargetBlockRelayOnly; i++ {
+		go cm.newConnReq(true)
+	}
 }
 
 // Wait blocks until the connection manager halts gracefully.
@@ -179,6 +179,59 @@ func TestConnectMode(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestProxyDial ensures connections to proxy addresses are made with the
+// configured proxy dialer while all other connections use the regular one.
+func TestProxyDial(t *testing.T) {
+	connected := make(chan net.Conn)
+	proxyDialed := make(chan string, 1)
+	cmgr, err := New(&Config{
+		Dial: mockDialer,
+		ProxyDial: func(network, addr string) (net.Conn, error) {
+			proxyDialed <- addr
+			return mockDialer(network, addr)
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- conn
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	defer cmgr.Stop()
+
+	onion := &ProxyAddr{
+		Host: "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion",
+		Port: 9657,
+	}
+	cmgr.Connect(&ConnReq{Addr: onion})
+	conn := <-connected
+	select {
+	case addr := <-proxyDialed:
+		if addr != onion.String() {
+			t.Fatalf("proxy dial: got address %s, want %s", addr,
+				onion)
+		}
+	default:
+		t.Fatal("proxy address not dialed through the proxy")
+	}
+	if conn.RemoteAddr().String() != onion.String() {
+		t.Fatalf("proxy dial: got remote address %s, want %s",
+			conn.RemoteAddr(), onion)
+	}
+
+	cmgr.Connect(&ConnReq{Addr: &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}})
+	<-connected
+	select {
+	case addr := <-proxyDialed:
+		t.Fatalf("proxy dial: unexpected dial to %s", addr)
+	default:
+	}
+}
+
 // TestTargetOutbound tests the target number of outbound connections.
 //
 // We wait until all connections are established, then test they there are the
@@ -216,6 +269,70 @@ func TestTargetOutbound(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestBlockRelayOnly tests that the target number of block-relay-only
+// connections is maintained in addition to the target outbound connections and
+// that the anchors are connected to first.
+func TestBlockRelayOnly(t *testing.T) {
+	anchor := &net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555}
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		RetryDuration:        time.Millisecond,
+		TargetOutbound:       2,
+		TargetBlockRelayOnly: 2,
+		Anchors:              []net.Addr{anchor},
+		Dial:                 mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+
+	var blockRelayOnly []*ConnReq
+	var gotAnchor bool
+	for i := 0; i < 4; i++ {
+		c := <-connected
+		if !c.BlockRelayOnly {
+			continue
+		}
+		blockRelayOnly = append(blockRelayOnly, c)
+		if c.Addr.String() == anchor.String() {
+			gotAnchor = true
+		}
+	}
+	if len(blockRelayOnly) != 2 {
+		t.Fatalf("block relay only: got %d connections, want 2",
+			len(blockRelayOnly))
+	}
+	if !gotAnchor {
+		t.Fatal("block relay only: anchor not connected")
+	}
+	select {
+	case c := <-connected:
+		t.Fatalf("block relay only: got unexpected connection - %v",
+			c.Addr)
+	case <-time.After(time.Millisecond):
+	}
+
+	// Ensure a disconnected block-relay-only connection is replaced by
+	// another one.
+	cmgr.Disconnect(blockRelayOnly[0].ID())
+	c := <-connected
+	if !c.BlockRelayOnly || c == blockRelayOnly[0] {
+		t.Fatalf("block relay only: disconnected connection replaced "+
+			"by %v (block relay only %v)", c, c.BlockRelayOnly)
+	}
+	cmgr.Stop()
+}
+
 // TestRetryPermanent tests that permanent connection requests are retried.
 //
 // We make a permanent connection request using Connect, disconnect it using
@@ -299,6 +416,75 @@ func TestRetryPermanent(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestV2TransportFallback tests that connections made automatically attempt
+// the v2 transport according to the transport policy and that connections whose
+// v2 handshake failed are retried with the v1 protocol right away, only once,
+// unless v2 is required.
+func TestV2TransportFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       TransportPolicy
+		wantV2       bool
+		wantFallback bool
+	}{
+		{"v1 only", TransportV1, false, false},
+		{"prefer v2", TransportPreferV2, true, true},
+		{"require v2", TransportRequireV2, true, false},
+	}
+
+	for _, test := range tests {
+		connected := make(chan *ConnReq)
+		cmgr, err := New(&Config{
+			TargetOutbound: 1,
+			Dial:           mockDialer,
+			GetNewAddress: func() (net.Addr, error) {
+				return &net.TCPAddr{
+					IP:   net.ParseIP("127.0.0.1"),
+					Port: 18555,
+				}, nil
+			},
+			OnConnection: func(c *ConnReq, conn net.Conn) {
+				connected <- c
+			},
+			TransportPolicy: test.policy,
+		})
+		if err != nil {
+			t.Fatalf("%s: New error: %v", test.name, err)
+		}
+		cmgr.Start()
+
+		cr := <-connected
+		if cr.V2Transport != test.wantV2 {
+			t.Fatalf("%s: unexpected v2 transport flag - got %v, "+
+				"want %v", test.name, cr.V2Transport, test.wantV2)
+		}
+
+		// Ensure the same connection request is retried with the v1
+		// protocol when falling back and a new one is made otherwise.
+		cmgr.DisconnectV2Failed(cr.ID())
+		gotConnReq := <-connected
+		if gotFallback := gotConnReq == cr; gotFallback != test.wantFallback {
+			t.Fatalf("%s: unexpected fallback - got %v, want %v",
+				test.name, gotFallback, test.wantFallback)
+		}
+		if test.wantFallback && gotConnReq.V2Transport {
+			t.Fatalf("%s: v2 transport attempted after fallback",
+				test.name)
+		}
+
+		// Ensure a connection request is only retried with the v1
+		// protocol once, even if the v2 handshake is reported as
+		// failed again.
+		gotConnReq.V2Transport = true
+		cmgr.DisconnectV2Failed(gotConnReq.ID())
+		if retry := <-connected; retry == gotConnReq && test.wantFallback {
+			t.Fatalf("%s: connection retried with the v1 protocol "+
+				"twice", test.name)
+		}
+		cmgr.Stop()
+	}
+}
+
 // TestMaxRetryDuration tests the maximum retry duration.
 //
 // We have a timed dialer which initially returns err but after RetryDuration
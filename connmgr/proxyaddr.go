@@ -0,0 +1,33 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"net"
+	"strconv"
+)
+
+// ProxyAddr implements the net.Addr interface and represents the address of a
+// peer on an overlay network, such as a Tor hidden service or an I2P
+// destination, which is identified by a host name that can not be resolved to
+// an IP address locally.  Connections to it are made by passing the host name
+// to the proxy for its network with the ProxyDial function of the connection
+// manager configuration.
+type ProxyAddr struct {
+	Host string
+	Port uint16
+}
+
+// Network returns the name of the network the address is dialed on.  This is
+// part of the net.Addr interface implementation.
+func (a *ProxyAddr) Network() string {
+	return "tcp"
+}
+
+// String returns the address in the host:port form expected by proxies.  This
+// is part of the net.Addr interface implementation.
+func (a *ProxyAddr) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(int(a.Port)))
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// torControlTimeout is the maximum amount of time allowed to connect
+	// to the Tor control port and for each command to complete.
+	torControlTimeout = 30 * time.Second
+
+	// torControlOK is the reply code of successful Tor control commands.
+	torControlOK = 250
+
+	// torCookieLen is the length of the Tor control port authentication
+	// cookie.
+	torCookieLen = 32
+
+	// torSafeCookieServerKey and torSafeCookieClientKey are the HMAC keys
+	// used to prove knowledge of the authentication cookie with the
+	// SAFECOOKIE authentication method.
+	torSafeCookieServerKey = "Tor safe cookie authentication server-to-controller hash"
+	torSafeCookieClientKey = "Tor safe cookie authentication controller-to-server hash"
+
+	// TorNewOnionKey is the key type passed to AddOnion to ask Tor to
+	// generate a new Tor v3 onion service key.
+	TorNewOnionKey = "NEW:ED25519-V3"
+)
+
+var (
+	// ErrTorNoAuthMethod indicates the Tor control port does not offer an
+	// authentication method which can be used with the provided
+	// credentials.
+	ErrTorNoAuthMethod = errors.New("no supported tor control " +
+		"authentication method")
+
+	// ErrTorInvalidServerHash indicates the Tor control port did not prove
+	// knowledge of the authentication cookie during SAFECOOKIE
+	// authentication.
+	ErrTorInvalidServerHash = errors.New("invalid tor control server hash")
+)
+
+// TorControl is a client for the Tor control protocol.  It is used to create
+// onion services which forward connections to a local listener.  Onion services
+// created by the client are removed by Tor when the connection to the control
+// port is closed.
+type TorControl struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// DialTorControl connects to the Tor control port at the passed address.  The
+// returned client must be authenticated with Authenticate before any other
+// commands are issued.
+func DialTorControl(addr string) (*TorControl, error) {
+	conn, err := net.DialTimeout("tcp", addr, torControlTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &TorControl{conn: conn, text: textproto.NewConn(conn)}, nil
+}
+
+// Close closes the connection to the Tor control port which also removes all
+// onion services created with it.
+func (c *TorControl) Close() error {
+	return c.text.Close()
+}
+
+// command sends the passed command to the Tor control port and returns the
+// lines of its reply, without the reply codes, when it succeeds.
+func (c *TorControl) command(format string, args ...interface{}) ([]string, error) {
+	c.conn.SetDeadline(time.Now().Add(torControlTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return nil, err
+	}
+	_, msg, err := c.text.ReadResponse(torControlOK)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(msg, "\n"), nil
+}
+
+// parseTorReplyArgs parses the space separated KEY=VALUE arguments of a Tor
+// control reply line where values may be quoted strings.
+func parseTorReplyArgs(line string) map[string]string {
+	args := make(map[string]string)
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " ")
+		eq := strings.IndexByte(line, '=')
+		if eq == -1 {
+			break
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		// Quoted values run until the first unescaped quote.
+		if strings.HasPrefix(line, "\"") {
+			end := 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				break
+			}
+			value, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				break
+			}
+			args[key] = value
+			line = line[end+1:]
+			continue
+		}
+
+		end := strings.IndexByte(line, ' ')
+		if end == -1 {
+			end = len(line)
+		}
+		args[key] = line[:end]
+		line = line[end:]
+	}
+	return args
+}
+
+// torQuote returns the passed string as a quoted string as expected by the Tor
+// control protocol.
+func torQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// Authenticate authenticates with the Tor control port.  The passed password
+// is used when it is not empty.  Otherwise, the authentication cookie is read
+// from the file advertised by Tor and used with the SAFECOOKIE method when it
+// is available, falling back to the COOKIE method.  Control ports which do not
+// require authentication are also supported.
+func (c *TorControl) Authenticate(password string) error {
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var methods map[string]bool
+	var cookieFile string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		args := parseTorReplyArgs(line[len("AUTH "):])
+		methods = make(map[string]bool)
+		for _, method := range strings.Split(args["METHODS"], ",") {
+			methods[method] = true
+		}
+		cookieFile = args["COOKIEFILE"]
+	}
+
+	switch {
+	case methods["NULL"]:
+		_, err = c.command("AUTHENTICATE")
+		return err
+
+	case password != "" && methods["HASHEDPASSWORD"]:
+		_, err = c.command("AUTHENTICATE %s", torQuote(password))
+		return err
+
+	case password == "" && methods["SAFECOOKIE"]:
+		cookie, err := readTorCookie(cookieFile)
+		if err != nil {
+			return err
+		}
+		return c.authenticateSafeCookie(cookie)
+
+	case password == "" && methods["COOKIE"]:
+		cookie, err := readTorCookie(cookieFile)
+		if err != nil {
+			return err
+		}
+		_, err = c.command("AUTHENTICATE %x", cookie)
+		return err
+	}
+	return ErrTorNoAuthMethod
+}
+
+// readTorCookie reads the Tor control port authentication cookie from the
+// passed file.
+func readTorCookie(cookieFile string) ([]byte, error) {
+	if cookieFile == "" {
+		return nil, errors.New("tor control port did not provide a " +
+			"cookie file")
+	}
+	cookie, err := ioutil.ReadFile(cookieFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(cookie) != torCookieLen {
+		return nil, fmt.Errorf("tor authentication cookie %s has "+
+			"length %d, want %d", cookieFile, len(cookie),
+			torCookieLen)
+	}
+	return cookie, nil
+}
+
+// torSafeCookieHash returns the HMAC-SHA256 of the passed cookie and nonces
+// with the passed key as used by the SAFECOOKIE authentication method.
+func torSafeCookieHash(key string, cookie, clientNonce, serverNonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(cookie)
+	mac.Write(clientNonce)
+	mac.Write(serverNonce)
+	return mac.Sum(nil)
+}
+
+// authenticateSafeCookie authenticates with the Tor control port using the
+// SAFECOOKIE method which, unlike the COOKIE method, does not reveal the
+// cookie to a control port that does not know it.
+func (c *TorControl) authenticateSafeCookie(cookie []byte) error {
+	var clientNonce [32]byte
+	if _, err := rand.Read(clientNonce[:]); err != nil {
+		return err
+	}
+	lines, err := c.command("AUTHCHALLENGE SAFECOOKIE %x", clientNonce[:])
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(lines[0], "AUTHCHALLENGE ") {
+		return fmt.Errorf("unexpected tor control reply %q", lines[0])
+	}
+	args := parseTorReplyArgs(lines[0][len("AUTHCHALLENGE "):])
+	serverHash, err := hex.DecodeString(args["SERVERHASH"])
+	if err != nil {
+		return err
+	}
+	serverNonce, err := hex.DecodeString(args["SERVERNONCE"])
+	if err != nil {
+		return err
+	}
+
+	wantHash := torSafeCookieHash(torSafeCookieServerKey, cookie,
+		clientNonce[:], serverNonce)
+	if !hmac.Equal(serverHash, wantHash) {
+		return ErrTorInvalidServerHash
+	}
+	clientHash := torSafeCookieHash(torSafeCookieClientKey, cookie,
+		clientNonce[:], serverNonce)
+	_, err = c.command("AUTHENTICATE %x", clientHash)
+	return err
+}
+
+// AddOnion creates an onion service which forwards connections to the passed
+// virtual port of the service to the passed target address.  The key is either
+// TorNewOnionKey to create a service with a new key, or a key returned by a
+// previous call to recreate the same service.  It returns the service ID, which
+// is the onion address without the .onion suffix, along with the key of the
+// service.  The key is only returned when a new one was generated.
+func (c *TorControl) AddOnion(key string, virtPort uint16, target string) (string, string, error) {
+	lines, err := c.command("ADD_ONION %s Port=%d,%s", key, virtPort,
+		target)
+	if err != nil {
+		return "", "", err
+	}
+	var serviceID, privateKey string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			serviceID = line[len("ServiceID="):]
+		case strings.HasPrefix(line, "PrivateKey="):
+			privateKey = line[len("PrivateKey="):]
+		}
+	}
+	if serviceID == "" {
+		return "", "", errors.New("tor control port did not return " +
+			"an onion service ID")
+	}
+	return serviceID, privateKey, nil
+}
+
+// DelOnion removes the onion service with the passed service ID.
+func (c *TorControl) DelOnion(serviceID string) error {
+	_, err := c.command("DEL_ONION %s", serviceID)
+	return err
+}
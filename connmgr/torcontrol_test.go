@@ -0,0 +1,242 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTorControl is a fake Tor control port which supports the commands used
+// by TorControl.
+type fakeTorControl struct {
+	listener   net.Listener
+	methods    string
+	cookieFile string
+	cookie     []byte
+
+	// onions is sent the commands which add and remove onion services.
+	onions chan string
+}
+
+// newFakeTorControl starts a fake Tor control port which offers the passed
+// authentication methods.
+func newFakeTorControl(t *testing.T, methods string) *fakeTorControl {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: unexpected error: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "faketorcontrol")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error: %v", err)
+	}
+	f := &fakeTorControl{
+		listener:   listener,
+		methods:    methods,
+		cookieFile: filepath.Join(dir, "control_auth_cookie"),
+		cookie:     bytes.Repeat([]byte{0x5a}, torCookieLen),
+		onions:     make(chan string, 2),
+	}
+	if err := ioutil.WriteFile(f.cookieFile, f.cookie, 0600); err != nil {
+		t.Fatalf("WriteFile: unexpected error: %v", err)
+	}
+	go f.serve()
+	return f
+}
+
+// close stops the fake Tor control port and removes its cookie file.
+func (f *fakeTorControl) close() {
+	f.listener.Close()
+	os.RemoveAll(filepath.Dir(f.cookieFile))
+}
+
+// serve handles the commands of a single control port connection.
+func (f *fakeTorControl) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	var authenticated bool
+	var clientNonce, serverNonce []byte
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, args := line, ""
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			cmd, args = line[:i], line[i+1:]
+		}
+		if !authenticated && cmd != "PROTOCOLINFO" &&
+			cmd != "AUTHCHALLENGE" && cmd != "AUTHENTICATE" {
+
+			text.PrintfLine("514 Authentication required.")
+			return
+		}
+
+		switch cmd {
+		case "PROTOCOLINFO":
+			text.PrintfLine("250-PROTOCOLINFO 1")
+			text.PrintfLine("250-AUTH METHODS=%s COOKIEFILE=%q",
+				f.methods, f.cookieFile)
+			text.PrintfLine("250-VERSION Tor=\"0.4.8.9\"")
+			text.PrintfLine("250 OK")
+
+		case "AUTHCHALLENGE":
+			clientNonce, _ = hex.DecodeString(strings.TrimPrefix(args,
+				"SAFECOOKIE "))
+			serverNonce = bytes.Repeat([]byte{0x01}, 32)
+			serverHash := torSafeCookieHash(torSafeCookieServerKey,
+				f.cookie, clientNonce, serverNonce)
+			text.PrintfLine("250 AUTHCHALLENGE SERVERHASH=%x "+
+				"SERVERNONCE=%x", serverHash, serverNonce)
+
+		case "AUTHENTICATE":
+			var want string
+			switch {
+			case strings.Contains(f.methods, "NULL"):
+			case strings.Contains(f.methods, "HASHEDPASSWORD"):
+				want = `"pass \"word\""`
+			case strings.Contains(f.methods, "SAFECOOKIE"):
+				want = hex.EncodeToString(torSafeCookieHash(
+					torSafeCookieClientKey, f.cookie,
+					clientNonce, serverNonce))
+			default:
+				want = hex.EncodeToString(f.cookie)
+			}
+			if args != want {
+				text.PrintfLine("515 Authentication failed.")
+				return
+			}
+			authenticated = true
+			text.PrintfLine("250 OK")
+
+		case "ADD_ONION":
+			f.onions <- line
+			text.PrintfLine("250-ServiceID=exampleonion")
+			if strings.HasPrefix(args, TorNewOnionKey+" ") {
+				text.PrintfLine("250-PrivateKey=ED25519-V3:key")
+			}
+			text.PrintfLine("250 OK")
+
+		case "DEL_ONION":
+			f.onions <- line
+			text.PrintfLine("250 OK")
+
+		default:
+			text.PrintfLine("510 Unrecognized command %q", cmd)
+		}
+	}
+}
+
+// TestTorControl ensures the Tor control client authenticates with each of the
+// supported methods and adds and removes onion services.
+func TestTorControl(t *testing.T) {
+	tests := []struct {
+		methods  string
+		password string
+	}{
+		{methods: "NULL"},
+		{methods: "HASHEDPASSWORD", password: "pass \"word\""},
+		{methods: "COOKIE,SAFECOOKIE"},
+		{methods: "COOKIE"},
+	}
+
+	for _, test := range tests {
+		f := newFakeTorControl(t, test.methods)
+		c, err := DialTorControl(f.listener.Addr().String())
+		if err != nil {
+			f.close()
+			t.Fatalf("%s: DialTorControl: unexpected error: %v",
+				test.methods, err)
+		}
+		if err := c.Authenticate(test.password); err != nil {
+			t.Fatalf("%s: Authenticate: unexpected error: %v",
+				test.methods, err)
+		}
+
+		// Ensure a new key is returned for a new onion service but not
+		// when the service is recreated from an existing key.
+		for _, key := range []string{TorNewOnionKey, "ED25519-V3:key"} {
+			serviceID, privateKey, err := c.AddOnion(key, 9657,
+				"127.0.0.1:19657")
+			if err != nil {
+				t.Fatalf("%s: AddOnion: unexpected error: %v",
+					test.methods, err)
+			}
+			wantCmd := fmt.Sprintf("ADD_ONION %s "+
+				"Port=9657,127.0.0.1:19657", key)
+			if cmd := <-f.onions; cmd != wantCmd {
+				t.Fatalf("%s: AddOnion: sent %q, want %q",
+					test.methods, cmd, wantCmd)
+			}
+			wantKey := ""
+			if key == TorNewOnionKey {
+				wantKey = "ED25519-V3:key"
+			}
+			if serviceID != "exampleonion" || privateKey != wantKey {
+				t.Fatalf("%s: AddOnion: got service %s with key "+
+					"%q, want exampleonion with key %q",
+					test.methods, serviceID, privateKey,
+					wantKey)
+			}
+		}
+
+		if err := c.DelOnion("exampleonion"); err != nil {
+			t.Fatalf("%s: DelOnion: unexpected error: %v",
+				test.methods, err)
+		}
+		if cmd := <-f.onions; cmd != "DEL_ONION exampleonion" {
+			t.Fatalf("%s: DelOnion: sent %q", test.methods, cmd)
+		}
+		c.Close()
+		f.close()
+	}
+}
+
+// TestTorControlAuthErrors ensures authentication fails when the control port
+// rejects the credentials or does not offer a usable method.
+func TestTorControlAuthErrors(t *testing.T) {
+	tests := []struct {
+		methods  string
+		password string
+	}{
+		// Password authentication with the wrong password.
+		{methods: "HASHEDPASSWORD", password: "wrong"},
+
+		// Password authentication without a password.
+		{methods: "HASHEDPASSWORD"},
+
+		// No supported methods.
+		{methods: "UNKNOWN"},
+	}
+
+	for _, test := range tests {
+		f := newFakeTorControl(t, test.methods)
+		c, err := DialTorControl(f.listener.Addr().String())
+		if err != nil {
+			f.close()
+			t.Fatalf("%s: DialTorControl: unexpected error: %v",
+				test.methods, err)
+		}
+		if err := c.Authenticate(test.password); err == nil {
+			t.Errorf("%s: Authenticate with password %q succeeded",
+				test.methods, test.password)
+		}
+		c.Close()
+		f.close()
+	}
+}
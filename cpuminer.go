@@ -7,20 +7,20 @@
 package main
 
 import (
-	"container/list"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/CommerciumBlockchain/cmmd/blockchain"
-	equihash "github.com/CommerciumBlockchain/cmmd/cequihash"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
 	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/equihash"
 	"github.com/CommerciumBlockchain/cmmd/mining"
 	"github.com/CommerciumBlockchain/cmmd/wire"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 )
 
 const (
@@ -31,15 +31,17 @@ const (
 	// transaction can be.
 	maxExtraNonce = ^uint64(0) // 2^64 - 1
 
-	// hpsUpdateSecs is the number of seconds to wait in between each
-	// update to the hashes per second monitor.
-	hpsUpdateSecs = 60
+	// spsUpdateSecs is the number of seconds to wait in between each
+	// update to the solutions per second monitor.
+	spsUpdateSecs = 60
+
+	// spsWindowSecs is the duration of the rolling window, in seconds, over
+	// which the solutions per second rate is measured.
+	spsWindowSecs = 60 * 60
 
 	// hashUpdateSec is the number of seconds each worker waits in between
-	// notifying the speed monitor with how many hashes have been completed
-	// while they are actively searching for a solution.  This is done to
-	// reduce the amount of syncs between the workers that must be done to
-	// keep track of the hashes per second.
+	// checks for stale work while they are actively searching for a
+	// solution.
 	hashUpdateSecs = 15
 
 	// maxSimnetToMine is the maximum number of blocks to mine on HEAD~1
@@ -67,80 +69,89 @@ var (
 // system which is typically sufficient.
 type CPUMiner struct {
 	sync.Mutex
-	policy            *mining.Policy
-	txSource          mining.TxSource
-	server            *server
-	numWorkers        uint32
-	started           bool
-	discreteMining    bool
-	miningAddr        *cmmutil.Address
-	submitBlockLock   sync.Mutex
-	wg                sync.WaitGroup
-	workerWg          sync.WaitGroup
-	updateNumWorkers  chan struct{}
-	queryHashesPerSec chan float64
-	updateHashes      chan uint64
-	speedMonitorQuit  chan struct{}
-	quit              chan struct{}
+	policy               *mining.Policy
+	txSource             mining.TxSource
+	server               *server
+	numWorkers           uint32
+	started              bool
+	discreteMining       bool
+	miningAddr           *cmmutil.Address
+	submitBlockLock      sync.Mutex
+	wg                   sync.WaitGroup
+	workerWg             sync.WaitGroup
+	updateNumWorkers     chan struct{}
+	querySolutionsPerSec chan float64
+	updateSolutions      chan uint64
+	speedMonitorQuit     chan struct{}
+	quit                 chan struct{}
+
+	// extraNonceOffset is the starting extra nonce shared by all workers.
+	// It is randomized when background mining starts and is zero for
+	// discrete mining so that GenerateNBlocks is predictable.
+	extraNonceOffset uint64
+
+	// tipCtx is canceled and replaced whenever the block manager signals a
+	// new chain tip so that in-flight solves on stale templates abort
+	// promptly.
+	tipMtx    sync.Mutex
+	tipCtx    context.Context
+	tipCancel context.CancelFunc
+
+	// job is the block template currently shared by all of the background
+	// mining workers.  It is protected by jobMtx.
+	jobMtx sync.Mutex
+	job    *miningJob
 
 	// This is a map that keeps track of how many blocks have
 	// been mined on each parent by the CPUMiner. It is only
 	// for use in simulation networks, to diminish memory
-	// exhaustion. It should not race because it's only
-	// accessed in a single threaded loop below.
-	minedOnParents map[chainhash.Hash]uint8
+	// exhaustion.  It is protected by minedOnParentsMtx since
+	// solutions are submitted from multiple workers.
+	minedOnParentsMtx sync.Mutex
+	minedOnParents    map[chainhash.Hash]uint8
 }
 
-// speedMonitor handles tracking the number of hashes per second the mining
-// process is performing.  It must be run as a goroutine.
+// speedMonitor handles tracking the number of Equihash solutions per second the
+// mining process is finding.  It must be run as a goroutine.
 func (m *CPUMiner) speedMonitor() {
 	minrLog.Tracef("CPU miner speed monitor started")
 
-	var updateCount uint64
-	var totalHashes uint64
-	var hashesCompletedInLastHour list.List
-	var hashesPerSec float64
-	ticker := time.NewTicker(time.Second * hpsUpdateSecs)
+	// The solutions found are tracked in per-update buckets which form a
+	// rolling window of spsWindowSecs.
+	var buckets [spsWindowSecs / spsUpdateSecs]uint64
+	var curBucket, numBuckets int
+	var totalSolutions uint64
+	var solutionsPerSec float64
+	ticker := time.NewTicker(time.Second * spsUpdateSecs)
 	defer ticker.Stop()
 
 out:
 	for {
 		select {
-		// Periodic updates from the workers with how many hashes they have performed.
-		case numHashes := <-m.updateHashes:
-			totalHashes += numHashes
-			for i := uint64(0); i < numHashes; i++ {
-				hashesCompletedInLastHour.PushBack(time.Now().Unix())
+		// Updates from the workers with how many solutions they have found.
+		case numSolutions := <-m.updateSolutions:
+			totalSolutions += numSolutions
+			buckets[curBucket] += numSolutions
+
+		case <-ticker.C: // Time to update the solutions per second.
+			if numBuckets < len(buckets) {
+				numBuckets++
 			}
-
-		case <-ticker.C: // Time to update the hashes per second.
-			var toRemove []*list.Element
-			now := time.Now()
-			for e := hashesCompletedInLastHour.Front(); e != nil; e = e.Next() {
-				if now.Sub(time.Unix(e.Value.(int64), 0)).Hours() > 1 {
-					toRemove = append(toRemove, e)
-				} else {
-					break
-				}
+			var windowSolutions uint64
+			for _, count := range buckets {
+				windowSolutions += count
 			}
-
-			for _, e := range toRemove {
-				hashesCompletedInLastHour.Remove(e)
+			solutionsPerSec = float64(windowSolutions) /
+				float64(numBuckets*spsUpdateSecs)
+			if solutionsPerSec != 0 {
+				minrLog.Infof("Solution rate: %.4f Sol/s, solutions "+
+					"found: %d", solutionsPerSec, totalSolutions)
 			}
 
-			updateCount += 1
-			startedSecsAgo := hpsUpdateSecs * updateCount
-			if float64(startedSecsAgo) < time.Hour.Seconds() {
-				hashesPerSec = float64(hashesCompletedInLastHour.Len()) / float64(startedSecsAgo)
-			} else {
-				hashesPerSec = float64(hashesCompletedInLastHour.Len()) / time.Hour.Seconds()
-			}
-			hashesPerHour := hashesPerSec * time.Hour.Seconds()
-			if hashesPerHour != 0 {
-				minrLog.Infof("Hash speed: %.2f hashes/hour, hashes completed: %d", hashesPerHour, totalHashes)
-			}
+			curBucket = (curBucket + 1) % len(buckets)
+			buckets[curBucket] = 0
 
-		case m.queryHashesPerSec <- hashesPerSec: // Request for the number of hashes per second.
+		case m.querySolutionsPerSec <- solutionsPerSec: // Request for the number of solutions per second.
 			// Nothing to do.
 
 		case <-m.speedMonitorQuit:
@@ -200,52 +211,120 @@ func (m *CPUMiner) submitBlock(block *cmmutil.Block) bool {
 	return true
 }
 
+// searchSpace identifies the portion of the extra nonce space searched by a
+// single worker.  The extra nonce space starting at extraNonceOffset is split
+// into numWorkers equally sized ranges and worker i tests every nonce for each
+// extra nonce of range i, so workers solving the same template never test the
+// same header and the assignment of work to workers is deterministic.
+type searchSpace struct {
+	worker           uint32
+	numWorkers       uint32
+	extraNonceOffset uint64
+}
+
+// extraNonces returns the first extra nonce of the range searched by the
+// worker along with the number of extra nonces in the range.
+//
+// Note that the offset is added relying on the fact that overflow will wrap
+// around 0 as provided by the Go spec.
+func (s searchSpace) extraNonces() (uint64, uint64) {
+	numWorkers := uint64(s.numWorkers)
+	if numWorkers == 0 {
+		numWorkers = 1
+	}
+	size := maxExtraNonce / numWorkers
+	return s.extraNonceOffset + uint64(s.worker)*size, size
+}
+
+// miningJob is a block template shared by all of the background mining
+// workers along with the flag which ensures only one of them submits a
+// solution for it.  Every worker solves its own copy of the block since the
+// header is modified while searching.
+type miningJob struct {
+	block     *wire.MsgBlock
+	ctx       context.Context
+	cancel    context.CancelFunc
+	submitted int32
+}
+
+// stale returns whether the job should no longer be solved, either because a
+// solution was already claimed or because it was replaced or the chain tip
+// changed.
+func (j *miningJob) stale() bool {
+	return j.ctx.Err() != nil || atomic.LoadInt32(&j.submitted) != 0
+}
+
+// retire cancels the job and prevents any solutions for it from being
+// submitted.
+func (j *miningJob) retire() {
+	atomic.StoreInt32(&j.submitted, 1)
+	j.cancel()
+}
+
 type solutionValidatorData struct {
-	solved   *bool
-	exiting  *bool
-	msgBlock *wire.MsgBlock
-	miner    *CPUMiner
-	quit     chan struct{}
+	ctx       context.Context
+	solved    *bool
+	exiting   *bool
+	submitted *int32
+	msgBlock  *wire.MsgBlock
+	miner     *CPUMiner
+	quit      chan struct{}
 }
 
-// returns 1 when mining should be stopped for any reason
-func (data solutionValidatorData) Validate(solution unsafe.Pointer) int {
-	if uintptr(solution) == 0 {
+// validate is called by the Equihash solver with every solution found and
+// periodically with a nil solution.  It returns true when mining should be
+// stopped for any reason.
+func (data solutionValidatorData) validate(solution []byte) bool {
+	if solution == nil {
 		if *data.exiting {
 			minrLog.Infof("Shutdown is pending. Bailing out")
-			return 1
+			return true
 		}
 		select {
 		case <-data.quit:
 			minrLog.Infof("Miner is stopping")
 			*data.exiting = true
-			return 1
+			return true
+		case <-data.ctx.Done():
+			minrLog.Debugf("Aborting solve of stale block template")
+			*data.exiting = true
+			return true
 		default:
 		}
 
-		return 0
+		return false
 	}
 
-	data.miner.updateHashes <- 1
+	data.miner.updateSolutions <- 1
 
 	bestBlock, _ := data.miner.server.blockManager.chainState.Best()
 	if data.msgBlock.Header.PrevBlock != *bestBlock {
 		*data.exiting = true
-		return 1
+		return true
 	}
 
-	bytes := equihash.ExtractSolution(data.miner.server.chainParams.N, data.miner.server.chainParams.K, solution)
-	copy(data.msgBlock.Header.EquihashSolution[:], bytes)
+	copy(data.msgBlock.Header.EquihashSolution[:], solution)
 	hash := data.msgBlock.Header.BlockHash()
 
 	if blockchain.HashToBig(&hash).Cmp(blockchain.CompactToBig(data.msgBlock.Header.Bits)) <= 0 {
-		data.miner.submitBlock(cmmutil.NewBlock(data.msgBlock))
-		data.miner.minedOnParents[data.msgBlock.Header.PrevBlock]++
-		*data.solved = true
-		return 1
+		// Only the first worker to solve a shared template submits it.
+		// Solutions for retired templates are never submitted.
+		if !atomic.CompareAndSwapInt32(data.submitted, 0, 1) {
+			*data.exiting = true
+			return true
+		}
+		if data.miner.submitBlock(cmmutil.NewBlock(data.msgBlock)) {
+			data.miner.minedOnParentsMtx.Lock()
+			data.miner.minedOnParents[data.msgBlock.Header.PrevBlock]++
+			data.miner.minedOnParentsMtx.Unlock()
+			*data.solved = true
+		} else {
+			*data.exiting = true
+		}
+		return true
 	}
 
-	return 0
+	return false
 }
 
 // solveAndSubmitBlock attempts to find some combination of a nonce, extra nonce, and
@@ -254,20 +333,20 @@ func (data solutionValidatorData) Validate(solution unsafe.Pointer) int {
 // updated periodically and the passed block is modified with all tweaks
 // during this process. This means that when the function returns true, the block is submitted.
 //
+// Only the portion of the extra nonce space described by the passed search
+// space is searched.  The submitted flag is shared by all workers solving the same
+// template and ensures only one of them submits a solution.
+//
 // This function will return early with false when conditions that trigger a
 // stale block such as a new block showing up or periodically when there are
 // new transactions and enough time has elapsed without finding a solution.
-func (m *CPUMiner) solveAndSubmitBlock(msgBlock *wire.MsgBlock, ticker *time.Ticker, quit chan struct{}) bool {
-	// Choose a random extra nonce offset for this block template and
-	// worker.
-	enOffset, err := wire.RandomUint64()
-	if err != nil {
-		minrLog.Errorf("Unexpected error while generating random extra nonce offset: %v", err)
-		enOffset = 0
-	}
+// In-flight solves are aborted as soon as the passed context is canceled.
+func (m *CPUMiner) solveAndSubmitBlock(ctx context.Context, msgBlock *wire.MsgBlock, ticker *time.Ticker,
+	quit chan struct{}, space searchSpace, submitted *int32) bool {
 
 	// Create a couple of convenience variables.
 	header := &msgBlock.Header
+	firstExtraNonce, numExtraNonces := space.extraNonces()
 
 	// Initial state.
 	lastGenerated := time.Now()
@@ -275,29 +354,34 @@ func (m *CPUMiner) solveAndSubmitBlock(msgBlock *wire.MsgBlock, ticker *time.Tic
 
 	solved := false
 	exiting := false
-	validatorData := solutionValidatorData{&solved, &exiting, msgBlock, m, quit}
+	validatorData := solutionValidatorData{ctx, &solved, &exiting, submitted,
+		msgBlock, m, quit}
 
-	// Note that the entire extra nonce range is iterated and the offset is
-	// added relying on the fact that overflow will wrap around 0 as
-	// provided by the Go spec.
-	for extraNonce := uint64(0); extraNonce < maxExtraNonce && !solved && !exiting; extraNonce++ {
+	// Note that the entire extra nonce range of the worker is iterated and
+	// the first extra nonce is added relying on the fact that overflow will
+	// wrap around 0 as provided by the Go spec.
+	for extraNonce := uint64(0); extraNonce < numExtraNonces && !solved && !exiting; extraNonce++ {
 		// Update the extra nonce in the block template header with the
 		// new value.
-		littleEndian.PutUint64(header.ExtraData[:], extraNonce+enOffset)
+		littleEndian.PutUint64(header.ExtraData[:], extraNonce+firstExtraNonce)
 
 		// Update equihash solver input bytes
 		headerBytes, _ := header.SerializeAllHeaderBytes()
 
 		// Search through the entire nonce range for a solution while
 		// periodically checking for early quit and stale block
-		// conditions along with updates to the speed monitor.
-		for i := uint32(0); i <= maxNonce && !solved && !exiting; i++ {
+		// conditions.
+		for i := uint64(0); i <= uint64(maxNonce) && !solved && !exiting; i++ {
 			select {
 			case <-quit:
 				minrLog.Infof("Miner is stopping")
 				exiting = true
 				return false
 
+			case <-ctx.Done():
+				minrLog.Debugf("Miner is abandoning stale block template")
+				return false
+
 			case <-ticker.C:
 				minrLog.Debugf("Miner is updating time for currently mined block")
 
@@ -312,8 +396,7 @@ func (m *CPUMiner) solveAndSubmitBlock(msgBlock *wire.MsgBlock, ticker *time.Tic
 					return false
 				}
 
-				err = UpdateBlockTime(msgBlock, m.server.blockManager)
-
+				err := UpdateBlockTime(msgBlock, m.server.blockManager)
 				if err != nil {
 					minrLog.Warnf("CPU miner unable to update block template time: %v", err)
 					return false
@@ -332,29 +415,91 @@ func (m *CPUMiner) solveAndSubmitBlock(msgBlock *wire.MsgBlock, ticker *time.Tic
 				// Non-blocking select to fall through
 			}
 
-			header.Nonce = i
-			equihash.SolveEquihash(m.server.chainParams.N, m.server.chainParams.K, headerBytes, int64(i), validatorData)
+			header.Nonce = uint32(i)
+			err := equihash.Solve(m.server.chainParams.N, m.server.chainParams.K, headerBytes, int64(i),
+				validatorData.validate)
+			if err != nil {
+				minrLog.Errorf("CPU miner unable to solve block template: %v", err)
+				return false
+			}
 		}
 	}
 
 	return solved
 }
 
+// tipContext returns the context which is canceled when the block manager
+// next signals a new chain tip.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) tipContext() context.Context {
+	m.tipMtx.Lock()
+	ctx := m.tipCtx
+	m.tipMtx.Unlock()
+	return ctx
+}
+
+// NotifyNewTip signals the miner that the best chain tip has changed.  Any
+// in-flight solves are aborted promptly since they are working on templates
+// which are now stale.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) NotifyNewTip() {
+	m.tipMtx.Lock()
+	m.tipCancel()
+	m.tipCtx, m.tipCancel = context.WithCancel(context.Background())
+	m.tipMtx.Unlock()
+}
+
+// nextJob returns the block template the background mining workers should
+// solve next.  The current job is returned unless it is stale or it is the
+// passed job the calling worker is done with, in which case it is replaced by
+// a job for the template returned by the passed function.  The replaced job is
+// retired, so the workers still solving it move on to the new template and
+// none of them can submit a solution for it.  A nil job is returned when the
+// passed function does not provide a template.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) nextJob(done *miningJob, newTemplate func() (*wire.MsgBlock, error)) (*miningJob, error) {
+	m.jobMtx.Lock()
+	defer m.jobMtx.Unlock()
+
+	if job := m.job; job != nil && job != done && !job.stale() {
+		return job, nil
+	}
+
+	// Grab the tip context before creating the template so a tip change
+	// while the template is being built is not missed.
+	tipCtx := m.tipContext()
+	block, err := newTemplate()
+	if err != nil || block == nil {
+		return nil, err
+	}
+
+	if m.job != nil {
+		m.job.retire()
+	}
+	ctx, cancel := context.WithCancel(tipCtx)
+	m.job = &miningJob{block: block, ctx: ctx, cancel: cancel}
+	return m.job, nil
+}
+
 // generateBlocks is a worker that is controlled by the miningWorkerController.
-// It is self contained in that it creates block templates and attempts to solve
-// them while detecting when it is performing stale work and reacting
-// accordingly by generating a new block template.  When a block is solved, it
-// is submitted.
+// It is self contained in that it obtains the block template shared by all of
+// the workers and attempts to solve it while detecting when it is performing
+// stale work and reacting accordingly by moving on to a new block template.
+// When a block is solved, it is submitted.
 //
 // It must be run as a goroutine.
-func (m *CPUMiner) generateBlocks(quit chan struct{}) {
-	minrLog.Tracef("Starting generate blocks worker")
+func (m *CPUMiner) generateBlocks(quit chan struct{}, worker uint32) {
+	minrLog.Tracef("Starting generate blocks worker %d", worker)
 
 	// Start a ticker which is used to signal checks for stale work and
 	// updates to the speed monitor.
 	ticker := time.NewTicker(333 * time.Millisecond)
 	defer ticker.Stop()
 
+	var job *miningJob
 out:
 	for {
 		// Quit when the miner is stopped.
@@ -389,45 +534,72 @@ out:
 
 		payToAddr, err := m.server.blockManager.GetMiningAddr()
 		if err != nil {
+			m.submitBlockLock.Unlock()
 			minrLog.Errorf("Failed to get mining address: %v", err)
 			continue
 		}
 
-		// Create a new block template using the available transactions
-		// in the memory pool as a source of transactions to potentially
-		// include in the block.
-		template, err := NewBlockTemplate(m.policy, m.server, payToAddr)
+		// Move on to the template shared by all of the workers, creating
+		// a new one using the available transactions in the memory pool
+		// as a source of transactions to potentially include in the
+		// block when the previous one is done with.
+		job, err = m.nextJob(job, func() (*wire.MsgBlock, error) {
+			template, err := NewBlockTemplate(m.policy, m.server, payToAddr)
+			if err != nil {
+				return nil, err
+			}
+
+			// Not enough voters.
+			if template == nil {
+				return nil, nil
+			}
+
+			// This prevents you from causing memory exhaustion
+			// issues when mining aggressively in a simulation
+			// network.
+			if cfg.SimNet {
+				m.minedOnParentsMtx.Lock()
+				numMined := m.minedOnParents[template.Block.Header.PrevBlock]
+				m.minedOnParentsMtx.Unlock()
+				if numMined >= maxSimnetToMine {
+					minrLog.Tracef("too many blocks mined on parent, stopping " +
+						"until there are enough votes on these to make a new block")
+					return nil, nil
+				}
+			}
+
+			return template.Block, nil
+		})
 		m.submitBlockLock.Unlock()
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to create new block template: %v", err)
 			minrLog.Errorf(errStr)
 			continue
 		}
-
-		// Not enough voters.
-		if template == nil {
+		if job == nil {
 			continue
 		}
 
-		// This prevents you from causing memory exhaustion issues
-		// when mining aggressively in a simulation network.
-		if cfg.SimNet {
-			if m.minedOnParents[template.Block.Header.PrevBlock] >=
-				maxSimnetToMine {
-				minrLog.Tracef("too many blocks mined on parent, stopping " +
-					"until there are enough votes on these to make a new block")
-				continue
-			}
+		// The extra nonce space of the shared template is split between
+		// the workers.  Every worker modifies the header while searching,
+		// so each one needs its own copy of the block.  The
+		// transactions are only read and are therefore shared.
+		space := searchSpace{
+			worker:           worker,
+			numWorkers:       atomic.LoadUint32(&m.numWorkers),
+			extraNonceOffset: m.extraNonceOffset,
 		}
+		workerBlock := *job.block
 
 		// Attempt to solve the block and submit solution.
 		// The function will exit early with false when conditions
 		// that trigger a stale block, so a new block template can be generated.
-		m.solveAndSubmitBlock(template.Block, ticker, quit)
+		m.solveAndSubmitBlock(job.ctx, &workerBlock, ticker, quit, space,
+			&job.submitted)
 	}
 
 	m.workerWg.Done()
-	minrLog.Tracef("Generate blocks worker done")
+	minrLog.Tracef("Generate blocks worker %d done", worker)
 }
 
 // miningWorkerController launches the worker goroutines that are used to
@@ -441,11 +613,12 @@ func (m *CPUMiner) miningWorkerController() {
 	var runningWorkers []chan struct{}
 	launchWorkers := func(numWorkers uint32) {
 		for i := uint32(0); i < numWorkers; i++ {
+			worker := uint32(len(runningWorkers))
 			quit := make(chan struct{})
 			runningWorkers = append(runningWorkers, quit)
 
 			m.workerWg.Add(1)
-			go m.generateBlocks(quit)
+			go m.generateBlocks(quit, worker)
 		}
 	}
 
@@ -507,6 +680,22 @@ func (m *CPUMiner) Start() {
 		return
 	}
 
+	// Choose a random extra nonce offset shared by all of the workers.
+	enOffset, err := wire.RandomUint64()
+	if err != nil {
+		minrLog.Errorf("Unexpected error while generating random extra nonce offset: %v", err)
+		enOffset = 0
+	}
+	m.extraNonceOffset = enOffset
+
+	// Never resume solving a template from a previous run.
+	m.jobMtx.Lock()
+	if m.job != nil {
+		m.job.retire()
+		m.job = nil
+	}
+	m.jobMtx.Unlock()
+
 	m.quit = make(chan struct{})
 	m.speedMonitorQuit = make(chan struct{})
 	m.wg.Add(2)
@@ -549,11 +738,14 @@ func (m *CPUMiner) IsMining() bool {
 	return m.started
 }
 
-// HashesPerSecond returns the number of hashes per second the mining process
-// is performing.  0 is returned if the miner is not currently running.
+// SolutionsPerSecond returns the number of Equihash solutions per second
+// (Sol/s) the mining process is finding.  Equihash work is measured in
+// solutions rather than hashes, so this is the value reported as the hashes per
+// second by the RPC server.  0 is returned if the miner is not currently
+// running.
 //
 // This function is safe for concurrent access.
-func (m *CPUMiner) HashesPerSecond() float64 {
+func (m *CPUMiner) SolutionsPerSecond() float64 {
 	m.Lock()
 	defer m.Unlock()
 
@@ -562,7 +754,7 @@ func (m *CPUMiner) HashesPerSecond() float64 {
 		return 0
 	}
 
-	return <-m.queryHashesPerSec
+	return <-m.querySolutionsPerSec
 }
 
 // SetNumWorkers sets the number of workers to create which solve blocks.  Any
@@ -581,11 +773,12 @@ func (m *CPUMiner) SetNumWorkers(numWorkers int32) {
 	m.Lock()
 	defer m.Unlock()
 
-	// Use default if provided value is negative.
+	// Use default if provided value is negative.  The value is stored
+	// atomically since running workers read it to split the nonce space.
 	if numWorkers < 0 {
-		m.numWorkers = defaultNumWorkers
+		atomic.StoreUint32(&m.numWorkers, defaultNumWorkers)
 	} else {
-		m.numWorkers = uint32(numWorkers)
+		atomic.StoreUint32(&m.numWorkers, uint32(numWorkers))
 	}
 
 	// When the miner is already running, notify the controller about the
@@ -610,6 +803,10 @@ func (m *CPUMiner) NumWorkers() int32 {
 // detecting when it is performing stale work and reacting accordingly by
 // generating a new block template.  When a block is solved, it is submitted.
 // The function returns a list of the hashes of generated blocks.
+//
+// Each template is solved by a single worker regardless of the configured
+// number of workers, and the extra nonce always starts at zero so that
+// generation is predictable.
 func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 	m.Lock()
 
@@ -629,6 +826,7 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 
 	m.started = true
 	m.discreteMining = true
+	m.extraNonceOffset = 0
 
 	m.speedMonitorQuit = make(chan struct{})
 	m.wg.Add(1)
@@ -641,8 +839,7 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 	i := uint32(0)
 	blockHashes := make([]*chainhash.Hash, n)
 
-	// Start a ticker which is used to signal checks for stale work and
-	// updates to the speed monitor.
+	// Start a ticker which is used to signal checks for stale work.
 	ticker := time.NewTicker(time.Second * hashUpdateSecs)
 	defer ticker.Stop()
 
@@ -662,6 +859,7 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 
 		payToAddr, err := m.server.blockManager.GetMiningAddr()
 		if err != nil {
+			m.submitBlockLock.Unlock()
 			minrLog.Errorf("Failed to get mining address: %v", err)
 			continue
 		}
@@ -686,7 +884,10 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveAndSubmitBlock(template.Block, ticker, nil) {
+		space := searchSpace{numWorkers: 1}
+		if m.solveAndSubmitBlock(m.tipContext(), template.Block, ticker,
+			nil, space, new(int32)) {
+
 			blockHashes[i] = cmmutil.NewBlock(template.Block).Hash()
 			i++
 
@@ -708,14 +909,17 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 // Use Start to begin the mining process.  See the documentation for CPUMiner
 // type for more details.
 func newCPUMiner(policy *mining.Policy, s *server) *CPUMiner {
+	tipCtx, tipCancel := context.WithCancel(context.Background())
 	return &CPUMiner{
-		policy:            policy,
-		txSource:          s.txMemPool,
-		server:            s,
-		numWorkers:        defaultNumWorkers,
-		updateNumWorkers:  make(chan struct{}),
-		queryHashesPerSec: make(chan float64),
-		updateHashes:      make(chan uint64),
-		minedOnParents:    make(map[chainhash.Hash]uint8),
+		policy:               policy,
+		txSource:             s.txMemPool,
+		server:               s,
+		numWorkers:           defaultNumWorkers,
+		updateNumWorkers:     make(chan struct{}),
+		querySolutionsPerSec: make(chan float64),
+		updateSolutions:      make(chan uint64),
+		tipCtx:               tipCtx,
+		tipCancel:            tipCancel,
+		minedOnParents:       make(map[chainhash.Hash]uint8),
 	}
 }
@@ -0,0 +1,135 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestMiningJobs ensures the background mining workers share a single block
+// template and submitted flag, and that they move on to a new template
+// together once it is done with.
+func TestMiningJobs(t *testing.T) {
+	tipCtx, tipCancel := context.WithCancel(context.Background())
+	m := &CPUMiner{tipCtx: tipCtx, tipCancel: tipCancel}
+
+	var created int
+	newTemplate := func() (*wire.MsgBlock, error) {
+		created++
+		block := &wire.MsgBlock{}
+		block.Header.Height = uint32(created)
+		return block, nil
+	}
+
+	// All of the workers receive the same job and only the first one
+	// creates the template.
+	job1, err := m.nextJob(nil, newTemplate)
+	if err != nil {
+		t.Fatalf("nextJob: unexpected error: %v", err)
+	}
+	for worker := 1; worker < 4; worker++ {
+		job, err := m.nextJob(nil, newTemplate)
+		if err != nil {
+			t.Fatalf("nextJob: unexpected error: %v", err)
+		}
+		if job != job1 {
+			t.Fatalf("worker %d did not receive the shared job", worker)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("unexpected number of templates created: got %d, want 1",
+			created)
+	}
+
+	// Only one worker may claim the right to submit a solution for the
+	// shared template.
+	if !atomic.CompareAndSwapInt32(&job1.submitted, 0, 1) {
+		t.Fatal("unable to claim the submission of a new job")
+	}
+	if atomic.CompareAndSwapInt32(&job1.submitted, 0, 1) {
+		t.Fatal("submission of a job claimed twice")
+	}
+
+	// Once a solution is claimed, the job is stale and the next worker to
+	// finish creates a new template which the others pick up.
+	job2, err := m.nextJob(job1, newTemplate)
+	if err != nil {
+		t.Fatalf("nextJob: unexpected error: %v", err)
+	}
+	if job2 == job1 || created != 2 {
+		t.Fatal("no new job created once a solution was claimed")
+	}
+	if job, _ := m.nextJob(job1, newTemplate); job != job2 || created != 2 {
+		t.Fatal("worker did not move on to the shared new job")
+	}
+
+	// A worker detecting the template is outdated replaces it for all of
+	// the workers.  The replaced job is canceled and no solution for it
+	// can be submitted anymore.
+	job3, _ := m.nextJob(job2, newTemplate)
+	if job3 == job2 || created != 3 {
+		t.Fatal("no new job created for an outdated template")
+	}
+	if job2.ctx.Err() == nil {
+		t.Fatal("replaced job was not canceled")
+	}
+	if atomic.CompareAndSwapInt32(&job2.submitted, 0, 1) {
+		t.Fatal("submission of a replaced job claimed")
+	}
+
+	// A new chain tip makes the current job stale.
+	m.NotifyNewTip()
+	if !job3.stale() {
+		t.Fatal("job not stale after a new chain tip")
+	}
+	job4, _ := m.nextJob(nil, newTemplate)
+	if job4 == job3 || created != 4 {
+		t.Fatal("no new job created after a new chain tip")
+	}
+
+	// The current job is kept when no template is available.
+	noTemplate := func() (*wire.MsgBlock, error) { return nil, nil }
+	if job, err := m.nextJob(job4, noTemplate); job != nil || err != nil {
+		t.Fatalf("nextJob: got job %v and error %v, want neither", job,
+			err)
+	}
+	if job, _ := m.nextJob(nil, newTemplate); job != job4 {
+		t.Fatal("current job replaced without a new template")
+	}
+}
+
+// TestSearchSpace ensures the extra nonce ranges searched by the workers are
+// disjoint and follow each other, including when they wrap around zero.
+func TestSearchSpace(t *testing.T) {
+	for _, numWorkers := range []uint32{0, 1, 3, 16} {
+		for _, offset := range []uint64{0, maxExtraNonce - 5} {
+			count := numWorkers
+			if count == 0 {
+				count = 1
+			}
+			wantSize := maxExtraNonce / uint64(count)
+			wantStart := offset
+			for worker := uint32(0); worker < count; worker++ {
+				space := searchSpace{
+					worker:           worker,
+					numWorkers:       numWorkers,
+					extraNonceOffset: offset,
+				}
+				start, size := space.extraNonces()
+				if start != wantStart || size != wantSize {
+					t.Fatalf("%d workers, offset %d, worker %d: "+
+						"got range %d+%d, want %d+%d",
+						numWorkers, offset, worker, start, size,
+						wantStart, wantSize)
+				}
+				wantStart += size
+			}
+		}
+	}
+}
@@ -0,0 +1,530 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/mempool"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+const (
+	// dandelionDestinations is the number of outbound peers which are
+	// chosen as stem destinations each epoch.
+	dandelionDestinations = 2
+
+	// dandelionFluffProbability is the probability the node acts as a
+	// diffuser during an epoch, in which case it fluffs the stem
+	// transactions it receives from other peers instead of relaying them
+	// along the stem.
+	dandelionFluffProbability = 0.1
+
+	// dandelionMinEmbargo is the minimum amount of time a transaction is
+	// held in the stem pool before it is fluffed in case the stem it was
+	// relayed along is broken.
+	dandelionMinEmbargo = time.Second * 10
+
+	// dandelionEmbargoMean is the mean of the exponentially distributed
+	// random amount of time which is added to the minimum embargo of each
+	// stem transaction.  Randomizing the embargo prevents peers from
+	// learning the position of the node along the stem from when it fluffs
+	// a transaction.
+	dandelionEmbargoMean = time.Second * 20
+
+	// dandelionEmbargoInterval is how often the stem pool is checked for
+	// transactions with expired embargoes.
+	dandelionEmbargoInterval = time.Second
+
+	// maxStemPoolTxs is the maximum number of transactions which may be
+	// held in the stem pool at once.  Stem transactions received while it
+	// is full are fluffed instead.
+	maxStemPoolTxs = 1000
+)
+
+// stemConflictError describes a transaction which was rejected because it
+// spends an output that is already spent by a transaction in the stem pool.
+type stemConflictError struct {
+	txHash   chainhash.Hash
+	outPoint wire.OutPoint
+	spender  chainhash.Hash
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e stemConflictError) Error() string {
+	return fmt.Sprintf("transaction %v spends output %v which is already "+
+		"spent by stem transaction %v", e.txHash, e.outPoint, e.spender)
+}
+
+// isStemConflict returns whether the passed error was returned for a
+// transaction that conflicts with a transaction in the stem pool.
+func isStemConflict(err error) bool {
+	rerr, ok := err.(mempool.RuleError)
+	if !ok {
+		return false
+	}
+	_, ok = rerr.Err.(stemConflictError)
+	return ok
+}
+
+// stemTx houses a transaction in the stem pool along with whether it was
+// submitted locally and the time its embargo expires.
+type stemTx struct {
+	tx      *cmmutil.Tx
+	local   bool
+	embargo time.Time
+}
+
+// dandelionRelay implements Dandelion++ transaction relay.  Rather than
+// announcing new transactions to all peers at once, transactions in the stem
+// phase are passed to a single stem destination at a time and held in a stem
+// pool which is separate from the memory pool so they are neither announced
+// nor served to other peers.  A transaction is fluffed, meaning it is added
+// to the memory pool and announced as normal, once a node acting as a
+// diffuser receives it or its embargo expires.
+//
+// Stem destinations are chosen from the outbound peers which advertise the
+// SFNodeDandelion service and are replaced at the start of every epoch.
+// Transactions from the same source are always relayed to the same
+// destination during an epoch.
+type dandelionRelay struct {
+	server *server
+	epoch  time.Duration
+
+	mtx          sync.Mutex
+	rand         *rand.Rand
+	fluff        bool
+	candidates   map[*serverPeer]struct{}
+	destinations []*serverPeer
+	routes       map[*serverPeer]*serverPeer
+	localRoute   *serverPeer
+	stemPool     map[chainhash.Hash]*stemTx
+	stemSpends   map[wire.OutPoint]*stemTx
+}
+
+// newDandelionRelay returns a new Dandelion++ relay for the passed server
+// which replaces its stem routes every epoch.
+func newDandelionRelay(s *server, epoch time.Duration) *dandelionRelay {
+	return &dandelionRelay{
+		server:     s,
+		epoch:      epoch,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		candidates: make(map[*serverPeer]struct{}),
+		routes:     make(map[*serverPeer]*serverPeer),
+		stemPool:   make(map[chainhash.Hash]*stemTx),
+		stemSpends: make(map[wire.OutPoint]*stemTx),
+	}
+}
+
+// isDestination returns whether or not the passed peer is currently a stem
+// destination.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) isDestination(sp *serverPeer) bool {
+	for _, dest := range d.destinations {
+		if dest == sp {
+			return true
+		}
+	}
+	return false
+}
+
+// fillDestinations randomly chooses stem destinations from the candidate
+// peers until there are enough of them or no candidates remain.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) fillDestinations() {
+	for len(d.destinations) < dandelionDestinations {
+		choices := make([]*serverPeer, 0, len(d.candidates))
+		for sp := range d.candidates {
+			if !d.isDestination(sp) {
+				choices = append(choices, sp)
+			}
+		}
+		if len(choices) == 0 {
+			return
+		}
+		d.destinations = append(d.destinations,
+			choices[d.rand.Intn(len(choices))])
+	}
+}
+
+// newEpoch starts a new epoch by choosing new stem destinations, forgetting
+// the routes of the previous epoch, and deciding whether the node acts as a
+// diffuser during it.
+func (d *dandelionRelay) newEpoch() {
+	d.mtx.Lock()
+	d.fluff = d.rand.Float64() < dandelionFluffProbability
+	d.destinations = nil
+	d.routes = make(map[*serverPeer]*serverPeer)
+	d.localRoute = nil
+	d.fillDestinations()
+	peerLog.Debugf("New Dandelion++ epoch (diffuser: %v, stem "+
+		"destinations: %v)", d.fluff, d.destinations)
+	d.mtx.Unlock()
+}
+
+// AddPeer makes the passed peer a candidate stem destination when it is an
+// outbound peer which supports Dandelion++ and wants transactions relayed.
+//
+// This function is safe for concurrent access.
+func (d *dandelionRelay) AddPeer(sp *serverPeer) {
+	if sp.Inbound() || sp.relayTxDisabled() ||
+		sp.Services()&wire.SFNodeDandelion != wire.SFNodeDandelion {
+
+		return
+	}
+
+	d.mtx.Lock()
+	d.candidates[sp] = struct{}{}
+	d.fillDestinations()
+	d.mtx.Unlock()
+}
+
+// RemovePeer forgets the passed peer along with any routes to and from it.  A
+// new stem destination is chosen to replace it when it was one.
+//
+// This function is safe for concurrent access.
+func (d *dandelionRelay) RemovePeer(sp *serverPeer) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	delete(d.candidates, sp)
+	delete(d.routes, sp)
+	if !d.isDestination(sp) {
+		return
+	}
+
+	destinations := d.destinations[:0]
+	for _, dest := range d.destinations {
+		if dest != sp {
+			destinations = append(destinations, dest)
+		}
+	}
+	d.destinations = destinations
+	for source, dest := range d.routes {
+		if dest == sp {
+			delete(d.routes, source)
+		}
+	}
+	if d.localRoute == sp {
+		d.localRoute = nil
+	}
+	d.fillDestinations()
+}
+
+// route returns the stem destination for transactions from the passed source
+// peer, or for locally submitted transactions when it is nil.  Nil is
+// returned when there is no suitable destination.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) route(source *serverPeer) *serverPeer {
+	if source == nil {
+		if d.localRoute == nil && len(d.destinations) > 0 {
+			d.localRoute = d.destinations[d.rand.Intn(len(d.destinations))]
+		}
+		return d.localRoute
+	}
+
+	if dest, ok := d.routes[source]; ok {
+		return dest
+	}
+
+	// Never route transactions back to the peer they came from.
+	choices := make([]*serverPeer, 0, len(d.destinations))
+	for _, dest := range d.destinations {
+		if dest != source {
+			choices = append(choices, dest)
+		}
+	}
+	if len(choices) == 0 {
+		return nil
+	}
+	dest := choices[d.rand.Intn(len(choices))]
+	d.routes[source] = dest
+	return dest
+}
+
+// embargo returns a random time at which the embargo of a transaction added
+// to the stem pool now expires.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) embargo() time.Time {
+	jitter := time.Duration(d.rand.ExpFloat64() *
+		float64(dandelionEmbargoMean))
+	return time.Now().Add(dandelionMinEmbargo + jitter)
+}
+
+// addStemTx adds the passed transaction to the stem pool and records the
+// outputs it spends.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) addStemTx(stx *stemTx) {
+	d.stemPool[*stx.tx.Hash()] = stx
+	for _, txIn := range stx.tx.MsgTx().TxIn {
+		d.stemSpends[txIn.PreviousOutPoint] = stx
+	}
+}
+
+// deleteStemTx removes the passed transaction from the stem pool along with
+// the record of the outputs it spends.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) deleteStemTx(stx *stemTx) {
+	delete(d.stemPool, *stx.tx.Hash())
+	for _, txIn := range stx.tx.MsgTx().TxIn {
+		if d.stemSpends[txIn.PreviousOutPoint] == stx {
+			delete(d.stemSpends, txIn.PreviousOutPoint)
+		}
+	}
+}
+
+// conflict returns an error when the passed transaction spends an output which
+// is already spent by another transaction in the stem pool.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) conflict(tx *cmmutil.Tx) error {
+	for _, txIn := range tx.MsgTx().TxIn {
+		spender, ok := d.stemSpends[txIn.PreviousOutPoint]
+		if !ok || spender.tx.Hash().IsEqual(tx.Hash()) {
+			continue
+		}
+		return mempool.RuleError{Err: stemConflictError{
+			txHash:   *tx.Hash(),
+			outPoint: txIn.PreviousOutPoint,
+			spender:  *spender.tx.Hash(),
+		}}
+	}
+	return nil
+}
+
+// StemTransaction attempts to relay the passed transaction along the stem.
+// The source is the peer the transaction was received from, or nil when it
+// was submitted locally.  It returns whether or not the transaction was added
+// to the stem pool.  When it was not, the caller is expected to process and
+// relay the transaction as normal.  An error is returned when the transaction
+// is rejected by the memory pool or spends an output which is already spent by
+// another transaction in the stem pool.
+//
+// This function is safe for concurrent access.
+func (d *dandelionRelay) StemTransaction(tx *cmmutil.Tx, source *serverPeer, allowHighFees bool) (bool, error) {
+	// Stake transactions are time sensitive and therefore never stemmed.
+	if stake.DetermineTxType(tx.MsgTx()) != stake.TxTypeRegular {
+		return false, nil
+	}
+
+	// Ignore transactions which are already in the stem pool and reject
+	// those which double spend them.
+	txHash := tx.Hash()
+	d.mtx.Lock()
+	_, ok := d.stemPool[*txHash]
+	err := d.conflict(tx)
+	d.mtx.Unlock()
+	if ok {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Ensure the transaction would be accepted to the memory pool.  It may
+	// only spend outputs which are not known yet when they are created by
+	// other transactions in the stem pool.
+	missingParents, err := d.server.txMemPool.CheckTransaction(tx,
+		allowHighFees)
+	if err != nil {
+		return false, err
+	}
+
+	d.mtx.Lock()
+	if _, ok := d.stemPool[*txHash]; ok {
+		d.mtx.Unlock()
+		return true, nil
+	}
+	if err := d.conflict(tx); err != nil {
+		d.mtx.Unlock()
+		return false, err
+	}
+	for _, parent := range missingParents {
+		if _, ok := d.stemPool[*parent]; !ok {
+			d.mtx.Unlock()
+			return false, nil
+		}
+	}
+
+	// Fluff the transaction instead when the node is a diffuser for this
+	// epoch, the stem pool is full, or there is no stem destination.
+	// Locally submitted transactions are always stemmed when possible.
+	if (d.fluff && source != nil) || len(d.stemPool) >= maxStemPoolTxs {
+		d.mtx.Unlock()
+		return false, nil
+	}
+	dest := d.route(source)
+	if dest == nil {
+		d.mtx.Unlock()
+		return false, nil
+	}
+	d.addStemTx(&stemTx{
+		tx:      tx,
+		local:   source == nil,
+		embargo: d.embargo(),
+	})
+	d.mtx.Unlock()
+
+	// Neither the source nor the stem destination need to be sent an
+	// announcement for the transaction once it is fluffed.
+	iv := wire.NewInvVect(wire.InvTypeTx, txHash)
+	if source != nil {
+		source.AddKnownInventory(iv)
+	}
+	dest.AddKnownInventory(iv)
+	dest.QueueMessage(wire.NewMsgDandelionTx(tx.MsgTx()), nil)
+
+	peerLog.Tracef("Relayed stem transaction %v to %v", txHash, dest)
+	return true, nil
+}
+
+// removeStemTx removes the transaction with the passed hash along with all of
+// its ancestors from the stem pool and appends them to the passed slice such
+// that ancestors come before the transactions which spend them.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) removeStemTx(hash *chainhash.Hash, removed []*stemTx) []*stemTx {
+	stx, ok := d.stemPool[*hash]
+	if !ok {
+		return removed
+	}
+	d.deleteStemTx(stx)
+
+	for _, txIn := range stx.tx.MsgTx().TxIn {
+		removed = d.removeStemTx(&txIn.PreviousOutPoint.Hash, removed)
+	}
+	return append(removed, stx)
+}
+
+// removeStemDescendants removes the passed transaction from the stem pool
+// along with all of the stem transactions which spend its outputs.
+//
+// This function MUST be called with the relay lock held.
+func (d *dandelionRelay) removeStemDescendants(stx *stemTx) {
+	d.deleteStemTx(stx)
+	txHash := stx.tx.Hash()
+	for i := range stx.tx.MsgTx().TxOut {
+		outPoint := wire.OutPoint{
+			Hash:  *txHash,
+			Index: uint32(i),
+			Tree:  wire.TxTreeRegular,
+		}
+		if spender, ok := d.stemSpends[outPoint]; ok {
+			d.removeStemDescendants(spender)
+		}
+	}
+}
+
+// RemoveTransactions removes the passed transactions, which were either mined
+// or added to the memory pool, from the stem pool.  Stem transactions which
+// double spend any of them are removed along with their descendants since
+// they can no longer be fluffed.  Descendants of the passed transactions are
+// kept since they remain valid.
+//
+// This function is safe for concurrent access.
+func (d *dandelionRelay) RemoveTransactions(txns []*cmmutil.Tx) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, tx := range txns {
+		if stx, ok := d.stemPool[*tx.Hash()]; ok {
+			d.deleteStemTx(stx)
+			continue
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			spender, ok := d.stemSpends[txIn.PreviousOutPoint]
+			if !ok {
+				continue
+			}
+			peerLog.Debugf("Removing stem transaction %v which is "+
+				"double spent by transaction %v", spender.tx.Hash(),
+				tx.Hash())
+			d.removeStemDescendants(spender)
+		}
+	}
+}
+
+// fluffExpired removes all transactions with expired embargoes from the stem
+// pool and fluffs them.
+func (d *dandelionRelay) fluffExpired() {
+	now := time.Now()
+	var expired []*stemTx
+	d.mtx.Lock()
+	for _, stx := range d.stemPool {
+		if !now.Before(stx.embargo) {
+			expired = append(expired, stx)
+		}
+	}
+	var fluffed []*stemTx
+	for _, stx := range expired {
+		fluffed = d.removeStemTx(stx.tx.Hash(), fluffed)
+	}
+	d.mtx.Unlock()
+
+	for _, stx := range fluffed {
+		d.fluffTx(stx)
+	}
+}
+
+// fluffTx adds the passed stem transaction to the memory pool and announces it
+// to all peers.  Locally submitted transactions are also rebroadcast until
+// they make it into a block.
+func (d *dandelionRelay) fluffTx(stx *stemTx) {
+	s := d.server
+	acceptedTxs, err := s.txMemPool.ProcessTransaction(stx.tx, false,
+		!stx.local, true)
+	if err != nil {
+		peerLog.Debugf("Unable to fluff stem transaction %v: %v",
+			stx.tx.Hash(), err)
+		return
+	}
+	peerLog.Debugf("Fluffing stem transaction %v after embargo",
+		stx.tx.Hash())
+	s.AnnounceNewTransactions(acceptedTxs)
+
+	if stx.local {
+		iv := wire.NewInvVect(wire.InvTypeTx, stx.tx.Hash())
+		s.AddRebroadcastInventory(iv, stx.tx)
+	}
+}
+
+// handler replaces the stem routes every epoch and fluffs the transactions in
+// the stem pool once their embargoes expire.  It must be run as a goroutine.
+func (d *dandelionRelay) handler() {
+	d.newEpoch()
+	epochTicker := time.NewTicker(d.epoch)
+	embargoTicker := time.NewTicker(dandelionEmbargoInterval)
+
+out:
+	for {
+		select {
+		case <-epochTicker.C:
+			d.newEpoch()
+
+		case <-embargoTicker.C:
+			d.fluffExpired()
+
+		case <-d.server.quit:
+			break out
+		}
+	}
+
+	epochTicker.Stop()
+	embargoTicker.Stop()
+	d.server.wg.Done()
+	peerLog.Tracef("Dandelion++ handler done")
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/peer"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestDandelionRoutes ensures stem destinations are chosen from the candidate
+// peers, transactions from the same source are routed to the same destination,
+// and destinations which disconnect are replaced.
+func TestDandelionRoutes(t *testing.T) {
+	d := newDandelionRelay(&server{}, time.Minute)
+
+	// Ensure transactions are not stemmed without any destinations.
+	if dest := d.route(nil); dest != nil {
+		t.Fatalf("unexpected stem destination %v without candidates", dest)
+	}
+
+	// newPeer returns a new server peer with the passed connection
+	// direction.
+	newPeer := func(inbound bool) *serverPeer {
+		sp := &serverPeer{}
+		if inbound {
+			sp.Peer = peer.NewInboundPeer(&peer.Config{})
+			return sp
+		}
+		p, err := peer.NewOutboundPeer(&peer.Config{}, "127.0.0.1:9657")
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+		}
+		sp.Peer = p
+		return sp
+	}
+	outbound := []*serverPeer{newPeer(false), newPeer(false), newPeer(false)}
+	for _, sp := range outbound {
+		d.candidates[sp] = struct{}{}
+	}
+	d.newEpoch()
+	if len(d.destinations) != dandelionDestinations ||
+		d.destinations[0] == d.destinations[1] {
+
+		t.Fatalf("unexpected stem destinations %v", d.destinations)
+	}
+
+	// Ensure local and inbound transactions are routed to the same stem
+	// destination for the whole epoch.
+	source := newPeer(true)
+	localDest, sourceDest := d.route(nil), d.route(source)
+	if !d.isDestination(localDest) || !d.isDestination(sourceDest) {
+		t.Fatal("transactions routed to peer which is not a stem " +
+			"destination")
+	}
+	for i := 0; i < 10; i++ {
+		if d.route(nil) != localDest || d.route(source) != sourceDest {
+			t.Fatal("stem route changed during epoch")
+		}
+	}
+
+	// Ensure transactions from a stem destination are never routed back to
+	// it.
+	for _, dest := range d.destinations {
+		if d.route(dest) == dest {
+			t.Fatal("transactions routed back to their source")
+		}
+	}
+
+	// Ensure a disconnected stem destination is replaced and no longer
+	// used by any routes.
+	d.RemovePeer(sourceDest)
+	if len(d.destinations) != dandelionDestinations ||
+		d.isDestination(sourceDest) {
+
+		t.Fatalf("disconnected stem destination not replaced: %v",
+			d.destinations)
+	}
+	if d.route(source) == sourceDest || d.route(nil) == sourceDest {
+		t.Fatal("transactions routed to disconnected stem destination")
+	}
+}
+
+// TestDandelionStemPoolAncestors ensures transactions are removed from the stem
+// pool along with their ancestors such that the ancestors are fluffed first.
+func TestDandelionStemPoolAncestors(t *testing.T) {
+	d := newDandelionRelay(&server{}, time.Minute)
+
+	// Create a chain of three transactions and add them to the stem pool
+	// along with an unrelated transaction.
+	prevOut := wire.NewOutPoint(&chainhash.Hash{0x01}, 0, wire.TxTreeRegular)
+	var chain []*cmmutil.Tx
+	for i := 0; i < 3; i++ {
+		msgTx := wire.NewMsgTx()
+		msgTx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		msgTx.AddTxOut(wire.NewTxOut(int64(1000-i), nil))
+		tx := cmmutil.NewTx(msgTx)
+		chain = append(chain, tx)
+		prevOut = wire.NewOutPoint(tx.Hash(), 0, wire.TxTreeRegular)
+	}
+	unrelated := wire.NewMsgTx()
+	unrelated.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x02},
+		0, wire.TxTreeRegular), nil))
+	for _, tx := range append(chain, cmmutil.NewTx(unrelated)) {
+		d.addStemTx(&stemTx{tx: tx})
+	}
+
+	// Remove the middle transaction and ensure its parent is removed before
+	// it while the rest of the stem pool is untouched.
+	removed := d.removeStemTx(chain[1].Hash(), nil)
+	if len(removed) != 2 || removed[0].tx != chain[0] ||
+		removed[1].tx != chain[1] {
+
+		t.Fatalf("unexpected removed transactions %v", removed)
+	}
+	if len(d.stemPool) != 2 {
+		t.Fatalf("unexpected stem pool size -- got %d, want 2",
+			len(d.stemPool))
+	}
+	if _, ok := d.stemPool[*chain[2].Hash()]; !ok {
+		t.Fatal("descendant removed from stem pool")
+	}
+	if len(d.stemSpends) != 2 {
+		t.Fatalf("unexpected number of stem spends -- got %d, want 2",
+			len(d.stemSpends))
+	}
+}
+
+// TestDandelionStemConflicts ensures transactions which double spend a stem
+// transaction are rejected and that stem transactions are removed from the
+// stem pool once they are mined or double spent by a public transaction.
+func TestDandelionStemConflicts(t *testing.T) {
+	d := newDandelionRelay(&server{}, time.Minute)
+
+	// newTx returns a new stem transaction spending the passed output.
+	newTx := func(prevOut *wire.OutPoint, value int64) *cmmutil.Tx {
+		msgTx := wire.NewMsgTx()
+		msgTx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		msgTx.AddTxOut(wire.NewTxOut(value, nil))
+		return cmmutil.NewTx(msgTx)
+	}
+	outPoint1 := wire.NewOutPoint(&chainhash.Hash{0x01}, 0, wire.TxTreeRegular)
+	outPoint2 := wire.NewOutPoint(&chainhash.Hash{0x02}, 0, wire.TxTreeRegular)
+	parent := newTx(outPoint1, 1000)
+	child := newTx(wire.NewOutPoint(parent.Hash(), 0, wire.TxTreeRegular), 900)
+	unrelated := newTx(outPoint2, 1000)
+	addAll := func() {
+		for _, tx := range []*cmmutil.Tx{parent, child, unrelated} {
+			d.addStemTx(&stemTx{tx: tx})
+		}
+	}
+	expectStemPool := func(desc string, want ...*cmmutil.Tx) {
+		if len(d.stemPool) != len(want) {
+			t.Fatalf("%s: unexpected stem pool size -- got %d, want %d",
+				desc, len(d.stemPool), len(want))
+		}
+		for _, tx := range want {
+			if _, ok := d.stemPool[*tx.Hash()]; !ok {
+				t.Fatalf("%s: transaction %v missing from stem pool",
+					desc, tx.Hash())
+			}
+		}
+		if len(d.stemSpends) != len(want) {
+			t.Fatalf("%s: unexpected number of stem spends -- got %d, "+
+				"want %d", desc, len(d.stemSpends), len(want))
+		}
+	}
+	addAll()
+
+	// Ensure a double spend of a stem transaction is rejected while the
+	// stem transactions themselves and unrelated transactions are not.
+	doubleSpend := newTx(outPoint1, 500)
+	if err := d.conflict(doubleSpend); !isStemConflict(err) {
+		t.Fatalf("unexpected error for double spend -- got %v, want a "+
+			"stem conflict", err)
+	}
+	for _, tx := range []*cmmutil.Tx{parent, child, newTx(
+		wire.NewOutPoint(&chainhash.Hash{0x03}, 0, wire.TxTreeRegular),
+		1000)} {
+
+		if err := d.conflict(tx); err != nil {
+			t.Fatalf("unexpected conflict for %v: %v", tx.Hash(), err)
+		}
+	}
+
+	// Ensure a public double spend removes the conflicted stem transaction
+	// along with its descendants.
+	d.RemoveTransactions([]*cmmutil.Tx{doubleSpend})
+	expectStemPool("double spent", unrelated)
+
+	// Ensure mined stem transactions are removed while their descendants
+	// are kept.
+	addAll()
+	d.RemoveTransactions([]*cmmutil.Tx{parent, unrelated})
+	expectStemPool("mined", child)
+}
@@ -121,6 +121,10 @@ type blockStore struct {
 	// basePath is the base path used for the flat block files and metadata.
 	basePath string
 
+	// firstFileNum is the number of the oldest flat block file which has
+	// not been pruned.  It is only modified during write transactions.
+	firstFileNum uint32
+
 	// The following fields are related to the flat files which hold the
 	// actual blocks.   The number of open files is limited by maxOpenFiles.
 	//
@@ -312,6 +316,58 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// fileSize returns the size of the block file for the passed flat file number.
+// A file which does not exist yet has a size of zero.
+func (s *blockStore) fileSize(fileNum uint32) (uint64, error) {
+	filePath := blockFilePath(s.basePath, fileNum)
+	st, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, makeDbErr(database.ErrDriverSpecific, err.Error(), err)
+	}
+
+	return uint64(st.Size()), nil
+}
+
+// pruneFiles closes and removes the block files for the passed flat file
+// numbers, which must be ordered from oldest to newest and must directly follow
+// the oldest remaining file.  The metadata must no longer reference any blocks
+// in the files.
+//
+// Any errors are simply logged at a warning level rather than being returned
+// since the metadata has already been updated and the only consequence of a
+// file that failed to be removed is the disk space it continues to use.
+//
+// This function MUST only be called during a write transaction commit.
+func (s *blockStore) pruneFiles(fileNums []uint32) {
+	for _, fileNum := range fileNums {
+		// Close the file if it is open under the write lock for the
+		// file in case any readers are currently reading from it so it's
+		// not closed out from under them.
+		s.obfMutex.Lock()
+		if blockFile, ok := s.openBlockFiles[fileNum]; ok {
+			s.lruMutex.Lock()
+			s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+			delete(s.fileNumToLRUElem, fileNum)
+			s.lruMutex.Unlock()
+
+			blockFile.Lock()
+			_ = blockFile.file.Close()
+			blockFile.Unlock()
+			delete(s.openBlockFiles, fileNum)
+		}
+		s.obfMutex.Unlock()
+
+		if err := s.deleteFileFunc(fileNum); err != nil {
+			log.Warnf("PRUNE: Failed to delete block file number %d: %v",
+				fileNum, err)
+		}
+		s.firstFileNum = fileNum + 1
+	}
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -717,15 +773,42 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
+// firstBlockFile searches the database directory for the oldest flat block
+// file.  This is only nonzero when older block files have been pruned.
+func firstBlockFile(dbPath string) uint32 {
+	matches, err := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	if err != nil || len(matches) == 0 {
+		return 0
+	}
+
+	first := ^uint32(0)
+	for _, match := range matches {
+		var fileNum uint32
+		_, err := fmt.Sscanf(filepath.Base(match), blockFilenameTemplate,
+			&fileNum)
+		if err != nil {
+			continue
+		}
+		if fileNum < first {
+			first = fileNum
+		}
+	}
+	if first == ^uint32(0) {
+		return 0
+	}
+	return first
+}
+
 // scanBlockFiles searches the database directory for all flat block files to
 // find the end of the most recent file.  This position is considered the
 // current write cursor which is also stored in the metadata.  Thus, it is used
 // to detect unexpected shutdowns in the middle of writes so the block files
-// can be reconciled.
-func scanBlockFiles(dbPath string) (int, uint32) {
+// can be reconciled.  The scan starts at the passed oldest file so pruned
+// files are skipped.
+func scanBlockFiles(dbPath string, firstFile uint32) (int, uint32) {
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
+	for i := int(firstFile); ; i++ {
 		filePath := blockFilePath(dbPath, uint32(i))
 		st, err := os.Stat(filePath)
 		if err != nil {
@@ -747,15 +830,17 @@ func newBlockStore(basePath string, network wire.CurrencyNet) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
-	fileNum, fileOff := scanBlockFiles(basePath)
+	firstFileNum := firstBlockFile(basePath)
+	fileNum, fileOff := scanBlockFiles(basePath, firstFileNum)
 	if fileNum == -1 {
-		fileNum = 0
+		fileNum = int(firstFileNum)
 		fileOff = 0
 	}
 
 	store := &blockStore{
 		network:          network,
 		basePath:         basePath,
+		firstFileNum:     firstFileNum,
 		maxBlockFileSize: maxBlockFileSize,
 		openBlockFiles:   make(map[uint32]*lockableFile),
 		openBlocksLRU:    list.New(),
@@ -968,6 +968,9 @@ type transaction struct {
 	pendingBlocks    map[chainhash.Hash]int
 	pendingBlockData []pendingBlock
 
+	// Block files that need to be removed on commit.
+	pendingPrunes []uint32
+
 	// Keys that need to be stored or deleted on commit.
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
@@ -1629,6 +1632,110 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 	return blockRegions, nil
 }
 
+// PruneBlocks removes the oldest flat block files, other than the one currently
+// being written, until the total size of all block files is no more than the
+// provided target size in bytes.  A file is only removed when the passed
+// function returns true for every block it houses and pruning stops at the
+// first file that can't be removed, so the remaining blocks are always the
+// most recently stored ones.  The hashes of all removed blocks are returned.
+//
+// The block index entries for the removed blocks are deleted immediately,
+// however the files themselves are not deleted until the transaction has been
+// committed and the metadata flushed to persistent storage.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, canPrune func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Determine the total size of the block files that are not already
+	// pending removal.  The current write file number is only modified
+	// during write transactions, of which there can be only one at a time,
+	// so it's safe to use it after releasing the lock.
+	store := tx.db.store
+	wc := store.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+	firstFileNum := store.firstFileNum
+	if n := len(tx.pendingPrunes); n > 0 {
+		firstFileNum = tx.pendingPrunes[n-1] + 1
+	}
+	fileSizes := make(map[uint32]uint64)
+	var totalSize uint64
+	for fileNum := firstFileNum; fileNum <= curFileNum; fileNum++ {
+		size, err := store.fileSize(fileNum)
+		if err != nil {
+			return nil, err
+		}
+		fileSizes[fileNum] = size
+		totalSize += size
+	}
+	if totalSize <= targetSize {
+		return nil, nil
+	}
+
+	// Group the blocks in all files other than the current write file by
+	// the file that houses them.
+	fileBlocks := make(map[uint32][]chainhash.Hash)
+	err := tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+		loc := deserializeBlockLoc(v)
+		if loc.blockFileNum < firstFileNum || loc.blockFileNum >= curFileNum {
+			return nil
+		}
+
+		var hash chainhash.Hash
+		copy(hash[:], k)
+		fileBlocks[loc.blockFileNum] = append(fileBlocks[loc.blockFileNum],
+			hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the oldest files along with the block index entries for all
+	// of the blocks they house until the target size is reached.
+	var pruned []chainhash.Hash
+	for fileNum := firstFileNum; fileNum < curFileNum; fileNum++ {
+		if totalSize <= targetSize {
+			break
+		}
+
+		hashes := fileBlocks[fileNum]
+		for i := range hashes {
+			if !canPrune(&hashes[i]) {
+				return pruned, nil
+			}
+		}
+		for i := range hashes {
+			if err := tx.blockIdxBucket.Delete(hashes[i][:]); err != nil {
+				return nil, err
+			}
+		}
+
+		log.Tracef("Pruning block file %d with %d blocks", fileNum,
+			len(hashes))
+		tx.pendingPrunes = append(tx.pendingPrunes, fileNum)
+		pruned = append(pruned, hashes...)
+		totalSize -= fileSizes[fileNum]
+	}
+
+	return pruned, nil
+}
+
 // close marks the transaction closed then releases any pending data, the
 // underlying snapshot, the transaction read lock, and the write lock when the
 // transaction is writable.
@@ -1639,6 +1746,9 @@ func (tx *transaction) close() {
 	tx.pendingBlocks = nil
 	tx.pendingBlockData = nil
 
+	// Clear pending block files that would have been removed on commit.
+	tx.pendingPrunes = nil
+
 	// Clear pending keys that would have been written or deleted on commit.
 	tx.pendingKeys = nil
 	tx.pendingRemove = nil
@@ -1726,7 +1836,21 @@ func (tx *transaction) writePendingAndCommit() error {
 
 	// Atomically update the database cache.  The cache automatically
 	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		return err
+	}
+
+	// Remove any pruned block files.  The metadata is flushed to persistent
+	// storage first so an unexpected shutdown can never leave the block
+	// index referencing files that no longer exist.
+	if len(tx.pendingPrunes) > 0 {
+		if err := tx.db.cache.flush(); err != nil {
+			return err
+		}
+		tx.db.store.pruneFiles(tx.pendingPrunes)
+	}
+
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
@@ -1958,6 +2082,38 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// BlockStoreSize returns the total size in bytes of the block files which have
+// not been pruned.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) BlockStoreSize() (uint64, error) {
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		return 0, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+
+	// The first and current file numbers are only modified during write
+	// transactions, so hold the write lock while reading them.
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	store := db.store
+	wc := store.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+
+	var totalSize uint64
+	for fileNum := store.firstFileNum; fileNum <= curFileNum; fileNum++ {
+		size, err := store.fileSize(fileNum)
+		if err != nil {
+			return 0, err
+		}
+		totalSize += size
+	}
+	return totalSize, nil
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
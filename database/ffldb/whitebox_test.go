@@ -19,6 +19,8 @@ import (
 
 	"compress/gzip"
 	"encoding/json"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
 	"github.com/CommerciumBlockchain/cmmd/database"
 	"github.com/CommerciumBlockchain/cmmd/cmmutil"
 	"github.com/CommerciumBlockchain/cmmd/wire"
@@ -685,3 +687,146 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// TestPruneBlocks ensures pruning removes the oldest block files along with the
+// block index entries of the blocks they house, stops at the first file with a
+// block that may not be pruned, and that a pruned database can be reopened.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-prune")
+	_ = os.RemoveAll(dbPath)
+	idb, err := openDB(dbPath, blockDataNet, true)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	// Create blocks which all have the same size and limit the block files
+	// so each one is stored in its own file.
+	const numBlocks = 5
+	blocks := make([]*cmmutil.Block, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		msgBlock := *chaincfg.SimNetParams.GenesisBlock
+		msgBlock.Header.Nonce = uint32(i + 1)
+		blocks = append(blocks, cmmutil.NewBlock(&msgBlock))
+	}
+	blockBytes, err := blocks[0].Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: unexpected error: %v", err)
+	}
+	idb.(*db).store.maxBlockFileSize = uint32(len(blockBytes) + 12)
+	for _, block := range blocks {
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: unexpected error: %v", err)
+		}
+	}
+
+	// checkStoreSize ensures the size of the block store matches the size
+	// of the passed number of block files.
+	fileSize := uint64(len(blockBytes) + 12)
+	checkStoreSize := func(numFiles uint64) {
+		t.Helper()
+		size, err := idb.BlockStoreSize()
+		if err != nil {
+			t.Fatalf("BlockStoreSize: unexpected error: %v", err)
+		}
+		if size != numFiles*fileSize {
+			t.Fatalf("BlockStoreSize: unexpected size - got %d, "+
+				"want %d", size, numFiles*fileSize)
+		}
+	}
+	checkStoreSize(numBlocks)
+
+	// Ensure pruning requires a writable transaction.
+	testName := "PruneBlocks: read-only transaction"
+	err = idb.View(func(tx database.Tx) error {
+		_, err := tx.PruneBlocks(0, nil)
+		return err
+	})
+	if !checkDbError(t, testName, err, database.ErrTxNotWritable) {
+		idb.Close()
+		return
+	}
+
+	// Ensure nothing is pruned when the files are within the target size.
+	var pruned []chainhash.Hash
+	err = idb.Update(func(tx database.Tx) error {
+		var err error
+		pruned, err = tx.PruneBlocks(^uint64(0), nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("PruneBlocks: unexpected error: %v", err)
+	}
+	if len(pruned) != 0 {
+		t.Fatalf("PruneBlocks: unexpectedly pruned %d blocks", len(pruned))
+	}
+
+	// Prune everything possible while refusing to prune the third block and
+	// ensure only the files for the first two blocks are removed.
+	err = idb.Update(func(tx database.Tx) error {
+		var err error
+		pruned, err = tx.PruneBlocks(0, func(hash *chainhash.Hash) bool {
+			return *hash != *blocks[2].Hash()
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("PruneBlocks: unexpected error: %v", err)
+	}
+	if len(pruned) != 2 || pruned[0] != *blocks[0].Hash() ||
+		pruned[1] != *blocks[1].Hash() {
+
+		t.Fatalf("PruneBlocks: unexpected pruned blocks %v", pruned)
+	}
+	for i := uint32(0); i < 2; i++ {
+		if fileExists(blockFilePath(dbPath, i)) {
+			t.Fatalf("PruneBlocks: block file %d still exists", i)
+		}
+	}
+	checkStoreSize(numBlocks - 2)
+
+	// Ensure the database can be reopened with the pruned files and that
+	// only the remaining blocks are available.
+	idb.Close()
+	idb, err = openDB(dbPath, blockDataNet, false)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer idb.Close()
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			_, err := tx.FetchBlock(block.Hash())
+			if i < 2 {
+				testName := fmt.Sprintf("FetchBlock: pruned block %d", i)
+				if !checkDbError(t, testName, err,
+					database.ErrBlockNotFound) {
+
+					return errSubTestFail
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FetchBlock: unexpected error: %v", err)
+	}
+
+	// Ensure new blocks can still be stored after reopening.
+	msgBlock := *chaincfg.SimNetParams.GenesisBlock
+	msgBlock.Header.Nonce = numBlocks + 1
+	err = idb.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(cmmutil.NewBlock(&msgBlock))
+	})
+	if err != nil {
+		t.Fatalf("StoreBlock: unexpected error: %v", err)
+	}
+}
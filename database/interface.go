@@ -391,6 +391,26 @@ type Tx interface {
 	// implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
 
+	// PruneBlocks removes the oldest stored blocks until the total size of
+	// the block storage is no more than the provided target size in bytes.
+	// Blocks are removed in the order they were stored, and only when the
+	// passed function reports every block that must be removed along with
+	// them may be pruned, so the remaining blocks are always the most
+	// recently stored ones.  The hashes of all removed blocks are returned.
+	//
+	// Depending on the backend implementation, blocks are removed in
+	// groups, so the final storage size may be less than the target, and
+	// the most recent blocks are never removed even if the storage size
+	// exceeds the target.  The removed blocks are no longer available from
+	// this transaction, however the underlying storage is not released
+	// until the transaction is committed.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	PruneBlocks(targetSize uint64, canPrune func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error)
+
 	// ******************************************************************
 	// Methods related to both atomic metadata storage and block storage.
 	// ******************************************************************
@@ -461,6 +481,12 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// BlockStoreSize returns the total size in bytes of the stored block
+	// data which has not been pruned.  It does not require a transaction,
+	// so it provides a cheap way to determine whether or not pruning is
+	// needed.
+	BlockStoreSize() (uint64, error)
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
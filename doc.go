@@ -44,6 +44,36 @@ Application Options:
                             banning misbehaving peers.
       --whitelist=          Add an IP network or IP that will not be banned.
                             (eg. 192.168.1.0/24 or ::1)
+      --v2transport         Support the encrypted and authenticated v2 P2P
+                            transport and prefer it for outbound connections,
+                            falling back to the v1 protocol for peers that do
+                            not support it
+      --v2only              Only connect to and accept peers that use the v2
+                            P2P transport -- implies --v2transport
+      --dandelion           Relay transactions submitted via RPC with
+                            Dandelion++ to hide their origin and relay stem
+                            transactions for other peers
+      --dandelionepoch=     How often the Dandelion++ stem routes are changed.
+                            Valid time units are {s, m, h}.  Minimum 1 second
+                            (10m0s)
+      --maxuploadrate=      Max KiB per second sent to all non-whitelisted peers
+                            combined (0 = unlimited)
+      --maxdownloadrate=    Max KiB per second received from all
+                            non-whitelisted peers combined (0 = unlimited)
+      --maxpeeruploadrate=  Max KiB per second sent to each non-whitelisted
+                            peer (0 = unlimited)
+      --maxpeerdownloadrate= Max KiB per second received from each
+                            non-whitelisted peer (0 = unlimited)
+      --maxuploadtarget=    Try to keep the data sent to peers below the given
+                            number of MiB per 24h -- Historical blocks are no
+                            longer served to non-whitelisted peers once the
+                            target is about to be reached (0 = unlimited)
+      --capturepeer=        Record the messages sent to and received from peers
+                            with the given IP or IP network to rotating files
+                            in the msgcapture directory of the data directory
+                            (eg. 192.168.1.0/24 or ::1)
+      --capturemaxfilesize= Max MiB per message capture file (16)
+      --capturemaxfiles=    Max number of message capture files to keep (10)
   -u, --rpcuser=            Username for RPC connections
   -P, --rpcpass=            Password for RPC connections
       --rpclimituser=       Username for limited RPC connections
@@ -73,17 +103,34 @@ Application Options:
       --noonion             Disable connecting to tor hidden services
       --torisolation        Enable Tor stream isolation by randomizing user
                             credentials for each connection.
+      --torcontrol=         Create a tor onion service for the listener via the
+                            tor control port and advertise it
+                            (eg. 127.0.0.1:9051)
+      --torpassword=        Password for the tor control port -- NOTE: Cookie
+                            authentication is used when not specified
+      --i2pproxy=           Connect to I2P destinations via SOCKS5 proxy
+                            (eg. 127.0.0.1:4447)
+      --cjdnsreachable      Treat addresses in fc00::/8 as CJDNS addresses which
+                            can be connected to directly
       --testnet             Use the test network
       --simnet              Use the simulation test network
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
       --dbtype=             Database backend to use for the Block Chain (ffldb)
+      --prune=              Reduce disk usage by deleting the oldest blocks once
+                            the stored blocks exceed the specified target size
+                            in MiB (0 = disabled, minimum 550)
       --profile=            Enable HTTP profiling on given [addr:]port -- NOTE: port
                             must be between 1024 and 65536
       --cpuprofile=         Write CPU profile to the specified file
       --memprofile=         Write mem profile to the specified file
       --dumpblockchain=     Write blockchain as a gob-encoded map to the
                             specified file
+      --loadutxosnapshot=   Initialize a new block database from the utxo
+                            snapshot in the specified file -- The snapshot must
+                            be pinned by the network parameters
+      --verifyutxosnapshot  Verify the block headers leading up to an imported
+                            utxo snapshot in the background
       --miningtimeoffset=   Offset the mining timestamp of a block by this many
                             seconds (positive values are in the past)
   -d, --debuglevel=         Logging level for all subsystems {trace, debug,
@@ -101,6 +148,13 @@ Application Options:
                             high priority for relaying
       --maxorphantx=        Max number of orphan transactions to keep in memory
                             (1000)
+      --maxmempool=         Max MiB of transactions to keep in the memory pool
+                            -- The transactions paying the lowest fee rates are
+                            evicted beyond it and a quarter of it is reserved
+                            for stake transactions -- 0 to disable (300)
+      --persistmempool      Save the memory pool to mempool.dat in the data
+                            directory at shutdown and periodically and reload
+                            it on startup
       --generate            Generate (mine) bitcoins using the CPU
       --miningaddr=         Add the specified payment address to the list of
                             addresses to use for generated blocks -- At least
@@ -112,6 +166,12 @@ Application Options:
                             a block (750000)
       --blockprioritysize=  Size in bytes for high-priority/low-fee transactions
                             when creating a block (50000)
+      --stratumlisten=      Add an interface/port to listen for stratum mining
+                            connections (default port: 9112, testnet: 19112)
+      --stratumdiff=        Initial share difficulty assigned to each stratum
+                            miner (1)
+      --stratumvardiff=     Interval at which the share difficulty of each
+                            stratum miner is retargeted, 0 to disable (2m0s)
       --getworkkey=         DEPRECATED -- Use the --miningaddr option instead
       --nonaggressive       Disable mining off of the parent block of the blockchain
                             if there aren't enough voters
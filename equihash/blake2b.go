@@ -0,0 +1,155 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package equihash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The standard library and golang.org/x/crypto/blake2b do not expose the
+// BLAKE2b parameter block, which Equihash needs in order to set the
+// personalization string.  This file provides the small subset of BLAKE2b
+// required by the verifier: parameter block initialization, streaming updates
+// and finalization with a variable digest length.
+
+const (
+	blake2bBlockSize = 128
+	blake2bMaxSize   = 64
+)
+
+var blake2bIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b,
+	0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f,
+	0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var blake2bSigma = [12][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+}
+
+// blake2bState houses the streaming state of a BLAKE2b hash.  It is a plain
+// value type so a midstate can be cheaply copied and reused.
+type blake2bState struct {
+	h      [8]uint64
+	t      [2]uint64
+	buf    [blake2bBlockSize]byte
+	buflen int
+	outlen int
+}
+
+// newBlake2bPersonal returns a BLAKE2b state initialized with a parameter
+// block which uses the provided digest length and 16-byte personalization
+// and a fanout and depth of one (sequential mode).
+func newBlake2bPersonal(outlen int, personal [16]byte) blake2bState {
+	var p [64]byte
+	p[0] = byte(outlen)
+	p[2] = 1 // fanout
+	p[3] = 1 // depth
+	copy(p[48:], personal[:])
+
+	var s blake2bState
+	for i := range s.h {
+		s.h[i] = blake2bIV[i] ^ binary.LittleEndian.Uint64(p[i*8:])
+	}
+	s.outlen = outlen
+	return s
+}
+
+// update adds more data to the running hash.
+func (s *blake2bState) update(data []byte) {
+	for len(data) > 0 {
+		// The final block must be retained for finalization, so only
+		// compress a full buffer once more input is known to follow.
+		if s.buflen == blake2bBlockSize {
+			s.incrementCounter(blake2bBlockSize)
+			s.compress(s.buf[:], false)
+			s.buflen = 0
+		}
+		n := copy(s.buf[s.buflen:], data)
+		s.buflen += n
+		data = data[n:]
+	}
+}
+
+// final returns the digest of all data added so far.  The state is not
+// modified.
+func (s blake2bState) final() []byte {
+	s.incrementCounter(uint64(s.buflen))
+	for i := s.buflen; i < blake2bBlockSize; i++ {
+		s.buf[i] = 0
+	}
+	s.compress(s.buf[:], true)
+
+	var out [blake2bMaxSize]byte
+	for i, v := range s.h {
+		binary.LittleEndian.PutUint64(out[i*8:], v)
+	}
+	return out[:s.outlen]
+}
+
+// incrementCounter adds n to the 128-bit byte counter.
+func (s *blake2bState) incrementCounter(n uint64) {
+	s.t[0] += n
+	if s.t[0] < n {
+		s.t[1]++
+	}
+}
+
+// compress runs the BLAKE2b compression function over a single block.
+func (s *blake2bState) compress(block []byte, last bool) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+
+	var v [16]uint64
+	copy(v[:8], s.h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= s.t[0]
+	v[13] ^= s.t[1]
+	if last {
+		v[14] = ^v[14]
+	}
+
+	g := func(a, b, c, d int, x, y uint64) {
+		v[a] = v[a] + v[b] + x
+		v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+		v[c] = v[c] + v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+		v[a] = v[a] + v[b] + y
+		v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+		v[c] = v[c] + v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+	}
+
+	for r := 0; r < 12; r++ {
+		sigma := &blake2bSigma[r]
+		g(0, 4, 8, 12, m[sigma[0]], m[sigma[1]])
+		g(1, 5, 9, 13, m[sigma[2]], m[sigma[3]])
+		g(2, 6, 10, 14, m[sigma[4]], m[sigma[5]])
+		g(3, 7, 11, 15, m[sigma[6]], m[sigma[7]])
+		g(0, 5, 10, 15, m[sigma[8]], m[sigma[9]])
+		g(1, 6, 11, 12, m[sigma[10]], m[sigma[11]])
+		g(2, 7, 8, 13, m[sigma[12]], m[sigma[13]])
+		g(3, 4, 9, 14, m[sigma[14]], m[sigma[15]])
+	}
+
+	for i := range s.h {
+		s.h[i] ^= v[i] ^ v[i+8]
+	}
+}
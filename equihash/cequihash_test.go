@@ -0,0 +1,109 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build cgo
+
+package equihash
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/cequihash"
+)
+
+// checkAgreement fails the test when the pure Go and cequihash verifiers
+// disagree about the provided solution.
+func checkAgreement(t *testing.T, desc string, n, k int, input []byte, nonce int64, solution []byte) bool {
+	t.Helper()
+
+	want := cequihash.ValidateEquihash(n, k, input, nonce, solution)
+	got := Verify(n, k, input, nonce, solution) == nil
+	if got != want {
+		t.Errorf("%s: implementations disagree: cequihash %v, pure go %v",
+			desc, want, got)
+		return false
+	}
+	return true
+}
+
+// TestDifferentialVectors ensures both implementations agree on every test
+// vector.
+func TestDifferentialVectors(t *testing.T) {
+	for i, test := range validatorTests {
+		solution := SolutionFromIndices(test.n, test.k, test.solution)
+		checkAgreement(t, "validator vector", test.n, test.k, test.I,
+			int64(test.nonce), solution)
+		if test.valid != Validate(test.n, test.k, test.I,
+			int64(test.nonce), solution) {
+
+			t.Errorf("validator vector #%d: unexpected result", i)
+		}
+	}
+
+	for _, test := range solutionTests {
+		for _, indices := range test.solutions {
+			solution := SolutionFromIndices(test.n, test.k, indices)
+			checkAgreement(t, "solver vector", test.n, test.k, test.I,
+				int64(test.nonce), solution)
+		}
+	}
+}
+
+// TestDifferentialMutations ensures both implementations agree on randomly
+// mutated solutions, inputs and nonces derived from valid solutions.
+func TestDifferentialMutations(t *testing.T) {
+	const iterations = 200
+
+	rng := rand.New(rand.NewSource(0x65717569))
+	for _, test := range solutionTests {
+		for _, indices := range test.solutions {
+			nonce := int64(test.nonce)
+			valid := SolutionFromIndices(test.n, test.k, indices)
+			for i := 0; i < iterations; i++ {
+				input := append([]byte(nil), test.I...)
+				solution := append([]byte(nil), valid...)
+				mutNonce := nonce
+
+				switch rng.Intn(6) {
+				// Flip a single bit of the solution.
+				case 0:
+					bit := rng.Intn(len(solution) * 8)
+					solution[bit/8] ^= 1 << uint(bit%8)
+
+				// Swap two random indices.
+				case 1:
+					mutated := IndicesFromSolution(test.n, test.k, solution)
+					a, b := rng.Intn(len(mutated)), rng.Intn(len(mutated))
+					mutated[a], mutated[b] = mutated[b], mutated[a]
+					solution = SolutionFromIndices(test.n, test.k, mutated)
+
+				// Replace an index with a random value.
+				case 2:
+					mutated := IndicesFromSolution(test.n, test.k, solution)
+					mutated[rng.Intn(len(mutated))] = rng.Uint32()
+					solution = SolutionFromIndices(test.n, test.k, mutated)
+
+				// Change a byte of the input.
+				case 3:
+					input[rng.Intn(len(input))] ^= byte(rng.Intn(255) + 1)
+
+				// Change the nonce.
+				case 4:
+					mutNonce = nonce + int64(rng.Intn(1000)) + 1
+
+				// Randomize a byte of the solution.
+				case 5:
+					solution[rng.Intn(len(solution))] = byte(rng.Intn(256))
+				}
+
+				if !checkAgreement(t, "mutation", test.n, test.k, input,
+					mutNonce, solution) {
+
+					return
+				}
+			}
+		}
+	}
+}
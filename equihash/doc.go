@@ -0,0 +1,27 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package equihash implements Equihash proof-of-work solution validation and
+solving in pure Go.
+
+Equihash(N, K) solutions are lists of 2^K indices into a set of BLAKE2b hashes
+personalized with "ZcashPoW" and the N and K parameters.  A solution is valid
+when the hashes of all indices xor to zero, every intermediate pair of subtrees
+collides on the leading N/(K+1) bit digits, the indices are unique and the left
+subtree of every pair starts with a smaller index than the right one.
+
+This package mirrors the validation semantics of the cgo based cequihash
+package so that nodes can be built without cgo, for instance when
+cross-compiling or producing static binaries.  Verify always uses the pure Go
+implementation, while Solve and Validate call into cequihash when cgo is
+available and fall back to the pure Go implementation when cgo is disabled or
+the purego build tag is provided.  The blockchain package, the CPU miner, the
+stratum server and the test chain generator all go through Solve and Validate.
+
+A straightforward solver implementing the Wagner algorithm is provided as well.
+It keeps every partial solution in memory, so it is primarily intended for the
+small parameters of the test networks and for builds without cgo.
+*/
+package equihash
@@ -0,0 +1,264 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package equihash
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// MaxInputLen is the maximum number of input (header) bytes that may be
+// hashed together with the nonce.  It matches the limit enforced by the
+// cequihash implementation.
+const MaxInputLen = 180
+
+var (
+	// ErrInvalidInputLength signifies that the input to be verified is
+	// longer than MaxInputLen.
+	ErrInvalidInputLength = errors.New("equihash input is too long")
+
+	// ErrDuplicateIndices signifies that the solution contains a repeated
+	// index or an index outside of the valid range.
+	ErrDuplicateIndices = errors.New("equihash solution has duplicate " +
+		"or out of range indices")
+
+	// ErrOutOfOrder signifies that the solution indices do not satisfy the
+	// Wagner algorithm binding ordering.
+	ErrOutOfOrder = errors.New("equihash solution indices are out of " +
+		"order")
+
+	// ErrNonZeroXor signifies that the hashes referenced by the solution do
+	// not collide on the required number of bits.
+	ErrNonZeroXor = errors.New("equihash solution does not xor to zero")
+
+	// ErrSolutionSize signifies that the solution does not have the size
+	// required by the Equihash parameters.
+	ErrSolutionSize = errors.New("equihash solution has unexpected size")
+
+	// ErrUnknownParams signifies that the requested Equihash parameters are
+	// not supported.
+	ErrUnknownParams = errors.New("unsupported equihash parameters")
+)
+
+// supportedParams lists the (N, K) pairs accepted by the verifier.  They are
+// the same pairs supported by the cequihash solver and verifier so that both
+// implementations agree on every input.
+var supportedParams = map[int]int{
+	48:  5,
+	96:  5,
+	144: 5,
+	200: 9,
+}
+
+// params houses the values derived from Equihash (N, K) which are needed
+// during verification.
+type params struct {
+	n, k           int
+	collisionBits  int
+	proofSize      int
+	hashLen        int
+	hashesPerBlake int
+	hashOutLen     int
+}
+
+// newParams returns the derived parameters for Equihash (N, K) or
+// ErrUnknownParams when the pair is not supported.
+func newParams(n, k int) (*params, error) {
+	if n <= 0 || k <= 0 {
+		return nil, ErrUnknownParams
+	}
+	if wantK, ok := supportedParams[n]; !ok || wantK != k {
+		return nil, ErrUnknownParams
+	}
+
+	hashesPerBlake := 512 / n
+	return &params{
+		n:              n,
+		k:              k,
+		collisionBits:  n / (k + 1),
+		proofSize:      1 << uint(k),
+		hashLen:        n / 8,
+		hashesPerBlake: hashesPerBlake,
+		hashOutLen:     hashesPerBlake * n / 8,
+	}, nil
+}
+
+// SolutionSize returns the size in bytes of a compressed Equihash solution
+// for the given parameters.
+func SolutionSize(n, k int) int {
+	return 1 << uint32(k) * (n/(k+1) + 1) / 8
+}
+
+// IndicesFromSolution expands a compressed solution into the list of indices
+// it encodes.  Each index occupies N/(K+1)+1 bits of the solution in
+// big-endian bit order.
+func IndicesFromSolution(n, k int, solution []byte) []uint32 {
+	bitLen := uint(n/(k+1) + 1)
+	numIndices := len(solution) * 8 / int(bitLen)
+	indices := make([]uint32, 0, numIndices)
+
+	var acc uint64
+	var accBits uint
+	mask := uint64(1)<<bitLen - 1
+	for _, b := range solution {
+		acc = acc<<8 | uint64(b)
+		accBits += 8
+		if accBits >= bitLen {
+			accBits -= bitLen
+			indices = append(indices, uint32(acc>>accBits&mask))
+		}
+	}
+	return indices
+}
+
+// SolutionFromIndices compresses a list of indices into the minimal solution
+// encoding.  It is the inverse of IndicesFromSolution.
+func SolutionFromIndices(n, k int, indices []uint32) []byte {
+	bitLen := uint(n/(k+1) + 1)
+	solution := make([]byte, 0, len(indices)*int(bitLen)/8)
+
+	var acc uint64
+	var accBits uint
+	mask := uint64(1)<<bitLen - 1
+	for _, index := range indices {
+		acc = acc<<bitLen | uint64(index)&mask
+		accBits += bitLen
+		for accBits >= 8 {
+			accBits -= 8
+			solution = append(solution, byte(acc>>accBits))
+		}
+	}
+	return solution
+}
+
+// initState returns the BLAKE2b midstate after hashing the input and the
+// optional nonce.  A negative nonce means the input already contains it.
+func initState(p *params, input []byte, nonce int64) blake2bState {
+	var personal [16]byte
+	copy(personal[:], "ZcashPoW")
+	binary.LittleEndian.PutUint32(personal[8:], uint32(p.n))
+	binary.LittleEndian.PutUint32(personal[12:], uint32(p.k))
+
+	state := newBlake2bPersonal(p.hashOutLen, personal)
+	state.update(input)
+	if nonce >= 0 {
+		var expandedNonce [32]byte
+		binary.LittleEndian.PutUint32(expandedNonce[:], uint32(nonce))
+		state.update(expandedNonce[:])
+	}
+	return state
+}
+
+// generateDigest returns the BLAKE2b digest which contains the hashes of the
+// provided index and its neighbours.
+func generateDigest(p *params, state *blake2bState, index uint32) []byte {
+	var leb [4]byte
+	binary.LittleEndian.PutUint32(leb[:], index/uint32(p.hashesPerBlake))
+
+	s := *state
+	s.update(leb[:])
+	return s.final()
+}
+
+// generateHash returns the N/8 byte hash for the provided index.
+func generateHash(p *params, state *blake2bState, index uint32) []byte {
+	digest := generateDigest(p, state, index)
+	offset := int(index%uint32(p.hashesPerBlake)) * p.hashLen
+	return digest[offset : offset+p.hashLen]
+}
+
+// hasDuplicates returns whether the indices contain a repeated value or a
+// value which can not be encoded in N/(K+1)+1 bits.
+func hasDuplicates(p *params, indices []uint32) bool {
+	sorted := make([]uint32, len(indices))
+	copy(sorted, indices)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	maxValue := uint32(1)<<uint(p.collisionBits+1) - 1
+	for i, index := range sorted {
+		if index > maxValue {
+			return true
+		}
+		if i > 0 && index <= sorted[i-1] {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyTree recursively checks the subtree of 2^r indices, writing the xor
+// of their hashes to hash.  Ordering is checked before descending so that the
+// first failure reported matches the cequihash implementation.
+func verifyTree(p *params, state *blake2bState, indices []uint32, hash []byte, r int) error {
+	if r == 0 {
+		copy(hash, generateHash(p, state, indices[0]))
+		return nil
+	}
+
+	half := 1 << uint(r-1)
+	if indices[0] >= indices[half] {
+		return ErrOutOfOrder
+	}
+
+	hash0 := make([]byte, p.hashLen)
+	hash1 := make([]byte, p.hashLen)
+	if err := verifyTree(p, state, indices[:half], hash0, r-1); err != nil {
+		return err
+	}
+	if err := verifyTree(p, state, indices[half:], hash1, r-1); err != nil {
+		return err
+	}
+	for i := range hash {
+		hash[i] = hash0[i] ^ hash1[i]
+	}
+
+	// Every intermediate step must collide on the leading r digits while
+	// the final step must xor to zero entirely.
+	zeroBits := p.n
+	if r < p.k {
+		zeroBits = r * p.collisionBits
+	}
+	i := 0
+	for ; i < zeroBits/8; i++ {
+		if hash[i] != 0 {
+			return ErrNonZeroXor
+		}
+	}
+	if rem := uint(zeroBits % 8); rem != 0 && hash[i]>>(8-rem) != 0 {
+		return ErrNonZeroXor
+	}
+	return nil
+}
+
+// Verify checks the compressed Equihash(N, K) solution for the provided input
+// and nonce and returns an error describing the first rule it violates, if
+// any.  A negative nonce indicates the nonce is already part of the input.
+//
+// Only the first SolutionSize(n, k) bytes of the solution are considered.
+func Verify(n, k int, input []byte, nonce int64, solution []byte) error {
+	p, err := newParams(n, k)
+	if err != nil {
+		return err
+	}
+	if len(solution) < SolutionSize(n, k) {
+		return ErrSolutionSize
+	}
+	if len(input) > MaxInputLen {
+		return ErrInvalidInputLength
+	}
+
+	indices := IndicesFromSolution(n, k, solution[:SolutionSize(n, k)])
+	if len(indices) != p.proofSize {
+		return ErrSolutionSize
+	}
+	if hasDuplicates(p, indices) {
+		return ErrDuplicateIndices
+	}
+
+	state := initState(p, input, nonce)
+	hash := make([]byte, p.hashLen)
+	return verifyTree(p, &state, indices, hash, k)
+}
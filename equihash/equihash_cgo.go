@@ -0,0 +1,57 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build cgo,!purego
+
+package equihash
+
+import (
+	"unsafe"
+
+	"github.com/CommerciumBlockchain/cmmd/cequihash"
+)
+
+// solutionCallback adapts a SolutionFunc to the callback interface of the
+// cequihash solver.
+type solutionCallback struct {
+	n, k int
+	fn   SolutionFunc
+}
+
+// Validate extracts the solution found by the cequihash solver, if any, and
+// passes it to the solution function.  It returns 1 when the solver should
+// stop.
+func (cb solutionCallback) Validate(solution unsafe.Pointer) int {
+	var solutionBytes []byte
+	if uintptr(solution) != 0 {
+		solutionBytes = cequihash.ExtractSolution(cb.n, cb.k, solution)
+	}
+	if cb.fn(solutionBytes) {
+		return 1
+	}
+	return 0
+}
+
+// Solve runs the cgo backed cequihash solver for Equihash(N, K) over the
+// provided input and nonce, calling fn with every solution found and
+// periodically with a nil solution until fn returns true or the search space
+// is exhausted.  Build with the purego tag or with cgo disabled to use the pure
+// Go solver instead.
+func Solve(n, k int, input []byte, nonce int64, fn SolutionFunc) error {
+	if _, err := newParams(n, k); err != nil {
+		return err
+	}
+	if len(input) > MaxInputLen {
+		return ErrInvalidInputLength
+	}
+	cequihash.SolveEquihash(n, k, input, nonce, solutionCallback{n, k, fn})
+	return nil
+}
+
+// Validate returns whether the compressed Equihash(N, K) solution is valid for
+// the provided input and nonce using the cgo backed cequihash implementation.
+// Build with the purego tag or with cgo disabled to use Verify instead.
+func Validate(n, k int, input []byte, nonce int64, solution []byte) bool {
+	return cequihash.ValidateEquihash(n, k, input, nonce, solution)
+}
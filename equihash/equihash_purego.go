@@ -0,0 +1,22 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !cgo purego
+
+package equihash
+
+// Solve runs the pure Go solver for Equihash(N, K) over the provided input and
+// nonce, calling fn with every solution found and periodically with a nil
+// solution until fn returns true or the search space is exhausted.  It is
+// selected when cgo is disabled or the purego build tag is set.
+func Solve(n, k int, input []byte, nonce int64, fn SolutionFunc) error {
+	return solve(n, k, input, nonce, fn)
+}
+
+// Validate returns whether the compressed Equihash(N, K) solution is valid for
+// the provided input and nonce using the pure Go verifier.  It is selected
+// when cgo is disabled or the purego build tag is set.
+func Validate(n, k int, input []byte, nonce int64, solution []byte) bool {
+	return Verify(n, k, input, nonce, solution) == nil
+}
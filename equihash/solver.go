@@ -0,0 +1,157 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package equihash
+
+import (
+	"sort"
+)
+
+// solveCheckInterval is the number of hashes generated in between checks of
+// whether the caller wants to stop the solver early.
+const solveCheckInterval = 1 << 14
+
+// SolutionFunc is the callback invoked by the solvers.  It is called with every
+// compressed solution found and periodically with a nil solution so callers
+// can check external exit conditions.  Returning true stops the solver as
+// soon as possible.
+//
+// The semantics intentionally match the callback of the cequihash solver.
+type SolutionFunc func(solution []byte) bool
+
+// solverRow is a partial solution of the Wagner algorithm: the xor of the
+// hashes of its indices along with the indices themselves in the order
+// required by the solution encoding.
+type solverRow struct {
+	hash    []byte
+	indices []uint32
+	key     uint64
+}
+
+// bitsAt returns the count bits of hash starting at bit offset start as an
+// unsigned integer.  Bits are numbered in big-endian order.
+func bitsAt(hash []byte, start, count int) uint64 {
+	var v uint64
+	for i := start; i < start+count; i++ {
+		v = v<<1 | uint64(hash[i/8]>>(7-uint(i%8))&1)
+	}
+	return v
+}
+
+// distinctIndices returns whether the two index lists have no index in common.
+func distinctIndices(a, b []uint32) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// combineRows returns the row resulting from joining the two rows, ordering
+// the indices so the subtree with the smaller first index is on the left.
+func combineRows(a, b *solverRow) solverRow {
+	if b.indices[0] < a.indices[0] {
+		a, b = b, a
+	}
+	hash := make([]byte, len(a.hash))
+	for i := range hash {
+		hash[i] = a.hash[i] ^ b.hash[i]
+	}
+	indices := make([]uint32, 0, len(a.indices)+len(b.indices))
+	indices = append(indices, a.indices...)
+	indices = append(indices, b.indices...)
+	return solverRow{hash: hash, indices: indices}
+}
+
+// solve runs the Wagner algorithm for Equihash(N, K) over the provided input
+// and nonce, calling fn with every solution found until fn returns true or the
+// search space is exhausted.  A negative nonce indicates the nonce is already
+// part of the input.
+//
+// The solver keeps every partial solution in memory and is intended for the
+// small parameters used by the test networks and for builds without cgo.  The
+// cequihash solver is considerably faster for the main network parameters.
+func solve(n, k int, input []byte, nonce int64, fn SolutionFunc) error {
+	p, err := newParams(n, k)
+	if err != nil {
+		return err
+	}
+	if len(input) > MaxInputLen {
+		return ErrInvalidInputLength
+	}
+
+	// Generate the hashes of every index.  Each BLAKE2b digest provides the
+	// hashes of several consecutive indices.
+	state := initState(p, input, nonce)
+	numIndices := uint32(1) << uint(p.collisionBits+1)
+	rows := make([]solverRow, 0, numIndices)
+	var digest []byte
+	for i := uint32(0); i < numIndices; i++ {
+		if i%solveCheckInterval == 0 && fn(nil) {
+			return nil
+		}
+		offset := int(i%uint32(p.hashesPerBlake)) * p.hashLen
+		if offset == 0 {
+			digest = generateDigest(p, &state, i)
+		}
+		hash := make([]byte, p.hashLen)
+		copy(hash, digest[offset:offset+p.hashLen])
+		rows = append(rows, solverRow{hash: hash, indices: []uint32{i}})
+	}
+
+	// Every round joins the rows which collide on the next digit.  The
+	// final round requires a collision on the last two digits which, since
+	// all of the previous digits are already zero, results in a zero xor.
+	for r := 1; r <= p.k; r++ {
+		if fn(nil) {
+			return nil
+		}
+
+		start := (r - 1) * p.collisionBits
+		count := p.collisionBits
+		if r == p.k {
+			count = 2 * p.collisionBits
+		}
+		for i := range rows {
+			rows[i].key = bitsAt(rows[i].hash, start, count)
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].key < rows[j].key
+		})
+
+		var next []solverRow
+		for i := 0; i < len(rows); {
+			j := i + 1
+			for j < len(rows) && rows[j].key == rows[i].key {
+				j++
+			}
+			for a := i; a < j; a++ {
+				for b := a + 1; b < j; b++ {
+					if !distinctIndices(rows[a].indices, rows[b].indices) {
+						continue
+					}
+					next = append(next, combineRows(&rows[a], &rows[b]))
+				}
+			}
+			i = j
+		}
+		rows = next
+	}
+
+	// Only report solutions which pass full verification so the ordering
+	// of equal subtrees and any remaining bits are accounted for.
+	for i := range rows {
+		solution := SolutionFromIndices(p.n, p.k, rows[i].indices)
+		if Verify(p.n, p.k, input, nonce, solution) != nil {
+			continue
+		}
+		if fn(solution) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package equihash
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSolve ensures the solver finds exactly the solutions found by the
+// reference solver for the Equihash(96, 5) test vectors.
+func TestSolve(t *testing.T) {
+	for i, test := range solutionTests {
+		if test.n != 96 {
+			continue
+		}
+
+		var found [][]byte
+		err := solve(test.n, test.k, test.I, int64(test.nonce),
+			func(solution []byte) bool {
+				if solution != nil {
+					found = append(found, solution)
+				}
+				return false
+			})
+		if err != nil {
+			t.Fatalf("test #%d: unexpected error: %v", i, err)
+		}
+		if len(found) != len(test.solutions) {
+			t.Fatalf("test #%d: unexpected number of solutions: got %d, "+
+				"want %d", i, len(found), len(test.solutions))
+		}
+		for j, indices := range test.solutions {
+			want := SolutionFromIndices(test.n, test.k, indices)
+			var ok bool
+			for _, solution := range found {
+				if bytes.Equal(solution, want) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				t.Fatalf("test #%d: reference solution #%d not found",
+					i, j)
+			}
+		}
+	}
+}
+
+// TestSolveStop ensures the solver stops as soon as the callback asks it to
+// and rejects unsupported parameters.
+func TestSolveStop(t *testing.T) {
+	var calls int
+	err := solve(96, 5, []byte("block header"), 0, func([]byte) bool {
+		calls++
+		return true
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("solver did not stop: callback called %d times", calls)
+	}
+
+	err = solve(100, 5, nil, 0, func([]byte) bool { return false })
+	if err != ErrUnknownParams {
+		t.Fatalf("unexpected error: got %v, want %v", err,
+			ErrUnknownParams)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/addrmgr"
+)
+
+const (
+	// evictionProtectNetGroups is the number of inbound peers from distinct
+	// network groups which are protected from eviction.
+	evictionProtectNetGroups = 4
+
+	// evictionProtectPing is the number of inbound peers with the lowest
+	// ping times which are protected from eviction.
+	evictionProtectPing = 8
+
+	// evictionProtectTxs is the number of inbound peers which most recently
+	// sent novel transactions that are protected from eviction.
+	evictionProtectTxs = 4
+
+	// evictionProtectBlocks is the number of inbound peers which most
+	// recently sent novel blocks that are protected from eviction.
+	evictionProtectBlocks = 4
+)
+
+// evictionCandidate houses the details of an inbound peer which are used to
+// decide whether it is evicted to make room for a new inbound peer.
+type evictionCandidate struct {
+	sp            *serverPeer
+	netGroup      string
+	keyedNetGroup uint64
+	pingMicros    int64
+	timeConnected time.Time
+	lastBlockTime time.Time
+	lastTxTime    time.Time
+}
+
+// keyedNetGroup returns the network group of the passed peer hashed with the
+// passed secret key.  Since remote peers do not know the key, they are unable
+// to predict which network groups are protected from eviction.
+func keyedNetGroup(key *[32]byte, netGroup string) uint64 {
+	h := sha256.New()
+	h.Write(key[:])
+	h.Write([]byte(netGroup))
+	return binary.LittleEndian.Uint64(h.Sum(nil)[:8])
+}
+
+// newEvictionCandidate returns the eviction details of the passed peer.
+func newEvictionCandidate(sp *serverPeer, key *[32]byte) *evictionCandidate {
+	netGroup := addrmgr.GroupKey(sp.NA())
+	return &evictionCandidate{
+		sp:            sp,
+		netGroup:      netGroup,
+		keyedNetGroup: keyedNetGroup(key, netGroup),
+		pingMicros:    sp.LastPingMicros(),
+		timeConnected: sp.TimeConnected(),
+		lastBlockTime: sp.LastBlockTime(),
+		lastTxTime:    sp.LastTxTime(),
+	}
+}
+
+// protectCandidates sorts the passed candidates such that the ones to protect
+// come last and returns the candidates without the passed number of them.
+func protectCandidates(candidates []*evictionCandidate, n int, less func(a, b *evictionCandidate) bool) []*evictionCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(candidates[i], candidates[j])
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	return candidates[:len(candidates)-n]
+}
+
+// selectPeerToEvict returns the inbound peer to disconnect in order to make room
+// for a new inbound peer, or nil when all of the passed candidates are
+// protected.
+//
+// Peers are protected by properties which are difficult for an attacker to
+// forge in order to prevent it from taking over all of the inbound slots.  The
+// peers from a few network groups chosen by a secret key, the peers with the
+// lowest ping times, the peers which most recently relayed novel transactions
+// and blocks, and half of the remaining peers which have been connected the
+// longest are protected.  The most recently connected peer from the network
+// group with the most remaining peers is then evicted.
+func selectPeerToEvict(candidates []*evictionCandidate) *evictionCandidate {
+	candidates = append([]*evictionCandidate(nil), candidates...)
+
+	candidates = protectCandidates(candidates, evictionProtectNetGroups,
+		func(a, b *evictionCandidate) bool {
+			return a.keyedNetGroup < b.keyedNetGroup
+		})
+
+	// Peers without a measured ping time are treated as the slowest.
+	candidates = protectCandidates(candidates, evictionProtectPing,
+		func(a, b *evictionCandidate) bool {
+			if a.pingMicros == 0 || b.pingMicros == 0 {
+				return a.pingMicros == 0 && b.pingMicros != 0
+			}
+			return a.pingMicros > b.pingMicros
+		})
+
+	candidates = protectCandidates(candidates, evictionProtectTxs,
+		func(a, b *evictionCandidate) bool {
+			return a.lastTxTime.Before(b.lastTxTime)
+		})
+
+	candidates = protectCandidates(candidates, evictionProtectBlocks,
+		func(a, b *evictionCandidate) bool {
+			return a.lastBlockTime.Before(b.lastBlockTime)
+		})
+
+	candidates = protectCandidates(candidates, len(candidates)/2,
+		func(a, b *evictionCandidate) bool {
+			return a.timeConnected.After(b.timeConnected)
+		})
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Find the network group with the most remaining peers along with the
+	// most recently connected peer of each group.  Ties are broken in favor
+	// of evicting from the group with the most recently connected peer.
+	counts := make(map[string]int)
+	youngest := make(map[string]*evictionCandidate)
+	for _, c := range candidates {
+		counts[c.netGroup]++
+		y, ok := youngest[c.netGroup]
+		if !ok || c.timeConnected.After(y.timeConnected) {
+			youngest[c.netGroup] = c
+		}
+	}
+	var evict *evictionCandidate
+	for netGroup, y := range youngest {
+		if evict == nil || counts[netGroup] > counts[evict.netGroup] ||
+			(counts[netGroup] == counts[evict.netGroup] &&
+				y.timeConnected.After(evict.timeConnected)) {
+
+			evict = y
+		}
+	}
+	return evict
+}
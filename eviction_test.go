@@ -0,0 +1,88 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSelectPeerToEvict ensures inbound peers are protected from eviction by
+// the expected properties and that the peer which is evicted is the most
+// recently connected peer of the largest network group.
+func TestSelectPeerToEvict(t *testing.T) {
+	now := time.Now()
+	var key [32]byte
+
+	// newCandidates returns the passed number of candidates from distinct
+	// network groups which were connected one second apart, such that the
+	// last candidate is the most recently connected.
+	newCandidates := func(n int) []*evictionCandidate {
+		candidates := make([]*evictionCandidate, 0, n)
+		for i := 0; i < n; i++ {
+			netGroup := fmt.Sprintf("10.%d", i)
+			candidates = append(candidates, &evictionCandidate{
+				netGroup:      netGroup,
+				keyedNetGroup: keyedNetGroup(&key, netGroup),
+				timeConnected: now.Add(time.Duration(i-n) * time.Second),
+			})
+		}
+		return candidates
+	}
+
+	// Ensure no peer is evicted when all of them are protected.
+	protected := evictionProtectNetGroups + evictionProtectPing +
+		evictionProtectTxs + evictionProtectBlocks
+	if evict := selectPeerToEvict(newCandidates(protected)); evict != nil {
+		t.Fatalf("evicted peer %s although all peers are protected",
+			evict.netGroup)
+	}
+
+	// Ensure a peer from the network group with the most peers is evicted
+	// when an attacker connects many peers from the same network group,
+	// even when they are the fastest peers.
+	candidates := newCandidates(40)
+	var attackers []*evictionCandidate
+	for i := 0; i < 20; i++ {
+		attackers = append(attackers, &evictionCandidate{
+			netGroup:      "20.1",
+			keyedNetGroup: keyedNetGroup(&key, "20.1"),
+			pingMicros:    1,
+			timeConnected: now.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	candidates = append(candidates, attackers...)
+	evict := selectPeerToEvict(candidates)
+	if evict == nil || evict.netGroup != "20.1" {
+		t.Fatalf("evicted peer %v, want peer from attacking network "+
+			"group", evict)
+	}
+
+	// Ensure the most recently connected peer, which would otherwise be
+	// evicted, is protected by each of the properties.
+	tests := []struct {
+		name    string
+		protect func(c *evictionCandidate)
+	}{
+		{"ping", func(c *evictionCandidate) { c.pingMicros = 100 }},
+		{"novel tx", func(c *evictionCandidate) { c.lastTxTime = now }},
+		{"novel block", func(c *evictionCandidate) { c.lastBlockTime = now }},
+	}
+	for _, test := range tests {
+		candidates := newCandidates(40)
+		youngest := candidates[len(candidates)-1]
+		if evict := selectPeerToEvict(candidates); evict != youngest {
+			t.Fatalf("%s: evicted peer %v, want most recently "+
+				"connected peer", test.name, evict)
+		}
+		test.protect(youngest)
+		evict := selectPeerToEvict(candidates)
+		if evict == nil || evict == youngest {
+			t.Fatalf("%s: evicted peer %v, want unprotected peer",
+				test.name, evict)
+		}
+	}
+}
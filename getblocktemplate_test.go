@@ -0,0 +1,195 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmjson"
+	"github.com/CommerciumBlockchain/cmmd/equihash"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestGBTHeaderOffsets ensures the nonce, extra data and equihash solution
+// offsets reported by getblocktemplate locate the respective fields within the
+// serialized block header.
+func TestGBTHeaderOffsets(t *testing.T) {
+	header := wire.BlockHeader{
+		Version:      1,
+		PrevBlock:    chainhash.Hash{0x01},
+		Height:       100,
+		Timestamp:    time.Unix(0x5a000000, 0),
+		Nonce:        0x04030201,
+		StakeVersion: 0x08070605,
+	}
+	for i := range header.ExtraData {
+		header.ExtraData[i] = byte(0x40 + i)
+	}
+	for i := range header.EquihashSolution {
+		header.EquihashSolution[i] = byte(0x80 + i)
+	}
+	headerBytes, err := header.Bytes()
+	if err != nil {
+		t.Fatalf("unable to serialize header: %v", err)
+	}
+	if len(headerBytes) != wire.MaxBlockHeaderPayload {
+		t.Fatalf("unexpected header size: got %d, want %d",
+			len(headerBytes), wire.MaxBlockHeaderPayload)
+	}
+
+	nonce := headerBytes[gbtNonceOffset : gbtNonceOffset+4]
+	if !bytes.Equal(nonce, []byte{0x01, 0x02, 0x03, 0x04}) {
+		t.Fatalf("unexpected nonce at offset %d: %x", gbtNonceOffset,
+			nonce)
+	}
+	extraData := headerBytes[gbtExtraDataOffset : gbtExtraDataOffset+
+		len(header.ExtraData)]
+	if !bytes.Equal(extraData, header.ExtraData[:]) {
+		t.Fatalf("unexpected extra data at offset %d: %x",
+			gbtExtraDataOffset, extraData)
+	}
+	stakeVersion := headerBytes[gbtSolutionOffset-4 : gbtSolutionOffset]
+	if !bytes.Equal(stakeVersion, []byte{0x05, 0x06, 0x07, 0x08}) {
+		t.Fatalf("unexpected stake version before the solution: %x",
+			stakeVersion)
+	}
+
+	// The solution makes up the remainder of the header.
+	solution := headerBytes[gbtSolutionOffset:]
+	if !bytes.Equal(solution, header.EquihashSolution[:]) {
+		t.Fatalf("unexpected solution at offset %d: got %d bytes",
+			gbtSolutionOffset, len(solution))
+	}
+}
+
+// TestGBTNotifyVote ensures long poll clients are notified of a new vote only
+// when it is for the block their template builds on.
+func TestGBTNotifyVote(t *testing.T) {
+	state := newGbtWorkState(nil)
+	prevHash := chainhash.Hash{0x01}
+	state.prevHash = &prevHash
+	state.Lock()
+	c := state.templateUpdateChan(&prevHash, 1)
+	state.Unlock()
+
+	// Votes on other blocks are ignored.  The notifications happen
+	// asynchronously, so give them some time.
+	state.NotifyVote(&chainhash.Hash{0x02})
+	select {
+	case <-c:
+		t.Fatal("long poll notified of a vote on another block")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	state.NotifyVote(&prevHash)
+	select {
+	case <-c:
+	case <-time.After(time.Second * 5):
+		t.Fatal("long poll not notified of a vote on its block")
+	}
+	state.Lock()
+	_, ok := state.notifyMap[prevHash]
+	state.Unlock()
+	if ok {
+		t.Fatal("notified long polls were not removed")
+	}
+}
+
+// TestGBTProposalBadSolution ensures block proposals with an invalid equihash
+// solution are rejected even though the proof of work is not checked.
+func TestGBTProposalBadSolution(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	bestHash := chainhash.Hash{0x01}
+	s := &rpcServer{
+		server: &server{
+			chainParams: params,
+			blockManager: &blockManager{
+				chainState: chainState{newestHash: &bestHash},
+			},
+		},
+	}
+
+	// Solve the header of the proposed block.  Not every header has a
+	// solution, so try the next nonce until one is found.
+	block := wire.NewMsgBlock(&wire.BlockHeader{
+		Version:   1,
+		PrevBlock: bestHash,
+		Bits:      params.PowLimitBits,
+		Timestamp: time.Unix(time.Now().Unix(), 0),
+	})
+	var solution []byte
+	for solution == nil {
+		if block.Header.Nonce == 100 {
+			t.Fatal("unable to solve header")
+		}
+		headerBytes, err := block.Header.SerializeAllHeaderBytes()
+		if err != nil {
+			t.Fatalf("unable to serialize header: %v", err)
+		}
+		err = equihash.Solve(params.N, params.K, headerBytes,
+			int64(block.Header.Nonce), func(s []byte) bool {
+				solution = s
+				return s != nil
+			})
+		if err != nil {
+			t.Fatalf("unable to solve header: %v", err)
+		}
+		if solution == nil {
+			block.Header.Nonce++
+		}
+	}
+	copy(block.Header.EquihashSolution[:], solution)
+	err := blockchain.ValidateEquihashSolution(&block.Header, params)
+	if err != nil {
+		t.Fatalf("solved header rejected: %v", err)
+	}
+
+	// propose returns the result of proposing the block.
+	propose := func() interface{} {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := block.Serialize(&buf); err != nil {
+			t.Fatalf("unable to serialize block: %v", err)
+		}
+		result, err := handleGetBlockTemplateProposal(s,
+			&cmmjson.TemplateRequest{
+				Mode: "proposal",
+				Data: hex.EncodeToString(buf.Bytes()),
+			})
+		if err != nil {
+			t.Fatalf("unexpected proposal error: %v", err)
+		}
+		return result
+	}
+
+	// A solution for another header is rejected.
+	block.Header.Nonce++
+	if result := propose(); result != "bad-equihash-solution" {
+		t.Fatalf("unexpected result for a solution of another header: "+
+			"got %v, want bad-equihash-solution", result)
+	}
+	block.Header.Nonce--
+
+	// A corrupted solution is rejected.
+	block.Header.EquihashSolution[0] ^= 0x01
+	if result := propose(); result != "bad-equihash-solution" {
+		t.Fatalf("unexpected result for a corrupted solution: got %v, "+
+			"want bad-equihash-solution", result)
+	}
+
+	// Proposals which do not build on the best block are rejected before
+	// their solution is checked.
+	block.Header.PrevBlock = chainhash.Hash{0x02}
+	if result := propose(); result != "bad-prevblk" {
+		t.Fatalf("unexpected result for another parent: got %v, want "+
+			"bad-prevblk", result)
+	}
+}
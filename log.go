@@ -69,6 +69,7 @@ var (
 	scrpLog = backendLog.Logger("SCRP")
 	srvrLog = backendLog.Logger("SRVR")
 	stkeLog = backendLog.Logger("STKE")
+	strmLog = backendLog.Logger("STRM")
 	txmpLog = backendLog.Logger("TXMP")
 )
 
@@ -102,6 +103,7 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"SCRP": scrpLog,
 	"SRVR": srvrLog,
 	"STKE": stkeLog,
+	"STRM": strmLog,
 	"TXMP": txmpLog,
 }
 
@@ -47,6 +47,8 @@ be an exhaustive list.
   - Reject non-fully-spent duplicate transactions
   - Reject coinbase transactions
   - Reject double spends (both from the chain and other transactions in pool)
+  - Replacement of regular transactions which signal it by transactions
+    spending the same coins which pay a higher fee (replace-by-fee)
   - Reject invalid transactions according to the network consensus rules
   - Full script execution and validation with signature cache support
   - Individual transaction query support
@@ -65,11 +67,14 @@ be an exhaustive list.
   - Max signature operations per transaction
   - Max orphan transaction size
   - Max number of orphan transactions allowed
+  - Max number of ancestors and descendants of transactions in the pool
 - Additional metadata tracking for each transaction
   - Timestamp when the transaction was added to the pool
   - Most recent block height when the transaction was added to the pool
   - The fee the transaction pays
   - The starting priority for the transaction
+  - Fee and priority deltas used to prioritize the transaction for inclusion
+    in blocks without changing the fee it pays
 - Manual control of transaction removal
   - Recursive removal of all dependent transactions
 
@@ -0,0 +1,468 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+)
+
+const (
+	// EstimateFeeDatabaseKey is the key that we use to store the fee
+	// estimator in the database.
+	EstimateFeeDatabaseKey = "estimatefee"
+
+	// DefaultEstimateFeeMaxConfirms is the maximum number of blocks a
+	// transaction is tracked for when waiting to be mined.  It is also the
+	// largest confirmation target estimates can be requested for.
+	DefaultEstimateFeeMaxConfirms = 32
+
+	// estimateFeeVersion is the current version of the serialized fee
+	// estimator state.
+	estimateFeeVersion = 1
+
+	// estimateFeeDecay is the factor all of the tracked statistics are
+	// multiplied by every time a block is registered.  It causes older
+	// observations to matter less than recent ones and results in a
+	// half-life of roughly 346 blocks.
+	estimateFeeDecay = 0.998
+
+	// estimateFeeMinBucketFee is the upper bound of the lowest fee rate
+	// bucket in atoms per kilobyte.
+	estimateFeeMinBucketFee = 1e4
+
+	// estimateFeeMaxBucketFee is the upper bound of the highest finite fee
+	// rate bucket in atoms per kilobyte.  Any transaction paying more than
+	// this falls into a final catch-all bucket.
+	estimateFeeMaxBucketFee = 1e8
+
+	// estimateFeeBucketSpacing is the ratio between the upper bounds of
+	// consecutive fee rate buckets.
+	estimateFeeBucketSpacing = 1.1
+
+	// estimateFeeSufficientTxs is the average number of transactions per
+	// block a group of buckets needs to have seen before its success rate
+	// is considered meaningful.
+	estimateFeeSufficientTxs = 0.1
+
+	// economicalSuccessThreshold and conservativeSuccessThreshold are the
+	// fractions of transactions in a group of buckets that must have been
+	// mined within the confirmation target for the group to be considered
+	// good enough by the respective estimation modes.
+	economicalSuccessThreshold   = 0.85
+	conservativeSuccessThreshold = 0.95
+)
+
+// EstimateMode defines the modes in which fee estimates can be requested.
+type EstimateMode int
+
+const (
+	// EstimateModeConservative requests an estimate which is less likely
+	// to be undercut by short term fluctuations of the fee market.
+	EstimateModeConservative EstimateMode = iota
+
+	// EstimateModeEconomical requests a cheaper estimate which is more
+	// responsive to recent fee rates, but might take longer to confirm.
+	EstimateModeEconomical
+)
+
+// String returns the EstimateMode as a human-readable name.
+func (m EstimateMode) String() string {
+	switch m {
+	case EstimateModeConservative:
+		return "CONSERVATIVE"
+	case EstimateModeEconomical:
+		return "ECONOMICAL"
+	}
+	return fmt.Sprintf("Unknown EstimateMode (%d)", int(m))
+}
+
+// successThreshold returns the fraction of transactions that must have been
+// mined within the requested target for a fee rate to be acceptable in the
+// mode.
+func (m EstimateMode) successThreshold() float64 {
+	if m == EstimateModeEconomical {
+		return economicalSuccessThreshold
+	}
+	return conservativeSuccessThreshold
+}
+
+var (
+	// ErrNoFeeEstimate is returned when the estimator has not seen enough
+	// transactions to provide an estimate for the requested target.
+	ErrNoFeeEstimate = errors.New("insufficient data to estimate fee")
+
+	// bucketFeeRates holds the upper bound, in atoms per kilobyte, of every
+	// fee rate bucket.  The last bucket is unbounded.
+	bucketFeeRates = func() []float64 {
+		var rates []float64
+		for rate := estimateFeeMinBucketFee; rate <= estimateFeeMaxBucketFee; rate *= estimateFeeBucketSpacing {
+			rates = append(rates, rate)
+		}
+		return append(rates, math.Inf(1))
+	}()
+)
+
+// observedTx is a transaction the fee estimator is waiting to see mined.
+type observedTx struct {
+	height  int64
+	feeRate float64
+	bucket  int
+}
+
+// FeeEstimator estimates the fee rate required for a transaction to be mined
+// within a number of blocks.  It is fed the regular transactions entering and
+// leaving the memory pool as well as the transactions of every block that is
+// connected to the main chain, and keeps exponentially decaying statistics of
+// how long transactions in each fee rate bucket took to be mined.
+//
+// The estimator is safe for concurrent access.
+type FeeEstimator struct {
+	mtx sync.Mutex
+
+	maxConfirms int
+	bestHeight  int64
+
+	// txCount and feeRateSum are the decayed number of mined transactions
+	// and the sum of their fee rates per bucket.
+	txCount    []float64
+	feeRateSum []float64
+
+	// confirmed[c][b] is the decayed number of transactions in bucket b
+	// which were mined within c+1 blocks.  failed[c][b] is the decayed
+	// number of transactions in bucket b which waited at least c+1 blocks
+	// and then left the memory pool without being mined.
+	confirmed [][]float64
+	failed    [][]float64
+
+	// observed holds the transactions currently in the memory pool.
+	observed map[chainhash.Hash]observedTx
+}
+
+// NewFeeEstimator returns a new fee estimator which tracks transactions for
+// up to maxConfirms blocks.
+func NewFeeEstimator(maxConfirms int) *FeeEstimator {
+	numBuckets := len(bucketFeeRates)
+	ef := &FeeEstimator{
+		maxConfirms: maxConfirms,
+		bestHeight:  -1,
+		txCount:     make([]float64, numBuckets),
+		feeRateSum:  make([]float64, numBuckets),
+		confirmed:   make([][]float64, maxConfirms),
+		failed:      make([][]float64, maxConfirms),
+		observed:    make(map[chainhash.Hash]observedTx),
+	}
+	for i := 0; i < maxConfirms; i++ {
+		ef.confirmed[i] = make([]float64, numBuckets)
+		ef.failed[i] = make([]float64, numBuckets)
+	}
+	return ef
+}
+
+// feeRate returns the fee rate of the passed transaction in atoms per
+// kilobyte.
+func feeRate(tx *cmmutil.Tx, fee int64) float64 {
+	size := tx.MsgTx().SerializeSize()
+	if size == 0 {
+		return 0
+	}
+	return float64(fee) * 1000 / float64(size)
+}
+
+// bucketIndex returns the index of the bucket the passed fee rate belongs to.
+func bucketIndex(rate float64) int {
+	return sort.SearchFloat64s(bucketFeeRates, rate)
+}
+
+// ObserveTransaction is called when a new transaction is added to the memory
+// pool.  Only regular transactions are tracked.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) ObserveTransaction(txDesc *TxDesc) {
+	if txDesc.Type != stake.TxTypeRegular {
+		return
+	}
+
+	ef.mtx.Lock()
+	hash := *txDesc.Tx.Hash()
+	if _, ok := ef.observed[hash]; !ok {
+		rate := feeRate(txDesc.Tx, txDesc.Fee)
+		ef.observed[hash] = observedTx{
+			height:  txDesc.Height,
+			feeRate: rate,
+			bucket:  bucketIndex(rate),
+		}
+	}
+	ef.mtx.Unlock()
+}
+
+// ObserveRemoval is called when a transaction leaves the memory pool.  Any
+// transaction still tracked at this point was not mined by a registered block,
+// so it counts as a failure for every target it has already waited for.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) ObserveRemoval(txHash *chainhash.Hash) {
+	ef.mtx.Lock()
+	if otx, ok := ef.observed[*txHash]; ok {
+		waited := ef.bestHeight - otx.height
+		for c := 0; c < ef.maxConfirms && int64(c) < waited; c++ {
+			ef.failed[c][otx.bucket]++
+		}
+		delete(ef.observed, *txHash)
+	}
+	ef.mtx.Unlock()
+}
+
+// RegisterDisapprovedBlock is called when the regular transaction tree of the
+// passed block is disapproved by stakeholders.  Its regular transactions were
+// mined, so they did not fail to confirm due to their fee rate, but they are
+// not confirmed either.  They are no longer tracked so that they do not count
+// as failures when they subsequently leave the memory pool.  It must be called
+// before they are removed from the memory pool.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) RegisterDisapprovedBlock(block *cmmutil.Block) {
+	ef.mtx.Lock()
+	for _, tx := range block.Transactions() {
+		delete(ef.observed, *tx.Hash())
+	}
+	ef.mtx.Unlock()
+}
+
+// RegisterBlock updates the statistics with the transactions mined by the
+// passed block.  It must be called before the mined transactions are removed
+// from the memory pool.  Blocks that are not above the last registered height,
+// such as those connected during a reorganization, are ignored.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) RegisterBlock(block *cmmutil.Block) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	height := block.Height()
+	if height <= ef.bestHeight {
+		return
+	}
+	ef.bestHeight = height
+
+	// Decay all existing observations so recent blocks matter more.
+	for b := range ef.txCount {
+		ef.txCount[b] *= estimateFeeDecay
+		ef.feeRateSum[b] *= estimateFeeDecay
+		for c := 0; c < ef.maxConfirms; c++ {
+			ef.confirmed[c][b] *= estimateFeeDecay
+			ef.failed[c][b] *= estimateFeeDecay
+		}
+	}
+
+	for _, tx := range block.Transactions() {
+		otx, ok := ef.observed[*tx.Hash()]
+		if !ok {
+			continue
+		}
+		delete(ef.observed, *tx.Hash())
+
+		blocksToConfirm := height - otx.height
+		if blocksToConfirm < 1 {
+			blocksToConfirm = 1
+		}
+		ef.txCount[otx.bucket]++
+		ef.feeRateSum[otx.bucket] += otx.feeRate
+		for c := int(blocksToConfirm) - 1; c < ef.maxConfirms; c++ {
+			ef.confirmed[c][otx.bucket]++
+		}
+	}
+}
+
+// LastKnownHeight returns the height of the last block which was registered.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) LastKnownHeight() int64 {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+	return ef.bestHeight
+}
+
+// estimateFee returns the fee rate in atoms per kilobyte needed for a
+// transaction to be mined within target blocks with at least the passed
+// success rate.
+//
+// Buckets are walked from the highest fee rate downwards and grouped until
+// the group has seen enough transactions.  The lowest fee rate group that
+// still meets the success threshold provides the estimate.
+//
+// This function MUST be called with the estimator lock held.
+func (ef *FeeEstimator) estimateFee(target int, threshold float64) (float64, bool) {
+	// Transactions still waiting in the memory pool for at least the target
+	// number of blocks count against their bucket.
+	unconfirmed := make([]float64, len(bucketFeeRates))
+	for _, otx := range ef.observed {
+		if ef.bestHeight-otx.height >= int64(target) {
+			unconfirmed[otx.bucket]++
+		}
+	}
+
+	sufficient := estimateFeeSufficientTxs / (1 - estimateFeeDecay)
+	var curConfirmed, curTotal, curCount, curFeeSum float64
+	var bestCount, bestFeeSum float64
+	found := false
+	for b := len(bucketFeeRates) - 1; b >= 0; b-- {
+		curConfirmed += ef.confirmed[target-1][b]
+		curTotal += ef.txCount[b] + ef.failed[target-1][b] + unconfirmed[b]
+		curCount += ef.txCount[b]
+		curFeeSum += ef.feeRateSum[b]
+		if curTotal < sufficient {
+			continue
+		}
+		if curConfirmed/curTotal < threshold {
+			break
+		}
+
+		found = true
+		bestCount, bestFeeSum = curCount, curFeeSum
+		curConfirmed, curTotal, curCount, curFeeSum = 0, 0, 0, 0
+	}
+	if !found || bestCount == 0 {
+		return 0, false
+	}
+	return bestFeeSum / bestCount, true
+}
+
+// EstimateFee returns the estimated fee rate per kilobyte needed for a
+// transaction to be mined within the target number of blocks.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) EstimateFee(target int, mode EstimateMode) (cmmutil.Amount, error) {
+	if target < 1 || target > ef.maxConfirms {
+		return 0, fmt.Errorf("confirmation target must be between 1 "+
+			"and %d", ef.maxConfirms)
+	}
+
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	rate, ok := ef.estimateFee(target, mode.successThreshold())
+	if !ok {
+		return 0, ErrNoFeeEstimate
+	}
+	return cmmutil.Amount(math.Ceil(rate)), nil
+}
+
+// EstimateSmartFee returns the estimated fee rate per kilobyte needed for a
+// transaction to be mined within the target number of blocks along with the
+// number of blocks the estimate is actually valid for.  When there is not
+// enough data for the requested target, progressively larger targets are
+// tried.
+//
+// In conservative mode the estimate is never lower than the one for twice the
+// target, which protects against a fee market that is only temporarily cheap.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) EstimateSmartFee(target int, mode EstimateMode) (cmmutil.Amount, int, error) {
+	if target < 1 {
+		return 0, 0, fmt.Errorf("confirmation target must be at least 1")
+	}
+	if target > ef.maxConfirms {
+		target = ef.maxConfirms
+	}
+
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	threshold := mode.successThreshold()
+	for ; target <= ef.maxConfirms; target++ {
+		rate, ok := ef.estimateFee(target, threshold)
+		if !ok {
+			continue
+		}
+		if mode == EstimateModeConservative && target*2 <= ef.maxConfirms {
+			longRate, ok := ef.estimateFee(target*2, threshold)
+			if ok && longRate > rate {
+				rate = longRate
+			}
+		}
+		return cmmutil.Amount(math.Ceil(rate)), target, nil
+	}
+	return 0, 0, ErrNoFeeEstimate
+}
+
+// Save serializes the statistics of the fee estimator so that they can be
+// restored with RestoreFeeEstimator.  Transactions which are waiting in the
+// memory pool are not saved.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) Save() []byte {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	var buf bytes.Buffer
+	w := func(data interface{}) {
+		// Writes to a bytes.Buffer never fail.
+		binary.Write(&buf, binary.BigEndian, data)
+	}
+	w(uint32(estimateFeeVersion))
+	w(uint32(ef.maxConfirms))
+	w(uint32(len(bucketFeeRates)))
+	w(ef.bestHeight)
+	w(ef.txCount)
+	w(ef.feeRateSum)
+	for c := 0; c < ef.maxConfirms; c++ {
+		w(ef.confirmed[c])
+		w(ef.failed[c])
+	}
+	return buf.Bytes()
+}
+
+// RestoreFeeEstimator restores a fee estimator from the data produced by
+// Save.
+func RestoreFeeEstimator(data []byte) (*FeeEstimator, error) {
+	r := bytes.NewReader(data)
+
+	var version, maxConfirms, numBuckets uint32
+	for _, field := range []*uint32{&version, &maxConfirms, &numBuckets} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read fee estimator "+
+				"header: %v", err)
+		}
+	}
+	if version != estimateFeeVersion {
+		return nil, fmt.Errorf("unsupported fee estimator version %d",
+			version)
+	}
+	if numBuckets != uint32(len(bucketFeeRates)) {
+		return nil, fmt.Errorf("fee estimator has %d buckets, expected "+
+			"%d", numBuckets, len(bucketFeeRates))
+	}
+	// Ensure the remaining data is exactly the size of the statistics
+	// before allocating them.
+	wantLen := 8 + 8*int64(numBuckets)*(2+2*int64(maxConfirms))
+	if maxConfirms == 0 || int64(r.Len()) != wantLen {
+		return nil, fmt.Errorf("malformed fee estimator state with %d "+
+			"max confirms and %d bytes of statistics", maxConfirms,
+			r.Len())
+	}
+
+	ef := NewFeeEstimator(int(maxConfirms))
+	fields := []interface{}{&ef.bestHeight, ef.txCount, ef.feeRateSum}
+	for c := 0; c < ef.maxConfirms; c++ {
+		fields = append(fields, ef.confirmed[c], ef.failed[c])
+	}
+	for _, field := range fields {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read fee estimator "+
+				"state: %v", err)
+		}
+	}
+	return ef, nil
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"math"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/mining"
+	"github.com/CommerciumBlockchain/cmmd/txscript"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// estimateFeeTester feeds transactions paying known fee rates and blocks
+// mining them into a fee estimator.
+type estimateFeeTester struct {
+	ef      *FeeEstimator
+	nextID  uint32
+	height  int64
+	pending map[int64][]*cmmutil.Tx
+}
+
+// newEstimateFeeTester returns a tester backed by a new fee estimator.
+func newEstimateFeeTester() *estimateFeeTester {
+	return &estimateFeeTester{
+		ef:      NewFeeEstimator(DefaultEstimateFeeMaxConfirms),
+		pending: make(map[int64][]*cmmutil.Tx),
+	}
+}
+
+// addTxs adds count transactions paying the passed fee rate in atoms per
+// kilobyte to the estimator and schedules them to be mined after the given
+// number of blocks.  A zero number of blocks means they are never mined.
+func (e *estimateFeeTester) addTxs(count int, rate float64, blocks int64) []*cmmutil.Tx {
+	txs := make([]*cmmutil.Tx, 0, count)
+	for i := 0; i < count; i++ {
+		msgTx := wire.NewMsgTx()
+		prevOut := wire.NewOutPoint(&chainhash.Hash{}, e.nextID,
+			wire.TxTreeRegular)
+		msgTx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		msgTx.AddTxOut(wire.NewTxOut(1e8, []byte{txscript.OP_TRUE}))
+		e.nextID++
+
+		tx := cmmutil.NewTx(msgTx)
+		e.ef.ObserveTransaction(&TxDesc{
+			TxDesc: mining.TxDesc{
+				Tx:     tx,
+				Type:   stake.TxTypeRegular,
+				Height: e.height,
+				Fee:    int64(rate * float64(msgTx.SerializeSize()) / 1000),
+			},
+		})
+		if blocks > 0 {
+			e.pending[e.height+blocks] = append(e.pending[e.height+blocks], tx)
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// connectBlock registers the next block, mining all transactions which were
+// scheduled for it.
+func (e *estimateFeeTester) connectBlock() {
+	e.height++
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{Height: uint32(e.height)},
+	}
+	for _, tx := range e.pending[e.height] {
+		msgBlock.AddTransaction(tx.MsgTx())
+	}
+	delete(e.pending, e.height)
+	e.ef.RegisterBlock(cmmutil.NewBlock(msgBlock))
+}
+
+// assertFeeRate ensures the passed fee rate is within one percent of the
+// expected rate.
+func assertFeeRate(t *testing.T, desc string, got cmmutil.Amount, want float64) {
+	t.Helper()
+	if math.Abs(float64(got)-want) > want/100 {
+		t.Fatalf("%s: unexpected fee rate - got %v, want %v", desc,
+			int64(got), want)
+	}
+}
+
+// TestEstimateFee ensures the fee estimator provides estimates matching the
+// fee rates transactions needed to be mined within various targets.
+func TestEstimateFee(t *testing.T) {
+	e := newEstimateFeeTester()
+
+	// An empty estimator can't provide any estimates.
+	if _, err := e.ef.EstimateFee(1, EstimateModeEconomical); err != ErrNoFeeEstimate {
+		t.Fatalf("unexpected error for empty estimator - got %v, want %v",
+			err, ErrNoFeeEstimate)
+	}
+	if _, _, err := e.ef.EstimateSmartFee(1, EstimateModeConservative); err != ErrNoFeeEstimate {
+		t.Fatalf("unexpected smart fee error for empty estimator - got "+
+			"%v, want %v", err, ErrNoFeeEstimate)
+	}
+
+	// Out of range targets are rejected.
+	for _, target := range []int{0, DefaultEstimateFeeMaxConfirms + 1} {
+		if _, err := e.ef.EstimateFee(target, EstimateModeEconomical); err == nil {
+			t.Fatalf("did not receive error for target %d", target)
+		}
+	}
+
+	// High fee transactions are mined in the next block while low fee
+	// transactions take six blocks.
+	const highRate, lowRate = 1e6, 2e5
+	for i := 0; i < 30; i++ {
+		e.addTxs(10, highRate, 1)
+		e.addTxs(10, lowRate, 6)
+		e.connectBlock()
+	}
+	if got := e.ef.LastKnownHeight(); got != e.height {
+		t.Fatalf("unexpected last known height - got %d, want %d", got,
+			e.height)
+	}
+
+	for _, mode := range []EstimateMode{EstimateModeEconomical,
+		EstimateModeConservative} {
+
+		fee, err := e.ef.EstimateFee(1, mode)
+		if err != nil {
+			t.Fatalf("%v: unexpected error for target 1: %v", mode, err)
+		}
+		assertFeeRate(t, mode.String()+" target 1", fee, highRate)
+
+		fee, err = e.ef.EstimateFee(6, mode)
+		if err != nil {
+			t.Fatalf("%v: unexpected error for target 6: %v", mode, err)
+		}
+		assertFeeRate(t, mode.String()+" target 6", fee, lowRate)
+	}
+
+	// Only the high fee transactions are mined within three blocks, while
+	// the low fee ones are good enough once the target reaches six blocks.
+	fee, blocks, err := e.ef.EstimateSmartFee(3, EstimateModeEconomical)
+	if err != nil {
+		t.Fatalf("unexpected smart fee error: %v", err)
+	}
+	assertFeeRate(t, "economical smart fee", fee, highRate)
+	if blocks != 3 {
+		t.Fatalf("unexpected smart fee blocks - got %d, want 3", blocks)
+	}
+	fee, _, err = e.ef.EstimateSmartFee(6, EstimateModeEconomical)
+	if err != nil {
+		t.Fatalf("unexpected smart fee error: %v", err)
+	}
+	assertFeeRate(t, "economical smart fee target 6", fee, lowRate)
+}
+
+// TestEstimateFeeFailures ensures transactions which leave the memory pool
+// without being mined count against the fee rate they paid.
+func TestEstimateFeeFailures(t *testing.T) {
+	e := newEstimateFeeTester()
+
+	const rate = 5e5
+	var evicted []*cmmutil.Tx
+	for i := 0; i < 30; i++ {
+		e.addTxs(10, rate, 1)
+		evicted = append(evicted, e.addTxs(10, rate, 0)...)
+		e.connectBlock()
+	}
+
+	// Half of the transactions are still waiting, so the success rate is
+	// far below the threshold.
+	if _, err := e.ef.EstimateFee(1, EstimateModeEconomical); err != ErrNoFeeEstimate {
+		t.Fatalf("unexpected error - got %v, want %v", err,
+			ErrNoFeeEstimate)
+	}
+
+	// Evicting the waiting transactions must record them as failures, so
+	// the estimate remains unavailable.
+	for _, tx := range evicted {
+		e.ef.ObserveRemoval(tx.Hash())
+	}
+	if _, err := e.ef.EstimateFee(1, EstimateModeEconomical); err != ErrNoFeeEstimate {
+		t.Fatalf("unexpected error after evictions - got %v, want %v",
+			err, ErrNoFeeEstimate)
+	}
+}
+
+// TestEstimateFeeDisapproved ensures transactions of a block whose regular
+// transaction tree was disapproved are no longer tracked instead of counting as
+// failures when they leave the memory pool.
+func TestEstimateFeeDisapproved(t *testing.T) {
+	e := newEstimateFeeTester()
+
+	const rate = 5e5
+	var disapproved []*cmmutil.Tx
+	for i := 0; i < 30; i++ {
+		e.addTxs(10, rate, 1)
+		disapproved = append(disapproved, e.addTxs(1, rate, 0)...)
+		e.connectBlock()
+	}
+	msgBlock := &wire.MsgBlock{}
+	for _, tx := range disapproved {
+		msgBlock.AddTransaction(tx.MsgTx())
+	}
+
+	bucket := bucketIndex(rate)
+	e.ef.RegisterDisapprovedBlock(cmmutil.NewBlock(msgBlock))
+	for _, tx := range disapproved {
+		e.ef.ObserveRemoval(tx.Hash())
+	}
+	for c := 0; c < e.ef.maxConfirms; c++ {
+		if e.ef.failed[c][bucket] != 0 {
+			t.Fatalf("disapproved transactions counted as failures "+
+				"for target %d", c+1)
+		}
+	}
+
+	// The disapproved transactions affect neither the estimate nor are
+	// they tracked anymore.
+	fee, err := e.ef.EstimateFee(1, EstimateModeConservative)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertFeeRate(t, "target 1", fee, rate)
+	if len(e.ef.observed) != 0 {
+		t.Fatalf("disapproved transactions are still tracked")
+	}
+}
+
+// TestEstimateFeeSaveRestore ensures the fee estimator state survives being
+// serialized and restored and that malformed state is rejected.
+func TestEstimateFeeSaveRestore(t *testing.T) {
+	e := newEstimateFeeTester()
+	for i := 0; i < 30; i++ {
+		e.addTxs(10, 1e6, 1)
+		e.addTxs(10, 2e5, 6)
+		e.connectBlock()
+	}
+
+	saved := e.ef.Save()
+	restored, err := RestoreFeeEstimator(saved)
+	if err != nil {
+		t.Fatalf("unexpected restore error: %v", err)
+	}
+	if restored.LastKnownHeight() != e.ef.LastKnownHeight() {
+		t.Fatalf("unexpected restored height - got %d, want %d",
+			restored.LastKnownHeight(), e.ef.LastKnownHeight())
+	}
+	want, err := e.ef.EstimateFee(6, EstimateModeConservative)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := restored.EstimateFee(6, EstimateModeConservative)
+	if err != nil {
+		t.Fatalf("unexpected error from restored estimator: %v", err)
+	}
+	if got != want {
+		t.Fatalf("unexpected restored estimate - got %v, want %v", got,
+			want)
+	}
+
+	badVersion := append([]byte(nil), saved...)
+	badVersion[3]++
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated header", saved[:6]},
+		{"truncated state", saved[:len(saved)-1]},
+		{"trailing data", append(append([]byte(nil), saved...), 0)},
+		{"unsupported version", badVersion},
+	}
+	for _, test := range tests {
+		if _, err := RestoreFeeEstimator(test.data); err == nil {
+			t.Errorf("%s: did not receive expected error", test.name)
+		}
+	}
+}
@@ -7,9 +7,11 @@
 package mempool
 
 import (
+	"container/heap"
 	"container/list"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -33,6 +35,16 @@ const (
 	// inclusion when generating block templates.
 	DefaultBlockPrioritySize = 20000
 
+	// DefaultMaxAncestorCount is the default maximum number of transactions
+	// in the pool a transaction and the transactions it depends on in the
+	// pool may add up to.
+	DefaultMaxAncestorCount = 25
+
+	// DefaultMaxDescendantCount is the default maximum number of
+	// transactions in the pool a transaction and the transactions which
+	// depend on it in the pool may add up to.
+	DefaultMaxDescendantCount = 25
+
 	// MinHighPriority is the minimum priority value that allows a
 	// transaction to be considered high priority.
 	MinHighPriority = cmmutil.AtomsPerCoin * 144.0 / 250
@@ -62,6 +74,28 @@ const (
 	// maxNullDataOutputs is the maximum number of OP_RETURN null data
 	// pushes in a transaction, after which it is considered non-standard.
 	maxNullDataOutputs = 4
+
+	// stakePoolSizeDivisor is the divisor applied to the maximum pool size
+	// to determine the size reserved for stake transactions.  Stake
+	// transactions are never evicted to make room for regular transactions
+	// while they stay within that budget.
+	stakePoolSizeDivisor = 4
+
+	// minFeeRateHalfLife is the half-life of the decay of the minimum fee
+	// rate which is raised when transactions are evicted due to the pool
+	// size limit.  The fee rate decays two or four times as fast while the
+	// pool is less than half or a quarter full, respectively.
+	minFeeRateHalfLife = 12 * time.Hour
+
+	// maxReplacementEvictions is the maximum number of transactions which
+	// are evicted from the pool, including descendants, when a transaction
+	// which replaces other transactions is accepted.
+	maxReplacementEvictions = 100
+
+	// maxReplaceableSequenceNum is the maximum sequence number of an input
+	// which signals the transaction may be replaced by one spending the
+	// same coins which pays a higher fee.
+	maxReplaceableSequenceNum = wire.MaxTxInSequenceNum - 2
 )
 
 // Config is a descriptor containing the memory pool configuration.
@@ -121,6 +155,10 @@ type Config struct {
 	// to use for indexing the unconfirmed transactions in the memory pool.
 	// This can be nil if the address index is not enabled.
 	ExistsAddrIndex *indexers.ExistsAddrIndex
+
+	// FeeEstimator provides a feeEstimator. If it is not nil, the mempool
+	// records all new transactions it observes into the feeEstimator.
+	FeeEstimator *FeeEstimator
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -154,6 +192,22 @@ type Policy struct {
 	// of big orphans.
 	MaxOrphanTxSize int
 
+	// MaxPoolSize is the maximum total serialized size in bytes of the
+	// transactions in the pool.  The transactions with the lowest fee rate
+	// along with the transactions which spend them are evicted when it is
+	// exceeded.  A quarter of it is reserved for stake transactions.  There
+	// is no limit when it is zero.
+	MaxPoolSize int64
+
+	// MaxAncestorCount and MaxDescendantCount are the maximum number of
+	// transactions a transaction along with the transactions it depends on
+	// and the transactions which depend on it in the pool, respectively,
+	// may add up to.  Transactions which would exceed either limit for
+	// themselves or any of the transactions they depend on are rejected.
+	// There is no limit when they are zero.
+	MaxAncestorCount   int
+	MaxDescendantCount int
+
 	// MaxSigOpsPerTx is the maximum number of signature operations
 	// in a single transaction we will relay or mine.  It is a fraction
 	// of the max signature operations for a block.
@@ -186,6 +240,12 @@ type TxDesc struct {
 	StartingPriority float64
 }
 
+// txDelta houses the priority and fee deltas of a transaction.
+type txDelta struct {
+	priority float64
+	fee      int64
+}
+
 // TxPool is used as a source of transactions that need to be mined into blocks
 // and relayed to other peers.  It is safe for concurrent access from multiple
 // peers.
@@ -200,6 +260,41 @@ type TxPool struct {
 	orphansByPrev map[chainhash.Hash]map[chainhash.Hash]*cmmutil.Tx
 	outpoints     map[wire.OutPoint]*cmmutil.Tx
 
+	// parents and children house the transactions in the pool which each
+	// transaction in the pool directly spends outputs of and which directly
+	// spend its outputs, respectively, by transaction hash.  Transactions
+	// without any are not included.
+	parents  map[chainhash.Hash]map[chainhash.Hash]*TxDesc
+	children map[chainhash.Hash]map[chainhash.Hash]*TxDesc
+
+	// poolSize and stakePoolSize are the total serialized sizes of the
+	// regular and stake transactions in the pool, respectively.
+	poolSize      int64
+	stakePoolSize int64
+
+	// evictEntries houses the eviction entries of the regular transactions
+	// and tickets in the pool by transaction hash.  regularEvictHeap and
+	// ticketEvictHeap order them by eviction score so the ones to evict
+	// first due to the pool size limit are found without scanning the
+	// pool.  The scores are updated whenever the descendants or the fee
+	// delta of a transaction change.
+	evictEntries     map[chainhash.Hash]*evictEntry
+	regularEvictHeap evictHeap
+	ticketEvictHeap  evictHeap
+
+	// minFeeRate is the minimum fee rate in atoms/kB required for regular
+	// transactions to be accepted.  It is raised above the fee rate of the
+	// transactions evicted due to the pool size limit and decays once a
+	// block has been connected since it was last raised.
+	minFeeRate         float64
+	lastMinFeeRateBump time.Time
+	blockSinceFeeBump  bool
+
+	// deltas houses the priority and fee deltas of the transactions
+	// prioritized with PrioritiseTransaction by transaction hash.  They
+	// are kept for transactions which are not in the pool yet.
+	deltas map[chainhash.Hash]txDelta
+
 	// Votes on blocks.
 	votesMtx sync.RWMutex
 	votes    map[chainhash.Hash][]mining.VoteDesc
@@ -560,12 +655,31 @@ func (mp *TxPool) removeTransaction(tx *cmmutil.Tx, removeRedeemers bool) {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
 
+		// Let the fee estimator know the transaction left the pool.
+		if mp.cfg.FeeEstimator != nil {
+			mp.cfg.FeeEstimator.ObserveRemoval(txHash)
+		}
+
 		// Mark the referenced outpoints as unspent by the pool.
 
 		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
+		if entry, exists := mp.evictEntries[*txHash]; exists {
+			heap.Remove(mp.evictHeapFor(txDesc.Type), entry.index)
+			delete(mp.evictEntries, *txHash)
+		}
+		mp.removeDependencies(txHash)
+		if txDesc.Type == stake.TxTypeRegular {
+			mp.poolSize -= int64(msgTx.SerializeSize())
+		} else {
+			mp.stakePoolSize -= int64(msgTx.SerializeSize())
+		}
 		delete(mp.pool, *txHash)
+
+		// The transaction no longer counts as a descendant of the
+		// transactions it spends.
+		mp.updateEvictScores(tx)
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -603,6 +717,298 @@ func (mp *TxPool) RemoveDoubleSpends(tx *cmmutil.Tx) {
 	mp.mtx.Unlock()
 }
 
+// txDescendants adds the transactions in the pool which spend outputs of the
+// passed transaction, either directly or through other transactions in the
+// pool, to the passed map.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) txDescendants(tx *cmmutil.Tx, descendants map[chainhash.Hash]*TxDesc) {
+	for childHash, child := range mp.children[*tx.Hash()] {
+		if _, seen := descendants[childHash]; seen {
+			continue
+		}
+		descendants[childHash] = child
+		mp.txDescendants(child.Tx, descendants)
+	}
+}
+
+// addDependency records that the passed child transaction spends outputs of
+// the passed parent transaction.  Both must be in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addDependency(parent, child *TxDesc) {
+	parentHash, childHash := *parent.Tx.Hash(), *child.Tx.Hash()
+	if mp.parents[childHash] == nil {
+		mp.parents[childHash] = make(map[chainhash.Hash]*TxDesc)
+	}
+	mp.parents[childHash][parentHash] = parent
+	if mp.children[parentHash] == nil {
+		mp.children[parentHash] = make(map[chainhash.Hash]*TxDesc)
+	}
+	mp.children[parentHash][childHash] = child
+}
+
+// removeDependencies removes the dependencies of the transaction with the
+// passed hash on other transactions in the pool and those of other
+// transactions in the pool on it.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeDependencies(txHash *chainhash.Hash) {
+	for parentHash := range mp.parents[*txHash] {
+		delete(mp.children[parentHash], *txHash)
+		if len(mp.children[parentHash]) == 0 {
+			delete(mp.children, parentHash)
+		}
+	}
+	for childHash := range mp.children[*txHash] {
+		delete(mp.parents[childHash], *txHash)
+		if len(mp.parents[childHash]) == 0 {
+			delete(mp.parents, childHash)
+		}
+	}
+	delete(mp.parents, *txHash)
+	delete(mp.children, *txHash)
+}
+
+// packageStats returns the number of transactions, the total serialized size
+// and the total fee including the fee deltas of the passed transaction along
+// with the passed related transactions, such as its ancestors or descendants.
+func packageStats(txDesc *TxDesc, related map[chainhash.Hash]*TxDesc) (int, int64, int64) {
+	size := int64(txDesc.Tx.MsgTx().SerializeSize())
+	fee := txDesc.Fee + txDesc.FeeDelta
+	for _, desc := range related {
+		size += int64(desc.Tx.MsgTx().SerializeSize())
+		fee += desc.Fee + desc.FeeDelta
+	}
+	return len(related) + 1, size, fee
+}
+
+// evictEntry houses the eviction score of a transaction in the pool.  The
+// score is the higher of the fee rate the transaction pays on its own and the
+// fee rate it pays together with its descendants in the pool, both in atoms/kB
+// and including the fee deltas.  Using the higher of the two keeps a
+// transaction which pays a high fee rate from being evicted along with its
+// descendants paying a low one, which are evicted on their own instead.
+type evictEntry struct {
+	txDesc         *TxDesc
+	packageFeeRate float64
+	score          float64
+	index          int
+}
+
+// evictHeap is a min heap of eviction entries ordered by eviction score.  It
+// implements heap.Interface.
+type evictHeap []*evictEntry
+
+// Len returns the number of entries in the heap.  It is part of the
+// heap.Interface implementation.
+func (h evictHeap) Len() int { return len(h) }
+
+// Less returns whether the entry with index i has a lower eviction score than
+// the entry with index j.  It is part of the heap.Interface implementation.
+func (h evictHeap) Less(i, j int) bool { return h[i].score < h[j].score }
+
+// Swap swaps the entries at the passed indices in the heap.  It is part of the
+// heap.Interface implementation.
+func (h evictHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+// Push pushes the passed entry onto the heap.  It is part of the
+// heap.Interface implementation.
+func (h *evictHeap) Push(x interface{}) {
+	entry := x.(*evictEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+// Pop removes the entry with the highest index from the heap and returns it.
+// It is part of the heap.Interface implementation.
+func (h *evictHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
+
+// evictHeapFor returns the eviction heap the passed transaction type belongs
+// to, or nil when transactions of that type are not evicted due to the pool
+// size limit.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) evictHeapFor(txType stake.TxType) *evictHeap {
+	switch txType {
+	case stake.TxTypeRegular:
+		return &mp.regularEvictHeap
+	case stake.TxTypeSStx:
+		return &mp.ticketEvictHeap
+	}
+	return nil
+}
+
+// updateEvictScores recomputes the eviction scores of the passed transaction
+// and its ancestors in the pool since they depend on its descendants and fee
+// delta.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) updateEvictScores(tx *cmmutil.Tx) {
+	txDescs := make(map[chainhash.Hash]*TxDesc)
+	mp.txAncestors(tx, txDescs)
+	if txDesc, exists := mp.pool[*tx.Hash()]; exists {
+		txDescs[*tx.Hash()] = txDesc
+	}
+	for txHash, txDesc := range txDescs {
+		entry, exists := mp.evictEntries[txHash]
+		if !exists {
+			continue
+		}
+		descendants := make(map[chainhash.Hash]*TxDesc)
+		mp.txDescendants(txDesc.Tx, descendants)
+		_, size, fee := packageStats(txDesc, descendants)
+		entry.packageFeeRate = float64(fee) * 1000 / float64(size)
+		ownSize := float64(txDesc.Tx.MsgTx().SerializeSize())
+		ownFeeRate := float64(txDesc.Fee+txDesc.FeeDelta) * 1000 / ownSize
+		entry.score = math.Max(ownFeeRate, entry.packageFeeRate)
+		heap.Fix(mp.evictHeapFor(txDesc.Type), entry.index)
+	}
+}
+
+// limitPoolSize evicts transactions from the pool until it no longer exceeds
+// the maximum pool size.  Stake transactions beyond the size reserved for them
+// evict the tickets with the lowest eviction scores and regular transactions
+// beyond the remaining size evict the regular transactions with the lowest
+// eviction scores along with their descendants.  The minimum fee rate is raised
+// above the fee rate of each evicted regular transaction package.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) limitPoolSize() {
+	maxPoolSize := mp.cfg.Policy.MaxPoolSize
+	if maxPoolSize <= 0 {
+		return
+	}
+
+	maxStakePoolSize := maxPoolSize / stakePoolSizeDivisor
+	for mp.stakePoolSize > maxStakePoolSize && len(mp.ticketEvictHeap) > 0 {
+		entry := mp.ticketEvictHeap[0]
+		log.Debugf("Evicting ticket %v with an eviction score of %.0f "+
+			"atoms/kB since the stake transactions exceed %d bytes",
+			entry.txDesc.Tx.Hash(), entry.score, maxStakePoolSize)
+		mp.removeTransaction(entry.txDesc.Tx, true)
+	}
+
+	for mp.poolSize+mp.stakePoolSize > maxPoolSize &&
+		len(mp.regularEvictHeap) > 0 {
+
+		entry := mp.regularEvictHeap[0]
+		feeRate := entry.packageFeeRate
+		log.Debugf("Evicting transaction %v with an eviction score of "+
+			"%.0f atoms/kB since the pool exceeds %d bytes",
+			entry.txDesc.Tx.Hash(), entry.score, maxPoolSize)
+		mp.removeTransaction(entry.txDesc.Tx, true)
+
+		// Require transactions to pay more than the evicted package
+		// from now on so they can't simply replace it.
+		feeRate += float64(mp.cfg.Policy.MinRelayTxFee)
+		if feeRate > mp.minFeeRate {
+			mp.minFeeRate = feeRate
+			mp.lastMinFeeRateBump = time.Now()
+			mp.blockSinceFeeBump = false
+		}
+	}
+}
+
+// currentMinFeeRate returns the minimum fee rate in atoms/kB required for
+// regular transactions to be accepted after applying the decay since it was
+// last raised.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) currentMinFeeRate() cmmutil.Amount {
+	// The fee rate only starts to decay once a block has been connected
+	// since it was raised.
+	if !mp.blockSinceFeeBump || mp.minFeeRate == 0 {
+		return cmmutil.Amount(math.Ceil(mp.minFeeRate))
+	}
+
+	halfLife := minFeeRateHalfLife
+	maxPoolSize := mp.cfg.Policy.MaxPoolSize
+	poolSize := mp.poolSize + mp.stakePoolSize
+	switch {
+	case poolSize < maxPoolSize/4:
+		halfLife /= 4
+	case poolSize < maxPoolSize/2:
+		halfLife /= 2
+	}
+	now := time.Now()
+	elapsed := now.Sub(mp.lastMinFeeRateBump)
+	mp.minFeeRate /= math.Pow(2, elapsed.Seconds()/halfLife.Seconds())
+	mp.lastMinFeeRateBump = now
+
+	// Stop requiring a higher fee rate once it has decayed to the point it
+	// no longer matters.
+	if mp.minFeeRate < float64(mp.cfg.Policy.MinRelayTxFee)/2 {
+		mp.minFeeRate = 0
+	}
+	return cmmutil.Amount(math.Ceil(mp.minFeeRate))
+}
+
+// MinFeeRate returns the minimum fee rate in atoms/kB required for regular
+// transactions to be accepted due to the pool size limit.  It is zero when the
+// pool has not been full recently.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFeeRate() cmmutil.Amount {
+	mp.mtx.Lock()
+	feeRate := mp.currentMinFeeRate()
+	mp.mtx.Unlock()
+	return feeRate
+}
+
+// BlockConnected notifies the pool that a new block which mined the passed
+// transactions was connected to the main chain.  This allows the minimum fee
+// rate raised by evictions to decay and clears the deltas of the mined
+// transactions.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) BlockConnected(minedTxns []*cmmutil.Tx) {
+	mp.mtx.Lock()
+	mp.blockSinceFeeBump = true
+	for _, tx := range minedTxns {
+		delete(mp.deltas, *tx.Hash())
+	}
+	mp.mtx.Unlock()
+}
+
+// PrioritiseTransaction adds the passed priority and fee deltas to those of
+// the transaction with the passed hash.  The deltas are added to the priority
+// and fee of the transaction when selecting transactions for block templates
+// and evicting transactions due to the pool size limit, but they do not change
+// the fee it pays.  They are kept when the transaction is not in the pool yet
+// and cleared once it is mined.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(hash *chainhash.Hash, priorityDelta float64, feeDelta int64) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	delta := mp.deltas[*hash]
+	delta.priority += priorityDelta
+	delta.fee += feeDelta
+	if delta == (txDelta{}) {
+		delete(mp.deltas, *hash)
+	} else {
+		mp.deltas[*hash] = delta
+	}
+	if txDesc, ok := mp.pool[*hash]; ok {
+		txDesc.PriorityDelta = delta.priority
+		txDesc.FeeDelta = delta.fee
+		mp.updateEvictScores(txDesc.Tx)
+	}
+}
+
 // addTransaction adds the passed transaction to the memory pool.  It should
 // not be called directly as it doesn't perform any validation.  This is a
 // helper for maybeAcceptTransaction.
@@ -614,19 +1020,52 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
 	msgTx := tx.MsgTx()
-	mp.pool[*tx.Hash()] = &TxDesc{
+	delta := mp.deltas[*tx.Hash()]
+	txD := &TxDesc{
 		TxDesc: mining.TxDesc{
-			Tx:     tx,
-			Type:   txType,
-			Added:  time.Now(),
-			Height: height,
-			Fee:    fee,
+			Tx:            tx,
+			Type:          txType,
+			Added:         time.Now(),
+			Height:        height,
+			Fee:           fee,
+			FeeDelta:      delta.fee,
+			PriorityDelta: delta.priority,
 		},
 		StartingPriority: mining.CalcPriority(msgTx, utxoView, height),
 	}
+	mp.pool[*tx.Hash()] = txD
 	for _, txIn := range msgTx.TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
+		if parent, exists := mp.pool[txIn.PreviousOutPoint.Hash]; exists {
+			mp.addDependency(parent, txD)
+		}
 	}
+
+	// Transactions restored from disconnected blocks may already be spent
+	// by transactions in the pool.
+	tree := wire.TxTreeRegular
+	if txType != stake.TxTypeRegular {
+		tree = wire.TxTreeStake
+	}
+	for i := uint32(0); i < uint32(len(msgTx.TxOut)); i++ {
+		outpoint := wire.NewOutPoint(tx.Hash(), i, tree)
+		if txRedeemer, exists := mp.outpoints[*outpoint]; exists {
+			if child, exists := mp.pool[*txRedeemer.Hash()]; exists {
+				mp.addDependency(txD, child)
+			}
+		}
+	}
+	if txType == stake.TxTypeRegular {
+		mp.poolSize += int64(msgTx.SerializeSize())
+	} else {
+		mp.stakePoolSize += int64(msgTx.SerializeSize())
+	}
+	if evictHeap := mp.evictHeapFor(txType); evictHeap != nil {
+		entry := &evictEntry{txDesc: txD}
+		mp.evictEntries[*tx.Hash()] = entry
+		heap.Push(evictHeap, entry)
+	}
+	mp.updateEvictScores(tx)
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -637,15 +1076,136 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	if mp.cfg.ExistsAddrIndex != nil {
 		mp.cfg.ExistsAddrIndex.AddUnconfirmedTx(msgTx)
 	}
+
+	// Record this tx for fee estimation if enabled.
+	if mp.cfg.FeeEstimator != nil {
+		mp.cfg.FeeEstimator.ObserveTransaction(txD)
+	}
+}
+
+// txAncestors adds the transactions in the pool whose outputs are spent by the
+// passed transaction, either directly or through other transactions in the
+// pool, to the passed map.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) txAncestors(tx *cmmutil.Tx, ancestors map[chainhash.Hash]*TxDesc) {
+	for _, txIn := range tx.MsgTx().TxIn {
+		originHash := txIn.PreviousOutPoint.Hash
+		if _, seen := ancestors[originHash]; seen {
+			continue
+		}
+		if txDesc, exists := mp.pool[originHash]; exists {
+			ancestors[originHash] = txDesc
+			mp.txAncestors(txDesc.Tx, ancestors)
+		}
+	}
+}
+
+// removeStakeTxns removes the stake transactions from the passed map of
+// transactions.
+func removeStakeTxns(txDescs map[chainhash.Hash]*TxDesc) {
+	for hash, txDesc := range txDescs {
+		if txDesc.Type != stake.TxTypeRegular {
+			delete(txDescs, hash)
+		}
+	}
+}
+
+// checkPackageLimits returns an error when the passed regular transaction,
+// which is not in the pool yet, would exceed the maximum number of ancestors
+// allowed by the policy or make any of the transactions it depends on exceed
+// the maximum number of descendants.  Only regular transactions count towards
+// the limits, so stake transactions in the pool, such as the many tickets a
+// single split transaction commonly funds, do not keep regular transactions
+// out.  The passed transactions which are replaced by the transaction are not
+// counted as descendants.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) checkPackageLimits(tx *cmmutil.Tx, replaced map[chainhash.Hash]*TxDesc) error {
+	maxAncestors := mp.cfg.Policy.MaxAncestorCount
+	maxDescendants := mp.cfg.Policy.MaxDescendantCount
+	if maxAncestors <= 0 && maxDescendants <= 0 {
+		return nil
+	}
+
+	ancestors := make(map[chainhash.Hash]*TxDesc)
+	mp.txAncestors(tx, ancestors)
+	removeStakeTxns(ancestors)
+	if maxAncestors > 0 && len(ancestors)+1 > maxAncestors {
+		str := fmt.Sprintf("transaction %v has too many unconfirmed "+
+			"ancestors (%d > %d)", tx.Hash(), len(ancestors)+1,
+			maxAncestors)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+	if maxDescendants <= 0 {
+		return nil
+	}
+	for ancestorHash, ancestor := range ancestors {
+		descendants := make(map[chainhash.Hash]*TxDesc)
+		mp.txDescendants(ancestor.Tx, descendants)
+		removeStakeTxns(descendants)
+		numDescendants := len(descendants) + 2
+		for hash := range replaced {
+			if _, ok := descendants[hash]; ok {
+				numDescendants--
+			}
+		}
+		if numDescendants > maxDescendants {
+			str := fmt.Sprintf("transaction %v would give unconfirmed "+
+				"transaction %v too many descendants (%d > %d)",
+				tx.Hash(), ancestorHash, numDescendants,
+				maxDescendants)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+	return nil
+}
+
+// signalsReplacement returns whether or not the passed transaction signals that
+// it may be replaced by a transaction spending the same coins, which is the
+// case when the sequence number of any of its inputs is at most
+// maxReplaceableSequenceNum.
+func signalsReplacement(tx *cmmutil.Tx) bool {
+	for _, txIn := range tx.MsgTx().TxIn {
+		if txIn.Sequence <= maxReplaceableSequenceNum {
+			return true
+		}
+	}
+	return false
+}
+
+// isReplaceable returns whether or not the passed regular transaction in the
+// pool may be replaced by a transaction spending the same coins.  That is the
+// case when it, or any of its ancestors in the pool, signals replacement.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) isReplaceable(txDesc *TxDesc) bool {
+	if txDesc.Type != stake.TxTypeRegular {
+		return false
+	}
+	if signalsReplacement(txDesc.Tx) {
+		return true
+	}
+	ancestors := make(map[chainhash.Hash]*TxDesc)
+	mp.txAncestors(txDesc.Tx, ancestors)
+	for _, ancestor := range ancestors {
+		if signalsReplacement(ancestor.Tx) {
+			return true
+		}
+	}
+	return false
 }
 
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
-// Note it does not check for double spends against transactions already in the
-// main chain.
+// Regular transactions may spend the same coins as replaceable regular
+// transactions, which are returned as the transactions it conflicts with.  Note
+// it does not check for double spends against transactions already in the main
+// chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
-func (mp *TxPool) checkPoolDoubleSpend(tx *cmmutil.Tx, txType stake.TxType) error {
+func (mp *TxPool) checkPoolDoubleSpend(tx *cmmutil.Tx, txType stake.TxType) (map[chainhash.Hash]*TxDesc, error) {
+	var conflicts map[chainhash.Hash]*TxDesc
 	for i, txIn := range tx.MsgTx().TxIn {
 		// We don't care about double spends of stake bases.
 		if (txType == stake.TxTypeSSGen || txType == stake.TxTypeSSRtx) &&
@@ -653,14 +1213,87 @@ func (mp *TxPool) checkPoolDoubleSpend(tx *cmmutil.Tx, txType stake.TxType) erro
 			continue
 		}
 
-		if txR, exists := mp.outpoints[txIn.PreviousOutPoint]; exists {
-			str := fmt.Sprintf("transaction %v in the pool "+
-				"already spends the same coins", txR.Hash())
-			return txRuleError(wire.RejectDuplicate, str)
+		txR, exists := mp.outpoints[txIn.PreviousOutPoint]
+		if !exists {
+			continue
 		}
+		if txType == stake.TxTypeRegular {
+			txDesc, exists := mp.pool[*txR.Hash()]
+			if exists && mp.isReplaceable(txDesc) {
+				if conflicts == nil {
+					conflicts = make(map[chainhash.Hash]*TxDesc)
+				}
+				conflicts[*txR.Hash()] = txDesc
+				continue
+			}
+		}
+		str := fmt.Sprintf("transaction %v in the pool "+
+			"already spends the same coins", txR.Hash())
+		return nil, txRuleError(wire.RejectDuplicate, str)
 	}
 
-	return nil
+	return conflicts, nil
+}
+
+// validateReplacement ensures the passed transaction pays enough to replace the
+// passed transactions it conflicts with along with their descendants and
+// returns all of the transactions it would evict from the pool.  It must pay a
+// higher fee rate than each of the conflicting transactions, a higher fee than
+// all of the evicted transactions combined plus the minimum relay fee for
+// itself and may not evict more than maxReplacementEvictions transactions.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) validateReplacement(tx *cmmutil.Tx, txFee int64, conflicts map[chainhash.Hash]*TxDesc) (map[chainhash.Hash]*TxDesc, error) {
+	txHash := tx.Hash()
+	txSize := int64(tx.MsgTx().SerializeSize())
+	feeRate := float64(txFee) * 1000 / float64(txSize)
+	evicted := make(map[chainhash.Hash]*TxDesc)
+	for hash, txDesc := range conflicts {
+		conflictSize := int64(txDesc.Tx.MsgTx().SerializeSize())
+		conflictFeeRate := float64(txDesc.Fee) * 1000 / float64(conflictSize)
+		if feeRate <= conflictFeeRate {
+			str := fmt.Sprintf("transaction %v has a fee rate of %.0f "+
+				"atoms/kB which is not higher than the %.0f "+
+				"atoms/kB of transaction %v it replaces", txHash,
+				feeRate, conflictFeeRate, hash)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+
+		evicted[hash] = txDesc
+		mp.txDescendants(txDesc.Tx, evicted)
+		if len(evicted) > maxReplacementEvictions {
+			str := fmt.Sprintf("transaction %v would evict more than "+
+				"the maximum of %d transactions it replaces",
+				txHash, maxReplacementEvictions)
+			return nil, txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	// The transaction may not spend the outputs of the transactions it
+	// evicts since they would no longer exist.
+	for _, txIn := range tx.MsgTx().TxIn {
+		originHash := &txIn.PreviousOutPoint.Hash
+		if _, exists := evicted[*originHash]; exists {
+			str := fmt.Sprintf("transaction %v spends an output of "+
+				"transaction %v it replaces", txHash, originHash)
+			return nil, txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	var evictedFees int64
+	for _, txDesc := range evicted {
+		evictedFees += txDesc.Fee
+	}
+	minFee := evictedFees + calcMinRequiredTxRelayFee(txSize,
+		mp.cfg.Policy.MinRelayTxFee)
+	if txFee < minFee {
+		str := fmt.Sprintf("transaction %v has %v fees which is under "+
+			"the required amount of %v to replace %d transactions",
+			txHash, txFee, minFee, len(evicted))
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	return evicted, nil
 }
 
 // IsTxTreeKnownInvalid returns whether or not the transaction tree of the
@@ -756,7 +1389,8 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash, includeRecentBlock bo
 
 // maybeAcceptTransaction is the internal function which implements the public
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// more details.  When checkOnly is set, the transaction is fully validated but
+// not added to the pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
 // Commercium - TODO
@@ -764,7 +1398,7 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash, includeRecentBlock bo
 // so that we can easily pick different stake tx types from the mempool later.
 // This should probably be done at the bottom using "IsSStx" etc functions.
 // It should also set the cmmutil tree type for the tx as well.
-func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allowHighFees bool) ([]*chainhash.Hash, error) {
+func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allowHighFees, checkOnly bool) ([]*chainhash.Hash, error) {
 	msgTx := tx.MsgTx()
 	txHash := tx.Hash()
 	// Don't accept the transaction if it already exists in the pool.  This
@@ -859,6 +1493,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allow
 	}
 
 	// Handle stake transaction double spending exceptions.
+	var conflicts map[chainhash.Hash]*TxDesc
 	if (txType == stake.TxTypeSSGen) || (txType == stake.TxTypeSSRtx) {
 		if txType == stake.TxTypeSSGen {
 			ssGenAlreadyFound := 0
@@ -901,7 +1536,11 @@ func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allow
 		// at this point.  There is a more in-depth check that happens later
 		// after fetching the referenced transaction inputs from the main chain
 		// which examines the actual spend data and prevents double spends.
-		err = mp.checkPoolDoubleSpend(tx, txType)
+		//
+		// Regular transactions may replace regular transactions which signal
+		// replacement when they pay enough, which is checked once the fee is
+		// known.
+		conflicts, err = mp.checkPoolDoubleSpend(tx, txType)
 		if err != nil {
 			return nil, err
 		}
@@ -1094,6 +1733,20 @@ func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allow
 		}
 	}
 
+	// Don't allow regular transactions with fees under the minimum fee rate
+	// which is raised when transactions are evicted due to the pool size
+	// limit.
+	if txType == stake.TxTypeRegular {
+		poolMinFee := calcMinRequiredTxRelayFee(serializedSize,
+			mp.currentMinFeeRate())
+		if txFee < poolMinFee {
+			str := fmt.Sprintf("transaction %v has %v fees which "+
+				"is under the mempool minimum fee of %v", txHash,
+				txFee, poolMinFee)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
 	// Free-to-relay transactions are rate limited here to prevent
 	// penny-flooding with tiny transactions as a form of attack.
 	// This applies to non-stake transactions only.
@@ -1148,6 +1801,27 @@ func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allow
 		}
 	}
 
+	// Ensure the transaction pays enough to replace the transactions it
+	// conflicts with.
+	var replaced map[chainhash.Hash]*TxDesc
+	if len(conflicts) > 0 {
+		replaced, err = mp.validateReplacement(tx, txFee, conflicts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Ensure the transaction does not depend on too many transactions in
+	// the pool and does not make any of them have too many descendants.
+	// Transactions restored from disconnected blocks are exempt since they
+	// were already mined and so are stake transactions.
+	if isNew && txType == stake.TxTypeRegular {
+		err := mp.checkPackageLimits(tx, replaced)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	flags, err := mp.cfg.Policy.StandardVerifyFlags()
@@ -1163,8 +1837,31 @@ func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allow
 		return nil, err
 	}
 
-	// Add to transaction pool.
+	// The transaction is valid, so there is nothing more to do when it is
+	// only being checked.
+	if checkOnly {
+		return nil, nil
+	}
+
+	// Remove the transactions replaced by the transaction along with their
+	// descendants.
+	for _, txDesc := range replaced {
+		log.Debugf("Replacing transaction %v with %v", txDesc.Tx.Hash(),
+			txHash)
+		mp.removeTransaction(txDesc.Tx, true)
+	}
+
+	// Add to transaction pool and evict transactions paying lower fee rates
+	// when that makes it exceed the maximum size.  The transaction is not
+	// accepted when it, or one of the transactions it spends, is the one
+	// evicted.
 	mp.addTransaction(utxoView, tx, txType, bestHeight, txFee)
+	mp.limitPoolSize()
+	if !mp.isTransactionInPool(txHash) {
+		str := fmt.Sprintf("transaction %v was not accepted since "+
+			"the mempool is full", txHash)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
 
 	// If it's an SSGen (vote), insert it into the list of
 	// votes.
@@ -1194,7 +1891,28 @@ func (mp *TxPool) maybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit, allow
 func (mp *TxPool) MaybeAcceptTransaction(tx *cmmutil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	hashes, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true,
+		false)
+	mp.mtx.Unlock()
+
+	return hashes, err
+}
+
+// CheckTransaction ensures the passed transaction would be accepted into the
+// memory pool without actually adding it.  It is used to validate transactions
+// which must not be announced yet, such as those in the stem phase of
+// Dandelion++ relay.  Free and low-fee transactions are not rate limited since
+// they will be once they are actually added to the pool.
+//
+// It returns a slice of hashes of the transactions the passed one spends which
+// are unknown when it would be an orphan.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckTransaction(tx *cmmutil.Tx, allowHighFees bool) ([]*chainhash.Hash, error) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	hashes, err := mp.maybeAcceptTransaction(tx, true, false, allowHighFees,
+		true)
 	mp.mtx.Unlock()
 
 	return hashes, err
@@ -1245,7 +1963,7 @@ func (mp *TxPool) processOrphans(hash *chainhash.Hash) []*cmmutil.Tx {
 			// Potentially accept the transaction into the
 			// transaction pool.
 			missingParents, err := mp.maybeAcceptTransaction(tx,
-				true, true, true)
+				true, true, true, false)
 			if err != nil {
 				// TODO: Remove orphans that depend on this
 				// failed transaction.
@@ -1380,7 +2098,7 @@ func (mp *TxPool) ProcessTransaction(tx *cmmutil.Tx, allowOrphan, rateLimit, all
 	// Potentially accept the transaction to the memory pool.
 	var missingParents []*chainhash.Hash
 	missingParents, err = mp.maybeAcceptTransaction(tx, true, rateLimit,
-		allowHighFees)
+		allowHighFees, false)
 	if err != nil {
 		return nil, err
 	}
@@ -1482,7 +2200,10 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	descs := make([]*mining.TxDesc, len(mp.pool))
 	i := 0
 	for _, desc := range mp.pool {
-		descs[i] = &desc.TxDesc
+		// Copy the descriptors since the deltas of the transactions
+		// in the pool may change while they are in use.
+		miningDesc := desc.TxDesc
+		descs[i] = &miningDesc
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1510,40 +2231,150 @@ func (mp *TxPool) RawMempoolVerbose(filterType *stake.TxType) map[string]*cmmjso
 			continue
 		}
 
-		// Calculate the current priority based on the inputs to
-		// the transaction.  Use zero if one or more of the
-		// input transactions can't be found for some reason.
 		tx := desc.Tx
-		var currentPriority float64
-		utxos, err := mp.fetchInputUtxos(tx)
-		if err == nil {
-			currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
-				bestHeight+1)
-		}
-
 		mpd := &cmmjson.GetRawMempoolVerboseResult{
 			Size:             int32(tx.MsgTx().SerializeSize()),
 			Fee:              cmmutil.Amount(desc.Fee).ToCoin(),
+			ModifiedFee:      cmmutil.Amount(desc.Fee + desc.FeeDelta).ToCoin(),
 			Time:             desc.Added.Unix(),
 			Height:           desc.Height,
 			StartingPriority: desc.StartingPriority,
-			CurrentPriority:  currentPriority,
-			Depends:          make([]string, 0),
-		}
-		for _, txIn := range tx.MsgTx().TxIn {
-			hash := &txIn.PreviousOutPoint.Hash
-			if mp.haveTransaction(hash) {
-				mpd.Depends = append(mpd.Depends,
-					hash.String())
-			}
+			CurrentPriority:  mp.currentPriority(desc, bestHeight),
+			Depends:          relatedHashes(mp.parents[*tx.Hash()]),
 		}
-
 		result[tx.Hash().String()] = mpd
 	}
 
 	return result
 }
 
+// currentPriority returns the priority of the passed transaction in the pool
+// for the block after the passed best height including its priority delta.
+// The priority is calculated based on the inputs to the transaction, so only
+// the priority delta is used if one or more of the input transactions can't be
+// found for some reason.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) currentPriority(desc *TxDesc, bestHeight int64) float64 {
+	var currentPriority float64
+	utxos, err := mp.fetchInputUtxos(desc.Tx)
+	if err == nil {
+		currentPriority = mining.CalcPriority(desc.Tx.MsgTx(), utxos,
+			bestHeight+1)
+	}
+	return currentPriority + desc.PriorityDelta
+}
+
+// relatedHashes returns the sorted hashes of the passed transactions as
+// strings.
+func relatedHashes(related map[chainhash.Hash]*TxDesc) []string {
+	hashes := make([]string, 0, len(related))
+	for hash := range related {
+		hashes = append(hashes, hash.String())
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// mempoolEntry returns the passed transaction in the pool as a fully populated
+// getmempoolentry JSON result, including the number of transactions, the total
+// size and the total fee of the transaction along with its ancestors and its
+// descendants in the pool, respectively.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) mempoolEntry(desc *TxDesc, bestHeight int64) *cmmjson.GetMempoolEntryResult {
+	tx := desc.Tx
+	ancestors := make(map[chainhash.Hash]*TxDesc)
+	mp.txAncestors(tx, ancestors)
+	ancestorCount, ancestorSize, ancestorFees := packageStats(desc,
+		ancestors)
+	descendants := make(map[chainhash.Hash]*TxDesc)
+	mp.txDescendants(tx, descendants)
+	descendantCount, descendantSize, descendantFees := packageStats(desc,
+		descendants)
+
+	return &cmmjson.GetMempoolEntryResult{
+		Size:             int32(tx.MsgTx().SerializeSize()),
+		Fee:              cmmutil.Amount(desc.Fee).ToCoin(),
+		ModifiedFee:      cmmutil.Amount(desc.Fee + desc.FeeDelta).ToCoin(),
+		Time:             desc.Added.Unix(),
+		Height:           desc.Height,
+		StartingPriority: desc.StartingPriority,
+		CurrentPriority:  mp.currentPriority(desc, bestHeight),
+		DescendantCount:  int64(descendantCount),
+		DescendantSize:   descendantSize,
+		DescendantFees:   cmmutil.Amount(descendantFees).ToCoin(),
+		AncestorCount:    int64(ancestorCount),
+		AncestorSize:     ancestorSize,
+		AncestorFees:     cmmutil.Amount(ancestorFees).ToCoin(),
+		Depends:          relatedHashes(mp.parents[*tx.Hash()]),
+		SpentBy:          relatedHashes(mp.children[*tx.Hash()]),
+	}
+}
+
+// MempoolEntry returns the transaction in the pool with the passed hash as a
+// fully populated getmempoolentry JSON result.  An error is returned when the
+// transaction is not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolEntry(txHash *chainhash.Hash) (*cmmjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	return mp.mempoolEntry(desc, mp.cfg.BestHeight()), nil
+}
+
+// relatedEntries returns the transactions the passed function adds to the map
+// for the transaction in the pool with the passed hash as fully populated
+// getmempoolentry JSON results by transaction hash.  An error is returned when
+// the transaction is not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) relatedEntries(txHash *chainhash.Hash, collect func(*cmmutil.Tx, map[chainhash.Hash]*TxDesc)) (map[string]*cmmjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	related := make(map[chainhash.Hash]*TxDesc)
+	collect(desc.Tx, related)
+
+	bestHeight := mp.cfg.BestHeight()
+	result := make(map[string]*cmmjson.GetMempoolEntryResult, len(related))
+	for hash, desc := range related {
+		result[hash.String()] = mp.mempoolEntry(desc, bestHeight)
+	}
+	return result, nil
+}
+
+// MempoolAncestors returns the transactions in the pool the transaction in the
+// pool with the passed hash depends on, either directly or through other
+// transactions in the pool, as fully populated getmempoolentry JSON results by
+// transaction hash.  An error is returned when the transaction is not in the
+// pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolAncestors(txHash *chainhash.Hash) (map[string]*cmmjson.GetMempoolEntryResult, error) {
+	return mp.relatedEntries(txHash, mp.txAncestors)
+}
+
+// MempoolDescendants returns the transactions in the pool which depend on the
+// transaction in the pool with the passed hash, either directly or through
+// other transactions in the pool, as fully populated getmempoolentry JSON
+// results by transaction hash.  An error is returned when the transaction is
+// not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolDescendants(txHash *chainhash.Hash) (map[string]*cmmjson.GetMempoolEntryResult, error) {
+	return mp.relatedEntries(txHash, mp.txDescendants)
+}
+
 // LastUpdated returns the last time a transaction was added to or removed from
 // the main pool.  It does not include the orphan pool.
 //
@@ -1561,6 +2392,10 @@ func New(cfg *Config) *TxPool {
 		orphans:       make(map[chainhash.Hash]*cmmutil.Tx),
 		orphansByPrev: make(map[chainhash.Hash]map[chainhash.Hash]*cmmutil.Tx),
 		outpoints:     make(map[wire.OutPoint]*cmmutil.Tx),
+		parents:       make(map[chainhash.Hash]map[chainhash.Hash]*TxDesc),
+		children:      make(map[chainhash.Hash]map[chainhash.Hash]*TxDesc),
+		evictEntries:  make(map[chainhash.Hash]*evictEntry),
+		deltas:        make(map[chainhash.Hash]txDelta),
 		votes:         make(map[chainhash.Hash][]mining.VoteDesc),
 	}
 }
@@ -7,18 +7,22 @@
 package mempool
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"reflect"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/CommerciumBlockchain/cmmd/blockchain"
+	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainec"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
 	"github.com/CommerciumBlockchain/cmmd/cmmec/secp256k1"
+	"github.com/CommerciumBlockchain/cmmd/cmmjson"
 	"github.com/CommerciumBlockchain/cmmd/cmmutil"
 	"github.com/CommerciumBlockchain/cmmd/txscript"
 	"github.com/CommerciumBlockchain/cmmd/wire"
@@ -253,15 +257,17 @@ func (p *poolHarness) CreateCoinbaseTx(blockHeight int64, numOutputs uint32) (*c
 
 // CreateSignedTx creates a new signed transaction that consumes the provided
 // inputs and generates the provided number of outputs by evenly splitting the
-// total input amount.  All outputs will be to the payment script associated
-// with the harness and all inputs are assumed to do the same.
-func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32) (*cmmutil.Tx, error) {
+// total input amount minus the provided fee.  All outputs will be to the
+// payment script associated with the harness and all inputs are assumed to do
+// the same.
+func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32, fee cmmutil.Amount) (*cmmutil.Tx, error) {
 	// Calculate the total input amount and split it amongst the requested
 	// number of outputs.
 	var totalInput cmmutil.Amount
 	for _, input := range inputs {
 		totalInput += input.amount
 	}
+	totalInput -= fee
 	amountPerOutput := int64(totalInput) / int64(numOutputs)
 	remainder := int64(totalInput) - amountPerOutput*int64(numOutputs)
 
@@ -287,16 +293,25 @@ func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32
 	}
 
 	// Sign the new transaction.
+	if err := p.SignTx(tx); err != nil {
+		return nil, err
+	}
+
+	return cmmutil.NewTx(tx), nil
+}
+
+// SignTx signs all of the inputs of the passed transaction, which are assumed
+// to spend outputs to the payment script associated with the harness.
+func (p *poolHarness) SignTx(tx *wire.MsgTx) error {
 	for i := range tx.TxIn {
 		sigScript, err := txscript.SignatureScript(tx, i, p.payScript,
 			txscript.SigHashAll, p.signKey, true)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		tx.TxIn[i].SignatureScript = sigScript
 	}
-
-	return cmmutil.NewTx(tx), nil
+	return nil
 }
 
 // CreateTxChain creates a chain of zero-fee transactions (each subsequent
@@ -653,3 +668,784 @@ func TestOrphanEviction(t *testing.T) {
 		}
 	}
 }
+
+// TestCheckTransaction ensures checking a transaction validates it without
+// adding it to the pool and reports the missing parents of orphans.
+func TestCheckTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// Ensure a valid transaction is accepted by the check but not added to
+	// the pool.
+	missingParents, err := harness.txPool.CheckTransaction(chainedTxns[0],
+		true)
+	if err != nil {
+		t.Fatalf("CheckTransaction: failed to accept valid transaction "+
+			"%v", err)
+	}
+	if len(missingParents) != 0 {
+		t.Fatalf("CheckTransaction: reported %d missing parents for "+
+			"non-orphan", len(missingParents))
+	}
+	if harness.txPool.HaveTransaction(chainedTxns[0].Hash()) {
+		t.Fatal("HaveTransaction: true for checked transaction")
+	}
+
+	// Ensure the missing parent of an orphan is reported and the orphan is
+	// not added to the orphan pool.
+	missingParents, err = harness.txPool.CheckTransaction(chainedTxns[1],
+		true)
+	if err != nil {
+		t.Fatalf("CheckTransaction: unexpected error for orphan %v", err)
+	}
+	if len(missingParents) != 1 ||
+		*missingParents[0] != *chainedTxns[0].Hash() {
+
+		t.Fatalf("CheckTransaction: unexpected missing parents %v",
+			missingParents)
+	}
+	if harness.txPool.HaveTransaction(chainedTxns[1].Hash()) {
+		t.Fatal("HaveTransaction: true for checked orphan")
+	}
+
+	// Ensure the transaction can still be added to the pool after it was
+	// checked.
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[0], false, false,
+		true)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept checked "+
+			"transaction %v", err)
+	}
+	if !harness.txPool.IsTransactionInPool(chainedTxns[0].Hash()) {
+		t.Fatal("IsTransactionInPool: false for accepted transaction")
+	}
+}
+
+// TestPoolSizeLimit ensures the transactions paying the lowest fee rates along
+// with their descendants are evicted when the pool exceeds its maximum size and
+// that the minimum fee rate is raised above their fee rate until it decays.
+func TestPoolSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	// Add a coinbase with several mature outputs to the fake chain.
+	coinbase, err := harness.CreateCoinbaseTx(1, 5)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1, wire.NullBlockIndex)
+
+	createTx := func(input spendableOutput, fee cmmutil.Amount) *cmmutil.Tx {
+		tx, err := harness.CreateSignedTx([]spendableOutput{input}, 1,
+			fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	txSize := func(tx *cmmutil.Tx) int64 {
+		return int64(tx.MsgTx().SerializeSize())
+	}
+
+	// Create a transaction paying a low fee whose package pays a high fee
+	// rate due to its child, one paying a medium fee and one paying a high
+	// fee.
+	lowFeeTx := createTx(txOutToSpendableOut(coinbase, 0), 1000)
+	childTx := createTx(txOutToSpendableOut(lowFeeTx, 0), 50000)
+	mediumFeeTx := createTx(txOutToSpendableOut(coinbase, 1), 5000)
+	highFeeTx := createTx(txOutToSpendableOut(coinbase, 2), 10000)
+
+	// Limit the pool so that all but one of the transactions fit.
+	txPool.cfg.Policy.MaxPoolSize = txSize(lowFeeTx) + txSize(childTx) +
+		txSize(mediumFeeTx) + txSize(highFeeTx) - 1
+	for _, tx := range []*cmmutil.Tx{lowFeeTx, childTx, mediumFeeTx} {
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	if feeRate := txPool.MinFeeRate(); feeRate != 0 {
+		t.Fatalf("MinFeeRate: got %v before eviction, want 0", feeRate)
+	}
+
+	// Ensure the transaction whose package pays the lowest fee rate is
+	// evicted when the pool exceeds its maximum size.
+	_, err = txPool.ProcessTransaction(highFeeTx, false, false, true)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid transaction "+
+			"%v", err)
+	}
+	if txPool.IsTransactionInPool(mediumFeeTx.Hash()) {
+		t.Fatal("IsTransactionInPool: true for evicted transaction")
+	}
+	for _, tx := range []*cmmutil.Tx{lowFeeTx, childTx, highFeeTx} {
+		if !txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatalf("IsTransactionInPool: false for transaction %v",
+				tx.Hash())
+		}
+	}
+
+	// Ensure the minimum fee rate was raised above the fee rate of the
+	// evicted transaction.
+	wantFeeRate := cmmutil.Amount(math.Ceil(5000*1000/
+		float64(txSize(mediumFeeTx)))) + txPool.cfg.Policy.MinRelayTxFee
+	if feeRate := txPool.MinFeeRate(); feeRate != wantFeeRate {
+		t.Fatalf("MinFeeRate: got %v, want %v", feeRate, wantFeeRate)
+	}
+
+	// Ensure transactions paying less than the minimum fee rate are
+	// rejected.
+	_, err = txPool.ProcessTransaction(createTx(txOutToSpendableOut(
+		coinbase, 3), 5000), false, false, true)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: got error %v, want insufficient "+
+			"fee rejection", err)
+	}
+
+	// Ensure the minimum fee rate only decays once a block was connected.
+	txPool.mtx.Lock()
+	txPool.lastMinFeeRateBump = time.Now().Add(-minFeeRateHalfLife)
+	txPool.mtx.Unlock()
+	if feeRate := txPool.MinFeeRate(); feeRate != wantFeeRate {
+		t.Fatalf("MinFeeRate: got %v without a block, want %v", feeRate,
+			wantFeeRate)
+	}
+	txPool.BlockConnected(nil)
+	if feeRate := txPool.MinFeeRate(); feeRate > wantFeeRate/2+1 {
+		t.Fatalf("MinFeeRate: got %v after a half-life, want %v",
+			feeRate, wantFeeRate/2)
+	}
+}
+
+// TestEvictionScores ensures transactions are evicted in the order of the
+// higher of the fee rate they pay on their own and together with their
+// descendants, that the scores follow fee deltas, and that tickets beyond the
+// size reserved for stake transactions are evicted without evicting regular
+// transactions or raising the minimum fee rate.
+func TestEvictionScores(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	coinbase, err := harness.CreateCoinbaseTx(1, 5)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1, wire.NullBlockIndex)
+	createTx := func(input spendableOutput, fee cmmutil.Amount) *cmmutil.Tx {
+		tx, err := harness.CreateSignedTx([]spendableOutput{input}, 1,
+			fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	txSize := func(tx *cmmutil.Tx) int64 {
+		return int64(tx.MsgTx().SerializeSize())
+	}
+
+	// Create a transaction paying a high fee with a child paying a low fee
+	// and a transaction paying a medium fee.
+	parentTx := createTx(txOutToSpendableOut(coinbase, 0), 50000)
+	childTx := createTx(txOutToSpendableOut(parentTx, 0), 1000)
+	mediumFeeTx := createTx(txOutToSpendableOut(coinbase, 1), 5000)
+
+	// Ensure only the child paying the low fee is evicted once the pool
+	// exceeds its maximum size even though the package of its parent pays
+	// a lower fee rate than the medium fee transaction.
+	txPool.cfg.Policy.MaxPoolSize = txSize(parentTx) + txSize(childTx) +
+		txSize(mediumFeeTx) - 1
+	for _, tx := range []*cmmutil.Tx{parentTx, childTx, mediumFeeTx} {
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	if txPool.IsTransactionInPool(childTx.Hash()) {
+		t.Fatal("IsTransactionInPool: true for evicted transaction")
+	}
+	for _, tx := range []*cmmutil.Tx{parentTx, mediumFeeTx} {
+		if !txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatalf("IsTransactionInPool: false for transaction %v",
+				tx.Hash())
+		}
+	}
+
+	// newTicket returns a ticket purchase which is unique for the passed
+	// seed.  Tickets are added directly since only
+	// their size and fee matter for eviction.
+	newTicket := func(seed byte) *cmmutil.Tx {
+		tx := wire.NewMsgTx()
+		prevOut := wire.NewOutPoint(&chainhash.Hash{seed}, 0,
+			wire.TxTreeRegular)
+		tx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		tx.AddTxOut(wire.NewTxOut(1e8, harness.payScript))
+		return cmmutil.NewTx(tx)
+	}
+	tickets := []*cmmutil.Tx{newTicket(1), newTicket(2), newTicket(3)}
+	fees := []int64{3000, 1000, 2000}
+
+	// Reserve room for two of the tickets and add all of them.
+	minFeeRate := txPool.MinFeeRate()
+	txPool.mtx.Lock()
+	txPool.cfg.Policy.MaxPoolSize = 2 * txSize(tickets[0]) *
+		stakePoolSizeDivisor
+	for i, ticket := range tickets {
+		txPool.addTransaction(blockchain.NewUtxoViewpoint(), ticket,
+			stake.TxTypeSStx, 1, fees[i])
+	}
+	txPool.limitPoolSize()
+	txPool.mtx.Unlock()
+
+	// Ensure the ticket paying the lowest fee rate is evicted while the
+	// regular transactions are kept and the minimum fee rate is not raised.
+	if txPool.IsTransactionInPool(tickets[1].Hash()) {
+		t.Fatal("IsTransactionInPool: true for evicted ticket")
+	}
+	for _, tx := range []*cmmutil.Tx{tickets[0], tickets[2], parentTx,
+		mediumFeeTx} {
+
+		if !txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatalf("IsTransactionInPool: false for transaction %v",
+				tx.Hash())
+		}
+	}
+	if feeRate := txPool.MinFeeRate(); feeRate != minFeeRate {
+		t.Fatalf("MinFeeRate: got %v after ticket eviction, want %v",
+			feeRate, minFeeRate)
+	}
+
+	// Ensure a fee delta is taken into account by the eviction order.
+	txPool.PrioritiseTransaction(tickets[0].Hash(), 0, -2500)
+	txPool.mtx.Lock()
+	txPool.addTransaction(blockchain.NewUtxoViewpoint(), newTicket(4),
+		stake.TxTypeSStx, 1, 1500)
+	txPool.limitPoolSize()
+	txPool.mtx.Unlock()
+	if txPool.IsTransactionInPool(tickets[0].Hash()) {
+		t.Fatal("IsTransactionInPool: true for deprioritised ticket")
+	}
+	if !txPool.IsTransactionInPool(tickets[2].Hash()) {
+		t.Fatal("IsTransactionInPool: false for ticket")
+	}
+}
+
+// TestReplacement ensures transactions which signal replacement can be replaced
+// along with their descendants by transactions spending the same coins which
+// pay enough and that other transactions can't be.
+func TestReplacement(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	// Add a coinbase with several mature outputs to the fake chain.
+	coinbase, err := harness.CreateCoinbaseTx(1, 5)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1, wire.NullBlockIndex)
+
+	// createTx returns a transaction spending the passed output which pays
+	// the passed fee and signals replacement when requested.
+	createTx := func(input spendableOutput, fee cmmutil.Amount, replaceable bool) *cmmutil.Tx {
+		tx, err := harness.CreateSignedTx([]spendableOutput{input}, 1,
+			fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		if !replaceable {
+			return tx
+		}
+		msgTx := tx.MsgTx()
+		msgTx.TxIn[0].Sequence = maxReplaceableSequenceNum
+		if err := harness.SignTx(msgTx); err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		return cmmutil.NewTx(msgTx)
+	}
+	mustAccept := func(tx *cmmutil.Tx) {
+		t.Helper()
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	mustReject := func(tx *cmmutil.Tx, wantCode wire.RejectCode) {
+		t.Helper()
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if code, _ := extractRejectCode(err); code != wantCode {
+			t.Fatalf("ProcessTransaction: got error %v, want reject "+
+				"code %v", err, wantCode)
+		}
+		if txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatal("IsTransactionInPool: true for rejected " +
+				"replacement")
+		}
+	}
+
+	// Ensure transactions which don't signal replacement are not replaced.
+	finalTx := createTx(txOutToSpendableOut(coinbase, 0), 1000, false)
+	mustAccept(finalTx)
+	mustReject(createTx(txOutToSpendableOut(coinbase, 0), 100000, true),
+		wire.RejectDuplicate)
+
+	// Ensure a replacement must pay more than the replaced transaction and
+	// its descendants.
+	parentTx := createTx(txOutToSpendableOut(coinbase, 1), 1000, true)
+	childTx := createTx(txOutToSpendableOut(parentTx, 0), 5000, false)
+	mustAccept(parentTx)
+	mustAccept(childTx)
+	mustReject(createTx(txOutToSpendableOut(coinbase, 1), 5500, false),
+		wire.RejectInsufficientFee)
+
+	// Ensure a replacement paying enough evicts the replaced transaction
+	// along with its descendants.
+	replacementTx := createTx(txOutToSpendableOut(coinbase, 1), 10000, false)
+	mustAccept(replacementTx)
+	for _, tx := range []*cmmutil.Tx{parentTx, childTx} {
+		if txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatalf("IsTransactionInPool: true for replaced "+
+				"transaction %v", tx.Hash())
+		}
+	}
+	if !txPool.IsTransactionInPool(finalTx.Hash()) {
+		t.Fatal("IsTransactionInPool: false for unrelated transaction")
+	}
+
+	// Ensure the replacement can't be replaced in turn since it does not
+	// signal replacement itself.
+	mustReject(createTx(txOutToSpendableOut(coinbase, 1), 50000, true),
+		wire.RejectDuplicate)
+}
+
+// TestPrioritiseTransaction ensures the deltas set with PrioritiseTransaction
+// apply to transactions which are added to the pool later, are taken into
+// account for evictions and are cleared once the transaction is mined.
+func TestPrioritiseTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	// Add a coinbase with several mature outputs to the fake chain.
+	coinbase, err := harness.CreateCoinbaseTx(1, 2)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1, wire.NullBlockIndex)
+
+	lowFeeTx, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(coinbase, 0)}, 1, 1000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	highFeeTx, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(coinbase, 1)}, 1, 10000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	// Prioritise the transaction paying the low fee before it is added to
+	// the pool.
+	txPool.PrioritiseTransaction(lowFeeTx.Hash(), 1.5, 50000)
+	for _, tx := range []*cmmutil.Tx{lowFeeTx, highFeeTx} {
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	for _, desc := range txPool.MiningDescs() {
+		wantFeeDelta, wantPriorityDelta := int64(0), 0.0
+		if *desc.Tx.Hash() == *lowFeeTx.Hash() {
+			wantFeeDelta, wantPriorityDelta = 50000, 1.5
+		}
+		if desc.FeeDelta != wantFeeDelta ||
+			desc.PriorityDelta != wantPriorityDelta {
+
+			t.Fatalf("MiningDescs: got deltas %v and %v for %v, "+
+				"want %v and %v", desc.PriorityDelta,
+				desc.FeeDelta, desc.Tx.Hash(), wantPriorityDelta,
+				wantFeeDelta)
+		}
+	}
+	verbose := txPool.RawMempoolVerbose(nil)
+	wantModifiedFee := cmmutil.Amount(51000).ToCoin()
+	if fee := verbose[lowFeeTx.Hash().String()].ModifiedFee; fee != wantModifiedFee {
+		t.Fatalf("RawMempoolVerbose: got modified fee %v, want %v", fee,
+			wantModifiedFee)
+	}
+
+	// Ensure the fee delta is taken into account when choosing which
+	// transaction to evict.
+	txPool.mtx.RLock()
+	lowest := txPool.regularEvictHeap[0].txDesc
+	txPool.mtx.RUnlock()
+	if *lowest.Tx.Hash() != *highFeeTx.Hash() {
+		t.Fatalf("regularEvictHeap: got %v first, want %v",
+			lowest.Tx.Hash(), highFeeTx.Hash())
+	}
+
+	// Ensure deltas which add up to zero are removed.
+	txPool.PrioritiseTransaction(lowFeeTx.Hash(), -1.5, -50000)
+	txPool.mtx.RLock()
+	desc := txPool.pool[*lowFeeTx.Hash()]
+	numDeltas := len(txPool.deltas)
+	txPool.mtx.RUnlock()
+	if desc.FeeDelta != 0 || desc.PriorityDelta != 0 || numDeltas != 0 {
+		t.Fatalf("PrioritiseTransaction: got deltas %v and %v and %d "+
+			"prioritised transactions after reverting the deltas",
+			desc.PriorityDelta, desc.FeeDelta, numDeltas)
+	}
+
+	// Ensure the deltas of mined transactions are cleared.
+	txPool.PrioritiseTransaction(highFeeTx.Hash(), 0, 1000)
+	txPool.BlockConnected([]*cmmutil.Tx{highFeeTx})
+	txPool.mtx.RLock()
+	numDeltas = len(txPool.deltas)
+	txPool.mtx.RUnlock()
+	if numDeltas != 0 {
+		t.Fatalf("BlockConnected: got %d prioritised transactions, "+
+			"want 0", numDeltas)
+	}
+}
+
+// TestPackageTracking ensures the dependencies between the transactions in the
+// pool are tracked as transactions are added and removed, that they are
+// reported by the entry queries and that the ancestor and descendant limits of
+// the policy are enforced.
+func TestPackageTracking(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], 5)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns[:4] {
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+
+	// Ensure the entry of a transaction in the middle of the chain reports
+	// its ancestors and descendants.
+	entry, err := txPool.MempoolEntry(chainedTxns[1].Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if entry.AncestorCount != 2 || entry.DescendantCount != 3 {
+		t.Fatalf("MempoolEntry: got %d ancestors and %d descendants, "+
+			"want 2 and 3", entry.AncestorCount, entry.DescendantCount)
+	}
+	wantSize := int64(0)
+	for _, tx := range chainedTxns[1:4] {
+		wantSize += int64(tx.MsgTx().SerializeSize())
+	}
+	if entry.DescendantSize != wantSize {
+		t.Fatalf("MempoolEntry: got descendant size %d, want %d",
+			entry.DescendantSize, wantSize)
+	}
+	wantDepends := []string{chainedTxns[0].Hash().String()}
+	wantSpentBy := []string{chainedTxns[2].Hash().String()}
+	if !reflect.DeepEqual(entry.Depends, wantDepends) ||
+		!reflect.DeepEqual(entry.SpentBy, wantSpentBy) {
+
+		t.Fatalf("MempoolEntry: got depends %v and spent by %v, want "+
+			"%v and %v", entry.Depends, entry.SpentBy, wantDepends,
+			wantSpentBy)
+	}
+	if _, err := txPool.MempoolEntry(chainedTxns[4].Hash()); err == nil {
+		t.Fatal("MempoolEntry: unexpected success for transaction not " +
+			"in the pool")
+	}
+
+	// checkRelated ensures the passed related entries are for exactly the
+	// passed transactions.
+	checkRelated := func(name string, entries map[string]*cmmjson.GetMempoolEntryResult, err error, want []*cmmutil.Tx) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(entries) != len(want) {
+			t.Fatalf("%s: got %d transactions, want %d", name,
+				len(entries), len(want))
+		}
+		for _, tx := range want {
+			if _, ok := entries[tx.Hash().String()]; !ok {
+				t.Fatalf("%s: transaction %v missing", name,
+					tx.Hash())
+			}
+		}
+	}
+	entries, err := txPool.MempoolAncestors(chainedTxns[3].Hash())
+	checkRelated("MempoolAncestors", entries, err, chainedTxns[:3])
+	entries, err = txPool.MempoolDescendants(chainedTxns[0].Hash())
+	checkRelated("MempoolDescendants", entries, err, chainedTxns[1:4])
+
+	// Ensure transactions exceeding the ancestor or descendant limits are
+	// rejected.
+	txPool.cfg.Policy.MaxAncestorCount = 4
+	_, err = txPool.ProcessTransaction(chainedTxns[4], false, false, true)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: got error %v, want ancestor limit "+
+			"rejection", err)
+	}
+	txPool.cfg.Policy.MaxAncestorCount = 0
+	txPool.cfg.Policy.MaxDescendantCount = 4
+	_, err = txPool.ProcessTransaction(chainedTxns[4], false, false, true)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: got error %v, want descendant "+
+			"limit rejection", err)
+	}
+
+	// Ensure the dependencies on a mined transaction are removed and
+	// restored when it is added back to the pool, such as when the block
+	// it was mined in is disconnected.
+	txPool.RemoveTransaction(chainedTxns[0], false)
+	entry, err = txPool.MempoolEntry(chainedTxns[1].Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if entry.AncestorCount != 1 || len(entry.Depends) != 0 {
+		t.Fatalf("MempoolEntry: got %d ancestors and depends %v after "+
+			"removing the parent, want 1 and none",
+			entry.AncestorCount, entry.Depends)
+	}
+	_, err = txPool.MaybeAcceptTransaction(chainedTxns[0], false, false)
+	if err != nil {
+		t.Fatalf("MaybeAcceptTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	entry, err = txPool.MempoolEntry(chainedTxns[1].Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if entry.AncestorCount != 2 || !reflect.DeepEqual(entry.Depends, wantDepends) {
+		t.Fatalf("MempoolEntry: got %d ancestors and depends %v after "+
+			"restoring the parent, want 2 and %v",
+			entry.AncestorCount, entry.Depends, wantDepends)
+	}
+}
+
+// TestPackageLimitsStake ensures stake transactions in the pool do not count
+// towards the ancestor and descendant limits of regular transactions while the
+// regular transactions still do.
+func TestPackageLimitsStake(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	coinbase, err := harness.CreateCoinbaseTx(1, 1)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1, wire.NullBlockIndex)
+	splitTx, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(coinbase, 0)}, 5, 10000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(splitTx, false, false, true)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid transaction "+
+			"%v", err)
+	}
+
+	// Add tickets spending outputs of the split transaction which exceed
+	// the descendant limit.  Tickets are added directly since only their
+	// dependencies matter for the limits.
+	txPool.cfg.Policy.MaxAncestorCount = 2
+	txPool.cfg.Policy.MaxDescendantCount = 3
+	txPool.mtx.Lock()
+	for i := uint32(0); i < 3; i++ {
+		ticket := wire.NewMsgTx()
+		prevOut := wire.NewOutPoint(splitTx.Hash(), i, wire.TxTreeRegular)
+		ticket.AddTxIn(wire.NewTxIn(prevOut, nil))
+		ticket.AddTxOut(wire.NewTxOut(1e8, harness.payScript))
+		txPool.addTransaction(blockchain.NewUtxoViewpoint(),
+			cmmutil.NewTx(ticket), stake.TxTypeSStx, 1, 1000)
+	}
+	txPool.mtx.Unlock()
+
+	// Ensure a regular transaction spending the split transaction is
+	// accepted despite the tickets.
+	childTx, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(splitTx, 3)}, 1, 10000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(childTx, false, false, true)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept transaction "+
+			"spending a ticket split: %v", err)
+	}
+
+	// Ensure regular transactions still count towards the limits.
+	grandchildTx, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(childTx, 0)}, 1, 10000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(grandchildTx, false, false, true)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: got error %v, want ancestor limit "+
+			"rejection", err)
+	}
+}
+
+// TestPersist ensures the transactions in the pool are persisted in an order
+// which allows reloading them and that reloading them restores the time they
+// were added to the pool.
+func TestPersist(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	txPool := harness.txPool
+
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		_, err := txPool.ProcessTransaction(tx, false, false, true)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+
+	// Mark the transactions as added in the reverse order so the
+	// persisted order must account for their dependencies.
+	added := time.Unix(1500000000, 0)
+	for i, tx := range chainedTxns {
+		offset := time.Duration(len(chainedTxns)-i) * time.Minute
+		txPool.pool[*tx.Hash()].Added = added.Add(offset)
+	}
+
+	txPool.PrioritiseTransaction(chainedTxns[1].Hash(), 0, 1000)
+	pendingHash := chainhash.Hash{0x01}
+	txPool.PrioritiseTransaction(&pendingHash, 1.5, 2000)
+
+	var buf bytes.Buffer
+	tipHash := harness.chain.BestHash()
+	tipHeight := harness.chain.BestHeight()
+	if err := txPool.Persist(&buf, tipHash, tipHeight); err != nil {
+		t.Fatalf("Persist: unexpected error: %v", err)
+	}
+	persisted, err := ReadPersisted(&buf)
+	if err != nil {
+		t.Fatalf("ReadPersisted: unexpected error: %v", err)
+	}
+	if persisted.TipHash != *tipHash || persisted.TipHeight != tipHeight {
+		t.Fatalf("ReadPersisted: got tip %v (height %d), want %v "+
+			"(height %d)", persisted.TipHash, persisted.TipHeight,
+			tipHash, tipHeight)
+	}
+	if len(persisted.Txns) != len(chainedTxns) {
+		t.Fatalf("ReadPersisted: got %d transactions, want %d",
+			len(persisted.Txns), len(chainedTxns))
+	}
+	for i, ptx := range persisted.Txns {
+		if *ptx.Tx.Hash() != *chainedTxns[i].Hash() {
+			t.Fatalf("ReadPersisted: got transaction %v at index %d, "+
+				"want %v", ptx.Tx.Hash(), i, chainedTxns[i].Hash())
+		}
+	}
+	wantDeltas := []*PersistedDelta{{Hash: pendingHash, FeeDelta: 2000,
+		PriorityDelta: 1.5}}
+	if !reflect.DeepEqual(persisted.Deltas, wantDeltas) {
+		t.Fatalf("ReadPersisted: got deltas %v, want %v",
+			persisted.Deltas, wantDeltas)
+	}
+
+	// Ensure all of the transactions are reloaded into an empty pool along
+	// with the time they were added and their deltas.
+	txPool.RemoveTransaction(chainedTxns[0], true)
+	txPool.PrioritiseTransaction(chainedTxns[1].Hash(), 0, -1000)
+	txPool.PrioritiseTransaction(&pendingHash, -1.5, -2000)
+	if count := txPool.Count(); count != 0 {
+		t.Fatalf("Count: got %d transactions after removal, want 0",
+			count)
+	}
+	accepted := txPool.LoadPersisted(persisted)
+	if len(accepted) != len(chainedTxns) {
+		t.Fatalf("LoadPersisted: got %d accepted transactions, want %d",
+			len(accepted), len(chainedTxns))
+	}
+	for _, ptx := range persisted.Txns {
+		desc, ok := txPool.pool[*ptx.Tx.Hash()]
+		if !ok {
+			t.Fatalf("LoadPersisted: transaction %v not in pool",
+				ptx.Tx.Hash())
+		}
+		if !desc.Added.Equal(ptx.Added) {
+			t.Fatalf("LoadPersisted: got added time %v for %v, want %v",
+				desc.Added, ptx.Tx.Hash(), ptx.Added)
+		}
+		wantFeeDelta := int64(0)
+		if *ptx.Tx.Hash() == *chainedTxns[1].Hash() {
+			wantFeeDelta = 1000
+		}
+		if desc.FeeDelta != wantFeeDelta {
+			t.Fatalf("LoadPersisted: got fee delta %d for %v, want %d",
+				desc.FeeDelta, ptx.Tx.Hash(), wantFeeDelta)
+		}
+	}
+
+	// Ensure the deltas of transactions which are not in the pool are
+	// restored as well.
+	wantDelta := txDelta{priority: 1.5, fee: 2000}
+	if delta := txPool.deltas[pendingHash]; delta != wantDelta {
+		t.Fatalf("LoadPersisted: got pending delta %+v, want %+v", delta,
+			wantDelta)
+	}
+
+	// Ensure reading a persisted pool of an unknown version fails.
+	_, err = ReadPersisted(bytes.NewReader([]byte{0xff, 0, 0, 0}))
+	if err == nil {
+		t.Fatal("ReadPersisted: unexpected success for unknown version")
+	}
+}
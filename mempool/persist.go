@@ -0,0 +1,278 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// persistVersion is the version of the format the memory pool is persisted in.
+const persistVersion = 1
+
+// PersistedTx describes a transaction of a persisted memory pool.
+type PersistedTx struct {
+	// Tx is the persisted transaction.
+	Tx *cmmutil.Tx
+
+	// Added is the time when the transaction was added to the pool.
+	Added time.Time
+
+	// FeeDelta and PriorityDelta are the deltas of the transaction set with
+	// PrioritiseTransaction.
+	FeeDelta      int64
+	PriorityDelta float64
+}
+
+// PersistedDelta describes the deltas set with PrioritiseTransaction for a
+// transaction which was not in the persisted memory pool.
+type PersistedDelta struct {
+	Hash          chainhash.Hash
+	FeeDelta      int64
+	PriorityDelta float64
+}
+
+// PersistedPool describes the transactions of a persisted memory pool along
+// with the deltas of transactions which were not in the pool yet and the best
+// chain tip at the time it was persisted.
+type PersistedPool struct {
+	TipHash   chainhash.Hash
+	TipHeight int64
+	Txns      []*PersistedTx
+	Deltas    []*PersistedDelta
+}
+
+// persistedEntry is the format the metadata of a transaction is persisted in.
+// It precedes the serialized transaction.
+type persistedEntry struct {
+	Added         int64
+	FeeDelta      int64
+	PriorityDelta float64
+}
+
+// persistOrder returns the transactions in the pool in the order they were
+// added in such that every transaction follows the transactions in the pool
+// it spends outputs of.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) persistOrder() []*TxDesc {
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc)
+	}
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].Added.Before(descs[j].Added)
+	})
+
+	// Transactions added within the resolution of the clock may still be
+	// out of order, so visit the parents of each transaction first.
+	ordered := make([]*TxDesc, 0, len(descs))
+	visited := make(map[chainhash.Hash]struct{}, len(descs))
+	var visit func(desc *TxDesc)
+	visit = func(desc *TxDesc) {
+		if _, ok := visited[*desc.Tx.Hash()]; ok {
+			return
+		}
+		visited[*desc.Tx.Hash()] = struct{}{}
+		for _, txIn := range desc.Tx.MsgTx().TxIn {
+			parent, ok := mp.pool[txIn.PreviousOutPoint.Hash]
+			if ok {
+				visit(parent)
+			}
+		}
+		ordered = append(ordered, desc)
+	}
+	for _, desc := range descs {
+		visit(desc)
+	}
+	return ordered
+}
+
+// Persist writes all of the transactions in the pool along with the time they
+// were added and their deltas, followed by the deltas of transactions which are
+// not in the pool yet, to the passed writer so they can be reloaded with
+// ReadPersisted and LoadPersisted after a restart.  The passed best chain tip
+// is recorded so callers are able to tell how stale the transactions are when
+// reloading them.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Persist(w io.Writer, tipHash *chainhash.Hash, tipHeight int64) error {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	err := binary.Write(w, binary.LittleEndian, uint32(persistVersion))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(tipHash[:]); err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, tipHeight)
+	if err != nil {
+		return err
+	}
+
+	ordered := mp.persistOrder()
+	err = wire.WriteVarInt(w, 0, uint64(len(ordered)))
+	if err != nil {
+		return err
+	}
+	for _, desc := range ordered {
+		entry := persistedEntry{
+			Added:         desc.Added.Unix(),
+			FeeDelta:      desc.FeeDelta,
+			PriorityDelta: desc.PriorityDelta,
+		}
+		err := binary.Write(w, binary.LittleEndian, &entry)
+		if err != nil {
+			return err
+		}
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return err
+		}
+	}
+
+	// Write the deltas of the transactions which are not in the pool in a
+	// deterministic order.
+	var pending []*PersistedDelta
+	for hash, delta := range mp.deltas {
+		if _, ok := mp.pool[hash]; ok {
+			continue
+		}
+		pending = append(pending, &PersistedDelta{
+			Hash:          hash,
+			FeeDelta:      delta.fee,
+			PriorityDelta: delta.priority,
+		})
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return bytes.Compare(pending[i].Hash[:], pending[j].Hash[:]) < 0
+	})
+	err = wire.WriteVarInt(w, 0, uint64(len(pending)))
+	if err != nil {
+		return err
+	}
+	for _, delta := range pending {
+		err := binary.Write(w, binary.LittleEndian, delta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPersisted reads a memory pool written with Persist from the passed
+// reader.
+func ReadPersisted(r io.Reader) (*PersistedPool, error) {
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != persistVersion {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+
+	var persisted PersistedPool
+	if _, err := io.ReadFull(r, persisted.TipHash[:]); err != nil {
+		return nil, err
+	}
+	err := binary.Read(r, binary.LittleEndian, &persisted.TipHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var entry persistedEntry
+		err := binary.Read(r, binary.LittleEndian, &entry)
+		if err != nil {
+			return nil, err
+		}
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return nil, err
+		}
+		persisted.Txns = append(persisted.Txns, &PersistedTx{
+			Tx:            cmmutil.NewTx(&msgTx),
+			Added:         time.Unix(entry.Added, 0),
+			FeeDelta:      entry.FeeDelta,
+			PriorityDelta: entry.PriorityDelta,
+		})
+	}
+
+	count, err = wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var delta PersistedDelta
+		err := binary.Read(r, binary.LittleEndian, &delta)
+		if err != nil {
+			return nil, err
+		}
+		persisted.Deltas = append(persisted.Deltas, &delta)
+	}
+	return &persisted, nil
+}
+
+// LoadPersisted restores the deltas of the transactions which were not in the
+// passed persisted memory pool and processes its transactions with the current
+// policy while restoring the time they were added to the pool along with their
+// deltas.  Transactions which are no longer accepted, such as those mined or
+// double spent in the meantime, are skipped.  It returns the transactions which
+// were accepted to the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) LoadPersisted(persisted *PersistedPool) []*cmmutil.Tx {
+	for _, delta := range persisted.Deltas {
+		mp.PrioritiseTransaction(&delta.Hash, delta.PriorityDelta,
+			delta.FeeDelta)
+	}
+
+	var accepted []*cmmutil.Tx
+	for _, ptx := range persisted.Txns {
+		// Restore the deltas first so they apply to the transaction
+		// when it is added to the pool.
+		hash := ptx.Tx.Hash()
+		hasDeltas := ptx.FeeDelta != 0 || ptx.PriorityDelta != 0
+		if hasDeltas {
+			mp.PrioritiseTransaction(hash, ptx.PriorityDelta,
+				ptx.FeeDelta)
+		}
+
+		// The transactions were already accepted to the pool before, so
+		// neither rate limit them nor reject them for high fees.
+		acceptedTxs, err := mp.ProcessTransaction(ptx.Tx, false, false,
+			true)
+		if err != nil {
+			log.Debugf("Unable to reload transaction %v: %v", hash,
+				err)
+			if hasDeltas {
+				mp.PrioritiseTransaction(hash, -ptx.PriorityDelta,
+					-ptx.FeeDelta)
+			}
+			continue
+		}
+		accepted = append(accepted, acceptedTxs...)
+
+		mp.mtx.Lock()
+		if desc, ok := mp.pool[*hash]; ok {
+			desc.Added = ptx.Added
+		}
+		mp.mtx.Unlock()
+	}
+	return accepted
+}
@@ -57,6 +57,7 @@ type txPrioItem struct {
 	tx       *cmmutil.Tx
 	txType   stake.TxType
 	fee      int64
+	feeDelta int64
 	priority float64
 	feePerKB float64
 
@@ -231,6 +232,60 @@ func newTxPriorityQueue(reserve int, lessFunc func(*txPriorityQueue, int, int) b
 	return pq
 }
 
+// regularAncestors adds the transactions in the passed set of transactions
+// which the passed transaction depends on, either directly or indirectly, to
+// the passed map.  It returns false when any of them is a stake transaction or
+// is not in the set.
+func regularAncestors(prioItem *txPrioItem, prioItems, ancestors map[chainhash.Hash]*txPrioItem) bool {
+	for hash := range prioItem.dependsOn {
+		if _, seen := ancestors[hash]; seen {
+			continue
+		}
+		parent, exists := prioItems[hash]
+		if !exists || parent.txType != stake.TxTypeRegular {
+			return false
+		}
+		ancestors[hash] = parent
+		if !regularAncestors(parent, prioItems, ancestors) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyAncestorFeeRates raises the fee per kilobyte of the transactions in the
+// passed set which other regular transactions in the set depend on to the fee
+// per kilobyte of the package made up of such a transaction and all of its
+// ancestors in the set, when that is higher.  This allows a transaction paying
+// a high fee to pull the transactions it depends on into a block (child pays
+// for parent).  Stake transactions are excluded.
+func applyAncestorFeeRates(prioItems map[chainhash.Hash]*txPrioItem) {
+	for _, prioItem := range prioItems {
+		if prioItem.txType != stake.TxTypeRegular ||
+			len(prioItem.dependsOn) == 0 {
+
+			continue
+		}
+
+		ancestors := make(map[chainhash.Hash]*txPrioItem)
+		if !regularAncestors(prioItem, prioItems, ancestors) {
+			continue
+		}
+		fee := prioItem.fee + prioItem.feeDelta
+		size := int64(prioItem.tx.MsgTx().SerializeSize())
+		for _, ancestor := range ancestors {
+			fee += ancestor.fee + ancestor.feeDelta
+			size += int64(ancestor.tx.MsgTx().SerializeSize())
+		}
+		feePerKB := (float64(fee) * float64(kilobyte)) / float64(size)
+		for _, ancestor := range ancestors {
+			if feePerKB > ancestor.feePerKB {
+				ancestor.feePerKB = feePerKB
+			}
+		}
+	}
+}
+
 // containsTx is a helper function that checks to see if a list of transactions
 // contains any of the TxIns of some transaction.
 func containsTxIns(txs []*cmmutil.Tx, tx *cmmutil.Tx) bool {
@@ -983,8 +1038,9 @@ func handleCreatedBlockTemplate(blockTemplate *BlockTemplate, bm *blockManager)
 // value, age of inputs, and size.  Transactions which consist of larger
 // amounts, older inputs, and small sizes have the highest priority.  Second, a
 // fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// policy settings are all taken into account.
+// higher fee per kilobyte are preferred.  Both include the deltas set for the
+// transaction with prioritisetransaction.  Finally, the block generation
+// related policy settings are all taken into account.
 //
 // Transactions which only spend outputs from other transactions already in the
 // block chain are immediately added to a priority queue which either
@@ -993,7 +1049,10 @@ func handleCreatedBlockTemplate(blockTemplate *BlockTemplate, bm *blockManager)
 // policy setting allots space for high-priority transactions.  Transactions
 // which spend outputs from other transactions in the source pool are added to a
 // dependency map so they can be added to the priority queue once the
-// transactions they depend on have been included.
+// transactions they depend on have been included.  The regular transactions
+// they depend on use the fee per kilobyte of the package made up of the
+// dependent transaction and all of its ancestors when it is higher, so a
+// transaction paying a high fee pulls in the transactions it depends on.
 //
 // Once the high-priority area (if configured) has been filled with
 // transactions, or the priority falls below what is considered high-priority,
@@ -1210,6 +1269,7 @@ func NewBlockTemplate(policy *mining.Policy, server *server, payToAddress cmmuti
 	minrLog.Debugf("Considering %d transactions for inclusion to new block",
 		len(sourceTxns))
 	treeKnownInvalid := txSource.IsTxTreeKnownInvalid(prevHash)
+	prioItems := make(map[chainhash.Hash]*txPrioItem, len(sourceTxns))
 
 mempoolLoop:
 	for _, txDesc := range sourceTxns {
@@ -1300,24 +1360,24 @@ mempoolLoop:
 		// Calculate the final transaction priority using the input
 		// value age sum as well as the adjusted transaction size.  The
 		// formula is: sum(inputValue * inputAge) / adjustedTxSize
+		// The priority delta set with prioritisetransaction is added to
+		// it.
 		prioItem.priority = mining.CalcPriority(tx.MsgTx(), utxos,
-			nextBlockHeight)
+			nextBlockHeight) + txDesc.PriorityDelta
 
-		// Calculate the fee in Atoms/KB.
+		// Calculate the fee in Atoms/KB including the fee delta set
+		// with prioritisetransaction.
 		// NOTE: This is a more precise value than the one calculated
 		// during calcMinRelayFee which rounds up to the nearest full
 		// kilobyte boundary.  This is beneficial since it provides an
 		// incentive to create smaller transactions.
 		txSize := tx.MsgTx().SerializeSize()
-		prioItem.feePerKB = (float64(txDesc.Fee) * float64(kilobyte)) /
+		modifiedFee := txDesc.Fee + txDesc.FeeDelta
+		prioItem.feePerKB = (float64(modifiedFee) * float64(kilobyte)) /
 			float64(txSize)
 		prioItem.fee = txDesc.Fee
-
-		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
-		if prioItem.dependsOn == nil {
-			heap.Push(priorityQueue, prioItem)
-		}
+		prioItem.feeDelta = txDesc.FeeDelta
+		prioItems[*tx.Hash()] = prioItem
 
 		// Merge the referenced outputs from the input transactions to
 		// this transaction into the block utxo view.  This allows the
@@ -1325,6 +1385,17 @@ mempoolLoop:
 		mergeUtxoView(blockUtxos, utxos)
 	}
 
+	// Select regular transactions which other transactions depend on by the
+	// fee per kilobyte of the packages they are part of and add the
+	// transactions to the priority queue to mark them ready for inclusion in
+	// the block unless they have dependencies.
+	applyAncestorFeeRates(prioItems)
+	for _, prioItem := range prioItems {
+		if prioItem.dependsOn == nil {
+			heap.Push(priorityQueue, prioItem)
+		}
+	}
+
 	minrLog.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
 
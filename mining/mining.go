@@ -32,6 +32,12 @@ type TxDesc struct {
 
 	// Fee is the total fee the transaction associated with the entry pays.
 	Fee int64
+
+	// FeeDelta and PriorityDelta are added to the fee and priority of the
+	// transaction associated with the entry when prioritizing it for
+	// inclusion in a block.  They do not change the fee it pays.
+	FeeDelta      int64
+	PriorityDelta float64
 }
 
 // VoteDesc is a descriptor about a vote transaction in a transaction source
@@ -12,6 +12,9 @@ import (
 	"testing"
 
 	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/wire"
 )
 
 // TestStakeTxFeePrioHeap tests the priority heaps including the stake types for
@@ -127,3 +130,84 @@ func TestStakeTxFeePrioHeap(t *testing.T) {
 		}
 	}
 }
+
+// TestApplyAncestorFeeRates ensures regular transactions which other regular
+// transactions depend on are selected by the fee per kilobyte of the packages
+// made up of the dependent transactions and their ancestors when it is higher,
+// and that stake transactions are excluded.
+func TestApplyAncestorFeeRates(t *testing.T) {
+	// newItem returns a priority item for a transaction of the passed type
+	// paying the passed fee which spends outputs of the passed transactions.
+	newItem := func(txType stake.TxType, fee int64, parents ...*txPrioItem) *txPrioItem {
+		msgTx := wire.NewMsgTx()
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+			uint32(rand.Int31()), wire.TxTreeRegular), nil))
+		msgTx.AddTxOut(wire.NewTxOut(1e8, []byte{0x51}))
+		item := &txPrioItem{
+			tx:       cmmutil.NewTx(msgTx),
+			txType:   txType,
+			fee:      fee,
+			feePerKB: float64(fee) * kilobyte / float64(msgTx.SerializeSize()),
+		}
+		for _, parent := range parents {
+			if item.dependsOn == nil {
+				item.dependsOn = make(map[chainhash.Hash]struct{})
+			}
+			item.dependsOn[*parent.tx.Hash()] = struct{}{}
+		}
+		return item
+	}
+	size := func(items ...*txPrioItem) float64 {
+		var size int
+		for _, item := range items {
+			size += item.tx.MsgTx().SerializeSize()
+		}
+		return float64(size)
+	}
+
+	grandparent := newItem(stake.TxTypeRegular, 0)
+	parent := newItem(stake.TxTypeRegular, 1000, grandparent)
+	child := newItem(stake.TxTypeRegular, 100000, parent)
+	highFee := newItem(stake.TxTypeRegular, 500000)
+	lowFeeChild := newItem(stake.TxTypeRegular, 0, highFee)
+	ticket := newItem(stake.TxTypeSStx, 0)
+	ticketChild := newItem(stake.TxTypeRegular, 100000, ticket)
+
+	prioItems := make(map[chainhash.Hash]*txPrioItem)
+	for _, item := range []*txPrioItem{grandparent, parent, child, highFee,
+		lowFeeChild, ticket, ticketChild} {
+
+		prioItems[*item.tx.Hash()] = item
+	}
+	highFeePerKB := highFee.feePerKB
+	childFeePerKB := child.feePerKB
+	applyAncestorFeeRates(prioItems)
+
+	// Ensure the ancestors of the child paying a high fee are selected by the
+	// fee per kilobyte of the whole package.
+	wantFeePerKB := 101000 * kilobyte / size(grandparent, parent, child)
+	if grandparent.feePerKB != wantFeePerKB {
+		t.Errorf("grandparent fee per KB: got %v, want %v",
+			grandparent.feePerKB, wantFeePerKB)
+	}
+	if parent.feePerKB != wantFeePerKB {
+		t.Errorf("parent fee per KB: got %v, want %v", parent.feePerKB,
+			wantFeePerKB)
+	}
+	if child.feePerKB != childFeePerKB {
+		t.Errorf("child fee per KB: got %v, want %v", child.feePerKB,
+			childFeePerKB)
+	}
+
+	// Ensure a child paying a low fee does not lower the fee per kilobyte of
+	// its parent.
+	if highFee.feePerKB != highFeePerKB {
+		t.Errorf("parent of low fee child fee per KB: got %v, want %v",
+			highFee.feePerKB, highFeePerKB)
+	}
+
+	// Ensure stake transactions are not pulled in by their children.
+	if ticket.feePerKB != 0 {
+		t.Errorf("ticket fee per KB: got %v, want 0", ticket.feePerKB)
+	}
+}
@@ -19,7 +19,8 @@ var activeNetParams = &mainNetParams
 // network and test networks.
 type params struct {
 	*chaincfg.Params
-	rpcPort string
+	rpcPort     string
+	stratumPort string
 }
 
 // mainNetParams contains parameters specific to the main network
@@ -29,22 +30,25 @@ type params struct {
 // it does not handle on to cmmd.  This approach allows the wallet process
 // to emulate the full reference implementation RPC API.
 var mainNetParams = params{
-	Params:  &chaincfg.MainNetParams,
-	rpcPort: "9109",
+	Params:      &chaincfg.MainNetParams,
+	rpcPort:     "9109",
+	stratumPort: "9112",
 }
 
 // testNetParams contains parameters specific to the test network
 // (wire.TestNet).
 var testNetParams = params{
-	Params:  &chaincfg.TestNetParams,
-	rpcPort: "19109",
+	Params:      &chaincfg.TestNetParams,
+	rpcPort:     "19109",
+	stratumPort: "19112",
 }
 
 // simNetParams contains parameters specific to the simulation test network
 // (wire.SimNet).
 var simNetParams = params{
-	Params:  &chaincfg.SimNetParams,
-	rpcPort: "19556",
+	Params:      &chaincfg.SimNetParams,
+	rpcPort:     "19556",
+	stratumPort: "19559",
 }
 
 // netName returns the name used when referring to a Commercium network.  At the
@@ -0,0 +1,379 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+const (
+	// captureVersion is the version of the message capture file format.
+	captureVersion = 1
+
+	// captureHeaderSize is the size of the header at the start of message
+	// capture files.  It consists of the magic bytes, the version and the
+	// network of the captured messages.
+	captureHeaderSize = 12
+
+	// captureFilePrefix and captureFileSuffix are the prefix and suffix of
+	// the names of message capture files.
+	captureFilePrefix = "msgcapture-"
+	captureFileSuffix = ".cap"
+)
+
+// captureMagic identifies message capture files.
+var captureMagic = [4]byte{'c', 'm', 'm', 'c'}
+
+// CaptureDirection indicates whether a captured message was received from or
+// sent to a peer.
+type CaptureDirection uint8
+
+const (
+	// CaptureRecv indicates the message was received from the peer.
+	CaptureRecv CaptureDirection = iota
+
+	// CaptureSent indicates the message was sent to the peer.
+	CaptureSent
+)
+
+// String returns the CaptureDirection in human-readable form.
+func (d CaptureDirection) String() string {
+	switch d {
+	case CaptureRecv:
+		return "recv"
+	case CaptureSent:
+		return "sent"
+	}
+	return fmt.Sprintf("Unknown CaptureDirection (%d)", uint8(d))
+}
+
+// CaptureRecord is a single message read from or written to a peer along with
+// when it happened and the address of the peer.  The message is recorded as the
+// raw command and payload exactly as they were received or sent, so messages
+// which fail to decode are recorded as well.
+type CaptureRecord struct {
+	Timestamp       time.Time
+	Direction       CaptureDirection
+	Addr            string
+	ProtocolVersion uint32
+	Command         string
+	Payload         []byte
+}
+
+// Message decodes the recorded message using the passed network.
+func (rec *CaptureRecord) Message(cmmnet wire.CurrencyNet) (wire.Message, error) {
+	r := bytes.NewReader(joinMessage(cmmnet, rec.Command, rec.Payload))
+	msg, _, err := wire.ReadMessage(r, rec.ProtocolVersion, cmmnet)
+	return msg, err
+}
+
+// splitMessage splits the passed raw wire message, which may have a truncated
+// payload, into its command and payload.  It returns false when the message is
+// too short to hold a message header.
+func splitMessage(raw []byte) (string, []byte, bool) {
+	if len(raw) < wire.MessageHeaderSize {
+		return "", nil, false
+	}
+	command := bytes.TrimRight(raw[4:4+wire.CommandSize], "\x00")
+	return string(command), raw[wire.MessageHeaderSize:], true
+}
+
+// joinMessage returns the raw wire message for the passed network which
+// consists of the passed command and payload.
+func joinMessage(cmmnet wire.CurrencyNet, command string, payload []byte) []byte {
+	raw := make([]byte, wire.MessageHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(raw[0:4], uint32(cmmnet))
+	copy(raw[4:4+wire.CommandSize], command)
+	binary.LittleEndian.PutUint32(raw[16:20], uint32(len(payload)))
+	copy(raw[20:24], chainhash.HashB(payload)[:4])
+	copy(raw[wire.MessageHeaderSize:], payload)
+	return raw
+}
+
+// CaptureWriter writes message capture records to files in a directory.  A new
+// file is started once the current one would exceed the maximum file size and
+// the oldest files are removed so that no more than the maximum number of files
+// are kept.
+//
+// It is safe for concurrent access.
+type CaptureWriter struct {
+	dir         string
+	cmmnet      wire.CurrencyNet
+	maxFileSize int64
+	maxFiles    int
+
+	mtx      sync.Mutex
+	file     *os.File
+	fileSize int64
+}
+
+// NewCaptureWriter returns a capture writer which writes the messages of the
+// passed network to files in the passed directory, creating it when needed.
+// The files are rotated once they reach the passed maximum size and no more
+// than the passed maximum number of files are kept.
+func NewCaptureWriter(dir string, cmmnet wire.CurrencyNet, maxFileSize int64, maxFiles int) (*CaptureWriter, error) {
+	if maxFileSize <= 0 || maxFiles <= 0 {
+		return nil, errors.New("the maximum file size and number of " +
+			"capture files must be positive")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &CaptureWriter{
+		dir:         dir,
+		cmmnet:      cmmnet,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+	}, nil
+}
+
+// rotate closes the current capture file, if any, starts a new one and removes
+// the oldest capture files beyond the maximum number of files.
+//
+// This function MUST be called with the mutex held.
+func (w *CaptureWriter) rotate(now time.Time) error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+
+	name := captureFilePrefix + now.UTC().Format("20060102-150405.000000000") +
+		captureFileSuffix
+	f, err := os.OpenFile(filepath.Join(w.dir, name),
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	var hdr [captureHeaderSize]byte
+	copy(hdr[:4], captureMagic[:])
+	binary.LittleEndian.PutUint32(hdr[4:8], captureVersion)
+	binary.LittleEndian.PutUint32(hdr[8:12], uint32(w.cmmnet))
+	if _, err := f.Write(hdr[:]); err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.fileSize = int64(len(hdr))
+
+	// Remove the oldest capture files.  The names sort by creation time.
+	infos, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), captureFilePrefix) &&
+			strings.HasSuffix(info.Name(), captureFileSuffix) {
+
+			names = append(names, info.Name())
+		}
+	}
+	for len(names) > w.maxFiles {
+		if err := os.Remove(filepath.Join(w.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// WriteRecord writes the passed record to the current capture file.
+func (w *CaptureWriter) WriteRecord(rec *CaptureRecord) error {
+	var buf bytes.Buffer
+	var hdr [9]byte
+	binary.LittleEndian.PutUint64(hdr[:8], uint64(rec.Timestamp.UnixNano()))
+	hdr[8] = uint8(rec.Direction)
+	buf.Write(hdr[:])
+	if err := wire.WriteVarString(&buf, 0, rec.Addr); err != nil {
+		return err
+	}
+	var pver [4]byte
+	binary.LittleEndian.PutUint32(pver[:], rec.ProtocolVersion)
+	buf.Write(pver[:])
+	if err := wire.WriteVarString(&buf, 0, rec.Command); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(&buf, 0, rec.Payload); err != nil {
+		return err
+	}
+
+	// Start a new file when the record does not fit into the current one
+	// unless it is still empty.
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.file == nil || (w.fileSize > captureHeaderSize &&
+		w.fileSize+int64(buf.Len()) > w.maxFileSize) {
+
+		if err := w.rotate(rec.Timestamp); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(buf.Bytes())
+	w.fileSize += int64(n)
+	return err
+}
+
+// Close closes the current capture file.
+func (w *CaptureWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// CaptureReader reads the records of a message capture file.
+type CaptureReader struct {
+	r      io.Reader
+	cmmnet wire.CurrencyNet
+}
+
+// NewCaptureReader returns a capture reader which reads the records from the
+// passed reader after reading the header of the capture file from it.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	var hdr [captureHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("unable to read capture file header: %v",
+			err)
+	}
+	if !bytes.Equal(hdr[:4], captureMagic[:]) {
+		return nil, errors.New("not a message capture file")
+	}
+	if version := binary.LittleEndian.Uint32(hdr[4:8]); version != captureVersion {
+		return nil, fmt.Errorf("unsupported capture file version %d",
+			version)
+	}
+	return &CaptureReader{
+		r:      r,
+		cmmnet: wire.CurrencyNet(binary.LittleEndian.Uint32(hdr[8:12])),
+	}, nil
+}
+
+// Net returns the network of the captured messages.
+func (r *CaptureReader) Net() wire.CurrencyNet {
+	return r.cmmnet
+}
+
+// ReadRecord reads the next record.  It returns io.EOF when there are no more
+// records.
+func (r *CaptureReader) ReadRecord() (*CaptureRecord, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	addr, err := wire.ReadVarString(r.r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var pver [4]byte
+	if _, err := io.ReadFull(r.r, pver[:]); err != nil {
+		return nil, err
+	}
+	rec := &CaptureRecord{
+		Timestamp:       time.Unix(0, int64(binary.LittleEndian.Uint64(hdr[:8]))),
+		Direction:       CaptureDirection(hdr[8]),
+		Addr:            addr,
+		ProtocolVersion: binary.LittleEndian.Uint32(pver[:]),
+	}
+	rec.Command, err = wire.ReadVarString(r.r, 0)
+	if err != nil {
+		return nil, err
+	}
+	rec.Payload, err = wire.ReadVarBytes(r.r, 0, wire.MaxMessagePayload,
+		"payload")
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// replayConn is one end of an in-memory connection which reports the address
+// of the captured peer as the remote address.
+type replayConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+// RemoteAddr returns the address of the captured peer.
+func (c *replayConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// ReplayCapture replays the raw messages which were received from a peer in the
+// passed capture records into the passed peer over an in-memory connection, as
+// if they were sent by the remote end.  The peer must be an inbound peer which
+// is not associated with a connection yet.  The messages sent by the peer are
+// passed to the onSent callback, when it is not nil, from a separate goroutine.
+//
+// It returns once all of the received messages have been read by the peer.  The
+// caller is responsible for disconnecting the peer afterwards.
+func ReplayCapture(p *Peer, records []*CaptureRecord, cmmnet wire.CurrencyNet, onSent func(msg wire.Message)) error {
+	if !p.Inbound() {
+		return errors.New("messages can only be replayed into inbound " +
+			"peers")
+	}
+
+	// Report the address of the captured peer as the remote address when
+	// possible so the peer behaves as it did when the messages were
+	// captured.
+	var remoteAddr net.Addr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	if len(records) > 0 {
+		if addr, err := net.ResolveTCPAddr("tcp", records[0].Addr); err == nil {
+			remoteAddr = addr
+		}
+	}
+
+	local, remote := net.Pipe()
+	go func() {
+		for {
+			_, msg, _, err := wire.ReadMessageN(remote,
+				p.ProtocolVersion(), cmmnet)
+			if _, ok := err.(*wire.MessageError); ok {
+				log.Debugf("Unable to decode message sent by "+
+					"%s: %v", p, err)
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if onSent != nil {
+				onSent(msg)
+			}
+		}
+	}()
+	p.AssociateConnection(&replayConn{Conn: local, remoteAddr: remoteAddr})
+
+	for _, rec := range records {
+		if rec.Direction != CaptureRecv {
+			continue
+		}
+		_, err := remote.Write(joinMessage(cmmnet, rec.Command,
+			rec.Payload))
+		if err != nil {
+			return fmt.Errorf("unable to replay %s message from %v: %v",
+				rec.Command, rec.Timestamp, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/peer"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// rawPayload returns the payload of the passed message encoded with the latest
+// protocol version.
+func rawPayload(t *testing.T, msg wire.Message) []byte {
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, wire.ProtocolVersion); err != nil {
+		t.Fatalf("unable to encode %s message: %v", msg.Command(), err)
+	}
+	return buf.Bytes()
+}
+
+// TestCaptureWriter ensures captured messages are written to rotating files
+// which decode to the same records, including messages which do not decode,
+// and that old files are removed.
+func TestCaptureWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const numRecords, maxFiles = 20, 2
+	w, err := peer.NewCaptureWriter(dir, wire.MainNet, 256, maxFiles)
+	if err != nil {
+		t.Fatalf("NewCaptureWriter: unexpected error: %v", err)
+	}
+	start := time.Unix(1500000000, 0)
+	var records []*peer.CaptureRecord
+	for i := 0; i < numRecords; i++ {
+		rec := &peer.CaptureRecord{
+			Timestamp:       start.Add(time.Duration(i) * time.Millisecond),
+			Direction:       peer.CaptureDirection(i % 2),
+			Addr:            "10.0.0.1:9108",
+			ProtocolVersion: wire.ProtocolVersion,
+			Command:         wire.CmdPing,
+			Payload:         rawPayload(t, wire.NewMsgPing(uint64(i))),
+		}
+		if i == numRecords-1 {
+			// Truncated ping payload.
+			rec.Payload = rec.Payload[:3]
+		}
+		if err := w.WriteRecord(rec); err != nil {
+			t.Fatalf("WriteRecord #%d: unexpected error: %v", i, err)
+		}
+		records = append(records, rec)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("Glob: unexpected error: %v", err)
+	}
+	if len(files) != maxFiles {
+		t.Fatalf("got %d capture files, want %d", len(files), maxFiles)
+	}
+
+	// Ensure the remaining files hold the most recent records in order.
+	var got []*peer.CaptureRecord
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("Open: unexpected error: %v", err)
+		}
+		r, err := peer.NewCaptureReader(f)
+		if err != nil {
+			f.Close()
+			t.Fatalf("NewCaptureReader: unexpected error: %v", err)
+		}
+		if r.Net() != wire.MainNet {
+			t.Fatalf("Net: got %v, want %v", r.Net(), wire.MainNet)
+		}
+		for {
+			rec, err := r.ReadRecord()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				t.Fatalf("ReadRecord: unexpected error: %v", err)
+			}
+			got = append(got, rec)
+		}
+		f.Close()
+	}
+	if len(got) == 0 || len(got) == numRecords {
+		t.Fatalf("got %d records, want some old records removed",
+			len(got))
+	}
+	want := records[numRecords-len(got):]
+	for i, rec := range got {
+		if !rec.Timestamp.Equal(want[i].Timestamp) ||
+			rec.Direction != want[i].Direction ||
+			rec.Addr != want[i].Addr ||
+			rec.ProtocolVersion != want[i].ProtocolVersion ||
+			rec.Command != want[i].Command ||
+			!bytes.Equal(rec.Payload, want[i].Payload) {
+
+			t.Fatalf("record #%d: got %+v, want %+v", i, rec, want[i])
+		}
+
+		// Ensure the recorded messages decode to the original ones
+		// except for the truncated one.
+		msg, err := rec.Message(wire.MainNet)
+		if i == len(got)-1 {
+			if err == nil {
+				t.Fatalf("record #%d: truncated message decoded", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("record #%d: unable to decode message: %v", i, err)
+		}
+		wantNonce := uint64(numRecords - len(got) + i)
+		if nonce := msg.(*wire.MsgPing).Nonce; nonce != wantNonce {
+			t.Fatalf("record #%d: got nonce %d, want %d", i, nonce,
+				wantNonce)
+		}
+	}
+}
+
+// TestReplayCapture ensures the raw captured messages received from a peer are
+// replayed into an inbound peer which then responds to them, including messages
+// which fail to decode.
+func TestReplayCapture(t *testing.T) {
+	pings := make(chan *wire.MsgPing, 1)
+	malformed := make(chan []byte, 1)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
+				pings <- msg
+			},
+			OnReadRaw: func(p *peer.Peer, command string, payload []byte, err error) {
+				if command == wire.CmdPing && err != nil {
+					malformed <- payload
+				}
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+	}
+	p := peer.NewInboundPeer(peerCfg)
+
+	remote := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"), 9108, 0)
+	local := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.2"), 9108, 0)
+	newRecord := func(msg wire.Message) *peer.CaptureRecord {
+		return &peer.CaptureRecord{
+			Timestamp:       time.Now(),
+			Direction:       peer.CaptureRecv,
+			Addr:            "10.0.0.1:9108",
+			ProtocolVersion: wire.ProtocolVersion,
+			Command:         msg.Command(),
+			Payload:         rawPayload(t, msg),
+		}
+	}
+	truncated := newRecord(wire.NewMsgPing(43))
+	truncated.Payload = truncated.Payload[:3]
+	records := []*peer.CaptureRecord{
+		newRecord(wire.NewMsgVersion(remote, local, 1, 0)),
+		newRecord(wire.NewMsgVerAck()),
+		{Direction: peer.CaptureSent, Command: wire.CmdPing},
+		newRecord(wire.NewMsgPing(42)),
+		truncated,
+	}
+
+	sent := make(chan string, 50)
+	err := peer.ReplayCapture(p, records, wire.MainNet, func(msg wire.Message) {
+		sent <- msg.Command()
+	})
+	if err != nil {
+		t.Fatalf("ReplayCapture: unexpected error: %v", err)
+	}
+	defer func() {
+		p.Disconnect()
+		p.WaitForDisconnect()
+	}()
+
+	select {
+	case msg := <-pings:
+		if msg.Nonce != 42 {
+			t.Fatalf("got ping nonce %d, want 42", msg.Nonce)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("replayed ping was not received")
+	}
+	if p.NA().IP.String() != "10.0.0.1" {
+		t.Fatalf("got remote address %v, want 10.0.0.1", p.NA().IP)
+	}
+
+	// Ensure the peer responded to the replayed messages.
+	seen := make(map[string]bool)
+	for !seen[wire.CmdPong] {
+		select {
+		case cmd := <-sent:
+			seen[cmd] = true
+		case <-time.After(time.Second * 5):
+			t.Fatal("peer did not respond to the replayed ping")
+		}
+	}
+	for _, cmd := range []string{wire.CmdVersion, wire.CmdVerAck} {
+		if !seen[cmd] {
+			t.Fatalf("peer did not send %s message", cmd)
+		}
+	}
+
+	// Ensure the truncated message was replayed as captured.
+	select {
+	case payload := <-malformed:
+		if !bytes.Equal(payload, truncated.Payload) {
+			t.Fatalf("got truncated payload %x, want %x", payload,
+				truncated.Payload)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("truncated message was not replayed")
+	}
+}
@@ -29,7 +29,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.NodeCFVersion
+	MaxProtocolVersion = wire.AddrV2Version
 
 	// outputBufferSize is the number of elements the output channels use.
 	outputBufferSize = 5000
@@ -103,6 +103,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr wire message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 wire message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping wire message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -198,6 +201,29 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct wire
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 wire
+	// message.
+	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock wire
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn wire
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn wire message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
+	// OnDandelionTx is invoked when a peer receives a dandeliontx wire
+	// message.
+	OnDandelionTx func(p *Peer, msg *wire.MsgDandelionTx)
+
 	// OnRead is invoked when a peer receives a wire message.  It consists
 	// of the number of bytes read, the message, and whether or not an error
 	// in the read occurred.  Typically, callers will opt to use the
@@ -212,6 +238,23 @@ type MessageListeners struct {
 	// not an error in the write occurred.  This can be useful for
 	// circumstances such as keeping track of server-wide byte counts.
 	OnWrite func(p *Peer, bytesWritten int, msg wire.Message, err error)
+
+	// OnReadRaw is invoked when a peer receives a wire message, including
+	// messages which fail to decode.  It consists of the command and the
+	// raw payload of the message as received, and whether or not an error
+	// in the read or decode occurred.  The command is empty when it can
+	// not be determined, in which case the payload holds the entire
+	// message.  It is not invoked when no message was received at all.
+	// This can be useful for circumstances such as recording the exact
+	// messages received from a peer.
+	OnReadRaw func(p *Peer, command string, payload []byte, err error)
+
+	// OnWriteRaw is invoked when we write a wire message to a peer.  It
+	// consists of the command and the raw payload of the message as
+	// encoded, and whether or not an error in the write occurred.  It is
+	// not invoked for messages which fail to encode since nothing is
+	// written to the peer for them.
+	OnWriteRaw func(p *Peer, command string, payload []byte, err error)
 }
 
 // Config is the struct to hold configuration options useful to Peer.
@@ -260,6 +303,32 @@ type Config struct {
 	// not send inv messages for transactions.
 	DisableRelayTx bool
 
+	// V2Transport specifies whether the encrypted and authenticated v2
+	// transport is used.  Outbound peers initiate the v2 handshake, so the
+	// connection fails when the remote peer does not support it.  Inbound
+	// peers accept the v2 handshake and fall back to the v1 protocol when
+	// the remote peer sends a v1 version message instead.
+	V2Transport bool
+
+	// RequireV2Transport specifies whether inbound peers which do not
+	// support the v2 transport are rejected instead of falling back to the
+	// v1 protocol.  It has no effect unless V2Transport is also set.
+	RequireV2Transport bool
+
+	// MaxSendRate and MaxRecvRate limit the number of bytes per second
+	// which are sent to and received from the peer.  A value of 0 means
+	// the rate is not limited.
+	MaxSendRate int64
+	MaxRecvRate int64
+
+	// SendLimiter and RecvLimiter limit the rate at which bytes are sent
+	// to and received from the peer in addition to MaxSendRate and
+	// MaxRecvRate.  They are typically shared by all peers to limit their
+	// combined rate.  They may be nil in which case only the per-peer
+	// limits apply.
+	SendLimiter *RateLimiter
+	RecvLimiter *RateLimiter
+
 	// Listeners houses callback functions to be invoked on receiving peer
 	// messages.
 	Listeners MessageListeners
@@ -365,6 +434,8 @@ type StatsSnap struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+	MaxSendRate    int64
+	MaxRecvRate    int64
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -416,11 +487,19 @@ type Peer struct {
 
 	conn net.Conn
 
+	// connReader is the reader the v1 protocol messages are read from and
+	// transport is the v2 transport when it is in use.  They are set while
+	// negotiating the protocol and never modified afterwards.
+	connReader io.Reader
+	transport  *v2Transport
+
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
-	addr    string
-	cfg     Config
-	inbound bool
+	addr        string
+	cfg         Config
+	inbound     bool
+	sendLimiter *RateLimiter
+	recvLimiter *RateLimiter
 
 	flagsMtx             sync.Mutex // protects the peer flags below
 	na                   *wire.NetAddress
@@ -431,6 +510,9 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	sendCmpctPreferred   bool   // peer sent a sendcmpct message
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
+	v2Transport          bool   // connection uses the v2 transport
 	versionSent          bool
 	verAckReceived       bool
 
@@ -504,6 +586,14 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether the passed inventory is in the cache of
+// known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Exists(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -537,6 +627,8 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingNonce:  p.lastPingNonce,
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
+		MaxSendRate:    p.sendLimiter.Rate(),
+		MaxRecvRate:    p.recvLimiter.Rate(),
 	}
 
 	p.statsMtx.RUnlock()
@@ -780,6 +872,42 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// WantsCmpctBlocks returns if the peer wants new blocks to be announced with
+// cmpctblock messages instead of inventory vectors or headers.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	sendCmpctPreferred := p.sendCmpctPreferred
+	p.flagsMtx.Unlock()
+
+	return sendCmpctPreferred
+}
+
+// WantsAddrV2 returns if the peer wants addresses to be relayed with addrv2
+// messages instead of addr messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	sendAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return sendAddrV2
+}
+
+// V2Transport returns whether or not the connection to the peer uses the
+// encrypted and authenticated v2 transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2Transport() bool {
+	p.flagsMtx.Lock()
+	v2Transport := p.v2Transport
+	p.flagsMtx.Unlock()
+
+	return v2Transport
+}
+
 // localVersionMsg creates a version message that can be used to send to the
 // remote peer.
 func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
@@ -805,6 +933,13 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 		}
 	}
 
+	// The version message can only carry an IP address, so an unroutable
+	// address is also returned as their address when they are on a network
+	// such as Tor v3 or I2P.
+	if !theirNA.IsLegacy() {
+		theirNA = wire.NewNetAddressIPPort(net.IP([]byte{0, 0, 0, 0}), 0, 0)
+	}
+
 	// Create a wire.NetAddress with only the services set to use as the
 	// "addrme" in the version message.
 	//
@@ -862,38 +997,52 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 }
 
 // PushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.  This function is useful over manually sending the message via
-// QueueMessage since it automatically limits the addresses to the maximum
-// number allowed by the message and randomizes the chosen addresses when there
-// are too many.  It returns the addresses that were actually sent and no
-// message will be sent if there are no entries in the provided addresses slice.
+// addresses, or an addrv2 message when the peer asked for them with a
+// sendaddrv2 message.  This function is useful over manually sending the
+// message via QueueMessage since it automatically limits the addresses to the
+// maximum number allowed by the message, randomizes the chosen addresses when
+// there are too many, and skips addresses which can not be encoded in an addr
+// message for peers which did not ask for addrv2 messages.  It returns the
+// addresses that were actually sent and no message will be sent if there are
+// no entries left to send.
 //
 // This function is safe for concurrent access.
 func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, error) {
+	wantsAddrV2 := p.WantsAddrV2()
+	addrList := make([]*wire.NetAddress, 0, len(addresses))
+	for _, na := range addresses {
+		if wantsAddrV2 || na.IsLegacy() {
+			addrList = append(addrList, na)
+		}
+	}
 
 	// Nothing to send.
-	if len(addresses) == 0 {
+	if len(addrList) == 0 {
 		return nil, nil
 	}
 
-	msg := wire.NewMsgAddr()
-	msg.AddrList = make([]*wire.NetAddress, len(addresses))
-	copy(msg.AddrList, addresses)
-
 	// Randomize the addresses sent if there are more than the maximum allowed.
-	if len(msg.AddrList) > wire.MaxAddrPerMsg {
+	if len(addrList) > wire.MaxAddrPerMsg {
 		// Shuffle the address list.
-		for i := range msg.AddrList {
+		for i := range addrList {
 			j := rand.Intn(i + 1)
-			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+			addrList[i], addrList[j] = addrList[j], addrList[i]
 		}
 
 		// Truncate it to the maximum size.
-		msg.AddrList = msg.AddrList[:wire.MaxAddrPerMsg]
+		addrList = addrList[:wire.MaxAddrPerMsg]
 	}
 
-	p.QueueMessage(msg, nil)
-	return msg.AddrList, nil
+	if wantsAddrV2 {
+		msg := wire.NewMsgAddrV2()
+		msg.AddrList = addrList
+		p.QueueMessage(msg, nil)
+	} else {
+		msg := wire.NewMsgAddr()
+		msg.AddrList = addrList
+		p.QueueMessage(msg, nil)
+	}
+	return addrList, nil
 }
 
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
@@ -1106,8 +1255,42 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next wire message from the peer with logging.
 func (p *Peer) readMessage() (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageN(p.conn, p.ProtocolVersion(),
-		p.cfg.ChainParams.Net)
+	var n int
+	var msg wire.Message
+	var buf []byte
+	var err error
+	onReadRaw := p.cfg.Listeners.OnReadRaw
+	if p.transport != nil {
+		var contents []byte
+		n, contents, err = p.transport.readContents()
+		if err == nil {
+			msg, buf, err = wire.DecodeMessageV2(contents,
+				p.ProtocolVersion())
+			if onReadRaw != nil {
+				command, payload, splitErr := wire.SplitMessageV2(contents)
+				if splitErr != nil {
+					command, payload = "", contents
+				}
+				onReadRaw(p, command, payload, err)
+			}
+		}
+	} else {
+		// Keep a copy of the bytes read when the raw message is needed
+		// since they are not returned when the message fails to decode.
+		r := p.connReader
+		var raw *bytes.Buffer
+		if onReadRaw != nil {
+			raw = new(bytes.Buffer)
+			r = io.TeeReader(r, raw)
+		}
+		n, msg, buf, err = wire.ReadMessageN(r, p.ProtocolVersion(),
+			p.cfg.ChainParams.Net)
+		if raw != nil {
+			if command, payload, ok := splitMessage(raw.Bytes()); ok {
+				onReadRaw(p, command, payload, err)
+			}
+		}
+	}
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
@@ -1116,6 +1299,11 @@ func (p *Peer) readMessage() (wire.Message, []byte, error) {
 		return nil, nil, err
 	}
 
+	// Delay reading the next message from the peer until the bytes read
+	// fit within the receive rate limits.
+	p.recvLimiter.Wait(n, p.quit)
+	p.cfg.RecvLimiter.Wait(n, p.quit)
+
 	// Use closures to log expensive operations so they are only run when
 	// the logging level requires it.
 	log.Debugf("%v", newLogClosure(func() string {
@@ -1169,15 +1357,55 @@ func (p *Peer) writeMessage(msg wire.Message) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageN(p.conn, msg, p.ProtocolVersion(),
-		p.cfg.ChainParams.Net)
+	var n int
+	var err error
+	if p.cfg.Listeners.OnWriteRaw != nil {
+		n, err = p.writeRawMessage(msg)
+	} else if p.transport != nil {
+		n, err = p.transport.writeMessage(msg, p.ProtocolVersion())
+	} else {
+		n, err = wire.WriteMessageN(p.conn, msg, p.ProtocolVersion(),
+			p.cfg.ChainParams.Net)
+	}
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
+
+	// Delay writing the next message to the peer until the bytes written
+	// fit within the send rate limits.
+	p.sendLimiter.Wait(n, p.quit)
+	p.cfg.SendLimiter.Wait(n, p.quit)
 	return err
 }
 
+// writeRawMessage encodes the passed message and writes it to the peer while
+// notifying the OnWriteRaw listener of the raw command and payload of the
+// message.  It returns the number of bytes written.
+func (p *Peer) writeRawMessage(msg wire.Message) (int, error) {
+	if p.transport != nil {
+		contents, err := wire.EncodeMessageV2(msg, p.ProtocolVersion())
+		if err != nil {
+			return 0, err
+		}
+		n, err := p.transport.writePacket(contents, 0)
+		command, payload, _ := wire.SplitMessageV2(contents)
+		p.cfg.Listeners.OnWriteRaw(p, command, payload, err)
+		return n, err
+	}
+
+	var raw bytes.Buffer
+	err := wire.WriteMessage(&raw, msg, p.ProtocolVersion(),
+		p.cfg.ChainParams.Net)
+	if err != nil {
+		return 0, err
+	}
+	n, err := p.conn.Write(raw.Bytes())
+	command, payload, _ := splitMessage(raw.Bytes())
+	p.cfg.Listeners.OnWriteRaw(p, command, payload, err)
+	return n, err
+}
+
 // shouldHandleReadError returns whether or not the passed error, which is
 // expected to have come from reading from the remote peer in the inHandler,
 // should be logged and responded to with a reject message.
@@ -1243,6 +1471,10 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 
 	case wire.CmdGetMiningState:
 		pendingResponses[wire.CmdMiningState] = deadline
+
+	case wire.CmdGetBlockTxn:
+		// Expects a blocktxn message.
+		pendingResponses[wire.CmdBlockTxn] = deadline
 	}
 }
 
@@ -1471,6 +1703,11 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1607,6 +1844,55 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgSendCmpct:
+			// Only announce blocks with cmpctblock messages when the
+			// peer asks for a version that is understood.
+			if msg.CmpctBlockVersion == wire.CmpctBlockVersion {
+				p.flagsMtx.Lock()
+				p.sendCmpctPreferred = msg.AnnounceUsingCmpctBlock
+				p.flagsMtx.Unlock()
+			}
+
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgSendAddrV2:
+			// The sendaddrv2 message is only allowed before the
+			// verack message.
+			if p.verAckReceived {
+				log.Infof("Received 'sendaddrv2' after 'verack' from "+
+					"peer %v -- disconnecting", p)
+				break out
+			}
+			p.flagsMtx.Lock()
+			p.sendAddrV2 = true
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnSendAddrV2 != nil {
+				p.cfg.Listeners.OnSendAddrV2(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
+		case *wire.MsgDandelionTx:
+			if p.cfg.Listeners.OnDandelionTx != nil {
+				p.cfg.Listeners.OnDandelionTx(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1904,6 +2190,7 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 	}
 
 	p.conn = conn
+	p.connReader = conn
 	p.timeConnected = time.Now()
 
 	if p.inbound {
@@ -1958,6 +2245,10 @@ func (p *Peer) start() error {
 
 	negotiateErr := make(chan error, 1)
 	go func() {
+		if err := p.negotiateTransport(); err != nil {
+			negotiateErr <- err
+			return
+		}
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
 		} else {
@@ -1983,6 +2274,12 @@ func (p *Peer) start() error {
 	go p.queueHandler()
 	go p.outHandler()
 
+	// Ask for addresses to be relayed with addrv2 messages when the peer
+	// supports them.  This must be sent before our verack message.
+	if p.ProtocolVersion() >= wire.AddrV2Version {
+		p.QueueMessage(wire.NewMsgSendAddrV2(), nil)
+	}
+
 	// Send our verack message now that the IO processing machinery has started.
 	p.QueueMessage(wire.NewMsgVerAck(), nil)
 	return nil
@@ -2043,6 +2340,49 @@ func (p *Peer) writeLocalVersionMsg() error {
 	return nil
 }
 
+// negotiateTransport performs the v2 transport handshake with the remote peer
+// when the v2 transport is enabled.  Inbound peers detect remote peers which do
+// not support it by the v1 version message they start with and fall back to the
+// v1 protocol unless the v2 transport is required.
+func (p *Peer) negotiateTransport() error {
+	if !p.cfg.V2Transport {
+		return nil
+	}
+
+	cmmnet := p.cfg.ChainParams.Net
+	var prefix []byte
+	if p.inbound {
+		prefix = make([]byte, len(v1Prefix(cmmnet)))
+		if _, err := io.ReadFull(p.conn, prefix); err != nil {
+			return err
+		}
+		if bytes.Equal(prefix, v1Prefix(cmmnet)) {
+			if p.cfg.RequireV2Transport {
+				return errors.New("peer does not support the v2 " +
+					"transport")
+			}
+			log.Debugf("Peer %s does not support the v2 transport -- "+
+				"falling back to the v1 protocol", p)
+			p.connReader = io.MultiReader(bytes.NewReader(prefix),
+				p.conn)
+			return nil
+		}
+	}
+
+	transport, err := newV2Transport(p.conn, cmmnet, !p.inbound, prefix)
+	if err != nil {
+		return fmt.Errorf("v2 transport handshake failed: %v", err)
+	}
+	p.transport = transport
+
+	p.flagsMtx.Lock()
+	p.v2Transport = true
+	p.flagsMtx.Unlock()
+
+	log.Debugf("Negotiated v2 transport with %s", p)
+	return nil
+}
+
 // negotiateInboundProtocol waits to receive a version message from the peer
 // then sends our version message. If the events do not occur in that order then
 // it returns an error.
@@ -2096,6 +2436,8 @@ func newPeerBase(cfg *Config, inbound bool) *Peer {
 		cfg:             *cfg, // Copy so caller can't mutate.
 		services:        cfg.Services,
 		protocolVersion: protocolVersion,
+		sendLimiter:     NewRateLimiter(cfg.MaxSendRate),
+		recvLimiter:     NewRateLimiter(cfg.MaxRecvRate),
 	}
 	return &p
 }
@@ -321,6 +321,77 @@ func TestPeerConnection(t *testing.T) {
 	}
 }
 
+// TestPeerV2Transport tests connections between inbound and outbound peers
+// using the v2 transport as well as inbound peers falling back to the v1
+// protocol for outbound peers which do not support it.
+func TestPeerV2Transport(t *testing.T) {
+	verack := make(chan struct{}, 4)
+	newConfig := func(v2Transport bool) *peer.Config {
+		return &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			UserAgentName:    "peer",
+			UserAgentVersion: "1.0",
+			ChainParams:      &chaincfg.MainNetParams,
+			V2Transport:      v2Transport,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		inV2   bool // inbound peer supports v2
+		outV2  bool // outbound peer initiates v2
+		wantV2 bool // connection uses v2
+	}{
+		{"v2 transport", true, true, true},
+		{"v1 fallback", true, false, false},
+		{"v1 only", false, false, false},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(newConfig(test.inV2))
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(newConfig(test.outV2),
+			"10.0.0.2:8333")
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err %v",
+				test.name, err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+		for _, p := range []*peer.Peer{inPeer, outPeer} {
+			if !p.VersionKnown() {
+				t.Errorf("%s: version of %s not known", test.name, p)
+			}
+			if p.V2Transport() != test.wantV2 {
+				t.Errorf("%s: unexpected v2 transport for %s - got "+
+					"%v, want %v", test.name, p, p.V2Transport(),
+					test.wantV2)
+			}
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
+
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
@@ -333,6 +404,9 @@ func TestPeerListeners(t *testing.T) {
 			OnAddr: func(p *peer.Peer, msg *wire.MsgAddr) {
 				ok <- msg
 			},
+			OnAddrV2: func(p *peer.Peer, msg *wire.MsgAddrV2) {
+				ok <- msg
+			},
 			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
 				ok <- msg
 			},
@@ -411,6 +485,21 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				ok <- msg
+			},
+			OnCmpctBlock: func(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+				ok <- msg
+			},
+			OnGetBlockTxn: func(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+				ok <- msg
+			},
+			OnBlockTxn: func(p *peer.Peer, msg *wire.MsgBlockTxn) {
+				ok <- msg
+			},
+			OnDandelionTx: func(p *peer.Peer, msg *wire.MsgDandelionTx) {
+				ok <- msg
+			},
 		},
 		UserAgentName:    "peer",
 		UserAgentVersion: "1.0",
@@ -445,6 +534,12 @@ func TestPeerListeners(t *testing.T) {
 		}
 	}
 
+	// Ensure the outbound peer asked for addrv2 messages before its
+	// verack message.
+	if !inPeer.WantsAddrV2() {
+		t.Errorf("TestPeerListeners: sendaddrv2 not received")
+	}
+
 	tests := []struct {
 		listener string
 		msg      wire.Message
@@ -457,6 +552,10 @@ func TestPeerListeners(t *testing.T) {
 			"OnAddr",
 			wire.NewMsgAddr(),
 		},
+		{
+			"OnAddrV2",
+			wire.NewMsgAddrV2(),
+		},
 		{
 			"OnPing",
 			wire.NewMsgPing(42),
@@ -565,6 +664,26 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendCmpct",
+			wire.NewMsgSendCmpct(true, wire.CmpctBlockVersion),
+		},
+		{
+			"OnCmpctBlock",
+			wire.NewMsgCmpctBlock(&wire.BlockHeader{}, 0),
+		},
+		{
+			"OnGetBlockTxn",
+			wire.NewMsgGetBlockTxn(&chainhash.Hash{}, []uint32{1}, nil),
+		},
+		{
+			"OnBlockTxn",
+			wire.NewMsgBlockTxn(&chainhash.Hash{}),
+		},
+		{
+			"OnDandelionTx",
+			wire.NewMsgDandelionTx(wire.NewMsgTx()),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -629,7 +748,13 @@ func TestOutboundPeer(t *testing.T) {
 
 	// Should be noops as the peer could not connect.
 	p.QueueInventory(fakeInv)
+	if p.IsKnownInventory(fakeInv) {
+		t.Fatal("inventory known before it was added")
+	}
 	p.AddKnownInventory(fakeInv)
+	if !p.IsKnownInventory(fakeInv) {
+		t.Fatal("inventory not known after it was added")
+	}
 	p.QueueInventory(fakeInv)
 
 	fakeMsg := wire.NewMsgVerAck()
@@ -695,10 +820,19 @@ func TestOutboundPeer(t *testing.T) {
 		na := wire.NetAddress{}
 		addrs = append(addrs, &na)
 	}
-	if _, err := p2.PushAddrMsg(addrs); err != nil {
+	addrs = append(addrs, &wire.NetAddress{Network: wire.NetworkTorV3,
+		Addr: make([]byte, 32)})
+	sent, err := p2.PushAddrMsg(addrs)
+	if err != nil {
 		t.Errorf("PushAddrMsg: unexpected err %v\n", err)
 		return
 	}
+	// Ensure the Tor v3 address is not sent in an addr message since the
+	// peer did not ask for addrv2 messages.
+	if len(sent) != 5 {
+		t.Errorf("PushAddrMsg: sent %d addresses, want 5", len(sent))
+		return
+	}
 	if err := p2.PushGetBlocksMsg(nil, &chainhash.Hash{}); err != nil {
 		t.Errorf("PushGetBlocksMsg: unexpected err %v\n", err)
 		return
@@ -0,0 +1,87 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket which limits the rate at which bytes are sent
+// to or received from peers.  The bucket holds up to one second worth of bytes
+// so short bursts are allowed while the average rate is kept below the limit.
+// A single limiter may be shared by multiple peers to limit their combined
+// rate.
+//
+// A nil RateLimiter does not limit the rate.  It is safe for concurrent access.
+type RateLimiter struct {
+	mtx    sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64 // bytes available, negative when in debt
+	last   time.Time
+}
+
+// NewRateLimiter returns a rate limiter which limits the rate to the passed
+// number of bytes per second.  A nil limiter, which does not limit the rate, is
+// returned when the rate is not positive.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the number of bytes per second the rate is limited to, or 0 when
+// it is not limited.
+func (r *RateLimiter) Rate() int64 {
+	if r == nil {
+		return 0
+	}
+	return int64(r.rate)
+}
+
+// reserve takes the passed number of bytes from the bucket at the passed time
+// and returns how long to wait until the bucket is no longer in debt.  Bytes are
+// always taken, even when the bucket is empty, so that messages larger than the
+// bucket are still transferred at the limited rate.
+func (r *RateLimiter) reserve(n int, now time.Time) time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.tokens += elapsed.Seconds() * r.rate
+		if r.tokens > r.rate {
+			r.tokens = r.rate
+		}
+		r.last = now
+	}
+	r.tokens -= float64(n)
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
+
+// Wait accounts for the passed number of bytes and blocks until they fit
+// within the rate limit or the passed quit channel is closed.
+func (r *RateLimiter) Wait(n int, quit <-chan struct{}) {
+	if r == nil || n <= 0 {
+		return
+	}
+	wait := r.reserve(n, time.Now())
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	select {
+	case <-timer.C:
+	case <-quit:
+		timer.Stop()
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRateLimiter ensures the rate limiter allows bursts up to its rate and
+// otherwise delays bytes according to the rate.
+func TestRateLimiter(t *testing.T) {
+	// Ensure limiters without a positive rate don't limit the rate.
+	if r := NewRateLimiter(0); r != nil || r.Rate() != 0 {
+		t.Fatalf("NewRateLimiter(0): got %v, want nil limiter", r)
+	}
+	var unlimited *RateLimiter
+	unlimited.Wait(1<<30, nil)
+
+	r := NewRateLimiter(1000)
+	if r.Rate() != 1000 {
+		t.Fatalf("Rate: got %d, want 1000", r.Rate())
+	}
+	now := r.last
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		n       int
+		want    time.Duration
+	}{
+		// The bucket starts full, so a burst of up to one second worth
+		// of bytes is allowed.
+		{"burst", 0, 1000, 0},
+
+		// Bytes are taken from an empty bucket and the wait is long
+		// enough to pay off the debt at the limited rate.
+		{"empty bucket", 0, 500, 500 * time.Millisecond},
+
+		// The debt is paid off as time passes.
+		{"debt paid", 500 * time.Millisecond, 250, 250 * time.Millisecond},
+
+		// The bucket does not fill beyond one second worth of bytes.
+		{"capped", 10 * time.Second, 1500, 500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		now = now.Add(test.elapsed)
+		if wait := r.reserve(test.n, now); wait != test.want {
+			t.Fatalf("%s: got wait %v, want %v", test.name, wait,
+				test.want)
+		}
+	}
+
+	// Ensure waiting stops when the quit channel is closed.
+	quit := make(chan struct{})
+	close(quit)
+	done := make(chan struct{})
+	go func() {
+		r.Wait(1<<20, quit)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return when the quit channel was closed")
+	}
+}
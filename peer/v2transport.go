@@ -0,0 +1,388 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/CommerciumBlockchain/cmmd/cmmec/secp256k1"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// v2PubKeySize is the size of the ephemeral public keys exchanged
+	// during the v2 transport handshake.  Only the x coordinate is sent
+	// since it is all that is needed to derive the shared secret.
+	v2PubKeySize = 32
+
+	// v2LengthSize is the size of the encrypted length field which
+	// precedes every v2 transport packet.
+	v2LengthSize = 3
+
+	// v2HeaderSize is the size of the header which precedes the contents
+	// of every v2 transport packet.
+	v2HeaderSize = 1
+
+	// v2IgnoreFlag is set in the header of v2 transport packets which must
+	// be ignored by the receiver.  It allows decoy traffic to be sent.
+	v2IgnoreFlag = 1 << 7
+
+	// v2RekeyInterval is the number of packets after which the keys used
+	// to encrypt them are replaced by keys derived from the previous ones
+	// which provides forward secrecy.
+	v2RekeyInterval = 224
+
+	// v2MaxContentsSize is the maximum size of the contents of a v2
+	// transport packet, which is the largest length the length field is
+	// able to hold.  Messages with larger payloads can't be sent over the
+	// v2 transport.
+	v2MaxContentsSize = 1<<(8*v2LengthSize) - 1
+
+	// v2MaxVersionSize is the maximum size of the contents of the version
+	// packet sent during the v2 transport handshake.  Limiting it allows
+	// peers which derived different keys to be detected right away since
+	// the length of the packet decrypts to a random value.
+	v2MaxVersionSize = 4096
+
+	// v2KeySalt is the salt used along with the network to derive the
+	// session keys from the shared secret.
+	v2KeySalt = "cmmd_v2_shared_secret"
+)
+
+// v1Prefix returns the first bytes sent by peers using the v1 protocol, which
+// are the network magic followed by the version command, for the passed
+// network.  It allows inbound peers to detect peers that do not support the v2
+// transport.
+func v1Prefix(net wire.CurrencyNet) []byte {
+	var prefix [4 + wire.CommandSize]byte
+	binary.LittleEndian.PutUint32(prefix[:], uint32(net))
+	copy(prefix[4:], wire.CmdVersion)
+	return prefix[:]
+}
+
+// fsChaCha20 is a ChaCha20 stream cipher which replaces its key with one taken
+// from its own key stream every v2RekeyInterval chunks.  It is used to encrypt
+// the length of v2 transport packets.
+type fsChaCha20 struct {
+	cipher       *chacha20.Cipher
+	chunkCounter uint32
+	rekeyCounter uint64
+}
+
+// newFSChaCha20 returns a new forward secure ChaCha20 stream cipher with the
+// passed 32-byte key.
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	c := &fsChaCha20{}
+	c.rekey(key)
+	return c
+}
+
+// rekey replaces the key of the stream cipher.
+func (c *fsChaCha20) rekey(key []byte) {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+	// The key and nonce sizes are always valid, so the error is impossible.
+	c.cipher, _ = chacha20.NewUnauthenticatedCipher(key, nonce[:])
+}
+
+// crypt encrypts or decrypts the passed chunk in place.
+func (c *fsChaCha20) crypt(chunk []byte) {
+	c.cipher.XORKeyStream(chunk, chunk)
+	c.chunkCounter++
+	if c.chunkCounter == v2RekeyInterval {
+		var key [chacha20.KeySize]byte
+		c.cipher.XORKeyStream(key[:], key[:])
+		c.chunkCounter = 0
+		c.rekeyCounter++
+		c.rekey(key[:])
+	}
+}
+
+// fsChaCha20Poly1305 is a ChaCha20-Poly1305 authenticated cipher which
+// replaces its key with one derived from the previous key every
+// v2RekeyInterval packets.  It is used to encrypt the header and contents of v2
+// transport packets.
+type fsChaCha20Poly1305 struct {
+	aead          cipher.AEAD
+	packetCounter uint32
+	rekeyCounter  uint64
+}
+
+// newFSChaCha20Poly1305 returns a new forward secure ChaCha20-Poly1305
+// authenticated cipher with the passed 32-byte key.
+func newFSChaCha20Poly1305(key []byte) *fsChaCha20Poly1305 {
+	// The key size is always valid, so the error is impossible.
+	aead, _ := chacha20poly1305.New(key)
+	return &fsChaCha20Poly1305{aead: aead}
+}
+
+// nonce returns the nonce for the passed packet counter.
+func (c *fsChaCha20Poly1305) nonce(packetCounter uint32) []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint32(nonce[:], packetCounter)
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+	return nonce[:]
+}
+
+// next advances the cipher to the next packet and replaces the key once
+// v2RekeyInterval packets have been processed with it.
+func (c *fsChaCha20Poly1305) next() {
+	c.packetCounter++
+	if c.packetCounter == v2RekeyInterval {
+		var zeros [chacha20poly1305.KeySize]byte
+		key := c.aead.Seal(nil, c.nonce(0xffffffff), zeros[:], nil)
+		c.aead, _ = chacha20poly1305.New(key[:chacha20poly1305.KeySize])
+		c.packetCounter = 0
+		c.rekeyCounter++
+	}
+}
+
+// seal encrypts and authenticates the passed plaintext and appends the result
+// to dst.
+func (c *fsChaCha20Poly1305) seal(dst, plaintext []byte) []byte {
+	sealed := c.aead.Seal(dst, c.nonce(c.packetCounter), plaintext, nil)
+	c.next()
+	return sealed
+}
+
+// open authenticates and decrypts the passed ciphertext in place.
+func (c *fsChaCha20Poly1305) open(ciphertext []byte) ([]byte, error) {
+	plaintext, err := c.aead.Open(ciphertext[:0], c.nonce(c.packetCounter),
+		ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.next()
+	return plaintext, nil
+}
+
+// v2Transport houses the state of an encrypted and authenticated v2 transport
+// connection with a remote peer.  Every message is sent as a packet consisting
+// of its encrypted length followed by the encrypted and authenticated header
+// and contents.  Separate keys are used for each direction.
+type v2Transport struct {
+	rw io.ReadWriter
+
+	sendLength *fsChaCha20
+	sendPacket *fsChaCha20Poly1305
+	recvLength *fsChaCha20
+	recvPacket *fsChaCha20Poly1305
+
+	// sessionID uniquely identifies the session and is the same for both
+	// sides of the connection.
+	sessionID [32]byte
+}
+
+// newV2Transport performs the v2 transport handshake over the passed
+// connection and returns the resulting transport.  The handshake consists of
+// both sides sending an ephemeral public key, deriving the session keys from
+// the resulting shared secret along with the network, and then sending an
+// empty version packet which proves the other side derived the same keys.  The
+// responder only sends its public key and version packet after receiving those
+// of the initiator.
+//
+// The prefix contains any bytes of the public key of the remote peer which were
+// already read from the connection, such as those used to detect peers which
+// do not support the v2 transport.
+func newV2Transport(rw io.ReadWriter, net wire.CurrencyNet, initiator bool, prefix []byte) (*v2Transport, error) {
+	// Generate an ephemeral key.  The initiator avoids keys that could be
+	// mistaken for the start of a v1 version message.
+	var privKey *secp256k1.PrivateKey
+	var ourPubKey []byte
+	for {
+		var err error
+		privKey, err = secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		pubKey := secp256k1.NewPublicKey(privKey.Public())
+		ourPubKey = pubKey.SerializeCompressed()[1:]
+		if !initiator || !bytes.HasPrefix(ourPubKey, v1Prefix(net)) {
+			break
+		}
+	}
+
+	// Exchange the public keys.
+	theirPubKey := make([]byte, v2PubKeySize)
+	readPubKey := func() error {
+		n := copy(theirPubKey, prefix)
+		_, err := io.ReadFull(rw, theirPubKey[n:])
+		return err
+	}
+	if !initiator {
+		if err := readPubKey(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := rw.Write(ourPubKey); err != nil {
+		return nil, err
+	}
+	if initiator {
+		if err := readPubKey(); err != nil {
+			return nil, err
+		}
+	}
+	pubKey, err := secp256k1.ParsePubKey(append([]byte{0x02},
+		theirPubKey...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid v2 transport public key: %v", err)
+	}
+
+	// Derive the session keys from the shared secret along with both
+	// public keys and the network.
+	var secret [32]byte
+	sharedX := secp256k1.GenerateSharedSecret(privKey, pubKey)
+	copy(secret[len(secret)-len(sharedX):], sharedX)
+	initiatorPubKey, responderPubKey := ourPubKey, theirPubKey
+	if !initiator {
+		initiatorPubKey, responderPubKey = theirPubKey, ourPubKey
+	}
+	ikm := make([]byte, 0, len(secret)+2*v2PubKeySize)
+	ikm = append(ikm, secret[:]...)
+	ikm = append(ikm, initiatorPubKey...)
+	ikm = append(ikm, responderPubKey...)
+	salt := append([]byte(v2KeySalt), v1Prefix(net)[:4]...)
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	deriveKey := func(label string) []byte {
+		key := make([]byte, 32)
+		// Reading far less than the maximum output of HKDF can't fail.
+		io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(label)), key)
+		return key
+	}
+	t := &v2Transport{rw: rw}
+	sendLabel, recvLabel := "initiator", "responder"
+	if !initiator {
+		sendLabel, recvLabel = recvLabel, sendLabel
+	}
+	t.sendLength = newFSChaCha20(deriveKey(sendLabel + "_L"))
+	t.sendPacket = newFSChaCha20Poly1305(deriveKey(sendLabel + "_P"))
+	t.recvLength = newFSChaCha20(deriveKey(recvLabel + "_L"))
+	t.recvPacket = newFSChaCha20Poly1305(deriveKey(recvLabel + "_P"))
+	copy(t.sessionID[:], deriveKey("session_id"))
+
+	// Exchange the version packets.  Their contents are reserved for
+	// future extensions and are currently ignored.
+	if initiator {
+		if _, err := t.writePacket(nil, 0); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, _, err := t.readPacket(v2MaxVersionSize); err != nil {
+		return nil, err
+	}
+	if !initiator {
+		if _, err := t.writePacket(nil, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// writePacket encrypts the passed contents along with a header containing the
+// passed flags and writes the resulting packet.  It returns the number of bytes
+// written.
+func (t *v2Transport) writePacket(contents []byte, flags byte) (int, error) {
+	if len(contents) > v2MaxContentsSize {
+		str := fmt.Sprintf("v2 transport packet contents of %d bytes "+
+			"exceed the maximum of %d bytes", len(contents),
+			v2MaxContentsSize)
+		return 0, errors.New(str)
+	}
+
+	packet := make([]byte, v2LengthSize, v2LengthSize+v2HeaderSize+
+		len(contents)+chacha20poly1305.Overhead)
+	length := uint32(len(contents))
+	packet[0] = byte(length)
+	packet[1] = byte(length >> 8)
+	packet[2] = byte(length >> 16)
+	t.sendLength.crypt(packet)
+
+	plaintext := make([]byte, 0, v2HeaderSize+len(contents))
+	plaintext = append(plaintext, flags)
+	plaintext = append(plaintext, contents...)
+	packet = t.sendPacket.seal(packet, plaintext)
+	return t.rw.Write(packet)
+}
+
+// readPacket reads the next packet, which may have contents of up to the passed
+// maximum size, and returns its decrypted contents and header flags along with
+// the number of bytes read.
+func (t *v2Transport) readPacket(maxSize uint32) (int, []byte, byte, error) {
+	var lengthField [v2LengthSize]byte
+	n, err := io.ReadFull(t.rw, lengthField[:])
+	if err != nil {
+		return n, nil, 0, err
+	}
+	t.recvLength.crypt(lengthField[:])
+	length := uint32(lengthField[0]) | uint32(lengthField[1])<<8 |
+		uint32(lengthField[2])<<16
+	if length > maxSize {
+		str := fmt.Sprintf("v2 transport packet contents of %d bytes "+
+			"exceed the maximum of %d bytes", length, maxSize)
+		return n, nil, 0, errors.New(str)
+	}
+
+	packet := make([]byte, v2HeaderSize+length+chacha20poly1305.Overhead)
+	read, err := io.ReadFull(t.rw, packet)
+	n += read
+	if err != nil {
+		return n, nil, 0, err
+	}
+	plaintext, err := t.recvPacket.open(packet)
+	if err != nil {
+		return n, nil, 0, errors.New("v2 transport packet failed " +
+			"authentication")
+	}
+	return n, plaintext[v2HeaderSize:], plaintext[0], nil
+}
+
+// writeMessage encodes the passed message and writes it as a packet.  It
+// returns the number of bytes written.
+func (t *v2Transport) writeMessage(msg wire.Message, pver uint32) (int, error) {
+	contents, err := wire.EncodeMessageV2(msg, pver)
+	if err != nil {
+		return 0, err
+	}
+	return t.writePacket(contents, 0)
+}
+
+// readContents reads the next packet which is not flagged to be ignored and
+// returns the number of bytes read along with the contents of the packet.
+func (t *v2Transport) readContents() (int, []byte, error) {
+	var totalBytes int
+	for {
+		n, contents, flags, err := t.readPacket(v2MaxContentsSize)
+		totalBytes += n
+		if err != nil {
+			return totalBytes, nil, err
+		}
+		if flags&v2IgnoreFlag != 0 {
+			continue
+		}
+		return totalBytes, contents, nil
+	}
+}
+
+// readMessage reads the next packet which is not flagged to be ignored and
+// decodes it into a message.  It returns the number of bytes read along with
+// the message and its raw payload.
+func (t *v2Transport) readMessage(pver uint32) (int, wire.Message, []byte, error) {
+	n, contents, err := t.readContents()
+	if err != nil {
+		return n, nil, nil, err
+	}
+	msg, payload, err := wire.DecodeMessageV2(contents, pver)
+	return n, msg, payload, err
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// newV2TransportPair performs the v2 transport handshake over an in-memory
+// connection between an initiator and a responder using the passed networks
+// and returns the resulting transports along with the underlying connections.
+func newV2TransportPair(initNet, respNet wire.CurrencyNet) (*v2Transport, *v2Transport, net.Conn, net.Conn, error) {
+	initConn, respConn := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	initConn.SetDeadline(deadline)
+	respConn.SetDeadline(deadline)
+	type result struct {
+		transport *v2Transport
+		err       error
+	}
+	respResult := make(chan result, 1)
+	go func() {
+		t, err := newV2Transport(respConn, respNet, false, nil)
+		if err != nil {
+			respConn.Close()
+		}
+		respResult <- result{t, err}
+	}()
+	initTransport, err := newV2Transport(initConn, initNet, true, nil)
+	if err != nil {
+		initConn.Close()
+	}
+	resp := <-respResult
+	if err == nil {
+		err = resp.err
+	}
+	return initTransport, resp.transport, initConn, respConn, err
+}
+
+// TestV2Transport ensures messages sent over the v2 transport are received
+// intact in both directions, including after the keys have been replaced, and
+// that packets flagged to be ignored are skipped.
+func TestV2Transport(t *testing.T) {
+	initiator, responder, initConn, respConn, err :=
+		newV2TransportPair(wire.MainNet, wire.MainNet)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	defer initConn.Close()
+	defer respConn.Close()
+	if initiator.sessionID != responder.sessionID {
+		t.Fatalf("mismatched session IDs %x and %x", initiator.sessionID,
+			responder.sessionID)
+	}
+
+	// sendMessages sends the passed number of ping messages along with a
+	// packet which must be ignored from the passed transport and ensures
+	// they are received by the other transport.
+	pver := MaxProtocolVersion
+	sendMessages := func(from, to *v2Transport, numMsgs int) {
+		t.Helper()
+		errChan := make(chan error, 1)
+		go func() {
+			if _, err := from.writePacket([]byte{0x01}, v2IgnoreFlag); err != nil {
+				errChan <- err
+				return
+			}
+			for i := 0; i < numMsgs; i++ {
+				msg := wire.NewMsgPing(uint64(i))
+				if _, err := from.writeMessage(msg, pver); err != nil {
+					errChan <- err
+					return
+				}
+			}
+			errChan <- nil
+		}()
+		for i := 0; i < numMsgs; i++ {
+			_, msg, _, err := to.readMessage(pver)
+			if err != nil {
+				t.Fatalf("readMessage #%d: unexpected error: %v", i,
+					err)
+			}
+			want := wire.NewMsgPing(uint64(i))
+			if !reflect.DeepEqual(msg, want) {
+				t.Fatalf("readMessage #%d: got %v, want %v", i, msg,
+					want)
+			}
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("writeMessage: unexpected error: %v", err)
+		}
+	}
+
+	// Send enough messages in both directions to ensure the keys are
+	// replaced multiple times.
+	sendMessages(initiator, responder, v2RekeyInterval*2+10)
+	sendMessages(responder, initiator, v2RekeyInterval*2+10)
+	if initiator.sendPacket.rekeyCounter != 2 ||
+		initiator.recvLength.rekeyCounter != 2 {
+
+		t.Fatalf("keys were not replaced")
+	}
+}
+
+// TestV2TransportErrors ensures the v2 transport handshake fails when the peers
+// are on different networks and that tampered packets are rejected.
+func TestV2TransportErrors(t *testing.T) {
+	_, _, _, _, err := newV2TransportPair(wire.MainNet, wire.TestNet)
+	if err == nil {
+		t.Fatal("handshake between different networks succeeded")
+	}
+
+	initiator, responder, initConn, respConn, err :=
+		newV2TransportPair(wire.MainNet, wire.MainNet)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	defer initConn.Close()
+	defer respConn.Close()
+
+	// Encrypt a packet and flip a bit of its contents before passing it to
+	// the responder.
+	var buf bytes.Buffer
+	initiator.rw = &buf
+	if _, err := initiator.writeMessage(wire.NewMsgPing(1), MaxProtocolVersion); err != nil {
+		t.Fatalf("writeMessage: unexpected error: %v", err)
+	}
+	packet := buf.Bytes()
+	packet[v2LengthSize+v2HeaderSize] ^= 0x01
+	responder.rw = bytes.NewBuffer(packet)
+	if _, _, _, err := responder.readMessage(MaxProtocolVersion); err == nil {
+		t.Fatal("tampered packet was accepted")
+	}
+
+	// Contents which do not fit in the length field are rejected before
+	// anything is written.
+	buf.Reset()
+	initiator.rw = &buf
+	if _, err := initiator.writePacket(make([]byte, v2MaxContentsSize+1), 0); err == nil {
+		t.Fatal("oversized packet was written")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("oversized packet wrote %d bytes", buf.Len())
+	}
+}
+
+// TestV1Prefix ensures the prefix used to detect peers which do not support the
+// v2 transport matches the start of a v1 version message.
+func TestV1Prefix(t *testing.T) {
+	var buf bytes.Buffer
+	msg := wire.NewMsgVersion(&wire.NetAddress{}, &wire.NetAddress{}, 0, 0)
+	if err := wire.WriteMessage(&buf, msg, MaxProtocolVersion, wire.MainNet); err != nil {
+		t.Fatalf("WriteMessage: unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), v1Prefix(wire.MainNet)) {
+		t.Fatalf("v1 version message %x does not start with prefix %x",
+			buf.Bytes(), v1Prefix(wire.MainNet))
+	}
+}
@@ -194,6 +194,44 @@ func (c *Client) GetBlockCount() (int64, error) {
 	return c.GetBlockCountAsync().Receive()
 }
 
+// FutureGetBlockChainInfoResult is a future promise to deliver the result of a
+// GetBlockChainInfoAsync RPC invocation (or an applicable error).
+type FutureGetBlockChainInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// information about the current state of the block chain.
+func (r FutureGetBlockChainInfoResult) Receive() (*cmmjson.GetBlockChainInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a getblockchaininfo result object.
+	var chainInfo cmmjson.GetBlockChainInfoResult
+	err = json.Unmarshal(res, &chainInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &chainInfo, nil
+}
+
+// GetBlockChainInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBlockChainInfo for the blocking version and more details.
+func (c *Client) GetBlockChainInfoAsync() FutureGetBlockChainInfoResult {
+	cmd := cmmjson.NewGetBlockChainInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetBlockChainInfo returns information about the current state of the block
+// chain such as the best block, the sync progress and the states of the
+// consensus deployments.
+func (c *Client) GetBlockChainInfo() (*cmmjson.GetBlockChainInfoResult, error) {
+	return c.GetBlockChainInfoAsync().Receive()
+}
+
 // FutureGetDifficultyResult is a future promise to deliver the result of a
 // GetDifficultyAsync RPC invocation (or an applicable error).
 type FutureGetDifficultyResult chan *response
@@ -526,6 +564,214 @@ func (c *Client) GetRawMempoolVerbose(txType cmmjson.GetRawMempoolTxTypeCmd) (ma
 	return c.GetRawMempoolVerboseAsync(txType).Receive()
 }
 
+// FutureGetMempoolEntryResult is a future promise to deliver the result of a
+// GetMempoolEntryAsync RPC invocation (or an applicable error).
+type FutureGetMempoolEntryResult chan *response
+
+// Receive waits for the response promised by the future and returns a data
+// structure with information about the transaction in the memory pool.
+func (r FutureGetMempoolEntryResult) Receive() (*cmmjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a getmempoolentry result object.
+	var entry cmmjson.GetMempoolEntryResult
+	err = json.Unmarshal(res, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetMempoolEntryAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetMempoolEntry for the blocking version and more details.
+func (c *Client) GetMempoolEntryAsync(txHash *chainhash.Hash) FutureGetMempoolEntryResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := cmmjson.NewGetMempoolEntryCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolEntry returns a data structure with information about the
+// transaction in the memory pool with the given hash, including the number,
+// size and fees of the transactions it depends on and which depend on it.
+func (c *Client) GetMempoolEntry(txHash *chainhash.Hash) (*cmmjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolEntryAsync(txHash).Receive()
+}
+
+// receiveMempoolEntries waits for the response promised by the passed future
+// and returns it as a map of transaction hashes to an associated data structure
+// with information about the transaction.
+func receiveMempoolEntries(r chan *response) (map[string]cmmjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a map of strings (tx hashes) to their
+	// detailed results.
+	var entries map[string]cmmjson.GetMempoolEntryResult
+	err = json.Unmarshal(res, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// FutureGetMempoolAncestorsResult is a future promise to deliver the result of
+// a GetMempoolAncestorsAsync RPC invocation (or an applicable error).
+type FutureGetMempoolAncestorsResult chan *response
+
+// Receive waits for the response promised by the future and returns the hashes
+// of the transactions in the memory pool the transaction depends on.
+func (r FutureGetMempoolAncestorsResult) Receive() ([]*chainhash.Hash, error) {
+	return FutureGetRawMempoolResult(r).Receive()
+}
+
+// GetMempoolAncestorsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolAncestors for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsAsync(txHash *chainhash.Hash) FutureGetMempoolAncestorsResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := cmmjson.NewGetMempoolAncestorsCmd(hash, cmmjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestors returns the hashes of the transactions in the memory pool
+// the transaction in the memory pool with the given hash depends on, either
+// directly or through other transactions in the memory pool.
+//
+// See GetMempoolAncestorsVerbose to retrieve data structures with information
+// about the transactions instead.
+func (c *Client) GetMempoolAncestors(txHash *chainhash.Hash) ([]*chainhash.Hash, error) {
+	return c.GetMempoolAncestorsAsync(txHash).Receive()
+}
+
+// FutureGetMempoolAncestorsVerboseResult is a future promise to deliver the
+// result of a GetMempoolAncestorsVerboseAsync RPC invocation (or an applicable
+// error).
+type FutureGetMempoolAncestorsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to an associated data structure with information about the
+// transaction for the transactions in the memory pool the transaction depends
+// on.
+func (r FutureGetMempoolAncestorsVerboseResult) Receive() (map[string]cmmjson.GetMempoolEntryResult, error) {
+	return receiveMempoolEntries(r)
+}
+
+// GetMempoolAncestorsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolAncestorsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsVerboseAsync(txHash *chainhash.Hash) FutureGetMempoolAncestorsVerboseResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := cmmjson.NewGetMempoolAncestorsCmd(hash, cmmjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestorsVerbose returns a map of transaction hashes to an
+// associated data structure with information about the transaction for the
+// transactions in the memory pool the transaction in the memory pool with the
+// given hash depends on.
+//
+// See GetMempoolAncestors to retrieve only the transaction hashes instead.
+func (c *Client) GetMempoolAncestorsVerbose(txHash *chainhash.Hash) (map[string]cmmjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolAncestorsVerboseAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDescendantsResult is a future promise to deliver the result
+// of a GetMempoolDescendantsAsync RPC invocation (or an applicable error).
+type FutureGetMempoolDescendantsResult chan *response
+
+// Receive waits for the response promised by the future and returns the hashes
+// of the transactions in the memory pool which depend on the transaction.
+func (r FutureGetMempoolDescendantsResult) Receive() ([]*chainhash.Hash, error) {
+	return FutureGetRawMempoolResult(r).Receive()
+}
+
+// GetMempoolDescendantsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolDescendants for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsAsync(txHash *chainhash.Hash) FutureGetMempoolDescendantsResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := cmmjson.NewGetMempoolDescendantsCmd(hash, cmmjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendants returns the hashes of the transactions in the memory
+// pool which depend on the transaction in the memory pool with the given hash,
+// either directly or through other transactions in the memory pool.
+//
+// See GetMempoolDescendantsVerbose to retrieve data structures with information
+// about the transactions instead.
+func (c *Client) GetMempoolDescendants(txHash *chainhash.Hash) ([]*chainhash.Hash, error) {
+	return c.GetMempoolDescendantsAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDescendantsVerboseResult is a future promise to deliver the
+// result of a GetMempoolDescendantsVerboseAsync RPC invocation (or an
+// applicable error).
+type FutureGetMempoolDescendantsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to an associated data structure with information about the
+// transaction for the transactions in the memory pool which depend on the
+// transaction.
+func (r FutureGetMempoolDescendantsVerboseResult) Receive() (map[string]cmmjson.GetMempoolEntryResult, error) {
+	return receiveMempoolEntries(r)
+}
+
+// GetMempoolDescendantsVerboseAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolDescendantsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsVerboseAsync(txHash *chainhash.Hash) FutureGetMempoolDescendantsVerboseResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := cmmjson.NewGetMempoolDescendantsCmd(hash, cmmjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendantsVerbose returns a map of transaction hashes to an
+// associated data structure with information about the transaction for the
+// transactions in the memory pool which depend on the transaction in the memory
+// pool with the given hash.
+//
+// See GetMempoolDescendants to retrieve only the transaction hashes instead.
+func (c *Client) GetMempoolDescendantsVerbose(txHash *chainhash.Hash) (map[string]cmmjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolDescendantsVerboseAsync(txHash).Receive()
+}
+
 // FutureVerifyChainResult is a future promise to deliver the result of a
 // VerifyChainAsync, VerifyChainLevelAsyncRPC, or VerifyChainBlocksAsync
 // invocation (or an applicable error).
@@ -664,6 +910,42 @@ func (c *Client) GetTxOut(txHash *chainhash.Hash, index uint32, mempool bool) (*
 	return c.GetTxOutAsync(txHash, index, mempool).Receive()
 }
 
+// FutureGetTxOutSetInfoResult is a future promise to deliver the result of a
+// GetTxOutSetInfoAsync RPC invocation (or an applicable error).
+type FutureGetTxOutSetInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// statistics about the unspent transaction output set.
+func (r FutureGetTxOutSetInfoResult) Receive() (*cmmjson.GetTxOutSetInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a gettxoutsetinfo result object.
+	var info cmmjson.GetTxOutSetInfoResult
+	err = json.Unmarshal(res, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetTxOutSetInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOutSetInfo for the blocking version and more details.
+func (c *Client) GetTxOutSetInfoAsync() FutureGetTxOutSetInfoResult {
+	cmd := cmmjson.NewGetTxOutSetInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutSetInfo returns statistics about the unspent transaction output set.
+func (c *Client) GetTxOutSetInfo() (*cmmjson.GetTxOutSetInfoResult, error) {
+	return c.GetTxOutSetInfoAsync().Receive()
+}
+
 // FutureRescanResult is a future promise to deliver the result of a
 // RescanAsynnc RPC invocation (or an applicable error).
 type FutureRescanResult chan *response
@@ -803,3 +1085,207 @@ func (c *Client) GetCFilterHeaderAsync(blockHash *chainhash.Hash, filterType wir
 func (c *Client) GetCFilterHeader(blockHash *chainhash.Hash, filterType wire.FilterType) (*chainhash.Hash, error) {
 	return c.GetCFilterHeaderAsync(blockHash, filterType).Receive()
 }
+
+// FutureEstimateFeeResult is a future promise to deliver the result of a
+// EstimateFeeAsync RPC invocation (or an applicable error).
+type FutureEstimateFeeResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// estimated fee per kilobyte.
+func (r FutureEstimateFeeResult) Receive() (cmmutil.Amount, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Unmarshal the result as a float64.
+	var fee float64
+	err = json.Unmarshal(res, &fee)
+	if err != nil {
+		return 0, err
+	}
+	return cmmutil.NewAmount(fee)
+}
+
+// EstimateFeeAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See EstimateFee for the blocking version and more details.
+func (c *Client) EstimateFeeAsync(numBlocks int64) FutureEstimateFeeResult {
+	cmd := cmmjson.NewEstimateFeeCmd(numBlocks)
+	return c.sendCmd(cmd)
+}
+
+// EstimateFee returns the estimated fee per kilobyte needed for a transaction
+// to be mined within numBlocks blocks.
+func (c *Client) EstimateFee(numBlocks int64) (cmmutil.Amount, error) {
+	return c.EstimateFeeAsync(numBlocks).Receive()
+}
+
+// FutureEstimateSmartFeeResult is a future promise to deliver the result of a
+// EstimateSmartFeeAsync RPC invocation (or an applicable error).
+type FutureEstimateSmartFeeResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// estimated fee rate along with the number of blocks it is valid for.
+func (r FutureEstimateSmartFeeResult) Receive() (*cmmjson.EstimateSmartFeeResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an estimatesmartfee result object.
+	var estimate cmmjson.EstimateSmartFeeResult
+	err = json.Unmarshal(res, &estimate)
+	if err != nil {
+		return nil, err
+	}
+	return &estimate, nil
+}
+
+// EstimateSmartFeeAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See EstimateSmartFee for the blocking version and more details.
+func (c *Client) EstimateSmartFeeAsync(confTarget int64, mode *cmmjson.EstimateSmartFeeMode) FutureEstimateSmartFeeResult {
+	cmd := cmmjson.NewEstimateSmartFeeCmd(confTarget, mode)
+	return c.sendCmd(cmd)
+}
+
+// EstimateSmartFee returns the estimated fee rate per kilobyte needed for a
+// transaction to be mined within confTarget blocks using the passed
+// estimation mode.  A nil mode uses the conservative mode.
+func (c *Client) EstimateSmartFee(confTarget int64, mode *cmmjson.EstimateSmartFeeMode) (*cmmjson.EstimateSmartFeeResult, error) {
+	return c.EstimateSmartFeeAsync(confTarget, mode).Receive()
+}
+
+// FutureExportUtxoSnapshotResult is a future promise to deliver the result of
+// an ExportUtxoSnapshotAsync RPC invocation (or an applicable error).
+type FutureExportUtxoSnapshotResult chan *response
+
+// Receive waits for the response promised by the future and returns
+// information about the written utxo snapshot.
+func (r FutureExportUtxoSnapshotResult) Receive() (*cmmjson.ExportUtxoSnapshotResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an exportutxosnapshot result object.
+	var snapshot cmmjson.ExportUtxoSnapshotResult
+	err = json.Unmarshal(res, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ExportUtxoSnapshotAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See ExportUtxoSnapshot for the blocking version and more details.
+func (c *Client) ExportUtxoSnapshotAsync(path string) FutureExportUtxoSnapshotResult {
+	cmd := cmmjson.NewExportUtxoSnapshotCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// ExportUtxoSnapshot requests the server to write a snapshot of its utxo set
+// as of the current best block to the passed path on the server.
+func (c *Client) ExportUtxoSnapshot(path string) (*cmmjson.ExportUtxoSnapshotResult, error) {
+	return c.ExportUtxoSnapshotAsync(path).Receive()
+}
+
+// FutureInvalidateBlockResult is a future promise to deliver the result of an
+// InvalidateBlockAsync RPC invocation (or an applicable error).
+type FutureInvalidateBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block could not be invalidated.
+func (r FutureInvalidateBlockResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// InvalidateBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See InvalidateBlock for the blocking version and more details.
+func (c *Client) InvalidateBlockAsync(blockHash *chainhash.Hash) FutureInvalidateBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := cmmjson.NewInvalidateBlockCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// InvalidateBlock marks the block with the given hash and all of its
+// descendants as invalid, reorganizing the chain away from them as needed.
+func (c *Client) InvalidateBlock(blockHash *chainhash.Hash) error {
+	return c.InvalidateBlockAsync(blockHash).Receive()
+}
+
+// FutureReconsiderBlockResult is a future promise to deliver the result of a
+// ReconsiderBlockAsync RPC invocation (or an applicable error).
+type FutureReconsiderBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block could not be reconsidered.
+func (r FutureReconsiderBlockResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// ReconsiderBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ReconsiderBlock for the blocking version and more details.
+func (c *Client) ReconsiderBlockAsync(blockHash *chainhash.Hash) FutureReconsiderBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := cmmjson.NewReconsiderBlockCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// ReconsiderBlock removes the invalid status from the block with the given
+// hash and its descendants, reorganizing the chain to them when they form the
+// best chain.
+func (c *Client) ReconsiderBlock(blockHash *chainhash.Hash) error {
+	return c.ReconsiderBlockAsync(blockHash).Receive()
+}
+
+// FutureSaveMempoolResult is a future promise to deliver the result of a
+// SaveMempoolAsync RPC invocation (or an applicable error).
+type FutureSaveMempoolResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the memory pool could not be saved.
+func (r FutureSaveMempoolResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SaveMempoolAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SaveMempool for the blocking version and more details.
+func (c *Client) SaveMempoolAsync() FutureSaveMempoolResult {
+	cmd := cmmjson.NewSaveMempoolCmd()
+	return c.sendCmd(cmd)
+}
+
+// SaveMempool writes the transactions in the memory pool of the server to its
+// data directory so they are reloaded when it restarts.
+func (c *Client) SaveMempool() error {
+	return c.SaveMempoolAsync().Receive()
+}
@@ -454,3 +454,37 @@ func (c *Client) SubmitBlockAsync(block *cmmutil.Block, options *cmmjson.SubmitB
 func (c *Client) SubmitBlock(block *cmmutil.Block, options *cmmjson.SubmitBlockOptions) error {
 	return c.SubmitBlockAsync(block, options).Receive()
 }
+
+// FuturePrioritiseTransactionResult is a future promise to deliver the result
+// of a PrioritiseTransactionAsync RPC invocation (or an applicable error).
+type FuturePrioritiseTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the deltas of the transaction could not be changed.
+func (r FuturePrioritiseTransactionResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// PrioritiseTransactionAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See PrioritiseTransaction for the blocking version and more details.
+func (c *Client) PrioritiseTransactionAsync(txHash *chainhash.Hash, priorityDelta float64, feeDelta cmmutil.Amount) FuturePrioritiseTransactionResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := cmmjson.NewPrioritiseTransactionCmd(hash, priorityDelta,
+		int64(feeDelta))
+	return c.sendCmd(cmd)
+}
+
+// PrioritiseTransaction adds the passed priority and fee deltas to those of the
+// transaction with the given hash, which changes how the server prioritizes it
+// for inclusion in block templates without changing the fee it pays.
+func (c *Client) PrioritiseTransaction(txHash *chainhash.Hash, priorityDelta float64, feeDelta cmmutil.Amount) error {
+	return c.PrioritiseTransactionAsync(txHash, priorityDelta, feeDelta).Receive()
+}
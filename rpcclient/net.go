@@ -8,6 +8,7 @@ package rpcclient
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/CommerciumBlockchain/cmmd/cmmjson"
 )
@@ -285,3 +286,121 @@ func (c *Client) GetNetTotalsAsync() FutureGetNetTotalsResult {
 func (c *Client) GetNetTotals() (*cmmjson.GetNetTotalsResult, error) {
 	return c.GetNetTotalsAsync().Receive()
 }
+
+// SetBanCommand enumerates the available commands that the SetBan function
+// accepts.
+type SetBanCommand string
+
+// Constants used to indicate the command for the SetBan function.
+const (
+	// SBAdd indicates the specified IP address or subnet should be banned.
+	SBAdd SetBanCommand = "add"
+
+	// SBRemove indicates the ban of the specified IP address or subnet
+	// should be removed.
+	SBRemove SetBanCommand = "remove"
+)
+
+// String returns the SetBanCommand in human-readable form.
+func (cmd SetBanCommand) String() string {
+	return string(cmd)
+}
+
+// FutureSetBanResult is a future promise to deliver the result of a
+// SetBanAsync RPC invocation (or an applicable error).
+type FutureSetBanResult chan *response
+
+// Receive waits for the response promised by the future and returns an error if
+// any occurred when performing the specified command.
+func (r FutureSetBanResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SetBanAsync returns an instance of a type that can be used to get the result
+// of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SetBan for the blocking version and more details.
+func (c *Client) SetBanAsync(subnet string, command SetBanCommand, until time.Time) FutureSetBanResult {
+	var banTime *int64
+	var absolute *bool
+	if !until.IsZero() {
+		banTime = cmmjson.Int64(until.Unix())
+		absolute = cmmjson.Bool(true)
+	}
+	cmd := cmmjson.NewSetBanCmd(subnet, cmmjson.SetBanSubCmd(command),
+		banTime, absolute)
+	return c.sendCmd(cmd)
+}
+
+// SetBan attempts to perform the passed command on the passed IP address or
+// subnet in CIDR notation.  For example, it can be used to ban a subnet until
+// the passed time or to remove its ban.  The server uses its configured ban
+// duration when the time is zero.
+func (c *Client) SetBan(subnet string, command SetBanCommand, until time.Time) error {
+	return c.SetBanAsync(subnet, command, until).Receive()
+}
+
+// FutureListBannedResult is a future promise to deliver the result of a
+// ListBannedAsync RPC invocation (or an applicable error).
+type FutureListBannedResult chan *response
+
+// Receive waits for the response promised by the future and returns the banned
+// IP addresses and subnets.
+func (r FutureListBannedResult) Receive() ([]cmmjson.ListBannedResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of listbanned result objects.
+	var bans []cmmjson.ListBannedResult
+	err = json.Unmarshal(res, &bans)
+	if err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// ListBannedAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ListBanned for the blocking version and more details.
+func (c *Client) ListBannedAsync() FutureListBannedResult {
+	cmd := cmmjson.NewListBannedCmd()
+	return c.sendCmd(cmd)
+}
+
+// ListBanned returns the banned IP addresses and subnets.
+func (c *Client) ListBanned() ([]cmmjson.ListBannedResult, error) {
+	return c.ListBannedAsync().Receive()
+}
+
+// FutureClearBannedResult is a future promise to deliver the result of a
+// ClearBannedAsync RPC invocation (or an applicable error).
+type FutureClearBannedResult chan *response
+
+// Receive waits for the response promised by the future and returns an error if
+// any occurred when clearing the bans.
+func (r FutureClearBannedResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// ClearBannedAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ClearBanned for the blocking version and more details.
+func (c *Client) ClearBannedAsync() FutureClearBannedResult {
+	cmd := cmmjson.NewClearBannedCmd()
+	return c.sendCmd(cmd)
+}
+
+// ClearBanned removes all IP address and subnet bans.
+func (c *Client) ClearBanned() error {
+	return c.ClearBannedAsync().Receive()
+}
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/elliptic"
 	"crypto/sha256"
@@ -42,6 +43,7 @@ import (
 	"github.com/CommerciumBlockchain/cmmd/chaincfg"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainec"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/connmgr"
 	"github.com/CommerciumBlockchain/cmmd/database"
 	"github.com/CommerciumBlockchain/cmmd/cmmjson"
 	"github.com/CommerciumBlockchain/cmmd/cmmutil"
@@ -94,6 +96,14 @@ const (
 	// RPC.
 	gbtNonceRange = "00000000ffffffff"
 
+	// gbtNonceOffset, gbtExtraDataOffset and gbtSolutionOffset are the
+	// byte offsets of the nonce, the extra data and the equihash solution
+	// within the serialized block header returned by the getblocktemplate
+	// RPC.  The solution follows the extra data and the stake version.
+	gbtNonceOffset     = 140
+	gbtExtraDataOffset = gbtNonceOffset + 4
+	gbtSolutionOffset  = gbtExtraDataOffset + 32 + 4
+
 	// gbtRegenerateSeconds is the number of seconds that must pass before
 	// a new template is generated when the previous block hash has not
 	// changed and there have been changes to the available transactions
@@ -171,6 +181,7 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":               handleAddNode,
+	"clearbanned":           handleClearBanned,
 	"createrawsstx":         handleCreateRawSStx,
 	"createrawssgentx":      handleCreateRawSSGenTx,
 	"createrawssrtx":        handleCreateRawSSRtx,
@@ -179,6 +190,7 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"decoderawtransaction":  handleDecodeRawTransaction,
 	"decodescript":          handleDecodeScript,
 	"estimatefee":           handleEstimateFee,
+	"estimatesmartfee":      handleEstimateSmartFee,
 	"estimatestakediff":     handleEstimateStakeDiff,
 	"existsaddress":         handleExistsAddress,
 	"existsaddresses":       handleExistsAddresses,
@@ -187,11 +199,13 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"existsliveticket":      handleExistsLiveTicket,
 	"existslivetickets":     handleExistsLiveTickets,
 	"existsmempooltxs":      handleExistsMempoolTxs,
+	"exportutxosnapshot":    handleExportUtxoSnapshot,
 	"generate":              handleGenerate,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
 	"getblock":              handleGetBlock,
+	"getblockchaininfo":     handleGetBlockchainInfo,
 	"getblockcount":         handleGetBlockCount,
 	"getblockhash":          handleGetBlockHash,
 	"getblockheader":        handleGetBlockHeader,
@@ -207,6 +221,9 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getcfilterheader":      handleGetCFilterHeader,
 	"getheaders":            handleGetHeaders,
 	"getinfo":               handleGetInfo,
+	"getmempoolancestors":   handleGetMempoolAncestors,
+	"getmempooldescendants": handleGetMempoolDescendants,
+	"getmempoolentry":       handleGetMempoolEntry,
 	"getmempoolinfo":        handleGetMempoolInfo,
 	"getmininginfo":         handleGetMiningInfo,
 	"getnettotals":          handleGetNetTotals,
@@ -220,16 +237,23 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getticketpoolvalue":    handleGetTicketPoolValue,
 	"getvoteinfo":           handleGetVoteInfo,
 	"gettxout":              handleGetTxOut,
+	"gettxoutsetinfo":       handleGetTxOutSetInfo,
 	"getwork":               handleGetWork,
 	"help":                  handleHelp,
+	"invalidateblock":       handleInvalidateBlock,
+	"listbanned":            handleListBanned,
 	"livetickets":           handleLiveTickets,
 	"missedtickets":         handleMissedTickets,
 	"node":                  handleNode,
 	"ping":                  handlePing,
+	"prioritisetransaction": handlePrioritiseTransaction,
 	"searchrawtransactions": handleSearchRawTransactions,
 	"rebroadcastmissed":     handleRebroadcastMissed,
 	"rebroadcastwinners":    handleRebroadcastWinners,
+	"reconsiderblock":       handleReconsiderBlock,
+	"savemempool":           handleSaveMempool,
 	"sendrawtransaction":    handleSendRawTransaction,
+	"setban":                handleSetBan,
 	"setgenerate":           handleSetGenerate,
 	"stop":                  handleStop,
 	"submitblock":           handleSubmitBlock,
@@ -265,7 +289,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getstakeinfo":            {},
 	"getvotechoices":          {},
 	"gettransaction":          {},
-	"gettxoutsetinfo":         {},
 	"getunconfirmedbalance":   {},
 	"importprivkey":           {},
 	"keypoolrefill":           {},
@@ -297,11 +320,8 @@ var rpcAskWallet = map[string]struct{}{
 
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
-	"estimatefee":       {},
-	"estimatepriority":  {},
-	"getblocktemplate":  {},
-	"getblockchaininfo": {},
-	"getnetworkinfo":    {},
+	"estimatepriority": {},
+	"getnetworkinfo":   {},
 }
 
 // Commands that are available to a limited user
@@ -324,12 +344,16 @@ var rpcLimited = map[string]struct{}{
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
+	"getblockchaininfo":     {},
 	"getblockcount":         {},
 	"getblockhash":          {},
 	"getchaintips":          {},
 	"getcurrentnet":         {},
 	"getdifficulty":         {},
 	"getinfo":               {},
+	"getmempoolancestors":   {},
+	"getmempooldescendants": {},
+	"getmempoolentry":       {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
@@ -424,6 +448,14 @@ func rpcNoTxInfoError(txHash *chainhash.Hash) *cmmjson.RPCError {
 			txHash))
 }
 
+// rpcBlockPrunedError is a convenience function for returning a nicely
+// formatted RPC error which indicates the data for the provided main chain block
+// is no longer available because it has been pruned.
+func rpcBlockPrunedError(hash *chainhash.Hash) *cmmjson.RPCError {
+	return cmmjson.NewRPCError(cmmjson.ErrRPCMisc,
+		fmt.Sprintf("Block not available (pruned data): %v", hash))
+}
+
 // rpcMiscError is a convenience function for returning a nicely formatted RPC
 // error which indicates there is a unquantifiable error.  Use this sparingly;
 // misc return codes are a cop out.
@@ -462,6 +494,7 @@ type gbtWorkState struct {
 	lastTxUpdate  time.Time
 	lastGenerated time.Time
 	prevHash      *chainhash.Hash
+	numVotes      int
 	minTimestamp  time.Time
 	template      *BlockTemplate
 	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
@@ -618,6 +651,14 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleClearBanned handles clearbanned commands.
+func handleClearBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.server.banList.Clear(); err != nil {
+		return nil, rpcInternalError(err.Error(), "Could not save ban list")
+	}
+	return nil, nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*cmmjson.CreateRawTransactionCmd)
@@ -1478,11 +1519,71 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
-// handleEstimateFee implenents the estimatefee command.
-// TODO this is a very basic implementation.  It should be
-// modified to match the bitcoin-core one.
+// handleEstimateFee implements the estimatefee command.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return cfg.minRelayTxFee.ToCoin(), nil
+	c := cmd.(*cmmjson.EstimateFeeCmd)
+
+	if c.NumBlocks <= 0 {
+		return nil, rpcInvalidError("Parameter NumBlocks must be "+
+			"positive: %d", c.NumBlocks)
+	}
+	numBlocks := c.NumBlocks
+	if numBlocks > mempool.DefaultEstimateFeeMaxConfirms {
+		numBlocks = mempool.DefaultEstimateFeeMaxConfirms
+	}
+
+	// Fall back to the minimum relay fee when there is not enough data to
+	// provide an estimate, and never suggest a fee which would not be
+	// relayed.
+	feeRate, err := s.server.feeEstimator.EstimateFee(int(numBlocks),
+		mempool.EstimateModeConservative)
+	if err != nil || feeRate < cfg.minRelayTxFee {
+		feeRate = cfg.minRelayTxFee
+	}
+	return feeRate.ToCoin(), nil
+}
+
+// handleEstimateSmartFee implements the estimatesmartfee command.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.EstimateSmartFeeCmd)
+
+	if c.ConfTarget <= 0 {
+		return nil, rpcInvalidError("Parameter ConfTarget must be "+
+			"positive: %d", c.ConfTarget)
+	}
+
+	mode := mempool.EstimateModeConservative
+	if c.EstimateMode != nil {
+		switch *c.EstimateMode {
+		case cmmjson.EstimateModeConservative:
+		case cmmjson.EstimateModeEconomical:
+			mode = mempool.EstimateModeEconomical
+		default:
+			return nil, rpcInvalidError("Invalid estimate mode: %q",
+				*c.EstimateMode)
+		}
+	}
+
+	confTarget := c.ConfTarget
+	if confTarget > mempool.DefaultEstimateFeeMaxConfirms {
+		confTarget = mempool.DefaultEstimateFeeMaxConfirms
+	}
+	feeRate, blocks, err := s.server.feeEstimator.EstimateSmartFee(
+		int(confTarget), mode)
+	if err != nil {
+		return &cmmjson.EstimateSmartFeeResult{
+			Errors: []string{err.Error()},
+			Blocks: 0,
+		}, nil
+	}
+	if feeRate < cfg.minRelayTxFee {
+		feeRate = cfg.minRelayTxFee
+	}
+	feeRateCoin := feeRate.ToCoin()
+	return &cmmjson.EstimateSmartFeeResult{
+		FeeRate: &feeRateCoin,
+		Blocks:  int64(blocks),
+	}, nil
 }
 
 // handleEstimateStakeDiff implements the estimatestakediff command.
@@ -1749,6 +1850,57 @@ func handleExistsMempoolTxs(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hex.EncodeToString([]byte(set)), nil
 }
 
+// handleExportUtxoSnapshot implements the exportutxosnapshot command.
+func handleExportUtxoSnapshot(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.ExportUtxoSnapshotCmd)
+
+	if c.Path == "" {
+		return nil, rpcInvalidError("A snapshot path must be provided")
+	}
+
+	// Refuse to overwrite an existing file so a typo can't clobber
+	// something important.
+	path := cleanAndExpandPath(c.Path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, rpcInvalidError("Unable to create snapshot file: %v",
+			err)
+	}
+
+	w := bufio.NewWriter(f)
+	info, err := s.chain.WriteUtxoSnapshot(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		context := "Failed to write utxo snapshot"
+		return nil, rpcInternalError(err.Error(), context)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		context := "Failed to stat utxo snapshot"
+		return nil, rpcInternalError(err.Error(), context)
+	}
+
+	return &cmmjson.ExportUtxoSnapshotResult{
+		Path:         path,
+		BlockHash:    info.Hash.String(),
+		Height:       info.Height,
+		UtxoHash:     info.UtxoHash.String(),
+		SnapshotHash: info.SnapshotHash.String(),
+		Bytes:        fi.Size(),
+	}, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -1913,6 +2065,9 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	}
 	blk, err := s.server.blockManager.chain.FetchBlockByHash(hash)
 	if err != nil {
+		if pruned, _ := s.chain.IsBlockPruned(hash); pruned {
+			return nil, rpcBlockPrunedError(hash)
+		}
 		return nil, &cmmjson.RPCError{
 			Code:    cmmjson.ErrRPCBlockNotFound,
 			Message: fmt.Sprintf("Block not found: %v", hash),
@@ -2031,6 +2186,69 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return blockReply, nil
 }
 
+// handleGetBlockchainInfo implements the getblockchaininfo command.
+func handleGetBlockchainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	best := s.chain.BestSnapshot()
+
+	// Fetch the current chain work using the the best block hash.
+	chainWork, err := s.chain.ChainWork(&best.Hash)
+	if err != nil {
+		return nil, rpcInternalError(err.Error(), "Could not fetch chain work")
+	}
+
+	// Estimate the verification progress of the node.
+	syncHeight := s.server.blockManager.SyncHeight()
+	var verifyProgress float64
+	if syncHeight > 0 {
+		verifyProgress = math.Min(float64(best.Height)/float64(syncHeight), 1.0)
+	}
+
+	// The prune height is the height of the first block whose data is still
+	// available when pruning is enabled.
+	var pruneHeight int64
+	if cfg.Prune != 0 {
+		pruneHeight = s.chain.PrunedHeight() + 1
+	}
+
+	// Fetch the agendas of the consensus deployments along with their
+	// threshold states for the next block.
+	params := s.server.chainParams
+	deployments := make(map[string]cmmjson.AgendaInfo)
+	for version, agendas := range params.Deployments {
+		for _, agenda := range agendas {
+			state, err := s.chain.ThresholdState(&best.Hash, version,
+				agenda.Vote.Id)
+			if err != nil {
+				context := fmt.Sprintf("Could not fetch threshold "+
+					"state for agenda %s", agenda.Vote.Id)
+				return nil, rpcInternalError(err.Error(), context)
+			}
+
+			deployments[agenda.Vote.Id] = cmmjson.AgendaInfo{
+				Status:     state.String(),
+				StartTime:  agenda.StartTime,
+				ExpireTime: agenda.ExpireTime,
+			}
+		}
+	}
+
+	return &cmmjson.GetBlockChainInfoResult{
+		Chain:                params.Name,
+		Blocks:               best.Height,
+		Headers:              s.server.blockManager.HeadersHeight(),
+		SyncHeight:           syncHeight,
+		BestBlockHash:        best.Hash.String(),
+		Difficulty:           getDifficultyRatio(best.Bits),
+		MedianTime:           best.MedianTime.Unix(),
+		VerificationProgress: verifyProgress,
+		InitialBlockDownload: !s.chain.IsCurrent(),
+		ChainWork:            fmt.Sprintf("%064x", chainWork),
+		Pruned:               cfg.Prune != 0,
+		PruneHeight:          pruneHeight,
+		Deployments:          deployments,
+	}, nil
+}
+
 // handleGetBlockCount implements the getblockcount command.
 func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.chain.BestSnapshot()
@@ -2273,6 +2491,32 @@ func (state *gbtWorkState) NotifyMempoolTx(lastUpdated time.Time) {
 	}()
 }
 
+// NotifyVote notifies any long poll clients with a new block template when a
+// new vote on the block the current template builds on arrives.  Unlike other
+// transactions, votes bypass the regeneration delay since they determine
+// which stake transactions the next block is allowed to include.
+func (state *gbtWorkState) NotifyVote(votedOn *chainhash.Hash) {
+	go func() {
+		state.Lock()
+		defer state.Unlock()
+
+		// No need to notify anything if the vote is not for the block
+		// the current template builds on.
+		if state.prevHash == nil || !state.prevHash.IsEqual(votedOn) {
+			return
+		}
+
+		channels, ok := state.notifyMap[*votedOn]
+		if !ok {
+			return
+		}
+		for _, c := range channels {
+			close(c)
+		}
+		delete(state.notifyMap, *votedOn)
+	}()
+}
+
 // templateUpdateChan returns a channel that will be closed once the block
 // template associated with the passed previous hash and last generated time
 // is stale.  The function will return existing channels for duplicate
@@ -2303,8 +2547,9 @@ func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGene
 
 // updateBlockTemplate creates or updates a block template for the work state.
 // A new block template will be generated when the current best block has
-// changed or the transactions in the memory pool have been updated and it has
-// been long enough since the last template was generated.  Otherwise, the
+// changed, the number of votes on it has changed, or the transactions in the
+// memory pool have been updated and it has been long enough since the last
+// template was generated.  Otherwise, the
 // timestamp for the existing block template is updated (and possibly the
 // difficulty on testnet per the consesus rules).  Finally, if the
 // useCoinbaseValue flag is false and the existing block template does not
@@ -2320,15 +2565,17 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	}
 
 	// Generate a new block template when the current best block has
-	// changed or the transactions in the memory pool have been updated and
-	// it has been at least gbtRegenerateSecond since the last template was
-	// generated.
+	// changed, new votes on it have arrived, or the transactions in the
+	// memory pool have been updated and it has been at least
+	// gbtRegenerateSecond since the last template was generated.
 	var msgBlock *wire.MsgBlock
 	var targetDifficulty string
 	latestHash, _ := s.server.blockManager.chainState.Best()
+	numVotes := len(s.server.txMemPool.VoteHashesForBlock(latestHash))
 	template := state.template
 	if template == nil || state.prevHash == nil ||
 		!state.prevHash.IsEqual(latestHash) ||
+		state.numVotes != numVotes ||
 		(state.lastTxUpdate != lastTxUpdate &&
 			time.Now().After(state.lastGenerated.Add(time.Second*
 				gbtRegenerateSeconds))) {
@@ -2386,6 +2633,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		state.lastGenerated = time.Now()
 		state.lastTxUpdate = lastTxUpdate
 		state.prevHash = latestHash
+		state.numVotes = numVotes
 		state.minTimestamp = minTimestamp
 
 		rpcsLog.Debugf("Generated block template (timestamp %v, "+
@@ -2405,22 +2653,24 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 
 		// When the caller requires a full coinbase as opposed to only
 		// the pertinent details needed to create their own coinbase,
-		// add a payment address to the output of the coinbase of the
-		// template if it doesn't already have one.  Since this requires
-		// mining addresses to be specified via the config, an error is
+		// add a payment address to the subsidy output of the coinbase
+		// of the template if it doesn't already have one.  Since this
+		// requires a mining address to be specified, an error is
 		// returned if none have been specified.
 		if !useCoinbaseValue && !template.ValidPayAddress {
-			// Choose a payment address at random.
-			payToAddr := cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
+			payToAddr, err := s.server.blockManager.GetMiningAddr()
+			if err != nil {
+				return rpcInternalError(err.Error(), "Configuration")
+			}
 
 			// Update the block coinbase output of the template to
-			// pay to the randomly selected payment address.
+			// pay to the selected payment address.
 			pkScript, err := txscript.PayToAddrScript(payToAddr)
 			if err != nil {
 				context := "Failed to create pay-to-addr script"
 				return rpcInternalError(err.Error(), context)
 			}
-			template.Block.Transactions[0].TxOut[0].PkScript = pkScript
+			template.Block.Transactions[0].TxOut[1].PkScript = pkScript
 			template.ValidPayAddress = true
 
 			// Update the merkle root.
@@ -2615,6 +2865,40 @@ func (state *gbtWorkState) blockTemplateResult(bm *blockManager, useCoinbaseValu
 		return nil, rpcInternalError(err.Error(), context)
 	}
 
+	// Decode the header fields and describe the layout of the serialized
+	// header so miners are able to place the nonce, extra nonce and
+	// equihash solution without having to know the header format.
+	headerFields := cmmjson.GetBlockTemplateResultHeader{
+		Version:      header.Version,
+		PreviousHash: header.PrevBlock.String(),
+		MerkleRoot:   header.MerkleRoot.String(),
+		StakeRoot:    header.StakeRoot.String(),
+		VoteBits:     header.VoteBits,
+		FinalState:   hex.EncodeToString(header.FinalState[:]),
+		Voters:       header.Voters,
+		FreshStake:   header.FreshStake,
+		Revocations:  header.Revocations,
+		PoolSize:     header.PoolSize,
+		Bits:         strconv.FormatInt(int64(header.Bits), 16),
+		SBits:        header.SBits,
+		Height:       header.Height,
+		Size:         header.Size,
+		CurTime:      header.Timestamp.Unix(),
+		Nonce:        header.Nonce,
+		ExtraData:    hex.EncodeToString(header.ExtraData[:]),
+		StakeVersion: header.StakeVersion,
+	}
+	params := bm.server.chainParams
+	equihash := cmmjson.GetBlockTemplateResultEquihash{
+		N:               params.N,
+		K:               params.K,
+		SolutionSize:    len(header.EquihashSolution),
+		HeaderSize:      len(headerBytes),
+		NonceOffset:     gbtNonceOffset,
+		ExtraDataOffset: gbtExtraDataOffset,
+		SolutionOffset:  gbtSolutionOffset,
+	}
+
 	// Generate the block template reply.  Note that following mutations
 	// are implied by the included or omission of fields:
 	//  Including MinTime -> time/decrement
@@ -2623,6 +2907,8 @@ func (state *gbtWorkState) blockTemplateResult(bm *blockManager, useCoinbaseValu
 	templateID := encodeTemplateID(state.prevHash, state.lastGenerated)
 	reply := cmmjson.GetBlockTemplateResult{
 		Header:        hex.EncodeToString(headerBytes),
+		HeaderFields:  &headerFields,
+		Equihash:      &equihash,
 		SigOpLimit:    blockchain.MaxSigOpsPerBlock,
 		SizeLimit:     maxBlockSize,
 		Transactions:  transactions,
@@ -2638,7 +2924,7 @@ func (state *gbtWorkState) blockTemplateResult(bm *blockManager, useCoinbaseValu
 	}
 	if useCoinbaseValue {
 		reply.CoinbaseAux = gbtCoinbaseAux
-		reply.CoinbaseValue = &msgBlock.Transactions[0].TxOut[0].Value
+		reply.CoinbaseValue = &msgBlock.Transactions[0].TxOut[1].Value
 	} else {
 		// Ensure the template has a valid payment address associated
 		// with it when a full coinbase is requested.
@@ -2679,8 +2965,9 @@ func (state *gbtWorkState) blockTemplateResult(bm *blockManager, useCoinbaseValu
 // is not sent until the caller should stop working on the previous block
 // template in favor of the new one.  In particular, this is the case when the
 // old block template is no longer valid due to a solution already being found
-// and added to the block chain, or new transactions have shown up and some time
-// has passed without finding a solution.
+// and added to the block chain, new votes on the block being built on have
+// arrived, or new transactions have shown up and some time has passed without
+// finding a solution.
 //
 // See https://en.bitcoin.it/wiki/BIP_0022 for more details.
 func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbaseValue bool, closeChan <-chan struct{}) (interface{}, error) {
@@ -2802,11 +3089,13 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *cmmjson.TemplateReques
 	// When a coinbase transaction has been requested, respond with an
 	// error if there are no addresses to pay the created block template
 	// to.
-	if !useCoinbaseValue && len(cfg.miningAddrs) == 0 {
-		return nil, rpcInternalError("A coinbase transaction has "+
-			"been requested, but the server has not been "+
-			"configured with any payment addresses via "+
-			"--miningaddr", "Configuration")
+	if !useCoinbaseValue {
+		if _, err := s.server.blockManager.GetMiningAddr(); err != nil {
+			return nil, rpcInternalError("A coinbase transaction "+
+				"has been requested, but the server has not "+
+				"been configured with any payment addresses "+
+				"via --miningaddr or setgenerate", "Configuration")
+		}
 	}
 
 	// Return an error if there are no peers connected since there is no
@@ -2885,6 +3174,8 @@ func chainErrToGBTErrString(err error) string {
 		return "bad-diffbits"
 	case blockchain.ErrHighHash:
 		return "high-hash"
+	case blockchain.ErrInvalidEquihashSolution:
+		return "bad-equihash-solution"
 	case blockchain.ErrBadMerkleRoot:
 		return "bad-txnmrklroot"
 	case blockchain.ErrBadCheckpoint:
@@ -2976,6 +3267,16 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *cmmjson.TemplateReque
 		return "bad-prevblk", nil
 	}
 
+	// The proof of work check is skipped below since proposals are not
+	// expected to meet the target, however the equihash solution must
+	// still be valid for the header.
+	chainParams := s.server.chainParams
+	err = blockchain.ValidateEquihashSolution(&msgBlock.Header, chainParams)
+	if err != nil {
+		rpcsLog.Infof("Rejected block proposal: %v", err)
+		return chainErrToGBTErrString(err), nil
+	}
+
 	flags := blockchain.BFNoPoWCheck
 	err = s.server.blockManager.chain.CheckConnectBlock(block, flags)
 	if err != nil {
@@ -2999,19 +3300,6 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *cmmjson.TemplateReque
 // See https://en.bitcoin.it/wiki/BIP_0022 and
 // https://en.bitcoin.it/wiki/BIP_0023 for more details.
 func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	if s.server.cpuMiner.IsMining() {
-		return nil, rpcMiscError("Block template production is " +
-			"disallowed while CPU mining is enabled. " +
-			"Please disable CPU mining and try again.")
-	}
-
-	// Respond with an error if there are no addresses to pay the
-	// created blocks to.
-	_, err := s.server.blockManager.GetMiningAddr()
-	if err != nil {
-		return nil, rpcInternalError(err.Error(), "Configuration")
-	}
-
 	c := cmd.(*cmmjson.GetBlockTemplateCmd)
 	request := c.Request
 
@@ -3064,7 +3352,7 @@ func handleGetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 
 // handleGetHashesPerSec implements the gethashespersec command.
 func handleGetHashesPerSec(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return int64(s.server.cpuMiner.HashesPerSecond()), nil
+	return int64(s.server.cpuMiner.SolutionsPerSecond()), nil
 }
 
 // handleGetCFilter implements the getcfilter command.
@@ -3223,6 +3511,65 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return ret, nil
 }
 
+// mempoolEntriesResult returns the passed getmempoolentry results when the
+// verbose flag is set or the sorted hashes of the transactions otherwise.
+func mempoolEntriesResult(entries map[string]*cmmjson.GetMempoolEntryResult, verbose *bool) interface{} {
+	if verbose != nil && *verbose {
+		return entries
+	}
+	hashStrings := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashStrings = append(hashStrings, hash)
+	}
+	sort.Strings(hashStrings)
+	return hashStrings
+}
+
+// handleGetMempoolAncestors implements the getmempoolancestors command.
+func handleGetMempoolAncestors(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.GetMempoolAncestorsCmd)
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	entries, err := s.server.txMemPool.MempoolAncestors(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	return mempoolEntriesResult(entries, c.Verbose), nil
+}
+
+// handleGetMempoolDescendants implements the getmempooldescendants command.
+func handleGetMempoolDescendants(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.GetMempoolDescendantsCmd)
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	entries, err := s.server.txMemPool.MempoolDescendants(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	return mempoolEntriesResult(entries, c.Verbose), nil
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.GetMempoolEntryCmd)
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	entry, err := s.server.txMemPool.MempoolEntry(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	return entry, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.server.txMemPool.TxDescs()
@@ -3232,9 +3579,18 @@ func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		numBytes += int64(txD.Tx.MsgTx().SerializeSize())
 	}
 
+	// The pool never accepts transactions paying less than the minimum
+	// relay fee, regardless of its dynamic minimum fee rate.
+	minFee := s.server.txMemPool.MinFeeRate()
+	if minFee < cfg.minRelayTxFee {
+		minFee = cfg.minRelayTxFee
+	}
+
 	ret := &cmmjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:          int64(len(mempoolTxns)),
+		Bytes:         numBytes,
+		MaxMempool:    cfg.MaxMempool * 1024 * 1024,
+		MempoolMinFee: minFee.ToCoin(),
 	}
 
 	return ret, nil
@@ -3273,7 +3629,7 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		StakeDifficulty:  nextStakeDiff,
 		Generate:         s.server.cpuMiner.IsMining(),
 		GenProcLimit:     s.server.cpuMiner.NumWorkers(),
-		HashesPerSec:     s.server.cpuMiner.HashesPerSecond(),
+		HashesPerSec:     s.server.cpuMiner.SolutionsPerSecond(),
 		NetworkHashPS:    networkHashesPerSec,
 		PooledTx:         uint64(s.server.txMemPool.Count()),
 		TestNet:          cfg.TestNet,
@@ -3284,10 +3640,20 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 // handleGetNetTotals implements the getnettotals command.
 func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	totalBytesRecv, totalBytesSent := s.server.NetTotals()
+	now := time.Now()
+	uploadTarget := s.server.uploadTarget
 	reply := &cmmjson.GetNetTotalsResult{
 		TotalBytesRecv: totalBytesRecv,
 		TotalBytesSent: totalBytesSent,
-		TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
+		TimeMillis:     now.UTC().UnixNano() / int64(time.Millisecond),
+		UploadTarget: cmmjson.GetNetTotalsResultUploadTarget{
+			TimeFrame:             int64(uploadTargetTimeframe / time.Second),
+			Target:                cfg.MaxUploadTarget * 1024 * 1024,
+			TargetReached:         uploadTarget.Reached(false, now),
+			ServeHistoricalBlocks: !uploadTarget.Reached(true, now),
+			BytesLeftInCycle:      uploadTarget.BytesLeftInCycle(now),
+			TimeLeftInCycle:       int64(uploadTarget.TimeLeftInCycle(now) / time.Second),
+		},
 	}
 	return reply, nil
 }
@@ -3415,6 +3781,8 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			CurrentHeight:  statsSnap.LastBlock,
 			BanScore:       int32(p.banScore.Int()),
 			SyncNode:       p == syncPeer,
+			MaxSendRate:    statsSnap.MaxSendRate,
+			MaxRecvRate:    statsSnap.MaxRecvRate,
 		}
 		if p.LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -4007,6 +4375,25 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
+// handleGetTxOutSetInfo implements the gettxoutsetinfo command.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats, err := s.chain.FetchUtxoStats()
+	if err != nil {
+		return nil, rpcInternalError(err.Error(), "Could not fetch utxo "+
+			"set statistics")
+	}
+
+	return &cmmjson.GetTxOutSetInfoResult{
+		Height:         stats.BestHeight,
+		BestBlock:      stats.BestHash.String(),
+		Transactions:   stats.Transactions,
+		TxOuts:         stats.Utxos,
+		SerializedSize: stats.Size,
+		SerializedHash: stats.SerializedHash.String(),
+		TotalAmount:    cmmutil.Amount(stats.Total).ToCoin(),
+	}, nil
+}
+
 // pruneOldBlockTemplates prunes all old block templates from the templatePool
 // map. Must be called with the RPC workstate locked to avoid races to the map.
 func pruneOldBlockTemplates(s *rpcServer, bestHeight int64) {
@@ -4398,6 +4785,44 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.InvalidateBlockCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	if have, err := s.chain.HaveBlock(hash); err != nil || !have {
+		return nil, &cmmjson.RPCError{
+			Code:    cmmjson.ErrRPCBlockNotFound,
+			Message: fmt.Sprintf("Block not found: %v", hash),
+		}
+	}
+
+	err = s.server.blockManager.InvalidateBlock(hash)
+	if err != nil {
+		return nil, rpcInternalError(err.Error(),
+			"Could not invalidate block")
+	}
+
+	return nil, nil
+}
+
+// handleListBanned implements the listbanned command.
+func handleListBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	entries := s.server.banList.Entries()
+	bans := make([]cmmjson.ListBannedResult, 0, len(entries))
+	for _, entry := range entries {
+		bans = append(bans, cmmjson.ListBannedResult{
+			Address:     entry.Subnet.String(),
+			BanCreated:  entry.Created.Unix(),
+			BannedUntil: entry.Until.Unix(),
+		})
+	}
+	return bans, nil
+}
+
 // handleLiveTickets implements the livetickets command.
 func handleLiveTickets(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	lt, err := s.server.blockManager.chain.LiveTickets()
@@ -4500,6 +4925,52 @@ func handleRebroadcastWinners(s *rpcServer, cmd interface{}, closeChan <-chan st
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.PrioritiseTransactionCmd)
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	s.server.txMemPool.PrioritiseTransaction(txHash, c.PriorityDelta,
+		c.FeeDelta)
+	return true, nil
+}
+
+// handleReconsiderBlock implements the reconsiderblock command.
+func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.ReconsiderBlockCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	err = s.server.blockManager.ReconsiderBlock(hash)
+	if err != nil {
+		return nil, rpcInternalError(err.Error(),
+			"Could not reconsider block")
+	}
+
+	return nil, nil
+}
+
+// handleSaveMempool implements the savemempool command.
+func handleSaveMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Do not overwrite the persisted memory pool with a partial one while
+	// it is still being reloaded.
+	if cfg.PersistMempool && atomic.LoadInt32(&s.server.mempoolLoaded) == 0 {
+		return nil, rpcMiscError("The memory pool has not been " +
+			"reloaded yet")
+	}
+
+	if err := s.server.saveMempool(); err != nil {
+		return nil, rpcInternalError(err.Error(),
+			"Could not save the memory pool")
+	}
+	return nil, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -5023,9 +5494,20 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 			err)
 	}
 
+	// Relay the transaction along the stem instead of announcing it to all
+	// peers when Dandelion++ is enabled.  It is added to the memory pool and
+	// rebroadcast once it is fluffed.
 	tx := cmmutil.NewTx(msgtx)
-	acceptedTxs, err := s.server.blockManager.ProcessTransaction(tx, false,
-		false, allowHighFees)
+	var stemmed bool
+	var acceptedTxs []*cmmutil.Tx
+	if s.server.dandelion != nil {
+		stemmed, err = s.server.dandelion.StemTransaction(tx, nil,
+			allowHighFees)
+	}
+	if err == nil && !stemmed {
+		acceptedTxs, err = s.server.blockManager.ProcessTransaction(tx,
+			false, false, allowHighFees)
+	}
 	if err != nil {
 		// When the error is a rule error, it means the transaction was
 		// simply rejected as opposed to something actually going
@@ -5054,6 +5536,9 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 		rpcsLog.Errorf("%v", err)
 		return nil, rpcDeserializationError("rejected: %v", err)
 	}
+	if stemmed {
+		return tx.Hash().String(), nil
+	}
 
 	s.server.AnnounceNewTransactions(acceptedTxs)
 
@@ -5079,6 +5564,59 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 	return tx.Hash().String(), nil
 }
 
+// handleSetBan implements the setban command.
+func handleSetBan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*cmmjson.SetBanCmd)
+	subnet, err := connmgr.ParseSubnet(c.SubNet)
+	if err != nil {
+		return nil, rpcInvalidError("%v", err)
+	}
+
+	switch c.SubCmd {
+	case cmmjson.SBAdd:
+		// Ban for the configured ban duration unless a ban time is
+		// given either in seconds from now or as an absolute unix
+		// timestamp.
+		now := time.Now()
+		until := now.Add(cfg.BanDuration)
+		if c.BanTime != nil && *c.BanTime != 0 {
+			if *c.BanTime < 0 {
+				return nil, rpcInvalidError("Ban time must not " +
+					"be negative")
+			}
+			if c.Absolute != nil && *c.Absolute {
+				until = time.Unix(*c.BanTime, 0)
+			} else {
+				until = now.Add(time.Duration(*c.BanTime) *
+					time.Second)
+			}
+		}
+		if !until.After(now) {
+			return nil, rpcInvalidError("Ban time is in the past")
+		}
+		if err := s.server.BanSubnet(subnet, until); err != nil {
+			return nil, rpcInternalError(err.Error(),
+				"Could not save ban list")
+		}
+
+	case cmmjson.SBRemove:
+		removed, err := s.server.banList.Unban(subnet)
+		if err != nil {
+			return nil, rpcInternalError(err.Error(),
+				"Could not save ban list")
+		}
+		if !removed {
+			return nil, rpcInvalidError("%v is not banned", subnet)
+		}
+
+	default:
+		return nil, rpcInvalidError("%v: invalid subcommand for setban",
+			c.SubCmd)
+	}
+
+	return nil, nil
+}
+
 // handleSetGenerate implements the setgenerate command.
 func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*cmmjson.SetGenerateCmd)
@@ -96,10 +96,95 @@ func testGetBlockHash(r *rpctest.Harness, t *testing.T) {
 	}
 }
 
+func testGetBlockChainInfo(r *rpctest.Harness, t *testing.T) {
+	bestHash, bestHeight, err := r.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("Call to `getbestblock` failed: %v", err)
+	}
+
+	info, err := r.Node.GetBlockChainInfo()
+	if err != nil {
+		t.Fatalf("Call to `getblockchaininfo` failed: %v", err)
+	}
+
+	// The result should describe the current best block of the simulation
+	// network.
+	if info.Chain != chaincfg.SimNetParams.Name {
+		t.Fatalf("Chain names do not match. Got %v, wanted %v",
+			info.Chain, chaincfg.SimNetParams.Name)
+	}
+	if info.Blocks != bestHeight || info.BestBlockHash != bestHash.String() {
+		t.Fatalf("Best blocks do not match. Got %v (%d), wanted %v (%d)",
+			info.BestBlockHash, info.Blocks, bestHash, bestHeight)
+	}
+
+	// The header chain is never behind the block chain.
+	if info.Headers < info.Blocks {
+		t.Fatalf("Header height %d is below the block height %d",
+			info.Headers, info.Blocks)
+	}
+	if len(info.ChainWork) != 64 || info.Pruned {
+		t.Fatalf("Unexpected chain work %q or pruned state %v",
+			info.ChainWork, info.Pruned)
+	}
+}
+
+func testGetTxOutSetInfo(r *rpctest.Harness, t *testing.T) {
+	prevInfo, err := r.Node.GetTxOutSetInfo()
+	if err != nil {
+		t.Fatalf("Call to `gettxoutsetinfo` failed: %v", err)
+	}
+
+	// Create a new block connecting to the current tip.
+	generatedBlockHashes, err := r.Node.Generate(1)
+	if err != nil {
+		t.Fatalf("Unable to generate block: %v", err)
+	}
+
+	info, err := r.Node.GetTxOutSetInfo()
+	if err != nil {
+		t.Fatalf("Call to `gettxoutsetinfo` failed: %v", err)
+	}
+
+	// The statistics should be for the newly generated block.
+	if info.BestBlock != generatedBlockHashes[0].String() ||
+		info.Height != prevInfo.Height+1 {
+
+		t.Fatalf("Best blocks do not match. Got %v (%d), wanted %v (%d)",
+			info.BestBlock, info.Height, generatedBlockHashes[0],
+			prevInfo.Height+1)
+	}
+
+	// The coinbase of the new block adds a transaction with unspent
+	// outputs and increases the total amount by the block subsidy.
+	if info.Transactions <= prevInfo.Transactions ||
+		info.TxOuts <= prevInfo.TxOuts {
+
+		t.Fatalf("Unexpected utxo counts. Got %d txns and %d outputs, "+
+			"wanted more than %d txns and %d outputs",
+			info.Transactions, info.TxOuts, prevInfo.Transactions,
+			prevInfo.TxOuts)
+	}
+	if info.TotalAmount <= prevInfo.TotalAmount {
+		t.Fatalf("Total amount did not increase. Got %v, previously %v",
+			info.TotalAmount, prevInfo.TotalAmount)
+	}
+	if info.SerializedHash == prevInfo.SerializedHash ||
+		info.SerializedSize <= prevInfo.SerializedSize {
+
+		t.Fatalf("Serialized utxo set did not grow. Got %v (%d "+
+			"bytes), previously %v (%d bytes)", info.SerializedHash,
+			info.SerializedSize, prevInfo.SerializedHash,
+			prevInfo.SerializedSize)
+	}
+}
+
 var rpcTestCases = []rpctest.HarnessTestCase{
 	testGetBestBlock,
 	testGetBlockCount,
 	testGetBlockHash,
+	testGetBlockChainInfo,
+	testGetTxOutSetInfo,
 }
 
 var primaryHarness *rpctest.Harness
@@ -82,6 +82,9 @@ var helpDescsEnUS = map[string]string{
 	"createrawssrtx-inputs":   "The inputs to the transaction of type sstxinput",
 	"createrawssrtx-fee":      "The fee to apply to the revocation in Coins",
 
+	// ClearBannedCmd help.
+	"clearbanned--synopsis": "Removes all IP address and subnet bans.",
+
 	// CreateRawTransactionCmd help.
 	"createrawtransaction--synopsis": "Returns a new transaction spending the provided inputs and sending to the provided addresses.\n" +
 		"The transaction inputs are not signed in the created transaction.\n" +
@@ -199,6 +202,19 @@ var helpDescsEnUS = map[string]string{
 	"existsmempooltxs-txhashblob": "Blob containing the hashes to check",
 	"existsmempooltxs--result0":   "Bool blob showing if txs exist in the mempool or not",
 
+	// ExportUtxoSnapshotCmd help.
+	"exportutxosnapshot--synopsis": "Writes a snapshot of the utxo set, stake state and recent blocks as of the current best block to a new file on the server.\n" +
+		"The snapshot may be loaded into an empty data directory with --loadutxosnapshot once its block hash, height, utxo hash and snapshot hash are pinned in the chain parameters.",
+	"exportutxosnapshot-path": "The path of the file to create on the server; existing files are not overwritten",
+
+	// ExportUtxoSnapshotResult help.
+	"exportutxosnapshotresult-path":         "The path of the written snapshot",
+	"exportutxosnapshotresult-blockhash":    "The hash of the block the snapshot was taken at",
+	"exportutxosnapshotresult-height":       "The height of the block the snapshot was taken at",
+	"exportutxosnapshotresult-utxohash":     "The serialized hash of the utxo set, matching hash_serialized from gettxoutsetinfo",
+	"exportutxosnapshotresult-snapshothash": "The hash of the entire snapshot contents, including the stake state, which must be pinned to load it",
+	"exportutxosnapshotresult-bytes":        "The size of the snapshot in bytes",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
@@ -302,6 +318,32 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-stakeversion":      "Stake Version of the block",
 	"getblockverboseresult-equihashsolution":  "The equihash solution of the block",
 
+	// GetBlockChainInfoCmd help.
+	"getblockchaininfo--synopsis": "Returns information about the current state of the block chain.",
+
+	// GetBlockChainInfoResult help.
+	"getblockchaininforesult-chain":                "The name of the network the node is running on",
+	"getblockchaininforesult-blocks":               "The height of the best block in the main chain",
+	"getblockchaininforesult-headers":              "The height of the best validated block header, which is ahead of the best block while the headers are synced ahead of the blocks",
+	"getblockchaininforesult-syncheight":           "The latest known block height being synced to",
+	"getblockchaininforesult-bestblockhash":        "The hash of the best block in the main chain",
+	"getblockchaininforesult-difficulty":           "The current proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockchaininforesult-mediantime":           "The median time of the past 11 blocks as a unix timestamp",
+	"getblockchaininforesult-verificationprogress": "An estimate of the verification progress of the node",
+	"getblockchaininforesult-initialblockdownload": "Whether the node is still downloading the initial block chain",
+	"getblockchaininforesult-chainwork":            "The total cumulative work in the best chain",
+	"getblockchaininforesult-pruned":               "Whether the node deletes the data of old blocks",
+	"getblockchaininforesult-pruneheight":          "The height of the oldest block whose data is available (only when pruning is enabled)",
+	"getblockchaininforesult-deployments":          "Network consensus deployments",
+	"getblockchaininforesult-deployments--key":     "agenda",
+	"getblockchaininforesult-deployments--value":   `{"status": "status", "starttime": n, "expiretime": n}`,
+	"getblockchaininforesult-deployments--desc":    "The agenda id as the key and the deployment state as the value",
+
+	// AgendaInfo help.
+	"agendainfo-status":     "The threshold state of the agenda for the next block",
+	"agendainfo-starttime":  "The start time of the voting period for the agenda",
+	"agendainfo-expiretime": "The expiration time of the voting period for the agenda",
+
 	// GetBlockCountCmd help.
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
 	"getblockcount--result0":  "The current block count",
@@ -375,6 +417,35 @@ var helpDescsEnUS = map[string]string{
 	// GetBlockTemplateResultAux help.
 	"getblocktemplateresultaux-flags": "Hex-encoded byte-for-byte data to include in the coinbase signature script",
 
+	// GetBlockTemplateResultHeader help.
+	"getblocktemplateresultheader-version":           "The block version",
+	"getblocktemplateresultheader-previousblockhash": "Hex-encoded big-endian hash of the previous block",
+	"getblocktemplateresultheader-merkleroot":        "The merkle root of the regular transaction tree",
+	"getblocktemplateresultheader-stakeroot":         "The merkle root of the stake transaction tree",
+	"getblocktemplateresultheader-votebits":          "The vote bits",
+	"getblocktemplateresultheader-finalstate":        "Hex-encoded final state value of the ticket pool",
+	"getblocktemplateresultheader-voters":            "The number of votes in the block",
+	"getblocktemplateresultheader-freshstake":        "The number of new tickets in the block",
+	"getblocktemplateresultheader-revocations":       "The number of revocations in the block",
+	"getblocktemplateresultheader-poolsize":          "The size of the live ticket pool",
+	"getblocktemplateresultheader-bits":              "Hex-encoded compressed difficulty",
+	"getblocktemplateresultheader-sbits":             "The stake difficulty in atoms",
+	"getblocktemplateresultheader-height":            "Height of the block to be solved",
+	"getblocktemplateresultheader-size":              "The size of the block in bytes",
+	"getblocktemplateresultheader-curtime":           "The block time in seconds since 1 Jan 1970 GMT",
+	"getblocktemplateresultheader-nonce":             "The block nonce",
+	"getblocktemplateresultheader-extradata":         "Hex-encoded extra data which miners may use as an extra nonce",
+	"getblocktemplateresultheader-stakeversion":      "The stake version of the block",
+
+	// GetBlockTemplateResultEquihash help.
+	"getblocktemplateresultequihash-n":               "The equihash N parameter",
+	"getblocktemplateresultequihash-k":               "The equihash K parameter",
+	"getblocktemplateresultequihash-solutionsize":    "The size of the equihash solution in bytes",
+	"getblocktemplateresultequihash-headersize":      "The size of the serialized header including the solution in bytes",
+	"getblocktemplateresultequihash-nonceoffset":     "The byte offset of the nonce in the serialized header",
+	"getblocktemplateresultequihash-extradataoffset": "The byte offset of the extra data in the serialized header",
+	"getblocktemplateresultequihash-solutionoffset":  "The byte offset of the equihash solution in the serialized header",
+
 	// GetBlockTemplateResult help.
 	"getblocktemplateresult-bits":              "Hex-encoded compressed difficulty",
 	"getblocktemplateresult-curtime":           "Current time as seen by the server (recommended for block time); must fall within mintime/maxtime rules",
@@ -400,7 +471,9 @@ var helpDescsEnUS = map[string]string{
 	"getblocktemplateresult-capabilities":      "List of server capabilities including 'proposal' to indicate support for block proposals",
 	"getblocktemplateresult-reject-reason":     "Reason the proposal was invalid as-is (only applies to proposal responses)",
 	"getblocktemplateresult-stransactions":     "Stake transactions",
-	"getblocktemplateresult-header":            "Block header",
+	"getblocktemplateresult-header":            "Hex-encoded serialized block header including the equihash solution",
+	"getblocktemplateresult-headerfields":      "The decoded fields of the block header",
+	"getblocktemplateresult-equihash":          "The equihash parameters and the layout of the serialized header",
 
 	// GetBlockTemplateCmd help.
 	"getblocktemplate--synopsis": "Returns a JSON object with information necessary to construct a block to mine or accepts a proposal to validate.\n" +
@@ -514,8 +587,8 @@ var helpDescsEnUS = map[string]string{
 	"getgenerate--result0":  "True if mining, false if not",
 
 	// GetHashesPerSecCmd help.
-	"gethashespersec--synopsis": "Returns a recent hashes per second performance measurement while generating coins (mining).",
-	"gethashespersec--result0":  "The number of hashes per second",
+	"gethashespersec--synopsis": "Returns a recent Equihash solutions per second (Sol/s) performance measurement while generating coins (mining).",
+	"gethashespersec--result0":  "The number of solutions per second",
 
 	// InfoChainResult help.
 	"infochainresult-version":         "The version of the server",
@@ -556,12 +629,51 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-size":             "Transaction size in bytes",
+	"getmempoolentryresult-fee":              "Transaction fee in CMM",
+	"getmempoolentryresult-modifiedfee":      "Transaction fee in CMM including the fee delta set with prioritisetransaction",
+	"getmempoolentryresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":           "Block height when transaction entered the pool",
+	"getmempoolentryresult-startingpriority": "Priority when transaction entered the pool",
+	"getmempoolentryresult-currentpriority":  "Current priority including the priority delta set with prioritisetransaction",
+	"getmempoolentryresult-descendantcount":  "Number of transactions in the pool which depend on this transaction, including this one",
+	"getmempoolentryresult-descendantsize":   "Total size in bytes of this transaction and the transactions in the pool which depend on it",
+	"getmempoolentryresult-descendantfees":   "Total modified fee in CMM of this transaction and the transactions in the pool which depend on it",
+	"getmempoolentryresult-ancestorcount":    "Number of transactions in the pool this transaction depends on, including this one",
+	"getmempoolentryresult-ancestorsize":     "Total size in bytes of this transaction and the transactions in the pool it depends on",
+	"getmempoolentryresult-ancestorfees":     "Total modified fee in CMM of this transaction and the transactions in the pool it depends on",
+	"getmempoolentryresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-spentby":          "Unconfirmed transactions spending outputs of this transaction",
+
+	// GetMempoolAncestorsCmd help.
+	"getmempoolancestors--synopsis":   "Returns the transactions in the memory pool a transaction in the memory pool depends on, either directly or through other transactions in the memory pool.",
+	"getmempoolancestors-txid":        "The hash of the transaction",
+	"getmempoolancestors-verbose":     "Returns JSON objects by transaction hash when true or an array of transaction hashes when false",
+	"getmempoolancestors--condition0": "verbose=false",
+	"getmempoolancestors--condition1": "verbose=true",
+	"getmempoolancestors--result0":    "Array of transaction hashes",
+
+	// GetMempoolDescendantsCmd help.
+	"getmempooldescendants--synopsis":   "Returns the transactions in the memory pool which depend on a transaction in the memory pool, either directly or through other transactions in the memory pool.",
+	"getmempooldescendants-txid":        "The hash of the transaction",
+	"getmempooldescendants-verbose":     "Returns JSON objects by transaction hash when true or an array of transaction hashes when false",
+	"getmempooldescendants--condition0": "verbose=false",
+	"getmempooldescendants--condition1": "verbose=true",
+	"getmempooldescendants--result0":    "Array of transaction hashes",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":         "Size in bytes of the mempool",
+	"getmempoolinforesult-size":          "Number of transactions in the mempool",
+	"getmempoolinforesult-maxmempool":    "Maximum size in bytes of the mempool (0 when unlimited)",
+	"getmempoolinforesult-mempoolminfee": "Minimum fee in CMM/kB required for regular transactions to be accepted due to the mempool size limit",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":           "Height of the latest best block",
@@ -593,6 +705,15 @@ var helpDescsEnUS = map[string]string{
 	"getnettotalsresult-totalbytesrecv": "Total bytes received",
 	"getnettotalsresult-totalbytessent": "Total bytes sent",
 	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-uploadtarget":   "The upload target and its current state",
+
+	// GetNetTotalsResultUploadTarget help.
+	"getnettotalsresultuploadtarget-timeframe":             "Length of the upload target cycle in seconds",
+	"getnettotalsresultuploadtarget-target":                "Bytes which may be sent per cycle or 0 when unlimited",
+	"getnettotalsresultuploadtarget-targetreached":         "Whether or not the upload target for the current cycle has been reached",
+	"getnettotalsresultuploadtarget-servehistoricalblocks": "Whether or not historical blocks are still served to non-whitelisted peers",
+	"getnettotalsresultuploadtarget-bytesleftincycle":      "Bytes which may still be sent during the current cycle",
+	"getnettotalsresultuploadtarget-timeleftincycle":       "Seconds left in the current cycle",
 
 	// GetPeerInfoResult help.
 	"getpeerinforesult-id":             "A unique node ID",
@@ -615,6 +736,8 @@ var helpDescsEnUS = map[string]string{
 	"getpeerinforesult-currentheight":  "The current height of the peer",
 	"getpeerinforesult-banscore":       "The ban score",
 	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-maxsendrate":    "Bytes per second the rate of sending to the peer is limited to or 0 when unlimited",
+	"getpeerinforesult-maxrecvrate":    "Bytes per second the rate of receiving from the peer is limited to or 0 when unlimited",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -622,10 +745,11 @@ var helpDescsEnUS = map[string]string{
 	// GetRawMempoolVerboseResult help.
 	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
 	"getrawmempoolverboseresult-fee":              "Transaction fee in CMM",
+	"getrawmempoolverboseresult-modifiedfee":      "Transaction fee in CMM including the fee delta set with prioritisetransaction",
 	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
 	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
 	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
-	"getrawmempoolverboseresult-currentpriority":  "Current priority",
+	"getrawmempoolverboseresult-currentpriority":  "Current priority including the priority delta set with prioritisetransaction",
 	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
 
 	// GetRawMempoolCmd help.
@@ -662,6 +786,18 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis": "Returns statistics about the unspent transaction output set.  This walks the entire set and may take some time.",
+
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":           "The height of the best block the statistics were calculated for",
+	"gettxoutsetinforesult-bestblock":        "The hash of the best block the statistics were calculated for",
+	"gettxoutsetinforesult-transactions":     "The number of transactions with unspent outputs",
+	"gettxoutsetinforesult-txouts":           "The number of unspent transaction outputs",
+	"gettxoutsetinforesult-bytes_serialized": "The size of the serialized unspent transaction output set in bytes",
+	"gettxoutsetinforesult-hash_serialized":  "The hash of the serialized unspent transaction output set",
+	"gettxoutsetinforesult-total_amount":     "The total amount of all unspent transaction outputs in CMM",
+
 	// GetWorkResult help.
 	"getworkresult-data":     "Hex-encoded block data",
 	"getworkresult-hash1":    "(DEPRECATED) Hex-encoded formatted hash buffer",
@@ -683,6 +819,18 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// InvalidateBlockCmd help.
+	"invalidateblock--synopsis": "Permanently marks a block and all of its descendants as invalid, reorganizing the chain to the best remaining valid tip when needed.",
+	"invalidateblock-blockhash": "The hash of the block to mark as invalid",
+
+	// ListBannedCmd help.
+	"listbanned--synopsis": "Returns the banned IP addresses and subnets.",
+
+	// ListBannedResult help.
+	"listbannedresult-address":     "The banned IP address or subnet in CIDR notation",
+	"listbannedresult-bancreated":  "Time the ban was created in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-banneduntil": "Time the ban expires in seconds since 1 Jan 1970 GMT",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
@@ -693,6 +841,20 @@ var helpDescsEnUS = map[string]string{
 	// RebroadcastWinnerCmd help.
 	"rebroadcastwinners--synopsis": "Asks the daemon to rebroadcast the winners of the voting lottery.\n",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis":     "Adds the passed priority and fee deltas to those of a transaction, which need not be in the memory pool yet, to change how it is prioritized for inclusion in block templates and for eviction from the memory pool.\nThe deltas do not change the fee the transaction pays and are cleared once it is mined.",
+	"prioritisetransaction-txid":          "The hash of the transaction",
+	"prioritisetransaction-prioritydelta": "The amount to add to the priority of the transaction",
+	"prioritisetransaction-feedelta":      "The amount in atoms to add to the fee of the transaction (may be negative)",
+	"prioritisetransaction--result0":      "Always true",
+
+	// ReconsiderBlockCmd help.
+	"reconsiderblock--synopsis": "Removes the invalid status from a block and its descendants that was previously set by invalidateblock or due to failed validation, reorganizing the chain to the best valid tip when needed.",
+	"reconsiderblock-blockhash": "The hash of the block to reconsider",
+
+	// SaveMempoolCmd help.
+	"savemempool--synopsis": "Writes the transactions in the memory pool to mempool.dat in the data directory so they are reloaded on startup when --persistmempool is set.",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -716,6 +878,14 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction-allowhighfees": "Whether or not to allow insanely high fees (cmmd does not yet implement this parameter, so it has no effect)",
 	"sendrawtransaction--result0":      "The hash of the transaction",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Bans an IP address or subnet, disconnecting the connected peers within it, or removes a ban.\n" +
+		"Bans persist across restarts.",
+	"setban-subnet":   "IP address or subnet in CIDR notation, such as 192.168.0.0/16, to operate on",
+	"setban-subcmd":   "'add' to ban the IP address or subnet or 'remove' to remove its ban",
+	"setban-bantime":  "Seconds to ban for or 0 to use the configured ban duration",
+	"setban-absolute": "Whether or not bantime is an absolute time in seconds since 1 Jan 1970 GMT",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
@@ -811,10 +981,21 @@ var helpDescsEnUS = map[string]string{
 	// -------- Commercium-specific help --------
 
 	// EstimateFee help.
-	"estimatefee--synopsis": "Returns the estimated fee in CMM/kb.",
-	"estimatefee-numblocks": "(unused)",
+	"estimatefee--synopsis": "Returns the estimated fee in CMM/kB needed for a transaction to be mined within the target number of blocks.\n" +
+		"The minimum relay fee is returned when there is not enough data to provide an estimate.",
+	"estimatefee-numblocks": "The maximum number of blocks the transaction should take to be mined",
 	"estimatefee--result0":  "Estimated fee.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis":    "Returns the estimated fee in CMM/kB needed for a transaction to be mined within the target number of blocks.",
+	"estimatesmartfee-conftarget":   "The maximum number of blocks the transaction should take to be mined",
+	"estimatesmartfee-estimatemode": "The estimation mode (ECONOMICAL or CONSERVATIVE).  Economical estimates react faster to falling fees, conservative estimates are less likely to be undercut",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "Estimated fee rate in CMM/kB",
+	"estimatesmartfeeresult-errors":  "Errors encountered while estimating the fee rate",
+	"estimatesmartfeeresult-blocks":  "The number of blocks the estimate is valid for",
+
 	// EstimateStakeDiff help.
 	"estimatestakediff--synopsis":      "Estimate the next minimum, maximum, expected, and user-specified stake difficulty",
 	"estimatestakediff-tickets":        "Use this number of new tickets in blocks to estimate the next difficulty",
@@ -918,6 +1099,7 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":               nil,
+	"clearbanned":           nil,
 	"createrawsstx":         {(*string)(nil)},
 	"createrawssgentx":      {(*string)(nil)},
 	"createrawssrtx":        {(*string)(nil)},
@@ -926,6 +1108,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"decoderawtransaction":  {(*cmmjson.TxRawDecodeResult)(nil)},
 	"decodescript":          {(*cmmjson.DecodeScriptResult)(nil)},
 	"estimatefee":           {(*float64)(nil)},
+	"estimatesmartfee":      {(*cmmjson.EstimateSmartFeeResult)(nil)},
 	"estimatestakediff":     {(*cmmjson.EstimateStakeDiffResult)(nil)},
 	"existsaddress":         {(*bool)(nil)},
 	"existsaddresses":       {(*string)(nil)},
@@ -934,11 +1117,13 @@ var rpcResultTypes = map[string][]interface{}{
 	"existsliveticket":      {(*bool)(nil)},
 	"existslivetickets":     {(*string)(nil)},
 	"existsmempooltxs":      {(*string)(nil)},
+	"exportutxosnapshot":    {(*cmmjson.ExportUtxoSnapshotResult)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]cmmjson.GetAddedNodeInfoResult)(nil)},
 	"getbestblock":          {(*cmmjson.GetBestBlockResult)(nil)},
 	"generate":              {(*[]string)(nil)},
 	"getbestblockhash":      {(*string)(nil)},
 	"getblock":              {(*string)(nil), (*cmmjson.GetBlockVerboseResult)(nil)},
+	"getblockchaininfo":     {(*cmmjson.GetBlockChainInfoResult)(nil)},
 	"getblockcount":         {(*int64)(nil)},
 	"getblockhash":          {(*string)(nil)},
 	"getblockheader":        {(*string)(nil), (*cmmjson.GetBlockHeaderVerboseResult)(nil)},
@@ -957,6 +1142,9 @@ var rpcResultTypes = map[string][]interface{}{
 	"gethashespersec":       {(*float64)(nil)},
 	"getheaders":            {(*cmmjson.GetHeadersResult)(nil)},
 	"getinfo":               {(*cmmjson.InfoChainResult)(nil)},
+	"getmempoolancestors":   {(*[]string)(nil), (*cmmjson.GetMempoolEntryResult)(nil)},
+	"getmempooldescendants": {(*[]string)(nil), (*cmmjson.GetMempoolEntryResult)(nil)},
+	"getmempoolentry":       {(*cmmjson.GetMempoolEntryResult)(nil)},
 	"getmempoolinfo":        {(*cmmjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":         {(*cmmjson.GetMiningInfoResult)(nil)},
 	"getnettotals":          {(*cmmjson.GetNetTotalsResult)(nil)},
@@ -966,18 +1154,25 @@ var rpcResultTypes = map[string][]interface{}{
 	"getrawtransaction":     {(*string)(nil), (*cmmjson.TxRawResult)(nil)},
 	"getticketpoolvalue":    {(*float64)(nil)},
 	"gettxout":              {(*cmmjson.GetTxOutResult)(nil)},
+	"gettxoutsetinfo":       {(*cmmjson.GetTxOutSetInfoResult)(nil)},
 	"getvoteinfo":           {(*cmmjson.GetVoteInfoResult)(nil)},
 	"getwork":               {(*cmmjson.GetWorkResult)(nil), (*bool)(nil)},
 	"getcoinsupply":         {(*int64)(nil)},
 	"help":                  {(*string)(nil), (*string)(nil)},
+	"invalidateblock":       nil,
+	"listbanned":            {(*[]cmmjson.ListBannedResult)(nil)},
 	"livetickets":           {(*cmmjson.LiveTicketsResult)(nil)},
 	"missedtickets":         {(*cmmjson.MissedTicketsResult)(nil)},
 	"node":                  nil,
 	"ping":                  nil,
 	"rebroadcastmissed":     nil,
 	"rebroadcastwinners":    nil,
+	"prioritisetransaction": {(*bool)(nil)},
+	"reconsiderblock":       nil,
+	"savemempool":           nil,
 	"searchrawtransactions": {(*string)(nil), (*[]cmmjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":    {(*string)(nil)},
+	"setban":                nil,
 	"setgenerate":           nil,
 	"stop":                  {(*string)(nil)},
 	"submitblock":           {nil, (*string)(nil)},
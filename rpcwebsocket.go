@@ -2197,6 +2197,9 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	for i := range blockHashes {
 		block, err := bc.BlockByHash(&blockHashes[i])
 		if err != nil {
+			if pruned, _ := bc.IsBlockPruned(&blockHashes[i]); pruned {
+				return nil, rpcBlockPrunedError(&blockHashes[i])
+			}
 			return nil, &cmmjson.RPCError{
 				Code:    cmmjson.ErrRPCBlockNotFound,
 				Message: "Failed to fetch block: " + err.Error(),
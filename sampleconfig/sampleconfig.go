@@ -59,6 +59,22 @@ const FileContents = `[Application Options]
 ; to correlate connections.
 ; torisolation=1
 
+; Create a Tor v3 onion service which forwards to the first listener via the
+; Tor control port and advertise its address to peers.  The onion service key is
+; saved in the data directory so the address remains the same across restarts.
+; Cookie authentication is used unless a control port password is specified.
+; torcontrol=127.0.0.1:9051
+; torpassword=
+
+; Connect to I2P destinations (.b32.i2p addresses) via the SOCKS5 proxy of a
+; local I2P router.  I2P addresses are neither relayed to nor connected to
+; unless an I2P proxy is set.
+; i2pproxy=127.0.0.1:4447
+
+; Treat addresses in the fc00::/8 range as CJDNS addresses.  Only set this when
+; the node is connected to the CJDNS network so such addresses are reachable.
+; cjdnsreachable=1
+
 ; Use Universal Plug and Play (UPnP) to automatically open the listen port
 ; and obtain the external IP address from supported devices.  NOTE: This option
 ; will have no effect if exernal IP addresses are specified.
@@ -113,6 +129,52 @@ const FileContents = `[Application Options]
 ; connect=fe80::1
 ; connect=[fe80::2]:9108
 
+; Support the encrypted and authenticated v2 P2P transport.  Outbound
+; connections attempt it first and fall back to the v1 protocol for peers that
+; do not support it, while inbound peers may use either.  Peers advertising
+; support for it are preferred when choosing outbound peers.
+; v2transport=1
+
+; Only connect to and accept peers that use the v2 P2P transport.  This implies
+; the v2transport option.
+; v2only=1
+
+; Relay transactions submitted via RPC with Dandelion++ so they are passed
+; along a random path of peers before being announced to the whole network,
+; which hides the node that created them.  This also relays stem transactions
+; for other peers which support Dandelion++.
+; dandelion=1
+
+; How often the Dandelion++ stem routes are changed.  Valid time units are
+; {s, m, h}.  Minimum 1 second.
+; dandelionepoch=10m
+
+; Limit the rate at which data is sent to and received from non-whitelisted
+; peers in KiB per second, both for all peers combined and for each peer.  The
+; rates are not limited by default.
+; maxuploadrate=1024
+; maxdownloadrate=4096
+; maxpeeruploadrate=256
+; maxpeerdownloadrate=1024
+
+; Try to keep the data sent to peers below the given number of MiB per 24 hours.
+; Once only enough of the target is left to relay the new blocks expected for
+; the rest of the 24 hours, blocks older than a week are no longer served to
+; non-whitelisted peers.  New blocks and transactions are still relayed, so the
+; target must be at least 216 MiB on the main network.  The target is unlimited
+; by default.
+; maxuploadtarget=5000
+
+; Record the messages sent to and received from peers with the given IPs or IP
+; networks for debugging.  The messages are written to rotating files in the
+; msgcapture directory of the data directory which can be decoded and replayed
+; with the msgcapture utility.  The maximum size of each file in MiB and the
+; maximum number of files to keep may also be set.
+; capturepeer=192.168.0.10
+; capturepeer=fd00::/16
+; capturemaxfilesize=16
+; capturemaxfiles=10
+
 ; Maximum number of inbound and outbound peers.
 ; maxpeers=8
 
@@ -247,6 +309,17 @@ const FileContents = `[Application Options]
 ; Limit orphan transaction pool to 1000 transactions.
 ; maxorphantx=1000
 
+; Limit the memory pool to 300 MiB of transactions.  The transactions paying
+; the lowest fee rates are evicted beyond it and the minimum fee required to
+; enter the pool is raised until it decays again.  A quarter of it is reserved
+; for stake transactions.  Set to 0 to disable.
+; maxmempool=300
+
+; Save the memory pool to mempool.dat in the data directory at shutdown and
+; periodically and reload it on startup.  The file is not loaded when the chain
+; tip it was saved at is too old.
+; persistmempool=1
+
 ; Do not accept transactions from remote peers.
 ; blocksonly=1
 
@@ -279,6 +352,17 @@ const FileContents = `[Application Options]
 ; addrindex=1
 
 
+; ------------------------------------------------------------------------------
+; Block Pruning
+; ------------------------------------------------------------------------------
+
+; Delete the oldest blocks once the stored blocks exceed the target size in MiB.
+; Recent blocks along with the data needed to handle reorganizations are always
+; kept.  Pruned nodes only serve recent blocks to other peers and can't be used
+; with the transaction or address indexes.  The minimum target is 550 MiB.
+; prune=2048
+
+
 ; ------------------------------------------------------------------------------
 ; Signature Verification Cache
 ; ------------------------------------------------------------------------------
@@ -325,6 +409,22 @@ const FileContents = `[Application Options]
 ; by the blackmaxsize option and will be limited as needed.
 ; blockprioritysize=50000
 
+; Enable the built-in stratum mining server for pool operators and miners by
+; specifying the interfaces to listen on.  The server speaks the Zcash flavour
+; of the stratum protocol and pays mined blocks to the mining addresses above.
+; The default port is 9112 for mainnet, 19112 for testnet and 19559 for simnet.
+; stratumlisten=                ; all interfaces on default port
+; stratumlisten=0.0.0.0:9112    ; all ipv4 interfaces on port 9112
+
+; Initial share difficulty assigned to each stratum miner, relative to the proof
+; of work limit of the network.  Miners may request a fixed share difficulty by
+; authorizing with a password of d=<difficulty>.
+; stratumdiff=1
+
+; Interval at which the share difficulty of each stratum miner is retargeted to
+; maintain a steady share rate.  Set to 0 to disable variable difficulty.
+; stratumvardiff=2m
+
 
 ; ------------------------------------------------------------------------------
 ; Debug
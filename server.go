@@ -7,12 +7,16 @@
 package main
 
 import (
+	"bufio"
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -23,6 +27,7 @@ import (
 	"github.com/CommerciumBlockchain/cmmd/addrmgr"
 	"github.com/CommerciumBlockchain/cmmd/blockchain"
 	"github.com/CommerciumBlockchain/cmmd/blockchain/indexers"
+	"github.com/CommerciumBlockchain/cmmd/blockchain/stake"
 	"github.com/CommerciumBlockchain/cmmd/bloom"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg"
 	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
@@ -51,13 +56,54 @@ const (
 	// target.
 	defaultTargetOutbound = 8
 
+	// defaultBlockRelayOnlyOutbound is the default number of outbound
+	// block-relay-only peers to target in addition to the outbound peers.
+	defaultBlockRelayOnlyOutbound = 2
+
 	// connectionRetryInterval is the base amount of time to wait in between
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
 
+	// feeFilterInterval is the interval at which the minimum fee rate of the
+	// memory pool is checked to update the fee filters sent to peers.
+	feeFilterInterval = time.Minute
+
+	// feeFilterMaxAge is the time after which a fee filter is sent to a
+	// peer again when the minimum fee rate only changed slightly.
+	feeFilterMaxAge = time.Minute * 10
+
 	// maxProtocolVersion is the max protocol version the server supports.
-	maxProtocolVersion = wire.NodeCFVersion
+	maxProtocolVersion = wire.AddrV2Version
+
+	// onionKeyFilename is the name of the file in the data directory which
+	// stores the key of the onion service created through the tor control
+	// port.
+	onionKeyFilename = "onion_v3_private_key"
+
+	// banListFilename is the name of the file in the data directory which
+	// stores the banned IP addresses and subnets.
+	banListFilename = "banlist.json"
+
+	// mempoolFilename is the name of the file in the data directory which
+	// stores the memory pool when it is persisted with --persistmempool or
+	// the savemempool RPC.
+	mempoolFilename = "mempool.dat"
+
+	// mempoolSaveInterval is the interval at which the memory pool is
+	// persisted when --persistmempool is set.
+	mempoolSaveInterval = time.Minute * 15
+
+	// maxPersistedMempoolAge is the maximum age of the chain tip a persisted
+	// memory pool was saved at for it to be reloaded on startup.  The
+	// transactions of an older memory pool are likely to have been mined or
+	// expired in the meantime.
+	maxPersistedMempoolAge = time.Hour * 24
+
+	// msgCaptureDirname is the name of the directory in the data directory
+	// which stores the captured messages of the peers selected with
+	// --capturepeer.
+	msgCaptureDirname = "msgcapture"
 )
 
 var (
@@ -105,12 +151,11 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -150,6 +195,7 @@ type server struct {
 	started       int32
 	shutdown      int32
 	shutdownSched int32
+	mempoolLoaded int32 // Set once a persisted memory pool is reloaded.
 
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
@@ -158,7 +204,10 @@ type server struct {
 	rpcServer            *rpcServer
 	blockManager         *blockManager
 	txMemPool            *mempool.TxPool
+	feeEstimator         *mempool.FeeEstimator
 	cpuMiner             *CPUMiner
+	stratumServer        *stratumServer
+	dandelion            *dandelionRelay
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
@@ -174,6 +223,31 @@ type server struct {
 	timeSource           blockchain.MedianTimeSource
 	services             wire.ServiceFlag
 
+	// evictionKey is the secret key used to choose the network groups of
+	// the inbound peers which are protected from eviction.
+	evictionKey [32]byte
+
+	// banList houses the banned IP addresses and subnets.  It persists
+	// across restarts.
+	banList *connmgr.BanList
+
+	// mempoolSaveMtx serializes writing the memory pool to the data
+	// directory.
+	mempoolSaveMtx sync.Mutex
+
+	// msgCapture records the messages of the peers selected with
+	// --capturepeer.  It is nil when no peers are selected.
+	msgCapture *peer.CaptureWriter
+
+	// sendLimiter and recvLimiter limit the combined rate at which bytes
+	// are sent to and received from non-whitelisted peers.  uploadTarget
+	// tracks the bytes sent to peers to stop serving historical blocks
+	// once the upload target is about to be reached.  They are nil when
+	// not enabled.
+	sendLimiter  *peer.RateLimiter
+	recvLimiter  *peer.RateLimiter
+	uploadTarget *uploadTarget
+
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
@@ -187,18 +261,27 @@ type server struct {
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
+	// The following variables must only be used atomically.
+	lastBlockTime int64 // Unix time of the last novel block from the peer.
+	lastTxTime    int64 // Unix time of the last novel tx from the peer.
+
 	*peer.Peer
 
 	connReq         *connmgr.ConnReq
 	server          *server
 	persistent      bool
+	blockRelayOnly  bool
 	continueHash    *chainhash.Hash
 	relayMtx        sync.Mutex
 	disableRelayTx  bool
 	isWhitelisted   bool
+	isCaptured      bool
+	feeFilter       int64
+	feeFilterSent   time.Time
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+	partialBlock    *partialBlock
 	filter          *bloom.Filter
 	knownAddresses  map[string]struct{}
 	banScore        connmgr.DynamicBanScore
@@ -255,16 +338,50 @@ func (sp *serverPeer) setDisableRelayTx(disable bool) {
 }
 
 // relayTxDisabled returns whether or not relaying of transactions for the given
-// peer is disabled.
+// peer is disabled.  Transactions are never relayed to block-relay-only peers.
 // It is safe for concurrent access.
 func (sp *serverPeer) relayTxDisabled() bool {
 	sp.relayMtx.Lock()
-	isDisabled := sp.disableRelayTx
+	isDisabled := sp.disableRelayTx || sp.blockRelayOnly
 	sp.relayMtx.Unlock()
 
 	return isDisabled
 }
 
+// setLastBlockTime records the passed time as the last time the peer sent a
+// novel block.
+// It is safe for concurrent access.
+func (sp *serverPeer) setLastBlockTime(t time.Time) {
+	atomic.StoreInt64(&sp.lastBlockTime, t.Unix())
+}
+
+// LastBlockTime returns the last time the peer sent a novel block, or the zero
+// time when it never did.
+// It is safe for concurrent access.
+func (sp *serverPeer) LastBlockTime() time.Time {
+	if t := atomic.LoadInt64(&sp.lastBlockTime); t != 0 {
+		return time.Unix(t, 0)
+	}
+	return time.Time{}
+}
+
+// setLastTxTime records the passed time as the last time the peer sent a novel
+// transaction.
+// It is safe for concurrent access.
+func (sp *serverPeer) setLastTxTime(t time.Time) {
+	atomic.StoreInt64(&sp.lastTxTime, t.Unix())
+}
+
+// LastTxTime returns the last time the peer sent a novel transaction, or the
+// zero time when it never did.
+// It is safe for concurrent access.
+func (sp *serverPeer) LastTxTime() time.Time {
+	if t := atomic.LoadInt64(&sp.lastTxTime); t != 0 {
+		return time.Unix(t, 0)
+	}
+	return time.Time{}
+}
+
 // pushAddrMsg sends an addr message to the connected peer using the provided
 // addresses.
 func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
@@ -338,6 +455,14 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *wire.MsgVersion) {
 	// is received.
 	sp.setDisableRelayTx(msg.DisableRelayTx)
 
+	// Ask the peer to announce new blocks with cmpctblock messages when it
+	// supports them so they can be rebuilt from the transactions that are
+	// already in the memory pool.
+	if p.ProtocolVersion() >= wire.CompactBlocksVersion {
+		p.QueueMessage(wire.NewMsgSendCmpct(true, wire.CmpctBlockVersion),
+			nil)
+	}
+
 	// Update the address manager and request known addresses from the
 	// remote peer for outbound connections.  This is skipped when running
 	// on the simulation test network since it is only intended to connect
@@ -345,8 +470,9 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *wire.MsgVersion) {
 	// discovered peers.
 	if !cfg.SimNet {
 		addrManager := sp.server.addrManager
-		// Outbound connections.
-		if !p.Inbound() {
+		// Outbound connections.  Addresses are not relayed to or from
+		// block-relay-only peers.
+		if !p.Inbound() && !sp.blockRelayOnly {
 			// TODO(davec): Only do this if not doing the initial block
 			// download and the local address is routable.
 			if !cfg.DisableListen /* && isCurrent? */ {
@@ -532,6 +658,14 @@ func (sp *serverPeer) OnTx(p *peer.Peer, msg *wire.MsgTx) {
 		return
 	}
 
+	// Block-relay-only peers were asked not to relay transactions.
+	if sp.blockRelayOnly {
+		peerLog.Infof("Block-relay-only peer %v sent tx %v -- "+
+			"disconnecting", p, msg.TxHash())
+		p.Disconnect()
+		return
+	}
+
 	// Add the transaction to the known inventory for the peer.
 	// Convert the raw MsgTx to a cmmutil.Tx which provides some convenience
 	// methods and things such as hash caching.
@@ -548,6 +682,28 @@ func (sp *serverPeer) OnTx(p *peer.Peer, msg *wire.MsgTx) {
 	<-sp.txProcessed
 }
 
+// OnDandelionTx is invoked when a peer receives a dandeliontx wire message.
+// The transaction is relayed along the stem when possible and is otherwise
+// processed the same way as a tx message, which also takes care of rejecting
+// it when it is invalid.  Transactions which double spend a stem transaction
+// are dropped since processing them would make them public instead.
+func (sp *serverPeer) OnDandelionTx(p *peer.Peer, msg *wire.MsgDandelionTx) {
+	if sp.server.dandelion != nil && !sp.blockRelayOnly {
+		tx := cmmutil.NewTx(msg.Tx)
+		stemmed, err := sp.server.dandelion.StemTransaction(tx, sp, false)
+		if stemmed {
+			return
+		}
+		if isStemConflict(err) {
+			peerLog.Debugf("Rejected stem transaction from %s: %v",
+				sp, err)
+			return
+		}
+	}
+
+	sp.OnTx(p, msg.Tx)
+}
+
 // OnBlock is invoked when a peer receives a block wire message.  It blocks
 // until the network block has been fully processed.
 func (sp *serverPeer) OnBlock(p *peer.Peer, msg *wire.MsgBlock, buf []byte) {
@@ -572,12 +728,64 @@ func (sp *serverPeer) OnBlock(p *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	<-sp.blockProcessed
 }
 
+// OnCmpctBlock is invoked when a peer receives a cmpctblock wire message.  The
+// compact block is queued to the block manager which rebuilds the block from
+// the memory pool and requests any missing transactions from the peer.
+func (sp *serverPeer) OnCmpctBlock(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+	// Add the block to the known inventory for the peer.
+	blockHash := msg.BlockHash()
+	iv := wire.NewInvVect(wire.InvTypeBlock, &blockHash)
+	p.AddKnownInventory(iv)
+
+	sp.server.blockManager.QueueCmpctBlock(msg, sp)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn wire message.  The
+// transactions are queued to the block manager to complete the block which is
+// being rebuilt from a previous cmpctblock message.
+func (sp *serverPeer) OnBlockTxn(p *peer.Peer, msg *wire.MsgBlockTxn) {
+	sp.server.blockManager.QueueBlockTxn(msg, sp)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn wire message.  It
+// responds with the requested transactions of both trees of the block so the
+// peer is able to complete a block it received as a cmpctblock message.
+func (sp *serverPeer) OnGetBlockTxn(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	block, err := sp.server.blockManager.chain.FetchBlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch requested block %v for "+
+			"getblocktxn from %v: %v", msg.BlockHash, p, err)
+		return
+	}
+
+	msgBlock := block.MsgBlock()
+	blockTxn := wire.NewMsgBlockTxn(&msg.BlockHash)
+	for _, index := range msg.Indexes {
+		if index >= uint32(len(msgBlock.Transactions)) {
+			sp.addBanScore(100, 0, "getblocktxn with invalid index")
+			return
+		}
+		blockTxn.Transactions = append(blockTxn.Transactions,
+			msgBlock.Transactions[index])
+	}
+	for _, index := range msg.SIndexes {
+		if index >= uint32(len(msgBlock.STransactions)) {
+			sp.addBanScore(100, 0, "getblocktxn with invalid stake "+
+				"index")
+			return
+		}
+		blockTxn.STransactions = append(blockTxn.STransactions,
+			msgBlock.STransactions[index])
+	}
+	p.QueueMessage(blockTxn, nil)
+}
+
 // OnInv is invoked when a peer receives an inv wire message and is used to
 // examine the inventory being advertised by the remote peer and react
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(p *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.blockRelayOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.blockManager.QueueInv(msg, sp)
 		}
@@ -618,6 +826,23 @@ func (sp *serverPeer) OnGetData(p *peer.Peer, msg *wire.MsgGetData) {
 		return
 	}
 
+	// Disconnect peers which request historical blocks once the upload
+	// target is about to be reached unless they are whitelisted.
+	if !sp.isWhitelisted && sp.server.uploadTarget.Reached(true, time.Now()) {
+		for _, iv := range msg.InvList {
+			if (iv.Type == wire.InvTypeBlock ||
+				iv.Type == wire.InvTypeFilteredBlock) &&
+				sp.server.isHistoricalBlock(&iv.Hash) {
+
+				peerLog.Infof("Upload target reached -- "+
+					"disconnecting peer %s requesting "+
+					"historical block %v", sp, iv.Hash)
+				sp.Disconnect()
+				return
+			}
+		}
+	}
+
 	numAdded := 0
 	notFound := wire.NewMsgNotFound()
 
@@ -1231,6 +1456,21 @@ func (sp *serverPeer) OnGetAddr(p *peer.Peer, msg *wire.MsgGetAddr) {
 // OnAddr is invoked when a peer receives an addr wire message and is used to
 // notify the server about advertised addresses.
 func (sp *serverPeer) OnAddr(p *peer.Peer, msg *wire.MsgAddr) {
+	sp.addAdvertisedAddresses(p, msg, msg.AddrList)
+}
+
+// OnAddrV2 is invoked when a peer receives an addrv2 wire message and is used
+// to notify the server about advertised addresses, including those of peers on
+// networks such as Tor v3, I2P and CJDNS.  Addresses on networks which are not
+// known are ignored by the address manager.
+func (sp *serverPeer) OnAddrV2(p *peer.Peer, msg *wire.MsgAddrV2) {
+	sp.addAdvertisedAddresses(p, msg, msg.AddrList)
+}
+
+// addAdvertisedAddresses adds the addresses advertised by the peer in the
+// passed addr or addrv2 message to the known addresses of the peer and the
+// server address manager.
+func (sp *serverPeer) addAdvertisedAddresses(p *peer.Peer, msg wire.Message, addrList []*wire.NetAddress) {
 	// Ignore addresses when running on the simulation test network.  This
 	// helps prevent the network from becoming another public test network
 	// since it will not be able to learn about other peers that have not
@@ -1239,15 +1479,21 @@ func (sp *serverPeer) OnAddr(p *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	// Ignore addresses from block-relay-only peers since they are not
+	// relayed over those connections.
+	if sp.blockRelayOnly {
+		return
+	}
+
 	// A message that has no addresses is invalid.
-	if len(msg.AddrList) == 0 {
+	if len(addrList) == 0 {
 		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
 			msg.Command(), p)
 		p.Disconnect()
 		return
 	}
 
-	for _, na := range msg.AddrList {
+	for _, na := range addrList {
 		// Don't add more address if we're disconnecting.
 		if !p.Connected() {
 			return
@@ -1270,7 +1516,7 @@ func (sp *serverPeer) OnAddr(p *peer.Peer, msg *wire.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, p.NA())
+	sp.server.addrManager.AddAddresses(addrList, p.NA())
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
@@ -1285,6 +1531,37 @@ func (sp *serverPeer) OnWrite(p *peer.Peer, bytesWritten int, msg wire.Message,
 	sp.server.AddBytesSent(uint64(bytesWritten))
 }
 
+// OnReadRaw is invoked when a peer selected with --capturepeer receives a
+// message, including messages which fail to decode, and it is used to record
+// the raw message in the message capture files.
+func (sp *serverPeer) OnReadRaw(p *peer.Peer, command string, payload []byte, err error) {
+	sp.captureMessage(peer.CaptureRecv, command, payload)
+}
+
+// OnWriteRaw is invoked when a message is sent to a peer selected with
+// --capturepeer and it is used to record the raw message in the message
+// capture files.
+func (sp *serverPeer) OnWriteRaw(p *peer.Peer, command string, payload []byte, err error) {
+	sp.captureMessage(peer.CaptureSent, command, payload)
+}
+
+// captureMessage records the passed raw message read from or written to the
+// peer in the message capture files.
+func (sp *serverPeer) captureMessage(direction peer.CaptureDirection, command string, payload []byte) {
+	err := sp.server.msgCapture.WriteRecord(&peer.CaptureRecord{
+		Timestamp:       time.Now(),
+		Direction:       direction,
+		Addr:            sp.Addr(),
+		ProtocolVersion: sp.ProtocolVersion(),
+		Command:         command,
+		Payload:         payload,
+	})
+	if err != nil {
+		peerLog.Errorf("Unable to capture %s message of peer %s: %v",
+			command, sp, err)
+	}
+}
+
 // randomUint16Number returns a random uint16 in a specified input range.  Note
 // that the range is in zeroth ordering; if you pass it 1800, you will get
 // values from 0 to 1800.
@@ -1330,6 +1607,12 @@ func (s *server) RemoveRebroadcastInventory(iv *wire.InvVect) {
 // transactions.  This function should be called whenever new transactions
 // are added to the mempool.
 func (s *server) AnnounceNewTransactions(newTxs []*cmmutil.Tx) {
+	// The transactions are public now, so neither they nor any stem
+	// transactions which double spend them remain in the stem pool.
+	if s.dandelion != nil {
+		s.dandelion.RemoveTransactions(newTxs)
+	}
+
 	// Generate and relay inventory vectors for all newly accepted
 	// transactions into the memory pool due to the original being
 	// accepted.
@@ -1346,6 +1629,13 @@ func (s *server) AnnounceNewTransactions(newTxs []*cmmutil.Tx) {
 			// about stale block templates due to the new transaction.
 			s.rpcServer.gbtWorkState.NotifyMempoolTx(
 				s.txMemPool.LastUpdated())
+
+			// Votes on the block the current block template builds
+			// on make the template stale right away.
+			if stake.IsSSGen(tx.MsgTx()) {
+				votedOn, _ := stake.SSGenBlockVotedOn(tx.MsgTx())
+				s.rpcServer.gbtWorkState.NotifyVote(&votedOn)
+			}
 		}
 	}
 }
@@ -1532,22 +1822,20 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd))
-			sp.Disconnect()
-			return false
-		}
-
-		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
+	if s.banList.IsBanned(net.ParseIP(host)) {
+		srvrLog.Debugf("Peer %s is banned - disconnecting", host)
+		sp.Disconnect()
+		return false
 	}
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if state.Count() >= cfg.MaxPeers {
+	// Limit max number of total peers.  An existing inbound peer is evicted
+	// to make room for a new inbound peer when possible so that an attacker
+	// can't take over all of the inbound slots by connecting first.
+	if state.Count() >= cfg.MaxPeers &&
+		(!sp.Inbound() || !s.evictInboundPeer(state)) {
+
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
 			cfg.MaxPeers, sp)
 		sp.Disconnect()
@@ -1568,10 +1856,53 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 			state.outboundPeers[sp.ID()] = sp
 		}
 	}
+	if s.dandelion != nil {
+		s.dandelion.AddPeer(sp)
+	}
 
 	return true
 }
 
+// evictInboundPeer disconnects an inbound peer selected by the eviction policy
+// to make room for a new inbound peer.  Whitelisted peers are never evicted.  It
+// returns whether or not a peer was evicted.  It is invoked from the
+// peerHandler goroutine.
+func (s *server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]*evictionCandidate, 0, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		if sp.isWhitelisted || !sp.Connected() {
+			continue
+		}
+		candidates = append(candidates, newEvictionCandidate(sp,
+			&s.evictionKey))
+	}
+	evict := selectPeerToEvict(candidates)
+	if evict == nil {
+		return false
+	}
+
+	srvrLog.Debugf("Evicting inbound peer %s to make room for a new peer",
+		evict.sp)
+	delete(state.inboundPeers, evict.sp.ID())
+	if s.dandelion != nil {
+		s.dandelion.RemovePeer(evict.sp)
+	}
+	evict.sp.Disconnect()
+	return true
+}
+
+// disconnectConnReq notifies the connection manager that the connection
+// request of the passed outbound peer is disconnected.  Peers which attempted
+// the v2 transport but failed to complete its handshake are reported as such so
+// the connection may be retried with the v1 protocol.
+func (s *server) disconnectConnReq(sp *serverPeer) {
+	if sp.connReq.V2Transport && !sp.V2Transport() {
+		s.connManager.DisconnectV2Failed(sp.connReq.ID())
+		return
+	}
+	s.connManager.Disconnect(sp.connReq.ID())
+}
+
 // handleDonePeerMsg deals with peers that have signalled they are done.  It is
 // invoked from the peerHandler goroutine.
 func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
@@ -1588,7 +1919,10 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
 		}
 		if !sp.Inbound() && sp.connReq != nil {
-			s.connManager.Disconnect(sp.connReq.ID())
+			s.disconnectConnReq(sp)
+		}
+		if s.dandelion != nil {
+			s.dandelion.RemovePeer(sp)
 		}
 		delete(list, sp.ID())
 		srvrLog.Debugf("Removed peer %s", sp)
@@ -1596,7 +1930,7 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 	}
 
 	if sp.connReq != nil {
-		s.connManager.Disconnect(sp.connReq.ID())
+		s.disconnectConnReq(sp)
 	}
 
 	// Update the address' last seen time if the peer has acknowledged
@@ -1617,32 +1951,70 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
 		return
 	}
+	subnet, err := connmgr.ParseSubnet(host)
+	if err != nil {
+		srvrLog.Debugf("can't ban peer %s %v", sp.Addr(), err)
+		return
+	}
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
+	err = s.banList.Ban(subnet, time.Now().Add(cfg.BanDuration))
+	if err != nil {
+		srvrLog.Errorf("Unable to save ban list: %v", err)
+	}
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	var cmpctBlock *wire.MsgCmpctBlock
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
 		}
 
+		// If the inventory is a block and the peer prefers compact
+		// blocks, generate and send a cmpctblock message instead of an
+		// inventory message unless the peer is already known to have
+		// the block, such as the peer it was received from.  The
+		// compact block is only created once for all peers.
+		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsCmpctBlocks() {
+			if sp.IsKnownInventory(msg.invVect) {
+				return
+			}
+			block, ok := msg.data.(*cmmutil.Block)
+			if !ok {
+				peerLog.Warnf("Underlying data for cmpctblock" +
+					" is not a block")
+				return
+			}
+			if cmpctBlock == nil {
+				// The nonce only serves to vary the short
+				// transaction IDs between announcements, so a
+				// failure to generate it is not fatal.
+				nonce, _ := wire.RandomUint64()
+				cmpctBlock = wire.NewMsgCmpctBlockFromBlock(
+					block.MsgBlock(), nonce)
+			}
+			sp.QueueMessage(cmpctBlock, nil)
+			sp.AddKnownInventory(msg.invVect)
+			return
+		}
+
 		// If the inventory is a block and the peer prefers headers,
 		// generate and send a headers message instead of an inventory
 		// message.
 		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
-			blockHeader, ok := msg.data.(wire.BlockHeader)
+			block, ok := msg.data.(*cmmutil.Block)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
-					" is not a block header")
+					" is not a block")
 				return
 			}
 			msgHeaders := wire.NewMsgHeaders()
-			if err := msgHeaders.AddBlockHeader(&blockHeader); err != nil {
+			err := msgHeaders.AddBlockHeader(&block.MsgBlock().Header)
+			if err != nil {
 				peerLog.Errorf("Failed to add block"+
 					" header: %v", err)
 				return
@@ -1698,6 +2070,36 @@ func (s *server) handleBroadcastMsg(state *peerState, bmsg *broadcastMsg) {
 	})
 }
 
+// handleFeeFilterUpdate sends the minimum fee rate of the memory pool, which is
+// never below the minimum relay fee, to peers in feefilter messages so they
+// don't announce transactions which would not be accepted.  It is only sent to
+// a peer again once it changed significantly or, when it changed slightly, once
+// the previous one is old enough.  It is invoked from the peerHandler
+// goroutine.
+func (s *server) handleFeeFilterUpdate(state *peerState) {
+	feeRate := int64(s.txMemPool.MinFeeRate())
+	if feeRate < int64(cfg.minRelayTxFee) {
+		feeRate = int64(cfg.minRelayTxFee)
+	}
+	now := time.Now()
+	state.forAllPeers(func(sp *serverPeer) {
+		if !sp.Connected() || sp.blockRelayOnly ||
+			sp.ProtocolVersion() < wire.FeeFilterVersion ||
+			sp.feeFilter == feeRate {
+
+			return
+		}
+
+		changed := feeRate*4 < sp.feeFilter*3 || feeRate*3 > sp.feeFilter*4
+		if !changed && now.Sub(sp.feeFilterSent) < feeFilterMaxAge {
+			return
+		}
+		sp.QueueMessage(wire.NewMsgFeeFilter(feeRate), nil)
+		sp.feeFilter = feeRate
+		sp.feeFilterSent = now
+	})
+}
+
 type getConnCountMsg struct {
 	reply chan int32
 }
@@ -1780,8 +2182,9 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 
 		// TODO: if too many, nuke a non-perm peer.
 		go s.connManager.Connect(&connmgr.ConnReq{
-			Addr:      netAddr,
-			Permanent: msg.permanent,
+			Addr:        netAddr,
+			Permanent:   msg.permanent,
+			V2Transport: cfg.V2Transport,
 		})
 		msg.reply <- nil
 	case removeNodeMsg:
@@ -1867,9 +2270,12 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 	return false
 }
 
-// newPeerConfig returns the configuration for the given serverPeer.
+// newPeerConfig returns the configuration for the given serverPeer.  The rate
+// at which bytes are sent to and received from the peer is limited unless it is
+// whitelisted.
 func newPeerConfig(sp *serverPeer) *peer.Config {
-	return &peer.Config{
+	const bytesPerKiB = 1024
+	peerCfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:        sp.OnVersion,
 			OnMemPool:        sp.OnMemPool,
@@ -1890,19 +2296,37 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnFilterLoad:     sp.OnFilterLoad,
 			OnGetAddr:        sp.OnGetAddr,
 			OnAddr:           sp.OnAddr,
+			OnAddrV2:         sp.OnAddrV2,
+			OnCmpctBlock:     sp.OnCmpctBlock,
+			OnGetBlockTxn:    sp.OnGetBlockTxn,
+			OnBlockTxn:       sp.OnBlockTxn,
+			OnDandelionTx:    sp.OnDandelionTx,
 			OnRead:           sp.OnRead,
 			OnWrite:          sp.OnWrite,
 		},
-		NewestBlock:      sp.newestBlock,
-		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
-		Proxy:            cfg.Proxy,
-		UserAgentName:    userAgentName,
-		UserAgentVersion: userAgentVersion,
-		ChainParams:      sp.server.chainParams,
-		Services:         sp.server.services,
-		DisableRelayTx:   cfg.BlocksOnly,
-		ProtocolVersion:  maxProtocolVersion,
-	}
+		NewestBlock:        sp.newestBlock,
+		HostToNetAddress:   sp.server.addrManager.HostToNetAddress,
+		Proxy:              cfg.Proxy,
+		UserAgentName:      userAgentName,
+		UserAgentVersion:   userAgentVersion,
+		ChainParams:        sp.server.chainParams,
+		Services:           sp.server.services,
+		DisableRelayTx:     cfg.BlocksOnly,
+		ProtocolVersion:    maxProtocolVersion,
+		V2Transport:        cfg.V2Transport,
+		RequireV2Transport: cfg.V2Only,
+	}
+	if !sp.isWhitelisted {
+		peerCfg.MaxSendRate = int64(cfg.MaxPeerUploadRate * bytesPerKiB)
+		peerCfg.MaxRecvRate = int64(cfg.MaxPeerDownloadRate * bytesPerKiB)
+		peerCfg.SendLimiter = sp.server.sendLimiter
+		peerCfg.RecvLimiter = sp.server.recvLimiter
+	}
+	if sp.isCaptured {
+		peerCfg.Listeners.OnReadRaw = sp.OnReadRaw
+		peerCfg.Listeners.OnWriteRaw = sp.OnWriteRaw
+	}
+	return peerCfg
 }
 
 // inboundPeerConnected is invoked by the connection manager when a new inbound
@@ -1910,8 +2334,15 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
+	if s.banList.IsBannedAddr(conn.RemoteAddr()) {
+		srvrLog.Debugf("Rejecting connection from banned peer %s",
+			conn.RemoteAddr())
+		conn.Close()
+		return
+	}
 	sp := newServerPeer(s, false)
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	sp.isCaptured = s.isCaptured(conn.RemoteAddr())
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
@@ -1923,15 +2354,27 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // request instance and the connection itself, and finally notifies the address
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
+	if s.banList.IsBannedAddr(conn.RemoteAddr()) {
+		srvrLog.Debugf("Disconnecting banned peer %s", c.Addr)
+		s.connManager.Disconnect(c.ID())
+		return
+	}
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	sp.blockRelayOnly = c.BlockRelayOnly
+	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	sp.isCaptured = s.isCaptured(conn.RemoteAddr())
+	peerCfg := newPeerConfig(sp)
+	peerCfg.V2Transport = c.V2Transport
+	if c.BlockRelayOnly {
+		peerCfg.DisableRelayTx = true
+	}
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
 		s.connManager.Disconnect(c.ID())
 	}
 	sp.Peer = p
 	sp.connReq = c
-	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 	s.addrManager.Attempt(sp.NA())
@@ -1950,6 +2393,26 @@ func (s *server) peerDoneHandler(sp *serverPeer) {
 	close(sp.quit)
 }
 
+// saveAnchors saves the addresses of the connected outbound block-relay-only
+// peers as anchors so the node reconnects to them at next run.  This makes it
+// harder for an attacker to eclipse the node by getting it to restart.  It is
+// invoked from the peerHandler goroutine.
+func (s *server) saveAnchors(state *peerState) {
+	var anchors []*wire.NetAddress
+	for _, sp := range state.outboundPeers {
+		if sp.blockRelayOnly && sp.Connected() &&
+			len(anchors) < defaultBlockRelayOnlyOutbound {
+
+			anchors = append(anchors, sp.NA())
+		}
+	}
+	if err := s.addrManager.SaveAnchors(anchors); err != nil {
+		srvrLog.Warnf("Unable to save anchor peers: %v", err)
+		return
+	}
+	srvrLog.Debugf("Saved %d anchor peers", len(anchors))
+}
+
 // peerHandler is used to handle peer operations such as adding and removing
 // peers to and from the server, banning peers, and broadcasting messages to
 // peers.  It must be run in a goroutine.
@@ -1968,7 +2431,6 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 
@@ -1985,6 +2447,8 @@ func (s *server) peerHandler() {
 	}
 	go s.connManager.Start()
 
+	feeFilterTicker := time.NewTicker(feeFilterInterval)
+
 out:
 	for {
 		select {
@@ -2016,7 +2480,15 @@ out:
 		case qmsg := <-s.query:
 			s.handleQuery(state, qmsg)
 
+			// Update the fee filters of peers.
+		case <-feeFilterTicker.C:
+			s.handleFeeFilterUpdate(state)
+
 		case <-s.quit:
+			// Save the block-relay-only peers as anchors to reconnect
+			// to at next run.
+			s.saveAnchors(state)
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
 				srvrLog.Tracef("Shutdown peer %s", sp)
@@ -2026,9 +2498,16 @@ out:
 		}
 	}
 
+	feeFilterTicker.Stop()
 	s.connManager.Stop()
 	s.blockManager.Stop()
 	s.addrManager.Stop()
+	if s.msgCapture != nil {
+		if err := s.msgCapture.Close(); err != nil {
+			srvrLog.Errorf("Unable to close message capture file: %v",
+				err)
+		}
+	}
 
 	// Drain channels before exiting so nothing is left waiting around
 	// to send.
@@ -2059,6 +2538,25 @@ func (s *server) BanPeer(sp *serverPeer) {
 	s.banPeers <- sp
 }
 
+// BanSubnet bans the passed IP address or subnet until the passed time and
+// disconnects the connected peers within it.
+func (s *server) BanSubnet(subnet *net.IPNet, until time.Time) error {
+	if err := s.banList.Ban(subnet, until); err != nil {
+		return err
+	}
+	for _, sp := range s.Peers() {
+		host, _, err := net.SplitHostPort(sp.Addr())
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && subnet.Contains(ip) {
+			srvrLog.Infof("Disconnecting banned peer %s", sp)
+			sp.Disconnect()
+		}
+	}
+	return nil
+}
+
 // RelayInventory relays the passed inventory vector to all connected peers
 // that are not already known to have it.
 func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
@@ -2177,6 +2675,7 @@ func (s *server) ConnectNode(addr string, permanent bool) error {
 // for the server.  It is safe for concurrent access.
 func (s *server) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	s.uploadTarget.AddBytesSent(bytesSent, time.Now())
 }
 
 // AddBytesReceived adds the passed number of bytes to the total bytes received
@@ -2185,6 +2684,19 @@ func (s *server) AddBytesReceived(bytesReceived uint64) {
 	atomic.AddUint64(&s.bytesReceived, bytesReceived)
 }
 
+// isHistoricalBlock returns whether or not the block with the passed hash is
+// older than historicalBlockAge relative to the best block.  Blocks which are
+// not known are not historical.  It is safe for concurrent access.
+func (s *server) isHistoricalBlock(hash *chainhash.Hash) bool {
+	chain := s.blockManager.chain
+	header, err := chain.FetchHeader(hash)
+	if err != nil {
+		return false
+	}
+	best := chain.BestSnapshot()
+	return best.MedianTime.Sub(header.Timestamp) > historicalBlockAge
+}
+
 // NetTotals returns the sum of all bytes received and sent across the network
 // for all peers.  It is safe for concurrent access.
 func (s *server) NetTotals() (uint64, uint64) {
@@ -2204,6 +2716,22 @@ func (s *server) UpdatePeerHeights(latestBlkHash *chainhash.Hash, latestHeight i
 	}
 }
 
+// verifyUtxoSnapshot verifies the block headers leading up to the utxo snapshot
+// the chain state was imported from, if any.  It must be run as a goroutine.
+func (s *server) verifyUtxoSnapshot() {
+	defer s.wg.Done()
+
+	err := s.blockManager.chain.VerifySnapshotHistory(s.quit)
+	if err != nil {
+		select {
+		case <-s.quit:
+		default:
+			srvrLog.Errorf("Unable to verify the utxo snapshot "+
+				"history: %v", err)
+		}
+	}
+}
+
 // rebroadcastHandler keeps track of user submitted inventories that we have
 // sent out but have not yet made it into a block. We periodically rebroadcast
 // them in case our peers restarted or otherwise lost track of them.
@@ -2281,6 +2809,20 @@ func (s *server) Start() {
 		go s.upnpUpdateThread()
 	}
 
+	// Create an onion service for the listener through the tor control port
+	// when requested.
+	if cfg.TorControl != "" && !cfg.DisableListen && len(cfg.Listeners) > 0 {
+		s.wg.Add(1)
+		go s.onionServiceHandler()
+	}
+
+	// Reload the memory pool of the previous run and persist it
+	// periodically when requested.
+	if cfg.PersistMempool {
+		s.wg.Add(1)
+		go s.mempoolPersistHandler()
+	}
+
 	if !cfg.DisableRPC {
 		s.wg.Add(1)
 
@@ -2295,6 +2837,24 @@ func (s *server) Start() {
 	if cfg.Generate {
 		s.cpuMiner.Start()
 	}
+
+	// Start the stratum server if it's enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Start()
+	}
+
+	// Start relaying transactions with Dandelion++ if it's enabled.
+	if s.dandelion != nil {
+		s.wg.Add(1)
+		go s.dandelion.handler()
+	}
+
+	// Verify the history leading up to an imported utxo snapshot in the
+	// background if requested.
+	if cfg.VerifyUtxoSnapshot {
+		s.wg.Add(1)
+		go s.verifyUtxoSnapshot()
+	}
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2313,11 +2873,25 @@ func (s *server) Stop() error {
 		s.cpuMiner.Stop()
 	}
 
+	// Shutdown the stratum server if it's enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Stop()
+	}
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC && s.rpcServer != nil {
 		s.rpcServer.Stop()
 	}
 
+	// Save fee estimator state in the database.
+	s.db.Update(func(tx database.Tx) error {
+		metadata := tx.Metadata()
+		metadata.Put([]byte(mempool.EstimateFeeDatabaseKey),
+			s.feeEstimator.Save())
+
+		return nil
+	})
+
 	// Signal the remaining goroutines to quit.
 	close(s.quit)
 	return nil
@@ -2475,6 +3049,200 @@ out:
 	s.wg.Done()
 }
 
+// onionServiceHandler creates a tor onion service which forwards to the first
+// listener through the tor control port and advertises it as a local address.
+// The onion service is removed when the server shuts down.  The key of the
+// onion service is saved to the data directory so that the same onion address
+// is used across restarts.
+//
+// It MUST be run as a goroutine.
+func (s *server) onionServiceHandler() {
+	defer s.wg.Done()
+
+	// Forward to the first listener.  Wildcard listeners also accept
+	// connections on the loopback interface.
+	host, port, err := net.SplitHostPort(cfg.Listeners[0])
+	if err != nil {
+		srvrLog.Warnf("Unable to create onion service for listener "+
+			"%s: %v", cfg.Listeners[0], err)
+		return
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	target := net.JoinHostPort(host, port)
+	virtPort, _ := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+
+	tc, err := connmgr.DialTorControl(cfg.TorControl)
+	if err != nil {
+		srvrLog.Warnf("Unable to connect to tor control port %s: %v",
+			cfg.TorControl, err)
+		return
+	}
+	defer tc.Close()
+	if err := tc.Authenticate(cfg.TorPassword); err != nil {
+		srvrLog.Warnf("Unable to authenticate with tor control port "+
+			"%s: %v", cfg.TorControl, err)
+		return
+	}
+
+	// Reuse the key of a previously created onion service when there is
+	// one.
+	keyFile := filepath.Join(cfg.DataDir, onionKeyFilename)
+	key := connmgr.TorNewOnionKey
+	if b, err := ioutil.ReadFile(keyFile); err == nil {
+		key = strings.TrimSpace(string(b))
+	} else if !os.IsNotExist(err) {
+		srvrLog.Warnf("Unable to read onion service key: %v", err)
+	}
+	serviceID, newKey, err := tc.AddOnion(key, uint16(virtPort), target)
+	if err != nil {
+		srvrLog.Warnf("Unable to create onion service: %v", err)
+		return
+	}
+	if newKey != "" {
+		err := ioutil.WriteFile(keyFile, []byte(newKey+"\n"), 0600)
+		if err != nil {
+			srvrLog.Warnf("Unable to save onion service key: %v", err)
+		}
+	}
+
+	onion := serviceID + ".onion"
+	na, err := s.addrManager.HostToNetAddress(onion, uint16(virtPort),
+		s.services)
+	if err == nil {
+		err = s.addrManager.AddLocalAddress(na, addrmgr.ManualPrio)
+	}
+	if err != nil {
+		srvrLog.Warnf("Unable to advertise onion service %s: %v", onion,
+			err)
+	} else {
+		srvrLog.Infof("Created onion service %s forwarding to %s",
+			addrmgr.NetAddressKey(na), target)
+	}
+
+	<-s.quit
+
+	if err := tc.DelOnion(serviceID); err != nil {
+		srvrLog.Warnf("Unable to remove onion service %s: %v", onion, err)
+	} else {
+		srvrLog.Debugf("Removed onion service %s", onion)
+	}
+}
+
+// saveMempool writes the transactions in the memory pool along with the
+// current best chain tip to the mempool file in the data directory.
+func (s *server) saveMempool() error {
+	s.mempoolSaveMtx.Lock()
+	defer s.mempoolSaveMtx.Unlock()
+
+	best := s.blockManager.chain.BestSnapshot()
+
+	// Write temporary mempool file and then move it into place.
+	filename := filepath.Join(cfg.DataDir, mempoolFilename)
+	tmpfile := filename + ".new"
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = s.txMemPool.Persist(w, &best.Hash, best.Height)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, filename)
+}
+
+// loadMempool processes the transactions of the mempool file in the data
+// directory with the current policy.  The file is skipped when the chain tip it
+// was saved at is no longer part of the main chain or is too old.
+func (s *server) loadMempool() error {
+	filename := filepath.Join(cfg.DataDir, mempoolFilename)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	persisted, err := mempool.ReadPersisted(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", filename, err)
+	}
+
+	chain := s.blockManager.chain
+	hasTip, err := chain.MainChainHasBlock(&persisted.TipHash)
+	if err != nil {
+		return err
+	}
+	if !hasTip {
+		srvrLog.Infof("Not reloading the memory pool since the chain "+
+			"tip %v it was saved at is not in the main chain",
+			persisted.TipHash)
+		return nil
+	}
+	tip, err := chain.BlockByHash(&persisted.TipHash)
+	if err != nil {
+		return err
+	}
+	tipAge := time.Since(tip.MsgBlock().Header.Timestamp)
+	if tipAge > maxPersistedMempoolAge {
+		srvrLog.Infof("Not reloading the memory pool since the chain "+
+			"tip %v (height %d) it was saved at is too old",
+			persisted.TipHash, persisted.TipHeight)
+		return nil
+	}
+
+	accepted := s.txMemPool.LoadPersisted(persisted)
+	srvrLog.Infof("Reloaded %d of %d transactions into the memory pool",
+		len(accepted), len(persisted.Txns))
+	s.AnnounceNewTransactions(accepted)
+	return nil
+}
+
+// mempoolPersistHandler reloads the memory pool persisted by the previous run
+// and then persists the memory pool periodically and when the server shuts
+// down.
+//
+// It MUST be run as a goroutine.
+func (s *server) mempoolPersistHandler() {
+	defer s.wg.Done()
+
+	if err := s.loadMempool(); err != nil {
+		srvrLog.Errorf("Unable to reload the memory pool: %v", err)
+	}
+	atomic.StoreInt32(&s.mempoolLoaded, 1)
+
+	ticker := time.NewTicker(mempoolSaveInterval)
+	defer ticker.Stop()
+out:
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.saveMempool(); err != nil {
+				srvrLog.Errorf("Unable to save the memory pool: %v",
+					err)
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	if err := s.saveMempool(); err != nil {
+		srvrLog.Errorf("Unable to save the memory pool: %v", err)
+	}
+}
+
 // standardScriptVerifyFlags returns the script flags that should be used when
 // executing transaction scripts to enforce additional checks which are required
 // for the script to be considered standard.  Note these flags are different
@@ -2496,8 +3264,19 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.Prune != 0 {
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
+	if cfg.V2Transport {
+		services |= wire.SFNodeV2Transport
+	}
+	if cfg.Dandelion {
+		services |= wire.SFNodeDandelion
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, cmmdLookup)
+	amgr.SetCJDNSReachable(cfg.CJDNSReachable)
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2645,6 +3424,38 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
 	}
 
+	if _, err := rand.Read(s.evictionKey[:]); err != nil {
+		return nil, err
+	}
+
+	s.banList = connmgr.NewBanList(filepath.Join(cfg.DataDir, banListFilename))
+	if err := s.banList.Load(); err != nil {
+		srvrLog.Warnf("Unable to load ban list: %v", err)
+	}
+
+	if len(cfg.capturePeers) > 0 {
+		const bytesPerMiB = 1024 * 1024
+		msgCapture, err := peer.NewCaptureWriter(
+			filepath.Join(cfg.DataDir, msgCaptureDirname),
+			chainParams.Net, cfg.CaptureMaxFileSize*bytesPerMiB,
+			cfg.CaptureMaxFiles)
+		if err != nil {
+			return nil, err
+		}
+		s.msgCapture = msgCapture
+	}
+
+	// Create the limiters of the combined rate at which bytes are sent to
+	// and received from peers and the upload target.  Enough of the upload
+	// target is kept in reserve to relay the largest possible blocks.
+	const bytesPerKiB, bytesPerMiB = 1024, 1024 * 1024
+	s.sendLimiter = peer.NewRateLimiter(int64(cfg.MaxUploadRate * bytesPerKiB))
+	s.recvLimiter = peer.NewRateLimiter(int64(cfg.MaxDownloadRate * bytesPerKiB))
+	maxBlockSizes := chainParams.MaximumBlockSizes
+	s.uploadTarget = newUploadTarget(cfg.MaxUploadTarget*bytesPerMiB,
+		chainParams.TargetTimePerBlock,
+		uint64(maxBlockSizes[len(maxBlockSizes)-1]))
+
 	// Create the transaction and address indexes if needed.
 	//
 	// CAUTION: the txindex needs to be first in the indexes array because
@@ -2693,6 +3504,36 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 	s.blockManager = bm
 
+	// Search for a FeeEstimator state in the database. If none can be found
+	// or if it cannot be loaded, create a new one.
+	db.Update(func(tx database.Tx) error {
+		metadata := tx.Metadata()
+		feeEstimationData := metadata.Get([]byte(mempool.EstimateFeeDatabaseKey))
+		if feeEstimationData != nil {
+			// Delete it from the database so that we don't try to
+			// restore the same thing again somehow.
+			metadata.Delete([]byte(mempool.EstimateFeeDatabaseKey))
+
+			// If there is an error, log it and make a new fee
+			// estimator.
+			var err error
+			s.feeEstimator, err = mempool.RestoreFeeEstimator(feeEstimationData)
+			if err != nil {
+				srvrLog.Errorf("Failed to restore fee estimator: %v", err)
+			}
+		}
+
+		return nil
+	})
+
+	// If no feeEstimator has been found, or if the one that has been found
+	// is behind somehow, create a new one and start over.
+	if s.feeEstimator == nil ||
+		s.feeEstimator.LastKnownHeight() > bm.chain.BestSnapshot().Height {
+		s.feeEstimator = mempool.NewFeeEstimator(
+			mempool.DefaultEstimateFeeMaxConfirms)
+	}
+
 	txC := mempool.Config{
 		Policy: mempool.Policy{
 			MaxTxVersion:         2,
@@ -2701,6 +3542,9 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
 			MaxOrphanTxs:         cfg.MaxOrphanTxs,
 			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
+			MaxPoolSize:          cfg.MaxMempool * bytesPerMiB,
+			MaxAncestorCount:     mempool.DefaultMaxAncestorCount,
+			MaxDescendantCount:   mempool.DefaultMaxDescendantCount,
 			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
 			MinRelayTxFee:        cfg.minRelayTxFee,
 			AllowOldVotes:        cfg.AllowOldVotes,
@@ -2725,8 +3569,12 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		PastMedianTime:   func() time.Time { return bm.chain.BestSnapshot().MedianTime },
 		AddrIndex:        s.addrIndex,
 		ExistsAddrIndex:  s.existsAddrIndex,
+		FeeEstimator:     s.feeEstimator,
 	}
 	s.txMemPool = mempool.New(&txC)
+	if cfg.Dandelion {
+		s.dandelion = newDandelionRelay(&s, cfg.DandelionEpoch)
+	}
 
 	// Create the mining policy based on the configuration options.
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
@@ -2765,6 +3613,25 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 					continue
 				}
 
+				// Skip addresses on networks which can't be
+				// reached with the configured proxies.
+				if !isReachable(addr.NetAddress()) {
+					continue
+				}
+
+				// Skip banned addresses.
+				if s.banList.IsBanned(addr.NetAddress().IP) {
+					continue
+				}
+
+				// Only connect to peers that advertise support for
+				// the v2 transport when it is required and prefer
+				// them for the first 30 tries when it is enabled.
+				v2 := addr.NetAddress().Services&wire.SFNodeV2Transport != 0
+				if !v2 && (cfg.V2Only || (cfg.V2Transport && tries < 30)) {
+					continue
+				}
+
 				// only allow recent nodes (10mins) after we failed 30
 				// times
 				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
@@ -2785,19 +3652,41 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}
 	}
 
-	// Create a connection manager.
+	// Create a connection manager.  Block-relay-only peers are only
+	// connected to automatically along with the anchors from the previous
+	// run when they fit within the max peers.
 	targetOutbound := defaultTargetOutbound
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	var targetBlockRelayOnly int
+	var anchors []net.Addr
+	if newAddressFunc != nil {
+		targetBlockRelayOnly = defaultBlockRelayOnlyOutbound
+		if cfg.MaxPeers-targetOutbound < targetBlockRelayOnly {
+			targetBlockRelayOnly = cfg.MaxPeers - targetOutbound
+		}
+		anchors = loadAnchors(amgr)
+	}
+	transportPolicy := connmgr.TransportV1
+	if cfg.V2Only {
+		transportPolicy = connmgr.TransportRequireV2
+	} else if cfg.V2Transport {
+		transportPolicy = connmgr.TransportPreferV2
+	}
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		OnAccept:       s.inboundPeerConnected,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
-		Dial:           cmmdDial,
-		OnConnection:   s.outboundPeerConnected,
-		GetNewAddress:  newAddressFunc,
+		Listeners:            listeners,
+		OnAccept:             s.inboundPeerConnected,
+		RetryDuration:        connectionRetryInterval,
+		TargetOutbound:       uint32(targetOutbound),
+		TargetBlockRelayOnly: uint32(targetBlockRelayOnly),
+		Anchors:              anchors,
+		Dial:                 cmmdDial,
+		ProxyDial:            cmmdProxyDial,
+		OnConnection:         s.outboundPeerConnected,
+		GetNewAddress:        newAddressFunc,
+		TransportPolicy:      transportPolicy,
+		BanList:              s.banList,
 	})
 	if err != nil {
 		return nil, err
@@ -2816,8 +3705,9 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}
 
 		go s.connManager.Connect(&connmgr.ConnReq{
-			Addr:      tcpAddr,
-			Permanent: true,
+			Addr:        tcpAddr,
+			Permanent:   true,
+			V2Transport: cfg.V2Transport,
 		})
 	}
 
@@ -2834,18 +3724,82 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}()
 	}
 
+	if len(cfg.StratumListeners) > 0 {
+		s.stratumServer, err = newStratumServer(cfg.StratumListeners,
+			&policy, &s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &s, nil
 }
 
+// loadAnchors returns the addresses of the anchor peers saved during the
+// previous run which can be reached with the configured proxies.
+func loadAnchors(amgr *addrmgr.AddrManager) []net.Addr {
+	nas, err := amgr.LoadAnchors()
+	if err != nil {
+		srvrLog.Warnf("Unable to load anchor peers: %v", err)
+		return nil
+	}
+	var anchors []net.Addr
+	for _, na := range nas {
+		if !isReachable(na) {
+			continue
+		}
+		addr, err := addrStringToNetAddr(addrmgr.NetAddressKey(na))
+		if err != nil {
+			srvrLog.Debugf("Skipping anchor peer %s: %v",
+				addrmgr.NetAddressKey(na), err)
+			continue
+		}
+		anchors = append(anchors, addr)
+	}
+	if len(anchors) > 0 {
+		srvrLog.Infof("Reconnecting to %d anchor peers", len(anchors))
+	}
+	return anchors
+}
+
+// isReachable returns whether or not peers at the passed address can be
+// connected to given the configured proxies.  Tor addresses require Tor to be
+// enabled along with a proxy, I2P addresses require an I2P proxy, and CJDNS
+// addresses must be explicitly enabled.  Addresses on unknown networks are
+// never reachable.
+func isReachable(na *wire.NetAddress) bool {
+	switch na.NetworkID() {
+	case wire.NetworkIPv4, wire.NetworkIPv6:
+		return true
+	case wire.NetworkTorV2, wire.NetworkTorV3:
+		return !cfg.NoOnion && (cfg.OnionProxy != "" || cfg.Proxy != "")
+	case wire.NetworkI2P:
+		return cfg.I2PProxy != ""
+	case wire.NetworkCJDNS:
+		return cfg.CJDNSReachable
+	}
+	return false
+}
+
 // addrStringToNetAddr takes an address in the form of 'host:port' and returns
 // a net.Addr which maps to the original address with any host names resolved
-// to IP addresses.
+// to IP addresses.  Tor and I2P host names can't be resolved, so a proxy
+// address which is dialed through the proxy for the network is returned for
+// them instead.
 func addrStringToNetAddr(addr string) (net.Addr, error) {
 	host, strPort, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
 
+	if strings.HasSuffix(host, ".onion") || strings.HasSuffix(host, ".i2p") {
+		port, err := strconv.ParseUint(strPort, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		return &connmgr.ProxyAddr{Host: host, Port: uint16(port)}, nil
+	}
+
 	// Attempt to look up an IP address associated with the parsed host.
 	// The cmmdLookup function will transparently handle performing the
 	// lookup over Tor if necessary.
@@ -2915,3 +3869,27 @@ func isWhitelisted(addr net.Addr) bool {
 	}
 	return false
 }
+
+// isCaptured returns whether the messages of the peer with the passed address
+// are recorded because its IP address is included in the networks and IPs
+// selected with --capturepeer.
+func (s *server) isCaptured(addr net.Addr) bool {
+	if s.msgCapture == nil {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range cfg.capturePeers {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/addrmgr"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/peer"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestAddrV2Negotiation ensures peers using the server peer configuration
+// advertise a protocol version which supports addrv2, ask the remote node to
+// relay addresses with addrv2 messages before their verack, and honor the same
+// request from the remote node, for both inbound and outbound connections.
+func TestAddrV2Negotiation(t *testing.T) {
+	defer func(c *config) { cfg = c }(cfg)
+	cfg = &config{}
+	params := &chaincfg.SimNetParams
+	s := &server{
+		chainParams: params,
+		addrManager: addrmgr.New("", net.LookupIP),
+		services:    wire.SFNodeNetwork,
+	}
+
+	// remoteNode plays the remote side of the handshake over the passed
+	// connection, sending its version message first when it initiated the
+	// connection.  It sends its version, sendaddrv2 and verack messages and
+	// reports whether the server peer sent a sendaddrv2 message before its
+	// verack.
+	remoteNode := func(conn net.Conn, outbound bool) (bool, error) {
+		pver := wire.AddrV2Version
+		writeVersion := func() error {
+			me, err := wire.NewNetAddress(conn.LocalAddr(), 0)
+			if err != nil {
+				return err
+			}
+			you, err := wire.NewNetAddress(conn.RemoteAddr(), 0)
+			if err != nil {
+				return err
+			}
+			msg := wire.NewMsgVersion(me, you, 0x7e57, 0)
+			msg.ProtocolVersion = int32(pver)
+			return wire.WriteMessage(conn, msg, pver, params.Net)
+		}
+		if outbound {
+			if err := writeVersion(); err != nil {
+				return false, err
+			}
+		}
+		msg, _, err := wire.ReadMessage(conn, pver, params.Net)
+		if err != nil {
+			return false, err
+		}
+		verMsg, ok := msg.(*wire.MsgVersion)
+		if !ok {
+			return false, fmt.Errorf("unexpected first message %T", msg)
+		}
+		if verMsg.ProtocolVersion != int32(pver) {
+			return false, fmt.Errorf("unexpected advertised protocol "+
+				"version -- got %d, want %d", verMsg.ProtocolVersion,
+				pver)
+		}
+		if !outbound {
+			if err := writeVersion(); err != nil {
+				return false, err
+			}
+		}
+		err = wire.WriteMessage(conn, wire.NewMsgSendAddrV2(), pver,
+			params.Net)
+		if err != nil {
+			return false, err
+		}
+		err = wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, params.Net)
+		if err != nil {
+			return false, err
+		}
+
+		var sendAddrV2 bool
+		for {
+			msg, _, err := wire.ReadMessage(conn, pver, params.Net)
+			if err != nil {
+				return false, err
+			}
+			switch msg.(type) {
+			case *wire.MsgSendAddrV2:
+				sendAddrV2 = true
+			case *wire.MsgVerAck:
+				return sendAddrV2, nil
+			}
+		}
+	}
+
+	for _, inbound := range []bool{true, false} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unable to listen: %v", err)
+		}
+		remoteConn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("unable to dial: %v", err)
+		}
+		localConn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			t.Fatalf("unable to accept: %v", err)
+		}
+
+		// Use the peer configuration of the server with the message
+		// handling replaced by a notification once the remote verack is
+		// received.
+		verAck := make(chan struct{}, 1)
+		peerCfg := newPeerConfig(newServerPeer(s, false))
+		peerCfg.NewestBlock = nil
+		peerCfg.Listeners = peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verAck <- struct{}{}
+			},
+		}
+		var p *peer.Peer
+		if inbound {
+			p = peer.NewInboundPeer(peerCfg)
+		} else {
+			p, err = peer.NewOutboundPeer(peerCfg,
+				localConn.RemoteAddr().String())
+			if err != nil {
+				t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+			}
+		}
+		p.AssociateConnection(localConn)
+
+		remoteConn.SetDeadline(time.Now().Add(time.Second * 5))
+		sentAddrV2, err := remoteNode(remoteConn, inbound)
+		if err != nil {
+			t.Fatalf("inbound %v: handshake failed: %v", inbound, err)
+		}
+		if !sentAddrV2 {
+			t.Fatalf("inbound %v: no sendaddrv2 message sent before "+
+				"verack", inbound)
+		}
+		select {
+		case <-verAck:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("inbound %v: verack timeout", inbound)
+		}
+		if pver := p.ProtocolVersion(); pver != wire.AddrV2Version {
+			t.Fatalf("inbound %v: unexpected protocol version -- got "+
+				"%d, want %d", inbound, pver, wire.AddrV2Version)
+		}
+		if !p.WantsAddrV2() {
+			t.Fatalf("inbound %v: addrv2 relay was not negotiated",
+				inbound)
+		}
+		p.Disconnect()
+		remoteConn.Close()
+	}
+}
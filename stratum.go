@@ -0,0 +1,981 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/blockchain"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/cmmutil"
+	"github.com/CommerciumBlockchain/cmmd/equihash"
+	"github.com/CommerciumBlockchain/cmmd/mining"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// The stratum server speaks the Zcash flavour of the stratum mining protocol
+// with the following adaptations for Commercium block headers:
+//
+// The 32-byte nonce of the Zcash dialect is the ExtraData field of the block
+// header.  The server assigns the first stratumNonce1Len bytes (NONCE_1) to
+// each connection and miners fill in the remaining bytes (NONCE_2).  The
+// 4-byte header nonce is always zero for stratum jobs.  The Equihash input is
+// therefore the version, previous block, merkle root, bits, time and extra
+// data fields followed by the zero header nonce.
+//
+// The reserved field of mining.notify carries the stake root and a ninth
+// parameter carries the full serialized header template so miners are able to
+// compute the block hash of their solutions and compare it to the share
+// target.
+const (
+	// stratumNonce1Len is the number of bytes of the header extra data
+	// which are assigned to each connection by the server.
+	stratumNonce1Len = 4
+
+	// stratumNonce2Len is the number of bytes of the header extra data
+	// which are filled in by miners.
+	stratumNonce2Len = 32 - stratumNonce1Len
+
+	// stratumMaxRequestLen is the maximum number of bytes a single request
+	// line may contain.  Requests are small, so anything larger is treated
+	// as a protocol violation and the client is disconnected.
+	stratumMaxRequestLen = 8192
+
+	// stratumIdleTimeout is the amount of time a client may remain silent
+	// before it is disconnected.
+	stratumIdleTimeout = time.Minute * 10
+
+	// stratumWriteTimeout is the amount of time a client has to read a
+	// message before it is disconnected.  Messages are sent to the clients
+	// one after the other, so a client which stops reading would otherwise
+	// hold up new jobs for every other client.
+	stratumWriteTimeout = time.Second * 10
+
+	// stratumJobRefreshInterval is how often the memory pool is checked for
+	// updates which warrant sending miners a new job for the same tip.
+	stratumJobRefreshInterval = time.Second * 30
+
+	// stratumMaxJobs is the maximum number of jobs against which shares
+	// are still accepted when the chain tip has not changed.
+	stratumMaxJobs = 8
+
+	// stratumTargetShareTime is the average time between shares from a
+	// single connection the variable difficulty retargeting aims for.
+	stratumTargetShareTime = time.Second * 15
+
+	// stratumVarDiffMaxFactor is the maximum factor by which the share
+	// difficulty of a connection may change in a single retarget.
+	stratumVarDiffMaxFactor = 4.0
+
+	// stratumMaxFutureTime is the maximum amount of time a submitted share
+	// timestamp may be ahead of the current time.  It matches the limit
+	// the chain enforces for blocks.
+	stratumMaxFutureTime = time.Hour * 2
+)
+
+// Stratum error codes as used by the reference stratum implementations.
+const (
+	stratumErrOther         = 20
+	stratumErrJobNotFound   = 21
+	stratumErrDuplicate     = 22
+	stratumErrLowDifficulty = 23
+	stratumErrUnauthorized  = 24
+	stratumErrNotSubscribed = 25
+)
+
+// maxShareTarget is the easiest possible share target.  Share difficulties
+// below one result in targets above the proof of work limit of the network,
+// so targets are capped to the largest 256-bit value instead.
+var maxShareTarget = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256),
+	big.NewInt(1))
+
+// stratumRequest describes a request received from a stratum client.
+type stratumRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumResponse describes the reply to a stratum request.
+type stratumResponse struct {
+	ID     interface{}   `json:"id"`
+	Result interface{}   `json:"result"`
+	Error  *stratumError `json:"error"`
+}
+
+// stratumNotification describes a server initiated stratum message such as
+// mining.notify and mining.set_target.
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumError describes an error returned to a stratum client.  It is
+// marshalled as the [code, message, traceback] triple stratum clients expect.
+type stratumError struct {
+	Code    int
+	Message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *stratumError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// MarshalJSON marshals the error as a [code, message, null] triple.
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Code, e.Message, nil})
+}
+
+// newStratumError returns a stratum error with the provided code and message.
+func newStratumError(code int, format string, args ...interface{}) *stratumError {
+	return &stratumError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// stratumJob houses a block template which has been handed out to miners.
+type stratumJob struct {
+	id     string
+	block  *wire.MsgBlock
+	target *big.Int
+}
+
+// notifyParams returns the parameters of the mining.notify message for the
+// job.
+func (j *stratumJob) notifyParams(cleanJobs bool) []interface{} {
+	header := &j.block.Header
+
+	var version, timestamp, bits [4]byte
+	littleEndian.PutUint32(version[:], uint32(header.Version))
+	littleEndian.PutUint32(timestamp[:], uint32(header.Timestamp.Unix()))
+	littleEndian.PutUint32(bits[:], header.Bits)
+
+	// Serializing the header can't fail except being out of memory which
+	// would cause a run-time panic.
+	headerBytes, _ := header.Bytes()
+
+	return []interface{}{
+		j.id,
+		hex.EncodeToString(version[:]),
+		hex.EncodeToString(header.PrevBlock[:]),
+		hex.EncodeToString(header.MerkleRoot[:]),
+		hex.EncodeToString(header.StakeRoot[:]),
+		hex.EncodeToString(timestamp[:]),
+		hex.EncodeToString(bits[:]),
+		cleanJobs,
+		hex.EncodeToString(headerBytes),
+	}
+}
+
+// stratumDifficultyToTarget converts a share difficulty to the share target
+// it represents.  A difficulty of one is the proof of work limit of the
+// network.
+func stratumDifficultyToTarget(difficulty float64, powLimit *big.Int) *big.Int {
+	t := new(big.Float).SetInt(powLimit)
+	t.Quo(t, big.NewFloat(difficulty))
+	target, _ := t.Int(nil)
+	if target.Cmp(maxShareTarget) > 0 {
+		return new(big.Int).Set(maxShareTarget)
+	}
+	if target.Sign() <= 0 {
+		return big.NewInt(1)
+	}
+	return target
+}
+
+// stratumRetarget returns the share difficulty a connection should use given
+// its current difficulty and the number of shares it submitted over the
+// elapsed time.  The difficulty moves by at most stratumVarDiffMaxFactor in
+// either direction and is left alone when the share rate is within 25% of the
+// target rate.
+func stratumRetarget(difficulty float64, shares uint32, elapsed time.Duration) float64 {
+	expected := elapsed.Seconds() / stratumTargetShareTime.Seconds()
+	if expected <= 0 {
+		return difficulty
+	}
+
+	ratio := float64(shares) / expected
+	if ratio > 0.8 && ratio < 1.25 {
+		return difficulty
+	}
+	if ratio < 1/stratumVarDiffMaxFactor {
+		ratio = 1 / stratumVarDiffMaxFactor
+	}
+	if ratio > stratumVarDiffMaxFactor {
+		ratio = stratumVarDiffMaxFactor
+	}
+	return difficulty * ratio
+}
+
+// parseStratumDifficulty returns the share difficulty requested through the
+// password of a mining.authorize request.  Miners may request a difficulty
+// with a comma separated "d=<difficulty>" option.  False is returned when no
+// valid difficulty was requested.
+func parseStratumDifficulty(password string) (float64, bool) {
+	for _, option := range strings.Split(password, ",") {
+		option = strings.TrimSpace(option)
+		if !strings.HasPrefix(option, "d=") {
+			continue
+		}
+		difficulty, err := strconv.ParseFloat(option[2:], 64)
+		if err != nil || difficulty <= 0 {
+			return 0, false
+		}
+		return difficulty, true
+	}
+	return 0, false
+}
+
+// stratumClient houses the state of a single stratum connection.
+type stratumClient struct {
+	server   *stratumServer
+	conn     net.Conn
+	addr     string
+	nonce1   [stratumNonce1Len]byte
+	writeMtx sync.Mutex
+
+	// The following fields are protected by mtx.
+	mtx          sync.Mutex
+	subscribed   bool
+	authorized   bool
+	workers      map[string]struct{}
+	difficulty   float64
+	fixedDiff    bool
+	target       *big.Int
+	sendWork     bool
+	shares       uint32
+	lastRetarget time.Time
+	submitted    map[chainhash.Hash]struct{}
+}
+
+// send marshals and writes the passed message to the client.  The client is
+// disconnected when the message can't be written within stratumWriteTimeout.
+//
+// This function is safe for concurrent access.
+func (c *stratumClient) send(msg interface{}) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	if _, err := c.conn.Write(b); err != nil {
+		// Closing the connection stops the client handler, which
+		// removes the client from the server.
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// sendTarget sends a mining.set_target message with the passed share target.
+func (c *stratumClient) sendTarget(target *big.Int) error {
+	return c.send(&stratumNotification{
+		Method: "mining.set_target",
+		Params: []interface{}{fmt.Sprintf("%064x", target)},
+	})
+}
+
+// sendJob sends a mining.notify message for the passed job.
+func (c *stratumClient) sendJob(job *stratumJob, cleanJobs bool) error {
+	if cleanJobs {
+		c.mtx.Lock()
+		c.submitted = make(map[chainhash.Hash]struct{})
+		c.mtx.Unlock()
+	}
+	return c.send(&stratumNotification{
+		Method: "mining.notify",
+		Params: job.notifyParams(cleanJobs),
+	})
+}
+
+// setDifficulty updates the share difficulty and target of the client.
+//
+// This function MUST be called with the client mutex held (for writes).
+func (c *stratumClient) setDifficulty(difficulty float64) {
+	c.difficulty = difficulty
+	c.target = stratumDifficultyToTarget(difficulty,
+		c.server.server.chainParams.PowLimit)
+}
+
+// retarget adjusts the share difficulty of the client based on the rate of
+// shares submitted since the last retarget and notifies the client when it
+// changed.
+func (c *stratumClient) retarget() {
+	c.mtx.Lock()
+	if !c.authorized || c.fixedDiff {
+		c.mtx.Unlock()
+		return
+	}
+	now := time.Now()
+	difficulty := stratumRetarget(c.difficulty, c.shares, now.Sub(c.lastRetarget))
+	c.shares = 0
+	c.lastRetarget = now
+	changed := difficulty != c.difficulty
+	if changed {
+		c.setDifficulty(difficulty)
+	}
+	target := c.target
+	c.mtx.Unlock()
+
+	if changed {
+		strmLog.Debugf("Retargeted share difficulty of %s to %g", c.addr,
+			difficulty)
+		if err := c.sendTarget(target); err != nil {
+			strmLog.Debugf("Unable to send target to %s: %v", c.addr, err)
+		}
+	}
+}
+
+// stratumHandler describes a handler for a stratum request method.
+type stratumHandler func(*stratumClient, []json.RawMessage) (interface{}, *stratumError)
+
+// stratumHandlers maps stratum request methods to their handlers.
+var stratumHandlers = map[string]stratumHandler{
+	"mining.subscribe": handleStratumSubscribe,
+	"mining.authorize": handleStratumAuthorize,
+	"mining.submit":    handleStratumSubmit,
+}
+
+// parseStratumParams unmarshals the passed positional parameters into the
+// provided string pointers.  An error is returned when fewer parameters than
+// pointers are provided or when a parameter is not a string.
+func parseStratumParams(params []json.RawMessage, dests ...*string) *stratumError {
+	if len(params) < len(dests) {
+		return newStratumError(stratumErrOther, "expected %d "+
+			"parameters, got %d", len(dests), len(params))
+	}
+	for i, dest := range dests {
+		if err := json.Unmarshal(params[i], dest); err != nil {
+			return newStratumError(stratumErrOther, "parameter %d "+
+				"is not a string", i)
+		}
+	}
+	return nil
+}
+
+// handleStratumSubscribe implements the mining.subscribe method.  The result
+// is the session id, which is not supported and therefore null, and the
+// NONCE_1 assigned to the connection.
+func handleStratumSubscribe(c *stratumClient, params []json.RawMessage) (interface{}, *stratumError) {
+	c.mtx.Lock()
+	c.subscribed = true
+	c.mtx.Unlock()
+
+	return []interface{}{nil, hex.EncodeToString(c.nonce1[:])}, nil
+}
+
+// handleStratumAuthorize implements the mining.authorize method.  The node pays
+// mined blocks to its configured mining addresses, so every worker name is
+// accepted.  The password may be used to request a fixed share difficulty.
+func handleStratumAuthorize(c *stratumClient, params []json.RawMessage) (interface{}, *stratumError) {
+	var worker, password string
+	if len(params) == 1 {
+		if err := parseStratumParams(params, &worker); err != nil {
+			return nil, err
+		}
+	} else if err := parseStratumParams(params, &worker, &password); err != nil {
+		return nil, err
+	}
+	if worker == "" {
+		return false, nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !c.subscribed {
+		return nil, newStratumError(stratumErrNotSubscribed,
+			"Not subscribed")
+	}
+	if difficulty, ok := parseStratumDifficulty(password); ok {
+		c.fixedDiff = true
+		c.setDifficulty(difficulty)
+	}
+	c.workers[worker] = struct{}{}
+	if !c.authorized {
+		c.authorized = true
+		c.lastRetarget = time.Now()
+		c.sendWork = true
+	}
+
+	strmLog.Debugf("Authorized worker %s on %s", worker, c.addr)
+	return true, nil
+}
+
+// handleStratumSubmit implements the mining.submit method.  The parameters are
+// the worker name, job id, time, NONCE_2 and the Equihash solution.  Shares
+// which also satisfy the network target are submitted as blocks.
+func handleStratumSubmit(c *stratumClient, params []json.RawMessage) (interface{}, *stratumError) {
+	var worker, jobID, timeHex, nonce2Hex, solutionHex string
+	err := parseStratumParams(params, &worker, &jobID, &timeHex,
+		&nonce2Hex, &solutionHex)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	_, authorized := c.workers[worker]
+	shareTarget := c.target
+	c.mtx.Unlock()
+	if !authorized {
+		return nil, newStratumError(stratumErrUnauthorized,
+			"Unauthorized worker")
+	}
+
+	job := c.server.job(jobID)
+	if job == nil {
+		return nil, newStratumError(stratumErrJobNotFound,
+			"Job not found")
+	}
+
+	// Decode the submitted fields.
+	timeBytes, decodeErr := hex.DecodeString(timeHex)
+	if decodeErr != nil || len(timeBytes) != 4 {
+		return nil, newStratumError(stratumErrOther, "Invalid time")
+	}
+	nonce2, decodeErr := hex.DecodeString(nonce2Hex)
+	if decodeErr != nil || len(nonce2) != stratumNonce2Len {
+		return nil, newStratumError(stratumErrOther, "Invalid nonce2 "+
+			"length, expected %d bytes", stratumNonce2Len)
+	}
+	solution, decodeErr := hex.DecodeString(solutionHex)
+	if decodeErr != nil {
+		return nil, newStratumError(stratumErrOther, "Invalid solution")
+	}
+
+	// Miners following the Zcash dialect prefix the solution with its
+	// compact size encoded length, so strip it when present.
+	if len(solution) != wire.EquihashSolutionLen {
+		r := bytes.NewReader(solution)
+		size, err := wire.ReadVarInt(r, 0)
+		if err != nil || size != wire.EquihashSolutionLen ||
+			r.Len() != wire.EquihashSolutionLen {
+
+			return nil, newStratumError(stratumErrOther,
+				"Invalid solution length")
+		}
+		solution = solution[len(solution)-r.Len():]
+	}
+
+	// Ensure the time was only rolled forward and not too far.
+	timestamp := time.Unix(int64(littleEndian.Uint32(timeBytes)), 0)
+	if timestamp.Before(job.block.Header.Timestamp) {
+		return nil, newStratumError(stratumErrOther, "Time too old")
+	}
+	if timestamp.After(time.Now().Add(stratumMaxFutureTime)) {
+		return nil, newStratumError(stratumErrOther, "Time too new")
+	}
+
+	// Rebuild the solved header from the job.
+	header := job.block.Header
+	header.Timestamp = timestamp
+	header.Nonce = 0
+	copy(header.ExtraData[:], c.nonce1[:])
+	copy(header.ExtraData[stratumNonce1Len:], nonce2)
+	copy(header.EquihashSolution[:], solution)
+
+	hash := header.BlockHash()
+	c.mtx.Lock()
+	_, duplicate := c.submitted[hash]
+	if !duplicate {
+		c.submitted[hash] = struct{}{}
+	}
+	c.mtx.Unlock()
+	if duplicate {
+		return nil, newStratumError(stratumErrDuplicate, "Duplicate share")
+	}
+
+	headerBytes, serializeErr := header.SerializeAllHeaderBytes()
+	if serializeErr != nil {
+		return nil, newStratumError(stratumErrOther, "Unable to "+
+			"serialize header: %v", serializeErr)
+	}
+	chainParams := c.server.server.chainParams
+	if !equihash.Validate(chainParams.N, chainParams.K, headerBytes,
+		int64(header.Nonce), header.EquihashSolution[:]) {
+
+		return nil, newStratumError(stratumErrOther, "Invalid solution")
+	}
+
+	hashNum := blockchain.HashToBig(&hash)
+	if hashNum.Cmp(shareTarget) > 0 {
+		return nil, newStratumError(stratumErrLowDifficulty,
+			"Low difficulty share")
+	}
+
+	c.mtx.Lock()
+	c.shares++
+	c.mtx.Unlock()
+
+	strmLog.Tracef("Accepted share %s from worker %s on %s", hash, worker,
+		c.addr)
+
+	// Submit the block when the share also satisfies the network target.
+	if hashNum.Cmp(job.target) <= 0 {
+		c.server.submitBlock(job, &header, worker)
+	}
+
+	return true, nil
+}
+
+// stratumServer provides a stratum mining server for pool operators and
+// miners which builds jobs from the block templates of the node.
+type stratumServer struct {
+	started  int32
+	shutdown int32
+
+	policy    *mining.Policy
+	server    *server
+	listeners []net.Listener
+	newTip    chan struct{}
+	quit      chan struct{}
+	wg        sync.WaitGroup
+
+	// nextNonce1 is the NONCE_1 assigned to the next connection.  It must
+	// only be used atomically.
+	nextNonce1 uint32
+
+	clientsMtx sync.Mutex
+	clients    map[*stratumClient]struct{}
+
+	// The following fields are protected by jobMtx.
+	jobMtx       sync.Mutex
+	jobs         map[string]*stratumJob
+	jobOrder     []string
+	currentJob   *stratumJob
+	nextJobID    uint64
+	extraNonce   uint64
+	lastTxUpdate time.Time
+}
+
+// job returns the job with the passed id, or nil when it is unknown or stale.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) job(id string) *stratumJob {
+	s.jobMtx.Lock()
+	defer s.jobMtx.Unlock()
+
+	return s.jobs[id]
+}
+
+// NotifyNewTip signals the stratum server that the best chain tip has changed
+// so miners are sent a new job and told to abandon their current work.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) NotifyNewTip() {
+	select {
+	case s.newTip <- struct{}{}:
+	default:
+	}
+}
+
+// newJob creates a new job from a fresh block template and makes it the
+// current job.  All previous jobs are discarded when cleanJobs is set since
+// they build on a stale tip.  Nil is returned when no template is available.
+func (s *stratumServer) newJob(cleanJobs bool) (*stratumJob, error) {
+	lastTxUpdate := s.server.txMemPool.LastUpdated()
+	payToAddr, err := s.server.blockManager.GetMiningAddr()
+	if err != nil {
+		return nil, err
+	}
+	template, err := NewBlockTemplate(s.policy, s.server, payToAddr)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		// There are not enough voters on the tip and no suitable
+		// parent template to build from.
+		return nil, nil
+	}
+
+	// The template is modified below, so work on a copy.
+	template = deepCopyBlockTemplate(template)
+	msgBlock := template.Block
+	msgBlock.Header.Nonce = 0
+	msgBlock.Header.ExtraData = [32]byte{}
+
+	s.jobMtx.Lock()
+	defer s.jobMtx.Unlock()
+
+	// Give every job a unique coinbase, and therefore merkle root, so
+	// solutions for different jobs never collide.
+	s.extraNonce++
+	err = UpdateExtraNonce(msgBlock, template.Height, s.extraNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	s.nextJobID++
+	job := &stratumJob{
+		id:     strconv.FormatUint(s.nextJobID, 16),
+		block:  msgBlock,
+		target: blockchain.CompactToBig(msgBlock.Header.Bits),
+	}
+
+	if cleanJobs {
+		s.jobs = make(map[string]*stratumJob)
+		s.jobOrder = s.jobOrder[:0]
+	}
+	if len(s.jobOrder) >= stratumMaxJobs {
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+	s.jobs[job.id] = job
+	s.jobOrder = append(s.jobOrder, job.id)
+	s.currentJob = job
+	s.lastTxUpdate = lastTxUpdate
+
+	strmLog.Debugf("Created job %s (height %d, target %064x, merkle "+
+		"root %s)", job.id, template.Height, job.target,
+		msgBlock.Header.MerkleRoot)
+	return job, nil
+}
+
+// refreshJob creates a new job and sends it to all authorized clients.
+func (s *stratumServer) refreshJob(cleanJobs bool) {
+	job, err := s.newJob(cleanJobs)
+	if err != nil {
+		strmLog.Errorf("Failed to create new stratum job: %v", err)
+		return
+	}
+	if job == nil {
+		strmLog.Debugf("Not enough voters to create a new stratum job")
+		return
+	}
+
+	s.clientsMtx.Lock()
+	clients := make([]*stratumClient, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.clientsMtx.Unlock()
+
+	for _, c := range clients {
+		c.mtx.Lock()
+		authorized := c.authorized
+		c.mtx.Unlock()
+		if !authorized {
+			continue
+		}
+		if err := c.sendJob(job, cleanJobs); err != nil {
+			strmLog.Debugf("Unable to send job to %s: %v", c.addr, err)
+		}
+	}
+}
+
+// retargetClients adjusts the share difficulty of all connected clients.
+func (s *stratumServer) retargetClients() {
+	s.clientsMtx.Lock()
+	clients := make([]*stratumClient, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.clientsMtx.Unlock()
+
+	for _, c := range clients {
+		c.retarget()
+	}
+}
+
+// jobHandler creates new jobs when the chain tip changes or the memory pool
+// has been updated and retargets the share difficulty of clients when
+// variable difficulty is enabled.
+//
+// It must be run as a goroutine.
+func (s *stratumServer) jobHandler() {
+	refreshTicker := time.NewTicker(stratumJobRefreshInterval)
+	defer refreshTicker.Stop()
+
+	// A nil channel blocks forever, so retargeting is disabled unless an
+	// interval is configured.
+	var retarget <-chan time.Time
+	if cfg.StratumVarDiff > 0 {
+		retargetTicker := time.NewTicker(cfg.StratumVarDiff)
+		defer retargetTicker.Stop()
+		retarget = retargetTicker.C
+	}
+
+	s.refreshJob(true)
+
+out:
+	for {
+		select {
+		case <-s.newTip:
+			s.refreshJob(true)
+
+		case <-refreshTicker.C:
+			s.jobMtx.Lock()
+			stale := s.currentJob == nil ||
+				s.lastTxUpdate != s.server.txMemPool.LastUpdated()
+			cleanJobs := s.currentJob == nil
+			s.jobMtx.Unlock()
+			if stale {
+				s.refreshJob(cleanJobs)
+			}
+
+		case <-retarget:
+			s.retargetClients()
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+	strmLog.Tracef("Stratum job handler done")
+}
+
+// submitBlock submits the block solved by a share to the network after
+// ensuring it passes all of the consensus validation rules.  This is the same
+// path taken by blocks submitted through the submitblock RPC.
+func (s *stratumServer) submitBlock(job *stratumJob, header *wire.BlockHeader, worker string) {
+	block := cmmutil.NewBlockDeepCopyCoinbase(&wire.MsgBlock{
+		Header:        *header,
+		Transactions:  job.block.Transactions,
+		STransactions: job.block.STransactions,
+	})
+
+	isOrphan, err := s.server.blockManager.ProcessBlock(block,
+		blockchain.BFNone)
+	if err != nil {
+		// Anything other than a rule violation is an unexpected error,
+		// so log that error as an internal error.
+		if _, ok := err.(blockchain.RuleError); !ok {
+			strmLog.Errorf("Unexpected error while processing block "+
+				"submitted via stratum: %v", err)
+			return
+		}
+		strmLog.Infof("Block submitted via stratum by worker %s "+
+			"rejected: %v", worker, err)
+		return
+	}
+	if isOrphan {
+		strmLog.Infof("Block submitted via stratum by worker %s is an "+
+			"orphan building on parent %v", worker, header.PrevBlock)
+		return
+	}
+
+	strmLog.Infof("Block submitted via stratum by worker %s accepted "+
+		"(hash %s, height %d)", worker, block.Hash(), header.Height)
+}
+
+// handleClient reads and responds to the requests of a stratum client until
+// the connection is closed or the server shuts down.
+//
+// It must be run as a goroutine.
+func (s *stratumServer) handleClient(c *stratumClient) {
+	defer func() {
+		s.clientsMtx.Lock()
+		delete(s.clients, c)
+		s.clientsMtx.Unlock()
+		c.conn.Close()
+		s.wg.Done()
+		strmLog.Debugf("Stratum client %s disconnected", c.addr)
+	}()
+
+	reader := bufio.NewReaderSize(c.conn, stratumMaxRequestLen)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			if err == bufio.ErrBufferFull {
+				strmLog.Warnf("Stratum client %s sent an "+
+					"oversized request", c.addr)
+			} else if err != io.EOF &&
+				atomic.LoadInt32(&s.shutdown) == 0 {
+
+				strmLog.Debugf("Unable to read from stratum "+
+					"client %s: %v", c.addr, err)
+			}
+			return
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var request stratumRequest
+		if err := json.Unmarshal(line, &request); err != nil {
+			strmLog.Debugf("Stratum client %s sent a malformed "+
+				"request: %v", c.addr, err)
+			return
+		}
+
+		response := stratumResponse{ID: request.ID}
+		handler, ok := stratumHandlers[request.Method]
+		if ok {
+			response.Result, response.Error = handler(c, request.Params)
+		} else {
+			response.Error = newStratumError(stratumErrOther,
+				"Unknown method %q", request.Method)
+		}
+		if err := c.send(&response); err != nil {
+			strmLog.Debugf("Unable to send response to stratum "+
+				"client %s: %v", c.addr, err)
+			return
+		}
+
+		// Newly authorized clients are sent their share target and the
+		// current job.
+		c.mtx.Lock()
+		sendWork := c.sendWork
+		c.sendWork = false
+		target := c.target
+		c.mtx.Unlock()
+		if !sendWork {
+			continue
+		}
+		if err := c.sendTarget(target); err != nil {
+			return
+		}
+		s.jobMtx.Lock()
+		job := s.currentJob
+		s.jobMtx.Unlock()
+		if job != nil {
+			if err := c.sendJob(job, true); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// listenHandler accepts stratum connections on the passed listener.
+//
+// It must be run as a goroutine.
+func (s *stratumServer) listenHandler(listener net.Listener) {
+	strmLog.Infof("Stratum server listening on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Only log the error if not forcibly shutting down.
+			if atomic.LoadInt32(&s.shutdown) == 0 {
+				strmLog.Errorf("Can't accept connection: %v", err)
+			}
+			break
+		}
+
+		c := &stratumClient{
+			server:    s,
+			conn:      conn,
+			addr:      conn.RemoteAddr().String(),
+			workers:   make(map[string]struct{}),
+			submitted: make(map[chainhash.Hash]struct{}),
+		}
+		nonce1 := atomic.AddUint32(&s.nextNonce1, 1)
+		c.nonce1[0] = byte(nonce1 >> 24)
+		c.nonce1[1] = byte(nonce1 >> 16)
+		c.nonce1[2] = byte(nonce1 >> 8)
+		c.nonce1[3] = byte(nonce1)
+		c.setDifficulty(cfg.StratumDifficulty)
+
+		s.clientsMtx.Lock()
+		s.clients[c] = struct{}{}
+		s.clientsMtx.Unlock()
+
+		strmLog.Debugf("New stratum client %s", c.addr)
+		s.wg.Add(1)
+		go s.handleClient(c)
+	}
+	s.wg.Done()
+	strmLog.Tracef("Stratum listener done for %s", listener.Addr())
+}
+
+// Start begins accepting stratum connections and handing out jobs.
+func (s *stratumServer) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	strmLog.Trace("Starting stratum server")
+	s.wg.Add(1)
+	go s.jobHandler()
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go s.listenHandler(listener)
+	}
+}
+
+// Stop gracefully shuts down the stratum server by closing the listeners and
+// disconnecting all clients.
+func (s *stratumServer) Stop() error {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		strmLog.Infof("Stratum server is already in the process of " +
+			"shutting down")
+		return nil
+	}
+	strmLog.Warnf("Stratum server shutting down")
+	for _, listener := range s.listeners {
+		err := listener.Close()
+		if err != nil {
+			strmLog.Errorf("Problem shutting down stratum: %v", err)
+			return err
+		}
+	}
+	s.clientsMtx.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.clientsMtx.Unlock()
+	close(s.quit)
+	s.wg.Wait()
+	strmLog.Infof("Stratum server shutdown complete")
+	return nil
+}
+
+// newStratumServer returns a new stratum server listening on the passed
+// addresses.  Use Start to begin accepting connections.
+func newStratumServer(listenAddrs []string, policy *mining.Policy, s *server) (*stratumServer, error) {
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			strmLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			strmLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("STRM: No valid listen address")
+	}
+
+	return &stratumServer{
+		policy:    policy,
+		server:    s,
+		listeners: listeners,
+		newTip:    make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+		clients:   make(map[*stratumClient]struct{}),
+		jobs:      make(map[string]*stratumJob),
+	}, nil
+}
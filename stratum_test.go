@@ -0,0 +1,344 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg"
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/CommerciumBlockchain/cmmd/equihash"
+	"github.com/CommerciumBlockchain/cmmd/wire"
+)
+
+// TestStratumDifficultyToTarget ensures share difficulties are converted to
+// the expected share targets.
+func TestStratumDifficultyToTarget(t *testing.T) {
+	powLimit := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 236),
+		big.NewInt(1))
+
+	tests := []struct {
+		name       string
+		difficulty float64
+		want       *big.Int
+	}{
+		{
+			name:       "difficulty one is the pow limit",
+			difficulty: 1,
+			want:       powLimit,
+		},
+		{
+			name:       "difficulty 16 is 16 times harder",
+			difficulty: 16,
+			want:       new(big.Int).Rsh(powLimit, 4),
+		},
+		{
+			name:       "tiny difficulty is capped",
+			difficulty: 1e-30,
+			want:       maxShareTarget,
+		},
+		{
+			name:       "huge difficulty is at least one",
+			difficulty: 1e90,
+			want:       big.NewInt(1),
+		},
+	}
+
+	for _, test := range tests {
+		got := stratumDifficultyToTarget(test.difficulty, powLimit)
+
+		// Allow for the precision lost by the float conversion.
+		diff := new(big.Int).Sub(got, test.want)
+		tolerance := new(big.Int).Rsh(test.want, 50)
+		if diff.CmpAbs(tolerance) > 0 {
+			t.Errorf("%s: unexpected target - got %064x, want %064x",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestStratumRetarget ensures the variable difficulty retargeting moves the
+// share difficulty towards the target share rate within the allowed bounds.
+func TestStratumRetarget(t *testing.T) {
+	interval := stratumTargetShareTime * 8
+
+	tests := []struct {
+		name    string
+		shares  uint32
+		elapsed time.Duration
+		want    float64
+	}{
+		{"on target", 8, interval, 10},
+		{"within tolerance", 9, interval, 10},
+		{"twice the rate", 16, interval, 20},
+		{"half the rate", 4, interval, 5},
+		{"clamped increase", 1000, interval, 10 * stratumVarDiffMaxFactor},
+		{"no shares", 0, interval, 10 / stratumVarDiffMaxFactor},
+		{"no time elapsed", 8, 0, 10},
+	}
+
+	for _, test := range tests {
+		got := stratumRetarget(10, test.shares, test.elapsed)
+		if got != test.want {
+			t.Errorf("%s: unexpected difficulty - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestParseStratumDifficulty ensures difficulties requested through the
+// authorize password are parsed properly.
+func TestParseStratumDifficulty(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+		wantOk   bool
+	}{
+		{"", 0, false},
+		{"x", 0, false},
+		{"d=64", 64, true},
+		{"x, d=0.5", 0.5, true},
+		{"d=0", 0, false},
+		{"d=-1", 0, false},
+		{"d=abc", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseStratumDifficulty(test.password)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("%q: got (%v, %v), want (%v, %v)", test.password,
+				got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+// TestStratumErrorMarshal ensures stratum errors are marshalled as the triple
+// stratum clients expect.
+func TestStratumErrorMarshal(t *testing.T) {
+	resp := stratumResponse{
+		ID:    1,
+		Error: newStratumError(stratumErrJobNotFound, "Job not found"),
+	}
+	got, err := json.Marshal(&resp)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+	want := `{"id":1,"result":null,"error":[21,"Job not found",null]}`
+	if string(got) != want {
+		t.Fatalf("unexpected response - got %s, want %s", got, want)
+	}
+
+	resp = stratumResponse{ID: 2, Result: true}
+	got, err = json.Marshal(&resp)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+	want = `{"id":2,"result":true,"error":null}`
+	if string(got) != want {
+		t.Fatalf("unexpected response - got %s, want %s", got, want)
+	}
+}
+
+// solveStratumShare returns the NONCE_2 and Equihash solution of a share for
+// the passed job and client, starting the search at the passed NONCE_2.
+func solveStratumShare(t *testing.T, c *stratumClient, job *stratumJob, nonce2 uint64) ([]byte, []byte) {
+	params := c.server.server.chainParams
+	for ; ; nonce2++ {
+		var nonce2Bytes [stratumNonce2Len]byte
+		littleEndian.PutUint64(nonce2Bytes[:], nonce2)
+
+		header := job.block.Header
+		copy(header.ExtraData[:], c.nonce1[:])
+		copy(header.ExtraData[stratumNonce1Len:], nonce2Bytes[:])
+		headerBytes, err := header.SerializeAllHeaderBytes()
+		if err != nil {
+			t.Fatalf("unable to serialize header: %v", err)
+		}
+
+		var solution []byte
+		err = equihash.Solve(params.N, params.K, headerBytes, 0,
+			func(s []byte) bool {
+				solution = s
+				return s != nil
+			})
+		if err != nil {
+			t.Fatalf("unable to solve share: %v", err)
+		}
+		if solution != nil {
+			padded := make([]byte, wire.EquihashSolutionLen)
+			copy(padded, solution)
+			return nonce2Bytes[:], padded
+		}
+	}
+}
+
+// TestStratumSubmit ensures mining.submit validates shares and accepts them
+// only when they are valid, not stale, not duplicates and meet the share
+// target of the client.
+func TestStratumSubmit(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	s := &stratumServer{
+		server: &server{chainParams: params},
+		jobs:   make(map[string]*stratumJob),
+	}
+
+	// The network target is set to zero so that accepted shares are never
+	// submitted as blocks.
+	job := &stratumJob{
+		id:     "1",
+		block:  &wire.MsgBlock{},
+		target: new(big.Int),
+	}
+	job.block.Header.Version = 1
+	job.block.Header.Bits = params.PowLimitBits
+	job.block.Header.Timestamp = time.Unix(time.Now().Unix(), 0)
+	s.jobs[job.id] = job
+
+	c := &stratumClient{
+		server:     s,
+		nonce1:     [stratumNonce1Len]byte{0x01, 0x02, 0x03, 0x04},
+		subscribed: true,
+		authorized: true,
+		workers:    map[string]struct{}{"worker": {}},
+		target:     maxShareTarget,
+		submitted:  make(map[chainhash.Hash]struct{}),
+	}
+
+	// submitParams returns the mining.submit parameters for the passed
+	// worker, job id, NONCE_2 and solution.
+	submitParams := func(worker, jobID string, nonce2, solution []byte) []json.RawMessage {
+		var timestamp [4]byte
+		littleEndian.PutUint32(timestamp[:],
+			uint32(job.block.Header.Timestamp.Unix()))
+		var params []json.RawMessage
+		for _, param := range []string{worker, jobID,
+			hex.EncodeToString(timestamp[:]),
+			hex.EncodeToString(nonce2),
+			hex.EncodeToString(solution)} {
+
+			params = append(params, json.RawMessage(fmt.Sprintf("%q",
+				param)))
+		}
+		return params
+	}
+
+	// submit submits the share described by the passed parameters with the
+	// passed client share target and checks the result.
+	submit := func(name string, target *big.Int, params []json.RawMessage, wantCode int) *stratumError {
+		t.Helper()
+		c.mtx.Lock()
+		c.target = target
+		c.mtx.Unlock()
+
+		result, err := handleStratumSubmit(c, params)
+		switch {
+		case wantCode == 0 && err != nil:
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		case wantCode == 0 && result != true:
+			t.Fatalf("%s: unexpected result: %v", name, result)
+		case wantCode != 0 && err == nil:
+			t.Fatalf("%s: share accepted, want error code %d", name,
+				wantCode)
+		case wantCode != 0 && err.Code != wantCode:
+			t.Fatalf("%s: unexpected error code: got %d (%v), want %d",
+				name, err.Code, err, wantCode)
+		}
+		return err
+	}
+
+	// A valid share is accepted and counted.
+	nonce2, solution := solveStratumShare(t, c, job, 0)
+	accepted := submitParams("worker", job.id, nonce2, solution)
+	submit("accepted", maxShareTarget, accepted, 0)
+	if c.shares != 1 {
+		t.Fatalf("unexpected number of shares: got %d, want 1", c.shares)
+	}
+
+	// Submitting the same share again is rejected as a duplicate.
+	submit("duplicate", maxShareTarget, accepted, stratumErrDuplicate)
+
+	// A share which does not meet the share target of the client is
+	// rejected.
+	next := littleEndian.Uint64(nonce2) + 1
+	nonce2, solution = solveStratumShare(t, c, job, next)
+	submit("low difficulty", big.NewInt(1),
+		submitParams("worker", job.id, nonce2, solution),
+		stratumErrLowDifficulty)
+
+	// A share with a solution for a different header is rejected.
+	next = littleEndian.Uint64(nonce2) + 1
+	nonce2, solution = solveStratumShare(t, c, job, next)
+	otherNonce2 := make([]byte, len(nonce2))
+	littleEndian.PutUint64(otherNonce2, littleEndian.Uint64(nonce2)+1<<32)
+	err := submit("invalid solution", maxShareTarget,
+		submitParams("worker", job.id, otherNonce2, solution),
+		stratumErrOther)
+	if err.Message != "Invalid solution" {
+		t.Fatalf("invalid solution: unexpected error: %v", err)
+	}
+
+	// Shares of unauthorized workers are rejected.
+	submit("unauthorized", maxShareTarget,
+		submitParams("other", job.id, nonce2, solution),
+		stratumErrUnauthorized)
+
+	// Shares for jobs discarded due to a new chain tip are rejected as
+	// stale even when they are otherwise valid.
+	s.jobs = make(map[string]*stratumJob)
+	submit("stale", maxShareTarget,
+		submitParams("worker", job.id, nonce2, solution),
+		stratumErrJobNotFound)
+	if c.shares != 1 {
+		t.Fatalf("unexpected number of shares: got %d, want 1", c.shares)
+	}
+}
+
+// stalledConn is a connection whose remote end never reads.  It records the
+// write deadline requested by the caller and shortens it so the test does not
+// have to wait for the full write timeout.
+type stalledConn struct {
+	net.Conn
+	deadline time.Time
+}
+
+// SetWriteDeadline records the requested deadline and makes pending writes
+// time out shortly instead.
+func (c *stalledConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return c.Conn.SetWriteDeadline(time.Now().Add(time.Millisecond * 50))
+}
+
+// TestStratumSendTimeout ensures messages to a client which stops reading time
+// out and that the client is disconnected so it can't hold up the messages to
+// the other clients.
+func TestStratumSendTimeout(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := &stalledConn{Conn: local}
+	c := &stratumClient{conn: conn}
+
+	start := time.Now()
+	err := c.send(&stratumNotification{Method: "mining.notify"})
+	if err == nil {
+		t.Fatal("send to a stalled client did not fail")
+	}
+	if conn.deadline.Before(start.Add(stratumWriteTimeout)) {
+		t.Fatalf("unexpected write deadline: got %v, want at least %v",
+			conn.deadline, start.Add(stratumWriteTimeout))
+	}
+
+	// The connection is closed, which disconnects the client.
+	if _, err := local.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Fatalf("connection not closed: got %v, want %v", err,
+			io.ErrClosedPipe)
+	}
+}
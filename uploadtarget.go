@@ -0,0 +1,138 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// uploadTargetTimeframe is the duration of the cycles over which the
+	// upload target applies.
+	uploadTargetTimeframe = 24 * time.Hour
+
+	// historicalBlockAge is the minimum age of a block, relative to the
+	// best block, for it to be considered historical.  Historical blocks
+	// are no longer served to peers once the upload target is reached.
+	historicalBlockAge = 7 * 24 * time.Hour
+)
+
+// uploadTarget tracks the bytes sent to peers during the current cycle in order
+// to stop serving historical blocks once the upload target for the cycle is
+// about to be reached.  Enough of the target is kept in reserve to relay the
+// new blocks which are expected during the remainder of the cycle.
+//
+// It is safe for concurrent access.
+type uploadTarget struct {
+	target       uint64
+	blockSpacing time.Duration
+	maxBlockSize uint64
+
+	mtx        sync.Mutex
+	cycleStart time.Time
+	cycleBytes uint64
+}
+
+// newUploadTarget returns an upload target which allows the passed number of
+// bytes to be sent per cycle, or nil when the target is 0 which means it is
+// unlimited.  The block spacing and max block size determine the bytes kept in
+// reserve for relaying new blocks.
+func newUploadTarget(target uint64, blockSpacing time.Duration, maxBlockSize uint64) *uploadTarget {
+	if target == 0 {
+		return nil
+	}
+	return &uploadTarget{
+		target:       target,
+		blockSpacing: blockSpacing,
+		maxBlockSize: maxBlockSize,
+	}
+}
+
+// minUploadTarget returns the smallest upload target which is able to keep
+// enough bytes in reserve to relay the largest possible new blocks expected
+// during a full cycle with the passed block spacing and max block size.
+func minUploadTarget(blockSpacing time.Duration, maxBlockSize uint64) uint64 {
+	return uint64(uploadTargetTimeframe/blockSpacing) * maxBlockSize
+}
+
+// updateCycle starts a new cycle when the current one has ended at the passed
+// time.
+//
+// This function MUST be called with the mutex held.
+func (u *uploadTarget) updateCycle(now time.Time) {
+	if now.Sub(u.cycleStart) >= uploadTargetTimeframe {
+		u.cycleStart = now
+		u.cycleBytes = 0
+	}
+}
+
+// AddBytesSent adds the passed number of bytes sent at the passed time to the
+// bytes sent during the current cycle.
+func (u *uploadTarget) AddBytesSent(n uint64, now time.Time) {
+	if u == nil {
+		return
+	}
+	u.mtx.Lock()
+	u.updateCycle(now)
+	u.cycleBytes += n
+	u.mtx.Unlock()
+}
+
+// timeLeftInCycle returns the time left in the current cycle at the passed
+// time.
+//
+// This function MUST be called with the mutex held.
+func (u *uploadTarget) timeLeftInCycle(now time.Time) time.Duration {
+	u.updateCycle(now)
+	return u.cycleStart.Add(uploadTargetTimeframe).Sub(now)
+}
+
+// TimeLeftInCycle returns the time left in the current cycle at the passed
+// time.
+func (u *uploadTarget) TimeLeftInCycle(now time.Time) time.Duration {
+	if u == nil {
+		return 0
+	}
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return u.timeLeftInCycle(now)
+}
+
+// BytesLeftInCycle returns the number of bytes which may still be sent during
+// the current cycle at the passed time.
+func (u *uploadTarget) BytesLeftInCycle(now time.Time) uint64 {
+	if u == nil {
+		return 0
+	}
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.updateCycle(now)
+	if u.cycleBytes >= u.target {
+		return 0
+	}
+	return u.target - u.cycleBytes
+}
+
+// Reached returns whether or not the upload target for the current cycle has
+// been reached at the passed time.  When historical is set, it instead returns
+// whether or not historical blocks should no longer be served, which happens
+// once only the bytes needed to relay the new blocks expected during the
+// remainder of the cycle are left.
+func (u *uploadTarget) Reached(historical bool, now time.Time) bool {
+	if u == nil {
+		return false
+	}
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	var reserve uint64
+	if historical {
+		blocksLeft := uint64(u.timeLeftInCycle(now) / u.blockSpacing)
+		reserve = blocksLeft * u.maxBlockSize
+	}
+	u.updateCycle(now)
+	return reserve >= u.target || u.cycleBytes >= u.target-reserve
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUploadTarget ensures the upload target stops serving historical blocks
+// while enough bytes are left to relay new blocks and that it is reset once the
+// cycle ends.
+func TestUploadTarget(t *testing.T) {
+	// Ensure a disabled upload target is never reached.
+	var disabled *uploadTarget
+	if u := newUploadTarget(0, time.Minute, 1000); u != nil {
+		t.Fatalf("newUploadTarget(0): got %v, want nil", u)
+	}
+	disabled.AddBytesSent(1<<30, time.Now())
+	if disabled.Reached(true, time.Now()) {
+		t.Fatal("disabled upload target reached")
+	}
+
+	// Ensure the minimum upload target keeps enough bytes in reserve to
+	// relay the largest possible blocks expected during a full cycle.
+	const want = 216 * 1024 * 1024
+	if got := minUploadTarget(150*time.Second, 393216); got != want {
+		t.Fatalf("minUploadTarget: got %d, want %d", got, want)
+	}
+
+	// Allow 1000 bytes per cycle with one block of 100 bytes expected every
+	// 4.8 hours, so 500 bytes are kept in reserve at the start of a cycle.
+	blockSpacing := uploadTargetTimeframe / 5
+	u := newUploadTarget(1000, blockSpacing, 100)
+	start := time.Now()
+	u.AddBytesSent(400, start)
+
+	tests := []struct {
+		name           string
+		elapsed        time.Duration
+		sent           uint64
+		wantHistorical bool
+		wantReached    bool
+		wantBytesLeft  uint64
+	}{
+		{"below reserve", 0, 0, false, false, 600},
+		{"reserve reached", 0, 100, true, false, 500},
+		{"reserve shrinks", 3 * blockSpacing, 0, false, false, 500},
+		{"target reached", 3 * blockSpacing, 500, true, true, 0},
+		{"new cycle", uploadTargetTimeframe, 0, false, false, 1000},
+	}
+	for _, test := range tests {
+		now := start.Add(test.elapsed)
+		u.AddBytesSent(test.sent, now)
+		if got := u.Reached(true, now); got != test.wantHistorical {
+			t.Fatalf("%s: historical reached %v, want %v", test.name,
+				got, test.wantHistorical)
+		}
+		if got := u.Reached(false, now); got != test.wantReached {
+			t.Fatalf("%s: reached %v, want %v", test.name, got,
+				test.wantReached)
+		}
+		if got := u.BytesLeftInCycle(now); got != test.wantBytesLeft {
+			t.Fatalf("%s: bytes left %d, want %d", test.name, got,
+				test.wantBytesLeft)
+		}
+	}
+}
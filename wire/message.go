@@ -60,6 +60,13 @@ const (
 	CmdCFilter        = "cfilter"
 	CmdCFHeaders      = "cfheaders"
 	CmdCFTypes        = "cftypes"
+	CmdSendCmpct      = "sendcmpct"
+	CmdCmpctBlock     = "cmpctblock"
+	CmdGetBlockTxn    = "getblocktxn"
+	CmdBlockTxn       = "blocktxn"
+	CmdDandelionTx    = "dandeliontx"
+	CmdAddrV2         = "addrv2"
+	CmdSendAddrV2     = "sendaddrv2"
 )
 
 // Message is an interface that describes a Commercium message.  A type that
@@ -168,6 +175,27 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdCFTypes:
 		msg = &MsgCFTypes{}
 
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
+
+	case CmdDandelionTx:
+		msg = &MsgDandelionTx{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -0,0 +1,170 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestAddrV2Wire tests the MsgAddrV2 wire encode and decode for addresses on
+// each of the known networks.
+func TestAddrV2Wire(t *testing.T) {
+	ts := time.Unix(0x495fab29, 0) // 2009-01-03 12:15:05 -0600 CST
+	torV3 := bytes.Repeat([]byte{0x11}, 32)
+	i2p := bytes.Repeat([]byte{0x22}, 32)
+	msg := NewMsgAddrV2()
+	msg.AddAddresses(
+		&NetAddress{Timestamp: ts, Services: SFNodeNetwork,
+			IP: net.ParseIP("127.0.0.1"), Port: 8333},
+		&NetAddress{Timestamp: ts, IP: net.ParseIP("2001:db8::1"),
+			Port: 8333},
+		&NetAddress{Timestamp: ts, IP: net.ParseIP("fd87:d87e:eb43::1"),
+			Port: 8333},
+		&NetAddress{Timestamp: ts, Network: NetworkTorV3, Addr: torV3,
+			Port: 8333},
+		&NetAddress{Timestamp: ts, Network: NetworkI2P, Addr: i2p},
+		&NetAddress{Timestamp: ts, Network: NetworkCJDNS,
+			IP: net.ParseIP("fc00::1"), Port: 8333},
+	)
+	msgEncoded := []byte{
+		0x06,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,       // Services varint
+		0x01, 0x04, // IPv4, address length
+		0x7f, 0x00, 0x00, 0x01, // IP 127.0.0.1
+		0x20, 0x8d, // Port 8333 in big-endian
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x02, 0x10, // IPv6
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x20, 0x8d,
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x03, 0x0a, // TorV2
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x20, 0x8d,
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x04, 0x20, // TorV3
+	}
+	msgEncoded = append(msgEncoded, torV3...)
+	msgEncoded = append(msgEncoded, 0x20, 0x8d)
+	msgEncoded = append(msgEncoded, 0x29, 0xab, 0x5f, 0x49, 0x00, 0x05, 0x20)
+	msgEncoded = append(msgEncoded, i2p...)
+	msgEncoded = append(msgEncoded, 0x00, 0x00)
+	msgEncoded = append(msgEncoded, []byte{
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x06, 0x10, // CJDNS
+		0xfc, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x20, 0x8d,
+	}...)
+
+	// Ensure the command is expected value.
+	wantCmd := "addrv2"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgAddrV2: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Encode the message to wire format.
+	pver := ProtocolVersion
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), msgEncoded) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(msgEncoded))
+	}
+
+	// Decode the message from wire format.
+	var readMsg MsgAddrV2
+	err := readMsg.BtcDecode(bytes.NewReader(msgEncoded), pver)
+	if err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Ensure only the legacy addresses can be encoded in an addr message.
+	for i, na := range msg.AddrList {
+		wantLegacy := i < 3
+		if na.IsLegacy() != wantLegacy {
+			t.Errorf("IsLegacy #%d: got %v, want %v", i,
+				na.IsLegacy(), wantLegacy)
+		}
+		err := writeNetAddress(&buf, pver, na, true)
+		if (err == nil) != wantLegacy {
+			t.Errorf("writeNetAddress #%d: unexpected error %v", i,
+				err)
+		}
+	}
+}
+
+// TestAddrV2WireErrors performs negative tests against wire decode of
+// MsgAddrV2 to confirm invalid addresses are rejected while addresses on
+// unknown networks are decoded so they can be ignored.
+func TestAddrV2WireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	tests := []struct {
+		buf  []byte     // Wire encoding
+		pver uint32     // Protocol version for wire encoding
+		want *MsgAddrV2 // Expected decoded message or nil on error
+	}{
+		// Protocol version before addrv2 was added.
+		{[]byte{0x00}, AddrV2Version - 1, nil},
+
+		// Too many addresses.
+		{[]byte{0xfd, 0xe9, 0x03}, pver, nil},
+
+		// IPv4 address with the wrong length.
+		{[]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x03,
+			0x7f, 0x00, 0x00, 0x20, 0x8d}, pver, nil},
+
+		// Tor v2 address encoded as an IPv6 address.
+		{append(append([]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+			0x10, 0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43},
+			make([]byte, 10)...), 0x20, 0x8d), pver, nil},
+
+		// CJDNS address outside of fc00::/8.
+		{append(append([]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x06,
+			0x10}, make([]byte, 16)...), 0x20, 0x8d), pver, nil},
+
+		// Address too long.
+		{[]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0xfd, 0x01,
+			0x02}, pver, nil},
+
+		// Unknown network.
+		{[]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0x02, 0xab,
+			0xcd, 0x20, 0x8d}, pver, &MsgAddrV2{
+			AddrList: []*NetAddress{{Timestamp: time.Unix(0, 0),
+				Network: 7, Addr: []byte{0xab, 0xcd}, Port: 8333}},
+		}},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		var msg MsgAddrV2
+		err := msg.BtcDecode(bytes.NewReader(test.buf), test.pver)
+		if test.want == nil {
+			if _, ok := err.(*MessageError); !ok {
+				t.Errorf("BtcDecode #%d: wrong error got: %v, "+
+					"want: %T", i, err, &MessageError{})
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("BtcDecode #%d: unexpected error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.want) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.want))
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+)
+
+// MsgBlockTxn implements the Message interface and represents a blocktxn
+// message.  It is used to deliver the transactions of a block requested by a
+// getblocktxn message in the same order as the requested indexes.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgBlockTxn struct {
+	BlockHash     chainhash.Hash
+	Transactions  []*MsgTx
+	STransactions []*MsgTx
+}
+
+// readBlockTxnTree reads the transactions of a single transaction tree of a
+// blocktxn message from r.
+func readBlockTxnTree(r io.Reader, pver uint32, treeName string) ([]*MsgTx, error) {
+	maxTxPerTree := MaxTxPerTxTree(pver)
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxTxPerTree {
+		str := fmt.Sprintf("too many %s transactions to fit into a "+
+			"block [count %d, max %d]", treeName, count, maxTxPerTree)
+		return nil, messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	txns := make([]*MsgTx, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var tx MsgTx
+		if err := tx.BtcDecode(r, pver); err != nil {
+			return nil, err
+		}
+		txns = append(txns, &tx)
+	}
+	return txns, nil
+}
+
+// writeBlockTxnTree writes the passed transactions of a single transaction
+// tree of a blocktxn message to w.
+func writeBlockTxnTree(w io.Writer, pver uint32, txns []*MsgTx) error {
+	err := WriteVarInt(w, pver, uint64(len(txns)))
+	if err != nil {
+		return err
+	}
+	for _, tx := range txns {
+		if err := tx.BtcEncode(w, pver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BtcDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("blocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	msg.Transactions, err = readBlockTxnTree(r, pver, "regular")
+	if err != nil {
+		return err
+	}
+	msg.STransactions, err = readBlockTxnTree(r, pver, "stake")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("blocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	err = writeBlockTxnTree(w, pver, msg.Transactions)
+	if err != nil {
+		return err
+	}
+	return writeBlockTxnTree(w, pver, msg.STransactions)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgBlockTxn) Command() string {
+	return CmdBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// The requested transactions can't be larger than the full block.
+	return MaxBlockPayload
+}
+
+// NewMsgBlockTxn returns a new blocktxn message that conforms to the Message
+// interface.  See MsgBlockTxn for details.
+func NewMsgBlockTxn(blockHash *chainhash.Hash) *MsgBlockTxn {
+	return &MsgBlockTxn{
+		BlockHash: *blockHash,
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode for the latest
+// protocol version and ensures it is rejected for older ones.
+func TestBlockTxnWire(t *testing.T) {
+	pver := ProtocolVersion
+	hash := testBlock.BlockHash()
+	msg := NewMsgBlockTxn(&hash)
+	msg.Transactions = testBlock.Transactions[1:]
+	msg.STransactions = testBlock.STransactions
+
+	// Ensure the command is expected value.
+	wantCmd := "blocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	var readMsg MsgBlockTxn
+	if err := readMsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	buf.Reset()
+	err := msg.BtcEncode(&buf, CompactBlocksVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcEncode: unexpected error for old protocol version "+
+			"- got %v, want MessageError", err)
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/aead/siphash"
+)
+
+// ShortTxIDSize is the number of bytes of a short transaction ID as encoded in
+// a cmpctblock message.
+const ShortTxIDSize = 6
+
+// shortTxIDMask is the mask applied to the SipHash of a transaction hash to
+// produce its short transaction ID.
+const shortTxIDMask = 1<<(ShortTxIDSize*8) - 1
+
+// PrefilledTx is a transaction which is included in full in a cmpctblock
+// message along with its index in the transaction tree of the block.  This is
+// typically used for transactions the receiving peer is not expected to have
+// already, such as the coinbase.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a cmpctblock
+// message.  It is used to relay a block using short transaction IDs for both
+// its regular and stake transaction trees so the receiving peer may rebuild
+// it from the transactions it already has in its memory pool and only request
+// the missing ones.
+//
+// The short transaction IDs of each tree skip the indexes of the prefilled
+// transactions of that tree, so the number of transactions in a tree is the
+// number of short IDs plus the number of prefilled transactions.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgCmpctBlock struct {
+	Header        BlockHeader
+	Nonce         uint64
+	ShortIDs      []uint64
+	PrefilledTxs  []PrefilledTx
+	SShortIDs     []uint64
+	PrefilledSTxs []PrefilledTx
+}
+
+// ShortIDKey returns the SipHash key used to calculate the short transaction
+// IDs of the compact block.  It commits to the block header and the nonce so
+// the IDs differ between blocks and announcements.
+func (msg *MsgCmpctBlock) ShortIDKey() [siphash.KeySize]byte {
+	var buf bytes.Buffer
+	buf.Grow(MaxBlockHeaderPayload + 8)
+	_ = msg.Header.Serialize(&buf)
+	_ = binarySerializer.PutUint64(&buf, littleEndian, msg.Nonce)
+
+	var key [siphash.KeySize]byte
+	copy(key[:], chainhash.HashB(buf.Bytes()))
+	return key
+}
+
+// ShortTxID returns the short transaction ID for the passed transaction hash
+// using the provided key obtained from ShortIDKey.
+func ShortTxID(key *[siphash.KeySize]byte, txHash *chainhash.Hash) uint64 {
+	return siphash.Sum64(txHash[:], key) & shortTxIDMask
+}
+
+// BlockHash computes the block identifier hash for the compact block.
+func (msg *MsgCmpctBlock) BlockHash() chainhash.Hash {
+	return msg.Header.BlockHash()
+}
+
+// NumTxns returns the number of transactions in the regular transaction tree
+// of the block.
+func (msg *MsgCmpctBlock) NumTxns() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// NumSTxns returns the number of transactions in the stake transaction tree
+// of the block.
+func (msg *MsgCmpctBlock) NumSTxns() int {
+	return len(msg.SShortIDs) + len(msg.PrefilledSTxs)
+}
+
+// readShortTxID reads a short transaction ID from r.
+func readShortTxID(r io.Reader) (uint64, error) {
+	lo, err := binarySerializer.Uint32(r, littleEndian)
+	if err != nil {
+		return 0, err
+	}
+	hi, err := binarySerializer.Uint16(r, littleEndian)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(hi)<<32 | uint64(lo), nil
+}
+
+// writeShortTxID writes the passed short transaction ID to w.
+func writeShortTxID(w io.Writer, id uint64) error {
+	err := binarySerializer.PutUint32(w, littleEndian, uint32(id))
+	if err != nil {
+		return err
+	}
+	return binarySerializer.PutUint16(w, littleEndian, uint16(id>>32))
+}
+
+// readDiffIndexes reads count differentially encoded indexes from r and
+// returns the absolute indexes they represent.  The first index is encoded
+// as is while every following one is encoded as the difference from the
+// previous index minus one, so the indexes are strictly increasing.
+func readDiffIndexes(r io.Reader, pver uint32, count uint64, maxIndex uint64, fieldName string) ([]uint32, error) {
+	indexes := make([]uint32, 0, count)
+	var next uint64
+	for i := uint64(0); i < count; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return nil, err
+		}
+		index := next + diff
+		if index < next || index >= maxIndex {
+			str := fmt.Sprintf("%s index %d is out of range "+
+				"[max %d]", fieldName, index, maxIndex-1)
+			return nil, messageError("readDiffIndexes", str)
+		}
+		indexes = append(indexes, uint32(index))
+		next = index + 1
+	}
+	return indexes, nil
+}
+
+// writeDiffIndex writes the passed index to w differentially encoded
+// against the previous index as described by readDiffIndexes.  The first
+// parameter indicates whether or not it is the first index being written.
+func writeDiffIndex(w io.Writer, pver uint32, first bool, prev, index uint32) error {
+	if first {
+		return WriteVarInt(w, pver, uint64(index))
+	}
+	if index <= prev {
+		str := fmt.Sprintf("index %d is not greater than the previous "+
+			"index %d", index, prev)
+		return messageError("writeDiffIndex", str)
+	}
+	return WriteVarInt(w, pver, uint64(index-prev-1))
+}
+
+// readCmpctTree reads the short transaction IDs and prefilled transactions of
+// a single transaction tree of a compact block from r.
+func readCmpctTree(r io.Reader, pver uint32, treeName string) ([]uint64, []PrefilledTx, error) {
+	maxTxPerTree := MaxTxPerTxTree(pver)
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > maxTxPerTree {
+		str := fmt.Sprintf("too many %s short ids to fit into a block "+
+			"[count %d, max %d]", treeName, count, maxTxPerTree)
+		return nil, nil, messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+	shortIDs := make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		id, err := readShortTxID(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		shortIDs = append(shortIDs, id)
+	}
+
+	prefilledCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count+prefilledCount > maxTxPerTree {
+		str := fmt.Sprintf("too many %s transactions to fit into a "+
+			"block [count %d, max %d]", treeName,
+			count+prefilledCount, maxTxPerTree)
+		return nil, nil, messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+	total := count + prefilledCount
+	prefilled := make([]PrefilledTx, 0, prefilledCount)
+	var next uint64
+	for i := uint64(0); i < prefilledCount; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return nil, nil, err
+		}
+		index := next + diff
+		if index < next || index >= total {
+			str := fmt.Sprintf("%s prefilled transaction index %d "+
+				"is out of range [max %d]", treeName, index, total-1)
+			return nil, nil, messageError("MsgCmpctBlock.BtcDecode",
+				str)
+		}
+		var tx MsgTx
+		if err := tx.BtcDecode(r, pver); err != nil {
+			return nil, nil, err
+		}
+		prefilled = append(prefilled, PrefilledTx{
+			Index: uint32(index),
+			Tx:    &tx,
+		})
+		next = index + 1
+	}
+	return shortIDs, prefilled, nil
+}
+
+// writeCmpctTree writes the short transaction IDs and prefilled transactions
+// of a single transaction tree of a compact block to w.
+func writeCmpctTree(w io.Writer, pver uint32, shortIDs []uint64, prefilled []PrefilledTx) error {
+	err := WriteVarInt(w, pver, uint64(len(shortIDs)))
+	if err != nil {
+		return err
+	}
+	for _, id := range shortIDs {
+		if err := writeShortTxID(w, id); err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(prefilled)))
+	if err != nil {
+		return err
+	}
+	for i, ptx := range prefilled {
+		var prev uint32
+		if i > 0 {
+			prev = prefilled[i-1].Index
+		}
+		err := writeDiffIndex(w, pver, i == 0, prev, ptx.Index)
+		if err != nil {
+			return err
+		}
+		if err := ptx.Tx.BtcEncode(w, pver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BtcDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	msg.ShortIDs, msg.PrefilledTxs, err = readCmpctTree(r, pver, "regular")
+	if err != nil {
+		return err
+	}
+	msg.SShortIDs, msg.PrefilledSTxs, err = readCmpctTree(r, pver, "stake")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = writeCmpctTree(w, pver, msg.ShortIDs, msg.PrefilledTxs)
+	if err != nil {
+		return err
+	}
+	return writeCmpctTree(w, pver, msg.SShortIDs, msg.PrefilledSTxs)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// A compact block can't be larger than the full block plus the nonce
+	// and the encoded indexes of the prefilled transactions of both trees.
+	maxTxPerTree := uint32(MaxTxPerTxTree(pver))
+	return MaxBlockPayload + 8 + 2*maxTxPerTree*MaxVarIntPayload
+}
+
+// NewMsgCmpctBlock returns a new cmpctblock message for the passed block
+// header and nonce that conforms to the Message interface.  See MsgCmpctBlock
+// for details.
+func NewMsgCmpctBlock(header *BlockHeader, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header: *header,
+		Nonce:  nonce,
+	}
+}
+
+// NewMsgCmpctBlockFromBlock returns a new cmpctblock message for the passed
+// block using the provided nonce.  The coinbase is prefilled since the
+// receiving peer can't have it while every other transaction of both trees is
+// referenced by its short transaction ID.
+func NewMsgCmpctBlockFromBlock(block *MsgBlock, nonce uint64) *MsgCmpctBlock {
+	msg := NewMsgCmpctBlock(&block.Header, nonce)
+	key := msg.ShortIDKey()
+	numShortIDs := len(block.Transactions)
+	if numShortIDs > 0 {
+		numShortIDs--
+	}
+	msg.ShortIDs = make([]uint64, 0, numShortIDs)
+	msg.PrefilledTxs = make([]PrefilledTx, 0, 1)
+	for i, tx := range block.Transactions {
+		if i == 0 {
+			msg.PrefilledTxs = append(msg.PrefilledTxs, PrefilledTx{
+				Index: 0,
+				Tx:    tx,
+			})
+			continue
+		}
+		txHash := tx.TxHash()
+		msg.ShortIDs = append(msg.ShortIDs, ShortTxID(&key, &txHash))
+	}
+	msg.SShortIDs = make([]uint64, 0, len(block.STransactions))
+	msg.PrefilledSTxs = make([]PrefilledTx, 0)
+	for _, stx := range block.STransactions {
+		txHash := stx.TxHash()
+		msg.SShortIDs = append(msg.SShortIDs, ShortTxID(&key, &txHash))
+	}
+	return msg
+}
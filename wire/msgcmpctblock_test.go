@@ -0,0 +1,115 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestCmpctBlock tests the MsgCmpctBlock API and ensures a compact block
+// created from a block survives a wire encode and decode round trip.
+func TestCmpctBlock(t *testing.T) {
+	pver := ProtocolVersion
+	block := &testBlock
+	msg := NewMsgCmpctBlockFromBlock(block, 0x0123456789abcdef)
+
+	// Ensure the command is expected value.
+	wantCmd := "cmpctblock"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCmpctBlock: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure the block hash and number of transactions in each tree match
+	// the block and that only the coinbase is prefilled.
+	if msg.BlockHash() != block.BlockHash() {
+		t.Errorf("BlockHash: wrong hash - got %v, want %v",
+			msg.BlockHash(), block.BlockHash())
+	}
+	if msg.NumTxns() != len(block.Transactions) {
+		t.Errorf("NumTxns: wrong count - got %d, want %d",
+			msg.NumTxns(), len(block.Transactions))
+	}
+	if msg.NumSTxns() != len(block.STransactions) {
+		t.Errorf("NumSTxns: wrong count - got %d, want %d",
+			msg.NumSTxns(), len(block.STransactions))
+	}
+	if len(msg.PrefilledTxs) != 1 || msg.PrefilledTxs[0].Index != 0 ||
+		msg.PrefilledTxs[0].Tx != block.Transactions[0] {
+
+		t.Errorf("unexpected prefilled transactions %v",
+			spew.Sdump(msg.PrefilledTxs))
+	}
+
+	// Ensure the short IDs match the transactions, are limited to their
+	// size, and depend on the nonce.
+	key := msg.ShortIDKey()
+	for i, stx := range block.STransactions {
+		txHash := stx.TxHash()
+		id := ShortTxID(&key, &txHash)
+		if id != msg.SShortIDs[i] {
+			t.Errorf("ShortTxID: wrong id for stake tx %d - got %x, "+
+				"want %x", i, msg.SShortIDs[i], id)
+		}
+		if id>>(ShortTxIDSize*8) != 0 {
+			t.Errorf("ShortTxID: id %x exceeds %d bytes", id,
+				ShortTxIDSize)
+		}
+	}
+	otherMsg := NewMsgCmpctBlock(&block.Header, msg.Nonce+1)
+	if otherMsg.ShortIDKey() == key {
+		t.Error("ShortIDKey: key does not commit to the nonce")
+	}
+
+	// Encode and decode the message and ensure it is unchanged.
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if uint32(buf.Len()) > msg.MaxPayloadLength(pver) {
+		t.Errorf("encoded compact block size %d exceeds max payload %d",
+			buf.Len(), msg.MaxPayloadLength(pver))
+	}
+	var readMsg MsgCmpctBlock
+	if err := readMsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Ensure the message is rejected for older protocol versions.
+	buf.Reset()
+	err := msg.BtcEncode(&buf, CompactBlocksVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcEncode: unexpected error for old protocol version "+
+			"- got %v, want MessageError", err)
+	}
+}
+
+// TestCmpctBlockBadPrefilledIndex ensures decoding a compact block with a
+// prefilled transaction index beyond the number of transactions in the tree
+// fails.
+func TestCmpctBlockBadPrefilledIndex(t *testing.T) {
+	pver := ProtocolVersion
+	msg := NewMsgCmpctBlock(&testBlock.Header, 0)
+	msg.PrefilledTxs = []PrefilledTx{{Index: 1, Tx: testBlock.Transactions[0]}}
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	var readMsg MsgCmpctBlock
+	err := readMsg.BtcDecode(&buf, pver)
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("BtcDecode: unexpected error - got %v, want "+
+			"MessageError", err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"io"
+)
+
+// MsgDandelionTx implements the Message interface and represents a dandeliontx
+// message.  It is used to relay a transaction along the stem phase of the
+// Dandelion++ protocol.  Unlike a tx message, a transaction received in a
+// dandeliontx message must not be announced to other peers until it is
+// fluffed, either because the receiving node chose to end the stem or because
+// the embargo for it expired.
+//
+// Peers which support this message advertise the SFNodeDandelion service flag.
+type MsgDandelionTx struct {
+	Tx *MsgTx
+}
+
+// BtcDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgDandelionTx) BtcDecode(r io.Reader, pver uint32) error {
+	msg.Tx = new(MsgTx)
+	return msg.Tx.BtcDecode(r, pver)
+}
+
+// BtcEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgDandelionTx) BtcEncode(w io.Writer, pver uint32) error {
+	return msg.Tx.BtcEncode(w, pver)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgDandelionTx) Command() string {
+	return CmdDandelionTx
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgDandelionTx) MaxPayloadLength(pver uint32) uint32 {
+	return new(MsgTx).MaxPayloadLength(pver)
+}
+
+// NewMsgDandelionTx returns a new dandeliontx message that conforms to the
+// Message interface using the passed transaction.  See MsgDandelionTx for
+// details.
+func NewMsgDandelionTx(tx *MsgTx) *MsgDandelionTx {
+	return &MsgDandelionTx{Tx: tx}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestDandelionTxWire tests the MsgDandelionTx wire encode and decode for the
+// latest protocol version.
+func TestDandelionTxWire(t *testing.T) {
+	msg := NewMsgDandelionTx(multiTx)
+
+	// Ensure the command is expected value.
+	wantCmd := "dandeliontx"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgDandelionTx: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is the same as a tx message.
+	pver := ProtocolVersion
+	wantPayload := multiTx.MaxPayloadLength(pver)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Encode the message to wire format and ensure it is encoded the same
+	// as a tx message.
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), multiTxEncoded) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(multiTxEncoded))
+	}
+
+	// Decode the message from wire format.
+	var readMsg MsgDandelionTx
+	err := readMsg.BtcDecode(bytes.NewReader(multiTxEncoded), pver)
+	if err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+}
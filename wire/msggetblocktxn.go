@@ -0,0 +1,128 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a getblocktxn
+// message.  It is used to request the transactions of a block which could not
+// be found when rebuilding it from a cmpctblock message.  The indexes refer to
+// the positions of the transactions in the regular and stake transaction
+// trees of the block respectively and must be strictly increasing.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgGetBlockTxn struct {
+	BlockHash chainhash.Hash
+	Indexes   []uint32
+	SIndexes  []uint32
+}
+
+// writeIndexes writes the passed strictly increasing indexes to w using the
+// differential encoding described by readDiffIndexes.
+func writeIndexes(w io.Writer, pver uint32, indexes []uint32) error {
+	err := WriteVarInt(w, pver, uint64(len(indexes)))
+	if err != nil {
+		return err
+	}
+	for i, index := range indexes {
+		var prev uint32
+		if i > 0 {
+			prev = indexes[i-1]
+		}
+		err := writeDiffIndex(w, pver, i == 0, prev, index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIndexes reads differentially encoded indexes of a single transaction
+// tree from r.
+func readIndexes(r io.Reader, pver uint32, treeName string) ([]uint32, error) {
+	maxTxPerTree := MaxTxPerTxTree(pver)
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxTxPerTree {
+		str := fmt.Sprintf("too many %s indexes to fit into a block "+
+			"[count %d, max %d]", treeName, count, maxTxPerTree)
+		return nil, messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+	return readDiffIndexes(r, pver, count, maxTxPerTree, treeName)
+}
+
+// BtcDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	msg.Indexes, err = readIndexes(r, pver, "regular")
+	if err != nil {
+		return err
+	}
+	msg.SIndexes, err = readIndexes(r, pver, "stake")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	err = writeIndexes(w, pver, msg.Indexes)
+	if err != nil {
+		return err
+	}
+	return writeIndexes(w, pver, msg.SIndexes)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes and the indexes for each tree.
+	maxTxPerTree := uint32(MaxTxPerTxTree(pver))
+	return chainhash.HashSize + 2*(MaxVarIntPayload+
+		maxTxPerTree*MaxVarIntPayload)
+}
+
+// NewMsgGetBlockTxn returns a new getblocktxn message that conforms to the
+// Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *chainhash.Hash, indexes, sIndexes []uint32) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   indexes,
+		SIndexes:  sIndexes,
+	}
+}
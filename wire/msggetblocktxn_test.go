@@ -0,0 +1,84 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode
+// including the differential encoding of the indexes.
+func TestGetBlockTxnWire(t *testing.T) {
+	pver := ProtocolVersion
+	hash := chainhash.Hash{0x01, 0x02}
+	msg := NewMsgGetBlockTxn(&hash, []uint32{1, 2, 5}, []uint32{3})
+
+	// Ensure the command is expected value.
+	wantCmd := "getblocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgGetBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	wantBuf := append(hash[:],
+		0x03,             // Num regular indexes
+		0x01, 0x00, 0x02, // Regular indexes 1, 2, 5
+		0x01, // Num stake indexes
+		0x03, // Stake index 3
+	)
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	var readMsg MsgGetBlockTxn
+	if err := readMsg.BtcDecode(bytes.NewReader(wantBuf), pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestGetBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgGetBlockTxn to confirm error paths work correctly.
+func TestGetBlockTxnWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	hash := chainhash.Hash{0x01}
+
+	// Ensure indexes which are not strictly increasing are rejected.
+	msg := NewMsgGetBlockTxn(&hash, []uint32{2, 2}, nil)
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, pver)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcEncode: unexpected error for duplicate index - "+
+			"got %v, want MessageError", err)
+	}
+
+	// Ensure the message is rejected for older protocol versions.
+	msg = NewMsgGetBlockTxn(&hash, []uint32{1}, nil)
+	buf.Reset()
+	err = msg.BtcEncode(&buf, CompactBlocksVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcEncode: unexpected error for old protocol version "+
+			"- got %v, want MessageError", err)
+	}
+	var readMsg MsgGetBlockTxn
+	err = readMsg.BtcDecode(bytes.NewReader(hash[:]), CompactBlocksVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: unexpected error for old protocol version "+
+			"- got %v, want MessageError", err)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSendAddrV2 tests the MsgSendAddrV2 API against the latest protocol
+// version and the version before it was added.
+func TestSendAddrV2(t *testing.T) {
+	msg := NewMsgSendAddrV2()
+
+	// Ensure the command is expected value.
+	wantCmd := "sendaddrv2"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgSendAddrV2: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure the message has no payload for the latest protocol version.
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, ProtocolVersion); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if buf.Len() != 0 || msg.MaxPayloadLength(ProtocolVersion) != 0 {
+		t.Fatalf("unexpected payload %x", buf.Bytes())
+	}
+	if err := msg.BtcDecode(&buf, ProtocolVersion); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+
+	// Ensure the message is rejected before it was added.
+	pver := AddrV2Version - 1
+	if err := msg.BtcEncode(&buf, pver); err == nil {
+		t.Errorf("BtcEncode: encoded message for protocol version %d",
+			pver)
+	}
+	if err := msg.BtcDecode(&buf, pver); err == nil {
+		t.Errorf("BtcDecode: decoded message for protocol version %d",
+			pver)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// CmpctBlockVersion is the version of the compact block encoding this package
+// supports.
+const CmpctBlockVersion uint64 = 1
+
+// MsgSendCmpct implements the Message interface and represents a sendcmpct
+// message.  It is used to signal that the sending peer supports compact blocks
+// of the specified version and whether or not it would like new blocks to be
+// announced with cmpctblock messages rather than inventory vectors or headers.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgSendCmpct struct {
+	AnnounceUsingCmpctBlock bool
+	CmpctBlockVersion       uint64
+}
+
+// BtcDecode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcDecode", str)
+	}
+
+	return readElements(r, &msg.AnnounceUsingCmpctBlock,
+		&msg.CmpctBlockVersion)
+}
+
+// BtcEncode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcEncode", str)
+	}
+
+	return writeElements(w, msg.AnnounceUsingCmpctBlock,
+		msg.CmpctBlockVersion)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	// 1 byte announce flag + 8 bytes version.
+	return 9
+}
+
+// NewMsgSendCmpct returns a new sendcmpct message that conforms to the Message
+// interface.  See MsgSendCmpct for details.
+func NewMsgSendCmpct(announce bool, version uint64) *MsgSendCmpct {
+	return &MsgSendCmpct{
+		AnnounceUsingCmpctBlock: announce,
+		CmpctBlockVersion:       version,
+	}
+}
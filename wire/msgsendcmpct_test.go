@@ -0,0 +1,112 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendCmpctWire tests the MsgSendCmpct wire encode and decode for the
+// latest protocol version.
+func TestSendCmpctWire(t *testing.T) {
+	msg := NewMsgSendCmpct(true, CmpctBlockVersion)
+
+	// Ensure the command is expected value.
+	wantCmd := "sendcmpct"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgSendCmpct: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	pver := ProtocolVersion
+	wantPayload := uint32(9)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Encode the message to wire format.
+	wantBuf := []byte{
+		0x01,                                           // Announce using cmpctblock
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Version
+	}
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), wantBuf) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(wantBuf))
+	}
+
+	// Decode the message from wire format.
+	var readMsg MsgSendCmpct
+	if err := readMsg.BtcDecode(bytes.NewReader(wantBuf), pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestSendCmpctWireErrors performs negative tests against wire encode and
+// decode of MsgSendCmpct to confirm error paths work correctly.
+func TestSendCmpctWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoCmpct := CompactBlocksVersion - 1
+	wireErr := &MessageError{}
+
+	baseSendCmpct := NewMsgSendCmpct(true, CmpctBlockVersion)
+	baseSendCmpctEncoded := []byte{
+		0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	tests := []struct {
+		in       *MsgSendCmpct // Value to encode
+		buf      []byte        // Wire encoding
+		pver     uint32        // Protocol version for wire encoding
+		max      int           // Max size of fixed buffer to induce errors
+		writeErr error         // Expected write error
+		readErr  error         // Expected read error
+	}{
+		// Force error in announce flag.
+		{baseSendCmpct, baseSendCmpctEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in version.
+		{baseSendCmpct, baseSendCmpctEncoded, pver, 1, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseSendCmpct, baseSendCmpctEncoded, pverNoCmpct, 9, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// Decode from wire format.
+		var msg MsgSendCmpct
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+	}
+}
@@ -7,8 +7,10 @@
 package wire
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"time"
@@ -48,6 +50,102 @@ type NetAddress struct {
 	// Port the peer is using.  This is encoded in big endian on the wire
 	// which differs from most everything else.
 	Port uint16
+
+	// Network identifies the network of addresses which are not fully
+	// described by their IP address.  It is zero for IPv4, IPv6 and Tor v2
+	// addresses since their network is implied by the IP address.
+	Network NetworkID
+
+	// Addr is the raw address of peers on networks which do not use IP
+	// addresses, such as Tor v3 and I2P.  It is nil for all other networks.
+	Addr []byte
+}
+
+// NetworkID identifies the network of an address as encoded in the addrv2
+// message.
+type NetworkID uint8
+
+const (
+	// NetworkIPv4 identifies an IPv4 address.
+	NetworkIPv4 NetworkID = 1
+
+	// NetworkIPv6 identifies an IPv6 address.
+	NetworkIPv6 NetworkID = 2
+
+	// NetworkTorV2 identifies a Tor v2 hidden service address.  They are
+	// represented by an IPv6 address in the OnionCat range.
+	NetworkTorV2 NetworkID = 3
+
+	// NetworkTorV3 identifies a Tor v3 hidden service address.  The
+	// address is the 32-byte ed25519 public key of the service.
+	NetworkTorV3 NetworkID = 4
+
+	// NetworkI2P identifies an I2P address.  The address is the 32-byte
+	// SHA256 hash of the destination.
+	NetworkI2P NetworkID = 5
+
+	// NetworkCJDNS identifies a CJDNS address.  The address is an IPv6
+	// address in the fc00::/8 range.
+	NetworkCJDNS NetworkID = 6
+)
+
+// networkAddrSizes houses the length of the encoded addresses of the known
+// networks.
+var networkAddrSizes = map[NetworkID]int{
+	NetworkIPv4:  4,
+	NetworkIPv6:  16,
+	NetworkTorV2: 10,
+	NetworkTorV3: 32,
+	NetworkI2P:   32,
+	NetworkCJDNS: 16,
+}
+
+// Map of network IDs back to their names for pretty printing.
+var networkStrings = map[NetworkID]string{
+	NetworkIPv4:  "IPv4",
+	NetworkIPv6:  "IPv6",
+	NetworkTorV2: "TorV2",
+	NetworkTorV3: "TorV3",
+	NetworkI2P:   "I2P",
+	NetworkCJDNS: "CJDNS",
+}
+
+// String returns the NetworkID in human-readable form.
+func (n NetworkID) String() string {
+	if s, ok := networkStrings[n]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown NetworkID (%d)", uint8(n))
+}
+
+// onionCatPrefix is the IPv6 prefix used to represent Tor v2 hidden service
+// addresses as IP addresses.
+var onionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+// NetworkID returns the network of the address.  The network of addresses
+// without an explicit network is determined from their IP address.
+func (na *NetAddress) NetworkID() NetworkID {
+	if na.Network != 0 {
+		return na.Network
+	}
+	if na.IP.To4() != nil {
+		return NetworkIPv4
+	}
+	if bytes.HasPrefix(na.IP, onionCatPrefix) {
+		return NetworkTorV2
+	}
+	return NetworkIPv6
+}
+
+// IsLegacy returns whether the address can be encoded in the legacy 16-byte IP
+// address format used by the addr and version messages.  Addresses on all
+// other networks may only be relayed with the addrv2 message.
+func (na *NetAddress) IsLegacy() bool {
+	switch na.NetworkID() {
+	case NetworkIPv4, NetworkIPv6, NetworkTorV2:
+		return true
+	}
+	return false
 }
 
 // HasService returns whether the specified service is supported by the address.
@@ -135,8 +233,15 @@ func readNetAddress(r io.Reader, pver uint32, na *NetAddress, ts bool) error {
 
 // writeNetAddress serializes a NetAddress to w depending on the protocol
 // version and whether or not the timestamp is included per ts.  Some messages
-// like version do not include the timestamp.
+// like version do not include the timestamp.  An error is returned for
+// addresses which can only be encoded with writeNetAddressV2.
 func writeNetAddress(w io.Writer, pver uint32, na *NetAddress, ts bool) error {
+	if !na.IsLegacy() {
+		str := fmt.Sprintf("%v address can only be encoded in an "+
+			"addrv2 message", na.NetworkID())
+		return messageError("writeNetAddress", str)
+	}
+
 	// NOTE: The Commercium protocol uses a uint32 for the timestamp so it will
 	// stop working somewhere around 2106.  Also timestamp wasn't added until
 	// until protocol version >= NetAddressTimeVersion.
@@ -160,3 +265,135 @@ func writeNetAddress(w io.Writer, pver uint32, na *NetAddress, ts bool) error {
 	// Sigh.  Commercium protocol mixes little and big endian.
 	return binary.Write(w, bigEndian, na.Port)
 }
+
+// maxNetAddressV2Payload is the max payload size for a NetAddress encoded in an
+// addrv2 message.  Timestamp 4 bytes + services varint 9 bytes + network ID
+// 1 byte + address length varint 3 bytes + max address 512 bytes + port
+// 2 bytes.
+const maxNetAddressV2Payload = 4 + MaxVarIntPayload + 1 + 3 +
+	maxNetAddressV2Size + 2
+
+// maxNetAddressV2Size is the maximum size of an address encoded in an addrv2
+// message.  Addresses on unknown networks may use any size up to it.
+const maxNetAddressV2Size = 512
+
+// readNetAddressV2 reads a NetAddress from r encoded as in the addrv2 message.
+// Addresses on unknown networks are read without error such that they can be
+// ignored by the caller, while addresses on known networks with an invalid
+// length are rejected.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddress) error {
+	var timestamp uint32Time
+	err := readElement(r, &timestamp)
+	if err != nil {
+		return err
+	}
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	var network NetworkID
+	err = readElement(r, (*uint8)(&network))
+	if err != nil {
+		return err
+	}
+	addr, err := ReadVarBytes(r, pver, maxNetAddressV2Size, "address")
+	if err != nil {
+		return err
+	}
+	// Sigh.  Commercium protocol mixes little and big endian.
+	port, err := binarySerializer.Uint16(r, bigEndian)
+	if err != nil {
+		return err
+	}
+
+	if size, ok := networkAddrSizes[network]; ok && len(addr) != size {
+		str := fmt.Sprintf("invalid %v address length [got %d, want %d]",
+			network, len(addr), size)
+		return messageError("readNetAddressV2", str)
+	}
+
+	*na = NetAddress{
+		Timestamp: time.Time(timestamp),
+		Services:  ServiceFlag(services),
+		Port:      port,
+	}
+	switch network {
+	case NetworkIPv4:
+		na.IP = net.IPv4(addr[0], addr[1], addr[2], addr[3])
+
+	case NetworkIPv6:
+		// Addresses in the OnionCat range are only valid as Tor v2
+		// addresses.
+		if bytes.HasPrefix(addr, onionCatPrefix) {
+			str := "Tor v2 address encoded as an IPv6 address"
+			return messageError("readNetAddressV2", str)
+		}
+		na.IP = net.IP(addr)
+
+	case NetworkTorV2:
+		na.IP = net.IP(append(append([]byte(nil), onionCatPrefix...),
+			addr...))
+
+	case NetworkCJDNS:
+		if addr[0] != 0xfc {
+			str := "CJDNS address outside of the fc00::/8 range"
+			return messageError("readNetAddressV2", str)
+		}
+		na.IP = net.IP(addr)
+		na.Network = network
+
+	default:
+		na.Network = network
+		na.Addr = addr
+	}
+	return nil
+}
+
+// writeNetAddressV2 serializes a NetAddress to w as encoded in the addrv2
+// message.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddress) error {
+	network := na.NetworkID()
+	var addr []byte
+	switch network {
+	case NetworkIPv4:
+		addr = na.IP.To4()
+
+	case NetworkIPv6, NetworkCJDNS:
+		// Ensure to always write 16 bytes even if the ip is nil.
+		addr = make([]byte, 16)
+		copy(addr, na.IP.To16())
+
+	case NetworkTorV2:
+		addr = na.IP[len(onionCatPrefix):]
+
+	default:
+		addr = na.Addr
+	}
+	if size, ok := networkAddrSizes[network]; (ok && len(addr) != size) ||
+		len(addr) > maxNetAddressV2Size {
+
+		str := fmt.Sprintf("invalid %v address length %d", network,
+			len(addr))
+		return messageError("writeNetAddressV2", str)
+	}
+
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+	err = WriteVarInt(w, pver, uint64(na.Services))
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, uint8(network))
+	if err != nil {
+		return err
+	}
+	err = WriteVarBytes(w, pver, addr)
+	if err != nil {
+		return err
+	}
+
+	// Sigh.  Commercium protocol mixes little and big endian.
+	return binary.Write(w, bigEndian, na.Port)
+}
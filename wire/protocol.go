@@ -18,7 +18,7 @@ const (
 	InitialProcotolVersion uint32 = 1
 
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 6
+	ProtocolVersion uint32 = 8
 
 	// NodeBloomVersion is the protocol version which added the SFNodeBloom
 	// service flag.
@@ -40,6 +40,14 @@ const (
 	// flag and the cfheaders, cfilter, cftypes, getcfheaders, getcfilter and
 	// getcftypes messages.
 	NodeCFVersion uint32 = 6
+
+	// CompactBlocksVersion is the protocol version which adds the
+	// sendcmpct, cmpctblock, getblocktxn and blocktxn messages.
+	CompactBlocksVersion uint32 = 7
+
+	// AddrV2Version is the protocol version which adds the addrv2 and
+	// sendaddrv2 messages.
+	AddrV2Version uint32 = 8
 )
 
 // ServiceFlag identifies services supported by a Commercium peer.
@@ -56,13 +64,28 @@ const (
 	// SFNodeCF is a flag used to indicate a peer supports committed
 	// filters (CFs).
 	SFNodeCF
+
+	// SFNodeNetworkLimited is a flag used to indicate a peer is a pruned
+	// full node which is only capable of serving the most recent blocks.
+	SFNodeNetworkLimited
+
+	// SFNodeV2Transport is a flag used to indicate a peer supports the
+	// encrypted and authenticated v2 transport.
+	SFNodeV2Transport
+
+	// SFNodeDandelion is a flag used to indicate a peer participates in
+	// the stem phase of Dandelion++ transaction relay.
+	SFNodeDandelion
 )
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeBloom:   "SFNodeBloom",
-	SFNodeCF:      "SFNodeCF",
+	SFNodeNetwork:        "SFNodeNetwork",
+	SFNodeBloom:          "SFNodeBloom",
+	SFNodeCF:             "SFNodeCF",
+	SFNodeNetworkLimited: "SFNodeNetworkLimited",
+	SFNodeV2Transport:    "SFNodeV2Transport",
+	SFNodeDandelion:      "SFNodeDandelion",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -71,6 +94,9 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeNetwork,
 	SFNodeBloom,
 	SFNodeCF,
+	SFNodeNetworkLimited,
+	SFNodeV2Transport,
+	SFNodeDandelion,
 }
 
 // String returns the ServiceFlag in human-readable form.
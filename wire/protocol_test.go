@@ -18,7 +18,10 @@ func TestServiceFlagStringer(t *testing.T) {
 		{SFNodeNetwork, "SFNodeNetwork"},
 		{SFNodeBloom, "SFNodeBloom"},
 		{SFNodeCF, "SFNodeCF"},
-		{0xffffffff, "SFNodeNetwork|SFNodeBloom|SFNodeCF|0xfffffff8"},
+		{SFNodeNetworkLimited, "SFNodeNetworkLimited"},
+		{SFNodeV2Transport, "SFNodeV2Transport"},
+		{SFNodeDandelion, "SFNodeDandelion"},
+		{0xffffffff, "SFNodeNetwork|SFNodeBloom|SFNodeCF|SFNodeNetworkLimited|SFNodeV2Transport|SFNodeDandelion|0xffffffc0"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -0,0 +1,177 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// v2LongCommandID is the message type ID which indicates the full command of a
+// message follows in the contents of a v2 transport packet.
+const v2LongCommandID = 0
+
+// v2MessageCommands houses the commands of the messages which are identified by
+// a single byte short ID in the v2 transport.  The short ID of a command is its
+// index in the list plus one since zero is reserved for v2LongCommandID.  New
+// commands must only ever be appended so the IDs of existing ones do not change.
+var v2MessageCommands = []string{
+	CmdAddr,
+	CmdBlock,
+	CmdBlockTxn,
+	CmdCmpctBlock,
+	CmdFeeFilter,
+	CmdFilterAdd,
+	CmdFilterClear,
+	CmdFilterLoad,
+	CmdGetBlocks,
+	CmdGetBlockTxn,
+	CmdGetData,
+	CmdGetHeaders,
+	CmdHeaders,
+	CmdInv,
+	CmdMemPool,
+	CmdMerkleBlock,
+	CmdNotFound,
+	CmdPing,
+	CmdPong,
+	CmdSendCmpct,
+	CmdTx,
+	CmdGetCFilter,
+	CmdCFilter,
+	CmdGetCFHeaders,
+	CmdCFHeaders,
+	CmdGetCFTypes,
+	CmdCFTypes,
+	CmdMiningState,
+	CmdGetMiningState,
+	CmdDandelionTx,
+	CmdAddrV2,
+}
+
+// v2MessageIDs maps the commands in v2MessageCommands to their short IDs.
+var v2MessageIDs = func() map[string]byte {
+	ids := make(map[string]byte, len(v2MessageCommands))
+	for i, cmd := range v2MessageCommands {
+		ids[cmd] = byte(i + 1)
+	}
+	return ids
+}()
+
+// EncodeMessageV2 encodes the passed message into the contents of a v2
+// transport packet.  The contents consist of the single byte short ID of the
+// message type followed by the message payload.  Messages without a short ID
+// use an ID of zero followed by the full zero padded command instead.
+func EncodeMessageV2(msg Message, pver uint32) ([]byte, error) {
+	cmd := msg.Command()
+	if len(cmd) > CommandSize {
+		str := fmt.Sprintf("command [%s] is too long [max %v]",
+			cmd, CommandSize)
+		return nil, messageError("EncodeMessageV2", str)
+	}
+
+	var bw bytes.Buffer
+	if id, ok := v2MessageIDs[cmd]; ok {
+		bw.WriteByte(id)
+	} else {
+		var command [CommandSize]byte
+		copy(command[:], cmd)
+		bw.WriteByte(v2LongCommandID)
+		bw.Write(command[:])
+	}
+	headerLen := bw.Len()
+
+	// Encode the message payload.
+	if err := msg.BtcEncode(&bw, pver); err != nil {
+		return nil, err
+	}
+	lenp := bw.Len() - headerLen
+
+	// Enforce maximum overall message payload.
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return nil, messageError("EncodeMessageV2", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, cmd, mpl)
+		return nil, messageError("EncodeMessageV2", str)
+	}
+
+	return bw.Bytes(), nil
+}
+
+// SplitMessageV2 splits the contents of a v2 transport packet as encoded by
+// EncodeMessageV2 into the command and the raw payload of the message without
+// decoding the payload.
+func SplitMessageV2(contents []byte) (string, []byte, error) {
+	if len(contents) == 0 {
+		return "", nil, messageError("SplitMessageV2",
+			"message type is missing")
+	}
+
+	// Determine the command from the short ID or the full command that
+	// follows it.
+	payload := contents[1:]
+	if id := contents[0]; id != v2LongCommandID {
+		if int(id) > len(v2MessageCommands) {
+			str := fmt.Sprintf("unknown short message type ID %d", id)
+			return "", nil, messageError("SplitMessageV2", str)
+		}
+		return v2MessageCommands[id-1], payload, nil
+	}
+	if len(payload) < CommandSize {
+		return "", nil, messageError("SplitMessageV2",
+			"message command is truncated")
+	}
+	command := string(bytes.TrimRight(payload[:CommandSize], "\x00"))
+	return command, payload[CommandSize:], nil
+}
+
+// DecodeMessageV2 decodes the contents of a v2 transport packet as encoded by
+// EncodeMessageV2 into a message for the provided protocol version.  It returns
+// the parsed Message and the raw bytes which comprise its payload.
+func DecodeMessageV2(contents []byte, pver uint32) (Message, []byte, error) {
+	command, payload, err := SplitMessageV2(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check for malformed commands.
+	if !utf8.ValidString(command) {
+		str := fmt.Sprintf("invalid command %v", []byte(command))
+		return nil, nil, messageError("DecodeMessageV2", str)
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, nil, messageError("DecodeMessageV2", err.Error())
+	}
+
+	// Check for maximum length based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(len(payload)) > mpl {
+		str := fmt.Sprintf("payload exceeds max length - packet "+
+			"contains %v bytes, but max payload size for "+
+			"messages of type [%v] is %v.", len(payload), command, mpl)
+		return nil, nil, messageError("DecodeMessageV2", str)
+	}
+
+	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
+	// MsgVersion BtcDecode function requires it.
+	if err := msg.BtcDecode(bytes.NewBuffer(payload), pver); err != nil {
+		return nil, nil, err
+	}
+
+	return msg, payload, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 The Commercium developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/CommerciumBlockchain/cmmd/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestMessageV2 tests the EncodeMessageV2, SplitMessageV2 and DecodeMessageV2
+// API.
+func TestMessageV2(t *testing.T) {
+	pver := ProtocolVersion
+
+	tests := []struct {
+		in     Message // Value to encode
+		typeID []byte  // Expected encoded message type
+	}{
+		// Messages with short IDs.
+		{NewMsgPing(123123), []byte{0x12}},
+		{NewMsgGetBlocks(&chainhash.Hash{}), []byte{0x09}},
+		{&testBlock, []byte{0x02}},
+
+		// Messages without short IDs.
+		{NewMsgVerAck(), []byte("\x00verack\x00\x00\x00\x00\x00\x00")},
+		{NewMsgSendHeaders(), []byte("\x00sendheaders\x00")},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to the v2 format and ensure the message type is as
+		// expected.
+		contents, err := EncodeMessageV2(test.in, pver)
+		if err != nil {
+			t.Errorf("EncodeMessageV2 #%d error %v", i, err)
+			continue
+		}
+		if !bytes.HasPrefix(contents, test.typeID) {
+			t.Errorf("EncodeMessageV2 #%d\n got: %s want: %s", i,
+				spew.Sdump(contents[:len(test.typeID)]),
+				spew.Sdump(test.typeID))
+			continue
+		}
+
+		// Decode from the v2 format and ensure the message and payload
+		// match the original.
+		msg, payload, err := DecodeMessageV2(contents, pver)
+		if err != nil {
+			t.Errorf("DecodeMessageV2 #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg, test.in) {
+			t.Errorf("DecodeMessageV2 #%d\n got: %v want: %v", i,
+				spew.Sdump(msg), spew.Sdump(test.in))
+			continue
+		}
+		if !bytes.Equal(payload, contents[len(test.typeID):]) {
+			t.Errorf("DecodeMessageV2 #%d unexpected payload", i)
+			continue
+		}
+
+		// Split the v2 format and ensure the command and payload match
+		// the original without decoding the payload.
+		command, payload, err := SplitMessageV2(contents)
+		if err != nil {
+			t.Errorf("SplitMessageV2 #%d error %v", i, err)
+			continue
+		}
+		if command != test.in.Command() ||
+			!bytes.Equal(payload, contents[len(test.typeID):]) {
+
+			t.Errorf("SplitMessageV2 #%d unexpected command %q or "+
+				"payload", i, command)
+			continue
+		}
+	}
+}
+
+// TestMessageV2Errors performs negative tests against decoding the contents of
+// v2 transport packets to confirm error paths work correctly.
+func TestMessageV2Errors(t *testing.T) {
+	pver := ProtocolVersion
+
+	tests := []struct {
+		name     string
+		contents []byte
+	}{
+		{"empty contents", nil},
+		{"unknown short ID", []byte{0xff}},
+		{"truncated command", []byte("\x00verack")},
+		{"unknown command", []byte("\x00bogus\x00\x00\x00\x00\x00\x00\x00")},
+		{"payload too large", append([]byte("\x00verack\x00\x00\x00\x00\x00\x00"),
+			0x01)},
+		{"truncated payload", []byte{0x12, 0x01}},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		_, _, err := DecodeMessageV2(test.contents, pver)
+		if err == nil {
+			t.Errorf("%s: DecodeMessageV2 did not return an error",
+				test.name)
+		}
+	}
+}